@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+)
+
+// client calls the REST API of a CPMS with the API key of a profile
+type client struct {
+	profile *profile
+	http    *http.Client
+	json    bool // Print the response data as JSON instead of a table
+}
+
+func newClient(p *profile, printJSON bool) *client {
+	return &client{
+		profile: p,
+		http:    &http.Client{Timeout: 60 * time.Second},
+		json:    printJSON,
+	}
+}
+
+// do calls an API endpoint with an optional JSON body and decodes the data of the response into out
+func (c *client) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.profile.URL+"/api/v1"+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.profile.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.profile.APIKey)
+	}
+	if c.profile.Operator != "" {
+		req.Header.Set("X-Operator", c.profile.Operator)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		var errResp apierror.Response
+		if err := json.Unmarshal(data, &errResp); err == nil && errResp.Error != nil {
+			return fmt.Errorf("%s (%s, HTTP %d)", errResp.Error.Message, errResp.Error.Code, resp.StatusCode)
+		}
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(data))
+	}
+
+	var envelope struct {
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	if out != nil && len(envelope.Data) > 0 {
+		if err := json.Unmarshal(envelope.Data, out); err != nil {
+			return fmt.Errorf("decoding response data: %w", err)
+		}
+	}
+	return nil
+}
+
+// printJSON prints the data of a response when -json was given and reports whether it did
+func (c *client) printJSON(v interface{}) (bool, error) {
+	if !c.json {
+		return false, nil
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return true, encoder.Encode(v)
+}
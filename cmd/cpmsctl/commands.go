@@ -0,0 +1,330 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// timeFormat is the format of the times in tables
+const timeFormat = "2006-01-02 15:04:05"
+
+// formatTime formats a time in the local zone, or - for a zero time
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(timeFormat)
+}
+
+// newTable creates a writer aligning the tab-separated columns of a table
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+}
+
+// listChargePoints prints the charge points
+func listChargePoints(c *client, args []string) error {
+	var limit int
+	var connected string
+	flags := commandFlags("chargepoints", "[flags]")
+	flags.IntVar(&limit, "limit", 100, "Maximum number of charge points")
+	flags.StringVar(&connected, "connected", "", "Only connected (true) or disconnected (false) charge points")
+	if _, err := parseArgs(flags, args, 0); err != nil {
+		return err
+	}
+
+	query := url.Values{"limit": {strconv.Itoa(limit)}, "sort": {"id"}}
+	if connected != "" {
+		query.Set("isConnected", connected)
+	}
+
+	var chargePoints []*models.ChargePoint
+	if err := c.do(http.MethodGet, "/chargepoints?"+query.Encode(), nil, &chargePoints); err != nil {
+		return err
+	}
+	if ok, err := c.printJSON(chargePoints); ok {
+		return err
+	}
+
+	w := newTable()
+	fmt.Fprintln(w, "ID\tVENDOR\tMODEL\tFIRMWARE\tCONNECTED\tLAST HEARTBEAT")
+	for _, cp := range chargePoints {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\n", cp.ID, cp.Vendor, cp.Model, cp.FirmwareVersion, cp.IsConnected, formatTime(cp.LastHeartbeat))
+	}
+	return w.Flush()
+}
+
+// tailMessages prints the latest OCPP messages of a charge point, oldest first, and with -f keeps polling for new ones
+func tailMessages(c *client, args []string) error {
+	var lines int
+	var follow bool
+	var interval time.Duration
+	flags := commandFlags("messages", "[flags] CHARGEPOINT")
+	flags.IntVar(&lines, "n", 20, "Number of messages to show")
+	flags.BoolVar(&follow, "f", false, "Keep printing new messages until interrupted")
+	flags.DurationVar(&interval, "interval", 2*time.Second, "Polling interval with -f")
+	rest, err := parseArgs(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	path := "/chargepoints/" + url.PathEscape(rest[0]) + "/messages?limit="
+
+	// The API returns the newest messages first
+	var messages []*models.OCPPMessage
+	if err := c.do(http.MethodGet, path+strconv.Itoa(lines), nil, &messages); err != nil {
+		return err
+	}
+
+	lastID := 0
+	printNew := func(messages []*models.OCPPMessage) error {
+		for i := len(messages) - 1; i >= 0; i-- {
+			msg := messages[i]
+			if msg.ID <= lastID {
+				continue
+			}
+			lastID = msg.ID
+			if ok, err := c.printJSON(msg); ok {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Printf("%s %-8s %-8s %-28s %s\n", formatTime(msg.Timestamp), msg.Direction, msg.MessageType, msg.Action, msg.Payload)
+		}
+		return nil
+	}
+	if err := printNew(messages); err != nil {
+		return err
+	}
+
+	for follow {
+		time.Sleep(interval)
+		messages = nil
+		if err := c.do(http.MethodGet, path+"100", nil, &messages); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			continue
+		}
+		if err := printNew(messages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetChargePoint sends a Soft or, with -hard, a Hard reset to a charge point
+func resetChargePoint(c *client, args []string) error {
+	var hard bool
+	flags := commandFlags("reset", "[flags] CHARGEPOINT")
+	flags.BoolVar(&hard, "hard", false, "Send a Hard reset instead of a Soft reset")
+	rest, err := parseArgs(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	resetType := "Soft"
+	if hard {
+		resetType = "Hard"
+	}
+
+	var cmd models.Command
+	body := map[string]string{"type": resetType}
+	if err := c.do(http.MethodPost, "/chargepoints/"+url.PathEscape(rest[0])+"/reset", body, &cmd); err != nil {
+		return err
+	}
+	return printCommand(c, &cmd)
+}
+
+// remoteStart starts a transaction on a connector of a charge point for an idTag
+func remoteStart(c *client, args []string) error {
+	var connectorID int
+	var idTag string
+	flags := commandFlags("start", "[flags] CHARGEPOINT")
+	flags.IntVar(&connectorID, "connector", 1, "Connector to start the transaction on")
+	flags.StringVar(&idTag, "idtag", "", "idTag to start the transaction for (required)")
+	rest, err := parseArgs(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	if idTag == "" {
+		flags.Usage()
+		return errUsage
+	}
+
+	var cmd models.Command
+	body := map[string]interface{}{"connectorId": connectorID, "idTag": idTag}
+	if err := c.do(http.MethodPost, "/chargepoints/"+url.PathEscape(rest[0])+"/starttransaction", body, &cmd); err != nil {
+		return err
+	}
+	return printCommand(c, &cmd)
+}
+
+// printCommand prints a command sent to a charge point
+func printCommand(c *client, cmd *models.Command) error {
+	if ok, err := c.printJSON(cmd); ok {
+		return err
+	}
+	fmt.Printf("%s sent to %s as command %d, status %s\n", cmd.Action, cmd.ChargePointID, cmd.ID, cmd.Status)
+	return nil
+}
+
+// manageTokens lists, saves and deletes idTags
+func manageTokens(c *client, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: cpmsctl tokens list|set|delete")
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		if _, err := parseArgs(commandFlags("tokens list", ""), args[1:], 0); err != nil {
+			return err
+		}
+
+		var tags []*models.IdTag
+		if err := c.do(http.MethodGet, "/idtags", nil, &tags); err != nil {
+			return err
+		}
+		if ok, err := c.printJSON(tags); ok {
+			return err
+		}
+
+		w := newTable()
+		fmt.Fprintln(w, "IDTAG\tTENANT\tSTATUS\tPARENT\tEXPIRES")
+		for _, tag := range tags {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", tag.IdTag, tag.TenantID, tag.Status, tag.ParentIdTag, formatTime(tag.ExpiryDate))
+		}
+		return w.Flush()
+
+	case "set":
+		var tenantID, parent, expiry string
+		var blocked bool
+		flags := commandFlags("tokens set", "[flags] IDTAG")
+		flags.StringVar(&tenantID, "tenant", "", "Tenant of the idTag, required with the admin key")
+		flags.StringVar(&parent, "parent", "", "Parent idTag grouping the idTag")
+		flags.StringVar(&expiry, "expires", "", "Expiry date in RFC3339 format")
+		flags.BoolVar(&blocked, "blocked", false, "Block the idTag instead of accepting it")
+		rest, err := parseArgs(flags, args[1:], 1)
+		if err != nil {
+			return err
+		}
+
+		status := "Accepted"
+		if blocked {
+			status = "Blocked"
+		}
+		body := map[string]string{
+			"tenantId":    tenantID,
+			"parentIdTag": parent,
+			"status":      status,
+			"expiryDate":  expiry,
+		}
+
+		var tag models.IdTag
+		if err := c.do(http.MethodPut, "/idtags/"+url.PathEscape(rest[0]), body, &tag); err != nil {
+			return err
+		}
+		if ok, err := c.printJSON(&tag); ok {
+			return err
+		}
+		fmt.Printf("IdTag %s saved as %s\n", rest[0], status)
+		return nil
+
+	case "delete":
+		var tenantID string
+		flags := commandFlags("tokens delete", "[flags] IDTAG")
+		flags.StringVar(&tenantID, "tenant", "", "Tenant of the idTag, required with the admin key")
+		rest, err := parseArgs(flags, args[1:], 1)
+		if err != nil {
+			return err
+		}
+
+		path := "/idtags/" + url.PathEscape(rest[0])
+		if tenantID != "" {
+			path += "?tenantId=" + url.QueryEscape(tenantID)
+		}
+		if err := c.do(http.MethodDelete, path, nil, nil); err != nil {
+			return err
+		}
+		fmt.Printf("IdTag %s deleted\n", rest[0])
+		return nil
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown tokens command %q\n", args[0])
+		return errUsage
+	}
+}
+
+// manageAPIKeys lists, creates and revokes the API keys of a tenant
+func manageAPIKeys(c *client, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: cpmsctl apikeys list|create|revoke TENANT")
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		rest, err := parseArgs(commandFlags("apikeys list", "TENANT"), args[1:], 1)
+		if err != nil {
+			return err
+		}
+
+		var keys []*models.APIKey
+		if err := c.do(http.MethodGet, "/tenants/"+url.PathEscape(rest[0])+"/apikeys", nil, &keys); err != nil {
+			return err
+		}
+		if ok, err := c.printJSON(keys); ok {
+			return err
+		}
+
+		w := newTable()
+		fmt.Fprintln(w, "ID\tNAME\tCREATED\tREVOKED")
+		for _, key := range keys {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", key.ID, key.Name, formatTime(key.CreatedAt), formatTime(key.RevokedAt))
+		}
+		return w.Flush()
+
+	case "create":
+		var name string
+		flags := commandFlags("apikeys create", "[flags] TENANT")
+		flags.StringVar(&name, "name", "", "Name of the key (required)")
+		rest, err := parseArgs(flags, args[1:], 1)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			flags.Usage()
+			return errUsage
+		}
+
+		var key models.APIKey
+		if err := c.do(http.MethodPost, "/tenants/"+url.PathEscape(rest[0])+"/apikeys", map[string]string{"name": name}, &key); err != nil {
+			return err
+		}
+		if ok, err := c.printJSON(&key); ok {
+			return err
+		}
+		fmt.Printf("API key %d created, it is only shown once:\n%s\n", key.ID, key.Key)
+		return nil
+
+	case "revoke":
+		rest, err := parseArgs(commandFlags("apikeys revoke", "TENANT KEYID"), args[1:], 2)
+		if err != nil {
+			return err
+		}
+		if err := c.do(http.MethodDelete, "/tenants/"+url.PathEscape(rest[0])+"/apikeys/"+url.PathEscape(rest[1]), nil, nil); err != nil {
+			return err
+		}
+		fmt.Printf("API key %s revoked\n", rest[1])
+		return nil
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown apikeys command %q\n", args[0])
+		return errUsage
+	}
+}
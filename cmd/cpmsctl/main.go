@@ -0,0 +1,128 @@
+// Command cpmsctl administers a CPMS through its REST API: it lists charge points, tails their OCPP message
+// log, sends resets and remote starts, and manages idTags and API keys.
+//
+// The URL and API key of each environment are kept as named profiles in the cpmsctl config file, so one
+// operator can switch between e.g. staging and production with -profile. CPMSCTL_URL and CPMSCTL_API_KEY
+// take precedence over the profile, for scripts and CI.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: cpmsctl [flags] command [arguments]
+
+Commands:
+  profile list|use|set|delete           Manage the environments cpmsctl talks to
+  chargepoints                          List the charge points
+  messages CHARGEPOINT                  Show or follow the OCPP message log of a charge point
+  reset CHARGEPOINT                     Reset a charge point
+  start CHARGEPOINT                     Start a transaction remotely
+  tokens list|set|delete                Manage idTags
+  apikeys list|create|revoke TENANT     Manage the API keys of a tenant (admin key only)
+
+Run cpmsctl command -h for the flags of a command.
+
+Flags:
+`
+
+// errUsage reports invalid arguments after the usage of the command was printed
+var errUsage = errors.New("invalid arguments")
+
+// globals are the flags shared by all commands
+type globals struct {
+	configPath string
+	profile    string
+	json       bool
+}
+
+func main() {
+	var g globals
+	flags := flag.NewFlagSet("cpmsctl", flag.ExitOnError)
+	flags.StringVar(&g.configPath, "config", defaultConfigPath(), "Path to the cpmsctl config file with the profiles")
+	flags.StringVar(&g.profile, "profile", os.Getenv("CPMSCTL_PROFILE"), "Profile to use instead of the current profile")
+	flags.BoolVar(&g.json, "json", false, "Print the API response data as JSON")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(os.Args[1:])
+
+	args := flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	command, args := args[0], args[1:]
+
+	var err error
+	if command == "profile" {
+		err = runProfile(g, args)
+	} else {
+		err = runAPICommand(g, command, args)
+	}
+
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// runAPICommand runs a command against the API of the selected profile
+func runAPICommand(g globals, command string, args []string) error {
+	var run func(*client, []string) error
+	switch command {
+	case "chargepoints":
+		run = listChargePoints
+	case "messages":
+		run = tailMessages
+	case "reset":
+		run = resetChargePoint
+	case "start":
+		run = remoteStart
+	case "tokens":
+		run = manageTokens
+	case "apikeys":
+		run = manageAPIKeys
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q, run cpmsctl -h for the commands\n", command)
+		return errUsage
+	}
+
+	profile, err := resolveProfile(g)
+	if err != nil {
+		return err
+	}
+	return run(newClient(profile, g.json), args)
+}
+
+// commandFlags creates the flag set of a command, whose usage lists its arguments
+func commandFlags(name, arguments string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: cpmsctl %s %s\n", name, arguments)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseArgs parses the flags of a command and checks that exactly n arguments remain
+func parseArgs(flags *flag.FlagSet, args []string, n int) ([]string, error) {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		return nil, errUsage
+	}
+	if flags.NArg() != n {
+		flags.Usage()
+		return nil, errUsage
+	}
+	return flags.Args(), nil
+}
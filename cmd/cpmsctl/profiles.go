@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// profile is an environment cpmsctl talks to
+type profile struct {
+	URL      string `json:"url"`                // Base URL of the CPMS, e.g. https://cpms.example.com
+	APIKey   string `json:"apiKey"`             // Admin or tenant API key
+	Operator string `json:"operator,omitempty"` // Recorded as the actor of the changes, defaults to the OS user
+}
+
+// profileConfig is the cpmsctl config file
+type profileConfig struct {
+	Current  string              `json:"current"`
+	Profiles map[string]*profile `json:"profiles"`
+}
+
+// defaultConfigPath returns the path of the config file in the user's config directory
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "cpmsctl.json"
+	}
+	return filepath.Join(dir, "cpmsctl", "config.json")
+}
+
+// loadProfiles reads the config file, a missing file has no profiles
+func loadProfiles(path string) (*profileConfig, error) {
+	cfg := &profileConfig{Profiles: make(map[string]*profile)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]*profile)
+	}
+	return cfg, nil
+}
+
+// save writes the config file, readable only by the user as it holds API keys
+func (c *profileConfig) save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// resolveProfile returns the profile selected with -profile, or the current profile, with the settings
+// of the environment applied
+func resolveProfile(g globals) (*profile, error) {
+	cfg, err := loadProfiles(g.configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	name := g.profile
+	if name == "" {
+		name = cfg.Current
+	}
+
+	p := &profile{}
+	if name != "" {
+		found, ok := cfg.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %q", name)
+		}
+		*p = *found
+	}
+
+	if v := os.Getenv("CPMSCTL_URL"); v != "" {
+		p.URL = v
+	}
+	if v := os.Getenv("CPMSCTL_API_KEY"); v != "" {
+		p.APIKey = v
+	}
+	if p.Operator == "" {
+		p.Operator = os.Getenv("USER")
+	}
+
+	if p.URL == "" {
+		return nil, errors.New("no CPMS URL, add a profile with cpmsctl profile set or set CPMSCTL_URL")
+	}
+	return p, nil
+}
+
+// runProfile manages the profiles of the config file
+func runProfile(g globals, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: cpmsctl profile list|use|set|delete")
+		return errUsage
+	}
+
+	cfg, err := loadProfiles(g.configPath)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		names := make([]string, 0, len(cfg.Profiles))
+		for name := range cfg.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CURRENT\tNAME\tURL\tOPERATOR")
+		for _, name := range names {
+			current := ""
+			if name == cfg.Current {
+				current = "*"
+			}
+			p := cfg.Profiles[name]
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", current, name, p.URL, p.Operator)
+		}
+		return w.Flush()
+
+	case "use":
+		flags := commandFlags("profile use", "NAME")
+		rest, err := parseArgs(flags, args[1:], 1)
+		if err != nil {
+			return err
+		}
+		if _, ok := cfg.Profiles[rest[0]]; !ok {
+			return fmt.Errorf("unknown profile %q", rest[0])
+		}
+		cfg.Current = rest[0]
+		return cfg.save(g.configPath)
+
+	case "set":
+		var url, apiKey, operator string
+		flags := commandFlags("profile set", "[flags] NAME")
+		flags.StringVar(&url, "url", "", "Base URL of the CPMS")
+		flags.StringVar(&apiKey, "key", "", "API key, - to read it from stdin")
+		flags.StringVar(&operator, "operator", "", "Name recorded as the actor of changes")
+		rest, err := parseArgs(flags, args[1:], 1)
+		if err != nil {
+			return err
+		}
+
+		p, ok := cfg.Profiles[rest[0]]
+		if !ok {
+			p = &profile{}
+			cfg.Profiles[rest[0]] = p
+		}
+		if url != "" {
+			p.URL = strings.TrimSuffix(url, "/")
+		}
+		if apiKey == "-" {
+			// Keeps the key out of the shell history
+			if _, err := fmt.Scanln(&apiKey); err != nil {
+				return fmt.Errorf("reading API key: %w", err)
+			}
+		}
+		if apiKey != "" {
+			p.APIKey = apiKey
+		}
+		if operator != "" {
+			p.Operator = operator
+		}
+		if cfg.Current == "" {
+			cfg.Current = rest[0]
+		}
+		return cfg.save(g.configPath)
+
+	case "delete":
+		flags := commandFlags("profile delete", "NAME")
+		rest, err := parseArgs(flags, args[1:], 1)
+		if err != nil {
+			return err
+		}
+		if _, ok := cfg.Profiles[rest[0]]; !ok {
+			return fmt.Errorf("unknown profile %q", rest[0])
+		}
+		delete(cfg.Profiles, rest[0])
+		if cfg.Current == rest[0] {
+			cfg.Current = ""
+		}
+		return cfg.save(g.configPath)
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown profile command %q\n", args[0])
+		return errUsage
+	}
+}
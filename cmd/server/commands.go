@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/balu-dk/go-cpms/config"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/sirupsen/logrus"
+)
+
+// migrate applies the database schema and exits
+func migrate(args []string) {
+	configPath := parseFlags("migrate", args)
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load configuration")
+	}
+	if err := cfg.SetupLogger(); err != nil {
+		logrus.WithError(err).Fatal("Failed to set up logging")
+	}
+
+	if cfg.DBDriver != "postgres" {
+		logrus.Infof("Nothing to migrate for the %s database driver", cfg.DBDriver)
+		return
+	}
+
+	store, err := db.NewPostgresStore(cfg)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to connect to database")
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	if err := store.Migrate(ctx, cfg.TimescaleEnabled); err != nil {
+		logrus.WithError(err).Fatal("Failed to migrate database")
+	}
+	logrus.WithField("timescale", cfg.TimescaleEnabled).Info("Database schema is up to date")
+}
+
+// checkConfig validates the configuration, reporting all invalid settings, and exits
+func checkConfig(args []string) {
+	configPath := parseFlags("check-config", args)
+
+	if _, err := config.LoadConfig(configPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println("Configuration is valid")
+}
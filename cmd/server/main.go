@@ -1,78 +1,101 @@
 package main
 
 import (
-	"context"
+	"flag"
 	"fmt"
-	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
-
-	"github.com/balu-dk/go-cpms/config"
-	"github.com/balu-dk/go-cpms/internal/api"
-	"github.com/balu-dk/go-cpms/internal/db"
-	"github.com/balu-dk/go-cpms/internal/service"
-	"github.com/sirupsen/logrus"
+	"strings"
 )
 
-func main() {
-	// Load configuration
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		logrus.WithError(err).Fatal("Failed to load configuration")
-	}
+// version is the version of the build, set with -ldflags "-X main.version=..."
+var version = "dev"
 
-	// Setup logger
-	cfg.SetupLogger()
-	logrus.Info("Starting CPMS server")
+const usage = `Usage: server [command] [flags]
 
-	// Connect to database
-	store, err := db.NewPostgresStore(cfg)
-	if err != nil {
-		logrus.WithError(err).Fatal("Failed to connect to database")
-	}
-	defer store.Close()
+Commands:
+  serve         Run the CPMS (default)
+  migrate       Apply the database schema
+  check-config  Validate the configuration and exit
+  seed          Populate the database with demo charge points and transactions
+  version       Print the version
 
-	// Create CPMS service
-	cpms := service.NewCPMS(cfg, store)
+Flags:
+`
 
-	// Start OCPP central system
-	if err := cpms.Start(); err != nil {
-		logrus.WithError(err).Fatal("Failed to start OCPP central system")
+func main() {
+	command := "serve"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		serve(args)
+	case "migrate":
+		migrate(args)
+	case "check-config":
+		checkConfig(args)
+	case "seed":
+		seed(args)
+	case "version":
+		fmt.Println(version)
+	case "help":
+		newFlagSet(command, new(string), &settings{}).Usage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", command)
+		newFlagSet(command, new(string), &settings{}).Usage()
+		os.Exit(2)
 	}
+}
 
-	// Create API server
-	apiServer := api.NewAPI(cpms)
+// settings collects the KEY=VALUE settings of repeated -set flags
+type settings []string
 
-	// Start API server
-	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.APIPort),
-		Handler: apiServer,
+func (s *settings) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *settings) Set(value string) error {
+	if key, _, ok := strings.Cut(value, "="); !ok || key == "" {
+		return fmt.Errorf("expected KEY=VALUE, got %q", value)
 	}
+	*s = append(*s, value)
+	return nil
+}
 
-	// Run the server in a goroutine
-	go func() {
-		logrus.Infof("Starting API server on port %d", cfg.APIPort)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logrus.WithError(err).Fatal("Failed to start API server")
-		}
-	}()
+// newFlagSet creates the flag set shared by the commands
+func newFlagSet(command string, configPath *string, overrides *settings) *flag.FlagSet {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.StringVar(configPath, "config", "", "Path to a YAML or TOML config file, settings in the environment take precedence")
+	flags.Var(overrides, "set", "Override a setting for this run as KEY=VALUE, e.g. -set LOG_LEVEL=debug (repeatable)")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
 
-	// Wait for interrupt signal to gracefully shut down the server
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	logrus.Info("Shutting down server...")
+// parseFlags parses the flags of a command and returns the config file path. Settings given
+// with -set are applied to the environment, so they take precedence over the environment and the config file.
+func parseFlags(command string, args []string) string {
+	return parseFlagsWith(command, args, nil)
+}
 
-	// Create a deadline for the shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// parseFlagsWith parses the flags of a command like parseFlags, with the command's own flags added by define
+func parseFlagsWith(command string, args []string, define func(*flag.FlagSet)) string {
+	var configPath string
+	var overrides settings
+	flags := newFlagSet(command, &configPath, &overrides)
+	if define != nil {
+		define(flags)
+	}
+	_ = flags.Parse(args)
 
-	// Attempt to gracefully shut down the server
-	if err := srv.Shutdown(ctx); err != nil {
-		logrus.WithError(err).Error("Server forced to shutdown")
+	for _, setting := range overrides {
+		key, value, _ := strings.Cut(setting, "=")
+		os.Setenv(key, value)
 	}
 
-	logrus.Info("Server exited")
+	return configPath
 }
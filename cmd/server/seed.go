@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/balu-dk/go-cpms/config"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/sirupsen/logrus"
+)
+
+// seedTransactionIDBase is the lowest ID of a seeded transaction, far above the IDs the central system hands out
+const seedTransactionIDBase = 1000000
+
+// seedMeterInterval is the interval of the seeded meter values
+const seedMeterInterval = 15 * time.Minute
+
+// demoModel is a charge point model the seeded charge points are drawn from
+type demoModel struct {
+	vendor     string
+	model      string
+	firmware   string
+	connectors int
+	plugType   string
+	format     string
+	maxPowerKW float64
+	phases     int
+}
+
+var demoModels = []demoModel{
+	{"Alfen", "Eve Double Pro-line", "6.4.0-4190", 2, "IEC_62196_T2", "SOCKET", 22, 3},
+	{"ABB", "Terra AC W22-T-RD-M-0", "1.8.33", 1, "IEC_62196_T2", "CABLE", 22, 3},
+	{"Zaptec", "Pro", "3.2.1.2", 1, "IEC_62196_T2", "SOCKET", 22, 3},
+	{"Easee", "Charge", "328", 1, "IEC_62196_T2", "SOCKET", 11, 3},
+	{"Wallbox", "Commander 2", "5.17.12", 1, "IEC_62196_T2", "CABLE", 7.4, 1},
+	{"ABB", "Terra 54 CJG", "1.6.17", 2, "IEC_62196_T2_COMBO", "CABLE", 50, 0},
+}
+
+// demoStopReasons are the stop reasons of the seeded transactions, most sessions end with the vehicle unplugged
+var demoStopReasons = []string{"EVDisconnected", "EVDisconnected", "EVDisconnected", "Local", "Remote"}
+
+// seedStats counts the seeded records
+type seedStats struct {
+	chargePoints int
+	connectors   int
+	transactions int
+	meterValues  int
+}
+
+// seed populates the database with demo charge points, connectors and a history of transactions with meter values.
+// Each run adds another history of transactions, the charge points and connectors are updated in place.
+func seed(args []string) {
+	var chargePoints, days int
+	configPath := parseFlagsWith("seed", args, func(flags *flag.FlagSet) {
+		flags.IntVar(&chargePoints, "chargepoints", 5, "Number of demo charge points to seed")
+		flags.IntVar(&days, "days", 30, "Days of transaction history to seed")
+	})
+	if chargePoints <= 0 || days <= 0 {
+		logrus.Fatal("-chargepoints and -days must be positive")
+	}
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load configuration")
+	}
+	if err := cfg.SetupLogger(); err != nil {
+		logrus.WithError(err).Fatal("Failed to set up logging")
+	}
+
+	// The memory store is lost when this command exits
+	if cfg.DBDriver != "postgres" {
+		logrus.Fatalf("Nothing to seed for the %s database driver, seeding needs DB_DRIVER=postgres", cfg.DBDriver)
+	}
+
+	store, err := db.NewPostgresStore(cfg)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to connect to database")
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	stats, err := seedDemoData(ctx, store, chargePoints, days, rand.New(rand.NewSource(time.Now().UnixNano())))
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to seed database")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"chargePoints": stats.chargePoints,
+		"connectors":   stats.connectors,
+		"transactions": stats.transactions,
+		"meterValues":  stats.meterValues,
+		"days":         days,
+	}).Info("Database seeded with demo data")
+}
+
+// seedDemoData seeds the charge points DEMO-001 and up with the given days of history up to now
+func seedDemoData(ctx context.Context, store db.Store, chargePoints, days int, rng *rand.Rand) (seedStats, error) {
+	var stats seedStats
+	now := time.Now().Truncate(time.Minute)
+	from := now.AddDate(0, 0, -days)
+
+	for month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, from.Location()); !month.After(now); month = month.AddDate(0, 1, 0) {
+		if err := store.EnsureMeterValuePartition(ctx, month); err != nil {
+			return stats, fmt.Errorf("creating meter value partition: %w", err)
+		}
+	}
+
+	nextID, err := nextSeedTransactionID(ctx, store)
+	if err != nil {
+		return stats, err
+	}
+
+	for i := 1; i <= chargePoints; i++ {
+		model := demoModels[(i-1)%len(demoModels)]
+		cp := &models.ChargePoint{
+			ID:                 fmt.Sprintf("DEMO-%03d", i),
+			Vendor:             model.vendor,
+			Model:              model.model,
+			SerialNumber:       fmt.Sprintf("SN%08d", rng.Intn(100000000)),
+			FirmwareVersion:    model.firmware,
+			LastHeartbeat:      now.Add(-time.Duration(rng.Intn(300)) * time.Second),
+			RegistrationStatus: "Accepted",
+		}
+		if err := store.SaveChargePoint(ctx, cp); err != nil {
+			return stats, fmt.Errorf("saving charge point %s: %w", cp.ID, err)
+		}
+		stats.chargePoints++
+
+		for connectorID := 1; connectorID <= model.connectors; connectorID++ {
+			connector := &models.Connector{
+				ID:            connectorID,
+				ChargePointID: cp.ID,
+				PlugType:      model.plugType,
+				Format:        model.format,
+				MaxPowerKW:    model.maxPowerKW,
+				Phases:        model.phases,
+			}
+			if err := store.SaveConnectorAttributes(ctx, connector); err != nil {
+				return stats, fmt.Errorf("saving connector %d of %s: %w", connectorID, cp.ID, err)
+			}
+
+			history, err := seedConnectorHistory(ctx, store, connector, from, now, &nextID, rng)
+			if err != nil {
+				return stats, fmt.Errorf("seeding transactions of %s connector %d: %w", cp.ID, connectorID, err)
+			}
+			stats.connectors++
+			stats.transactions += history.transactions
+			stats.meterValues += history.meterValues
+		}
+	}
+
+	return stats, nil
+}
+
+// nextSeedTransactionID returns the ID of the first seeded transaction, above every existing transaction
+func nextSeedTransactionID(ctx context.Context, store db.Store) (int, error) {
+	latest, _, err := store.GetTransactions(ctx, db.TransactionFilter{}, db.Sort{Field: "id", Desc: true}, db.Page{Limit: 1})
+	if err != nil {
+		return 0, fmt.Errorf("getting latest transaction: %w", err)
+	}
+	if len(latest) > 0 && latest[0].ID >= seedTransactionIDBase {
+		return latest[0].ID + 1, nil
+	}
+	return seedTransactionIDBase, nil
+}
+
+// seedConnectorHistory seeds the transactions of a connector between from and to, zero to three sessions a day
+// during the daytime, and leaves the connector Available
+func seedConnectorHistory(ctx context.Context, store db.Store, connector *models.Connector, from, to time.Time, nextID *int, rng *rand.Rand) (seedStats, error) {
+	var stats seedStats
+	register := rng.Intn(5000000) // Wh on the connector's energy register before the seeded history
+
+	// The status history of the connector, its current status is saved once at the end
+	recordStatus := func(status string, at time.Time) error {
+		return store.CreateConnectorStatusEvent(ctx, &models.ConnectorStatusEvent{
+			ChargePointID: connector.ChargePointID,
+			ConnectorID:   connector.ID,
+			Status:        status,
+			ErrorCode:     "NoError",
+			Timestamp:     at,
+		})
+	}
+
+	for day := from.Truncate(24 * time.Hour); day.Before(to); day = day.AddDate(0, 0, 1) {
+		// Sessions of a day start between 06:00 and 22:00 and don't overlap
+		earliest := day.Add(6 * time.Hour)
+		for sessions := rng.Intn(4); sessions > 0; sessions-- {
+			start := earliest.Add(time.Duration(rng.Intn(180)) * time.Minute)
+			duration := time.Duration(30+rng.Intn(270)) * time.Minute
+			end := start.Add(duration)
+			if start.Before(from) || end.After(to) || start.After(day.Add(22*time.Hour)) {
+				break
+			}
+			earliest = end.Add(30 * time.Minute)
+
+			// Vehicles rarely draw the connector's full power
+			powerW := connector.MaxPowerKW * 1000 * (0.5 + rng.Float64()*0.45)
+			tx := &models.Transaction{
+				ID:            *nextID,
+				ChargePointID: connector.ChargePointID,
+				ConnectorID:   connector.ID,
+				IdTag:         fmt.Sprintf("DEMO%04d", 1+rng.Intn(20)),
+				StartTime:     start,
+				MeterStart:    register,
+				Status:        "InProgress",
+				SessionID:     db.NewSessionID(),
+				CreatedAt:     start,
+			}
+			*nextID++
+
+			if err := recordStatus("Charging", start); err != nil {
+				return stats, err
+			}
+			if err := store.StartTransaction(ctx, tx); err != nil {
+				return stats, err
+			}
+
+			var batch []*models.MeterValue
+			for t := start; !t.After(end); t = t.Add(seedMeterInterval) {
+				energy := float64(register) + powerW*t.Sub(start).Hours()
+				batch = append(batch,
+					&models.MeterValue{
+						TransactionID: tx.ID,
+						ChargePointID: tx.ChargePointID,
+						ConnectorID:   tx.ConnectorID,
+						Timestamp:     t,
+						Value:         math.Round(energy),
+						Unit:          "Wh",
+						Measurand:     "Energy.Active.Import.Register",
+						SessionID:     tx.SessionID,
+					},
+					&models.MeterValue{
+						TransactionID: tx.ID,
+						ChargePointID: tx.ChargePointID,
+						ConnectorID:   tx.ConnectorID,
+						Timestamp:     t,
+						Value:         math.Round(powerW * (0.95 + rng.Float64()*0.1)),
+						Unit:          "W",
+						Measurand:     "Power.Active.Import",
+						SessionID:     tx.SessionID,
+					},
+				)
+			}
+			if err := store.SaveMeterValues(ctx, batch); err != nil {
+				return stats, err
+			}
+
+			register += int(math.Round(powerW * duration.Hours()))
+			if err := store.StopTransaction(ctx, tx.ID, end, register, demoStopReasons[rng.Intn(len(demoStopReasons))]); err != nil {
+				return stats, err
+			}
+			if err := recordStatus("Available", end); err != nil {
+				return stats, err
+			}
+
+			stats.transactions++
+			stats.meterValues += len(batch)
+		}
+	}
+
+	connector.Status = "Available"
+	connector.ErrorCode = "NoError"
+	if err := store.SaveConnector(ctx, connector); err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/balu-dk/go-cpms/config"
+	"github.com/balu-dk/go-cpms/internal/api"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+// serve runs the CPMS until it receives SIGINT or SIGTERM
+func serve(args []string) {
+	configPath := parseFlags("serve", args)
+
+	// Load configuration
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load configuration")
+	}
+
+	// Setup logger
+	if err := cfg.SetupLogger(); err != nil {
+		logrus.WithError(err).Fatal("Failed to set up logging")
+	}
+	logrus.WithField("version", version).Info("Starting CPMS server")
+
+	// Connect to database
+	store, err := db.NewStore(cfg)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to connect to database")
+	}
+	defer store.Close()
+
+	// Create CPMS service
+	cpms := service.NewCPMS(cfg, store)
+
+	// Start OCPP central system
+	if err := cpms.Start(); err != nil {
+		logrus.WithError(err).Fatal("Failed to start OCPP central system")
+	}
+
+	// Create API server
+	apiServer := api.NewAPI(cpms)
+
+	// Load the API TLS certificate, if configured
+	tlsConfig, err := api.TLSConfig(cfg)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to configure API TLS")
+	}
+
+	// Start API server
+	srv := &http.Server{
+		Addr:      fmt.Sprintf(":%d", cfg.APIPort),
+		Handler:   apiServer,
+		TLSConfig: tlsConfig,
+	}
+
+	// Run the server in a goroutine
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			logrus.Infof("Starting API server on port %d with TLS", cfg.APIPort)
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			logrus.Infof("Starting API server on port %d", cfg.APIPort)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logrus.WithError(err).Fatal("Failed to start API server")
+		}
+	}()
+
+	// Reload the runtime-tunable settings on SIGHUP. Environment variables are fixed at startup,
+	// so only changes to the config file take effect.
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			logrus.Info("Reloading configuration")
+			newCfg, err := config.LoadConfig(configPath)
+			if err != nil {
+				logrus.WithError(err).Error("Failed to reload configuration, keeping the current settings")
+				continue
+			}
+			cpms.Reload(newCfg)
+		}
+	}()
+
+	// Wait for interrupt signal to gracefully shut down the server
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	signal.Stop(reload)
+	logrus.Info("Shutting down server...")
+
+	// Create a deadline for the shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Attempt to gracefully shut down the server
+	if err := srv.Shutdown(ctx); err != nil {
+		logrus.WithError(err).Error("Server forced to shutdown")
+	}
+
+	// Stop accepting charge point connections and close the open ones
+	cpms.Stop(ctx)
+
+	logrus.Info("Server exited")
+}
@@ -0,0 +1,627 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	ocpp16 "github.com/lorenzodonini/ocpp-go/ocpp1.6"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/firmware"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/localauth"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/remotetrigger"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/lorenzodonini/ocpp-go/ws"
+	"github.com/sirupsen/logrus"
+)
+
+// reconnectDelay is how long the charge point waits before reconnecting after a failed connection or a reboot
+const reconnectDelay = 5 * time.Second
+
+// replyDelay is how long the charge point waits after a command before sending the messages it triggers,
+// so the confirmation of the command is sent first
+const replyDelay = 100 * time.Millisecond
+
+// errOffline is returned for messages sent while the charge point is disconnected
+var errOffline = errors.New("charge point is offline")
+
+// readonlyKeys are the configuration keys the CPMS cannot change
+var readonlyKeys = map[string]bool{
+	"NumberOfConnectors":       true,
+	"SupportedFeatureProfiles": true,
+}
+
+var (
+	_ core.ChargePointHandler          = (*chargePoint)(nil)
+	_ firmware.ChargePointHandler      = (*chargePoint)(nil)
+	_ localauth.ChargePointHandler     = (*chargePoint)(nil)
+	_ remotetrigger.ChargePointHandler = (*chargePoint)(nil)
+)
+
+// chargePoint is a simulated OCPP 1.6 charge point
+type chargePoint struct {
+	ctx        context.Context
+	cfg        *config
+	log        *logrus.Entry
+	connectors []*connector
+	metrics    *metrics
+	rebooting  atomic.Bool
+
+	mu               sync.Mutex
+	client           ocpp16.ChargePoint // Replaced on every connection, nil while disconnected
+	firmware         string
+	firmwareStatus   firmware.FirmwareStatus
+	configuration    map[string]string
+	localListVersion int
+}
+
+// newChargePoint creates a simulated charge point that records its requests in metrics
+func newChargePoint(cfg *config, m *metrics) *chargePoint {
+	heartbeatInterval := 300
+	if cfg.heartbeatInterval > 0 {
+		heartbeatInterval = int(cfg.heartbeatInterval.Seconds())
+	}
+
+	cp := &chargePoint{
+		cfg:            cfg,
+		log:            logrus.WithField("chargePointID", cfg.id),
+		metrics:        m,
+		firmware:       cfg.firmware,
+		firmwareStatus: firmware.FirmwareStatusIdle,
+		configuration: map[string]string{
+			"AuthorizationKey":          "",
+			"AuthorizeRemoteTxRequests": "false",
+			"ConnectionTimeOut":         "60",
+			"HeartbeatInterval":         strconv.Itoa(heartbeatInterval),
+			"MeterValueSampleInterval":  strconv.Itoa(int(cfg.meterInterval.Seconds())),
+			"MeterValuesSampledData":    "Energy.Active.Import.Register,Power.Active.Import,Current.Import,Voltage,SoC",
+			"NumberOfConnectors":        strconv.Itoa(cfg.connectors),
+			"SupportedFeatureProfiles":  "Core,FirmwareManagement,LocalAuthListManagement,RemoteTrigger",
+		},
+	}
+	for id := 1; id <= cfg.connectors; id++ {
+		cp.connectors = append(cp.connectors, newConnector(cp, id))
+	}
+	return cp
+}
+
+// run connects and boots the charge point and simulates it until the context is cancelled,
+// then stops the ongoing sessions and disconnects
+func (cp *chargePoint) run(ctx context.Context) {
+	cp.ctx = ctx
+	if !cp.start(ctx) {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range cp.connectors {
+		wg.Add(1)
+		go func(c *connector) {
+			defer wg.Done()
+			c.run(ctx)
+		}(c)
+	}
+	go cp.sendHeartbeats(ctx)
+	go cp.runScript(ctx)
+
+	<-ctx.Done()
+	wg.Wait()
+	cp.disconnect()
+	cp.log.Info("Simulator stopped")
+}
+
+// start connects the charge point, boots it and reports the status of its connectors
+func (cp *chargePoint) start(ctx context.Context) bool {
+	if !cp.reconnect(ctx) || !cp.boot(ctx) {
+		return false
+	}
+	cp.notifyStatuses()
+	return true
+}
+
+// reconnect connects the charge point, retrying until it succeeds or the context is cancelled
+func (cp *chargePoint) reconnect(ctx context.Context) bool {
+	for {
+		err := cp.connect()
+		if err == nil {
+			return true
+		}
+		cp.log.WithError(err).Warn("Failed to connect to the CPMS")
+		if !sleep(ctx, reconnectDelay) {
+			return false
+		}
+	}
+}
+
+// connect opens a new connection to the CPMS. The websocket client reconnects by itself when the connection drops.
+func (cp *chargePoint) connect() error {
+	wsClient := ws.NewClient()
+	if cp.cfg.password != "" {
+		wsClient.SetBasicAuth(cp.cfg.id, cp.cfg.password)
+	}
+
+	client := ocpp16.NewChargePoint(cp.cfg.id, nil, wsClient)
+	client.SetCoreHandler(cp)
+	client.SetFirmwareManagementHandler(cp)
+	client.SetLocalAuthListHandler(cp)
+	client.SetRemoteTriggerHandler(cp)
+
+	start := time.Now()
+	err := client.Start(cp.cfg.url)
+	cp.metrics.record(connectAction, time.Since(start), err)
+	if err != nil {
+		return err
+	}
+
+	cp.mu.Lock()
+	cp.client = client
+	cp.mu.Unlock()
+	cp.metrics.connected.Add(1)
+
+	cp.log.WithField("url", cp.cfg.url).Info("Connected to the CPMS")
+	return nil
+}
+
+// disconnect closes the connection to the CPMS
+func (cp *chargePoint) disconnect() {
+	cp.mu.Lock()
+	client := cp.client
+	cp.client = nil
+	cp.mu.Unlock()
+
+	if client != nil {
+		client.Stop()
+		cp.metrics.connected.Add(-1)
+		cp.log.Info("Disconnected from the CPMS")
+	}
+}
+
+// disconnectFor drops the connection for a duration, then reconnects without rebooting
+func (cp *chargePoint) disconnectFor(ctx context.Context, d time.Duration) {
+	cp.disconnect()
+	if !sleep(ctx, d) || !cp.reconnect(ctx) {
+		return
+	}
+	cp.notifyStatuses()
+}
+
+// reboot stops the ongoing sessions, disconnects and boots the charge point again
+func (cp *chargePoint) reboot(ctx context.Context, reason core.Reason) {
+	if !cp.rebooting.CompareAndSwap(false, true) {
+		return
+	}
+	defer cp.rebooting.Store(false)
+
+	cp.log.WithField("reason", reason).Info("Rebooting")
+	for _, c := range cp.connectors {
+		c.stopSession(reason)
+	}
+
+	// Give the sessions time to send their StopTransaction
+	deadline := time.Now().Add(10 * time.Second)
+	for cp.inSession() && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	cp.disconnect()
+	if sleep(ctx, reconnectDelay) {
+		cp.start(ctx)
+	}
+}
+
+// inSession reports whether a connector is in a session
+func (cp *chargePoint) inSession() bool {
+	for _, c := range cp.connectors {
+		if c.inSession() {
+			return true
+		}
+	}
+	return false
+}
+
+// online reports whether the charge point is connected to the CPMS
+func (cp *chargePoint) online() bool {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.client != nil
+}
+
+// send sends a request to the CPMS and waits for its confirmation. Requests sent while offline are
+// not recorded in the metrics, as they never reach the CPMS.
+func (cp *chargePoint) send(request ocpp.Request) (ocpp.Response, error) {
+	cp.mu.Lock()
+	client := cp.client
+	cp.mu.Unlock()
+
+	if client == nil {
+		return nil, errOffline
+	}
+
+	start := time.Now()
+	response, err := client.SendRequest(request)
+	cp.metrics.record(request.GetFeatureName(), time.Since(start), err)
+	return response, err
+}
+
+// boot sends boot notifications until the CPMS accepts the charge point
+func (cp *chargePoint) boot(ctx context.Context) bool {
+	for {
+		request := core.NewBootNotificationRequest(cp.cfg.model, cp.cfg.vendor)
+		request.ChargePointSerialNumber = cp.cfg.serialNumber
+		request.FirmwareVersion = cp.firmwareVersion()
+
+		retry := reconnectDelay
+		response, err := cp.send(request)
+		if err != nil {
+			cp.log.WithError(err).Warn("Failed to send boot notification")
+		} else {
+			conf := response.(*core.BootNotificationConfirmation)
+			if conf.Interval > 0 {
+				retry = time.Duration(conf.Interval) * time.Second
+			}
+			if conf.Status == core.RegistrationStatusAccepted {
+				if conf.Interval > 0 && cp.cfg.heartbeatInterval == 0 {
+					cp.setConfiguration("HeartbeatInterval", strconv.Itoa(conf.Interval))
+				}
+				cp.log.WithField("heartbeatInterval", conf.Interval).Info("Boot notification accepted")
+				return true
+			}
+			cp.log.WithField("status", conf.Status).Warn("Boot notification not accepted, retrying")
+		}
+
+		if !sleep(ctx, retry) {
+			return false
+		}
+	}
+}
+
+// sendHeartbeats sends heartbeats at the configured heartbeat interval
+func (cp *chargePoint) sendHeartbeats(ctx context.Context) {
+	for sleep(ctx, cp.interval("HeartbeatInterval", 5*time.Minute)) {
+		cp.sendHeartbeat()
+	}
+}
+
+// sendHeartbeat sends a heartbeat
+func (cp *chargePoint) sendHeartbeat() {
+	if _, err := cp.send(core.NewHeartbeatRequest()); err != nil {
+		cp.log.WithError(err).Warn("Failed to send heartbeat")
+	}
+}
+
+// notifyStatuses reports the status of the charge point and of all connectors
+func (cp *chargePoint) notifyStatuses() {
+	request := core.NewStatusNotificationRequest(0, core.NoError, core.ChargePointStatusAvailable)
+	request.Timestamp = types.NewDateTime(time.Now())
+	if _, err := cp.send(request); err != nil {
+		cp.log.WithError(err).Warn("Failed to send status notification")
+	}
+
+	for _, c := range cp.connectors {
+		c.notifyStatus()
+	}
+}
+
+// connector returns a connector by ID, nil if it does not exist
+func (cp *chargePoint) connector(id int) *connector {
+	if id < 1 || id > len(cp.connectors) {
+		return nil
+	}
+	return cp.connectors[id-1]
+}
+
+// interval returns a configuration key holding an interval in seconds, or fallback if it is not positive
+func (cp *chargePoint) interval(key string, fallback time.Duration) time.Duration {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	seconds, err := strconv.Atoi(cp.configuration[key])
+	if err != nil || seconds <= 0 {
+		return fallback
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// setConfiguration sets a configuration key
+func (cp *chargePoint) setConfiguration(key, value string) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.configuration[key] = value
+}
+
+// firmwareVersion returns the installed firmware version
+func (cp *chargePoint) firmwareVersion() string {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.firmware
+}
+
+// setFirmwareStatus records and reports the status of a firmware update
+func (cp *chargePoint) setFirmwareStatus(status firmware.FirmwareStatus) {
+	cp.mu.Lock()
+	cp.firmwareStatus = status
+	cp.mu.Unlock()
+
+	if _, err := cp.send(firmware.NewFirmwareStatusNotificationRequest(status)); err != nil {
+		cp.log.WithError(err).Warn("Failed to send firmware status notification")
+	}
+}
+
+// afterReply runs fn once the confirmation of the command being handled has been sent
+func (cp *chargePoint) afterReply(fn func()) {
+	go func() {
+		time.Sleep(replyDelay)
+		fn()
+	}()
+}
+
+// OnChangeAvailability makes connectors operative or inoperative, after their session if they are charging
+func (cp *chargePoint) OnChangeAvailability(request *core.ChangeAvailabilityRequest) (*core.ChangeAvailabilityConfirmation, error) {
+	targets := cp.connectors
+	if request.ConnectorId != 0 {
+		c := cp.connector(request.ConnectorId)
+		if c == nil {
+			return core.NewChangeAvailabilityConfirmation(core.AvailabilityStatusRejected), nil
+		}
+		targets = []*connector{c}
+	}
+
+	status := core.AvailabilityStatusAccepted
+	for _, c := range targets {
+		if !c.setOperative(request.Type == core.AvailabilityTypeOperative) {
+			status = core.AvailabilityStatusScheduled
+		}
+	}
+	return core.NewChangeAvailabilityConfirmation(status), nil
+}
+
+// OnChangeConfiguration changes a configuration key
+func (cp *chargePoint) OnChangeConfiguration(request *core.ChangeConfigurationRequest) (*core.ChangeConfigurationConfirmation, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if _, ok := cp.configuration[request.Key]; !ok {
+		return core.NewChangeConfigurationConfirmation(core.ConfigurationStatusNotSupported), nil
+	}
+	if readonlyKeys[request.Key] {
+		return core.NewChangeConfigurationConfirmation(core.ConfigurationStatusRejected), nil
+	}
+	if strings.HasSuffix(request.Key, "Interval") {
+		if seconds, err := strconv.Atoi(request.Value); err != nil || seconds < 0 {
+			return core.NewChangeConfigurationConfirmation(core.ConfigurationStatusRejected), nil
+		}
+	}
+
+	cp.configuration[request.Key] = request.Value
+	cp.log.WithField("key", request.Key).Info("Configuration changed")
+	return core.NewChangeConfigurationConfirmation(core.ConfigurationStatusAccepted), nil
+}
+
+// OnClearCache clears the authorization cache, which the simulator does not keep
+func (cp *chargePoint) OnClearCache(request *core.ClearCacheRequest) (*core.ClearCacheConfirmation, error) {
+	return core.NewClearCacheConfirmation(core.ClearCacheStatusAccepted), nil
+}
+
+// OnDataTransfer rejects vendor-specific data, the simulator implements no vendor extensions
+func (cp *chargePoint) OnDataTransfer(request *core.DataTransferRequest) (*core.DataTransferConfirmation, error) {
+	return core.NewDataTransferConfirmation(core.DataTransferStatusUnknownVendorId), nil
+}
+
+// OnGetConfiguration returns the requested configuration keys, or all keys if none are requested
+func (cp *chargePoint) OnGetConfiguration(request *core.GetConfigurationRequest) (*core.GetConfigurationConfirmation, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	keys := request.Key
+	if len(keys) == 0 {
+		for key := range cp.configuration {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	}
+
+	var known []core.ConfigurationKey
+	var unknown []string
+	for _, key := range keys {
+		value, ok := cp.configuration[key]
+		if !ok {
+			unknown = append(unknown, key)
+			continue
+		}
+		known = append(known, core.ConfigurationKey{Key: key, Readonly: readonlyKeys[key], Value: &value})
+	}
+
+	conf := core.NewGetConfigurationConfirmation(known)
+	conf.UnknownKey = unknown
+	return conf, nil
+}
+
+// OnRemoteStartTransaction starts a session at the requested connector or the first available one
+func (cp *chargePoint) OnRemoteStartTransaction(request *core.RemoteStartTransactionRequest) (*core.RemoteStartTransactionConfirmation, error) {
+	var started bool
+	if request.ConnectorId != nil {
+		if c := cp.connector(*request.ConnectorId); c != nil {
+			started = c.requestStart(request.IdTag, true)
+		}
+	} else {
+		for _, c := range cp.connectors {
+			if started = c.requestStart(request.IdTag, true); started {
+				break
+			}
+		}
+	}
+
+	if !started {
+		return core.NewRemoteStartTransactionConfirmation(types.RemoteStartStopStatusRejected), nil
+	}
+	return core.NewRemoteStartTransactionConfirmation(types.RemoteStartStopStatusAccepted), nil
+}
+
+// OnRemoteStopTransaction stops the session of a transaction
+func (cp *chargePoint) OnRemoteStopTransaction(request *core.RemoteStopTransactionRequest) (*core.RemoteStopTransactionConfirmation, error) {
+	for _, c := range cp.connectors {
+		if c.transaction() == request.TransactionId {
+			c.stopSession(core.ReasonRemote)
+			return core.NewRemoteStopTransactionConfirmation(types.RemoteStartStopStatusAccepted), nil
+		}
+	}
+	return core.NewRemoteStopTransactionConfirmation(types.RemoteStartStopStatusRejected), nil
+}
+
+// OnReset reboots the charge point
+func (cp *chargePoint) OnReset(request *core.ResetRequest) (*core.ResetConfirmation, error) {
+	reason := core.ReasonSoftReset
+	if request.Type == core.ResetTypeHard {
+		reason = core.ReasonHardReset
+	}
+	cp.afterReply(func() { cp.reboot(cp.ctx, reason) })
+	return core.NewResetConfirmation(core.ResetStatusAccepted), nil
+}
+
+// OnUnlockConnector unlocks a connector, stopping its session
+func (cp *chargePoint) OnUnlockConnector(request *core.UnlockConnectorRequest) (*core.UnlockConnectorConfirmation, error) {
+	c := cp.connector(request.ConnectorId)
+	if c == nil {
+		return core.NewUnlockConnectorConfirmation(core.UnlockStatusNotSupported), nil
+	}
+	c.stopSession(core.ReasonUnlockCommand)
+	return core.NewUnlockConnectorConfirmation(core.UnlockStatusUnlocked), nil
+}
+
+// OnGetDiagnostics pretends to upload a diagnostics file
+func (cp *chargePoint) OnGetDiagnostics(request *firmware.GetDiagnosticsRequest) (*firmware.GetDiagnosticsConfirmation, error) {
+	cp.afterReply(func() {
+		for _, status := range []firmware.DiagnosticsStatus{firmware.DiagnosticsStatusUploading, firmware.DiagnosticsStatusUploaded} {
+			if _, err := cp.send(firmware.NewDiagnosticsStatusNotificationRequest(status)); err != nil {
+				cp.log.WithError(err).Warn("Failed to send diagnostics status notification")
+			}
+			time.Sleep(2 * time.Second)
+		}
+	})
+
+	conf := firmware.NewGetDiagnosticsConfirmation()
+	conf.FileName = fmt.Sprintf("%s-diagnostics.log", cp.cfg.id)
+	return conf, nil
+}
+
+// OnUpdateFirmware pretends to download and install the firmware at its retrieve date. The version
+// reported after the reboot is the file name of the firmware location without its extension.
+func (cp *chargePoint) OnUpdateFirmware(request *firmware.UpdateFirmwareRequest) (*firmware.UpdateFirmwareConfirmation, error) {
+	version := request.Location
+	if u, err := url.Parse(request.Location); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		version = strings.TrimSuffix(path.Base(u.Path), path.Ext(u.Path))
+	}
+
+	retrieveDate := time.Now()
+	if request.RetrieveDate != nil {
+		retrieveDate = request.RetrieveDate.Time
+	}
+
+	go func() {
+		if !sleep(cp.ctx, time.Until(retrieveDate)+replyDelay) {
+			return
+		}
+
+		cp.setFirmwareStatus(firmware.FirmwareStatusDownloading)
+		time.Sleep(5 * time.Second)
+		cp.setFirmwareStatus(firmware.FirmwareStatusDownloaded)
+		cp.setFirmwareStatus(firmware.FirmwareStatusInstalling)
+		time.Sleep(5 * time.Second)
+
+		cp.mu.Lock()
+		cp.firmware = version
+		cp.mu.Unlock()
+
+		cp.reboot(cp.ctx, core.ReasonReboot)
+		cp.setFirmwareStatus(firmware.FirmwareStatusInstalled)
+	}()
+
+	return firmware.NewUpdateFirmwareConfirmation(), nil
+}
+
+// OnGetLocalListVersion returns the version of the local authorization list
+func (cp *chargePoint) OnGetLocalListVersion(request *localauth.GetLocalListVersionRequest) (*localauth.GetLocalListVersionConfirmation, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return localauth.NewGetLocalListVersionConfirmation(cp.localListVersion), nil
+}
+
+// OnSendLocalList records the version of the local authorization list, the simulator authorizes with the CPMS
+func (cp *chargePoint) OnSendLocalList(request *localauth.SendLocalListRequest) (*localauth.SendLocalListConfirmation, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.localListVersion = request.ListVersion
+	return localauth.NewSendLocalListConfirmation(localauth.UpdateStatusAccepted), nil
+}
+
+// OnTriggerMessage sends the requested message
+func (cp *chargePoint) OnTriggerMessage(request *remotetrigger.TriggerMessageRequest) (*remotetrigger.TriggerMessageConfirmation, error) {
+	targets := cp.connectors
+	if request.ConnectorId != nil {
+		c := cp.connector(*request.ConnectorId)
+		if c == nil {
+			return remotetrigger.NewTriggerMessageConfirmation(remotetrigger.TriggerMessageStatusRejected), nil
+		}
+		targets = []*connector{c}
+	}
+
+	var fn func()
+	switch string(request.RequestedMessage) {
+	case core.BootNotificationFeatureName:
+		fn = func() { cp.boot(cp.ctx) }
+	case core.HeartbeatFeatureName:
+		fn = cp.sendHeartbeat
+	case core.StatusNotificationFeatureName:
+		fn = func() {
+			for _, c := range targets {
+				c.notifyStatus()
+			}
+		}
+	case core.MeterValuesFeatureName:
+		fn = func() {
+			for _, c := range targets {
+				c.sendMeterValues(types.ReadingContextTrigger)
+			}
+		}
+	case firmware.FirmwareStatusNotificationFeatureName:
+		fn = func() {
+			cp.mu.Lock()
+			status := cp.firmwareStatus
+			cp.mu.Unlock()
+			cp.setFirmwareStatus(status)
+		}
+	case firmware.DiagnosticsStatusNotificationFeatureName:
+		fn = func() {
+			if _, err := cp.send(firmware.NewDiagnosticsStatusNotificationRequest(firmware.DiagnosticsStatusIdle)); err != nil {
+				cp.log.WithError(err).Warn("Failed to send diagnostics status notification")
+			}
+		}
+	default:
+		return remotetrigger.NewTriggerMessageConfirmation(remotetrigger.TriggerMessageStatusNotImplemented), nil
+	}
+
+	cp.afterReply(fn)
+	return remotetrigger.NewTriggerMessageConfirmation(remotetrigger.TriggerMessageStatusAccepted), nil
+}
+
+// sleep waits for a duration, returning false if the context is cancelled first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
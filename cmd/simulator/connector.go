@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/sirupsen/logrus"
+)
+
+// nominalVoltage is the phase voltage of the simulated three-phase supply
+const nominalVoltage = 230.0
+
+// sessionRequest asks a connector to start a session
+type sessionRequest struct {
+	idTag  string
+	remote bool // Remote starts are authorized by the CPMS and skip the Authorize request
+}
+
+// connector is a connector of a simulated charge point, charging one vehicle at a time
+type connector struct {
+	cp     *chargePoint
+	id     int
+	log    *logrus.Entry
+	starts chan sessionRequest
+	stops  chan core.Reason
+
+	mu            sync.Mutex
+	status        core.ChargePointStatus
+	errorCode     core.ChargePointErrorCode
+	info          string
+	operative     bool
+	scheduled     *bool // Availability change scheduled for the end of the session
+	charging      bool  // In a session, from plugging in until unplugging
+	transactionID int
+	meterWh       float64 // Energy register
+	vehicle       *vehicle
+}
+
+// newConnector creates an available connector with a used energy register
+func newConnector(cp *chargePoint, id int) *connector {
+	return &connector{
+		cp:        cp,
+		id:        id,
+		log:       cp.log.WithField("connectorId", id),
+		starts:    make(chan sessionRequest, 1),
+		stops:     make(chan core.Reason, 1),
+		status:    core.ChargePointStatusAvailable,
+		errorCode: core.NoError,
+		operative: true,
+		meterWh:   math.Round(rand.Float64() * 5_000_000),
+	}
+}
+
+// run runs sessions until the context is cancelled
+func (c *connector) run(ctx context.Context) {
+	for {
+		request, ok := c.waitForSession(ctx)
+		if !ok {
+			return
+		}
+		c.charge(ctx, request)
+	}
+}
+
+// waitForSession waits for a remote or scripted start, or until a vehicle arrives when sessions start automatically
+func (c *connector) waitForSession(ctx context.Context) (sessionRequest, bool) {
+	var arrival <-chan time.Time
+	if c.cp.cfg.autoSessions {
+		arrival = time.After(jitter(c.cp.cfg.idleTime))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return sessionRequest{}, false
+		case request := <-c.starts:
+			return request, true
+		case <-arrival:
+			if c.available() && c.cp.online() {
+				return sessionRequest{idTag: c.cp.cfg.idTag}, true
+			}
+			arrival = time.After(jitter(c.cp.cfg.idleTime))
+		}
+	}
+}
+
+// charge runs a session: authorization, the transaction with its meter values until the vehicle leaves
+// or the session is stopped, and the StopTransaction
+func (c *connector) charge(ctx context.Context, request sessionRequest) {
+	if !c.beginSession() {
+		return
+	}
+	defer c.endSession()
+
+	if !request.remote && !c.authorize(request.idTag) {
+		return
+	}
+
+	v := newVehicle(c.cp.cfg.maxPowerKW)
+	c.mu.Lock()
+	c.vehicle = v
+	meterStart := int(c.meterWh)
+	c.mu.Unlock()
+
+	response, err := c.cp.send(core.NewStartTransactionRequest(c.id, request.idTag, meterStart, types.NewDateTime(time.Now())))
+	if err != nil {
+		c.log.WithError(err).Warn("Failed to start transaction")
+		return
+	}
+	conf := response.(*core.StartTransactionConfirmation)
+
+	c.mu.Lock()
+	c.transactionID = conf.TransactionId
+	c.mu.Unlock()
+
+	log := c.log.WithFields(logrus.Fields{
+		"transactionId": conf.TransactionId,
+		"idTag":         request.idTag,
+	})
+	log.Info("Transaction started")
+
+	reason := core.ReasonDeAuthorized
+	if conf.IdTagInfo != nil && conf.IdTagInfo.Status == types.AuthorizationStatusAccepted {
+		c.setStatus(core.ChargePointStatusCharging)
+		c.sendMeterValues(types.ReadingContextTransactionBegin)
+		reason = c.chargeVehicle(ctx, v)
+	}
+
+	c.mu.Lock()
+	meterStop := int(c.meterWh)
+	c.mu.Unlock()
+
+	stop := core.NewStopTransactionRequest(meterStop, types.NewDateTime(time.Now()), conf.TransactionId)
+	stop.IdTag = request.idTag
+	stop.Reason = reason
+	if _, err := c.cp.send(stop); err != nil {
+		log.WithError(err).Warn("Failed to stop transaction")
+		return
+	}
+	log.WithFields(logrus.Fields{
+		"reason":    reason,
+		"energyKWh": float64(meterStop-meterStart) / 1000,
+	}).Info("Transaction stopped")
+}
+
+// chargeVehicle charges a vehicle, sending meter values, until the session ends and returns the stop reason
+func (c *connector) chargeVehicle(ctx context.Context, v *vehicle) core.Reason {
+	departure := time.After(jitter(c.cp.cfg.sessionLength))
+	last := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return core.ReasonLocal
+		case reason := <-c.stops:
+			return reason
+		case <-departure:
+			return core.ReasonEVDisconnected
+		case now := <-time.After(c.cp.interval("MeterValueSampleInterval", c.cp.cfg.meterInterval)):
+			c.mu.Lock()
+			c.meterWh += v.charge(now.Sub(last))
+			last = now
+			suspended := v.full() && c.status == core.ChargePointStatusCharging
+			c.mu.Unlock()
+
+			c.sendMeterValues(types.ReadingContextSamplePeriodic)
+			if suspended {
+				c.setStatus(core.ChargePointStatusSuspendedEV)
+			}
+		}
+	}
+}
+
+// authorize asks the CPMS to authorize an idTag
+func (c *connector) authorize(idTag string) bool {
+	response, err := c.cp.send(core.NewAuthorizationRequest(idTag))
+	if err != nil {
+		c.log.WithError(err).Warn("Failed to authorize idTag")
+		return false
+	}
+
+	status := response.(*core.AuthorizeConfirmation).IdTagInfo.Status
+	if status != types.AuthorizationStatusAccepted {
+		c.log.WithFields(logrus.Fields{
+			"idTag":  idTag,
+			"status": status,
+		}).Warn("idTag not authorized")
+		return false
+	}
+	return true
+}
+
+// beginSession moves an available connector to Preparing, false if it is not available
+func (c *connector) beginSession() bool {
+	c.mu.Lock()
+	if c.charging || c.status != core.ChargePointStatusAvailable {
+		c.mu.Unlock()
+		return false
+	}
+	c.charging = true
+	c.status = core.ChargePointStatusPreparing
+
+	// Drop a stop requested before the session started
+	select {
+	case <-c.stops:
+	default:
+	}
+	c.mu.Unlock()
+
+	c.notifyStatus()
+	return true
+}
+
+// endSession finishes a session and applies an availability change scheduled during it
+func (c *connector) endSession() {
+	c.mu.Lock()
+	c.charging = false
+	c.transactionID = 0
+	c.vehicle = nil
+	if c.scheduled != nil {
+		c.operative = *c.scheduled
+		c.scheduled = nil
+	}
+	faulted := c.errorCode != core.NoError
+	c.mu.Unlock()
+
+	// A faulted connector stays Faulted until the fault is cleared
+	if faulted {
+		return
+	}
+	c.setStatus(core.ChargePointStatusFinishing)
+
+	c.mu.Lock()
+	c.status = c.idleStatus()
+	c.mu.Unlock()
+	c.notifyStatus()
+}
+
+// idleStatus returns the status of the connector outside of sessions, the caller holds the lock
+func (c *connector) idleStatus() core.ChargePointStatus {
+	switch {
+	case c.errorCode != core.NoError:
+		return core.ChargePointStatusFaulted
+	case !c.operative:
+		return core.ChargePointStatusUnavailable
+	default:
+		return core.ChargePointStatusAvailable
+	}
+}
+
+// available reports whether a session can start
+func (c *connector) available() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.charging && c.status == core.ChargePointStatusAvailable
+}
+
+// inSession reports whether the connector is in a session
+func (c *connector) inSession() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.charging
+}
+
+// transaction returns the ID of the ongoing transaction, 0 if there is none
+func (c *connector) transaction() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.transactionID
+}
+
+// requestStart asks the connector to start a session, false if it is not available
+func (c *connector) requestStart(idTag string, remote bool) bool {
+	if !c.available() {
+		return false
+	}
+	select {
+	case c.starts <- sessionRequest{idTag: idTag, remote: remote}:
+		return true
+	default:
+		return false
+	}
+}
+
+// stopSession asks the connector to stop its session
+func (c *connector) stopSession(reason core.Reason) {
+	if !c.inSession() {
+		return
+	}
+	select {
+	case c.stops <- reason:
+	default:
+	}
+}
+
+// setOperative makes the connector operative or inoperative. A connector in a session changes after
+// the session, for which setOperative returns false.
+func (c *connector) setOperative(operative bool) bool {
+	c.mu.Lock()
+	if c.charging {
+		c.scheduled = &operative
+		c.mu.Unlock()
+		return false
+	}
+	c.operative = operative
+	c.status = c.idleStatus()
+	c.mu.Unlock()
+
+	c.cp.afterReply(c.notifyStatus)
+	return true
+}
+
+// fault puts the connector in the Faulted state, stopping its session
+func (c *connector) fault(errorCode core.ChargePointErrorCode, info string) {
+	c.mu.Lock()
+	c.errorCode = errorCode
+	c.info = info
+	c.status = core.ChargePointStatusFaulted
+	c.mu.Unlock()
+
+	c.log.WithField("errorCode", errorCode).Info("Connector faulted")
+	c.stopSession(core.ReasonOther)
+	c.notifyStatus()
+}
+
+// clearFault clears the fault of the connector
+func (c *connector) clearFault() {
+	c.mu.Lock()
+	c.errorCode = core.NoError
+	c.info = ""
+	if !c.charging {
+		c.status = c.idleStatus()
+	}
+	c.mu.Unlock()
+
+	c.log.Info("Connector fault cleared")
+	c.notifyStatus()
+}
+
+// setStatus changes and reports the status of the connector
+func (c *connector) setStatus(status core.ChargePointStatus) {
+	c.mu.Lock()
+	c.status = status
+	c.mu.Unlock()
+	c.notifyStatus()
+}
+
+// notifyStatus reports the status of the connector
+func (c *connector) notifyStatus() {
+	c.mu.Lock()
+	request := core.NewStatusNotificationRequest(c.id, c.errorCode, c.status)
+	request.Info = c.info
+	request.Timestamp = types.NewDateTime(time.Now())
+	c.mu.Unlock()
+
+	if _, err := c.cp.send(request); err != nil {
+		c.log.WithError(err).Warn("Failed to send status notification")
+	}
+}
+
+// sendMeterValues reports the energy register and, during a session, the power, current, voltage
+// and the vehicle's state of charge
+func (c *connector) sendMeterValues(context types.ReadingContext) {
+	c.mu.Lock()
+	transactionID := c.transactionID
+	meterWh := c.meterWh
+	var powerW, soc float64
+	if c.vehicle != nil {
+		powerW, soc = c.vehicle.powerW, c.vehicle.soc
+	}
+	hasVehicle := c.vehicle != nil
+	c.mu.Unlock()
+
+	voltage := nominalVoltage + rand.NormFloat64()*1.5
+	current := powerW / (3 * voltage)
+
+	samples := []types.SampledValue{
+		{Value: strconv.FormatFloat(meterWh, 'f', 0, 64), Context: context, Measurand: types.MeasurandEnergyActiveImportRegister, Location: types.LocationOutlet, Unit: types.UnitOfMeasureWh},
+		{Value: strconv.FormatFloat(powerW, 'f', 0, 64), Context: context, Measurand: types.MeasurandPowerActiveImport, Location: types.LocationOutlet, Unit: types.UnitOfMeasureW},
+		{Value: strconv.FormatFloat(current, 'f', 1, 64), Context: context, Measurand: types.MeasurandCurrentImport, Location: types.LocationOutlet, Unit: types.UnitOfMeasureA},
+		{Value: strconv.FormatFloat(voltage, 'f', 1, 64), Context: context, Measurand: types.MeasurandVoltage, Location: types.LocationOutlet, Unit: types.UnitOfMeasureV},
+	}
+	if hasVehicle {
+		samples = append(samples, types.SampledValue{Value: strconv.FormatFloat(soc, 'f', 0, 64), Context: context, Measurand: types.MeasueandSoC, Location: types.LocationEV, Unit: types.UnitOfMeasurePercent})
+	}
+
+	request := core.NewMeterValuesRequest(c.id, []types.MeterValue{{
+		Timestamp:    types.NewDateTime(time.Now()),
+		SampledValue: samples,
+	}})
+	if transactionID != 0 {
+		request.TransactionId = &transactionID
+	}
+
+	if _, err := c.cp.send(request); err != nil {
+		c.log.WithError(err).Warn("Failed to send meter values")
+	}
+}
+
+// vehicle is the electric vehicle charged in a session
+type vehicle struct {
+	capacityWh float64
+	soc        float64 // State of charge in percent
+	maxPowerW  float64
+	powerW     float64 // Power drawn in the last interval
+}
+
+// newVehicle creates a vehicle with a random battery and state of charge that draws close to the charger's maximum power
+func newVehicle(chargerKW float64) *vehicle {
+	return &vehicle{
+		capacityWh: (40 + rand.Float64()*60) * 1000,
+		soc:        10 + rand.Float64()*50,
+		maxPowerW:  chargerKW * 1000 * (0.85 + rand.Float64()*0.15),
+	}
+}
+
+// charge charges the vehicle for a duration and returns the energy delivered in Wh. Vehicles draw
+// their maximum power up to 80 % and taper off linearly above, down to a tenth of it.
+func (v *vehicle) charge(d time.Duration) float64 {
+	power := v.maxPowerW
+	switch {
+	case v.soc >= 100:
+		power = 0
+	case v.soc > 80:
+		power *= math.Max(0.1, (100-v.soc)/20)
+	}
+
+	energy := power * d.Hours()
+	v.soc = math.Min(100, v.soc+energy/v.capacityWh*100)
+	v.powerW = power
+	return energy
+}
+
+// full reports whether the vehicle stopped drawing power
+func (v *vehicle) full() bool {
+	return v.soc >= 100
+}
+
+// jitter returns a random duration between half and one and a half times the mean
+func jitter(mean time.Duration) time.Duration {
+	return time.Duration(float64(mean) * (0.5 + rand.Float64()))
+}
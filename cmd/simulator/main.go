@@ -0,0 +1,130 @@
+// Command simulator runs a simulated OCPP 1.6 charge point against a CPMS, so the CPMS can be
+// developed and demoed without hardware. The charge point boots, sends heartbeats and status
+// notifications, runs charging sessions with realistic meter values, answers the commands of the
+// CPMS and injects the faults of an optional script.
+//
+// With -count the simulator becomes a load generator: it connects many charge points, numbered after
+// -id and spread over -ramp, and reports the latency and errors of their requests, so the capacity of
+// a CPMS can be measured. -heartbeat, -meter-interval, -session and -idle control the message rates.
+// Thousands of charge points need as many open files, so raise the limit with ulimit -n.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// config is the configuration of a simulated charge point
+type config struct {
+	url               string        // OCPP endpoint, the charge point ID is appended
+	id                string        // Charge point ID
+	password          string        // Basic auth password, empty to connect without authentication
+	vendor            string        // Reported in the boot notification
+	model             string        // Reported in the boot notification
+	serialNumber      string        // Reported in the boot notification
+	firmware          string        // Reported in the boot notification
+	connectors        int           // Number of connectors
+	idTag             string        // idTag of locally started sessions
+	maxPowerKW        float64       // Maximum charging power per connector
+	meterInterval     time.Duration // Default MeterValueSampleInterval
+	heartbeatInterval time.Duration // Fixed HeartbeatInterval, 0 to use the one of the CPMS
+	sessionLength     time.Duration // Mean length of automatic sessions
+	idleTime          time.Duration // Mean time between automatic sessions
+	autoSessions      bool          // Start sessions without a remote start
+	script            []step        // Scripted faults and events
+}
+
+func main() {
+	cfg := &config{}
+	var scriptPath, logLevel string
+	var count int
+	var ramp, reportInterval time.Duration
+
+	flags := flag.NewFlagSet("simulator", flag.ExitOnError)
+	flags.StringVar(&cfg.url, "url", "ws://localhost:9000/ocpp", "OCPP endpoint of the CPMS, the charge point ID is appended")
+	flags.StringVar(&cfg.id, "id", "SIM-001", "Charge point ID, the prefix of the numbered IDs with -count")
+	flags.StringVar(&cfg.password, "password", "", "Basic auth password, if the CPMS requires one")
+	flags.StringVar(&cfg.vendor, "vendor", "go-cpms", "Charge point vendor")
+	flags.StringVar(&cfg.model, "model", "Simulator", "Charge point model")
+	flags.StringVar(&cfg.serialNumber, "serial", "", "Charge point serial number")
+	flags.StringVar(&cfg.firmware, "firmware", "1.0.0", "Firmware version")
+	flags.IntVar(&cfg.connectors, "connectors", 2, "Number of connectors")
+	flags.StringVar(&cfg.idTag, "idtag", "SIMULATOR", "idTag of sessions started at the charge point")
+	flags.Float64Var(&cfg.maxPowerKW, "power", 11, "Maximum charging power per connector in kW")
+	flags.DurationVar(&cfg.meterInterval, "meter-interval", 30*time.Second, "Interval of meter values during sessions")
+	flags.DurationVar(&cfg.heartbeatInterval, "heartbeat", 0, "Heartbeat interval, 0 to use the interval of the CPMS")
+	flags.DurationVar(&cfg.sessionLength, "session", 20*time.Minute, "Mean length of automatic sessions")
+	flags.DurationVar(&cfg.idleTime, "idle", 5*time.Minute, "Mean time between automatic sessions")
+	flags.BoolVar(&cfg.autoSessions, "auto", true, "Start sessions automatically, otherwise only remote starts and the script start sessions")
+	flags.StringVar(&scriptPath, "script", "", "Path to a script of timed faults and events, one step like \"30s fault 1 GroundFailure\" per line")
+	flags.IntVar(&count, "count", 1, "Number of charge points to simulate")
+	flags.DurationVar(&ramp, "ramp", 0, "Spread the connections of the charge points over this duration")
+	flags.DurationVar(&reportInterval, "report", 0, "Interval of latency and error reports, 0 to report only when stopping")
+	flags.StringVar(&logLevel, "log-level", "info", "Log level")
+	flags.Parse(os.Args[1:])
+
+	level, err := logrus.ParseLevel(logLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid log level: %v\n", err)
+		os.Exit(2)
+	}
+	logrus.SetLevel(level)
+
+	if cfg.connectors < 1 {
+		fmt.Fprintln(os.Stderr, "At least one connector is required")
+		os.Exit(2)
+	}
+	if count < 1 {
+		fmt.Fprintln(os.Stderr, "At least one charge point is required")
+		os.Exit(2)
+	}
+	if cfg.meterInterval < time.Second || (cfg.heartbeatInterval != 0 && cfg.heartbeatInterval < time.Second) {
+		fmt.Fprintln(os.Stderr, "Intervals must be at least a second")
+		os.Exit(2)
+	}
+
+	if scriptPath != "" {
+		cfg.script, err = loadScript(scriptPath, cfg.connectors)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid script: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	m := newMetrics()
+	if reportInterval > 0 {
+		go m.reportEvery(ctx, os.Stdout, reportInterval)
+	}
+
+	var wg sync.WaitGroup
+	for i := 1; i <= count; i++ {
+		cpCfg := *cfg
+		if count > 1 {
+			cpCfg.id = fmt.Sprintf("%s-%0*d", cfg.id, len(fmt.Sprint(count)), i)
+		}
+
+		wg.Add(1)
+		go func(cp *chargePoint) {
+			defer wg.Done()
+			cp.run(ctx)
+		}(newChargePoint(&cpCfg, m))
+
+		if i < count && !sleep(ctx, ramp/time.Duration(count)) {
+			break
+		}
+	}
+	wg.Wait()
+
+	m.report(os.Stdout)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// connectAction is the name the metrics record connection attempts under
+const connectAction = "Connect"
+
+// metrics collects the latency and errors of the connections and requests of the simulated charge points,
+// as seen by the charge points, so the capacity of a CPMS can be measured
+type metrics struct {
+	start     time.Time
+	connected atomic.Int64
+
+	mu      sync.Mutex
+	actions map[string]*actionMetrics
+}
+
+// actionMetrics are the metrics of an action
+type actionMetrics struct {
+	latencies []time.Duration // Of the successful requests
+	errors    int
+}
+
+// newMetrics creates an empty metrics collector
+func newMetrics() *metrics {
+	return &metrics{
+		start:   time.Now(),
+		actions: map[string]*actionMetrics{},
+	}
+}
+
+// record records the outcome of a request
+func (m *metrics) record(action string, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a := m.actions[action]
+	if a == nil {
+		a = &actionMetrics{}
+		m.actions[action] = a
+	}
+	if err != nil {
+		a.errors++
+		return
+	}
+	a.latencies = append(a.latencies, latency)
+}
+
+// reportEvery writes the metrics at an interval until the context is cancelled
+func (m *metrics) reportEvery(ctx context.Context, w io.Writer, interval time.Duration) {
+	for sleep(ctx, interval) {
+		m.report(w)
+	}
+}
+
+// report writes the connected charge points and the count, rate, error rate and latency percentiles
+// of every action since the start
+func (m *metrics) report(w io.Writer) {
+	elapsed := time.Since(m.start)
+
+	m.mu.Lock()
+	names := make([]string, 0, len(m.actions))
+	for name := range m.actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type row struct {
+		name               string
+		count, errors      int
+		p50, p95, p99, max time.Duration
+	}
+	rows := make([]row, 0, len(names))
+	for _, name := range names {
+		a := m.actions[name]
+		latencies := append([]time.Duration(nil), a.latencies...)
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+		r := row{name: name, count: len(latencies) + a.errors, errors: a.errors}
+		if len(latencies) > 0 {
+			r.p50 = percentile(latencies, 0.50)
+			r.p95 = percentile(latencies, 0.95)
+			r.p99 = percentile(latencies, 0.99)
+			r.max = latencies[len(latencies)-1]
+		}
+		rows = append(rows, r)
+	}
+	m.mu.Unlock()
+
+	fmt.Fprintf(w, "\n%s elapsed, %d charge points connected\n", elapsed.Round(time.Second), m.connected.Load())
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Action\tCount\tRate/s\tErrors\tError %\tp50\tp95\tp99\tMax\t")
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%d\t%.2f\t%s\t%s\t%s\t%s\t\n",
+			r.name, r.count, float64(r.count)/elapsed.Seconds(), r.errors, 100*float64(r.errors)/float64(r.count),
+			formatLatency(r.p50), formatLatency(r.p95), formatLatency(r.p99), formatLatency(r.max))
+	}
+	tw.Flush()
+}
+
+// percentile returns the q quantile of sorted latencies
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	return sorted[int(q*float64(len(sorted)-1)+0.5)]
+}
+
+// formatLatency formats a latency in milliseconds
+func formatLatency(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/sirupsen/logrus"
+)
+
+// A script injects faults and events at times relative to the start of the simulator, one step per line:
+//
+//	# At  Action      Arguments
+//	30s   fault       1 GroundFailure Ground fault detected
+//	2m    clear       1
+//	3m    start       2 TAG-42
+//	10m   stop        2
+//	12m   disconnect  45s
+//	15m   reboot
+//
+// fault puts a connector in the Faulted state with an OCPP error code and optional info, stopping its
+// session, and clear clears the fault. start starts a session at a connector with the given idTag or the
+// -idtag one, and stop stops it. disconnect drops the connection for a duration, reboot stops all sessions
+// and boots the charge point again.
+
+// errorCodes are the OCPP 1.6 error codes a script can inject
+var errorCodes = map[core.ChargePointErrorCode]bool{
+	core.ConnectorLockFailure: true,
+	core.EVCommunicationError: true,
+	core.GroundFailure:        true,
+	core.HighTemperature:      true,
+	core.InternalError:        true,
+	core.LocalListConflict:    true,
+	core.OtherError:           true,
+	core.OverCurrentFailure:   true,
+	core.OverVoltage:          true,
+	core.PowerMeterFailure:    true,
+	core.PowerSwitchFailure:   true,
+	core.ReaderFailure:        true,
+	core.ResetFailure:         true,
+	core.UnderVoltage:         true,
+	core.WeakSignal:           true,
+}
+
+// step is a step of a script
+type step struct {
+	line      int
+	at        time.Duration
+	action    string
+	connector int
+	errorCode core.ChargePointErrorCode
+	info      string
+	idTag     string
+	duration  time.Duration
+}
+
+// loadScript reads a script for a charge point with the given number of connectors, ordered by time
+func loadScript(path string, connectors int) ([]step, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var steps []step
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		s, err := parseStep(fields, connectors)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		s.line = line
+		steps = append(steps, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].at < steps[j].at })
+	return steps, nil
+}
+
+// parseStep parses the fields of a script line
+func parseStep(fields []string, connectors int) (step, error) {
+	if len(fields) < 2 {
+		return step{}, fmt.Errorf("expected a time and an action")
+	}
+
+	at, err := time.ParseDuration(fields[0])
+	if err != nil || at < 0 {
+		return step{}, fmt.Errorf("invalid time %q", fields[0])
+	}
+	s := step{at: at, action: fields[1]}
+	args := fields[2:]
+
+	switch s.action {
+	case "fault", "clear", "start", "stop":
+		if len(args) == 0 {
+			return step{}, fmt.Errorf("%s requires a connector", s.action)
+		}
+		s.connector, err = strconv.Atoi(args[0])
+		if err != nil || s.connector < 1 || s.connector > connectors {
+			return step{}, fmt.Errorf("invalid connector %q, the charge point has %d", args[0], connectors)
+		}
+		args = args[1:]
+	}
+
+	switch s.action {
+	case "fault":
+		if len(args) == 0 {
+			return step{}, fmt.Errorf("fault requires an error code")
+		}
+		s.errorCode = core.ChargePointErrorCode(args[0])
+		if !errorCodes[s.errorCode] {
+			return step{}, fmt.Errorf("unknown error code %q", args[0])
+		}
+		s.info = strings.Join(args[1:], " ")
+	case "start":
+		if len(args) > 0 {
+			s.idTag = args[0]
+		}
+	case "clear", "stop", "reboot":
+	case "disconnect":
+		if len(args) == 0 {
+			return step{}, fmt.Errorf("disconnect requires a duration")
+		}
+		s.duration, err = time.ParseDuration(args[0])
+		if err != nil || s.duration <= 0 {
+			return step{}, fmt.Errorf("invalid duration %q", args[0])
+		}
+	default:
+		return step{}, fmt.Errorf("unknown action %q", s.action)
+	}
+	return s, nil
+}
+
+// runScript runs the steps of the script at their times
+func (cp *chargePoint) runScript(ctx context.Context) {
+	start := time.Now()
+	for _, s := range cp.cfg.script {
+		if !sleep(ctx, time.Until(start.Add(s.at))) {
+			return
+		}
+
+		cp.log.WithFields(logrus.Fields{
+			"line":   s.line,
+			"action": s.action,
+		}).Info("Running script step")
+
+		switch s.action {
+		case "fault":
+			cp.connector(s.connector).fault(s.errorCode, s.info)
+		case "clear":
+			cp.connector(s.connector).clearFault()
+		case "start":
+			idTag := s.idTag
+			if idTag == "" {
+				idTag = cp.cfg.idTag
+			}
+			if !cp.connector(s.connector).requestStart(idTag, false) {
+				cp.log.WithField("connectorId", s.connector).Warn("Connector is not available, session not started")
+			}
+		case "stop":
+			cp.connector(s.connector).stopSession(core.ReasonLocal)
+		case "disconnect":
+			cp.disconnectFor(ctx, s.duration)
+		case "reboot":
+			cp.reboot(ctx, core.ReasonReboot)
+		}
+	}
+}
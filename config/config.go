@@ -2,9 +2,16 @@ package config
 
 import (
 	"fmt"
+	"log"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/balu-dk/go-cpms/internal/clientip"
+	"github.com/balu-dk/go-cpms/internal/logfile"
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
 )
@@ -17,6 +24,7 @@ type Config struct {
 	OCPPPath   string
 
 	// Database configuration
+	DBDriver   string // postgres, or memory to keep everything in process without a database
 	DBHost     string
 	DBPort     int
 	DBUser     string
@@ -24,60 +32,836 @@ type Config struct {
 	DBName     string
 	DBSSLMode  string
 
+	DBConnectRetries      int  // Connection attempts at startup before giving up
+	DBConnectBackoff      int  // Initial delay in seconds between connection attempts, doubled for every attempt
+	DBHealthCheckInterval int  // Seconds between database health checks
+	TimescaleEnabled      bool // meter_values and connector_status_events are hypertables, see migrations/timescale.sql
+
 	// OCPP configuration
-	HeartbeatInterval int
+	HeartbeatInterval  int
+	OCPPTenantFromPath bool              // Take the tenant from the path element before the charge point ID, e.g. OCPP_PATH=/ocpp/{tenant}/{id}
+	OCPPTenantPrefixes map[string]string // Charge point ID prefix -> tenant ID for charge points connecting without a tenant path
+	OCPPSubprotocols   []string          // OCPP versions negotiated per connection on the OCPP endpoint, ocpp1.6 (default) and ocpp2.0.1, which is monitoring-only
+
+	// OCPP websocket configuration, for deployments behind load balancers closing idle connections
+	OCPPWSPingWait        int      // Seconds without a message or ping from a charge point before its connection is closed, 0 keeps idle connections open
+	OCPPWSWriteWait       int      // Seconds allowed for writing a frame to a charge point
+	OCPPWSPingInterval    int      // WebSocketPingInterval configured on charge points when they boot, 0 leaves their setting alone
+	OCPPWSMaxMessageSize  int      // Bytes, charge points sending larger frames are disconnected once the frame is read, 0 disables the limit
+	OCPPConnectionHeaders []string // Handshake headers recorded with each connection besides User-Agent and the proxy headers, e.g. a carrier's MSISDN header
+
+	// OCPP flood protection configuration
+	OCPPMessageRateLimit float64 // Heartbeats, status notifications, meter values and data transfers per second per charge point, 0 disables the limit
+	OCPPMessageRateBurst int
+	OCPPFloodDisconnect  bool // Disconnect charge points exceeding the limit instead of only skipping persistence
+
+	// OCPP connection limit configuration, connections over the limits are rejected during the websocket handshake
+	OCPPMaxConnections   int     // Concurrent charge point connections to this instance, 0 is unlimited
+	OCPPConnectRateLimit float64 // Connection attempts per second per client address, 0 disables the limit
+	OCPPConnectRateBurst int
+
+	// Charger clock drift configuration
+	ClockDriftThreshold int // Seconds a charger clock may deviate from server time before the charge point is flagged, 0 disables drift detection
+
+	// Reboot loop protection configuration, for charge points sending BootNotification over and over
+	BootLoopThreshold   int // BootNotifications within the window that put a charge point in a reboot loop, 0 disables the protection
+	BootLoopWindow      int // Seconds
+	BootLoopMaxInterval int // Seconds the interval returned to a reboot-looping charge point doubles up to
+
+	// Status notification configuration
+	StatusDedup    bool // Skip status notifications repeating the stored status of a connector instead of persisting and publishing them
+	StatusDebounce int  // Seconds a connector's change between Available and Preparing must hold before it is persisted, 0 disables debouncing
+
+	// Charger timestamp policy configuration, for timestamps too far from the time a message is received
+	TimestampPolicy    string // accept records implausible timestamps as reported, normalize replaces them by the receive time
+	TimestampMaxPast   int    // Seconds a timestamp may lie before the receive time, covering messages queued while offline
+	TimestampMaxFuture int    // Seconds a timestamp may lie after the receive time
+
+	// Meter value retention configuration
+	MeterValueRetentionDays     int // Days raw meter values are kept, 0 keeps them forever
+	MeterValueDownsampleMinutes int // Bucket size older meter values are downsampled to before pruning, 0 discards them
+
+	// OCPP message retention configuration
+	OCPPMessageRetentionDays int    // Days OCPP and quarantined messages are kept in the database, 0 keeps them forever
+	OCPPArchiveDestination   string // file:///path or s3://bucket/prefix old OCPP messages are archived to before deletion
+	S3Region                 string
+	S3Endpoint               string // Custom S3 compatible endpoint, empty uses AWS
+	S3AccessKeyID            string
+	S3SecretAccessKey        string
+
+	// OCPP message redaction configuration
+	OCPPLogRedactFields     []string // Payload fields masked in logged OCPP messages in addition to idTags
+	OCPPLogFullChargePoints []string // Charge points whose OCPP messages are logged unredacted, "*" logs all in full for debugging
+
+	// Orphaned transaction configuration
+	OrphanedTransactionTimeout int // Minutes without meter values or heartbeats after which an in-progress transaction is closed as Orphaned, 0 disables the cleanup
+
+	// Offline transaction configuration
+	OfflineTransactionThreshold int    // Seconds a StartTransaction timestamp may lie in the past before the transaction counts as started offline
+	OfflineUnknownIdTagPolicy   string // accept, review or reject offline-started transactions of unknown idTags
+
+	// External authorization configuration
+	AuthCalloutURL      string // Endpoint deciding on the idTags of Authorize and StartTransaction requests, empty authorizes against the local idTags
+	AuthCalloutTimeout  int    // Milliseconds the endpoint is waited for before the fallback policy applies
+	AuthCalloutHeader   string // Authorization header sent to the endpoint, e.g. "Bearer <token>"
+	AuthCalloutFallback string // local, accept or reject when the endpoint fails or times out
+
+	// Authorization cache configuration
+	AuthCacheTTLs map[string]int // Authorization status -> seconds results with it are cached, statuses without a TTL are not cached
+
+	// ISO 15118 Plug & Charge configuration
+	PnCRootCerts          string // PEM file of the V2G and mobility operator roots contract certificates are verified against, empty leaves verifying them to the charge points
+	PnCCertificateURL     string // Certificate provider installing and updating the contract certificates of vehicles, empty rejects their requests
+	PnCCertificateTimeout int    // Milliseconds the certificate provider is waited for
+	PnCCertificateHeader  string // Authorization header sent to the certificate provider, e.g. "Bearer <token>"
+
+	// Firmware update configuration
+	FirmwareMaxAttempts  int
+	FirmwareRetryBackoff int // Base backoff in seconds, doubled for every failed attempt
+
+	// Command retry configuration
+	CommandRetryPolicies map[string]CommandRetryPolicy // Action, or * for all other actions -> retry policy
+	CommandQueueTimeout  int                           // Seconds commands queued for an offline charge point wait for it to reconnect
+
+	// Spot price feed configuration
+	PriceFeedEnabled bool
+	PriceFeedURL     string
+	PriceArea        string
+	PriceCurrency    string // DKK or EUR
+
+	// Carbon intensity feed configuration
+	CarbonFeedEnabled bool
+	CarbonFeedURL     string // Energi Data Service dataset API, read for the price area
+
+	// Tariff configuration
+	TariffMode       string  // flat or spot
+	TariffFlatPrice  float64 // Price per kWh in flat mode
+	TariffSpotMarkup float64 // Markup per kWh added to the spot price in spot mode
+
+	// Charge point statistics configuration
+	ChargePointStatsCacheTTL int // Seconds computed charge point statistics are reused, 0 computes them on every request
+
+	// Solar surplus charging configuration. The export power of a site is pushed to the API or polled from its
+	// meter URL, there is no MQTT input.
+	SolarControlInterval int // Seconds between charging profile adjustments
+
+	// Departure-time aware smart charging configuration
+	DepartureScheduleInterval int     // Seconds between updates of the charging schedules of transactions with a departure time
+	DepartureDefaultMaxPower  float64 // kW a connector is scheduled with when its maximum power is not maintained
+
+	// Spot price optimized charging configuration
+	SpotChargingEnabled  bool    // Defer all transactions to the cheapest spot price hours unless they or their charge point opt out
+	SpotChargingDeadline int     // Hours after its start a transaction without a departure time is scheduled to be charged by
+	SpotChargingEnergy   float64 // kWh a transaction without a target energy is scheduled to be charged with
+
+	// Alerting configuration
+	AlertEvaluationInterval int // Seconds between evaluations of the alert rules
+
+	// Fault diagnostics configuration
+	DiagnosticsLocation   string   // Upload location for diagnostics collected when a connector faults, empty disables collection
+	DiagnosticsErrorCodes []string // Error codes of Faulted connectors triggering collection, empty triggers on any error code
+	DiagnosticsInterval   int      // Minimum minutes between collections from the same charge point
+	DiagnosticsLookback   int      // Minutes of diagnostics before the fault to request
+
+	// Automatic recovery configuration
+	RecoveryEnabled          bool
+	RecoveryFaultThreshold   int // Consecutive Faulted status notifications of a connector triggering a reset
+	RecoveryPreparingTimeout int // Minutes a connector may stay in Preparing before a reset, 0 disables the check
+	RecoveryInterval         int // Minimum minutes between resets of a charge point, and how long it must stay healthy to count as recovered
+	RecoveryMaxAttempts      int // Resets per charge point before giving up, the first Soft and the others Hard
+
+	// Email notification configuration
+	SMTPHost          string // SMTP server emails are sent through, empty disables email notifications
+	SMTPPort          int
+	SMTPUsername      string // Empty sends without authentication
+	SMTPPassword      string
+	EmailFrom         string
+	EmailRecipients   []string
+	EmailEvents       []string // Event types to email, empty emails alert firing and resolution
+	EmailTemplateFile string   // text/template file overriding the "subject" and "body" templates, or those of an event type like "alert.firing.subject"
+
+	// Incident management configuration
+	IncidentProvider string // pagerduty or opsgenie, empty disables opening incidents for alerts
+	IncidentAPIKey   string // PagerDuty integration routing key or Opsgenie API key
+	IncidentURL      string // Provider API endpoint, empty uses the provider's public endpoint
+	IncidentSeverity string // critical, error, warning or info
+
+	// Grid curtailment configuration
+	GridSignalSecret string // HMAC secret for signed demand-response webhooks, empty disables the webhook
+
+	// Webhook configuration
+	WebhookURLs   []string
+	WebhookSecret string
+	WebhookEvents []string // Event types to deliver, empty delivers all
+
+	TransactionUpdateInterval int // Minimum seconds between the transaction.updated events of a transaction, 0 publishes one per MeterValues
+
+	// API authentication configuration
+	APIAuthEnabled bool   // Require an API key on API requests
+	AdminAPIKey    string // Key with access to all tenants and tenant management
+
+	// API rate limiting configuration, per API key or per client address for requests without one
+	APIRateLimit        float64 // Requests per second, 0 disables rate limiting
+	APIRateBurst        int
+	APICommandRateLimit float64 // Requests per second to endpoints changing state, like OCPP commands, 0 applies only APIRateLimit
+	APICommandRateBurst int
+
+	// API TLS configuration, the API is served over plain HTTP when no certificate is configured. Certificates are
+	// not obtained automatically over ACME: a client such as certbot renews the files, which are then reloaded.
+	APITLSCertFile   string // PEM certificate chain, reloaded when the file changes so renewed certificates apply without a restart
+	APITLSKeyFile    string
+	APITLSMinVersion string // 1.2 or 1.3
+
+	// Admin UI configuration
+	AdminUIEnabled bool // Serve the embedded admin web UI at /ui/
+
+	// Reverse proxy configuration
+	TrustedProxies []*net.IPNet // Proxies whose X-Forwarded-For and X-Real-IP headers name the client address of API requests and charge point connections
+
+	// SIEM forwarding configuration
+	SIEMURL          string   // udp:// or tcp:// syslog collector receiving CEF, or http(s):// endpoint receiving JSON, empty disables forwarding
+	SIEMActions      []string // OCPP actions and security events to forward, empty forwards all
+	SIEMChargePoints []string // Charge points whose messages are forwarded, empty forwards all
+	SIEMMinSeverity  int      // Minimum CEF severity (0-10) to forward
+
+	// Clustering configuration
+	InstanceID        string // Unique name of this instance in the charge point connection registry
+	InstanceURL       string // Internal API base URL other instances forward commands to, empty disables forwarding
+	InternalAPISecret string // Shared secret authenticating forwarded commands between instances
 
 	// Logging
-	LogLevel string
+	LogLevel       string
+	LogFormat      string // text or json
+	LogFile        string // Log to this file instead of stderr, empty logs to stderr
+	LogMaxSizeMB   int    // Size at which the log file is rotated, 0 disables rotation by size
+	LogRotateHours int    // Age at which the log file is rotated, 0 disables rotation by age
+	LogMaxBackups  int    // Rotated log files kept, 0 keeps all
 }
 
-// LoadConfig loads configuration from environment variables
-func LoadConfig() (*Config, error) {
+// CommandRetryPolicy is how a command failing with a transient error, a timeout or a disconnected charge point, is retried
+type CommandRetryPolicy struct {
+	MaxAttempts       int  // Attempts including the first one
+	Backoff           int  // Seconds before the first retry, doubled for every further retry
+	QueueOnDisconnect bool // Commands for an offline charge point wait for it to reconnect instead of failing
+}
+
+// LoadConfig loads configuration from environment variables layered over the config file at path,
+// if one is given. All invalid settings are reported together rather than only the first.
+func LoadConfig(path string) (*Config, error) {
 	// Load .env file if it exists
 	_ = godotenv.Load()
 
-	// Server configuration
-	serverPort, err := strconv.Atoi(getEnv("SERVER_PORT", "8887"))
-	if err != nil {
-		return nil, fmt.Errorf("invalid SERVER_PORT: %v", err)
+	l := &loader{}
+	if path != "" {
+		file, err := readFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		l.file = file
 	}
 
-	apiPort, err := strconv.Atoi(getEnv("API_PORT", "8888"))
-	if err != nil {
-		return nil, fmt.Errorf("invalid API_PORT: %v", err)
-	}
+	// Server configuration
+	serverPort := l.port("SERVER_PORT", "8887")
+	apiPort := l.port("API_PORT", "8888")
 
 	// Database configuration
-	dbPort, err := strconv.Atoi(getEnv("DB_PORT", "5432"))
-	if err != nil {
-		return nil, fmt.Errorf("invalid DB_PORT: %v", err)
+	dbDriver := l.get("DB_DRIVER", "postgres")
+	if dbDriver != "postgres" && dbDriver != "memory" {
+		l.fail("invalid DB_DRIVER: %q, use postgres or memory", dbDriver)
 	}
 
+	dbPort := l.port("DB_PORT", "5432")
+	dbConnectRetries := l.int("DB_CONNECT_RETRIES", "10")
+	dbConnectBackoff := l.int("DB_CONNECT_BACKOFF", "1")
+	dbHealthCheckInterval := l.int("DB_HEALTH_CHECK_INTERVAL", "30")
+	timescaleEnabled := l.bool("TIMESCALE_ENABLED", "false")
+
 	// OCPP configuration
-	heartbeatInterval, err := strconv.Atoi(getEnv("HEARTBEAT_INTERVAL", "600"))
+	heartbeatInterval := l.positiveInt("HEARTBEAT_INTERVAL", "600")
+
+	ocppTenantFromPath := l.bool("OCPP_TENANT_FROM_PATH", "false")
+
+	ocppTenantPrefixes := make(map[string]string)
+	for _, entry := range l.list("OCPP_TENANT_PREFIXES") {
+		prefix, tenantID, ok := strings.Cut(entry, "=")
+		if !ok || prefix == "" || tenantID == "" {
+			l.fail("invalid OCPP_TENANT_PREFIXES: expected PREFIX=TENANT, got %q", entry)
+			continue
+		}
+		ocppTenantPrefixes[prefix] = tenantID
+	}
+
+	// OCPP 2.0.1 charging stations are monitoring-only: they can register, send heartbeats and report their
+	// connector statuses, but Authorize and TransactionEvent are answered with NotSupported, so they cannot charge.
+	// They are only accepted when ocpp2.0.1 is listed explicitly.
+	ocppSubprotocols := l.list("OCPP_SUBPROTOCOLS")
+	if len(ocppSubprotocols) == 0 {
+		ocppSubprotocols = []string{"ocpp1.6"}
+	}
+	for _, subprotocol := range ocppSubprotocols {
+		if subprotocol != "ocpp1.6" && subprotocol != "ocpp2.0.1" {
+			l.fail("invalid OCPP_SUBPROTOCOLS: %q, use ocpp1.6 or ocpp2.0.1", subprotocol)
+		}
+	}
+
+	// OCPP websocket configuration
+	ocppWSPingWait := l.int("OCPP_WS_PING_WAIT", "60")
+	if ocppWSPingWait < 0 {
+		l.fail("invalid OCPP_WS_PING_WAIT: must not be negative, got %d", ocppWSPingWait)
+	}
+	ocppWSWriteWait := l.positiveInt("OCPP_WS_WRITE_WAIT", "10")
+	ocppWSPingInterval := l.int("OCPP_WS_PING_INTERVAL", "0")
+	if ocppWSPingInterval < 0 {
+		l.fail("invalid OCPP_WS_PING_INTERVAL: must not be negative, got %d", ocppWSPingInterval)
+	}
+	if ocppWSPingInterval > 0 && ocppWSPingWait > 0 && ocppWSPingInterval >= ocppWSPingWait {
+		l.fail("invalid OCPP_WS_PING_INTERVAL: must be shorter than OCPP_WS_PING_WAIT (%d), got %d", ocppWSPingWait, ocppWSPingInterval)
+	}
+	ocppWSMaxMessageSize := l.int("OCPP_WS_MAX_MESSAGE_SIZE", "0")
+	if ocppWSMaxMessageSize < 0 {
+		l.fail("invalid OCPP_WS_MAX_MESSAGE_SIZE: must not be negative, got %d", ocppWSMaxMessageSize)
+	}
+
+	// OCPP flood protection configuration
+	ocppMessageRateLimit := l.float("OCPP_MESSAGE_RATE_LIMIT", "0")
+	ocppMessageRateBurst := l.int("OCPP_MESSAGE_RATE_BURST", "30")
+	ocppFloodDisconnect := l.bool("OCPP_FLOOD_DISCONNECT", "false")
+
+	// OCPP connection limit configuration
+	ocppMaxConnections := l.int("OCPP_MAX_CONNECTIONS", "0")
+	if ocppMaxConnections < 0 {
+		l.fail("invalid OCPP_MAX_CONNECTIONS: must not be negative, got %d", ocppMaxConnections)
+	}
+	ocppConnectRateLimit := l.float("OCPP_CONNECT_RATE_LIMIT", "0")
+	ocppConnectRateBurst := l.int("OCPP_CONNECT_RATE_BURST", "10")
+
+	// Charger clock drift configuration
+	clockDriftThreshold := l.int("CLOCK_DRIFT_THRESHOLD", "60")
+	if clockDriftThreshold < 0 {
+		l.fail("invalid CLOCK_DRIFT_THRESHOLD: must not be negative, got %d", clockDriftThreshold)
+	}
+
+	// Reboot loop protection configuration
+	bootLoopThreshold := l.int("BOOT_LOOP_THRESHOLD", "5")
+	if bootLoopThreshold < 0 {
+		l.fail("invalid BOOT_LOOP_THRESHOLD: must not be negative, got %d", bootLoopThreshold)
+	}
+	bootLoopWindow := l.positiveInt("BOOT_LOOP_WINDOW", "600")
+	bootLoopMaxInterval := l.positiveInt("BOOT_LOOP_MAX_INTERVAL", "3600")
+
+	// Status notification configuration
+	statusDedup := l.bool("STATUS_DEDUP", "true")
+	statusDebounce := l.int("STATUS_DEBOUNCE", "5")
+	if statusDebounce < 0 {
+		l.fail("invalid STATUS_DEBOUNCE: must not be negative, got %d", statusDebounce)
+	}
+
+	// Charger timestamp policy configuration
+	timestampPolicy := l.get("TIMESTAMP_POLICY", "accept")
+	if timestampPolicy != "accept" && timestampPolicy != "normalize" {
+		l.fail("invalid TIMESTAMP_POLICY: %q, use accept or normalize", timestampPolicy)
+	}
+	timestampMaxPast := l.positiveInt("TIMESTAMP_MAX_PAST", "2592000")
+	timestampMaxFuture := l.positiveInt("TIMESTAMP_MAX_FUTURE", "300")
+
+	// Meter value retention configuration
+	meterValueRetentionDays := l.int("METER_VALUE_RETENTION_DAYS", "90")
+	meterValueDownsampleMinutes := l.int("METER_VALUE_DOWNSAMPLE_MINUTES", "15")
+
+	// OCPP message retention configuration
+	ocppMessageRetentionDays := l.int("OCPP_MESSAGE_RETENTION_DAYS", "0")
+
+	ocppArchiveDestination := l.get("OCPP_ARCHIVE_DESTINATION", "")
+	if ocppArchiveDestination != "" {
+		u, err := url.Parse(ocppArchiveDestination)
+		if err != nil {
+			l.fail("invalid OCPP_ARCHIVE_DESTINATION: %v", err)
+		} else if u.Scheme != "file" && u.Scheme != "s3" {
+			l.fail("invalid OCPP_ARCHIVE_DESTINATION: unsupported scheme %q, use file or s3", u.Scheme)
+		}
+	}
+	if ocppMessageRetentionDays > 0 && ocppArchiveDestination == "" {
+		l.fail("OCPP_ARCHIVE_DESTINATION is required when OCPP_MESSAGE_RETENTION_DAYS is set")
+	}
+
+	// Orphaned transaction configuration
+	orphanedTransactionTimeout := l.int("ORPHANED_TRANSACTION_TIMEOUT", "0")
+
+	// Offline transaction configuration
+	offlineTransactionThreshold := l.positiveInt("OFFLINE_TRANSACTION_THRESHOLD", "300")
+
+	offlineUnknownIdTagPolicy := l.get("OFFLINE_UNKNOWN_IDTAG_POLICY", "review")
+	if offlineUnknownIdTagPolicy != "accept" && offlineUnknownIdTagPolicy != "review" && offlineUnknownIdTagPolicy != "reject" {
+		l.fail("invalid OFFLINE_UNKNOWN_IDTAG_POLICY: %q, use accept, review or reject", offlineUnknownIdTagPolicy)
+	}
+
+	// External authorization configuration
+	authCalloutURL := l.get("AUTH_CALLOUT_URL", "")
+	if authCalloutURL != "" {
+		u, err := url.Parse(authCalloutURL)
+		if err != nil {
+			l.fail("invalid AUTH_CALLOUT_URL: %v", err)
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			l.fail("invalid AUTH_CALLOUT_URL: unsupported scheme %q, use http or https", u.Scheme)
+		}
+	}
+
+	authCalloutTimeout := l.positiveInt("AUTH_CALLOUT_TIMEOUT", "2000")
+
+	authCalloutFallback := l.get("AUTH_CALLOUT_FALLBACK", "local")
+	if authCalloutFallback != "local" && authCalloutFallback != "accept" && authCalloutFallback != "reject" {
+		l.fail("invalid AUTH_CALLOUT_FALLBACK: %q, use local, accept or reject", authCalloutFallback)
+	}
+
+	// Authorization cache configuration
+	authCacheTTLs := make(map[string]int)
+	for _, entry := range l.list("AUTH_CACHE_TTLS") {
+		status, value, ok := strings.Cut(entry, "=")
+		seconds, err := strconv.Atoi(value)
+		if !ok || err != nil || seconds <= 0 {
+			l.fail("invalid AUTH_CACHE_TTLS: expected STATUS=SECONDS, got %q", entry)
+			continue
+		}
+		switch status {
+		case "Accepted", "Blocked", "Expired", "Invalid":
+			authCacheTTLs[status] = seconds
+		default:
+			l.fail("invalid AUTH_CACHE_TTLS: unknown status %q, use Accepted, Blocked, Expired or Invalid", status)
+		}
+	}
+
+	// ISO 15118 Plug & Charge configuration
+	pncCertificateURL := l.get("PNC_CERTIFICATE_URL", "")
+	if pncCertificateURL != "" {
+		u, err := url.Parse(pncCertificateURL)
+		if err != nil {
+			l.fail("invalid PNC_CERTIFICATE_URL: %v", err)
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			l.fail("invalid PNC_CERTIFICATE_URL: unsupported scheme %q, use http or https", u.Scheme)
+		}
+	}
+
+	pncCertificateTimeout := l.positiveInt("PNC_CERTIFICATE_TIMEOUT", "5000")
+
+	// Firmware update configuration
+	firmwareMaxAttempts := l.positiveInt("FIRMWARE_MAX_ATTEMPTS", "3")
+	firmwareRetryBackoff := l.int("FIRMWARE_RETRY_BACKOFF", "300")
+
+	// Command retry configuration
+	commandRetryPolicies := make(map[string]CommandRetryPolicy)
+	for _, entry := range l.list("COMMAND_RETRY_POLICIES") {
+		action, value, _ := strings.Cut(entry, "=")
+		fields := strings.Split(value, ":")
+		if action == "" || len(fields) < 2 || len(fields) > 3 {
+			l.fail("invalid COMMAND_RETRY_POLICIES: expected ACTION=ATTEMPTS:BACKOFF[:queue], got %q", entry)
+			continue
+		}
+		attempts, err := strconv.Atoi(fields[0])
+		if err != nil || attempts < 1 {
+			l.fail("invalid COMMAND_RETRY_POLICIES: attempts of %s must be a positive number, got %q", action, fields[0])
+			continue
+		}
+		backoff, err := strconv.Atoi(fields[1])
+		if err != nil || backoff < 0 {
+			l.fail("invalid COMMAND_RETRY_POLICIES: backoff of %s must not be negative, got %q", action, fields[1])
+			continue
+		}
+		if len(fields) == 3 && fields[2] != "queue" {
+			l.fail("invalid COMMAND_RETRY_POLICIES: unknown option %q of %s, use queue", fields[2], action)
+			continue
+		}
+		commandRetryPolicies[action] = CommandRetryPolicy{
+			MaxAttempts:       attempts,
+			Backoff:           backoff,
+			QueueOnDisconnect: len(fields) == 3,
+		}
+	}
+	commandQueueTimeout := l.positiveInt("COMMAND_QUEUE_TIMEOUT", "3600")
+
+	// Spot price feed configuration
+	priceFeedEnabled := l.bool("PRICE_FEED_ENABLED", "false")
+
+	priceCurrency := l.get("PRICE_CURRENCY", "DKK")
+	if priceCurrency != "DKK" && priceCurrency != "EUR" {
+		l.fail("invalid PRICE_CURRENCY: %q, use DKK or EUR", priceCurrency)
+	}
+
+	// Carbon intensity feed configuration
+	carbonFeedEnabled := l.bool("CARBON_FEED_ENABLED", "false")
+
+	// Tariff configuration
+	tariffMode := l.get("TARIFF_MODE", "flat")
+	if tariffMode != "flat" && tariffMode != "spot" {
+		l.fail("invalid TARIFF_MODE: %q, use flat or spot", tariffMode)
+	}
+
+	tariffFlatPrice := l.float("TARIFF_FLAT_PRICE", "0")
+	tariffSpotMarkup := l.float("TARIFF_SPOT_MARKUP", "0")
+
+	// Charge point statistics configuration
+	chargePointStatsCacheTTL := l.int("CHARGE_POINT_STATS_CACHE_TTL", "300")
+	if chargePointStatsCacheTTL < 0 {
+		l.fail("invalid CHARGE_POINT_STATS_CACHE_TTL: must not be negative, got %d", chargePointStatsCacheTTL)
+	}
+
+	// Solar surplus charging configuration
+	solarControlInterval := l.positiveInt("SOLAR_CONTROL_INTERVAL", "60")
+
+	// Departure-time aware smart charging configuration
+	departureScheduleInterval := l.positiveInt("DEPARTURE_SCHEDULE_INTERVAL", "300")
+	departureDefaultMaxPower := l.float("DEPARTURE_DEFAULT_MAX_POWER", "11")
+	if departureDefaultMaxPower <= 0 {
+		l.fail("invalid DEPARTURE_DEFAULT_MAX_POWER: must be positive, got %g", departureDefaultMaxPower)
+	}
+
+	// Spot price optimized charging configuration
+	spotChargingEnabled := l.bool("SPOT_CHARGING_ENABLED", "false")
+	spotChargingDeadline := l.positiveInt("SPOT_CHARGING_DEADLINE", "8")
+	spotChargingEnergy := l.float("SPOT_CHARGING_ENERGY", "20")
+	if spotChargingEnergy <= 0 {
+		l.fail("invalid SPOT_CHARGING_ENERGY: must be positive, got %g", spotChargingEnergy)
+	}
+
+	// Alerting configuration
+	alertEvaluationInterval := l.positiveInt("ALERT_EVALUATION_INTERVAL", "60")
+
+	// Fault diagnostics configuration
+	diagnosticsInterval := l.positiveInt("DIAGNOSTICS_INTERVAL", "60")
+	diagnosticsLookback := l.positiveInt("DIAGNOSTICS_LOOKBACK", "60")
+
+	// Automatic recovery configuration
+	recoveryEnabled := l.bool("RECOVERY_ENABLED", "false")
+	recoveryFaultThreshold := l.positiveInt("RECOVERY_FAULT_THRESHOLD", "3")
+	recoveryPreparingTimeout := l.int("RECOVERY_PREPARING_TIMEOUT", "15")
+	if recoveryPreparingTimeout < 0 {
+		l.fail("invalid RECOVERY_PREPARING_TIMEOUT: must not be negative, got %d", recoveryPreparingTimeout)
+	}
+	recoveryInterval := l.positiveInt("RECOVERY_INTERVAL", "10")
+	recoveryMaxAttempts := l.positiveInt("RECOVERY_MAX_ATTEMPTS", "3")
+
+	// Email notification configuration
+	smtpHost := l.get("SMTP_HOST", "")
+	smtpPort := l.port("SMTP_PORT", "587")
+	emailFrom := l.get("EMAIL_FROM", "")
+	emailRecipients := l.list("EMAIL_RECIPIENTS")
+	if smtpHost != "" && (emailFrom == "" || len(emailRecipients) == 0) {
+		l.fail("EMAIL_FROM and EMAIL_RECIPIENTS are required when SMTP_HOST is set")
+	}
+
+	// Incident management configuration
+	incidentProvider := l.get("INCIDENT_PROVIDER", "")
+	incidentAPIKey := l.get("INCIDENT_API_KEY", "")
+	switch incidentProvider {
+	case "":
+	case "pagerduty", "opsgenie":
+		if incidentAPIKey == "" {
+			l.fail("INCIDENT_API_KEY is required when INCIDENT_PROVIDER is set")
+		}
+	default:
+		l.fail("invalid INCIDENT_PROVIDER: must be pagerduty or opsgenie, got %q", incidentProvider)
+	}
+	incidentSeverity := l.get("INCIDENT_SEVERITY", "error")
+	switch incidentSeverity {
+	case "critical", "error", "warning", "info":
+	default:
+		l.fail("invalid INCIDENT_SEVERITY: must be critical, error, warning or info, got %q", incidentSeverity)
+	}
+
+	// API authentication configuration
+	apiAuthEnabled := l.bool("API_AUTH_ENABLED", "false")
+
+	// API rate limiting configuration
+	apiRateLimit := l.float("API_RATE_LIMIT", "0")
+	apiRateBurst := l.int("API_RATE_BURST", "20")
+	apiCommandRateLimit := l.float("API_COMMAND_RATE_LIMIT", "0")
+	apiCommandRateBurst := l.int("API_COMMAND_RATE_BURST", "5")
+
+	// API TLS configuration
+	apiTLSCertFile := l.get("API_TLS_CERT_FILE", "")
+	apiTLSKeyFile := l.get("API_TLS_KEY_FILE", "")
+	if (apiTLSCertFile == "") != (apiTLSKeyFile == "") {
+		l.fail("invalid API TLS configuration: API_TLS_CERT_FILE and API_TLS_KEY_FILE must be set together")
+	}
+
+	apiTLSMinVersion := l.get("API_TLS_MIN_VERSION", "1.2")
+	if apiTLSMinVersion != "1.2" && apiTLSMinVersion != "1.3" {
+		l.fail("invalid API_TLS_MIN_VERSION: %q, use 1.2 or 1.3", apiTLSMinVersion)
+	}
+
+	// Reverse proxy configuration
+	trustedProxies, err := clientip.ParseNetworks(l.list("TRUSTED_PROXIES"))
 	if err != nil {
-		return nil, fmt.Errorf("invalid HEARTBEAT_INTERVAL: %v", err)
+		l.fail("invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	// SIEM forwarding configuration
+	siemURL := l.get("SIEM_URL", "")
+	if siemURL != "" {
+		u, err := url.Parse(siemURL)
+		if err != nil {
+			l.fail("invalid SIEM_URL: %v", err)
+		} else {
+			switch u.Scheme {
+			case "udp", "tcp", "http", "https":
+			default:
+				l.fail("invalid SIEM_URL: unsupported scheme %q, use udp, tcp, http or https", u.Scheme)
+			}
+		}
+	}
+
+	siemMinSeverity := l.int("SIEM_MIN_SEVERITY", "0")
+	if siemMinSeverity < 0 || siemMinSeverity > 10 {
+		l.fail("invalid SIEM_MIN_SEVERITY: must be between 0 and 10, got %d", siemMinSeverity)
+	}
+
+	// Clustering configuration
+	instanceID := l.get("INSTANCE_ID", "")
+	if instanceID == "" {
+		instanceID, _ = os.Hostname()
+	}
+
+	instanceURL := strings.TrimSuffix(l.get("INSTANCE_URL", ""), "/")
+	internalAPISecret := l.get("INTERNAL_API_SECRET", "")
+	if instanceURL != "" && internalAPISecret == "" {
+		l.fail("INTERNAL_API_SECRET is required when INSTANCE_URL is set")
+	}
+
+	// Logging
+	logLevel := l.get("LOG_LEVEL", "info")
+	if _, err := logrus.ParseLevel(logLevel); err != nil {
+		l.fail("invalid LOG_LEVEL: %v", err)
+	}
+
+	logFormat := l.get("LOG_FORMAT", "text")
+	if logFormat != "text" && logFormat != "json" {
+		l.fail("invalid LOG_FORMAT: %q, use text or json", logFormat)
+	}
+
+	logMaxSizeMB := l.int("LOG_MAX_SIZE_MB", "100")
+	logRotateHours := l.int("LOG_ROTATE_HOURS", "24")
+	logMaxBackups := l.int("LOG_MAX_BACKUPS", "7")
+
+	if err := l.err(); err != nil {
+		return nil, err
 	}
 
 	return &Config{
 		// Server configuration
 		ServerPort: serverPort,
 		APIPort:    apiPort,
-		OCPPPath:   getEnv("OCPP_PATH", "/ocpp"),
+		OCPPPath:   l.get("OCPP_PATH", "/ocpp"),
 
 		// Database configuration
-		DBHost:     getEnv("DB_HOST", "localhost"),
+		DBDriver:   dbDriver,
+		DBHost:     l.get("DB_HOST", "localhost"),
 		DBPort:     dbPort,
-		DBUser:     getEnv("DB_USER", "postgres"),
-		DBPassword: getEnv("DB_PASSWORD", "postgres"),
-		DBName:     getEnv("DB_NAME", "cpms"),
-		DBSSLMode:  getEnv("DB_SSL_MODE", "disable"),
+		DBUser:     l.get("DB_USER", "postgres"),
+		DBPassword: l.get("DB_PASSWORD", "postgres"),
+		DBName:     l.get("DB_NAME", "cpms"),
+		DBSSLMode:  l.get("DB_SSL_MODE", "disable"),
+
+		DBConnectRetries:      dbConnectRetries,
+		DBConnectBackoff:      dbConnectBackoff,
+		DBHealthCheckInterval: dbHealthCheckInterval,
+		TimescaleEnabled:      timescaleEnabled,
 
 		// OCPP configuration
-		HeartbeatInterval: heartbeatInterval,
+		HeartbeatInterval:  heartbeatInterval,
+		OCPPTenantFromPath: ocppTenantFromPath,
+		OCPPTenantPrefixes: ocppTenantPrefixes,
+		OCPPSubprotocols:   ocppSubprotocols,
+
+		// OCPP websocket configuration
+		OCPPWSPingWait:        ocppWSPingWait,
+		OCPPWSWriteWait:       ocppWSWriteWait,
+		OCPPWSPingInterval:    ocppWSPingInterval,
+		OCPPWSMaxMessageSize:  ocppWSMaxMessageSize,
+		OCPPConnectionHeaders: l.list("OCPP_CONNECTION_HEADERS"),
+
+		// OCPP flood protection configuration
+		OCPPMessageRateLimit: ocppMessageRateLimit,
+		OCPPMessageRateBurst: ocppMessageRateBurst,
+		OCPPFloodDisconnect:  ocppFloodDisconnect,
+
+		// OCPP connection limit configuration
+		OCPPMaxConnections:   ocppMaxConnections,
+		OCPPConnectRateLimit: ocppConnectRateLimit,
+		OCPPConnectRateBurst: ocppConnectRateBurst,
+
+		// Charger clock drift configuration
+		ClockDriftThreshold: clockDriftThreshold,
+
+		// Reboot loop protection configuration
+		BootLoopThreshold:   bootLoopThreshold,
+		BootLoopWindow:      bootLoopWindow,
+		BootLoopMaxInterval: bootLoopMaxInterval,
+
+		// Status notification configuration
+		StatusDedup:    statusDedup,
+		StatusDebounce: statusDebounce,
+
+		// Charger timestamp policy configuration
+		TimestampPolicy:    timestampPolicy,
+		TimestampMaxPast:   timestampMaxPast,
+		TimestampMaxFuture: timestampMaxFuture,
+
+		// Meter value retention configuration
+		MeterValueRetentionDays:     meterValueRetentionDays,
+		MeterValueDownsampleMinutes: meterValueDownsampleMinutes,
+
+		// OCPP message retention configuration
+		OCPPMessageRetentionDays: ocppMessageRetentionDays,
+		OCPPArchiveDestination:   ocppArchiveDestination,
+		S3Region:                 l.get("S3_REGION", "us-east-1"),
+		S3Endpoint:               l.get("S3_ENDPOINT", ""),
+		S3AccessKeyID:            l.get("S3_ACCESS_KEY_ID", ""),
+		S3SecretAccessKey:        l.get("S3_SECRET_ACCESS_KEY", ""),
+
+		// OCPP message redaction configuration
+		OCPPLogRedactFields:     l.list("OCPP_LOG_REDACT_FIELDS"),
+		OCPPLogFullChargePoints: l.list("OCPP_LOG_FULL_CHARGE_POINTS"),
+
+		// Orphaned transaction configuration
+		OrphanedTransactionTimeout: orphanedTransactionTimeout,
+
+		// Offline transaction configuration
+		OfflineTransactionThreshold: offlineTransactionThreshold,
+		OfflineUnknownIdTagPolicy:   offlineUnknownIdTagPolicy,
+
+		// External authorization configuration
+		AuthCalloutURL:      authCalloutURL,
+		AuthCalloutTimeout:  authCalloutTimeout,
+		AuthCalloutHeader:   l.get("AUTH_CALLOUT_HEADER", ""),
+		AuthCalloutFallback: authCalloutFallback,
+
+		// Authorization cache configuration
+		AuthCacheTTLs: authCacheTTLs,
+
+		// ISO 15118 Plug & Charge configuration
+		PnCRootCerts:          l.get("PNC_ROOT_CERTS", ""),
+		PnCCertificateURL:     pncCertificateURL,
+		PnCCertificateTimeout: pncCertificateTimeout,
+		PnCCertificateHeader:  l.get("PNC_CERTIFICATE_HEADER", ""),
+
+		// Firmware update configuration
+		FirmwareMaxAttempts:  firmwareMaxAttempts,
+		FirmwareRetryBackoff: firmwareRetryBackoff,
+
+		// Command retry configuration
+		CommandRetryPolicies: commandRetryPolicies,
+		CommandQueueTimeout:  commandQueueTimeout,
+
+		// Spot price feed configuration
+		PriceFeedEnabled: priceFeedEnabled,
+		PriceFeedURL:     l.get("PRICE_FEED_URL", "https://api.energidataservice.dk/dataset/Elspotprices"),
+		PriceArea:        l.get("PRICE_AREA", "DK1"),
+		PriceCurrency:    priceCurrency,
+
+		// Carbon intensity feed configuration
+		CarbonFeedEnabled: carbonFeedEnabled,
+		CarbonFeedURL:     l.get("CARBON_FEED_URL", "https://api.energidataservice.dk/dataset"),
+
+		// Tariff configuration
+		TariffMode:       tariffMode,
+		TariffFlatPrice:  tariffFlatPrice,
+		TariffSpotMarkup: tariffSpotMarkup,
+
+		// Charge point statistics configuration
+		ChargePointStatsCacheTTL: chargePointStatsCacheTTL,
+
+		// Solar surplus charging configuration
+		SolarControlInterval: solarControlInterval,
+
+		// Departure-time aware smart charging configuration
+		DepartureScheduleInterval: departureScheduleInterval,
+		DepartureDefaultMaxPower:  departureDefaultMaxPower,
+
+		// Spot price optimized charging configuration
+		SpotChargingEnabled:  spotChargingEnabled,
+		SpotChargingDeadline: spotChargingDeadline,
+		SpotChargingEnergy:   spotChargingEnergy,
+
+		// Alerting configuration
+		AlertEvaluationInterval: alertEvaluationInterval,
+
+		// Fault diagnostics configuration
+		DiagnosticsLocation:   l.get("DIAGNOSTICS_LOCATION", ""),
+		DiagnosticsErrorCodes: l.list("DIAGNOSTICS_ERROR_CODES"),
+		DiagnosticsInterval:   diagnosticsInterval,
+		DiagnosticsLookback:   diagnosticsLookback,
+
+		// Automatic recovery configuration
+		RecoveryEnabled:          recoveryEnabled,
+		RecoveryFaultThreshold:   recoveryFaultThreshold,
+		RecoveryPreparingTimeout: recoveryPreparingTimeout,
+		RecoveryInterval:         recoveryInterval,
+		RecoveryMaxAttempts:      recoveryMaxAttempts,
+
+		// Email notification configuration
+		SMTPHost:          smtpHost,
+		SMTPPort:          smtpPort,
+		SMTPUsername:      l.get("SMTP_USERNAME", ""),
+		SMTPPassword:      l.get("SMTP_PASSWORD", ""),
+		EmailFrom:         emailFrom,
+		EmailRecipients:   emailRecipients,
+		EmailEvents:       l.list("EMAIL_EVENTS"),
+		EmailTemplateFile: l.get("EMAIL_TEMPLATE_FILE", ""),
+
+		// Incident management configuration
+		IncidentProvider: incidentProvider,
+		IncidentAPIKey:   incidentAPIKey,
+		IncidentURL:      l.get("INCIDENT_URL", ""),
+		IncidentSeverity: incidentSeverity,
+
+		// Grid curtailment configuration
+		GridSignalSecret: l.get("GRID_SIGNAL_SECRET", ""),
+
+		// Webhook configuration
+		WebhookURLs:   l.list("WEBHOOK_URLS"),
+		WebhookSecret: l.get("WEBHOOK_SECRET", ""),
+		WebhookEvents: l.list("WEBHOOK_EVENTS"),
+
+		TransactionUpdateInterval: l.int("TRANSACTION_UPDATE_INTERVAL", "60"),
+
+		// API authentication configuration
+		APIAuthEnabled: apiAuthEnabled,
+		AdminAPIKey:    l.get("ADMIN_API_KEY", ""),
+
+		// API rate limiting configuration
+		APIRateLimit:        apiRateLimit,
+		APIRateBurst:        apiRateBurst,
+		APICommandRateLimit: apiCommandRateLimit,
+		APICommandRateBurst: apiCommandRateBurst,
+
+		// API TLS configuration
+		APITLSCertFile:   apiTLSCertFile,
+		APITLSKeyFile:    apiTLSKeyFile,
+		APITLSMinVersion: apiTLSMinVersion,
+
+		// Admin UI configuration
+		AdminUIEnabled: l.bool("ADMIN_UI_ENABLED", "true"),
+
+		// Reverse proxy configuration
+		TrustedProxies: trustedProxies,
+
+		// SIEM forwarding configuration
+		SIEMURL:          siemURL,
+		SIEMActions:      l.list("SIEM_ACTIONS"),
+		SIEMChargePoints: l.list("SIEM_CHARGE_POINTS"),
+		SIEMMinSeverity:  siemMinSeverity,
+
+		// Clustering configuration
+		InstanceID:        instanceID,
+		InstanceURL:       instanceURL,
+		InternalAPISecret: internalAPISecret,
 
 		// Logging
-		LogLevel: getEnv("LOG_LEVEL", "info"),
+		LogLevel:       logLevel,
+		LogFormat:      logFormat,
+		LogFile:        l.get("LOG_FILE", ""),
+		LogMaxSizeMB:   logMaxSizeMB,
+		LogRotateHours: logRotateHours,
+		LogMaxBackups:  logMaxBackups,
 	}, nil
 }
 
@@ -89,22 +873,32 @@ func (c *Config) GetDSN() string {
 	)
 }
 
-// SetupLogger configures the global logger
-func (c *Config) SetupLogger() {
+// SetupLogger configures the global logger. Output of the standard library logger,
+// like HTTP server errors, is sent through it as well.
+func (c *Config) SetupLogger() error {
 	level, err := logrus.ParseLevel(c.LogLevel)
 	if err != nil {
 		level = logrus.InfoLevel
 	}
 	logrus.SetLevel(level)
-	logrus.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp: true,
-	})
-}
 
-// Helper function to get environment variables with fallback
-func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+	if c.LogFormat == "json" {
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		logrus.SetFormatter(&logrus.TextFormatter{
+			FullTimestamp: true,
+		})
 	}
-	return fallback
+
+	if c.LogFile != "" {
+		w, err := logfile.New(c.LogFile, c.LogMaxSizeMB, time.Duration(c.LogRotateHours)*time.Hour, c.LogMaxBackups)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		logrus.SetOutput(w)
+	}
+
+	log.SetFlags(0)
+	log.SetOutput(logrus.StandardLogger().WriterLevel(logrus.ErrorLevel))
+	return nil
 }
@@ -0,0 +1,293 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readFile reads a YAML (.yaml, .yml) or TOML (.toml) config file into settings by environment variable name.
+// Nested keys are joined with underscores, so
+//
+//	api:
+//	  port: 8080
+//
+// in YAML and
+//
+//	[api]
+//	port = 8080
+//
+// in TOML both set API_PORT. Lists set the comma-separated form of their variable.
+// Only the flat subset of both formats needed for settings is supported: mappings or tables,
+// scalars and lists of scalars.
+func readFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return parseYAML(lines)
+	case ".toml":
+		return parseTOML(lines)
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q, use .yaml, .yml or .toml", filepath.Ext(path))
+	}
+}
+
+// settingName returns the environment variable name of a nested key
+func settingName(keys ...string) string {
+	name := strings.Join(keys, "_")
+	name = strings.NewReplacer("-", "_", ".", "_").Replace(name)
+	return strings.ToUpper(name)
+}
+
+// parseYAML parses nested mappings of scalars and lists of scalars
+func parseYAML(lines []string) (map[string]string, error) {
+	type level struct {
+		indent int
+		key    string
+	}
+
+	settings := make(map[string]string)
+	var stack []level
+	listKey := "" // Setting the "- item" lines below a key without a value are added to
+
+	for i, raw := range lines {
+		line := strings.TrimRight(stripComment(raw), " \t")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if listKey == "" {
+				return nil, fmt.Errorf("line %d: list item without a key", i+1)
+			}
+			item, err := yamlScalar(strings.TrimSpace(strings.TrimPrefix(trimmed, "-")))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			if settings[listKey] != "" {
+				settings[listKey] += ","
+			}
+			settings[listKey] += item
+			continue
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", i+1)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"'`)
+		value = strings.TrimSpace(value)
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		keys := make([]string, 0, len(stack)+1)
+		for _, l := range stack {
+			keys = append(keys, l.key)
+		}
+		name := settingName(append(keys, key)...)
+
+		if value == "" {
+			// A nested mapping or a list follows
+			stack = append(stack, level{indent: indent, key: key})
+			listKey = name
+			continue
+		}
+		listKey = ""
+
+		if strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") || strings.HasPrefix(value, "&") || strings.HasPrefix(value, "*") {
+			return nil, fmt.Errorf("line %d: block scalars, anchors and aliases are not supported", i+1)
+		}
+
+		if strings.HasPrefix(value, "[") {
+			items, err := inlineList(value, yamlScalar)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			settings[name] = items
+			continue
+		}
+
+		scalar, err := yamlScalar(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		settings[name] = scalar
+	}
+
+	return settings, nil
+}
+
+// yamlScalar returns the value of a plain, single-quoted or double-quoted scalar
+func yamlScalar(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, `"`):
+		return strconv.Unquote(v)
+	case strings.HasPrefix(v, "'"):
+		if len(v) < 2 || !strings.HasSuffix(v, "'") {
+			return "", fmt.Errorf("unterminated string %s", v)
+		}
+		return strings.ReplaceAll(v[1:len(v)-1], "''", "'"), nil
+	case v == "~" || v == "null":
+		return "", nil
+	default:
+		return v, nil
+	}
+}
+
+// parseTOML parses tables of key/value pairs with scalar and single-line array values
+func parseTOML(lines []string) (map[string]string, error) {
+	settings := make(map[string]string)
+	var table []string
+
+	for i, raw := range lines {
+		line := strings.TrimSpace(stripComment(raw))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("line %d: invalid table header %s", i+1, line)
+			}
+			table = strings.Split(strings.TrimSpace(line[1:len(line)-1]), ".")
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", i+1)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"'`)
+		value = strings.TrimSpace(value)
+		name := settingName(append(append([]string{}, table...), key)...)
+
+		if strings.HasPrefix(value, "[") {
+			items, err := inlineList(value, tomlScalar)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			settings[name] = items
+			continue
+		}
+
+		scalar, err := tomlScalar(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		settings[name] = scalar
+	}
+
+	return settings, nil
+}
+
+// tomlScalar returns the value of a basic string, literal string, number or boolean
+func tomlScalar(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, `"""`) || strings.HasPrefix(v, "'''"):
+		return "", fmt.Errorf("multi-line strings are not supported")
+	case strings.HasPrefix(v, `"`):
+		return strconv.Unquote(v)
+	case strings.HasPrefix(v, "'"):
+		if len(v) < 2 || !strings.HasSuffix(v, "'") {
+			return "", fmt.Errorf("unterminated string %s", v)
+		}
+		return v[1 : len(v)-1], nil
+	case v == "":
+		return "", fmt.Errorf("missing value")
+	default:
+		return v, nil
+	}
+}
+
+// inlineList returns the items of a single-line list like [a, "b"] in comma-separated form
+func inlineList(v string, scalar func(string) (string, error)) (string, error) {
+	if !strings.HasSuffix(v, "]") {
+		return "", fmt.Errorf("lists must be on a single line")
+	}
+
+	var items []string
+	for _, item := range splitList(v[1 : len(v)-1]) {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		value, err := scalar(item)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, value)
+	}
+	return strings.Join(items, ","), nil
+}
+
+// splitList splits list items on the commas outside of quotes, which only open a string at the start of an item
+func splitList(v string) []string {
+	var items []string
+	var quote rune
+	start := 0
+	for i, c := range v {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && strings.TrimSpace(v[start:i]) == "":
+			quote = c
+		case c == ',':
+			items = append(items, v[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, v[start:])
+}
+
+// stripComment removes a # comment outside of quotes from a line. A quote only opens a string where a scalar
+// starts, so the apostrophe in name: O'Brien # note does not hide the comment.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			switch {
+			case c == '\\' && quote == '"':
+				i++ // Skip the escaped character
+			case c == '\'' && quote == '\'' && i+1 < len(line) && line[i+1] == '\'':
+				i++ // A quote doubled inside a single-quoted YAML string
+			case c == quote:
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && startsScalar(line[:i]):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// startsScalar reports whether a scalar or quoted key starts after the beginning of a line: at its start, after a
+// list item marker, or after a key separator or the bracket or comma of an inline list
+func startsScalar(prefix string) bool {
+	prefix = strings.TrimSpace(prefix)
+	return prefix == "" || prefix == "-" || strings.ContainsAny(prefix[len(prefix)-1:], ":=[,")
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]string
+		wantErr string // Error message prefix
+	}{
+		{
+			name: "nested keys",
+			data: "api:\n  port: 8080\n  tls:\n    enabled: true\ndb-host: localhost\n",
+			want: map[string]string{"API_PORT": "8080", "API_TLS_ENABLED": "true", "DB_HOST": "localhost"},
+		},
+		{
+			name: "back to an outer level",
+			data: "ocpp:\n  ws:\n    ping-wait: 60\n  tenant-from-path: true\nport: 8080\n",
+			want: map[string]string{"OCPP_WS_PING_WAIT": "60", "OCPP_TENANT_FROM_PATH": "true", "PORT": "8080"},
+		},
+		{
+			name: "quoted scalars",
+			data: "a: \"x # y\"\nb: 'it''s'\n\"c\": \"tab\\tstop\"\nd: ~\ne: null\n",
+			want: map[string]string{"A": "x # y", "B": "it's", "C": "tab\tstop", "D": "", "E": ""},
+		},
+		{
+			name: "comments",
+			data: "# settings\n---\nname: O'Brien # note\nurl: http://example.com/#anchor\nkey: 'a # b' # c\n",
+			want: map[string]string{"NAME": "O'Brien", "URL": "http://example.com/#anchor", "KEY": "a # b"},
+		},
+		{
+			name: "block list",
+			data: "proxies:\n  - 10.0.0.0/8\n  - \"192.0.2.10\" # edge\n",
+			want: map[string]string{"PROXIES": "10.0.0.0/8,192.0.2.10"},
+		},
+		{
+			name: "inline list",
+			data: "subprotocols: [ocpp1.6, 'ocpp2.0.1']\n",
+			want: map[string]string{"SUBPROTOCOLS": "ocpp1.6,ocpp2.0.1"},
+		},
+		{name: "list item without a key", data: "port: 8080\n- item\n", wantErr: "line 2: list item without a key"},
+		{name: "missing separator", data: "api:\n  port 8080\n", wantErr: "line 2: expected key: value"},
+		{name: "block scalar", data: "motd: |\n  hello\n", wantErr: "line 1: block scalars"},
+		{name: "alias", data: "a: &port 8080\n", wantErr: "line 1: block scalars"},
+		{name: "multi-line list", data: "a: [1,\n  2]\n", wantErr: "line 1: lists must be on a single line"},
+		{name: "unterminated string", data: "a: 'x\n", wantErr: "line 1: unterminated string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings, err := parseYAML(strings.Split(tt.data, "\n"))
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("parseYAML() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseYAML() error = %v", err)
+			}
+			if !reflect.DeepEqual(settings, tt.want) {
+				t.Errorf("parseYAML() = %v, want %v", settings, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]string
+		wantErr string // Error message prefix
+	}{
+		{
+			name: "tables",
+			data: "port = 8080\n[api]\nrate-limit = 10\n[ocpp.ws]\nping-wait = 60\n",
+			want: map[string]string{"PORT": "8080", "API_RATE_LIMIT": "10", "OCPP_WS_PING_WAIT": "60"},
+		},
+		{
+			name: "strings",
+			data: "a = \"x # y\"\nb = 'C:\\path'\n\"c\" = \"tab\\tstop\"\n",
+			want: map[string]string{"A": "x # y", "B": `C:\path`, "C": "tab\tstop"},
+		},
+		{
+			name: "comments",
+			data: "# settings\nname = O'Brien # note\nkey = 'a # b' # c\n",
+			want: map[string]string{"NAME": "O'Brien", "KEY": "a # b"},
+		},
+		{
+			name: "array",
+			data: "proxies = [\"10.0.0.0/8\", '192.0.2.10', ] # trailing comma\n",
+			want: map[string]string{"PROXIES": "10.0.0.0/8,192.0.2.10"},
+		},
+		{name: "missing separator", data: "port 8080\n", wantErr: "line 1: expected key = value"},
+		{name: "missing value", data: "[api]\nport =\n", wantErr: "line 2: missing value"},
+		{name: "array of tables", data: "[[upstreams]]\n", wantErr: "line 1: invalid table header"},
+		{name: "unterminated table header", data: "[api\n", wantErr: "line 1: invalid table header"},
+		{name: "multi-line string", data: "motd = \"\"\"\nhello\n\"\"\"\n", wantErr: "line 1: multi-line strings"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings, err := parseTOML(strings.Split(tt.data, "\n"))
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("parseTOML() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTOML() error = %v", err)
+			}
+			if !reflect.DeepEqual(settings, tt.want) {
+				t.Errorf("parseTOML() = %v, want %v", settings, tt.want)
+			}
+		})
+	}
+}
+
+func TestInlineList(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain items", value: "[a, b,c]", want: "a,b,c"},
+		{name: "quoted commas", value: `["a,b", 'c,d']`, want: "a,b,c,d"},
+		{name: "apostrophe inside an item", value: "[O'Brien, x]", want: "O'Brien,x"},
+		{name: "empty items skipped", value: "[a, , b,]", want: "a,b"},
+		{name: "empty list", value: "[]", want: ""},
+		{name: "not closed", value: "[a, b", wantErr: true},
+		{name: "invalid item", value: `["a]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := inlineList(tt.value, yamlScalar)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("inlineList() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("inlineList() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("inlineList() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripComment(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{name: "no comment", line: "port: 8080", want: "port: 8080"},
+		{name: "trailing comment", line: "port: 8080 # API", want: "port: 8080 "},
+		{name: "whole line", line: "# API", want: ""},
+		{name: "hash inside a value", line: "url: http://example.com/#anchor", want: "url: http://example.com/#anchor"},
+		{name: "double-quoted hash", line: `key: "a # b" # c`, want: `key: "a # b" `},
+		{name: "single-quoted hash", line: "key: 'a # b' # c", want: "key: 'a # b' "},
+		{name: "escaped quote", line: `key: "say \"# hi\"" # c`, want: `key: "say \"# hi\"" `},
+		{name: "doubled single quote", line: "key: 'it''s # here' # c", want: "key: 'it''s # here' "},
+		{name: "apostrophe inside a plain scalar", line: "name: O'Brien # note", want: "name: O'Brien "},
+		{name: "quote inside a TOML value", line: `size = 5" # inches`, want: `size = 5" `},
+		{name: "quoted key", line: `"a#b": 1 # c`, want: `"a#b": 1 `},
+		{name: "quoted list item", line: "  - '# not a comment' # c", want: "  - '# not a comment' "},
+		{name: "quoted inline list item", line: "a: [x, '# y'] # c", want: "a: [x, '# y'] "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripComment(tt.line); got != tt.want {
+				t.Errorf("stripComment(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
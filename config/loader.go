@@ -0,0 +1,100 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loader reads settings from the environment, falling back to the config file and then to defaults.
+// Invalid settings are collected so they can be reported together.
+type loader struct {
+	file map[string]string // Settings of the config file by environment variable name
+	errs []error
+}
+
+// get returns a setting, or fallback if it is set neither in the environment nor in the config file
+func (l *loader) get(key, fallback string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+	if value, exists := l.file[key]; exists {
+		return value
+	}
+	return fallback
+}
+
+// list returns a comma-separated setting as a list
+func (l *loader) list(key string) []string {
+	var list []string
+	for _, item := range strings.Split(l.get(key, ""), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// int returns an integer setting
+func (l *loader) int(key, fallback string) int {
+	value, err := strconv.Atoi(l.get(key, fallback))
+	if err != nil {
+		l.fail("invalid %s: %v", key, err)
+	}
+	return value
+}
+
+// positiveInt returns an integer setting that must be greater than zero
+func (l *loader) positiveInt(key, fallback string) int {
+	value, err := strconv.Atoi(l.get(key, fallback))
+	if err != nil {
+		l.fail("invalid %s: %v", key, err)
+	} else if value <= 0 {
+		l.fail("invalid %s: must be positive, got %d", key, value)
+	}
+	return value
+}
+
+// port returns a TCP port setting
+func (l *loader) port(key, fallback string) int {
+	value, err := strconv.Atoi(l.get(key, fallback))
+	if err != nil {
+		l.fail("invalid %s: %v", key, err)
+	} else if value < 1 || value > 65535 {
+		l.fail("invalid %s: port must be between 1 and 65535, got %d", key, value)
+	}
+	return value
+}
+
+// float returns a decimal setting
+func (l *loader) float(key, fallback string) float64 {
+	value, err := strconv.ParseFloat(l.get(key, fallback), 64)
+	if err != nil {
+		l.fail("invalid %s: %v", key, err)
+	}
+	return value
+}
+
+// bool returns a boolean setting
+func (l *loader) bool(key, fallback string) bool {
+	value, err := strconv.ParseBool(l.get(key, fallback))
+	if err != nil {
+		l.fail("invalid %s: %v", key, err)
+	}
+	return value
+}
+
+// fail records an invalid setting
+func (l *loader) fail(format string, args ...interface{}) {
+	l.errs = append(l.errs, fmt.Errorf(format, args...))
+}
+
+// err returns all invalid settings as one error, or nil if all settings are valid
+func (l *loader) err() error {
+	if len(l.errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid configuration:\n%w", errors.Join(l.errs...))
+}
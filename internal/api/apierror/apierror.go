@@ -0,0 +1,102 @@
+// Package apierror defines the structured error responses of the REST API
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Error codes returned to API clients. Codes are stable, messages may change.
+const (
+	CodeValidationFailed   = "validation_failed"
+	CodeInvalidRequestBody = "invalid_request_body"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodeChargePointOffline = "charge_point_offline"
+	CodeChargePointFrozen  = "charge_point_frozen"
+	CodeCommandFailed      = "command_failed"
+	CodeRateLimited        = "rate_limited"
+	CodeInternal           = "internal_error"
+)
+
+// FieldError describes why a single request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is the error object of an error response
+type Error struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Details interface{}  `json:"details,omitempty"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// Response is the body of every error response of the API
+type Response struct {
+	Success bool   `json:"success"`
+	Error   *Error `json:"error"`
+}
+
+// New creates an error with a code and a human-readable message
+func New(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Invalid creates a validation error rejecting the given request fields
+func Invalid(message string, fields ...string) *Error {
+	e := New(CodeValidationFailed, message)
+	for _, field := range fields {
+		e.WithField(field, message)
+	}
+	return e
+}
+
+// WithDetails attaches additional machine-readable context to the error
+func (e *Error) WithDetails(details interface{}) *Error {
+	e.Details = details
+	return e
+}
+
+// WithField adds a field error
+func (e *Error) WithField(field, message string) *Error {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+	return e
+}
+
+// CodeForStatus returns the generic error code of an HTTP status
+func CodeForStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return CodeValidationFailed
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	default:
+		return CodeInternal
+	}
+}
+
+// Write sends an error response
+func Write(w http.ResponseWriter, statusCode int, e *Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(Response{
+		Success: false,
+		Error:   e,
+	}); err != nil {
+		logrus.WithError(err).Error("Failed to encode error response")
+	}
+}
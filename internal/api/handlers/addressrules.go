@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// GetAddressRules returns the networks charge points may or may not connect from
+func (h *Handler) GetAddressRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.cpms.GetAddressRules(r.Context())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get address rules")
+		sendErrorResponse(w, "Failed to get address rules", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    rules,
+	})
+}
+
+// SaveAddressRule creates or updates a global or tenant address rule
+func (h *Handler) SaveAddressRule(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Address rule ID is required", "id"))
+		return
+	}
+
+	var req struct {
+		TenantID    string `json:"tenantId,omitempty"`
+		CIDR        string `json:"cidr"`
+		Action      string `json:"action"`
+		Description string `json:"description,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	rule := &models.AddressRule{
+		ID:          id,
+		TenantID:    req.TenantID,
+		CIDR:        req.CIDR,
+		Action:      req.Action,
+		Description: req.Description,
+	}
+
+	if err := service.ValidateAddressRule(rule); err != nil {
+		sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := h.cpms.SaveAddressRule(r.Context(), rule)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Tenant not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to save address rule")
+		sendErrorResponse(w, "Failed to save address rule", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    rule,
+	})
+}
+
+// DeleteAddressRule removes an address rule
+func (h *Handler) DeleteAddressRule(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Address rule ID is required", "id"))
+		return
+	}
+
+	err := h.cpms.DeleteAddressRule(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Address rule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to delete address rule")
+		sendErrorResponse(w, "Failed to delete address rule", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Address rule deleted",
+	})
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// GetAlertRules returns all alert rules
+func (h *Handler) GetAlertRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.cpms.GetAlertRules(r.Context())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get alert rules")
+		sendErrorResponse(w, "Failed to get alert rules", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    rules,
+	})
+}
+
+// GetAlertRule returns a specific alert rule
+func (h *Handler) GetAlertRule(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Alert rule ID is required", "id"))
+		return
+	}
+
+	rule, err := h.cpms.GetAlertRule(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Alert rule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get alert rule")
+		sendErrorResponse(w, "Failed to get alert rule", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    rule,
+	})
+}
+
+// SaveAlertRule creates or updates an alert rule
+func (h *Handler) SaveAlertRule(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Alert rule ID is required", "id"))
+		return
+	}
+
+	var req struct {
+		Name               string `json:"name"`
+		Condition          string `json:"condition"`
+		ChargePointID      string `json:"chargePointId,omitempty"`
+		DurationMinutes    int    `json:"durationMinutes,omitempty"`
+		ErrorCode          string `json:"errorCode,omitempty"`
+		TriggerMeterValues bool   `json:"triggerMeterValues,omitempty"`
+		Enabled            *bool  `json:"enabled,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.Name == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Name is required", "name"))
+		return
+	}
+
+	rule := &models.AlertRule{
+		ID:                 id,
+		Name:               req.Name,
+		Condition:          req.Condition,
+		ChargePointID:      req.ChargePointID,
+		DurationMinutes:    req.DurationMinutes,
+		ErrorCode:          req.ErrorCode,
+		TriggerMeterValues: req.TriggerMeterValues,
+		Enabled:            req.Enabled == nil || *req.Enabled,
+	}
+
+	if err := service.ValidateAlertRule(rule); err != nil {
+		sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.cpms.SaveAlertRule(r.Context(), rule); err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to save alert rule")
+		sendErrorResponse(w, "Failed to save alert rule", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    rule,
+	})
+}
+
+// DeleteAlertRule removes an alert rule
+func (h *Handler) DeleteAlertRule(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Alert rule ID is required", "id"))
+		return
+	}
+
+	err := h.cpms.DeleteAlertRule(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Alert rule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to delete alert rule")
+		sendErrorResponse(w, "Failed to delete alert rule", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Alert rule deleted",
+	})
+}
+
+// GetAlerts returns the most recently fired alerts, optionally only the firing or resolved ones
+func (h *Handler) GetAlerts(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	if state != "" && state != service.AlertStateFiring && state != service.AlertStateResolved {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("State must be 'firing' or 'resolved'", "state"))
+		return
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 {
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Limit must be a positive integer", "limit"))
+			return
+		}
+		limit = l
+	}
+
+	alerts, err := h.cpms.GetAlerts(r.Context(), state, limit)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get alerts")
+		sendErrorResponse(w, "Failed to get alerts", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    alerts,
+	})
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// Limits of how long a command endpoint called with wait=true blocks for the charge point's confirmation
+const (
+	defaultCommandWait = 30 * time.Second
+	maxCommandWait     = 120 * time.Second
+)
+
+// parseCommandWait parses the wait and timeout query parameters of a command endpoint. It returns how long to wait
+// for the charge point's confirmation, 0 if the endpoint should respond once the command is sent.
+func parseCommandWait(r *http.Request) (time.Duration, *apierror.Error) {
+	query := r.URL.Query()
+	if query.Get("wait") == "" {
+		return 0, nil
+	}
+	wait, err := strconv.ParseBool(query.Get("wait"))
+	if err != nil {
+		return 0, apierror.Invalid("Wait must be true or false", "wait")
+	}
+	if !wait {
+		return 0, nil
+	}
+
+	timeout := defaultCommandWait
+	if v := query.Get("timeout"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds <= 0 || time.Duration(seconds)*time.Second > maxCommandWait {
+			return 0, apierror.Invalid("Timeout must be between 1 and 120 seconds", "timeout")
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+	return timeout, nil
+}
+
+// sendCommandResult responds to a command endpoint. Without wait it reports the command as sent, otherwise it
+// waits for the charge point's confirmation and reports the status it confirmed: 200 once confirmed, whether
+// Accepted or Rejected, 202 if the charge point didn't confirm in time and 502 if the command failed.
+func (h *Handler) sendCommandResult(w http.ResponseWriter, r *http.Request, cmd *models.Command, name string, wait time.Duration) {
+	if wait == 0 {
+		sendResponse(w, Response{
+			Success: true,
+			Message: name + " command sent",
+			Data:    cmd,
+		})
+		return
+	}
+
+	result, err := h.cpms.WaitForCommand(r.Context(), cmd, wait)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"id":        cmd.ChargePointID,
+			"commandId": cmd.ID,
+		}).Error("Failed to wait for command")
+		sendErrorResponse(w, "Failed to wait for "+name+" command", http.StatusInternalServerError)
+		return
+	}
+
+	switch result.Status {
+	case service.CommandStatusPending:
+		sendResponseStatus(w, http.StatusAccepted, Response{
+			Success: true,
+			Message: name + " command sent, the charge point didn't confirm it in time",
+			Data:    result,
+		})
+	case service.CommandStatusFailed:
+		sendError(w, http.StatusBadGateway, apierror.New(apierror.CodeCommandFailed, name+" command failed: "+result.Error).WithDetails(result))
+	default:
+		sendResponse(w, Response{
+			Success: true,
+			Message: name + " command " + result.Status,
+			Data:    result,
+		})
+	}
+}
+
+// GetCommands returns the most recent commands sent to a charge point
+func (h *Handler) GetCommands(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 {
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Limit must be a positive integer", "limit"))
+			return
+		}
+		limit = l
+	}
+
+	commands, err := h.cpms.GetCommands(r.Context(), id, limit)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get commands")
+		sendErrorResponse(w, "Failed to get commands", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    commands,
+	})
+}
+
+// SyncLocalList replaces the charge point's local authorization list with its tenant's idTags
+func (h *Handler) SyncLocalList(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	wait, apiErr := parseCommandWait(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	cmd, err := h.cpms.SyncLocalList(r.Context(), id)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to sync local list")
+		sendCommandError(w, err, "Failed to sync local list")
+		return
+	}
+
+	h.sendCommandResult(w, r, cmd, "Send local list", wait)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// GetConfigurationPlan returns the OCPP 2.0.1 variables to set when migrating a charge point, translated
+// from the latest configuration it reported to GetConfiguration
+func (h *Handler) GetConfigurationPlan(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	plan, err := h.cpms.PlanConfigurationMigration(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "No configuration snapshot, request the charge point's configuration first", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to plan configuration migration")
+		sendErrorResponse(w, "Failed to plan configuration migration", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    plan,
+	})
+}
+
+// TranslateConfiguration translates OCPP 1.6 configuration keys to OCPP 2.0.1 variables, or the other way round
+func (h *Handler) TranslateConfiguration(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		From      string                     `json:"from"` // ocpp1.6 or ocpp2.0.1
+		Keys      []models.ConfigurationKey  `json:"keys,omitempty"`
+		Variables []models.ComponentVariable `json:"variables,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	plan, err := h.cpms.TranslateConfiguration(req.From, req.Keys, req.Variables)
+	if errors.Is(err, service.ErrInvalidConfigurationSource) {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("From must be 'ocpp1.6' or 'ocpp2.0.1'", "from"))
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to translate configuration")
+		sendErrorResponse(w, "Failed to translate configuration", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    plan,
+	})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// plugTypes are the OCPI connector standards a connector's plug type can be
+var plugTypes = map[string]bool{
+	"CHADEMO":               true,
+	"DOMESTIC_E":            true,
+	"DOMESTIC_F":            true,
+	"GBT_AC":                true,
+	"GBT_DC":                true,
+	"IEC_60309_2_single_16": true,
+	"IEC_60309_2_three_16":  true,
+	"IEC_60309_2_three_32":  true,
+	"IEC_62196_T1":          true,
+	"IEC_62196_T1_COMBO":    true,
+	"IEC_62196_T2":          true,
+	"IEC_62196_T2_COMBO":    true,
+	"IEC_62196_T3C":         true,
+	"TESLA_S":               true,
+}
+
+// SaveConnectorAttributes updates the operator-maintained attributes of a connector
+func (h *Handler) SaveConnectorAttributes(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	connectorID, err := strconv.Atoi(chi.URLParam(r, "connectorId"))
+	if err != nil || connectorID <= 0 {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Connector ID must be positive", "connectorId"))
+		return
+	}
+
+	var req struct {
+		PlugType   string  `json:"plugType"`   // OCPI connector standard
+		Format     string  `json:"format"`     // SOCKET or CABLE
+		MaxPowerKW float64 `json:"maxPowerKw"` // Maximum charging power in kW
+		Phases     int     `json:"phases"`     // 1 or 3 for AC connectors, 0 for DC connectors
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.PlugType != "" && !plugTypes[req.PlugType] {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("PlugType must be an OCPI connector standard, e.g. IEC_62196_T2", "plugType"))
+		return
+	}
+
+	if req.Format != "" && req.Format != "SOCKET" && req.Format != "CABLE" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Format must be 'SOCKET' or 'CABLE'", "format"))
+		return
+	}
+
+	if req.MaxPowerKW < 0 {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("MaxPowerKw must be non-negative", "maxPowerKw"))
+		return
+	}
+
+	if req.Phases != 0 && req.Phases != 1 && req.Phases != 3 {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Phases must be 1 or 3, or 0 for DC", "phases"))
+		return
+	}
+
+	connector := &models.Connector{
+		ID:            connectorID,
+		ChargePointID: id,
+		PlugType:      req.PlugType,
+		Format:        req.Format,
+		MaxPowerKW:    req.MaxPowerKW,
+		Phases:        req.Phases,
+	}
+
+	err = h.cpms.SaveConnectorAttributes(r.Context(), connector)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Charge point not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"id":          id,
+			"connectorId": connectorID,
+		}).Error("Failed to save connector attributes")
+		sendErrorResponse(w, "Failed to save connector attributes", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Connector attributes updated",
+	})
+}
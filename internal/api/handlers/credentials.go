@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// RotateCredentials starts the rotation of a charge point's basic auth password
+func (h *Handler) RotateCredentials(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	rotation, err := h.cpms.RotateCredentials(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Charge point not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to rotate charge point credentials")
+		sendCommandError(w, err, "Failed to rotate charge point credentials")
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Credential rotation started, it completes when the charge point reconnects with its new password",
+		Data:    rotation,
+	})
+}
+
+// GetCredentialRotations returns the credential rotation history of a charge point
+func (h *Handler) GetCredentialRotations(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 {
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Limit must be a positive integer", "limit"))
+			return
+		}
+		limit = l
+	}
+
+	rotations, err := h.cpms.GetCredentialRotations(r.Context(), id, limit)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get credential rotations")
+		sendErrorResponse(w, "Failed to get credential rotations", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    rotations,
+	})
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+)
+
+// eventStreamKeepAlive is the interval of the empty lines sent on an idle event stream,
+// so proxies don't close it
+const eventStreamKeepAlive = 30 * time.Second
+
+// StreamEvents streams the events published on this instance as NDJSON, one event per line,
+// until the client disconnects. Empty lines are keep-alives.
+func (h *Handler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	events, stop := h.cpms.WatchEvents()
+	defer stop()
+
+	out := newNDJSONWriter(w)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	out.Flush()
+
+	ticker := time.NewTicker(eventStreamKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			if err := out.Write(event); err != nil {
+				return
+			}
+			out.Flush()
+		case <-ticker.C:
+			if _, err := w.Write([]byte("\n")); err != nil {
+				return
+			}
+			out.Flush()
+		}
+	}
+}
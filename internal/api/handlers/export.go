@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// ndjsonWriter encodes one JSON document per line and flushes after every cursor batch,
+// so a slow client applies backpressure to the database cursor
+type ndjsonWriter struct {
+	w       http.ResponseWriter
+	enc     *json.Encoder
+	flusher http.Flusher
+	count   int
+}
+
+func newNDJSONWriter(w http.ResponseWriter) *ndjsonWriter {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	flusher, _ := w.(http.Flusher)
+	return &ndjsonWriter{w: w, enc: json.NewEncoder(w), flusher: flusher}
+}
+
+func (n *ndjsonWriter) Write(v interface{}) error {
+	if err := n.enc.Encode(v); err != nil {
+		return err
+	}
+	n.count++
+	if n.count%db.ExportBatchSize == 0 {
+		n.Flush()
+	}
+	return nil
+}
+
+func (n *ndjsonWriter) Flush() {
+	if n.flusher != nil {
+		n.flusher.Flush()
+	}
+}
+
+// parseExportRange reads the export range from the year or from/to query parameters
+func parseExportRange(r *http.Request, defaultFrom, defaultTo time.Time) (time.Time, time.Time, string) {
+	from, to := defaultFrom, defaultTo
+
+	if v := r.URL.Query().Get("year"); v != "" {
+		year, err := strconv.Atoi(v)
+		if err != nil {
+			return from, to, "Invalid year"
+		}
+		from = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(1, 0, 0), ""
+	}
+
+	var err error
+	if v := r.URL.Query().Get("from"); v != "" {
+		from, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			return from, to, "Invalid from format, use RFC3339"
+		}
+	}
+
+	if v := r.URL.Query().Get("to"); v != "" {
+		to, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			return from, to, "Invalid to format, use RFC3339"
+		}
+	}
+
+	if !to.After(from) {
+		return from, to, "To must be after from"
+	}
+
+	return from, to, ""
+}
+
+// ExportTransactions streams all transactions in a range as NDJSON
+func (h *Handler) ExportTransactions(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	from, to, msg := parseExportRange(r, time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.UTC), now)
+	if msg != "" {
+		sendErrorResponse(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	out := newNDJSONWriter(w)
+	err := h.cpms.ExportTransactions(r.Context(), from, to, func(tx *models.Transaction) error {
+		return out.Write(tx)
+	})
+	out.Flush()
+
+	// The status has already been sent, so a failure can only truncate the stream
+	if err != nil {
+		logrus.WithError(err).WithField("exported", out.count).Error("Failed to export transactions")
+	}
+}
+
+// ExportMeterValues streams all meter values of a charge point in a range as NDJSON
+func (h *Handler) ExportMeterValues(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	from, to, msg := parseExportRange(r, time.Unix(0, 0).UTC(), time.Now().UTC())
+	if msg != "" {
+		sendErrorResponse(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	out := newNDJSONWriter(w)
+	err := h.cpms.ExportMeterValues(r.Context(), id, from, to, func(mv *models.MeterValue) error {
+		return out.Write(mv)
+	})
+	out.Flush()
+
+	// The status has already been sent, so a failure can only truncate the stream
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"id":       id,
+			"exported": out.count,
+		}).Error("Failed to export meter values")
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// UpdateFirmware requests the charge point to update its firmware
+func (h *Handler) UpdateFirmware(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	var req struct {
+		Location     string   `json:"location"`
+		Mirrors      []string `json:"mirrors,omitempty"` // Alternate locations used for retries
+		RetrieveDate string   `json:"retrieveDate"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.Location == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Location is required", "location"))
+		return
+	}
+
+	for _, mirror := range req.Mirrors {
+		if mirror == "" {
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Mirrors must not contain empty locations", "mirrors"))
+			return
+		}
+	}
+
+	if req.RetrieveDate == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("RetrieveDate is required", "retrieveDate"))
+		return
+	}
+
+	retrieveDate, err := time.Parse(time.RFC3339, req.RetrieveDate)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid retrieveDate format, use RFC3339", "retrieveDate"))
+		return
+	}
+
+	firmwareUpdate, err := h.cpms.UpdateFirmware(r.Context(), id, req.Location, req.Mirrors, retrieveDate)
+	if errors.Is(err, service.ErrChargePointFrozen) {
+		sendError(w, http.StatusConflict, apierror.New(apierror.CodeChargePointFrozen, "Charge point is frozen"))
+		return
+	}
+	if errors.Is(err, service.ErrFirmwareUpdateNotDelivered) {
+		// The update is recorded, it is sent again when its retry is due
+		if firmwareUpdate.Status == "Failed" {
+			sendError(w, http.StatusBadGateway, apierror.New(apierror.CodeCommandFailed, "Update firmware command failed: "+firmwareUpdate.LastError).WithDetails(firmwareUpdate))
+			return
+		}
+		sendResponseStatus(w, http.StatusAccepted, Response{
+			Success: true,
+			Message: "Update firmware command not delivered, retry scheduled",
+			Data:    firmwareUpdate,
+		})
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to update firmware")
+		sendErrorResponse(w, "Failed to update firmware", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Update firmware command sent",
+		Data:    firmwareUpdate,
+	})
+}
+
+// GetFirmwareUpdates returns the firmware update history of a charge point
+func (h *Handler) GetFirmwareUpdates(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	updates, err := h.cpms.GetFirmwareUpdates(r.Context(), id)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get firmware updates")
+		sendErrorResponse(w, "Failed to get firmware updates", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    updates,
+	})
+}
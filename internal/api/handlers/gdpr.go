@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// ExportPersonalData returns everything stored about an idTag
+func (h *Handler) ExportPersonalData(w http.ResponseWriter, r *http.Request) {
+	idTag := chi.URLParam(r, "idTag")
+	if idTag == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("IdTag is required", "idTag"))
+		return
+	}
+
+	data, err := h.cpms.ExportPersonalData(r.Context(), idTag)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to export personal data")
+		sendErrorResponse(w, "Failed to export personal data", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    data,
+	})
+}
+
+// ErasePersonalData anonymizes the transactions of an idTag in a tenant and deletes its other personal data there
+func (h *Handler) ErasePersonalData(w http.ResponseWriter, r *http.Request) {
+	idTag := chi.URLParam(r, "idTag")
+	if idTag == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("IdTag is required", "idTag"))
+		return
+	}
+
+	var req struct {
+		TenantID string `json:"tenantId,omitempty"` // Empty for charge points without a tenant, ignored for tenant keys
+		Reason   string `json:"reason,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	erasure, err := h.cpms.ErasePersonalData(r.Context(), req.TenantID, idTag, req.Reason)
+	if errors.Is(err, service.ErrIdTagCharging) {
+		sendError(w, http.StatusConflict, apierror.New(apierror.CodeConflict, "IdTag has a transaction in progress"))
+		return
+	}
+	if err != nil {
+		// The idTag is personal data, so it is not logged
+		logrus.WithError(err).Error("Failed to erase personal data")
+		sendErrorResponse(w, "Failed to erase personal data", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    erasure,
+	})
+}
+
+// GetErasures returns the most recent entries of the erasure log
+func (h *Handler) GetErasures(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 {
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Limit must be a positive integer", "limit"))
+			return
+		}
+		limit = l
+	}
+
+	erasures, err := h.cpms.GetErasures(r.Context(), limit)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get erasures")
+		sendErrorResponse(w, "Failed to get erasures", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    erasures,
+	})
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// ReceiveGridEvent accepts a signed demand-response event capping the power of a site
+func (h *Handler) ReceiveGridEvent(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if !h.cpms.VerifyGridSignal(body, r.Header.Get("X-Signature")) {
+		sendErrorResponse(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		EventID   string  `json:"eventId"`
+		SiteID    string  `json:"siteId"`
+		LimitKW   float64 `json:"limitKW"`
+		StartTime string  `json:"startTime"`
+		EndTime   string  `json:"endTime"`
+		Source    string  `json:"source,omitempty"`
+	}
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.EventID == "" || req.SiteID == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("EventID and SiteID are required", "eventId", "siteId"))
+		return
+	}
+
+	if req.LimitKW < 0 {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("LimitKW must be non-negative", "limitKW"))
+		return
+	}
+
+	startTime, err := time.Parse(time.RFC3339, req.StartTime)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid startTime format, use RFC3339", "startTime"))
+		return
+	}
+
+	endTime, err := time.Parse(time.RFC3339, req.EndTime)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid endTime format, use RFC3339", "endTime"))
+		return
+	}
+
+	if !endTime.After(startTime) {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("EndTime must be after startTime", "endTime"))
+		return
+	}
+
+	if req.Source == "" {
+		req.Source = "webhook"
+	}
+
+	event := &models.GridEvent{
+		ID:        req.EventID,
+		SiteID:    req.SiteID,
+		LimitKW:   req.LimitKW,
+		StartTime: startTime,
+		EndTime:   endTime,
+		Source:    req.Source,
+	}
+
+	if err := h.cpms.ReceiveGridEvent(r.Context(), event); err != nil {
+		logrus.WithError(err).WithField("eventID", req.EventID).Error("Failed to receive grid event")
+		sendErrorResponse(w, "Failed to receive grid event", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Grid event received",
+	})
+}
+
+// GetGridEvents returns the grid event history
+func (h *Handler) GetGridEvents(w http.ResponseWriter, r *http.Request) {
+	events, err := h.cpms.GetGridEvents(r.Context())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get grid events")
+		sendErrorResponse(w, "Failed to get grid events", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    events,
+	})
+}
+
+// CancelGridEvent cancels a grid event and restores the site's power
+func (h *Handler) CancelGridEvent(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Grid event ID is required", "id"))
+		return
+	}
+
+	err := h.cpms.CancelGridEvent(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Grid event not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to cancel grid event")
+		sendErrorResponse(w, "Failed to cancel grid event", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Grid event cancelled",
+	})
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// GetGroups returns all groups
+func (h *Handler) GetGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.cpms.GetGroups(r.Context())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get groups")
+		sendErrorResponse(w, "Failed to get groups", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    groups,
+	})
+}
+
+// GetGroup returns a specific group with its members
+func (h *Handler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Group ID is required", "id"))
+		return
+	}
+
+	group, err := h.cpms.GetGroup(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Group not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get group")
+		sendErrorResponse(w, "Failed to get group", http.StatusInternalServerError)
+		return
+	}
+
+	members, err := h.cpms.GetGroupMembers(r.Context(), id)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get group members")
+		sendErrorResponse(w, "Failed to get group members", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data: struct {
+			*models.Group
+			Members []string `json:"members"`
+		}{group, members},
+	})
+}
+
+// SaveGroup creates or updates a group
+func (h *Handler) SaveGroup(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Group ID is required", "id"))
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.Name == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Name is required", "name"))
+		return
+	}
+
+	group := &models.Group{ID: id, Name: req.Name}
+	if err := h.cpms.SaveGroup(r.Context(), group); err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to save group")
+		sendErrorResponse(w, "Failed to save group", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    group,
+	})
+}
+
+// AddGroupMember adds a charge point to a group
+func (h *Handler) AddGroupMember(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Group ID is required", "id"))
+		return
+	}
+
+	var req struct {
+		ChargePointID string `json:"chargePointId"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.ChargePointID == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("ChargePointID is required", "chargePointId"))
+		return
+	}
+
+	if err := h.cpms.AddGroupMember(r.Context(), id, req.ChargePointID); err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to add group member")
+		sendErrorResponse(w, "Failed to add group member", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Charge point added to group",
+	})
+}
+
+// RemoveGroupMember removes a charge point from a group
+func (h *Handler) RemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	chargePointID := chi.URLParam(r, "chargePointId")
+	if id == "" || chargePointID == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Group ID and charge point ID are required", "id", "chargePointId"))
+		return
+	}
+
+	if err := h.cpms.RemoveGroupMember(r.Context(), id, chargePointID); err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to remove group member")
+		sendErrorResponse(w, "Failed to remove group member", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Charge point removed from group",
+	})
+}
+
+// FreezeGroup blocks firmware updates and configuration changes for a group
+func (h *Handler) FreezeGroup(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Group ID is required", "id"))
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.Reason == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Reason is required", "reason"))
+		return
+	}
+
+	if err := h.cpms.FreezeGroup(r.Context(), id, req.Reason); err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to freeze group")
+		sendErrorResponse(w, "Failed to freeze group", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Group frozen",
+	})
+}
+
+// UnfreezeGroup lifts the freeze of a group
+func (h *Handler) UnfreezeGroup(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Group ID is required", "id"))
+		return
+	}
+
+	if err := h.cpms.UnfreezeGroup(r.Context(), id); err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to unfreeze group")
+		sendErrorResponse(w, "Failed to unfreeze group", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Group unfrozen",
+	})
+}
+
+// CreateFreezeOverride allows a blocked action on a frozen group for a limited time
+func (h *Handler) CreateFreezeOverride(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Group ID is required", "id"))
+		return
+	}
+
+	var req struct {
+		ChargePointID string `json:"chargePointId,omitempty"` // Empty applies to all members
+		Action        string `json:"action"`                  // firmware or configuration
+		Reason        string `json:"reason"`
+		ValidMinutes  int    `json:"validMinutes"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.Action != service.FreezeActionFirmware && req.Action != service.FreezeActionConfiguration {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Action must be 'firmware' or 'configuration'", "action"))
+		return
+	}
+
+	if req.Reason == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Reason is required", "reason"))
+		return
+	}
+
+	if req.ValidMinutes <= 0 {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("ValidMinutes must be positive", "validMinutes"))
+		return
+	}
+
+	override := &models.FreezeOverride{
+		GroupID:       id,
+		ChargePointID: req.ChargePointID,
+		Action:        req.Action,
+		Reason:        req.Reason,
+	}
+
+	if err := h.cpms.CreateFreezeOverride(r.Context(), override, time.Duration(req.ValidMinutes)*time.Minute); err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to create freeze override")
+		sendErrorResponse(w, "Failed to create freeze override", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    override,
+	})
+}
+
+// GetAuditLog returns the most recent audit entries
+func (h *Handler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 {
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Limit must be a positive integer", "limit"))
+			return
+		}
+		limit = l
+	}
+
+	entries, err := h.cpms.GetAuditLog(r.Context(), r.URL.Query().Get("targetType"), r.URL.Query().Get("targetId"), limit)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get audit log")
+		sendErrorResponse(w, "Failed to get audit log", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    entries,
+	})
+}
@@ -2,12 +2,17 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/db"
 	"github.com/balu-dk/go-cpms/internal/service"
 	"github.com/go-chi/chi/v5"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
 	"github.com/sirupsen/logrus"
 )
 
@@ -28,38 +33,79 @@ type Response struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
-}
 
-// ErrorResponse represents an error response
-type ErrorResponse struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error"`
+	Pagination *Pagination `json:"pagination,omitempty"`
 }
 
-// GetChargePoints returns all charge points
+// GetChargePoints returns a page of the charge points matching the query parameters
 func (h *Handler) GetChargePoints(w http.ResponseWriter, r *http.Request) {
-	chargePoints, err := h.cpms.GetChargePoints(r.Context())
+	page, apiErr := parsePage(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := db.ChargePointFilter{
+		Vendor:             query.Get("vendor"),
+		Model:              query.Get("model"),
+		FirmwareVersion:    query.Get("firmwareVersion"),
+		RegistrationStatus: query.Get("registrationStatus"),
+		SiteID:             query.Get("siteId"),
+	}
+	if v := query.Get("isConnected"); v != "" {
+		connected, err := strconv.ParseBool(v)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid isConnected value", "isConnected"))
+			return
+		}
+		filter.IsConnected = &connected
+	}
+	if v := query.Get("clockDriftFlagged"); v != "" {
+		flagged, err := strconv.ParseBool(v)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid clockDriftFlagged value", "clockDriftFlagged"))
+			return
+		}
+		filter.ClockDriftFlagged = flagged
+	}
+	if v := query.Get("rebootLooping"); v != "" {
+		looping, err := strconv.ParseBool(v)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid rebootLooping value", "rebootLooping"))
+			return
+		}
+		filter.RebootLooping = looping
+	}
+
+	sort := db.ParseSort(query.Get("sort"))
+	chargePoints, total, err := h.cpms.GetChargePoints(r.Context(), filter, sort, page)
+	if errors.Is(err, db.ErrInvalidSort) {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge points cannot be sorted by "+sort.Field, "sort"))
+		return
+	}
 	if err != nil {
 		logrus.WithError(err).Error("Failed to get charge points")
 		sendErrorResponse(w, "Failed to get charge points", http.StatusInternalServerError)
 		return
 	}
 
-	sendResponse(w, Response{
-		Success: true,
-		Data:    chargePoints,
-	})
+	sendPage(w, r, chargePoints, page, total)
 }
 
 // GetChargePoint returns a specific charge point
 func (h *Handler) GetChargePoint(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		sendErrorResponse(w, "Charge point ID is required", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
 		return
 	}
 
 	chargePoint, err := h.cpms.GetChargePoint(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Charge point not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Failed to get charge point")
 		sendErrorResponse(w, "Failed to get charge point", http.StatusInternalServerError)
@@ -77,24 +123,164 @@ func (h *Handler) GetChargePoint(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// GetConnectors returns all connectors for a charge point
+// GetConnectors returns a page of the connectors of a charge point
 func (h *Handler) GetConnectors(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		sendErrorResponse(w, "Charge point ID is required", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	page, apiErr := parsePage(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
 		return
 	}
 
-	connectors, err := h.cpms.GetConnectors(r.Context(), id)
+	connectors, total, err := h.cpms.GetConnectors(r.Context(), id, page)
 	if err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Failed to get connectors")
 		sendErrorResponse(w, "Failed to get connectors", http.StatusInternalServerError)
 		return
 	}
 
+	sendPage(w, r, connectors, page, total)
+}
+
+// GetOCPPMessages returns a page of the OCPP messages logged for a charge point, newest first
+func (h *Handler) GetOCPPMessages(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	page, apiErr := parsePage(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	messages, total, err := h.cpms.GetOCPPMessages(r.Context(), id, page)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get OCPP messages")
+		sendErrorResponse(w, "Failed to get OCPP messages", http.StatusInternalServerError)
+		return
+	}
+
+	sendPage(w, r, messages, page, total)
+}
+
+// GetConnectorStatusEvents returns the status notification history of a charge point's connectors
+func (h *Handler) GetConnectorStatusEvents(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	query := r.URL.Query()
+
+	connectorID := 0
+	if v := query.Get("connectorId"); v != "" {
+		c, err := strconv.Atoi(v)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid connector ID", "connectorId"))
+			return
+		}
+		connectorID = c
+	}
+
+	errorsOnly := false
+	if v := query.Get("errorsOnly"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid errorsOnly value", "errorsOnly"))
+			return
+		}
+		errorsOnly = b
+	}
+
+	limit := 100
+	if v := query.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 {
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Limit must be a positive integer", "limit"))
+			return
+		}
+		limit = l
+	}
+
+	statusEvents, err := h.cpms.GetConnectorStatusEvents(r.Context(), id, connectorID, errorsOnly, limit)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get connector status events")
+		sendErrorResponse(w, "Failed to get connector status events", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    statusEvents,
+	})
+}
+
+// GetConnectionEvents returns the connection history of a charge point with the client address,
+// subprotocol and headers of each connection
+func (h *Handler) GetConnectionEvents(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 {
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Limit must be a positive integer", "limit"))
+			return
+		}
+		limit = l
+	}
+
+	connections, err := h.cpms.GetConnectionEvents(r.Context(), id, limit)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get connection events")
+		sendErrorResponse(w, "Failed to get connection events", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    connections,
+	})
+}
+
+// GetHourlyEnergy returns the energy a charge point's connectors delivered per hour, by default over the last week
+func (h *Handler) GetHourlyEnergy(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Hour)
+	from, to, msg := parseExportRange(r, now.AddDate(0, 0, -7), now.Add(time.Hour))
+	if msg != "" {
+		sendErrorResponse(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	energy, err := h.cpms.GetHourlyEnergy(r.Context(), id, from, to)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get hourly energy")
+		sendErrorResponse(w, "Failed to get hourly energy", http.StatusInternalServerError)
+		return
+	}
+
 	sendResponse(w, Response{
 		Success: true,
-		Data:    connectors,
+		Data:    energy,
 	})
 }
 
@@ -102,7 +288,13 @@ func (h *Handler) GetConnectors(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) Reset(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		sendErrorResponse(w, "Charge point ID is required", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	wait, apiErr := parseCommandWait(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
 		return
 	}
 
@@ -111,32 +303,36 @@ func (h *Handler) Reset(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
 		return
 	}
 
 	if req.Type != "Hard" && req.Type != "Soft" {
-		sendErrorResponse(w, "Type must be 'Hard' or 'Soft'", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Type must be 'Hard' or 'Soft'", "type"))
 		return
 	}
 
-	if err := h.cpms.ResetChargePoint(r.Context(), id, req.Type); err != nil {
+	cmd, err := h.cpms.ResetChargePoint(r.Context(), id, req.Type)
+	if err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Failed to reset charge point")
-		sendErrorResponse(w, "Failed to reset charge point", http.StatusInternalServerError)
+		sendCommandError(w, err, "Failed to reset charge point")
 		return
 	}
 
-	sendResponse(w, Response{
-		Success: true,
-		Message: "Reset command sent",
-	})
+	h.sendCommandResult(w, r, cmd, "Reset", wait)
 }
 
 // ChangeAvailability changes the availability of a connector
 func (h *Handler) ChangeAvailability(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		sendErrorResponse(w, "Charge point ID is required", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	wait, apiErr := parseCommandWait(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
 		return
 	}
 
@@ -146,40 +342,44 @@ func (h *Handler) ChangeAvailability(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
 		return
 	}
 
 	if req.ConnectorID < 0 {
-		sendErrorResponse(w, "ConnectorID must be non-negative", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("ConnectorID must be non-negative", "connectorId"))
 		return
 	}
 
 	if req.Type != "Operative" && req.Type != "Inoperative" {
-		sendErrorResponse(w, "Type must be 'Operative' or 'Inoperative'", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Type must be 'Operative' or 'Inoperative'", "type"))
 		return
 	}
 
-	if err := h.cpms.ChangeAvailability(r.Context(), id, req.ConnectorID, req.Type); err != nil {
+	cmd, err := h.cpms.ChangeAvailability(r.Context(), id, req.ConnectorID, req.Type)
+	if err != nil {
 		logrus.WithError(err).WithFields(logrus.Fields{
 			"id":          id,
 			"connectorID": req.ConnectorID,
 		}).Error("Failed to change availability")
-		sendErrorResponse(w, "Failed to change availability", http.StatusInternalServerError)
+		sendCommandError(w, err, "Failed to change availability")
 		return
 	}
 
-	sendResponse(w, Response{
-		Success: true,
-		Message: "Change availability command sent",
-	})
+	h.sendCommandResult(w, r, cmd, "Change availability", wait)
 }
 
 // UnlockConnector unlocks a connector
 func (h *Handler) UnlockConnector(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		sendErrorResponse(w, "Charge point ID is required", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	wait, apiErr := parseCommandWait(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
 		return
 	}
 
@@ -188,128 +388,251 @@ func (h *Handler) UnlockConnector(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
 		return
 	}
 
 	if req.ConnectorID <= 0 {
-		sendErrorResponse(w, "ConnectorID must be positive", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("ConnectorID must be positive", "connectorId"))
 		return
 	}
 
-	if err := h.cpms.UnlockConnector(r.Context(), id, req.ConnectorID); err != nil {
+	cmd, err := h.cpms.UnlockConnector(r.Context(), id, req.ConnectorID)
+	if err != nil {
 		logrus.WithError(err).WithFields(logrus.Fields{
 			"id":          id,
 			"connectorID": req.ConnectorID,
 		}).Error("Failed to unlock connector")
-		sendErrorResponse(w, "Failed to unlock connector", http.StatusInternalServerError)
+		sendCommandError(w, err, "Failed to unlock connector")
 		return
 	}
 
-	sendResponse(w, Response{
-		Success: true,
-		Message: "Unlock connector command sent",
-	})
+	h.sendCommandResult(w, r, cmd, "Unlock connector", wait)
 }
 
 // RemoteStartTransaction starts a transaction remotely
 func (h *Handler) RemoteStartTransaction(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		sendErrorResponse(w, "Charge point ID is required", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	wait, apiErr := parseCommandWait(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
 		return
 	}
 
 	var req struct {
-		ConnectorID int    `json:"connectorId"`
-		IdTag       string `json:"idTag"`
+		ConnectorID      int                     `json:"connectorId"`
+		IdTag            string                  `json:"idTag"`
+		ChargingSchedule *types.ChargingSchedule `json:"chargingSchedule"` // Limits the transaction from its start
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
 		return
 	}
 
 	if req.ConnectorID <= 0 {
-		sendErrorResponse(w, "ConnectorID must be positive", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("ConnectorID must be positive", "connectorId"))
 		return
 	}
 
 	if req.IdTag == "" {
-		sendErrorResponse(w, "IdTag is required", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("IdTag is required", "idTag"))
 		return
 	}
 
-	if err := h.cpms.RemoteStartTransaction(r.Context(), id, req.ConnectorID, req.IdTag); err != nil {
+	if req.ChargingSchedule != nil {
+		if apiErr := validateChargingSchedule(req.ChargingSchedule); apiErr != nil {
+			sendError(w, http.StatusBadRequest, apiErr)
+			return
+		}
+	}
+
+	cmd, err := h.cpms.RemoteStartTransaction(r.Context(), id, req.ConnectorID, req.IdTag, req.ChargingSchedule)
+	if err != nil {
 		logrus.WithError(err).WithFields(logrus.Fields{
 			"id":          id,
 			"connectorID": req.ConnectorID,
 			"idTag":       req.IdTag,
 		}).Error("Failed to start transaction")
-		sendErrorResponse(w, "Failed to start transaction", http.StatusInternalServerError)
+		sendCommandError(w, err, "Failed to start transaction")
 		return
 	}
 
-	sendResponse(w, Response{
-		Success: true,
-		Message: "Remote start transaction command sent",
-	})
+	h.sendCommandResult(w, r, cmd, "Remote start transaction", wait)
 }
 
 // RemoteStopTransaction stops a transaction remotely
 func (h *Handler) RemoteStopTransaction(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		sendErrorResponse(w, "Charge point ID is required", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	wait, apiErr := parseCommandWait(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
 		return
 	}
 
 	var req struct {
-		TransactionID int `json:"transactionId"`
+		TransactionID int    `json:"transactionId"`
+		IdTag         string `json:"idTag,omitempty"` // Stop on behalf of this idTag, which must be in the transaction's group
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
 		return
 	}
 
 	if req.TransactionID <= 0 {
-		sendErrorResponse(w, "TransactionID must be positive", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("TransactionID must be positive", "transactionId"))
 		return
 	}
 
-	if err := h.cpms.RemoteStopTransaction(r.Context(), id, req.TransactionID); err != nil {
+	cmd, err := h.cpms.RemoteStopTransaction(r.Context(), id, req.TransactionID, req.IdTag)
+	if errors.Is(err, db.ErrNotFound) {
+		sendError(w, http.StatusNotFound, apierror.New(apierror.CodeNotFound, "Transaction not found"))
+		return
+	}
+	if errors.Is(err, service.ErrIdTagNotInGroup) {
+		sendError(w, http.StatusForbidden, apierror.New(apierror.CodeForbidden, "IdTag may not stop this transaction"))
+		return
+	}
+	if err != nil {
 		logrus.WithError(err).WithFields(logrus.Fields{
 			"id":            id,
 			"transactionID": req.TransactionID,
 		}).Error("Failed to stop transaction")
-		sendErrorResponse(w, "Failed to stop transaction", http.StatusInternalServerError)
+		sendCommandError(w, err, "Failed to stop transaction")
 		return
 	}
 
-	sendResponse(w, Response{
-		Success: true,
-		Message: "Remote stop transaction command sent",
-	})
+	h.sendCommandResult(w, r, cmd, "Remote stop transaction", wait)
 }
 
 // TriggerHeartbeat triggers a heartbeat from a charge point
 func (h *Handler) TriggerHeartbeat(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		sendErrorResponse(w, "Charge point ID is required", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	wait, apiErr := parseCommandWait(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
 		return
 	}
 
-	if err := h.cpms.TriggerHeartbeat(r.Context(), id); err != nil {
+	cmd, err := h.cpms.TriggerHeartbeat(r.Context(), id)
+	if err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Failed to trigger heartbeat")
-		sendErrorResponse(w, "Failed to trigger heartbeat", http.StatusInternalServerError)
+		sendCommandError(w, err, "Failed to trigger heartbeat")
+		return
+	}
+
+	h.sendCommandResult(w, r, cmd, "Trigger heartbeat", wait)
+}
+
+// TriggerMessage asks a charge point to send a BootNotification, DiagnosticsStatusNotification,
+// FirmwareStatusNotification, Heartbeat, MeterValues or StatusNotification, optionally for one connector
+func (h *Handler) TriggerMessage(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	wait, apiErr := parseCommandWait(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	var req struct {
+		RequestedMessage string `json:"requestedMessage"`
+		ConnectorID      int    `json:"connectorId,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if !service.IsTriggerMessage(req.RequestedMessage) {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("RequestedMessage must be one of "+strings.Join(service.TriggerMessages, ", "), "requestedMessage"))
+		return
+	}
+
+	if req.ConnectorID < 0 {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("ConnectorID must not be negative", "connectorId"))
+		return
+	}
+
+	cmd, err := h.cpms.TriggerMessage(r.Context(), id, req.RequestedMessage, req.ConnectorID)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"id":               id,
+			"requestedMessage": req.RequestedMessage,
+		}).Error("Failed to trigger message")
+		sendCommandError(w, err, "Failed to trigger message")
+		return
+	}
+
+	h.sendCommandResult(w, r, cmd, "Trigger message", wait)
+}
+
+// SendRawOCPP sends any OCPP action with a raw JSON payload to a charge point and returns the command
+// with the charge point's raw confirmation. It is meant for debugging and restricted to admins.
+func (h *Handler) SendRawOCPP(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	var req struct {
+		Action  string          `json:"action"`
+		Payload json.RawMessage `json:"payload"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.Action == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Action is required", "action"))
+		return
+	}
+	if len(req.Payload) == 0 {
+		req.Payload = json.RawMessage("{}")
+	}
+
+	cmd, err := h.cpms.SendRawCommand(r.Context(), id, req.Action, req.Payload)
+	if errors.Is(err, service.ErrInvalidRawCommand) {
+		sendError(w, http.StatusBadRequest, apierror.Invalid(err.Error(), "action", "payload"))
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"id":     id,
+			"action": req.Action,
+		}).Error("Failed to send raw OCPP command")
+		sendCommandError(w, err, "Failed to send raw OCPP command")
 		return
 	}
 
 	sendResponse(w, Response{
 		Success: true,
-		Message: "Trigger heartbeat command sent",
+		Message: "Raw OCPP command sent",
+		Data:    cmd,
 	})
 }
 
@@ -317,17 +640,21 @@ func (h *Handler) TriggerHeartbeat(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetTransaction(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	if idStr == "" {
-		sendErrorResponse(w, "Transaction ID is required", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Transaction ID is required", "id"))
 		return
 	}
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		sendErrorResponse(w, "Invalid transaction ID", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid transaction ID", "id"))
 		return
 	}
 
 	transaction, err := h.cpms.GetTransaction(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Failed to get transaction")
 		sendErrorResponse(w, "Failed to get transaction", http.StatusInternalServerError)
@@ -349,7 +676,13 @@ func (h *Handler) GetTransaction(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetDiagnostics(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		sendErrorResponse(w, "Charge point ID is required", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	wait, apiErr := parseCommandWait(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
 		return
 	}
 
@@ -360,12 +693,12 @@ func (h *Handler) GetDiagnostics(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
 		return
 	}
 
 	if req.Location == "" {
-		sendErrorResponse(w, "Location is required", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Location is required", "location"))
 		return
 	}
 
@@ -375,7 +708,7 @@ func (h *Handler) GetDiagnostics(w http.ResponseWriter, r *http.Request) {
 	if req.StartTime != "" {
 		startTime, err = time.Parse(time.RFC3339, req.StartTime)
 		if err != nil {
-			sendErrorResponse(w, "Invalid startTime format, use RFC3339", http.StatusBadRequest)
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid startTime format, use RFC3339", "startTime"))
 			return
 		}
 	}
@@ -383,94 +716,56 @@ func (h *Handler) GetDiagnostics(w http.ResponseWriter, r *http.Request) {
 	if req.StopTime != "" {
 		stopTime, err = time.Parse(time.RFC3339, req.StopTime)
 		if err != nil {
-			sendErrorResponse(w, "Invalid stopTime format, use RFC3339", http.StatusBadRequest)
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid stopTime format, use RFC3339", "stopTime"))
 			return
 		}
 	}
 
-	if err := h.cpms.GetDiagnostics(r.Context(), id, req.Location, startTime, stopTime); err != nil {
+	cmd, err := h.cpms.GetDiagnostics(r.Context(), id, req.Location, startTime, stopTime)
+	if err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Failed to get diagnostics")
-		sendErrorResponse(w, "Failed to get diagnostics", http.StatusInternalServerError)
+		sendCommandError(w, err, "Failed to get diagnostics")
 		return
 	}
 
-	sendResponse(w, Response{
-		Success: true,
-		Message: "Get diagnostics command sent",
-	})
+	h.sendCommandResult(w, r, cmd, "Get diagnostics", wait)
 }
 
-// UpdateFirmware requests the charge point to update its firmware
-func (h *Handler) UpdateFirmware(w http.ResponseWriter, r *http.Request) {
+// ClearCache requests the charge point to clear its cache
+func (h *Handler) ClearCache(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		sendErrorResponse(w, "Charge point ID is required", http.StatusBadRequest)
-		return
-	}
-
-	var req struct {
-		Location     string `json:"location"`
-		RetrieveDate string `json:"retrieveDate"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
 		return
 	}
 
-	if req.Location == "" {
-		sendErrorResponse(w, "Location is required", http.StatusBadRequest)
+	wait, apiErr := parseCommandWait(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
 		return
 	}
 
-	if req.RetrieveDate == "" {
-		sendErrorResponse(w, "RetrieveDate is required", http.StatusBadRequest)
-		return
-	}
-
-	retrieveDate, err := time.Parse(time.RFC3339, req.RetrieveDate)
+	cmd, err := h.cpms.ClearCache(r.Context(), id)
 	if err != nil {
-		sendErrorResponse(w, "Invalid retrieveDate format, use RFC3339", http.StatusBadRequest)
-		return
-	}
-
-	if err := h.cpms.UpdateFirmware(r.Context(), id, req.Location, retrieveDate); err != nil {
-		logrus.WithError(err).WithField("id", id).Error("Failed to update firmware")
-		sendErrorResponse(w, "Failed to update firmware", http.StatusInternalServerError)
-		return
-	}
-
-	sendResponse(w, Response{
-		Success: true,
-		Message: "Update firmware command sent",
-	})
-}
-
-// ClearCache requests the charge point to clear its cache
-func (h *Handler) ClearCache(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	if id == "" {
-		sendErrorResponse(w, "Charge point ID is required", http.StatusBadRequest)
-		return
-	}
-
-	if err := h.cpms.ClearCache(r.Context(), id); err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Failed to clear cache")
-		sendErrorResponse(w, "Failed to clear cache", http.StatusInternalServerError)
+		sendCommandError(w, err, "Failed to clear cache")
 		return
 	}
 
-	sendResponse(w, Response{
-		Success: true,
-		Message: "Clear cache command sent",
-	})
+	h.sendCommandResult(w, r, cmd, "Clear cache", wait)
 }
 
 // GetConfiguration gets the charge point's configuration
 func (h *Handler) GetConfiguration(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		sendErrorResponse(w, "Charge point ID is required", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	wait, apiErr := parseCommandWait(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
 		return
 	}
 
@@ -479,27 +774,31 @@ func (h *Handler) GetConfiguration(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
 		return
 	}
 
-	if err := h.cpms.GetConfiguration(r.Context(), id, req.Keys); err != nil {
+	cmd, err := h.cpms.GetConfiguration(r.Context(), id, req.Keys)
+	if err != nil {
 		logrus.WithError(err).WithField("id", id).Error("Failed to get configuration")
-		sendErrorResponse(w, "Failed to get configuration", http.StatusInternalServerError)
+		sendCommandError(w, err, "Failed to get configuration")
 		return
 	}
 
-	sendResponse(w, Response{
-		Success: true,
-		Message: "Get configuration command sent",
-	})
+	h.sendCommandResult(w, r, cmd, "Get configuration", wait)
 }
 
 // ChangeConfiguration changes a configuration key on the charge point
 func (h *Handler) ChangeConfiguration(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		sendErrorResponse(w, "Charge point ID is required", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	wait, apiErr := parseCommandWait(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
 		return
 	}
 
@@ -509,46 +808,92 @@ func (h *Handler) ChangeConfiguration(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
 		return
 	}
 
 	if req.Key == "" {
-		sendErrorResponse(w, "Key is required", http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Key is required", "key"))
 		return
 	}
 
-	if err := h.cpms.ChangeConfiguration(r.Context(), id, req.Key, req.Value); err != nil {
+	cmd, err := h.cpms.ChangeConfiguration(r.Context(), id, req.Key, req.Value)
+	if err != nil {
 		logrus.WithError(err).WithFields(logrus.Fields{
 			"id":  id,
 			"key": req.Key,
 		}).Error("Failed to change configuration")
-		sendErrorResponse(w, "Failed to change configuration", http.StatusInternalServerError)
+		sendCommandError(w, err, "Failed to change configuration")
 		return
 	}
 
-	sendResponse(w, Response{
-		Success: true,
-		Message: "Change configuration command sent",
-	})
+	h.sendCommandResult(w, r, cmd, "Change configuration", wait)
 }
 
 // Helper functions to send responses
 func sendResponse(w http.ResponseWriter, response Response) {
+	sendResponseStatus(w, http.StatusOK, response)
+}
+
+// sendResponseStatus sends a response with a status other than 200 OK
+func sendResponseStatus(w http.ResponseWriter, statusCode int, response Response) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(statusCode)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		logrus.WithError(err).Error("Failed to encode response")
 	}
 }
 
+// sendErrorResponse sends an error with the generic code of its status
 func sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	if err := json.NewEncoder(w).Encode(ErrorResponse{
-		Success: false,
-		Error:   message,
-	}); err != nil {
-		logrus.WithError(err).Error("Failed to encode error response")
+	sendError(w, statusCode, apierror.New(apierror.CodeForStatus(statusCode), message))
+}
+
+// sendError sends a structured error
+func sendError(w http.ResponseWriter, statusCode int, e *apierror.Error) {
+	apierror.Write(w, statusCode, e)
+}
+
+// sendCommandError reports a command that could not be sent, telling clients why the charge point refused it when known
+func sendCommandError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrChargePointOffline):
+		sendError(w, http.StatusConflict, apierror.New(apierror.CodeChargePointOffline, "Charge point is offline"))
+	case errors.Is(err, service.ErrChargePointFrozen):
+		sendError(w, http.StatusConflict, apierror.New(apierror.CodeChargePointFrozen, "Charge point is frozen"))
+	default:
+		sendErrorResponse(w, message, http.StatusInternalServerError)
+	}
+}
+
+// validateChargingSchedule checks a charging schedule sent to a charge point, returning the error of its first
+// invalid field
+func validateChargingSchedule(schedule *types.ChargingSchedule) *apierror.Error {
+	if schedule.ChargingRateUnit != types.ChargingRateUnitAmperes && schedule.ChargingRateUnit != types.ChargingRateUnitWatts {
+		return apierror.Invalid("ChargingRateUnit must be A or W", "chargingSchedule.chargingRateUnit")
+	}
+	if len(schedule.ChargingSchedulePeriod) == 0 {
+		return apierror.Invalid("ChargingSchedulePeriod is required", "chargingSchedule.chargingSchedulePeriod")
+	}
+	if schedule.Duration != nil && *schedule.Duration <= 0 {
+		return apierror.Invalid("Duration must be positive", "chargingSchedule.duration")
+	}
+	if schedule.MinChargingRate != nil && *schedule.MinChargingRate < 0 {
+		return apierror.Invalid("MinChargingRate must not be negative", "chargingSchedule.minChargingRate")
+	}
+	for i, period := range schedule.ChargingSchedulePeriod {
+		if i == 0 && period.StartPeriod != 0 {
+			return apierror.Invalid("The first period must start at 0", "chargingSchedule.chargingSchedulePeriod")
+		}
+		if i > 0 && period.StartPeriod <= schedule.ChargingSchedulePeriod[i-1].StartPeriod {
+			return apierror.Invalid("Periods must be in ascending order of their start", "chargingSchedule.chargingSchedulePeriod")
+		}
+		if period.Limit < 0 {
+			return apierror.Invalid("Limit must not be negative", "chargingSchedule.chargingSchedulePeriod")
+		}
+		if period.NumberPhases != nil && (*period.NumberPhases < 1 || *period.NumberPhases > 3) {
+			return apierror.Invalid("NumberPhases must be between 1 and 3", "chargingSchedule.chargingSchedulePeriod")
+		}
 	}
+	return nil
 }
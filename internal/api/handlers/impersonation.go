@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// StartImpersonation opens a time-limited session to act within a tenant's scope.
+// The token is only returned in this response and is presented in the X-Impersonation-Token header.
+func (h *Handler) StartImpersonation(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TenantID     string `json:"tenantId"`
+		Reason       string `json:"reason"`
+		ValidMinutes int    `json:"validMinutes"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.TenantID == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("TenantID is required", "tenantId"))
+		return
+	}
+
+	if req.Reason == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Reason is required", "reason"))
+		return
+	}
+
+	if req.ValidMinutes <= 0 {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("ValidMinutes must be positive", "validMinutes"))
+		return
+	}
+
+	session, err := h.cpms.StartImpersonation(r.Context(), req.TenantID, req.Reason, time.Duration(req.ValidMinutes)*time.Minute)
+	if errors.Is(err, service.ErrImpersonationNotAllowed) {
+		sendErrorResponse(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, service.ErrActorRequired) {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("X-Operator header is required", "X-Operator"))
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("tenantId", req.TenantID).Error("Failed to start impersonation")
+		sendErrorResponse(w, "Failed to start impersonation", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    session,
+	})
+}
+
+// GetImpersonationSessions returns the most recent impersonation sessions
+func (h *Handler) GetImpersonationSessions(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 {
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Limit must be a positive integer", "limit"))
+			return
+		}
+		limit = l
+	}
+
+	sessions, err := h.cpms.GetImpersonationSessions(r.Context(), limit)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get impersonation sessions")
+		sendErrorResponse(w, "Failed to get impersonation sessions", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    sessions,
+	})
+}
+
+// EndImpersonation ends an impersonation session before it expires
+func (h *Handler) EndImpersonation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid impersonation session ID", "id"))
+		return
+	}
+
+	err = h.cpms.EndImpersonation(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Active impersonation session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to end impersonation")
+		sendErrorResponse(w, "Failed to end impersonation", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Impersonation session ended",
+	})
+}
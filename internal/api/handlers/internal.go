@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+// ExecuteForwardedCommand sends a command forwarded by another instance to a charge point connected here
+func (h *Handler) ExecuteForwardedCommand(w http.ResponseWriter, r *http.Request) {
+	var req service.ForwardedCommand
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.ChargePointID == "" || req.Action == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("ChargePointID and Action are required", "chargePointId", "action"))
+		return
+	}
+
+	result, err := h.cpms.ExecuteForwardedCommand(r.Context(), req)
+	if errors.Is(err, service.ErrNotConnectedHere) {
+		sendErrorResponse(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("chargePointID", req.ChargePointID).Error("Failed to execute forwarded command")
+		sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    result,
+	})
+}
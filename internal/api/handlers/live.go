@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/balu-dk/go-cpms/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// GetLiveReadings returns the most recent power, current and energy readings per connector of a charge point.
+// They are served from memory, for dashboards polling every few seconds.
+func (h *Handler) GetLiveReadings(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	connectors, err := h.cpms.GetLiveReadings(r.Context(), id)
+	if errors.Is(err, service.ErrNotConnectedHere) {
+		sendErrorResponse(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get live readings")
+		sendErrorResponse(w, "Failed to get live readings", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    connectors,
+	})
+}
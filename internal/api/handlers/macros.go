@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// GetMacros returns all command macros
+func (h *Handler) GetMacros(w http.ResponseWriter, r *http.Request) {
+	macros, err := h.cpms.GetMacros(r.Context())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get macros")
+		sendErrorResponse(w, "Failed to get macros", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    macros,
+	})
+}
+
+// GetMacro returns a specific command macro
+func (h *Handler) GetMacro(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Macro ID is required", "id"))
+		return
+	}
+
+	macro, err := h.cpms.GetMacro(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Macro not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get macro")
+		sendErrorResponse(w, "Failed to get macro", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    macro,
+	})
+}
+
+// SaveMacro creates or updates a command macro
+func (h *Handler) SaveMacro(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Macro ID is required", "id"))
+		return
+	}
+
+	var req struct {
+		Name  string             `json:"name"`
+		Steps []models.MacroStep `json:"steps"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.Name == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Name is required", "name"))
+		return
+	}
+
+	if len(req.Steps) == 0 {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Steps are required", "steps"))
+		return
+	}
+
+	for _, step := range req.Steps {
+		if err := service.ValidateMacroStep(step); err != nil {
+			sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	macro := &models.Macro{ID: id, Name: req.Name, Steps: req.Steps}
+	if err := h.cpms.SaveMacro(r.Context(), macro); err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to save macro")
+		sendErrorResponse(w, "Failed to save macro", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    macro,
+	})
+}
+
+// DeleteMacro removes a command macro
+func (h *Handler) DeleteMacro(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Macro ID is required", "id"))
+		return
+	}
+
+	err := h.cpms.DeleteMacro(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Macro not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to delete macro")
+		sendErrorResponse(w, "Failed to delete macro", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Macro deleted",
+	})
+}
+
+// RunMacro starts a macro against a charge point or fleet filter
+func (h *Handler) RunMacro(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Macro ID is required", "id"))
+		return
+	}
+
+	var target service.MacroTarget
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if len(target.ChargePointIDs) == 0 && target.GroupID == "" && target.SiteID == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("ChargePointIDs, GroupID or SiteID is required", "chargePointIds", "groupId", "siteId"))
+		return
+	}
+
+	run, err := h.cpms.RunMacro(r.Context(), id, target)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Macro not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.ErrNoMacroTargets) {
+		sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to run macro")
+		sendErrorResponse(w, "Failed to run macro", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Macro run started",
+		Data:    run,
+	})
+}
+
+// GetMacroRun returns a macro run with the per-step command results
+func (h *Handler) GetMacroRun(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "runId"))
+	if err != nil {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid macro run ID", "runId"))
+		return
+	}
+
+	run, err := h.cpms.GetMacroRun(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Macro run not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get macro run")
+		sendErrorResponse(w, "Failed to get macro run", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    run,
+	})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/db"
+)
+
+// Page sizes of list endpoints when the client asks for none, and the largest page a client may ask for
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// Pagination describes the page of a list returned in a response
+type Pagination struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+	Total  int `json:"total"`
+}
+
+// parsePage reads the limit and offset query parameters of a list request
+func parsePage(r *http.Request) (db.Page, *apierror.Error) {
+	page := db.Page{Limit: defaultPageLimit}
+	query := r.URL.Query()
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxPageLimit {
+			return page, apierror.Invalid(fmt.Sprintf("Limit must be an integer between 1 and %d", maxPageLimit), "limit")
+		}
+		page.Limit = limit
+	}
+
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return page, apierror.Invalid("Offset must be a non-negative integer", "offset")
+		}
+		page.Offset = offset
+	}
+
+	return page, nil
+}
+
+// sendPage sends a page of a list with its total count.
+// The X-Total-Count and Link headers let clients page through the list without reading the body.
+func sendPage(w http.ResponseWriter, r *http.Request, data interface{}, page db.Page, total int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Header().Set("Link", pageLinks(r, page, total))
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    data,
+		Pagination: &Pagination{
+			Limit:  page.Limit,
+			Offset: page.Offset,
+			Total:  total,
+		},
+	})
+}
+
+// pageLinks returns the RFC 8288 links to the first, previous, next and last pages of a list
+func pageLinks(r *http.Request, page db.Page, total int) string {
+	link := func(offset int, rel string) string {
+		query := r.URL.Query()
+		query.Set("limit", strconv.Itoa(page.Limit))
+		query.Set("offset", strconv.Itoa(offset))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, query.Encode(), rel)
+	}
+
+	last := 0
+	if total > 0 {
+		last = (total - 1) / page.Limit * page.Limit
+	}
+
+	links := []string{link(0, "first")}
+	if page.Offset > 0 {
+		prev := page.Offset - page.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, link(prev, "prev"))
+	}
+	if page.Offset+page.Limit < total {
+		links = append(links, link(page.Offset+page.Limit, "next"))
+	}
+	links = append(links, link(last, "last"))
+
+	return strings.Join(links, ", ")
+}
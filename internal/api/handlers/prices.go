@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/sirupsen/logrus"
+)
+
+// GetSpotPrices returns the stored spot prices, by default for today and tomorrow
+func (h *Handler) GetSpotPrices(w http.ResponseWriter, r *http.Request) {
+	from := time.Now().UTC().Truncate(24 * time.Hour)
+	to := from.Add(48 * time.Hour)
+	var err error
+
+	if v := r.URL.Query().Get("from"); v != "" {
+		from, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid from format, use RFC3339", "from"))
+			return
+		}
+	}
+
+	if v := r.URL.Query().Get("to"); v != "" {
+		to, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid to format, use RFC3339", "to"))
+			return
+		}
+	}
+
+	prices, err := h.cpms.GetSpotPrices(r.Context(), from, to)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get spot prices")
+		sendErrorResponse(w, "Failed to get spot prices", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    prices,
+	})
+}
+
+// GetCarbonIntensities returns the stored hourly carbon intensities, by default for the last day
+func (h *Handler) GetCarbonIntensities(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC().Truncate(time.Hour)
+	from, to, msg := parseExportRange(r, now.Add(-24*time.Hour), now.Add(time.Hour))
+	if msg != "" {
+		sendErrorResponse(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	intensities, err := h.cpms.GetCarbonIntensities(r.Context(), from, to)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get carbon intensities")
+		sendErrorResponse(w, "Failed to get carbon intensities", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    intensities,
+	})
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// GetQuarantinedMessages returns the inbound OCPP messages quarantined because they failed parsing or validation,
+// newest first, optionally of one charge point and only those not reviewed yet
+func (h *Handler) GetQuarantinedMessages(w http.ResponseWriter, r *http.Request) {
+	page, apiErr := parsePage(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := db.QuarantineFilter{ChargePointID: query.Get("chargePointId")}
+	if v := query.Get("unreviewed"); v != "" {
+		unreviewed, err := strconv.ParseBool(v)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid unreviewed value", "unreviewed"))
+			return
+		}
+		filter.Unreviewed = unreviewed
+	}
+
+	messages, total, err := h.cpms.GetQuarantinedMessages(r.Context(), filter, page)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get quarantined OCPP messages")
+		sendErrorResponse(w, "Failed to get quarantined OCPP messages", http.StatusInternalServerError)
+		return
+	}
+
+	sendPage(w, r, messages, page, total)
+}
+
+// ReviewQuarantinedMessage marks a quarantined OCPP message as reviewed
+func (h *Handler) ReviewQuarantinedMessage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid quarantined message ID", "id"))
+		return
+	}
+
+	err = h.cpms.ReviewQuarantinedMessage(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Quarantined message not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to review quarantined OCPP message")
+		sendErrorResponse(w, "Failed to review quarantined OCPP message", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Quarantined message reviewed",
+	})
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+// ReplayOCPPMessages passes logged inbound OCPP requests through the handlers again. Replays are dry runs,
+// discarding the handlers' writes, unless dryRun is false.
+func (h *Handler) ReplayOCPPMessages(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChargePointID string    `json:"chargePointId"`
+		From          time.Time `json:"from"`
+		To            time.Time `json:"to"`
+		Actions       []string  `json:"actions"`
+		DryRun        *bool     `json:"dryRun"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.From.IsZero() || req.To.IsZero() {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("From and to are required", "from", "to"))
+		return
+	}
+	if !req.To.After(req.From) {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("To must be after from", "to"))
+		return
+	}
+	dryRun := req.DryRun == nil || *req.DryRun
+
+	results, err := h.cpms.ReplayOCPPMessages(r.Context(), service.ReplayFilter{
+		ChargePointID: req.ChargePointID,
+		From:          req.From,
+		To:            req.To,
+		Actions:       req.Actions,
+	}, dryRun)
+	if errors.Is(err, service.ErrReplayTooLarge) {
+		sendError(w, http.StatusBadRequest, apierror.Invalid(err.Error(), "from", "to"))
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to replay OCPP messages")
+		sendErrorResponse(w, "Failed to replay OCPP messages", http.StatusInternalServerError)
+		return
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "OCPP messages replayed",
+		Data: map[string]interface{}{
+			"dryRun":   dryRun,
+			"replayed": len(results),
+			"failed":   failed,
+			"results":  results,
+		},
+	})
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// GetSites returns all sites
+func (h *Handler) GetSites(w http.ResponseWriter, r *http.Request) {
+	sites, err := h.cpms.GetSites(r.Context())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get sites")
+		sendErrorResponse(w, "Failed to get sites", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    sites,
+	})
+}
+
+// GetSite returns a specific site
+func (h *Handler) GetSite(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Site ID is required", "id"))
+		return
+	}
+
+	site, err := h.cpms.GetSite(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Site not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get site")
+		sendErrorResponse(w, "Failed to get site", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    site,
+	})
+}
+
+// SaveSite creates or updates a site
+func (h *Handler) SaveSite(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Site ID is required", "id"))
+		return
+	}
+
+	site := models.Site{
+		MinCurrent: 6,
+		MaxCurrent: 32,
+		Phases:     3,
+		Voltage:    230,
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&site); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+	site.ID = id
+
+	if site.Name == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Name is required", "name"))
+		return
+	}
+
+	if site.MinCurrent < 0 || site.MaxCurrent < site.MinCurrent {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("MinCurrent must be non-negative and not exceed MaxCurrent", "minCurrent", "maxCurrent"))
+		return
+	}
+
+	if site.Phases != 1 && site.Phases != 3 {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Phases must be 1 or 3", "phases"))
+		return
+	}
+
+	if site.Voltage <= 0 {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Voltage must be positive", "voltage"))
+		return
+	}
+
+	if site.MaxStayMinutes < 0 || site.OverstayWarningMinutes < 0 {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("MaxStayMinutes and OverstayWarningMinutes must be non-negative", "maxStayMinutes", "overstayWarningMinutes"))
+		return
+	}
+
+	if err := h.cpms.SaveSite(r.Context(), &site); err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to save site")
+		sendErrorResponse(w, "Failed to save site", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    site,
+	})
+}
+
+// ReportSiteExportPower accepts a reading of the power a site exports to the grid
+func (h *Handler) ReportSiteExportPower(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Site ID is required", "id"))
+		return
+	}
+
+	var req struct {
+		ExportPower *float64 `json:"exportPower"` // W, positive when exporting
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.ExportPower == nil {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("ExportPower is required", "exportPower"))
+		return
+	}
+
+	h.cpms.ReportSiteExportPower(id, *req.ExportPower)
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Export power reading recorded",
+	})
+}
+
+// SetChargePointSite assigns a charge point to a site
+func (h *Handler) SetChargePointSite(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	var req struct {
+		SiteID string `json:"siteId"` // Empty removes the assignment
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if err := h.cpms.SetChargePointSite(r.Context(), id, req.SiteID); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"id":     id,
+			"siteID": req.SiteID,
+		}).Error("Failed to set charge point site")
+		sendErrorResponse(w, "Failed to set charge point site", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Charge point site updated",
+	})
+}
+
+// SetChargePointFreeVend enables or disables free vend mode on a charge point
+func (h *Handler) SetChargePointFreeVend(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	err := h.cpms.SetChargePointFreeVend(r.Context(), id, req.Enabled)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Charge point not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to set charge point free vend mode")
+		sendErrorResponse(w, "Failed to set charge point free vend mode", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Charge point free vend mode updated",
+	})
+}
+
+// SetChargePointSpotOptOut excludes the transactions of a charge point from spot price optimized charging,
+// or includes them again
+func (h *Handler) SetChargePointSpotOptOut(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	var req struct {
+		OptOut bool `json:"optOut"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	err := h.cpms.SetChargePointSpotOptOut(r.Context(), id, req.OptOut)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Charge point not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to set charge point spot charging opt-out")
+		sendErrorResponse(w, "Failed to set charge point spot charging opt-out", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Charge point spot charging opt-out updated",
+	})
+}
+
+// GetParkingSessions returns the vehicles currently plugged in at a site with a max-stay rule
+func (h *Handler) GetParkingSessions(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Site ID is required", "id"))
+		return
+	}
+
+	sessions, err := h.cpms.GetParkingSessions(r.Context(), id)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get parking sessions")
+		sendErrorResponse(w, "Failed to get parking sessions", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    sessions,
+	})
+}
+
+// GetSiteDemand returns the hourly peak demand and coincidence factors of a site, by default over the last 30 days
+func (h *Handler) GetSiteDemand(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Site ID is required", "id"))
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Hour)
+	from, to, msg := parseExportRange(r, now.AddDate(0, 0, -30), now.Add(time.Hour))
+	if msg != "" {
+		sendErrorResponse(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.cpms.GetSiteDemand(r.Context(), id, from, to)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Site not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get site demand")
+		sendErrorResponse(w, "Failed to get site demand", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    report,
+	})
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// GetChargePointStats returns the lifetime totals of a charge point and its totals over a period, by default
+// the last 30 days: sessions, kWh, revenue, utilization and faults
+func (h *Handler) GetChargePointStats(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	now := time.Now().UTC().Truncate(time.Hour)
+	from, to, msg := parseExportRange(r, now.AddDate(0, 0, -30), now.Add(time.Hour))
+	if msg != "" {
+		sendErrorResponse(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.cpms.GetChargePointStats(r.Context(), id, from, to)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Charge point not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get charge point statistics")
+		sendErrorResponse(w, "Failed to get charge point statistics", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    stats,
+	})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	tapWriteTimeout = 10 * time.Second
+	tapPingInterval = 30 * time.Second
+	tapPongTimeout  = tapPingInterval + tapWriteTimeout
+)
+
+// tapUpgrader upgrades OCPP tap requests to websockets. The API key is sent in a header, which
+// browsers cannot add to cross-site websocket requests, so any origin is accepted.
+var tapUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// TapOCPP streams the raw OCPP frames exchanged with a charge point over a websocket, one JSON
+// message per frame, until the client disconnects. Credentials in the frames are redacted.
+func (h *Handler) TapOCPP(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	frames, stop, err := h.cpms.TapOCPP(r.Context(), id)
+	if errors.Is(err, service.ErrNotConnectedHere) {
+		sendErrorResponse(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to tap OCPP traffic")
+		sendErrorResponse(w, "Failed to tap OCPP traffic", http.StatusInternalServerError)
+		return
+	}
+	defer stop()
+
+	conn, err := tapUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied with an error
+		return
+	}
+	defer conn.Close()
+
+	// Read until the client disconnects, which also handles its pongs and close message
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadDeadline(time.Now().Add(tapPongTimeout))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(tapPongTimeout))
+		})
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(tapPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case frame := <-frames:
+			conn.SetWriteDeadline(time.Now().Add(tapWriteTimeout))
+			if err := conn.WriteJSON(frame); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(tapWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
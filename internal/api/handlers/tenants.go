@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// ChargePointScope rejects requests for charge points outside the caller's tenant
+func (h *Handler) ChargePointScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		if id == "" || service.IsAdmin(r.Context()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		_, err := h.cpms.GetChargePoint(r.Context(), id)
+		if errors.Is(err, db.ErrNotFound) {
+			sendErrorResponse(w, "Charge point not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("id", id).Error("Failed to get charge point")
+			sendErrorResponse(w, "Failed to get charge point", http.StatusInternalServerError)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GetTenants returns all tenants
+func (h *Handler) GetTenants(w http.ResponseWriter, r *http.Request) {
+	tenants, err := h.cpms.GetTenants(r.Context())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get tenants")
+		sendErrorResponse(w, "Failed to get tenants", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    tenants,
+	})
+}
+
+// SaveTenant creates or updates a tenant
+func (h *Handler) SaveTenant(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Tenant ID is required", "id"))
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.Name == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Name is required", "name"))
+		return
+	}
+
+	tenant := &models.Tenant{ID: id, Name: req.Name}
+	if err := h.cpms.SaveTenant(r.Context(), tenant); err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to save tenant")
+		sendErrorResponse(w, "Failed to save tenant", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    tenant,
+	})
+}
+
+// GetAPIKeys returns the API keys of a tenant
+func (h *Handler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Tenant ID is required", "id"))
+		return
+	}
+
+	keys, err := h.cpms.GetAPIKeys(r.Context(), id)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get API keys")
+		sendErrorResponse(w, "Failed to get API keys", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    keys,
+	})
+}
+
+// CreateAPIKey creates an API key for a tenant. The key is only returned in this response.
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Tenant ID is required", "id"))
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.Name == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Name is required", "name"))
+		return
+	}
+
+	key, err := h.cpms.CreateAPIKey(r.Context(), id, req.Name)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to create API key")
+		sendErrorResponse(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    key,
+	})
+}
+
+// RevokeAPIKey revokes an API key of a tenant
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Tenant ID is required", "id"))
+		return
+	}
+
+	keyID, err := strconv.Atoi(chi.URLParam(r, "keyId"))
+	if err != nil {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid API key ID", "keyId"))
+		return
+	}
+
+	err = h.cpms.RevokeAPIKey(r.Context(), id, keyID)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to revoke API key")
+		sendErrorResponse(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "API key revoked",
+	})
+}
+
+// SetChargePointTenant assigns a charge point to a tenant
+func (h *Handler) SetChargePointTenant(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	var req struct {
+		TenantID string `json:"tenantId"` // Empty unassigns the charge point
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	err := h.cpms.SetChargePointTenant(r.Context(), id, req.TenantID)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Charge point not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to set charge point tenant")
+		sendErrorResponse(w, "Failed to set charge point tenant", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Charge point tenant updated",
+	})
+}
+
+// GetIdTags returns the idTags of the caller's tenant, or of all tenants for the admin key
+func (h *Handler) GetIdTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.cpms.GetIdTags(r.Context())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get idTags")
+		sendErrorResponse(w, "Failed to get idTags", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    tags,
+	})
+}
+
+// SaveIdTag creates or updates an idTag
+func (h *Handler) SaveIdTag(w http.ResponseWriter, r *http.Request) {
+	idTag := chi.URLParam(r, "idTag")
+	if idTag == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("IdTag is required", "idTag"))
+		return
+	}
+
+	var req struct {
+		TenantID    string `json:"tenantId,omitempty"`    // Required for the admin key, ignored for tenant keys
+		ParentIdTag string `json:"parentIdTag,omitempty"` // Group of the idTag
+		Status      string `json:"status"`                // Accepted or Blocked
+		ExpiryDate  string `json:"expiryDate,omitempty"`  // RFC3339 format
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.Status != "Accepted" && req.Status != "Blocked" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Status must be 'Accepted' or 'Blocked'", "status"))
+		return
+	}
+
+	if service.IsAdmin(r.Context()) && req.TenantID == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("TenantID is required", "tenantId"))
+		return
+	}
+
+	tag := &models.IdTag{
+		TenantID:    req.TenantID,
+		IdTag:       idTag,
+		ParentIdTag: req.ParentIdTag,
+		Status:      req.Status,
+	}
+
+	if req.ExpiryDate != "" {
+		expiryDate, err := time.Parse(time.RFC3339, req.ExpiryDate)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid expiry date format (use RFC3339)", "expiryDate"))
+			return
+		}
+		tag.ExpiryDate = expiryDate
+	}
+
+	if err := h.cpms.SaveIdTag(r.Context(), tag); err != nil {
+		logrus.WithError(err).WithField("idTag", idTag).Error("Failed to save idTag")
+		sendErrorResponse(w, "Failed to save idTag", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    tag,
+	})
+}
+
+// DeleteIdTag removes an idTag
+func (h *Handler) DeleteIdTag(w http.ResponseWriter, r *http.Request) {
+	idTag := chi.URLParam(r, "idTag")
+	if idTag == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("IdTag is required", "idTag"))
+		return
+	}
+
+	tenantID := r.URL.Query().Get("tenantId")
+	if service.IsAdmin(r.Context()) && tenantID == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("TenantID is required", "tenantId"))
+		return
+	}
+
+	err := h.cpms.DeleteIdTag(r.Context(), tenantID, idTag)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "IdTag not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("idTag", idTag).Error("Failed to delete idTag")
+		sendErrorResponse(w, "Failed to delete idTag", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "IdTag deleted",
+	})
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// parseTransactionFilter reads the transaction filter from the query parameters
+func parseTransactionFilter(r *http.Request) (db.TransactionFilter, *apierror.Error) {
+	query := r.URL.Query()
+	filter := db.TransactionFilter{
+		ChargePointID: query.Get("chargePointId"),
+		IdTag:         query.Get("idTag"),
+		Status:        query.Get("status"),
+		VehicleVIN:    query.Get("vehicleVin"),
+	}
+	if v := query.Get("billingReview"); v != "" {
+		billingReview, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, apierror.Invalid("Invalid billingReview value", "billingReview")
+		}
+		filter.BillingReview = billingReview
+	}
+	if v := query.Get("connectorId"); v != "" {
+		connectorID, err := strconv.Atoi(v)
+		if err != nil || connectorID <= 0 {
+			return filter, apierror.Invalid("Invalid connector ID", "connectorId")
+		}
+		filter.ConnectorID = connectorID
+	}
+	if v := query.Get("from"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, apierror.Invalid("Invalid from format, use RFC3339", "from")
+		}
+		filter.From = from
+	}
+	if v := query.Get("to"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, apierror.Invalid("Invalid to format, use RFC3339", "to")
+		}
+		filter.To = to
+	}
+	return filter, nil
+}
+
+// GetTransactions returns a page of the transactions matching the query parameters, of the charge point in the path if any,
+// most recently started first unless sorted otherwise. Filtering by idTag, from and to lists everything a card charged in a period.
+func (h *Handler) GetTransactions(w http.ResponseWriter, r *http.Request) {
+	page, apiErr := parsePage(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
+		return
+	}
+	filter, apiErr := parseTransactionFilter(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
+		return
+	}
+	if id := chi.URLParam(r, "id"); id != "" {
+		filter.ChargePointID = id
+	}
+
+	sort := db.ParseSort(r.URL.Query().Get("sort"))
+	transactions, total, err := h.cpms.GetTransactions(r.Context(), filter, sort, page)
+	if errors.Is(err, db.ErrInvalidSort) {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Transactions cannot be sorted by "+sort.Field, "sort"))
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get transactions")
+		sendErrorResponse(w, "Failed to get transactions", http.StatusInternalServerError)
+		return
+	}
+
+	sendPage(w, r, transactions, page, total)
+}
+
+// GetActiveTransactions returns a page of the in-progress transactions, of the charge point in the path if any,
+// with their energy delivered so far and duration, most recently started first unless sorted otherwise
+func (h *Handler) GetActiveTransactions(w http.ResponseWriter, r *http.Request) {
+	page, apiErr := parsePage(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := db.TransactionFilter{
+		ChargePointID: chi.URLParam(r, "id"),
+		IdTag:         query.Get("idTag"),
+	}
+	if filter.ChargePointID == "" {
+		filter.ChargePointID = query.Get("chargePointId")
+	}
+
+	sort := db.ParseSort(query.Get("sort"))
+	transactions, total, err := h.cpms.GetActiveTransactions(r.Context(), filter, sort, page)
+	if errors.Is(err, db.ErrInvalidSort) {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Transactions cannot be sorted by "+sort.Field, "sort"))
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get active transactions")
+		sendErrorResponse(w, "Failed to get active transactions", http.StatusInternalServerError)
+		return
+	}
+
+	sendPage(w, r, transactions, page, total)
+}
+
+// GetSessionSummaries returns a page of the transactions matching the query parameters with the energy delivered,
+// duration, and average and peak power derived from their meter values, most recently started first unless sorted otherwise
+func (h *Handler) GetSessionSummaries(w http.ResponseWriter, r *http.Request) {
+	page, apiErr := parsePage(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
+		return
+	}
+	filter, apiErr := parseTransactionFilter(r)
+	if apiErr != nil {
+		sendError(w, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	sort := db.ParseSort(r.URL.Query().Get("sort"))
+	summaries, total, err := h.cpms.GetSessionSummaries(r.Context(), filter, sort, page)
+	if errors.Is(err, db.ErrInvalidSort) {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Sessions cannot be sorted by "+sort.Field, "sort"))
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get session summaries")
+		sendErrorResponse(w, "Failed to get session summaries", http.StatusInternalServerError)
+		return
+	}
+
+	sendPage(w, r, summaries, page, total)
+}
+
+// GetSessionSummary returns a transaction with the energy delivered, duration, and average and peak power
+// derived from its meter values
+func (h *Handler) GetSessionSummary(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid transaction ID", "id"))
+		return
+	}
+
+	summary, err := h.cpms.GetSessionSummary(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to get session summary")
+		sendErrorResponse(w, "Failed to get session summary", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    summary,
+	})
+}
+
+// GetTransactionCost returns the calculated cost of a transaction
+func (h *Handler) GetTransactionCost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid transaction ID", "id"))
+		return
+	}
+
+	cost, err := h.cpms.GetTransactionCost(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to calculate transaction cost")
+		sendErrorResponse(w, "Failed to calculate transaction cost", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    cost,
+	})
+}
+
+// SetTransactionDeparture sets the energy a transaction needs by its departure time and schedules its charging
+func (h *Handler) SetTransactionDeparture(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid transaction ID", "id"))
+		return
+	}
+
+	var req struct {
+		TargetEnergy     float64   `json:"targetEnergy"` // kWh, 0 removes the departure schedule
+		DepartureTime    time.Time `json:"departureTime"`
+		OptimizeForPrice bool      `json:"optimizeForPrice"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.TargetEnergy < 0 {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("TargetEnergy must be non-negative", "targetEnergy"))
+		return
+	}
+	if req.TargetEnergy > 0 && !req.DepartureTime.After(time.Now()) {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("DepartureTime must be in the future", "departureTime"))
+		return
+	}
+
+	err = h.cpms.SetTransactionDeparture(r.Context(), id, req.TargetEnergy, req.DepartureTime, req.OptimizeForPrice)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Transaction in progress not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to set transaction departure")
+		sendCommandError(w, err, "Failed to set transaction departure")
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Transaction departure schedule updated",
+	})
+}
+
+// SetTransactionSpotOptOut excludes a transaction from spot price optimized charging, or includes it again
+func (h *Handler) SetTransactionSpotOptOut(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid transaction ID", "id"))
+		return
+	}
+
+	var req struct {
+		OptOut bool `json:"optOut"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	err = h.cpms.SetTransactionSpotOptOut(r.Context(), id, req.OptOut)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Transaction in progress not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to set transaction spot charging opt-out")
+		sendErrorResponse(w, "Failed to set transaction spot charging opt-out", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Transaction spot charging opt-out updated",
+	})
+}
+
+// SetTransactionLimits sets the cost and energy caps of an in-progress transaction
+func (h *Handler) SetTransactionLimits(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Invalid transaction ID", "id"))
+		return
+	}
+
+	var req struct {
+		MaxCost   float64 `json:"maxCost"`   // 0 removes the cap
+		MaxEnergy float64 `json:"maxEnergy"` // kWh, 0 removes the cap
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	if req.MaxCost < 0 || req.MaxEnergy < 0 {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("MaxCost and MaxEnergy must be non-negative", "maxCost", "maxEnergy"))
+		return
+	}
+
+	err = h.cpms.SetTransactionLimits(r.Context(), id, req.MaxCost, req.MaxEnergy)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Transaction in progress not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to set transaction limits")
+		sendErrorResponse(w, "Failed to set transaction limits", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Transaction limits updated",
+	})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// GetUpstreamGateways returns the charge points whose OCPP traffic is forwarded to an upstream central system
+func (h *Handler) GetUpstreamGateways(w http.ResponseWriter, r *http.Request) {
+	gateways, err := h.cpms.GetUpstreamGateways(r.Context())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get upstream gateways")
+		sendErrorResponse(w, "Failed to get upstream gateways", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    gateways,
+	})
+}
+
+// SaveUpstreamGateway forwards a charge point's OCPP traffic, or only the given requests of it, to an upstream central system
+func (h *Handler) SaveUpstreamGateway(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	var req struct {
+		URL     string   `json:"url"`
+		Actions []string `json:"actions,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, apierror.New(apierror.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	gateway := &models.UpstreamGateway{
+		ChargePointID: id,
+		URL:           req.URL,
+		Actions:       req.Actions,
+	}
+
+	if err := service.ValidateUpstreamGateway(gateway); err != nil {
+		sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.cpms.SaveUpstreamGateway(r.Context(), gateway); err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to save upstream gateway")
+		sendErrorResponse(w, "Failed to save upstream gateway", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Data:    gateway,
+	})
+}
+
+// DeleteUpstreamGateway stops forwarding a charge point's OCPP traffic to an upstream central system
+func (h *Handler) DeleteUpstreamGateway(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		sendError(w, http.StatusBadRequest, apierror.Invalid("Charge point ID is required", "id"))
+		return
+	}
+
+	err := h.cpms.DeleteUpstreamGateway(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		sendErrorResponse(w, "Upstream gateway not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("Failed to delete upstream gateway")
+		sendErrorResponse(w, "Failed to delete upstream gateway", http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Response{
+		Success: true,
+		Message: "Upstream gateway deleted",
+	})
+}
@@ -1,6 +1,21 @@
 package middleware
 
-import "net/http"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/api/apierror"
+	"github.com/balu-dk/go-cpms/internal/service"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/sirupsen/logrus"
+)
 
 // ContentType sets the content type for all responses
 func ContentType(next http.Handler) http.Handler {
@@ -9,3 +24,196 @@ func ContentType(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// maxRequestIDLength is the longest request ID accepted from clients
+const maxRequestIDLength = 64
+
+// RequestID assigns every request an ID, returned in the X-Request-ID response header and recorded
+// with the commands and OCPP messages the request causes. A valid X-Request-ID sent by the client,
+// like one set by a load balancer, is used instead of generating a new one.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", requestID)
+		next.ServeHTTP(w, r.WithContext(service.WithRequestID(r.Context(), requestID)))
+	})
+}
+
+// validRequestID reports whether a client supplied request ID is safe to log and store
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Logger logs every request with its status, size and duration as structured fields
+func Logger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		logrus.WithFields(logrus.Fields{
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"status":     ww.Status(),
+			"bytes":      ww.BytesWritten(),
+			"durationMs": time.Since(start).Milliseconds(),
+			"remoteAddr": r.RemoteAddr,
+			"requestID":  service.RequestIDFromContext(r.Context()),
+		}).Info("API request")
+	})
+}
+
+// Actor records the operator named in the X-Operator header as the actor of the request
+func Actor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if operator := r.Header.Get("X-Operator"); operator != "" {
+			r = r.WithContext(service.WithActor(r.Context(), operator))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RealIP replaces the remote address of requests received through a trusted proxy with the
+// address of the client, so request logs, rate limits and audit entries name the actual client
+func RealIP(cpms *service.CPMS) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr := cpms.ClientAddr(r)
+			r.RemoteAddr = addr
+			next.ServeHTTP(w, r.WithContext(service.WithClientAddr(r.Context(), addr)))
+		})
+	}
+}
+
+// Auth resolves the API key presented as a bearer token or in the X-API-Key header
+// and scopes the request to the key's tenant. Admins can act within a tenant's scope
+// by presenting an impersonation token in the X-Impersonation-Token header.
+func Auth(cpms *service.CPMS) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			if cpms.AuthEnabled() {
+				var err error
+				ctx, err = cpms.Authenticate(ctx, apiKey(r))
+				if errors.Is(err, service.ErrUnauthorized) {
+					sendError(w, "Invalid or missing API key", http.StatusUnauthorized)
+					return
+				}
+				if err != nil {
+					logrus.WithError(err).Error("Failed to authenticate API key")
+					sendError(w, "Failed to authenticate API key", http.StatusInternalServerError)
+					return
+				}
+			}
+
+			if token := r.Header.Get("X-Impersonation-Token"); token != "" {
+				var err error
+				ctx, err = cpms.Impersonate(ctx, token)
+				if errors.Is(err, service.ErrImpersonationNotAllowed) {
+					sendError(w, err.Error(), http.StatusForbidden)
+					return
+				}
+				if errors.Is(err, service.ErrUnauthorized) {
+					sendError(w, "Invalid or expired impersonation token", http.StatusUnauthorized)
+					return
+				}
+				if err != nil {
+					logrus.WithError(err).Error("Failed to resolve impersonation token")
+					sendError(w, "Failed to resolve impersonation token", http.StatusInternalServerError)
+					return
+				}
+
+				cpms.AuditImpersonatedRequest(ctx, r.Method, r.URL.Path)
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// apiKey returns the API key presented as a bearer token or in the X-API-Key header
+func apiKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// RateLimit rejects requests of clients over their rate limit with 429 Too Many Requests.
+// Clients are identified by their API key, or by their address for requests without one.
+func RateLimit(cpms *service.CPMS) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := "key:" + apiKey(r)
+			if client == "key:" {
+				client = "addr:" + clientAddr(r)
+			}
+
+			command := r.Method != http.MethodGet && r.Method != http.MethodHead
+			if ok, retryAfter := cpms.AllowAPIRequest(client, command); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				sendError(w, "Rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientAddr returns the IP address of the client of a request
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RequireAdmin rejects requests scoped to a single tenant
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !service.IsAdmin(r.Context()) {
+			sendError(w, "Admin API key required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sendError writes an error response in the API's error format
+func sendError(w http.ResponseWriter, message string, statusCode int) {
+	apierror.Write(w, statusCode, apierror.New(apierror.CodeForStatus(statusCode), message))
+}
+
+// Internal authenticates requests forwarded by other instances of the cluster with the shared secret
+func Internal(cpms *service.CPMS) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !cpms.InternalAuthenticate(r.Header.Get("X-Internal-Secret")) {
+				sendError(w, "Invalid or missing internal secret", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
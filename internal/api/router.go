@@ -5,6 +5,7 @@ import (
 
 	"github.com/balu-dk/go-cpms/internal/api/handlers"
 	"github.com/balu-dk/go-cpms/internal/api/middleware"
+	"github.com/balu-dk/go-cpms/internal/api/ui"
 	"github.com/balu-dk/go-cpms/internal/service"
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
@@ -23,48 +24,235 @@ func NewAPI(cpms *service.CPMS) *API {
 	handler := handlers.NewHandler(cpms)
 
 	// Setup middleware
-	router.Use(chimiddleware.Logger)
+	router.Use(middleware.RealIP(cpms))
+	router.Use(middleware.RequestID)
+	router.Use(middleware.Logger)
 	router.Use(chimiddleware.Recoverer)
 	router.Use(middleware.ContentType)
+	router.Use(middleware.Actor)
 
 	// CORS configuration
 	router.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Operator", "X-API-Key", "X-Impersonation-Token", "X-Request-ID"},
+		ExposedHeaders:   []string{"Link", "X-Total-Count", "Retry-After", "X-Request-ID"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
 	// Setup routes
 	router.Route("/api/v1", func(r chi.Router) {
-		// Charge Point routes
-		r.Route("/chargepoints", func(r chi.Router) {
-			r.Get("/", handler.GetChargePoints)
-			r.Get("/{id}", handler.GetChargePoint)
-			r.Get("/{id}/connectors", handler.GetConnectors)
-
-			// OCPP commands
-			r.Post("/{id}/reset", handler.Reset)
-			r.Post("/{id}/availability", handler.ChangeAvailability)
-			r.Post("/{id}/unlock", handler.UnlockConnector)
-			r.Post("/{id}/starttransaction", handler.RemoteStartTransaction)
-			r.Post("/{id}/stoptransaction", handler.RemoteStopTransaction)
-			r.Post("/{id}/heartbeat", handler.TriggerHeartbeat)
-			r.Post("/{id}/diagnostics", handler.GetDiagnostics)
-			r.Post("/{id}/firmware", handler.UpdateFirmware)
-			r.Post("/{id}/clearcache", handler.ClearCache)
-			r.Post("/{id}/configuration", handler.GetConfiguration)
-			r.Put("/{id}/configuration", handler.ChangeConfiguration)
-		})
+		// Grid signals authenticate with their HMAC signature instead of an API key
+		r.Post("/gridevents", handler.ReceiveGridEvent)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Auth(cpms))
+			r.Use(middleware.RateLimit(cpms))
+
+			// Charge Point routes
+			r.Route("/chargepoints", func(r chi.Router) {
+				r.Get("/", handler.GetChargePoints)
+
+				r.Group(func(r chi.Router) {
+					r.Use(handler.ChargePointScope)
+
+					r.Get("/{id}", handler.GetChargePoint)
+					r.Get("/{id}/connectors", handler.GetConnectors)
+					r.Put("/{id}/connectors/{connectorId}", handler.SaveConnectorAttributes)
+					r.Get("/{id}/statusevents", handler.GetConnectorStatusEvents)
+					r.Get("/{id}/connections", handler.GetConnectionEvents)
+					r.Get("/{id}/live", handler.GetLiveReadings)
+					r.Get("/{id}/stats", handler.GetChargePointStats)
+					r.Get("/{id}/messages", handler.GetOCPPMessages)
+					r.Get("/{id}/transactions", handler.GetTransactions)
+					r.Get("/{id}/transactions/active", handler.GetActiveTransactions)
+					r.Put("/{id}/freevend", handler.SetChargePointFreeVend)
+					r.Put("/{id}/spotoptout", handler.SetChargePointSpotOptOut)
+
+					// OCPP commands
+					r.Post("/{id}/reset", handler.Reset)
+					r.Post("/{id}/availability", handler.ChangeAvailability)
+					r.Post("/{id}/unlock", handler.UnlockConnector)
+					r.Post("/{id}/starttransaction", handler.RemoteStartTransaction)
+					r.Post("/{id}/stoptransaction", handler.RemoteStopTransaction)
+					r.Post("/{id}/heartbeat", handler.TriggerHeartbeat)
+					r.Post("/{id}/trigger", handler.TriggerMessage)
+					r.Post("/{id}/diagnostics", handler.GetDiagnostics)
+					r.Post("/{id}/firmware", handler.UpdateFirmware)
+					r.Get("/{id}/firmware", handler.GetFirmwareUpdates)
+					r.Post("/{id}/clearcache", handler.ClearCache)
+					r.Post("/{id}/configuration", handler.GetConfiguration)
+					r.Put("/{id}/configuration", handler.ChangeConfiguration)
+					r.Get("/{id}/configuration/plan", handler.GetConfigurationPlan)
+					r.Post("/{id}/locallist", handler.SyncLocalList)
+					r.Get("/{id}/commands", handler.GetCommands)
+
+					// Exports and reports
+					r.Get("/{id}/export/metervalues", handler.ExportMeterValues)
+					r.Get("/{id}/energy", handler.GetHourlyEnergy)
+				})
+
+				r.With(middleware.RequireAdmin).Put("/{id}/site", handler.SetChargePointSite)
+				r.With(middleware.RequireAdmin).Put("/{id}/tenant", handler.SetChargePointTenant)
+				r.With(middleware.RequireAdmin).Post("/{id}/ocpp", handler.SendRawOCPP)
+				r.With(middleware.RequireAdmin).Get("/{id}/ocpp/tap", handler.TapOCPP)
+				r.With(middleware.RequireAdmin).Post("/{id}/credentials/rotate", handler.RotateCredentials)
+				r.With(middleware.RequireAdmin).Get("/{id}/credentials/rotations", handler.GetCredentialRotations)
+			})
+
+			// Transaction routes
+			r.Route("/transactions", func(r chi.Router) {
+				r.Get("/", handler.GetTransactions)
+				r.Get("/active", handler.GetActiveTransactions)
+				r.Get("/{id}", handler.GetTransaction)
+				r.Get("/{id}/cost", handler.GetTransactionCost)
+				r.Get("/{id}/summary", handler.GetSessionSummary)
+				r.Put("/{id}/limits", handler.SetTransactionLimits)
+				r.Put("/{id}/departure", handler.SetTransactionDeparture)
+				r.Put("/{id}/spotoptout", handler.SetTransactionSpotOptOut)
+			})
+
+			// Session routes
+			r.Get("/sessions", handler.GetSessionSummaries)
+			r.Get("/sessions/{id}", handler.GetSession)
+
+			// NDJSON export routes
+			r.Get("/export/transactions", handler.ExportTransactions)
+
+			// IdTag routes
+			r.Route("/idtags", func(r chi.Router) {
+				r.Get("/", handler.GetIdTags)
+				r.Put("/{idTag}", handler.SaveIdTag)
+				r.Delete("/{idTag}", handler.DeleteIdTag)
+			})
+
+			// Spot price routes
+			r.Get("/prices", handler.GetSpotPrices)
+
+			// Grid carbon intensity routes
+			r.Get("/carbon", handler.GetCarbonIntensities)
+
+			// OCPP 1.6 and 2.0.1 configuration translation
+			r.Post("/configuration/translate", handler.TranslateConfiguration)
+
+			// Routes spanning all tenants
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireAdmin)
+
+				// Tenant routes
+				r.Route("/tenants", func(r chi.Router) {
+					r.Get("/", handler.GetTenants)
+					r.Put("/{id}", handler.SaveTenant)
+					r.Get("/{id}/apikeys", handler.GetAPIKeys)
+					r.Post("/{id}/apikeys", handler.CreateAPIKey)
+					r.Delete("/{id}/apikeys/{keyId}", handler.RevokeAPIKey)
+				})
 
-		// Transaction routes
-		r.Route("/transactions", func(r chi.Router) {
-			r.Get("/{id}", handler.GetTransaction)
+				// Charge point connection address rules
+				r.Route("/addressrules", func(r chi.Router) {
+					r.Get("/", handler.GetAddressRules)
+					r.Put("/{id}", handler.SaveAddressRule)
+					r.Delete("/{id}", handler.DeleteAddressRule)
+				})
+
+				// Upstream central systems the OCPP traffic of charge points is forwarded to, by charge point ID
+				r.Route("/upstreams", func(r chi.Router) {
+					r.Get("/", handler.GetUpstreamGateways)
+					r.Put("/{id}", handler.SaveUpstreamGateway)
+					r.Delete("/{id}", handler.DeleteUpstreamGateway)
+				})
+
+				// Impersonation routes
+				r.Route("/impersonations", func(r chi.Router) {
+					r.Get("/", handler.GetImpersonationSessions)
+					r.Post("/", handler.StartImpersonation)
+					r.Delete("/{id}", handler.EndImpersonation)
+				})
+
+				// Command macro routes
+				r.Route("/macros", func(r chi.Router) {
+					r.Get("/", handler.GetMacros)
+					r.Get("/runs/{runId}", handler.GetMacroRun)
+					r.Get("/{id}", handler.GetMacro)
+					r.Put("/{id}", handler.SaveMacro)
+					r.Delete("/{id}", handler.DeleteMacro)
+					r.Post("/{id}/run", handler.RunMacro)
+				})
+
+				// Site routes
+				r.Route("/sites", func(r chi.Router) {
+					r.Get("/", handler.GetSites)
+					r.Get("/{id}", handler.GetSite)
+					r.Put("/{id}", handler.SaveSite)
+					r.Post("/{id}/meter", handler.ReportSiteExportPower)
+					r.Get("/{id}/parking", handler.GetParkingSessions)
+					r.Get("/{id}/demand", handler.GetSiteDemand)
+				})
+
+				// Group routes
+				r.Route("/groups", func(r chi.Router) {
+					r.Get("/", handler.GetGroups)
+					r.Get("/{id}", handler.GetGroup)
+					r.Put("/{id}", handler.SaveGroup)
+					r.Post("/{id}/members", handler.AddGroupMember)
+					r.Delete("/{id}/members/{chargePointId}", handler.RemoveGroupMember)
+					r.Post("/{id}/freeze", handler.FreezeGroup)
+					r.Post("/{id}/unfreeze", handler.UnfreezeGroup)
+					r.Post("/{id}/overrides", handler.CreateFreezeOverride)
+				})
+
+				// Alerting routes
+				r.Route("/alertrules", func(r chi.Router) {
+					r.Get("/", handler.GetAlertRules)
+					r.Get("/{id}", handler.GetAlertRule)
+					r.Put("/{id}", handler.SaveAlertRule)
+					r.Delete("/{id}", handler.DeleteAlertRule)
+				})
+				r.Get("/alerts", handler.GetAlerts)
+
+				// Audit log routes
+				r.Get("/audit", handler.GetAuditLog)
+
+				// Live event stream
+				r.Get("/events/stream", handler.StreamEvents)
+
+				// Personal data routes
+				r.Route("/gdpr", func(r chi.Router) {
+					r.Get("/idtags/{idTag}", handler.ExportPersonalData)
+					r.Post("/idtags/{idTag}/erase", handler.ErasePersonalData)
+					r.Get("/erasures", handler.GetErasures)
+				})
+
+				// OCPP message replay
+				r.Post("/ocpp/replay", handler.ReplayOCPPMessages)
+
+				// Quarantined OCPP messages, which failed parsing or validation
+				r.Route("/ocpp/quarantine", func(r chi.Router) {
+					r.Get("/", handler.GetQuarantinedMessages)
+					r.Post("/{id}/review", handler.ReviewQuarantinedMessage)
+				})
+
+				// Grid event routes
+				r.Get("/gridevents", handler.GetGridEvents)
+				r.Delete("/gridevents/{id}", handler.CancelGridEvent)
+			})
 		})
 	})
 
+	// Admin web UI, which calls the API above with the API key entered by the operator
+	if cpms.AdminUIEnabled() {
+		router.Get("/", http.RedirectHandler("/ui/", http.StatusFound).ServeHTTP)
+		router.Get("/ui", http.RedirectHandler("/ui/", http.StatusMovedPermanently).ServeHTTP)
+		router.Get("/ui/*", http.StripPrefix("/ui", ui.Handler()).ServeHTTP)
+	}
+
+	// Commands forwarded by the instance an API call landed on to the instance holding the websocket
+	router.Route("/internal/v1", func(r chi.Router) {
+		r.Use(middleware.Internal(cpms))
+		r.Post("/commands", handler.ExecuteForwardedCommand)
+	})
+
 	return &API{
 		router:  router,
 		handler: handler,
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/balu-dk/go-cpms/config"
+	"github.com/sirupsen/logrus"
+)
+
+// certReloadInterval is how often the certificate files are checked for changes
+const certReloadInterval = time.Minute
+
+// certReloader serves a certificate from files and reloads it when the files change,
+// so certificates renewed by e.g. certbot apply without restarting the server
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+// TLSConfig returns the TLS configuration of the API server, or nil if no certificate is configured
+func TLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if cfg.APITLSCertFile == "" {
+		return nil, nil
+	}
+
+	reloader := &certReloader{certFile: cfg.APITLSCertFile, keyFile: cfg.APITLSKeyFile}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+
+	minVersion := uint16(tls.VersionTLS12)
+	if cfg.APITLSMinVersion == "1.3" {
+		minVersion = tls.VersionTLS13
+	}
+
+	return &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: reloader.getCertificate,
+	}, nil
+}
+
+// load reads the certificate and key files
+func (c *certReloader) load() error {
+	info, err := os.Stat(c.certFile)
+	if err != nil {
+		return fmt.Errorf("failed to read TLS certificate: %w", err)
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	c.modTime = info.ModTime()
+	c.lastCheck = time.Now()
+	return nil
+}
+
+// getCertificate returns the current certificate, reloading it if the certificate file changed.
+// A failed reload keeps serving the previous certificate.
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	cert := c.cert
+	check := time.Since(c.lastCheck) >= certReloadInterval
+	if check {
+		c.lastCheck = time.Now()
+	}
+	modTime := c.modTime
+	c.mu.Unlock()
+
+	if !check {
+		return cert, nil
+	}
+
+	info, err := os.Stat(c.certFile)
+	if err != nil || !info.ModTime().After(modTime) {
+		return cert, nil
+	}
+
+	if err := c.load(); err != nil {
+		logrus.WithError(err).Error("Failed to reload TLS certificate, keeping the previous certificate")
+		return cert, nil
+	}
+	logrus.WithField("certFile", c.certFile).Info("Reloaded TLS certificate")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cert, nil
+}
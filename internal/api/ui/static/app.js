@@ -0,0 +1,273 @@
+// Admin UI of the CPMS. Every call goes through the REST API with the API key entered by the operator,
+// which is kept in the session storage of the tab only.
+'use strict';
+
+const API = '/api/v1';
+const MAX_EVENTS = 200;
+
+const state = {
+  apiKey: sessionStorage.getItem('cpms.apiKey') || '',
+  operator: sessionStorage.getItem('cpms.operator') || '',
+  chargePoints: [],
+  selected: null,
+  stream: null, // AbortController of the event stream
+};
+
+const $ = (id) => document.getElementById(id);
+
+function el(tag, text, className) {
+  const e = document.createElement(tag);
+  if (text !== undefined && text !== null) {
+    e.textContent = text;
+  }
+  if (className) {
+    e.className = className;
+  }
+  return e;
+}
+
+function formatTime(value) {
+  if (!value || value.startsWith('0001-')) {
+    return '-';
+  }
+  return new Date(value).toLocaleString();
+}
+
+function showError(message) {
+  const error = $('error');
+  error.textContent = message;
+  error.hidden = !message;
+}
+
+function headers(json) {
+  const h = {};
+  if (state.apiKey) {
+    h['Authorization'] = 'Bearer ' + state.apiKey;
+  }
+  if (state.operator) {
+    h['X-Operator'] = state.operator;
+  }
+  if (json) {
+    h['Content-Type'] = 'application/json';
+  }
+  return h;
+}
+
+// api calls an endpoint and returns the data of the response, throwing the message of error responses
+async function api(method, path, body) {
+  const resp = await fetch(API + path, {
+    method: method,
+    headers: headers(body !== undefined),
+    body: body !== undefined ? JSON.stringify(body) : undefined,
+  });
+  const payload = await resp.json().catch(() => ({}));
+  if (!resp.ok) {
+    const message = payload.error ? payload.error.message : resp.statusText;
+    throw new Error(message + ' (HTTP ' + resp.status + ')');
+  }
+  return payload.data;
+}
+
+async function loadChargePoints() {
+  try {
+    state.chargePoints = (await api('GET', '/chargepoints?limit=1000&sort=id')) || [];
+    showError('');
+  } catch (err) {
+    showError('Failed to load charge points: ' + err.message);
+    return;
+  }
+  renderChargePoints();
+}
+
+function renderChargePoints() {
+  const filter = $('filter').value.toLowerCase();
+  const body = $('chargepoints');
+  body.replaceChildren();
+
+  for (const cp of state.chargePoints) {
+    const text = [cp.id, cp.vendor, cp.model, cp.firmwareVersion].join(' ').toLowerCase();
+    if (filter && !text.includes(filter)) {
+      continue;
+    }
+
+    const row = el('tr', null, 'selectable');
+    if (state.selected === cp.id) {
+      row.classList.add('selected');
+    }
+    row.append(el('td', cp.id), el('td', cp.vendor), el('td', cp.model), el('td', cp.firmwareVersion));
+    const status = el('td');
+    status.append(el('span', cp.isConnected ? 'online' : 'offline', 'badge ' + (cp.isConnected ? 'online' : 'offline')));
+    row.append(status, el('td', formatTime(cp.lastHeartbeat)));
+    row.addEventListener('click', () => selectChargePoint(cp.id));
+    body.append(row);
+  }
+}
+
+async function selectChargePoint(id) {
+  state.selected = id;
+  renderChargePoints();
+  $('detail-panel').hidden = false;
+  $('detail-title').textContent = id;
+  $('command-result').textContent = '';
+  await loadConnectors();
+}
+
+async function loadConnectors() {
+  if (!state.selected) {
+    return;
+  }
+
+  let connectors;
+  try {
+    connectors = (await api('GET', '/chargepoints/' + encodeURIComponent(state.selected) + '/connectors')) || [];
+  } catch (err) {
+    showError('Failed to load connectors: ' + err.message);
+    return;
+  }
+
+  const body = $('connectors');
+  body.replaceChildren();
+  for (const c of connectors) {
+    const row = el('tr');
+    const status = el('td');
+    status.append(el('span', c.status, 'badge ' + c.status));
+    row.append(
+      el('td', c.id),
+      status,
+      el('td', c.errorCode === 'NoError' ? '' : c.errorCode),
+      el('td', formatTime(c.statusSince)),
+      el('td', c.plugType || ''),
+      el('td', c.maxPowerKw || ''),
+    );
+    body.append(row);
+  }
+}
+
+// sendCommand sends the command of a command form to the selected charge point
+async function sendCommand(form) {
+  const body = {};
+  for (const [name, value] of new FormData(form)) {
+    const input = form.elements[name];
+    body[name] = input.type === 'number' ? Number(value) : value;
+  }
+
+  const result = $('command-result');
+  result.textContent = 'Sending ' + form.dataset.command + '...';
+  try {
+    const cmd = await api('POST', '/chargepoints/' + encodeURIComponent(state.selected) + '/' + form.dataset.command, body);
+    result.textContent = JSON.stringify(cmd, null, 2);
+  } catch (err) {
+    result.textContent = 'Failed: ' + err.message;
+  }
+}
+
+function addEvent(event) {
+  const list = $('events');
+  const item = el('li');
+  item.append(
+    el('div', formatTime(event.timestamp) + '  ' + event.type + (event.chargePointId ? '  ' + event.chargePointId : '')),
+  );
+  if (event.data !== undefined) {
+    item.append(el('div', JSON.stringify(event.data), 'muted'));
+  }
+  list.prepend(item);
+  while (list.children.length > MAX_EVENTS) {
+    list.lastChild.remove();
+  }
+
+  // Keep the views of the affected charge point current
+  if (event.chargePointId && event.chargePointId === state.selected) {
+    loadConnectors();
+  }
+}
+
+// streamEvents reads the NDJSON event stream, reconnecting after errors until the operator disconnects
+async function streamEvents() {
+  if (state.stream) {
+    state.stream.abort();
+  }
+  const controller = new AbortController();
+  state.stream = controller;
+
+  while (!controller.signal.aborted) {
+    try {
+      const resp = await fetch(API + '/events/stream', { headers: headers(false), signal: controller.signal });
+      if (!resp.ok) {
+        throw new Error('HTTP ' + resp.status);
+      }
+      $('stream-status').textContent = 'connected';
+
+      const reader = resp.body.getReader();
+      const decoder = new TextDecoder();
+      let buffer = '';
+      for (;;) {
+        const { value, done } = await reader.read();
+        if (done) {
+          break;
+        }
+        buffer += decoder.decode(value, { stream: true });
+        let newline;
+        while ((newline = buffer.indexOf('\n')) >= 0) {
+          const line = buffer.slice(0, newline).trim();
+          buffer = buffer.slice(newline + 1);
+          if (line) {
+            addEvent(JSON.parse(line));
+          }
+        }
+      }
+    } catch (err) {
+      if (controller.signal.aborted) {
+        break;
+      }
+      $('stream-status').textContent = 'disconnected: ' + err.message;
+    }
+    await new Promise((resolve) => setTimeout(resolve, 5000));
+  }
+  $('stream-status').textContent = 'disconnected';
+}
+
+function connect() {
+  $('logout').hidden = !state.apiKey;
+  loadChargePoints();
+  streamEvents();
+}
+
+$('login').addEventListener('submit', (e) => {
+  e.preventDefault();
+  state.apiKey = $('api-key').value.trim();
+  state.operator = $('operator').value.trim();
+  sessionStorage.setItem('cpms.apiKey', state.apiKey);
+  sessionStorage.setItem('cpms.operator', state.operator);
+  $('api-key').value = '';
+  connect();
+});
+
+$('logout').addEventListener('click', () => {
+  sessionStorage.removeItem('cpms.apiKey');
+  state.apiKey = '';
+  if (state.stream) {
+    state.stream.abort();
+  }
+  state.chargePoints = [];
+  state.selected = null;
+  renderChargePoints();
+  $('detail-panel').hidden = true;
+  $('logout').hidden = true;
+});
+
+$('refresh').addEventListener('click', () => {
+  loadChargePoints();
+  loadConnectors();
+});
+$('filter').addEventListener('input', renderChargePoints);
+$('clear-events').addEventListener('click', () => $('events').replaceChildren());
+
+for (const form of document.querySelectorAll('.commands form')) {
+  form.addEventListener('submit', (e) => {
+    e.preventDefault();
+    sendCommand(form);
+  });
+}
+
+$('operator').value = state.operator;
+connect();
@@ -0,0 +1,30 @@
+// Package ui embeds the admin web UI, a single page that shows the charge points and their connectors,
+// streams live events and sends commands through the REST API with an API key entered by the operator
+package ui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the assets of the admin UI, with index.html at the root
+func Handler() http.Handler {
+	assets, err := fs.Sub(static, "static")
+	if err != nil {
+		// The embedded directory is fixed at build time
+		panic(err)
+	}
+	files := http.FileServer(http.FS(assets))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The API sets a JSON content type on every response, the file server detects the type of each asset
+		w.Header().Del("Content-Type")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		files.ServeHTTP(w, r)
+	})
+}
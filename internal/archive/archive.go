@@ -0,0 +1,74 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store is a destination archived files are written to
+type Store interface {
+	// Put writes a file of size bytes under key, replacing any existing file
+	Put(ctx context.Context, key string, body io.ReadSeeker, size int64) error
+}
+
+// S3Config holds the credentials and endpoint of an S3 compatible object store
+type S3Config struct {
+	Region          string
+	Endpoint        string // Custom endpoint, e.g. for MinIO, empty uses AWS
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// New returns the archive store for a destination URL: file:///path or s3://bucket/prefix
+func New(destination string, s3 S3Config) (Store, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "file":
+		return &fileStore{dir: u.Path}, nil
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("missing bucket in %q", destination)
+		}
+		return newS3Store(u.Host, strings.Trim(u.Path, "/"), s3), nil
+	default:
+		return nil, fmt.Errorf("unsupported archive scheme %q, use file or s3", u.Scheme)
+	}
+}
+
+// fileStore archives to a local directory
+type fileStore struct {
+	dir string
+}
+
+func (f *fileStore) Put(ctx context.Context, key string, body io.ReadSeeker, size int64) error {
+	path := filepath.Join(f.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated archive behind
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".archive-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,88 @@
+// Package authcallout asks an external backend, like a billing system or an eMSP, whether to accept an idTag.
+package authcallout
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Request is the body posted to the endpoint
+type Request struct {
+	Action        string `json:"action"` // Authorize or StartTransaction
+	ChargePointID string `json:"chargePointId"`
+	TenantID      string `json:"tenantId,omitempty"`
+	ConnectorID   int    `json:"connectorId,omitempty"`
+	IdTag         string `json:"idTag"`
+}
+
+// Result is the decision of the endpoint
+type Result struct {
+	Status      string    `json:"status"` // Accepted, Blocked, Expired or Invalid
+	ExpiryDate  time.Time `json:"expiryDate,omitempty"`
+	ParentIdTag string    `json:"parentIdTag,omitempty"`
+}
+
+// statuses are the statuses the endpoint may answer with
+var statuses = map[string]bool{
+	"Accepted": true,
+	"Blocked":  true,
+	"Expired":  true,
+	"Invalid":  true,
+}
+
+// Client posts authorization requests to the endpoint
+type Client struct {
+	url        string
+	authHeader string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the endpoint at url, sending authHeader as the Authorization header if it is set
+func NewClient(url, authHeader string, timeout time.Duration) *Client {
+	return &Client{
+		url:        url,
+		authHeader: authHeader,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// Authorize asks the endpoint whether to accept an idTag. An error means the endpoint made no decision.
+func (c *Client) Authorize(ctx context.Context, request Request) (*Result, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.authHeader != "" {
+		req.Header.Set("Authorization", c.authHeader)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call authorization endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to call authorization endpoint: unexpected status %s", resp.Status)
+	}
+
+	var result Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode authorization: %v", err)
+	}
+	if !statuses[result.Status] {
+		return nil, fmt.Errorf("invalid authorization status %q", result.Status)
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,163 @@
+package carbonfeed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// Client fetches the carbon intensity and renewable share of the grid from Energi Data Service (energidataservice.dk)
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewClient creates a new carbon intensity client, baseURL is the dataset API the dataset names are appended to
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    baseURL,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// co2EmisRecord is a single record of the CO2Emis dataset, the CO2 emission per kWh consumed in 5 minutes
+type co2EmisRecord struct {
+	Minutes5UTC string   `json:"Minutes5UTC"`
+	PriceArea   string   `json:"PriceArea"`
+	CO2Emission *float64 `json:"CO2Emission"` // g/kWh
+}
+
+// productionRecord is a single record of the ElectricityProdex5MinRealtime dataset, the production in 5 minutes in MW
+type productionRecord struct {
+	Minutes5UTC       string   `json:"Minutes5UTC"`
+	PriceArea         string   `json:"PriceArea"`
+	ProductionLt100MW *float64 `json:"ProductionLt100MW"`
+	ProductionGe100MW *float64 `json:"ProductionGe100MW"`
+	OffshoreWindPower *float64 `json:"OffshoreWindPower"`
+	OnshoreWindPower  *float64 `json:"OnshoreWindPower"`
+	SolarPower        *float64 `json:"SolarPower"`
+}
+
+// FetchIntensities retrieves the hourly carbon intensity and renewable share of a price area within a time range.
+// Both are averaged over the 5 minute records of the hour. The renewable share counts wind and solar production.
+func (c *Client) FetchIntensities(ctx context.Context, priceArea string, from, to time.Time) ([]*models.CarbonIntensity, error) {
+	var emissions []co2EmisRecord
+	if err := c.fetch(ctx, "CO2Emis", priceArea, from, to, &emissions); err != nil {
+		return nil, err
+	}
+	var production []productionRecord
+	if err := c.fetch(ctx, "ElectricityProdex5MinRealtime", priceArea, from, to, &production); err != nil {
+		return nil, err
+	}
+
+	type hour struct {
+		co2Sum              float64
+		co2Samples          int
+		renewable, produced float64
+	}
+	hours := make(map[time.Time]*hour)
+	var order []time.Time
+	bucket := func(minutes5UTC string) (*hour, error) {
+		t, err := time.Parse("2006-01-02T15:04:05", minutes5UTC)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Minutes5UTC %q: %v", minutes5UTC, err)
+		}
+		hourStart := t.UTC().Truncate(time.Hour)
+		h, ok := hours[hourStart]
+		if !ok {
+			h = &hour{}
+			hours[hourStart] = h
+			order = append(order, hourStart)
+		}
+		return h, nil
+	}
+
+	for _, record := range emissions {
+		if record.CO2Emission == nil {
+			continue
+		}
+		h, err := bucket(record.Minutes5UTC)
+		if err != nil {
+			return nil, err
+		}
+		h.co2Sum += *record.CO2Emission
+		h.co2Samples++
+	}
+	for _, record := range production {
+		h, err := bucket(record.Minutes5UTC)
+		if err != nil {
+			return nil, err
+		}
+		h.renewable += value(record.OffshoreWindPower) + value(record.OnshoreWindPower) + value(record.SolarPower)
+		h.produced += value(record.ProductionLt100MW) + value(record.ProductionGe100MW)
+	}
+
+	var intensities []*models.CarbonIntensity
+	for _, hourStart := range order {
+		h := hours[hourStart]
+		if h.co2Samples == 0 {
+			// The renewable share alone doesn't price the emissions of an hour
+			continue
+		}
+
+		intensity := &models.CarbonIntensity{
+			PriceArea: priceArea,
+			HourStart: hourStart,
+			CO2PerKWh: h.co2Sum / float64(h.co2Samples),
+		}
+		if h.produced > 0 {
+			intensity.RenewableShare = math.Min(h.renewable/h.produced, 1)
+		}
+		intensities = append(intensities, intensity)
+	}
+
+	return intensities, nil
+}
+
+// fetch retrieves the records of a dataset for a price area within a time range
+func (c *Client) fetch(ctx context.Context, dataset, priceArea string, from, to time.Time, records interface{}) error {
+	params := url.Values{}
+	params.Set("start", from.UTC().Format("2006-01-02T15:04"))
+	params.Set("end", to.UTC().Format("2006-01-02T15:04"))
+	params.Set("filter", fmt.Sprintf(`{"PriceArea":["%s"]}`, priceArea))
+	params.Set("timezone", "UTC")
+	params.Set("sort", "Minutes5UTC")
+	params.Set("limit", "0")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/"+dataset+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %v", dataset, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch %s: unexpected status %s", dataset, resp.Status)
+	}
+
+	body := struct {
+		Records interface{} `json:"records"`
+	}{Records: records}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", dataset, err)
+	}
+	return nil
+}
+
+// value returns a production figure, 0 when it wasn't published
+func value(v *float64) float64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
@@ -0,0 +1,93 @@
+// Package clientip resolves the address of the client of a request received through reverse proxies
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseNetworks parses a list of IP addresses and CIDR networks
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", v)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// FromRequest returns the IP address of the client of a request. The X-Forwarded-For and X-Real-IP
+// headers are only honoured when the request comes from a trusted proxy, so clients cannot spoof
+// their address. X-Forwarded-For is read from the right, skipping the trusted proxies the request
+// passed through.
+func FromRequest(r *http.Request, trustedProxies []*net.IPNet) string {
+	peer := hostOf(r.RemoteAddr)
+	if !trusted(peer, trustedProxies) {
+		return peer
+	}
+
+	if forwardedFor := r.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+		hops := strings.Split(strings.Join(forwardedFor, ","), ",")
+		client := ""
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := hostOf(strings.TrimSpace(hops[i]))
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			client = hop
+			if !trusted(hop, trustedProxies) {
+				break
+			}
+		}
+		if client != "" {
+			return client
+		}
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+
+	return peer
+}
+
+// hostOf strips the port from an address, if it has one
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// trusted reports whether an address is within one of the trusted networks
+func trusted(addr string, networks []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
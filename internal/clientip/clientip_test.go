@@ -0,0 +1,103 @@
+package clientip
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFromRequest(t *testing.T) {
+	proxies, err := ParseNetworks([]string{"10.0.0.0/8", "192.0.2.10", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string // X-Forwarded-For headers
+		realIP     string
+		proxies    bool // Trust the proxies above
+		want       string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:51000", proxies: true, want: "203.0.113.7"},
+		{name: "untrusted peer headers ignored", remoteAddr: "203.0.113.7:51000", forwarded: []string{"198.51.100.1"}, realIP: "198.51.100.2", proxies: true, want: "203.0.113.7"},
+		{name: "no trusted proxies", remoteAddr: "10.0.0.5:51000", forwarded: []string{"198.51.100.1"}, want: "10.0.0.5"},
+		{name: "single proxy", remoteAddr: "10.0.0.5:51000", forwarded: []string{"198.51.100.1"}, proxies: true, want: "198.51.100.1"},
+		{name: "trusted hops skipped", remoteAddr: "10.0.0.5:51000", forwarded: []string{"198.51.100.1, 192.0.2.10, 10.1.2.3"}, proxies: true, want: "198.51.100.1"},
+		{name: "spoofed entries left of the client", remoteAddr: "10.0.0.5:51000", forwarded: []string{"6.6.6.6, 198.51.100.1"}, proxies: true, want: "198.51.100.1"},
+		{name: "headers joined", remoteAddr: "10.0.0.5:51000", forwarded: []string{"6.6.6.6", "198.51.100.1, 10.1.2.3"}, proxies: true, want: "198.51.100.1"},
+		{name: "all hops trusted", remoteAddr: "10.0.0.5:51000", forwarded: []string{"10.9.9.9, 10.1.2.3"}, proxies: true, want: "10.9.9.9"},
+		{name: "hop with port", remoteAddr: "10.0.0.5:51000", forwarded: []string{"198.51.100.1:4711"}, proxies: true, want: "198.51.100.1"},
+		{name: "invalid hop stops the walk", remoteAddr: "10.0.0.5:51000", forwarded: []string{"198.51.100.1, unknown, 10.1.2.3"}, proxies: true, want: "10.1.2.3"},
+		{name: "invalid last hop falls back to the peer", remoteAddr: "10.0.0.5:51000", forwarded: []string{"198.51.100.1, unknown"}, proxies: true, want: "10.0.0.5"},
+		{name: "invalid last hop falls back to X-Real-IP", remoteAddr: "10.0.0.5:51000", forwarded: []string{"unknown"}, realIP: "198.51.100.2", proxies: true, want: "198.51.100.2"},
+		{name: "X-Real-IP", remoteAddr: "10.0.0.5:51000", realIP: "198.51.100.2", proxies: true, want: "198.51.100.2"},
+		{name: "invalid X-Real-IP", remoteAddr: "10.0.0.5:51000", realIP: "client", proxies: true, want: "10.0.0.5"},
+		{name: "IPv6 proxy", remoteAddr: "[2001:db8::1]:443", forwarded: []string{"2001:db9::7"}, proxies: true, want: "2001:db9::7"},
+		{name: "peer without port", remoteAddr: "203.0.113.7", proxies: true, want: "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			trustedProxies := proxies
+			if !tt.proxies {
+				trustedProxies = nil
+			}
+			if got := FromRequest(r, trustedProxies); got != tt.want {
+				t.Errorf("FromRequest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "IPv4 address", values: []string{"192.0.2.10"}, want: []string{"192.0.2.10/32"}},
+		{name: "IPv6 address", values: []string{"2001:db8::1"}, want: []string{"2001:db8::1/128"}},
+		{name: "networks", values: []string{"10.0.0.0/8", "2001:db8::/32"}, want: []string{"10.0.0.0/8", "2001:db8::/32"}},
+		{name: "network with host bits", values: []string{"10.1.2.3/8"}, want: []string{"10.0.0.0/8"}},
+		{name: "invalid address", values: []string{"proxy.local"}, wantErr: true},
+		{name: "invalid network", values: []string{"10.0.0.0/33"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networks, err := ParseNetworks(tt.values)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseNetworks() = %v, want an error", networks)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseNetworks() error = %v", err)
+			}
+
+			if len(networks) != len(tt.want) {
+				t.Fatalf("ParseNetworks() = %v, want %v", networks, tt.want)
+			}
+			for i, network := range networks {
+				if network.String() != tt.want[i] {
+					t.Errorf("network %d = %s, want %s", i, network, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+// Package configmap translates charge point configuration between OCPP 1.6 configuration keys and
+// OCPP 2.0.1 component variables, for migrating charge points between the protocol versions
+package configmap
+
+import (
+	"strings"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// Subprotocols of the OCPP versions a configuration is translated between
+const (
+	V16  = "ocpp1.6"
+	V201 = "ocpp2.0.1"
+)
+
+// Actions of the steps of a configuration plan
+const (
+	ActionApply    = "Apply"    // Set the target to the translated value
+	ActionVerify   = "Verify"   // The target is read-only, check it matches
+	ActionManual   = "Manual"   // The target must be set by hand, e.g. credentials or values without a direct translation
+	ActionUnmapped = "Unmapped" // The setting has no equivalent in the target version
+)
+
+// valueKind is how a value is converted between the versions
+type valueKind int
+
+const (
+	kindText    valueKind = iota
+	kindBoolean           // OCPP 2.0.1 booleans are lowercase
+	kindList              // Comma separated lists, OCPP 2.0.1 member lists have no spaces
+)
+
+// mapping pairs an OCPP 1.6 configuration key with its closest OCPP 2.0.1 variable
+type mapping struct {
+	key       string
+	component string
+	instance  string
+	variable  string
+	kind      valueKind
+	readonly  bool   // The setting is reported but cannot be changed
+	manual    bool   // The value cannot be copied, the note says why
+	secret    bool   // The value is a credential and is left out of plans
+	note      string // Differences in meaning between the versions
+}
+
+// mappings are the OCPP 1.6 standard configuration keys with an OCPP 2.0.1 equivalent, after the
+// migration tables of the OCPP 2.0.1 specification
+var mappings = []mapping{
+	// Core profile
+	{key: "AllowOfflineTxForUnknownId", component: "AuthCtrlr", variable: "OfflineTxForUnknownIdEnabled", kind: kindBoolean},
+	{key: "AuthorizationCacheEnabled", component: "AuthCacheCtrlr", variable: "Enabled", kind: kindBoolean},
+	{key: "AuthorizeRemoteTxRequests", component: "AuthCtrlr", variable: "AuthorizeRemoteStart", kind: kindBoolean},
+	{key: "ClockAlignedDataInterval", component: "AlignedDataCtrlr", variable: "Interval"},
+	{key: "ConnectionTimeOut", component: "TxCtrlr", variable: "EVConnectionTimeOut"},
+	{key: "ConnectorPhaseRotation", component: "ChargingStation", variable: "PhaseRotation", manual: true,
+		note: "OCPP 1.6 lists the rotation of every connector, OCPP 2.0.1 sets it per EVSE and connector component"},
+	{key: "GetConfigurationMaxKeys", component: "DeviceDataCtrlr", instance: "GetVariables", variable: "ItemsPerMessage", readonly: true},
+	{key: "HeartbeatInterval", component: "OCPPCommCtrlr", variable: "HeartbeatInterval"},
+	{key: "LocalAuthorizeOffline", component: "AuthCtrlr", variable: "LocalAuthorizeOffline", kind: kindBoolean},
+	{key: "LocalPreAuthorize", component: "AuthCtrlr", variable: "LocalPreAuthorize", kind: kindBoolean},
+	{key: "MaxEnergyOnInvalidId", component: "TxCtrlr", variable: "MaxEnergyOnInvalidId"},
+	{key: "MeterValuesAlignedData", component: "AlignedDataCtrlr", variable: "Measurands", kind: kindList},
+	{key: "MeterValuesSampledData", component: "SampledDataCtrlr", variable: "TxUpdatedMeasurands", kind: kindList},
+	{key: "MeterValueSampleInterval", component: "SampledDataCtrlr", variable: "TxUpdatedInterval"},
+	{key: "NumberOfConnectors", component: "EVSE", variable: "Count", readonly: true,
+		note: "OCPP 2.0.1 counts EVSEs, each with its own connectors"},
+	{key: "ResetRetries", component: "OCPPCommCtrlr", variable: "ResetRetries"},
+	{key: "StopTransactionOnEVSideDisconnect", component: "TxCtrlr", variable: "StopTxOnEVSideDisconnect", kind: kindBoolean},
+	{key: "StopTransactionOnInvalidId", component: "TxCtrlr", variable: "StopTxOnInvalidId", kind: kindBoolean},
+	{key: "StopTxnAlignedData", component: "AlignedDataCtrlr", variable: "TxEndedMeasurands", kind: kindList},
+	{key: "StopTxnSampledData", component: "SampledDataCtrlr", variable: "TxEndedMeasurands", kind: kindList},
+	{key: "TransactionMessageAttempts", component: "OCPPCommCtrlr", instance: "TransactionEvent", variable: "MessageAttempts"},
+	{key: "TransactionMessageRetryInterval", component: "OCPPCommCtrlr", instance: "TransactionEvent", variable: "MessageAttemptInterval"},
+	{key: "UnlockConnectorOnEVSideDisconnect", component: "OCPPCommCtrlr", variable: "UnlockOnEVSideDisconnect", kind: kindBoolean},
+	{key: "WebSocketPingInterval", component: "OCPPCommCtrlr", variable: "WebSocketPingInterval"},
+
+	// Local auth list management profile
+	{key: "LocalAuthListEnabled", component: "LocalAuthListCtrlr", variable: "Enabled", kind: kindBoolean},
+	{key: "LocalAuthListMaxLength", component: "LocalAuthListCtrlr", variable: "Entries", readonly: true},
+	{key: "SendLocalListMaxLength", component: "LocalAuthListCtrlr", variable: "ItemsPerMessage", readonly: true},
+
+	// Reservation profile
+	{key: "ReserveConnectorZeroSupported", component: "ReservationCtrlr", variable: "NonEvseSpecific", kind: kindBoolean, readonly: true},
+
+	// Smart charging profile
+	{key: "ChargeProfileMaxStackLevel", component: "SmartChargingCtrlr", variable: "ProfileStackLevel", readonly: true},
+	{key: "ChargingScheduleAllowedChargingRateUnit", component: "SmartChargingCtrlr", variable: "RateUnit", kind: kindList, readonly: true},
+	{key: "ChargingScheduleMaxPeriods", component: "SmartChargingCtrlr", variable: "PeriodsPerSchedule", readonly: true},
+	{key: "MaxChargingProfilesInstalled", component: "SmartChargingCtrlr", instance: "ChargingProfiles", variable: "Entries", readonly: true},
+
+	// Security whitepaper
+	{key: "AuthorizationKey", component: "SecurityCtrlr", variable: "BasicAuthPassword", manual: true, secret: true,
+		note: "Credentials are never copied, set the password explicitly"},
+	{key: "CpoName", component: "SecurityCtrlr", variable: "OrganizationName"},
+	{key: "SecurityProfile", component: "SecurityCtrlr", variable: "SecurityProfile", readonly: true,
+		note: "Security profiles are raised with SetNetworkProfile in OCPP 2.0.1"},
+}
+
+// variableName joins the component, instance and variable of an OCPP 2.0.1 variable
+func variableName(component, instance, variable string) string {
+	if instance == "" {
+		return component + "." + variable
+	}
+	return component + "." + instance + "." + variable
+}
+
+// convert converts a value to the target version
+func convert(value string, kind valueKind, to string) string {
+	switch kind {
+	case kindBoolean:
+		if strings.EqualFold(value, "true") {
+			value = "true"
+		} else if strings.EqualFold(value, "false") {
+			value = "false"
+		}
+		return value
+	case kindList:
+		separator := ","
+		if to == V16 {
+			separator = ", "
+		}
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return strings.Join(items, separator)
+	default:
+		return value
+	}
+}
+
+// step translates one setting with its mapping, nil if it has none
+func step(source, value string, readonly bool, m *mapping, to string) models.ConfigurationStep {
+	s := models.ConfigurationStep{Source: source, Value: value}
+	if m == nil {
+		s.Action = ActionUnmapped
+		s.Note = "No equivalent in " + to
+		return s
+	}
+	if m.secret {
+		s.Value = ""
+	}
+
+	if to == V201 {
+		s.Target = variableName(m.component, m.instance, m.variable)
+	} else {
+		s.Target = m.key
+	}
+	s.Note = m.note
+
+	switch {
+	case m.manual:
+		s.Action = ActionManual
+	case m.readonly || readonly:
+		s.Action = ActionVerify
+		s.TargetValue = convert(value, m.kind, to)
+	case value == "":
+		s.Action = ActionManual
+		if s.Note == "" {
+			s.Note = "No value reported"
+		}
+	default:
+		s.Action = ActionApply
+		s.TargetValue = convert(value, m.kind, to)
+	}
+	return s
+}
+
+// ToV201 translates OCPP 1.6 configuration keys to the OCPP 2.0.1 variables to set
+func ToV201(keys []models.ConfigurationKey) *models.ConfigurationPlan {
+	byKey := make(map[string]*mapping, len(mappings))
+	for i := range mappings {
+		byKey[mappings[i].key] = &mappings[i]
+	}
+
+	plan := &models.ConfigurationPlan{From: V16, To: V201, Steps: []models.ConfigurationStep{}}
+	for _, key := range keys {
+		m := byKey[key.Key]
+		s := step(key.Key, key.Value, key.Readonly, m, V201)
+		if s.Action == ActionApply {
+			plan.SetVariables = append(plan.SetVariables, models.ComponentVariable{
+				Component: m.component,
+				Instance:  m.instance,
+				Variable:  m.variable,
+				Value:     s.TargetValue,
+			})
+		}
+		plan.Steps = append(plan.Steps, s)
+	}
+	return plan
+}
+
+// ToV16 translates OCPP 2.0.1 variables to the OCPP 1.6 configuration keys to change
+func ToV16(variables []models.ComponentVariable) *models.ConfigurationPlan {
+	byVariable := make(map[string]*mapping, len(mappings))
+	for i := range mappings {
+		m := &mappings[i]
+		byVariable[variableName(m.component, m.instance, m.variable)] = m
+	}
+
+	plan := &models.ConfigurationPlan{From: V201, To: V16, Steps: []models.ConfigurationStep{}}
+	for _, v := range variables {
+		name := variableName(v.Component, v.Instance, v.Variable)
+		m := byVariable[name]
+		s := step(name, v.Value, v.Readonly, m, V16)
+		if s.Action == ActionApply {
+			if plan.ChangeConfiguration == nil {
+				plan.ChangeConfiguration = make(map[string]string)
+			}
+			plan.ChangeConfiguration[m.key] = s.TargetValue
+		}
+		plan.Steps = append(plan.Steps, s)
+	}
+	return plan
+}
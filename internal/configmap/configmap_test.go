@@ -0,0 +1,200 @@
+package configmap
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+func TestToV201(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        models.ConfigurationKey
+		wantStep   models.ConfigurationStep
+		wantSetVar *models.ComponentVariable
+	}{
+		{
+			name: "text value applied",
+			key:  models.ConfigurationKey{Key: "HeartbeatInterval", Value: "300"},
+			wantStep: models.ConfigurationStep{
+				Source: "HeartbeatInterval", Value: "300", Target: "OCPPCommCtrlr.HeartbeatInterval", TargetValue: "300", Action: ActionApply,
+			},
+			wantSetVar: &models.ComponentVariable{Component: "OCPPCommCtrlr", Variable: "HeartbeatInterval", Value: "300"},
+		},
+		{
+			name: "boolean lowercased",
+			key:  models.ConfigurationKey{Key: "LocalAuthorizeOffline", Value: "True"},
+			wantStep: models.ConfigurationStep{
+				Source: "LocalAuthorizeOffline", Value: "True", Target: "AuthCtrlr.LocalAuthorizeOffline", TargetValue: "true", Action: ActionApply,
+			},
+			wantSetVar: &models.ComponentVariable{Component: "AuthCtrlr", Variable: "LocalAuthorizeOffline", Value: "true"},
+		},
+		{
+			name: "list spaces and empty members removed",
+			key:  models.ConfigurationKey{Key: "MeterValuesSampledData", Value: "Energy.Active.Import.Register, Power.Active.Import,"},
+			wantStep: models.ConfigurationStep{
+				Source: "MeterValuesSampledData", Value: "Energy.Active.Import.Register, Power.Active.Import,",
+				Target: "SampledDataCtrlr.TxUpdatedMeasurands", TargetValue: "Energy.Active.Import.Register,Power.Active.Import", Action: ActionApply,
+			},
+			wantSetVar: &models.ComponentVariable{
+				Component: "SampledDataCtrlr", Variable: "TxUpdatedMeasurands", Value: "Energy.Active.Import.Register,Power.Active.Import",
+			},
+		},
+		{
+			name: "component instance",
+			key:  models.ConfigurationKey{Key: "TransactionMessageAttempts", Value: "3"},
+			wantStep: models.ConfigurationStep{
+				Source: "TransactionMessageAttempts", Value: "3", Target: "OCPPCommCtrlr.TransactionEvent.MessageAttempts", TargetValue: "3", Action: ActionApply,
+			},
+			wantSetVar: &models.ComponentVariable{Component: "OCPPCommCtrlr", Instance: "TransactionEvent", Variable: "MessageAttempts", Value: "3"},
+		},
+		{
+			name: "read-only target verified",
+			key:  models.ConfigurationKey{Key: "NumberOfConnectors", Value: "2", Readonly: true},
+			wantStep: models.ConfigurationStep{
+				Source: "NumberOfConnectors", Value: "2", Target: "EVSE.Count", TargetValue: "2", Action: ActionVerify,
+				Note: "OCPP 2.0.1 counts EVSEs, each with its own connectors",
+			},
+		},
+		{
+			name: "read-only key verified",
+			key:  models.ConfigurationKey{Key: "HeartbeatInterval", Value: "300", Readonly: true},
+			wantStep: models.ConfigurationStep{
+				Source: "HeartbeatInterval", Value: "300", Target: "OCPPCommCtrlr.HeartbeatInterval", TargetValue: "300", Action: ActionVerify,
+			},
+		},
+		{
+			name: "credentials never copied",
+			key:  models.ConfigurationKey{Key: "AuthorizationKey", Value: "secret"},
+			wantStep: models.ConfigurationStep{
+				Source: "AuthorizationKey", Target: "SecurityCtrlr.BasicAuthPassword", Action: ActionManual,
+				Note: "Credentials are never copied, set the password explicitly",
+			},
+		},
+		{
+			name: "missing value set by hand",
+			key:  models.ConfigurationKey{Key: "ConnectionTimeOut"},
+			wantStep: models.ConfigurationStep{
+				Source: "ConnectionTimeOut", Target: "TxCtrlr.EVConnectionTimeOut", Action: ActionManual, Note: "No value reported",
+			},
+		},
+		{
+			name: "vendor key unmapped",
+			key:  models.ConfigurationKey{Key: "VendorLedBrightness", Value: "80"},
+			wantStep: models.ConfigurationStep{
+				Source: "VendorLedBrightness", Value: "80", Action: ActionUnmapped, Note: "No equivalent in " + V201,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := ToV201([]models.ConfigurationKey{tt.key})
+			if plan.From != V16 || plan.To != V201 {
+				t.Errorf("plan translates %s to %s, want %s to %s", plan.From, plan.To, V16, V201)
+			}
+			if len(plan.Steps) != 1 || !reflect.DeepEqual(plan.Steps[0], tt.wantStep) {
+				t.Errorf("Steps = %+v, want [%+v]", plan.Steps, tt.wantStep)
+			}
+
+			var wantSetVariables []models.ComponentVariable
+			if tt.wantSetVar != nil {
+				wantSetVariables = []models.ComponentVariable{*tt.wantSetVar}
+			}
+			if !reflect.DeepEqual(plan.SetVariables, wantSetVariables) {
+				t.Errorf("SetVariables = %+v, want %+v", plan.SetVariables, wantSetVariables)
+			}
+		})
+	}
+}
+
+func TestToV16(t *testing.T) {
+	tests := []struct {
+		name       string
+		variable   models.ComponentVariable
+		wantStep   models.ConfigurationStep
+		wantChange map[string]string
+	}{
+		{
+			name:     "text value applied",
+			variable: models.ComponentVariable{Component: "OCPPCommCtrlr", Variable: "HeartbeatInterval", Value: "300"},
+			wantStep: models.ConfigurationStep{
+				Source: "OCPPCommCtrlr.HeartbeatInterval", Value: "300", Target: "HeartbeatInterval", TargetValue: "300", Action: ActionApply,
+			},
+			wantChange: map[string]string{"HeartbeatInterval": "300"},
+		},
+		{
+			name:     "list spaced",
+			variable: models.ComponentVariable{Component: "AlignedDataCtrlr", Variable: "Measurands", Value: "Energy.Active.Import.Register,Voltage"},
+			wantStep: models.ConfigurationStep{
+				Source: "AlignedDataCtrlr.Measurands", Value: "Energy.Active.Import.Register,Voltage",
+				Target: "MeterValuesAlignedData", TargetValue: "Energy.Active.Import.Register, Voltage", Action: ActionApply,
+			},
+			wantChange: map[string]string{"MeterValuesAlignedData": "Energy.Active.Import.Register, Voltage"},
+		},
+		{
+			name:     "component instance",
+			variable: models.ComponentVariable{Component: "OCPPCommCtrlr", Instance: "TransactionEvent", Variable: "MessageAttemptInterval", Value: "60"},
+			wantStep: models.ConfigurationStep{
+				Source: "OCPPCommCtrlr.TransactionEvent.MessageAttemptInterval", Value: "60",
+				Target: "TransactionMessageRetryInterval", TargetValue: "60", Action: ActionApply,
+			},
+			wantChange: map[string]string{"TransactionMessageRetryInterval": "60"},
+		},
+		{
+			name:     "credentials never copied",
+			variable: models.ComponentVariable{Component: "SecurityCtrlr", Variable: "BasicAuthPassword", Value: "secret"},
+			wantStep: models.ConfigurationStep{
+				Source: "SecurityCtrlr.BasicAuthPassword", Target: "AuthorizationKey", Action: ActionManual,
+				Note: "Credentials are never copied, set the password explicitly",
+			},
+		},
+		{
+			name:     "read-only variable verified",
+			variable: models.ComponentVariable{Component: "SmartChargingCtrlr", Variable: "ProfileStackLevel", Value: "8"},
+			wantStep: models.ConfigurationStep{
+				Source: "SmartChargingCtrlr.ProfileStackLevel", Value: "8", Target: "ChargeProfileMaxStackLevel", TargetValue: "8", Action: ActionVerify,
+			},
+		},
+		{
+			name:     "variable unmapped",
+			variable: models.ComponentVariable{Component: "DisplayCtrlr", Variable: "Brightness", Value: "80"},
+			wantStep: models.ConfigurationStep{
+				Source: "DisplayCtrlr.Brightness", Value: "80", Action: ActionUnmapped, Note: "No equivalent in " + V16,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := ToV16([]models.ComponentVariable{tt.variable})
+			if plan.From != V201 || plan.To != V16 {
+				t.Errorf("plan translates %s to %s, want %s to %s", plan.From, plan.To, V201, V16)
+			}
+			if len(plan.Steps) != 1 || !reflect.DeepEqual(plan.Steps[0], tt.wantStep) {
+				t.Errorf("Steps = %+v, want [%+v]", plan.Steps, tt.wantStep)
+			}
+			if !reflect.DeepEqual(plan.ChangeConfiguration, tt.wantChange) {
+				t.Errorf("ChangeConfiguration = %v, want %v", plan.ChangeConfiguration, tt.wantChange)
+			}
+		})
+	}
+}
+
+func TestMappingsUnique(t *testing.T) {
+	keys := make(map[string]bool, len(mappings))
+	variables := make(map[string]bool, len(mappings))
+	for _, m := range mappings {
+		if keys[m.key] {
+			t.Errorf("key %s is mapped twice", m.key)
+		}
+		keys[m.key] = true
+
+		name := variableName(m.component, m.instance, m.variable)
+		if variables[name] {
+			t.Errorf("variable %s is mapped twice", name)
+		}
+		variables[name] = true
+	}
+}
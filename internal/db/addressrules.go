@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// SaveAddressRule creates or updates a connection address rule
+func (s *PostgresStore) SaveAddressRule(ctx context.Context, rule *models.AddressRule) error {
+	query := `
+		INSERT INTO address_rules (id, tenant_id, cidr, action, description, created_at, updated_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4, NULLIF($5, ''), $6, $7)
+		ON CONFLICT (id) DO UPDATE SET
+			tenant_id = NULLIF($2, ''),
+			cidr = $3,
+			action = $4,
+			description = NULLIF($5, ''),
+			updated_at = $7
+		RETURNING created_at
+	`
+
+	now := time.Now()
+	if rule.CreatedAt.IsZero() {
+		rule.CreatedAt = now
+	}
+	rule.UpdatedAt = now
+
+	return s.pool.QueryRow(ctx, query,
+		rule.ID, rule.TenantID, rule.CIDR, rule.Action, rule.Description, rule.CreatedAt, rule.UpdatedAt,
+	).Scan(&rule.CreatedAt)
+}
+
+// GetAddressRules retrieves all connection address rules
+func (s *PostgresStore) GetAddressRules(ctx context.Context) ([]*models.AddressRule, error) {
+	query := `
+		SELECT id, COALESCE(tenant_id, ''), cidr, action, COALESCE(description, ''), created_at, updated_at
+		FROM address_rules
+		ORDER BY tenant_id NULLS FIRST, id
+	`
+
+	rows, err := s.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*models.AddressRule
+	for rows.Next() {
+		rule := &models.AddressRule{}
+		if err := rows.Scan(
+			&rule.ID, &rule.TenantID, &rule.CIDR, &rule.Action, &rule.Description, &rule.CreatedAt, &rule.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// DeleteAddressRule removes a connection address rule
+func (s *PostgresStore) DeleteAddressRule(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM address_rules WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
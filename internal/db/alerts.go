@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+const alertRuleColumns = `
+	id, name, condition, COALESCE(charge_point_id, ''), duration_minutes, COALESCE(error_code, ''), trigger_meter_values,
+	enabled, created_at, updated_at
+`
+
+const alertColumns = `
+	id, rule_id, rule_name, condition, charge_point_id, connector_id, state, message, COALESCE(diagnostics_file, ''),
+	fired_at, resolved_at
+`
+
+// SaveAlertRule creates or updates an alert rule
+func (s *PostgresStore) SaveAlertRule(ctx context.Context, rule *models.AlertRule) error {
+	query := `
+		INSERT INTO alert_rules (
+			id, name, condition, charge_point_id, duration_minutes, error_code, enabled, created_at, updated_at,
+			trigger_meter_values
+		) VALUES ($1, $2, $3, NULLIF($4, ''), $5, NULLIF($6, ''), $7, $8, $9, $10)
+		ON CONFLICT (id) DO UPDATE SET
+			name = $2,
+			condition = $3,
+			charge_point_id = NULLIF($4, ''),
+			duration_minutes = $5,
+			error_code = NULLIF($6, ''),
+			enabled = $7,
+			updated_at = $9,
+			trigger_meter_values = $10
+	`
+
+	now := time.Now()
+	if rule.CreatedAt.IsZero() {
+		rule.CreatedAt = now
+	}
+	rule.UpdatedAt = now
+
+	_, err := s.pool.Exec(ctx, query,
+		rule.ID, rule.Name, rule.Condition, rule.ChargePointID, rule.DurationMinutes, rule.ErrorCode, rule.Enabled,
+		rule.CreatedAt, rule.UpdatedAt, rule.TriggerMeterValues,
+	)
+	return err
+}
+
+// GetAlertRule retrieves an alert rule by its ID
+func (s *PostgresStore) GetAlertRule(ctx context.Context, id string) (*models.AlertRule, error) {
+	query := `SELECT ` + alertRuleColumns + ` FROM alert_rules WHERE id = $1`
+	return notFound(scanAlertRule(s.pool.QueryRow(ctx, query, id)))
+}
+
+// GetAlertRules retrieves all alert rules
+func (s *PostgresStore) GetAlertRules(ctx context.Context) ([]*models.AlertRule, error) {
+	query := `SELECT ` + alertRuleColumns + ` FROM alert_rules ORDER BY name`
+
+	rows, err := s.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*models.AlertRule
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// DeleteAlertRule removes an alert rule. The alerts it raised are kept.
+func (s *PostgresStore) DeleteAlertRule(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM alert_rules WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanAlertRule(row rowScanner) (*models.AlertRule, error) {
+	rule := &models.AlertRule{}
+	err := row.Scan(
+		&rule.ID, &rule.Name, &rule.Condition, &rule.ChargePointID, &rule.DurationMinutes, &rule.ErrorCode, &rule.TriggerMeterValues,
+		&rule.Enabled, &rule.CreatedAt, &rule.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// CreateAlert records a firing alert
+func (s *PostgresStore) CreateAlert(ctx context.Context, alert *models.Alert) error {
+	query := `
+		INSERT INTO alerts (
+			rule_id, rule_name, condition, charge_point_id, connector_id, state, message, diagnostics_file, fired_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9)
+		RETURNING id
+	`
+
+	if alert.FiredAt.IsZero() {
+		alert.FiredAt = time.Now()
+	}
+
+	return s.pool.QueryRow(ctx, query,
+		alert.RuleID, alert.RuleName, alert.Condition, alert.ChargePointID, alert.ConnectorID, alert.State, alert.Message,
+		alert.DiagnosticsFile, alert.FiredAt,
+	).Scan(&alert.ID)
+}
+
+// ResolveAlert marks a firing alert as resolved
+func (s *PostgresStore) ResolveAlert(ctx context.Context, id int, resolvedAt time.Time) error {
+	query := `
+		UPDATE alerts
+		SET state = 'resolved', resolved_at = $1
+		WHERE id = $2 AND state = 'firing'
+	`
+
+	_, err := s.pool.Exec(ctx, query, resolvedAt, id)
+	return err
+}
+
+// SetAlertDiagnostics attaches the location of a diagnostics file to an alert
+func (s *PostgresStore) SetAlertDiagnostics(ctx context.Context, id int, file string) error {
+	_, err := s.pool.Exec(ctx, `UPDATE alerts SET diagnostics_file = $1 WHERE id = $2`, file, id)
+	return err
+}
+
+// GetAlerts retrieves the most recently fired alerts, optionally only those in a state.
+// A zero limit retrieves all of them.
+func (s *PostgresStore) GetAlerts(ctx context.Context, state string, limit int) ([]*models.Alert, error) {
+	query := `SELECT ` + alertColumns + `
+		FROM alerts
+		WHERE $1 = '' OR state = $1
+		ORDER BY fired_at DESC, id DESC
+		LIMIT NULLIF($2::int, 0)
+	`
+
+	rows, err := s.pool.Query(ctx, query, state, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []*models.Alert
+	for rows.Next() {
+		alert := &models.Alert{}
+		var resolvedAt sql.NullTime
+		if err := rows.Scan(
+			&alert.ID, &alert.RuleID, &alert.RuleName, &alert.Condition, &alert.ChargePointID, &alert.ConnectorID,
+			&alert.State, &alert.Message, &alert.DiagnosticsFile, &alert.FiredAt, &resolvedAt,
+		); err != nil {
+			return nil, err
+		}
+		if resolvedAt.Valid {
+			alert.ResolvedAt = resolvedAt.Time
+		}
+		alerts = append(alerts, alert)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// CreateAuditEntry records an operator or policy action
+func (s *PostgresStore) CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	query := `
+		INSERT INTO audit_log (actor, action, target_type, target_id, details, client_addr, created_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)
+		RETURNING id
+	`
+
+	details, err := json.Marshal(entry.Details)
+	if err != nil {
+		return err
+	}
+	if entry.Details == nil {
+		details = []byte("{}")
+	}
+
+	entry.CreatedAt = time.Now()
+	return s.pool.QueryRow(ctx, query,
+		entry.Actor, entry.Action, entry.TargetType, entry.TargetID, details, entry.ClientAddr, entry.CreatedAt,
+	).Scan(&entry.ID)
+}
+
+// GetAuditLog retrieves the most recent audit entries, optionally filtered by target
+func (s *PostgresStore) GetAuditLog(ctx context.Context, targetType, targetID string, limit int) ([]*models.AuditEntry, error) {
+	query := `
+		SELECT id, actor, action, target_type, target_id, details, COALESCE(client_addr, ''), created_at
+		FROM audit_log
+		WHERE ($1 = '' OR target_type = $1) AND ($2 = '' OR target_id = $2)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`
+
+	rows, err := s.pool.Query(ctx, query, targetType, targetID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.AuditEntry
+	for rows.Next() {
+		entry := &models.AuditEntry{}
+		var details []byte
+		if err := rows.Scan(
+			&entry.ID, &entry.Actor, &entry.Action, &entry.TargetType, &entry.TargetID, &details, &entry.ClientAddr, &entry.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(details, &entry.Details); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+const commandColumns = `
+	id, charge_point_id, action, payload, status, response, error,
+	actor, macro_run_id, step, COALESCE(session_id::text, ''), COALESCE(request_id, ''), attempts, created_at, completed_at
+`
+
+// CreateCommand records a command before it is sent to the charge point
+func (s *PostgresStore) CreateCommand(ctx context.Context, cmd *models.Command) error {
+	query := `
+		INSERT INTO commands (charge_point_id, action, payload, status, actor, macro_run_id, step, session_id, request_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), NULLIF($7, 0), NULLIF($8, '')::uuid, NULLIF($9, ''), $10)
+		RETURNING id
+	`
+
+	cmd.CreatedAt = time.Now()
+	return s.pool.QueryRow(ctx, query,
+		cmd.ChargePointID, cmd.Action, []byte(cmd.Payload), cmd.Status, cmd.Actor, cmd.MacroRunID, cmd.Step, cmd.SessionID, cmd.RequestID, cmd.CreatedAt,
+	).Scan(&cmd.ID)
+}
+
+// CompleteCommand records the outcome of a command
+func (s *PostgresStore) CompleteCommand(ctx context.Context, cmd *models.Command) error {
+	query := `
+		UPDATE commands
+		SET status = $1, response = $2, error = NULLIF($3, ''), completed_at = $4, attempts = $6
+		WHERE id = $5
+	`
+
+	var response []byte
+	if len(cmd.Response) > 0 {
+		response = cmd.Response
+	}
+
+	cmd.CompletedAt = time.Now()
+	_, err := s.pool.Exec(ctx, query, cmd.Status, response, cmd.Error, cmd.CompletedAt, cmd.ID, cmd.Attempts)
+	return err
+}
+
+// GetCommand retrieves a command by its ID
+func (s *PostgresStore) GetCommand(ctx context.Context, id int) (*models.Command, error) {
+	query := `SELECT ` + commandColumns + ` FROM commands WHERE id = $1`
+	return notFound(scanCommand(s.pool.QueryRow(ctx, query, id)))
+}
+
+// GetCommands retrieves the most recent commands sent to a charge point
+func (s *PostgresStore) GetCommands(ctx context.Context, chargePointID string, limit int) ([]*models.Command, error) {
+	query := `SELECT ` + commandColumns + `
+		FROM commands
+		WHERE charge_point_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+	return s.queryCommands(ctx, query, chargePointID, limit)
+}
+
+// GetLatestCommand retrieves the most recent command of an action the charge point answered
+func (s *PostgresStore) GetLatestCommand(ctx context.Context, chargePointID, action string) (*models.Command, error) {
+	query := `SELECT ` + commandColumns + `
+		FROM commands
+		WHERE charge_point_id = $1 AND action = $2 AND response IS NOT NULL
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+	return notFound(scanCommand(s.pool.QueryRow(ctx, query, chargePointID, action)))
+}
+
+// GetMacroRunCommands retrieves the commands sent by a macro run
+func (s *PostgresStore) GetMacroRunCommands(ctx context.Context, runID int) ([]*models.Command, error) {
+	query := `SELECT ` + commandColumns + `
+		FROM commands
+		WHERE macro_run_id = $1
+		ORDER BY charge_point_id, step, id
+	`
+	return s.queryCommands(ctx, query, runID)
+}
+
+// GetSessionCommands retrieves the commands sent for a session
+func (s *PostgresStore) GetSessionCommands(ctx context.Context, sessionID string) ([]*models.Command, error) {
+	query := `SELECT ` + commandColumns + `
+		FROM commands
+		WHERE session_id = $1::uuid
+		ORDER BY created_at, id
+	`
+	return s.queryCommands(ctx, query, sessionID)
+}
+
+func (s *PostgresStore) queryCommands(ctx context.Context, query string, args ...interface{}) ([]*models.Command, error) {
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var commands []*models.Command
+	for rows.Next() {
+		cmd, err := scanCommand(rows)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, cmd)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return commands, nil
+}
+
+func scanCommand(row rowScanner) (*models.Command, error) {
+	cmd := &models.Command{}
+	var payload, response []byte
+	var errMsg sql.NullString
+	var macroRunID, step sql.NullInt32
+	var completedAt sql.NullTime
+	err := row.Scan(
+		&cmd.ID, &cmd.ChargePointID, &cmd.Action, &payload, &cmd.Status, &response, &errMsg,
+		&cmd.Actor, &macroRunID, &step, &cmd.SessionID, &cmd.RequestID, &cmd.Attempts, &cmd.CreatedAt, &completedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.Payload = payload
+	cmd.Response = response
+	cmd.Error = errMsg.String
+	cmd.MacroRunID = int(macroRunID.Int32)
+	cmd.Step = int(step.Int32)
+	if completedAt.Valid {
+		cmd.CompletedAt = completedAt.Time
+	}
+	return cmd, nil
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// CreateConnectionEvent records a websocket connection of a charge point and stores its metadata on the charge point
+func (s *PostgresStore) CreateConnectionEvent(ctx context.Context, event *models.ConnectionEvent) error {
+	headers, err := json.Marshal(event.Headers)
+	if err != nil {
+		return err
+	}
+	if event.Headers == nil {
+		headers = []byte("{}")
+	}
+	if event.ConnectedAt.IsZero() {
+		event.ConnectedAt = time.Now()
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// A connection still open was replaced without a disconnect, e.g. after a crash of this instance
+	if _, err := tx.Exec(ctx, `
+		UPDATE charge_point_connections SET disconnected_at = $2
+		WHERE charge_point_id = $1 AND disconnected_at IS NULL
+	`, event.ChargePointID, event.ConnectedAt); err != nil {
+		return err
+	}
+
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO charge_point_connections (charge_point_id, remote_addr, subprotocol, headers, connected_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, event.ChargePointID, event.RemoteAddr, event.Subprotocol, headers, event.ConnectedAt).Scan(&event.ID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE charge_points
+		SET remote_addr = NULLIF($2, ''), subprotocol = NULLIF($3, ''), connection_headers = $4
+		WHERE id = $1
+	`, event.ChargePointID, event.RemoteAddr, event.Subprotocol, headers); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// CloseConnectionEvent records the end of a charge point's open connection
+func (s *PostgresStore) CloseConnectionEvent(ctx context.Context, chargePointID string, disconnectedAt time.Time) error {
+	_, err := s.pool.Exec(ctx, `
+		UPDATE charge_point_connections SET disconnected_at = $2
+		WHERE charge_point_id = $1 AND disconnected_at IS NULL
+	`, chargePointID, disconnectedAt)
+	return err
+}
+
+// GetConnectionEvents retrieves the most recent connections of a charge point
+func (s *PostgresStore) GetConnectionEvents(ctx context.Context, chargePointID string, limit int) ([]*models.ConnectionEvent, error) {
+	query := `
+		SELECT id, charge_point_id, remote_addr, subprotocol, headers, connected_at, disconnected_at
+		FROM charge_point_connections
+		WHERE charge_point_id = $1
+		ORDER BY connected_at DESC
+		LIMIT $2
+	`
+
+	rows, err := s.pool.Query(ctx, query, chargePointID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.ConnectionEvent
+	for rows.Next() {
+		e := &models.ConnectionEvent{}
+		var headers []byte
+		var disconnectedAt sql.NullTime
+		if err := rows.Scan(
+			&e.ID, &e.ChargePointID, &e.RemoteAddr, &e.Subprotocol, &headers, &e.ConnectedAt, &disconnectedAt,
+		); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(headers, &e.Headers); err != nil {
+			return nil, err
+		}
+		e.DisconnectedAt = disconnectedAt.Time
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
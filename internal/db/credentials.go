@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// HashPassword returns the stored representation of a charge point password. The passwords are random
+// and long, so an unsalted hash is as good as a slow one.
+func HashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+const credentialRotationColumns = `
+	id, charge_point_id, status, COALESCE(command_id, 0), COALESCE(error, ''), COALESCE(actor, ''), password_hash,
+	created_at, updated_at, completed_at
+`
+
+// GetChargePointPasswordHash retrieves the hash of a charge point's basic auth password, empty if it has none
+func (s *PostgresStore) GetChargePointPasswordHash(ctx context.Context, chargePointID string) (string, error) {
+	var hash sql.NullString
+	err := s.pool.QueryRow(ctx, `SELECT password_hash FROM charge_points WHERE id = $1`, chargePointID).Scan(&hash)
+	if err != nil {
+		return notFound("", err)
+	}
+	return hash.String, nil
+}
+
+// CreateCredentialRotation stores a new credential rotation, superseding the open rotations of the charge point
+func (s *PostgresStore) CreateCredentialRotation(ctx context.Context, rotation *models.CredentialRotation) error {
+	now := time.Now()
+	rotation.CreatedAt = now
+	rotation.UpdatedAt = now
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE credential_rotations SET status = 'Superseded', updated_at = $2
+		WHERE charge_point_id = $1 AND status IN ('Pending', 'AwaitingReconnect')
+	`, rotation.ChargePointID, now); err != nil {
+		return err
+	}
+
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO credential_rotations (
+			charge_point_id, status, actor, password_hash, created_at, updated_at
+		) VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6)
+		RETURNING id
+	`, rotation.ChargePointID, rotation.Status, rotation.Actor, rotation.PasswordHash, rotation.CreatedAt, rotation.UpdatedAt,
+	).Scan(&rotation.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UpdateCredentialRotation persists the status, command and error of an open credential rotation.
+// Rotations completed or superseded in the meantime are left alone.
+func (s *PostgresStore) UpdateCredentialRotation(ctx context.Context, rotation *models.CredentialRotation) error {
+	query := `
+		UPDATE credential_rotations
+		SET status = $1, command_id = NULLIF($2, 0), error = NULLIF($3, ''), updated_at = $4
+		WHERE id = $5 AND status IN ('Pending', 'AwaitingReconnect')
+	`
+
+	rotation.UpdatedAt = time.Now()
+	_, err := s.pool.Exec(ctx, query, rotation.Status, rotation.CommandID, rotation.Error, rotation.UpdatedAt, rotation.ID)
+	return err
+}
+
+// GetOpenCredentialRotation retrieves the rotation of a charge point waiting for the charge point to use its password
+func (s *PostgresStore) GetOpenCredentialRotation(ctx context.Context, chargePointID string) (*models.CredentialRotation, error) {
+	query := `SELECT ` + credentialRotationColumns + `
+		FROM credential_rotations
+		WHERE charge_point_id = $1 AND status IN ('Pending', 'AwaitingReconnect')
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+	return notFound(scanCredentialRotation(s.pool.QueryRow(ctx, query, chargePointID)))
+}
+
+// CompleteCredentialRotation makes the password of an open rotation the charge point's password,
+// invalidating the previous one. It reports false if the rotation is no longer open.
+func (s *PostgresStore) CompleteCredentialRotation(ctx context.Context, id int) (bool, error) {
+	now := time.Now()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var chargePointID, passwordHash string
+	err = tx.QueryRow(ctx, `
+		UPDATE credential_rotations SET status = 'Completed', error = NULL, updated_at = $2, completed_at = $2
+		WHERE id = $1 AND status IN ('Pending', 'AwaitingReconnect')
+		RETURNING charge_point_id, password_hash
+	`, id, now).Scan(&chargePointID, &passwordHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE charge_points SET password_hash = $2, updated_at = $3 WHERE id = $1
+	`, chargePointID, passwordHash, now); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// GetCredentialRotations retrieves the most recent credential rotations of a charge point
+func (s *PostgresStore) GetCredentialRotations(ctx context.Context, chargePointID string, limit int) ([]*models.CredentialRotation, error) {
+	query := `SELECT ` + credentialRotationColumns + `
+		FROM credential_rotations
+		WHERE charge_point_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+
+	rows, err := s.pool.Query(ctx, query, chargePointID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rotations []*models.CredentialRotation
+	for rows.Next() {
+		rotation, err := scanCredentialRotation(rows)
+		if err != nil {
+			return nil, err
+		}
+		rotations = append(rotations, rotation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rotations, nil
+}
+
+func scanCredentialRotation(row rowScanner) (*models.CredentialRotation, error) {
+	rotation := &models.CredentialRotation{}
+	var completedAt sql.NullTime
+	err := row.Scan(
+		&rotation.ID, &rotation.ChargePointID, &rotation.Status, &rotation.CommandID, &rotation.Error, &rotation.Actor,
+		&rotation.PasswordHash, &rotation.CreatedAt, &rotation.UpdatedAt, &completedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	rotation.CompletedAt = completedAt.Time
+	return rotation, nil
+}
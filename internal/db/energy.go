@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// hourlyEnergyLookback is how far before the requested range readings are read,
+// so the first hour's energy is measured from the previous reading
+const hourlyEnergyLookback = 24 * time.Hour
+
+// GetHourlyEnergy returns the energy delivered per connector and hour of a charge point in [from, to).
+// In Timescale mode the hourly register readings come from the meter_values_hourly_energy continuous aggregate,
+// otherwise they are aggregated from the raw meter values.
+func (s *PostgresStore) GetHourlyEnergy(ctx context.Context, chargePointID string, from, to time.Time) ([]*models.HourlyEnergy, error) {
+	hourly := `
+		SELECT connector_id, date_trunc('hour', timestamp) AS bucket,
+			min(CASE WHEN unit = 'kWh' THEN value ELSE value / 1000 END) AS min_kwh,
+			max(CASE WHEN unit = 'kWh' THEN value ELSE value / 1000 END) AS max_kwh
+		FROM meter_values
+		WHERE charge_point_id = $1 AND measurand = 'Energy.Active.Import.Register'
+			AND timestamp >= $2 AND timestamp < $3
+		GROUP BY 1, 2
+	`
+	if s.timescale {
+		hourly = `
+			SELECT connector_id, bucket, min_kwh, max_kwh
+			FROM meter_values_hourly_energy
+			WHERE charge_point_id = $1 AND bucket >= $2 AND bucket < $3
+		`
+	}
+
+	// The energy of an hour is its highest reading minus the previous hour's, clamped for meter resets
+	query := `
+		WITH hourly AS (` + hourly + `),
+		energy AS (
+			SELECT connector_id, bucket,
+				GREATEST(max_kwh - COALESCE(lag(max_kwh) OVER (PARTITION BY connector_id ORDER BY bucket), min_kwh), 0) AS energy_kwh
+			FROM hourly
+		)
+		SELECT connector_id, bucket, energy_kwh
+		FROM energy
+		WHERE bucket >= $4 AND $1 IN (
+			SELECT id FROM charge_points WHERE ` + tenantScope("tenant_id", 5) + `
+		)
+		ORDER BY bucket, connector_id
+	`
+
+	rows, err := s.pool.Query(ctx, query, chargePointID, from.Add(-hourlyEnergyLookback), to, from, TenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var energy []*models.HourlyEnergy
+	for rows.Next() {
+		e := &models.HourlyEnergy{}
+		if err := rows.Scan(&e.ConnectorID, &e.Hour, &e.EnergyKWh); err != nil {
+			return nil, err
+		}
+		energy = append(energy, e)
+	}
+
+	return energy, rows.Err()
+}
@@ -0,0 +1,18 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrNotFound is returned when a requested row does not exist or is outside the context's tenant scope
+var ErrNotFound = errors.New("not found")
+
+// notFound translates the pgx error of a single-row query that matched nothing into ErrNotFound
+func notFound[T any](v T, err error) (T, error) {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ExportBatchSize is the number of rows fetched from the server-side cursor at a time
+const ExportBatchSize = 1000
+
+// streamCursor runs a query through a server-side cursor and calls scan for every row.
+// Rows are fetched in batches of ExportBatchSize, so a slow consumer holds back the next fetch
+// instead of the whole result set being buffered in memory.
+func (s *PostgresStore) streamCursor(ctx context.Context, query string, args []interface{}, scan func(pgx.Rows) error) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DECLARE export_cursor NO SCROLL CURSOR FOR `+query, args...); err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf(`FETCH %d FROM export_cursor`, ExportBatchSize)
+	for {
+		rows, err := tx.Query(ctx, fetch)
+		if err != nil {
+			return err
+		}
+
+		n := 0
+		for rows.Next() {
+			n++
+			if err := scan(rows); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if n < ExportBatchSize {
+			break
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// StreamTransactions calls fn for every transaction started in [from, to) within the context's tenant scope
+func (s *PostgresStore) StreamTransactions(ctx context.Context, from, to time.Time, fn func(*models.Transaction) error) error {
+	query := `SELECT ` + transactionColumns + `
+		FROM transactions
+		WHERE start_time >= $1 AND start_time < $2 AND ` + tenantScope("tenant_id", 3) + `
+		ORDER BY start_time, id
+	`
+
+	return s.streamCursor(ctx, query, []interface{}{from, to, TenantFromContext(ctx)}, func(rows pgx.Rows) error {
+		tx, err := scanTransaction(rows)
+		if err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// StreamMeterValues calls fn for every meter value of a charge point sampled in [from, to)
+func (s *PostgresStore) StreamMeterValues(ctx context.Context, chargePointID string, from, to time.Time, fn func(*models.MeterValue) error) error {
+	query := `SELECT ` + meterValueColumns + `
+		FROM meter_values
+		WHERE charge_point_id = $1 AND timestamp >= $2 AND timestamp < $3 AND charge_point_id IN (
+			SELECT id FROM charge_points WHERE ` + tenantScope("tenant_id", 4) + `
+		)
+		ORDER BY timestamp, id
+	`
+
+	return s.streamCursor(ctx, query, []interface{}{chargePointID, from, to, TenantFromContext(ctx)}, func(rows pgx.Rows) error {
+		mv, err := scanMeterValue(rows)
+		if err != nil {
+			return err
+		}
+		return fn(mv)
+	})
+}
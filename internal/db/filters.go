@@ -0,0 +1,204 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSort is returned when a list is sorted by a field it cannot be sorted by
+var ErrInvalidSort = errors.New("invalid sort field")
+
+// Sort orders a list by one of its sortable fields. The zero Sort keeps the list's default order.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// ParseSort parses a sort parameter like "lastHeartbeat" or "-lastHeartbeat" for descending order
+func ParseSort(v string) Sort {
+	if strings.HasPrefix(v, "-") {
+		return Sort{Field: v[1:], Desc: true}
+	}
+	return Sort{Field: v}
+}
+
+// ChargePointFilter selects the charge points of a list. Zero fields match all charge points.
+type ChargePointFilter struct {
+	IsConnected        *bool
+	Vendor             string
+	Model              string
+	FirmwareVersion    string
+	RegistrationStatus string
+	SiteID             string
+	ClockDriftFlagged  bool // Only charge points whose clock drift exceeds the threshold
+	RebootLooping      bool // Only charge points in a reboot loop
+}
+
+// TransactionFilter selects the transactions of a list. Zero fields match all transactions.
+type TransactionFilter struct {
+	ChargePointID string
+	ConnectorID   int
+	IdTag         string // Only transactions started with the idTag
+	Status        string
+	BillingReview bool      // Only transactions flagged for billing review
+	VehicleVIN    string    // Only transactions charging the vehicle
+	From          time.Time // Started at or after
+	To            time.Time // Started before
+}
+
+// QuarantineFilter selects the quarantined OCPP messages of a list. Zero fields match all messages.
+type QuarantineFilter struct {
+	ChargePointID string
+	Unreviewed    bool // Only messages that weren't reviewed yet
+}
+
+// chargePointSortColumns maps the sortable fields of charge points to their columns
+var chargePointSortColumns = map[string]string{
+	"id":                 "id",
+	"vendor":             "vendor",
+	"model":              "model",
+	"firmwareVersion":    "firmware_version",
+	"registrationStatus": "registration_status",
+	"isConnected":        "is_connected",
+	"lastHeartbeat":      "last_heartbeat",
+	"connectedSince":     "connected_since",
+	"createdAt":          "created_at",
+	"updatedAt":          "updated_at",
+}
+
+// transactionSortColumns maps the sortable fields of transactions to their columns
+var transactionSortColumns = map[string]string{
+	"id":            "id",
+	"chargePointId": "charge_point_id",
+	"connectorId":   "connector_id",
+	"idTag":         "id_tag",
+	"status":        "status",
+	"startTime":     "start_time",
+	"endTime":       "end_time",
+	"meterStart":    "meter_start",
+	"meterStop":     "meter_stop",
+}
+
+// orderClause returns the ORDER BY clause of a sort, breaking ties by ID.
+// The zero Sort returns the default order.
+func orderClause(sort Sort, columns map[string]string, defaultOrder string) (string, error) {
+	if sort.Field == "" {
+		return "ORDER BY " + defaultOrder, nil
+	}
+
+	column, ok := columns[sort.Field]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrInvalidSort, sort.Field)
+	}
+
+	direction := "ASC NULLS LAST"
+	if sort.Desc {
+		direction = "DESC NULLS LAST"
+	}
+	if column == "id" {
+		return "ORDER BY id " + direction, nil
+	}
+	return fmt.Sprintf("ORDER BY %s %s, id", column, direction), nil
+}
+
+// conditions collects the WHERE conditions of a query and their parameters
+type conditions struct {
+	where []string
+	args  []interface{}
+}
+
+// add adds a condition on the next parameter, written as %d in the condition
+func (c *conditions) add(condition string, arg interface{}) {
+	c.args = append(c.args, arg)
+	c.where = append(c.where, fmt.Sprintf(condition, len(c.args)))
+}
+
+// addTenantScope restricts the rows to the context's tenant
+func (c *conditions) addTenantScope(column, tenantID string) {
+	c.args = append(c.args, tenantID)
+	c.where = append(c.where, tenantScope(column, len(c.args)))
+}
+
+// String returns the conditions joined for a WHERE clause
+func (c *conditions) String() string {
+	if len(c.where) == 0 {
+		return "TRUE"
+	}
+	return strings.Join(c.where, " AND ")
+}
+
+// chargePointConditions returns the conditions of a charge point filter within the tenant scope
+func chargePointConditions(filter ChargePointFilter, tenantID string) *conditions {
+	c := &conditions{}
+	c.addTenantScope("tenant_id", tenantID)
+	if filter.IsConnected != nil {
+		c.add("is_connected = $%d", *filter.IsConnected)
+	}
+	if filter.Vendor != "" {
+		c.add("vendor = $%d", filter.Vendor)
+	}
+	if filter.Model != "" {
+		c.add("model = $%d", filter.Model)
+	}
+	if filter.FirmwareVersion != "" {
+		c.add("firmware_version = $%d", filter.FirmwareVersion)
+	}
+	if filter.RegistrationStatus != "" {
+		c.add("registration_status = $%d", filter.RegistrationStatus)
+	}
+	if filter.SiteID != "" {
+		c.add("site_id = $%d", filter.SiteID)
+	}
+	if filter.ClockDriftFlagged {
+		c.add("clock_drift_flagged = $%d", true)
+	}
+	if filter.RebootLooping {
+		c.add("(reboot_loop_since IS NOT NULL) = $%d", true)
+	}
+	return c
+}
+
+// transactionConditions returns the conditions of a transaction filter within the tenant scope
+func transactionConditions(filter TransactionFilter, tenantID string) *conditions {
+	c := &conditions{}
+	c.addTenantScope("tenant_id", tenantID)
+	if filter.ChargePointID != "" {
+		c.add("charge_point_id = $%d", filter.ChargePointID)
+	}
+	if filter.ConnectorID > 0 {
+		c.add("connector_id = $%d", filter.ConnectorID)
+	}
+	if filter.IdTag != "" {
+		c.add("id_tag = $%d", filter.IdTag)
+	}
+	if filter.Status != "" {
+		c.add("status = $%d", filter.Status)
+	}
+	if filter.BillingReview {
+		c.add("billing_review = $%d", true)
+	}
+	if filter.VehicleVIN != "" {
+		c.add("vehicle_vin = $%d", filter.VehicleVIN)
+	}
+	if !filter.From.IsZero() {
+		c.add("start_time >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		c.add("start_time < $%d", filter.To)
+	}
+	return c
+}
+
+// quarantineConditions returns the conditions of a quarantined message filter
+func quarantineConditions(filter QuarantineFilter) *conditions {
+	c := &conditions{}
+	if filter.ChargePointID != "" {
+		c.add("charge_point_id = $%d", filter.ChargePointID)
+	}
+	if filter.Unreviewed {
+		c.add("(reviewed_at IS NULL) = $%d", true)
+	}
+	return c
+}
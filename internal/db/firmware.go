@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+const firmwareUpdateColumns = `
+	id, charge_point_id, locations, retrieve_date, status, attempts, max_attempts,
+	next_retry_at, last_error, created_at, updated_at
+`
+
+// CreateFirmwareUpdate stores a new firmware update request
+func (s *PostgresStore) CreateFirmwareUpdate(ctx context.Context, fu *models.FirmwareUpdate) error {
+	query := `
+		INSERT INTO firmware_updates (
+			charge_point_id, locations, retrieve_date, status, attempts, max_attempts,
+			created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`
+
+	now := time.Now()
+	fu.CreatedAt = now
+	fu.UpdatedAt = now
+
+	return s.pool.QueryRow(ctx, query,
+		fu.ChargePointID, fu.Locations, fu.RetrieveDate, fu.Status, fu.Attempts, fu.MaxAttempts,
+		fu.CreatedAt, fu.UpdatedAt,
+	).Scan(&fu.ID)
+}
+
+// UpdateFirmwareUpdate persists the status and retry state of a firmware update
+func (s *PostgresStore) UpdateFirmwareUpdate(ctx context.Context, fu *models.FirmwareUpdate) error {
+	query := `
+		UPDATE firmware_updates
+		SET status = $1, attempts = $2, next_retry_at = $3, last_error = $4, updated_at = $5
+		WHERE id = $6
+	`
+
+	var nextRetryAt sql.NullTime
+	if !fu.NextRetryAt.IsZero() {
+		nextRetryAt = sql.NullTime{Time: fu.NextRetryAt, Valid: true}
+	}
+
+	fu.UpdatedAt = time.Now()
+	_, err := s.pool.Exec(ctx, query,
+		fu.Status, fu.Attempts, nextRetryAt, sql.NullString{String: fu.LastError, Valid: fu.LastError != ""},
+		fu.UpdatedAt, fu.ID,
+	)
+	return err
+}
+
+// GetActiveFirmwareUpdate retrieves the most recent unfinished firmware update for a charge point
+func (s *PostgresStore) GetActiveFirmwareUpdate(ctx context.Context, chargePointID string) (*models.FirmwareUpdate, error) {
+	query := `SELECT ` + firmwareUpdateColumns + `
+		FROM firmware_updates
+		WHERE charge_point_id = $1 AND status NOT IN ('Installed', 'Failed')
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	return notFound(scanFirmwareUpdate(s.pool.QueryRow(ctx, query, chargePointID)))
+}
+
+// GetFirmwareUpdates retrieves all firmware updates for a charge point
+func (s *PostgresStore) GetFirmwareUpdates(ctx context.Context, chargePointID string) ([]*models.FirmwareUpdate, error) {
+	query := `SELECT ` + firmwareUpdateColumns + `
+		FROM firmware_updates
+		WHERE charge_point_id = $1
+		ORDER BY created_at DESC
+	`
+
+	return s.queryFirmwareUpdates(ctx, query, chargePointID)
+}
+
+// GetFirmwareUpdatesDueForRetry retrieves firmware updates whose retry time has passed
+func (s *PostgresStore) GetFirmwareUpdatesDueForRetry(ctx context.Context, now time.Time) ([]*models.FirmwareUpdate, error) {
+	query := `SELECT ` + firmwareUpdateColumns + `
+		FROM firmware_updates
+		WHERE status = 'RetryScheduled' AND next_retry_at <= $1
+		ORDER BY next_retry_at
+	`
+
+	return s.queryFirmwareUpdates(ctx, query, now)
+}
+
+func (s *PostgresStore) queryFirmwareUpdates(ctx context.Context, query string, args ...interface{}) ([]*models.FirmwareUpdate, error) {
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var updates []*models.FirmwareUpdate
+	for rows.Next() {
+		fu, err := scanFirmwareUpdate(rows)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, fu)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return updates, nil
+}
+
+// rowScanner is satisfied by both pgx.Row and pgx.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFirmwareUpdate(row rowScanner) (*models.FirmwareUpdate, error) {
+	fu := &models.FirmwareUpdate{}
+	var nextRetryAt sql.NullTime
+	var lastError sql.NullString
+	err := row.Scan(
+		&fu.ID, &fu.ChargePointID, &fu.Locations, &fu.RetrieveDate, &fu.Status, &fu.Attempts, &fu.MaxAttempts,
+		&nextRetryAt, &lastError, &fu.CreatedAt, &fu.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if nextRetryAt.Valid {
+		fu.NextRetryAt = nextRetryAt.Time
+	}
+	fu.LastError = lastError.String
+
+	return fu, nil
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+const gridEventColumns = `
+	id, site_id, limit_kw, start_time, end_time, status, source, created_at, updated_at
+`
+
+// SaveGridEvent creates or updates a grid event.
+// Updates of an already finished event are ignored so a resent signal cannot reactivate it.
+func (s *PostgresStore) SaveGridEvent(ctx context.Context, event *models.GridEvent) error {
+	query := `
+		INSERT INTO grid_events (
+			id, site_id, limit_kw, start_time, end_time, status, source, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO UPDATE SET
+			limit_kw = $3,
+			start_time = $4,
+			end_time = $5,
+			updated_at = $9
+		WHERE grid_events.status IN ('Scheduled', 'Active')
+	`
+
+	now := time.Now()
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = now
+	}
+	event.UpdatedAt = now
+
+	_, err := s.pool.Exec(ctx, query,
+		event.ID, event.SiteID, event.LimitKW, event.StartTime, event.EndTime, event.Status, event.Source,
+		event.CreatedAt, event.UpdatedAt,
+	)
+	return err
+}
+
+// UpdateGridEventStatus updates the status of a grid event
+func (s *PostgresStore) UpdateGridEventStatus(ctx context.Context, id, status string) error {
+	query := `
+		UPDATE grid_events
+		SET status = $1, updated_at = $2
+		WHERE id = $3
+	`
+
+	_, err := s.pool.Exec(ctx, query, status, time.Now(), id)
+	return err
+}
+
+// GetGridEvent retrieves a grid event by its ID
+func (s *PostgresStore) GetGridEvent(ctx context.Context, id string) (*models.GridEvent, error) {
+	query := `SELECT ` + gridEventColumns + ` FROM grid_events WHERE id = $1`
+	return notFound(scanGridEvent(s.pool.QueryRow(ctx, query, id)))
+}
+
+// GetGridEvents retrieves the grid event history, most recent first
+func (s *PostgresStore) GetGridEvents(ctx context.Context) ([]*models.GridEvent, error) {
+	query := `SELECT ` + gridEventColumns + ` FROM grid_events ORDER BY start_time DESC`
+	return s.queryGridEvents(ctx, query)
+}
+
+// GetPendingGridEvents retrieves grid events that are scheduled or active
+func (s *PostgresStore) GetPendingGridEvents(ctx context.Context) ([]*models.GridEvent, error) {
+	query := `SELECT ` + gridEventColumns + `
+		FROM grid_events
+		WHERE status IN ('Scheduled', 'Active')
+		ORDER BY start_time
+	`
+	return s.queryGridEvents(ctx, query)
+}
+
+func (s *PostgresStore) queryGridEvents(ctx context.Context, query string, args ...interface{}) ([]*models.GridEvent, error) {
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.GridEvent
+	for rows.Next() {
+		event, err := scanGridEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func scanGridEvent(row rowScanner) (*models.GridEvent, error) {
+	event := &models.GridEvent{}
+	err := row.Scan(
+		&event.ID, &event.SiteID, &event.LimitKW, &event.StartTime, &event.EndTime, &event.Status, &event.Source,
+		&event.CreatedAt, &event.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
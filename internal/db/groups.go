@@ -0,0 +1,193 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+const groupColumns = `
+	id, name, frozen, freeze_reason, frozen_by, frozen_at, created_at, updated_at
+`
+
+// SaveGroup creates or updates a group's name, leaving the freeze state untouched
+func (s *PostgresStore) SaveGroup(ctx context.Context, group *models.Group) error {
+	query := `
+		INSERT INTO groups (id, name, created_at, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET
+			name = $2,
+			updated_at = $4
+	`
+
+	now := time.Now()
+	if group.CreatedAt.IsZero() {
+		group.CreatedAt = now
+	}
+	group.UpdatedAt = now
+
+	_, err := s.pool.Exec(ctx, query, group.ID, group.Name, group.CreatedAt, group.UpdatedAt)
+	return err
+}
+
+// GetGroup retrieves a group by its ID
+func (s *PostgresStore) GetGroup(ctx context.Context, id string) (*models.Group, error) {
+	query := `SELECT ` + groupColumns + ` FROM groups WHERE id = $1`
+	return notFound(scanGroup(s.pool.QueryRow(ctx, query, id)))
+}
+
+// GetGroups retrieves all groups
+func (s *PostgresStore) GetGroups(ctx context.Context) ([]*models.Group, error) {
+	query := `SELECT ` + groupColumns + ` FROM groups ORDER BY name`
+	return s.queryGroups(ctx, query)
+}
+
+// GetFrozenGroupsForChargePoint retrieves the frozen groups a charge point belongs to
+func (s *PostgresStore) GetFrozenGroupsForChargePoint(ctx context.Context, chargePointID string) ([]*models.Group, error) {
+	query := `SELECT ` + groupColumns + `
+		FROM groups
+		WHERE frozen = TRUE AND id IN (
+			SELECT group_id FROM group_members WHERE charge_point_id = $1
+		)
+		ORDER BY id
+	`
+	return s.queryGroups(ctx, query, chargePointID)
+}
+
+// SetGroupFrozen freezes or unfreezes a group
+func (s *PostgresStore) SetGroupFrozen(ctx context.Context, id string, frozen bool, reason, actor string) error {
+	query := `
+		UPDATE groups
+		SET frozen = $1,
+			freeze_reason = CASE WHEN $1 THEN $2 END,
+			frozen_by = CASE WHEN $1 THEN $3 END,
+			frozen_at = CASE WHEN $1 THEN $4::timestamptz END,
+			updated_at = $4
+		WHERE id = $5
+	`
+
+	_, err := s.pool.Exec(ctx, query, frozen, reason, actor, time.Now(), id)
+	return err
+}
+
+// AddGroupMember adds a charge point to a group
+func (s *PostgresStore) AddGroupMember(ctx context.Context, groupID, chargePointID string) error {
+	query := `
+		INSERT INTO group_members (group_id, charge_point_id, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`
+
+	_, err := s.pool.Exec(ctx, query, groupID, chargePointID, time.Now())
+	return err
+}
+
+// RemoveGroupMember removes a charge point from a group
+func (s *PostgresStore) RemoveGroupMember(ctx context.Context, groupID, chargePointID string) error {
+	_, err := s.pool.Exec(ctx, `DELETE FROM group_members WHERE group_id = $1 AND charge_point_id = $2`, groupID, chargePointID)
+	return err
+}
+
+// GetGroupMembers retrieves the IDs of the charge points in a group
+func (s *PostgresStore) GetGroupMembers(ctx context.Context, groupID string) ([]string, error) {
+	rows, err := s.pool.Query(ctx, `SELECT charge_point_id FROM group_members WHERE group_id = $1 ORDER BY charge_point_id`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// CreateFreezeOverride stores a new freeze override
+func (s *PostgresStore) CreateFreezeOverride(ctx context.Context, o *models.FreezeOverride) error {
+	query := `
+		INSERT INTO freeze_overrides (
+			group_id, charge_point_id, action, reason, approved_by, valid_until, created_at
+		) VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7)
+		RETURNING id
+	`
+
+	o.CreatedAt = time.Now()
+	return s.pool.QueryRow(ctx, query,
+		o.GroupID, o.ChargePointID, o.Action, o.Reason, o.ApprovedBy, o.ValidUntil, o.CreatedAt,
+	).Scan(&o.ID)
+}
+
+// GetActiveFreezeOverride retrieves a valid override for an action on a charge point in a group
+func (s *PostgresStore) GetActiveFreezeOverride(ctx context.Context, groupID, chargePointID, action string) (*models.FreezeOverride, error) {
+	query := `
+		SELECT id, group_id, COALESCE(charge_point_id, ''), action, reason, approved_by, valid_until, created_at
+		FROM freeze_overrides
+		WHERE group_id = $1 AND action = $2 AND valid_until > $3
+			AND (charge_point_id IS NULL OR charge_point_id = $4)
+		ORDER BY valid_until DESC
+		LIMIT 1
+	`
+
+	o := &models.FreezeOverride{}
+	err := s.pool.QueryRow(ctx, query, groupID, action, time.Now(), chargePointID).Scan(
+		&o.ID, &o.GroupID, &o.ChargePointID, &o.Action, &o.Reason, &o.ApprovedBy, &o.ValidUntil, &o.CreatedAt,
+	)
+	if err != nil {
+		return notFound[*models.FreezeOverride](nil, err)
+	}
+	return o, nil
+}
+
+func (s *PostgresStore) queryGroups(ctx context.Context, query string, args ...interface{}) ([]*models.Group, error) {
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*models.Group
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+func scanGroup(row rowScanner) (*models.Group, error) {
+	group := &models.Group{}
+	var freezeReason, frozenBy sql.NullString
+	var frozenAt sql.NullTime
+	err := row.Scan(
+		&group.ID, &group.Name, &group.Frozen, &freezeReason, &frozenBy, &frozenAt,
+		&group.CreatedAt, &group.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	group.FreezeReason = freezeReason.String
+	group.FrozenBy = frozenBy.String
+	if frozenAt.Valid {
+		group.FrozenAt = frozenAt.Time
+	}
+	return group, nil
+}
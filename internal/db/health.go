@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxConnectBackoff caps the delay between database connection attempts at startup
+const maxConnectBackoff = 30 * time.Second
+
+// monitorHealth pings the database periodically and logs when it becomes unavailable
+// and when it recovers. The pool itself replaces broken connections on its own.
+func (s *PostgresStore) monitorHealth(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	healthy := true
+	var downSince time.Time
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := s.pool.Ping(ctx)
+		cancel()
+
+		switch {
+		case err != nil && healthy:
+			healthy = false
+			downSince = time.Now()
+			logrus.WithError(err).Error("Database connection lost")
+		case err != nil:
+			logrus.WithError(err).WithField("downFor", time.Since(downSince).Round(time.Second)).Warn("Database still unavailable")
+		case !healthy:
+			healthy = true
+			logrus.WithField("downFor", time.Since(downSince).Round(time.Second)).Info("Database connection restored")
+		}
+	}
+}
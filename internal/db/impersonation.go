@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+const impersonationColumns = `
+	id, tenant_id, actor, reason, expires_at, ended_at, created_at
+`
+
+// CreateImpersonationSession stores a new impersonation session with the hash of its token
+func (s *PostgresStore) CreateImpersonationSession(ctx context.Context, session *models.ImpersonationSession) error {
+	query := `
+		INSERT INTO impersonation_sessions (token_hash, tenant_id, actor, reason, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+
+	session.CreatedAt = time.Now()
+	return s.pool.QueryRow(ctx, query,
+		HashAPIKey(session.Token), session.TenantID, session.Actor, session.Reason, session.ExpiresAt, session.CreatedAt,
+	).Scan(&session.ID)
+}
+
+// GetActiveImpersonationSession retrieves the unexpired, unended session matching a token
+func (s *PostgresStore) GetActiveImpersonationSession(ctx context.Context, token string) (*models.ImpersonationSession, error) {
+	query := `SELECT ` + impersonationColumns + `
+		FROM impersonation_sessions
+		WHERE token_hash = $1 AND ended_at IS NULL AND expires_at > $2
+	`
+	return notFound(scanImpersonationSession(s.pool.QueryRow(ctx, query, HashAPIKey(token), time.Now())))
+}
+
+// GetImpersonationSessions retrieves the most recent impersonation sessions
+func (s *PostgresStore) GetImpersonationSessions(ctx context.Context, limit int) ([]*models.ImpersonationSession, error) {
+	query := `SELECT ` + impersonationColumns + `
+		FROM impersonation_sessions
+		ORDER BY created_at DESC
+		LIMIT $1
+	`
+
+	rows, err := s.pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*models.ImpersonationSession
+	for rows.Next() {
+		session, err := scanImpersonationSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// EndImpersonationSession ends an active impersonation session
+func (s *PostgresStore) EndImpersonationSession(ctx context.Context, id int) (*models.ImpersonationSession, error) {
+	query := `
+		UPDATE impersonation_sessions
+		SET ended_at = $1
+		WHERE id = $2 AND ended_at IS NULL
+		RETURNING ` + impersonationColumns
+
+	return notFound(scanImpersonationSession(s.pool.QueryRow(ctx, query, time.Now(), id)))
+}
+
+func scanImpersonationSession(row rowScanner) (*models.ImpersonationSession, error) {
+	session := &models.ImpersonationSession{}
+	var endedAt sql.NullTime
+	err := row.Scan(
+		&session.ID, &session.TenantID, &session.Actor, &session.Reason,
+		&session.ExpiresAt, &endedAt, &session.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if endedAt.Valid {
+		session.EndedAt = endedAt.Time
+	}
+	return session, nil
+}
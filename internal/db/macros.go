@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// SaveMacro creates or updates a command macro
+func (s *PostgresStore) SaveMacro(ctx context.Context, macro *models.Macro) error {
+	query := `
+		INSERT INTO macros (id, name, steps, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET
+			name = $2,
+			steps = $3,
+			updated_at = $5
+	`
+
+	steps, err := json.Marshal(macro.Steps)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if macro.CreatedAt.IsZero() {
+		macro.CreatedAt = now
+	}
+	macro.UpdatedAt = now
+
+	_, err = s.pool.Exec(ctx, query, macro.ID, macro.Name, steps, macro.CreatedAt, macro.UpdatedAt)
+	return err
+}
+
+// GetMacro retrieves a command macro by its ID
+func (s *PostgresStore) GetMacro(ctx context.Context, id string) (*models.Macro, error) {
+	query := `SELECT id, name, steps, created_at, updated_at FROM macros WHERE id = $1`
+	return notFound(scanMacro(s.pool.QueryRow(ctx, query, id)))
+}
+
+// GetMacros retrieves all command macros
+func (s *PostgresStore) GetMacros(ctx context.Context) ([]*models.Macro, error) {
+	query := `SELECT id, name, steps, created_at, updated_at FROM macros ORDER BY name`
+
+	rows, err := s.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var macros []*models.Macro
+	for rows.Next() {
+		macro, err := scanMacro(rows)
+		if err != nil {
+			return nil, err
+		}
+		macros = append(macros, macro)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return macros, nil
+}
+
+// DeleteMacro removes a command macro and its run history
+func (s *PostgresStore) DeleteMacro(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM macros WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanMacro(row rowScanner) (*models.Macro, error) {
+	macro := &models.Macro{}
+	var steps []byte
+	if err := row.Scan(&macro.ID, &macro.Name, &steps, &macro.CreatedAt, &macro.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(steps, &macro.Steps); err != nil {
+		return nil, err
+	}
+	return macro, nil
+}
+
+// CreateMacroRun records the start of a macro run
+func (s *PostgresStore) CreateMacroRun(ctx context.Context, run *models.MacroRun) error {
+	query := `
+		INSERT INTO macro_runs (macro_id, charge_point_ids, status, actor, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`
+
+	run.CreatedAt = time.Now()
+	return s.pool.QueryRow(ctx, query, run.MacroID, run.ChargePointIDs, run.Status, run.Actor, run.CreatedAt).Scan(&run.ID)
+}
+
+// CompleteMacroRun records the final status of a macro run
+func (s *PostgresStore) CompleteMacroRun(ctx context.Context, id int, status string) error {
+	query := `UPDATE macro_runs SET status = $1, completed_at = $2 WHERE id = $3`
+
+	_, err := s.pool.Exec(ctx, query, status, time.Now(), id)
+	return err
+}
+
+// GetMacroRun retrieves a macro run by its ID
+func (s *PostgresStore) GetMacroRun(ctx context.Context, id int) (*models.MacroRun, error) {
+	query := `
+		SELECT id, macro_id, charge_point_ids, status, actor, created_at, completed_at
+		FROM macro_runs
+		WHERE id = $1
+	`
+
+	run := &models.MacroRun{}
+	var completedAt sql.NullTime
+	err := s.pool.QueryRow(ctx, query, id).Scan(
+		&run.ID, &run.MacroID, &run.ChargePointIDs, &run.Status, &run.Actor, &run.CreatedAt, &completedAt,
+	)
+	if err != nil {
+		return notFound[*models.MacroRun](nil, err)
+	}
+	if completedAt.Valid {
+		run.CompletedAt = completedAt.Time
+	}
+	return run, nil
+}
@@ -0,0 +1,1520 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// MemoryStore keeps all data in process memory, for local development, demos and tests without Postgres.
+// It mirrors the behavior of PostgresStore, including tenant scoping and ErrNotFound for missing rows.
+// Everything is lost when the process exits.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	lastID map[string]int // Last generated ID per table
+
+	chargePoints    map[string]*models.ChargePoint
+	connectors      map[string]map[int]*models.Connector // Charge point ID -> connector ID
+	statusEvents    []*models.ConnectorStatusEvent
+	connectionLog   []*models.ConnectionEvent
+	transactions    map[int]*models.Transaction
+	pendingSessions map[[2]string]*pendingSession // Charge point ID and idTag
+	meterValues     []*models.MeterValue
+	ocppMessages    []*models.OCPPMessage
+	quarantine      []*models.QuarantinedMessage
+	connections     map[string]*connectionOwner
+
+	commands        map[int]*models.Command
+	macros          map[string]*models.Macro
+	macroRuns       map[int]*models.MacroRun
+	firmwareUpdates map[int]*models.FirmwareUpdate
+	spotPrices      map[string]*models.SpotPrice       // Price area and hour
+	carbon          map[string]*models.CarbonIntensity // Price area and hour
+	alertRules      map[string]*models.AlertRule
+	alerts          []*models.Alert
+	sites           map[string]*models.Site
+	gridEvents      map[string]*models.GridEvent
+	groups          map[string]*models.Group
+	groupMembers    map[string]map[string]bool // Group ID -> charge point IDs
+	freezeOverrides []*models.FreezeOverride
+	tenants         map[string]*models.Tenant
+	addressRules    map[string]*models.AddressRule
+	upstreams       map[string]*models.UpstreamGateway
+	upstreamTxIDs   map[int]int       // Transaction ID -> ID assigned by the upstream central system
+	passwordHashes  map[string]string // Charge point ID -> hash of its basic auth password
+	rotations       []*models.CredentialRotation
+	apiKeys         []*hashedAPIKey
+	idTags          map[[2]string]*models.IdTag // Tenant ID and idTag
+	impersonations  []*hashedImpersonationSession
+	auditLog        []*models.AuditEntry
+	erasures        []*models.Erasure
+}
+
+type pendingSession struct {
+	sessionID string
+	createdAt time.Time
+}
+
+type connectionOwner struct {
+	instanceID  string
+	instanceURL string
+}
+
+type hashedAPIKey struct {
+	models.APIKey
+	hash string
+}
+
+type hashedImpersonationSession struct {
+	models.ImpersonationSession
+	hash string
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		lastID:          make(map[string]int),
+		chargePoints:    make(map[string]*models.ChargePoint),
+		connectors:      make(map[string]map[int]*models.Connector),
+		transactions:    make(map[int]*models.Transaction),
+		pendingSessions: make(map[[2]string]*pendingSession),
+		connections:     make(map[string]*connectionOwner),
+		commands:        make(map[int]*models.Command),
+		macros:          make(map[string]*models.Macro),
+		macroRuns:       make(map[int]*models.MacroRun),
+		firmwareUpdates: make(map[int]*models.FirmwareUpdate),
+		spotPrices:      make(map[string]*models.SpotPrice),
+		carbon:          make(map[string]*models.CarbonIntensity),
+		alertRules:      make(map[string]*models.AlertRule),
+		sites:           make(map[string]*models.Site),
+		gridEvents:      make(map[string]*models.GridEvent),
+		groups:          make(map[string]*models.Group),
+		groupMembers:    make(map[string]map[string]bool),
+		tenants:         make(map[string]*models.Tenant),
+		addressRules:    make(map[string]*models.AddressRule),
+		upstreams:       make(map[string]*models.UpstreamGateway),
+		upstreamTxIDs:   make(map[int]int),
+		passwordHashes:  make(map[string]string),
+		idTags:          make(map[[2]string]*models.IdTag),
+	}
+}
+
+// Close releases nothing, the data is dropped with the store
+func (s *MemoryStore) Close() {}
+
+// nextID returns the next serial ID of a table
+func (s *MemoryStore) nextID(table string) int {
+	s.lastID[table]++
+	return s.lastID[table]
+}
+
+// inScope reports whether a row of a tenant is visible in the context's tenant scope
+func inScope(ctx context.Context, tenantID string) bool {
+	scope := TenantFromContext(ctx)
+	return scope == "" || scope == tenantID
+}
+
+// chargePointInScope reports whether a charge point exists and is visible in the context's tenant scope
+func (s *MemoryStore) chargePointInScope(ctx context.Context, chargePointID string) bool {
+	cp, ok := s.chargePoints[chargePointID]
+	return ok && inScope(ctx, cp.TenantID)
+}
+
+// SaveChargePoint creates or updates a charge point, keeping its site, tenant and free vend mode
+func (s *MemoryStore) SaveChargePoint(ctx context.Context, cp *models.ChargePoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if cp.CreatedAt.IsZero() {
+		cp.CreatedAt = now
+	}
+	cp.UpdatedAt = now
+
+	stored := *cp
+	if existing, ok := s.chargePoints[cp.ID]; ok {
+		stored.CreatedAt = existing.CreatedAt
+		stored.SiteID = existing.SiteID
+		stored.TenantID = existing.TenantID
+		stored.FreeVend = existing.FreeVend
+		stored.SpotOptOut = existing.SpotOptOut
+		if existing.IsConnected || !cp.IsConnected {
+			stored.ConnectedSince = existing.ConnectedSince
+		}
+	} else {
+		stored.SiteID = ""
+		stored.TenantID = ""
+		stored.FreeVend = false
+		stored.SpotOptOut = false
+	}
+	s.chargePoints[cp.ID] = &stored
+	return nil
+}
+
+// GetChargePoint retrieves a charge point by its ID
+func (s *MemoryStore) GetChargePoint(ctx context.Context, id string) (*models.ChargePoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.chargePointInScope(ctx, id) {
+		return nil, ErrNotFound
+	}
+	cp := *s.chargePoints[id]
+	return &cp, nil
+}
+
+// GetChargePoints retrieves a page of the charge points matching a filter, newest first unless sorted otherwise,
+// and the total number of matching charge points
+func (s *MemoryStore) GetChargePoints(ctx context.Context, filter ChargePointFilter, order Sort, page Page) ([]*models.ChargePoint, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var chargePoints []*models.ChargePoint
+	for _, stored := range s.chargePoints {
+		if inScope(ctx, stored.TenantID) && matchChargePoint(stored, filter) {
+			cp := *stored
+			chargePoints = append(chargePoints, &cp)
+		}
+	}
+
+	if order.Field == "" {
+		sort.Slice(chargePoints, func(i, j int) bool {
+			if !chargePoints[i].CreatedAt.Equal(chargePoints[j].CreatedAt) {
+				return chargePoints[i].CreatedAt.After(chargePoints[j].CreatedAt)
+			}
+			return chargePoints[i].ID < chargePoints[j].ID
+		})
+	} else if err := sortItems(chargePoints, order, chargePointFields); err != nil {
+		return nil, 0, err
+	}
+	return pageSlice(chargePoints, page), len(chargePoints), nil
+}
+
+func matchChargePoint(cp *models.ChargePoint, filter ChargePointFilter) bool {
+	return (filter.IsConnected == nil || cp.IsConnected == *filter.IsConnected) &&
+		(filter.Vendor == "" || cp.Vendor == filter.Vendor) &&
+		(filter.Model == "" || cp.Model == filter.Model) &&
+		(filter.FirmwareVersion == "" || cp.FirmwareVersion == filter.FirmwareVersion) &&
+		(filter.RegistrationStatus == "" || cp.RegistrationStatus == filter.RegistrationStatus) &&
+		(filter.SiteID == "" || cp.SiteID == filter.SiteID) &&
+		(!filter.ClockDriftFlagged || cp.ClockDriftFlagged) &&
+		(!filter.RebootLooping || !cp.RebootLoopSince.IsZero())
+}
+
+// chargePointFields compares charge points by their sortable fields, like chargePointSortColumns
+var chargePointFields = map[string]func(a, b *models.ChargePoint) int{
+	"id":                 func(a, b *models.ChargePoint) int { return strings.Compare(a.ID, b.ID) },
+	"vendor":             func(a, b *models.ChargePoint) int { return strings.Compare(a.Vendor, b.Vendor) },
+	"model":              func(a, b *models.ChargePoint) int { return strings.Compare(a.Model, b.Model) },
+	"firmwareVersion":    func(a, b *models.ChargePoint) int { return strings.Compare(a.FirmwareVersion, b.FirmwareVersion) },
+	"registrationStatus": func(a, b *models.ChargePoint) int { return strings.Compare(a.RegistrationStatus, b.RegistrationStatus) },
+	"isConnected":        func(a, b *models.ChargePoint) int { return compareBools(a.IsConnected, b.IsConnected) },
+	"lastHeartbeat":      func(a, b *models.ChargePoint) int { return compareTimes(a.LastHeartbeat, b.LastHeartbeat) },
+	"connectedSince":     func(a, b *models.ChargePoint) int { return compareTimes(a.ConnectedSince, b.ConnectedSince) },
+	"createdAt":          func(a, b *models.ChargePoint) int { return compareTimes(a.CreatedAt, b.CreatedAt) },
+	"updatedAt":          func(a, b *models.ChargePoint) int { return compareTimes(a.UpdatedAt, b.UpdatedAt) },
+}
+
+// UpdateChargePointConnection updates the connection status of a charge point
+func (s *MemoryStore) UpdateChargePointConnection(ctx context.Context, id string, connected bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cp, ok := s.chargePoints[id]; ok {
+		now := time.Now()
+		cp.IsConnected = connected
+		if connected {
+			cp.ConnectedSince = now
+		}
+		cp.UpdatedAt = now
+	}
+	return nil
+}
+
+// UpdateClockDrift records the measured clock drift of a charge point and whether it exceeds the threshold
+func (s *MemoryStore) UpdateClockDrift(ctx context.Context, id string, drift time.Duration, flagged bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cp, ok := s.chargePoints[id]; ok {
+		cp.ClockDriftMs = drift.Milliseconds()
+		cp.ClockDriftAt = time.Now()
+		cp.ClockDriftFlagged = flagged
+	}
+	return nil
+}
+
+// UpdateRebootLoop records the start of a charge point's reboot loop, a zero time records that it ended
+func (s *MemoryStore) UpdateRebootLoop(ctx context.Context, id string, since time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cp, ok := s.chargePoints[id]; ok {
+		cp.RebootLoopSince = since
+	}
+	return nil
+}
+
+// UpdateHeartbeat updates the last heartbeat time of a charge point
+func (s *MemoryStore) UpdateHeartbeat(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cp, ok := s.chargePoints[id]; ok {
+		now := time.Now()
+		cp.LastHeartbeat = now
+		cp.UpdatedAt = now
+	}
+	return nil
+}
+
+// isOccupied reports whether a vehicle is plugged in in a connector status, see occupiedStatuses
+func isOccupied(status string) bool {
+	switch status {
+	case "Preparing", "Charging", "SuspendedEV", "SuspendedEVSE", "Finishing":
+		return true
+	}
+	return false
+}
+
+// SaveConnector creates or updates a connector, tracking the plug-in and status times like PostgresStore
+func (s *MemoryStore) SaveConnector(ctx context.Context, connector *models.Connector) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if connector.CreatedAt.IsZero() {
+		connector.CreatedAt = now
+	}
+	connector.UpdatedAt = now
+
+	connectors, ok := s.connectors[connector.ChargePointID]
+	if !ok {
+		connectors = make(map[int]*models.Connector)
+		s.connectors[connector.ChargePointID] = connectors
+	}
+
+	stored := *connector
+	stored.OccupiedSince = time.Time{}
+	stored.StatusSince = now
+	if existing, ok := connectors[connector.ID]; ok {
+		stored.CreatedAt = existing.CreatedAt
+		stored.OccupiedSince = existing.OccupiedSince
+		if existing.Status == stored.Status && !existing.StatusSince.IsZero() {
+			stored.StatusSince = existing.StatusSince
+		}
+		stored.PlugType, stored.Format = existing.PlugType, existing.Format
+		stored.MaxPowerKW, stored.Phases = existing.MaxPowerKW, existing.Phases
+	}
+	if !isOccupied(stored.Status) {
+		stored.OccupiedSince = time.Time{}
+	} else if stored.OccupiedSince.IsZero() {
+		stored.OccupiedSince = now
+	}
+	connectors[connector.ID] = &stored
+	return nil
+}
+
+// TouchConnector records that a connector confirmed its stored status, without changing it
+func (s *MemoryStore) TouchConnector(ctx context.Context, chargePointID string, connectorID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if connector, ok := s.connectors[chargePointID][connectorID]; ok {
+		connector.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// SaveConnectorAttributes updates the operator-maintained attributes of a connector. Connectors that have not
+// reported a status yet are created with status Unknown.
+func (s *MemoryStore) SaveConnectorAttributes(ctx context.Context, connector *models.Connector) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.chargePoints[connector.ChargePointID]; !ok {
+		return ErrNotFound
+	}
+
+	connectors, ok := s.connectors[connector.ChargePointID]
+	if !ok {
+		connectors = make(map[int]*models.Connector)
+		s.connectors[connector.ChargePointID] = connectors
+	}
+
+	now := time.Now()
+	stored, ok := connectors[connector.ID]
+	if !ok {
+		stored = &models.Connector{
+			ID:            connector.ID,
+			ChargePointID: connector.ChargePointID,
+			Status:        "Unknown",
+			ErrorCode:     "NoError",
+			CreatedAt:     now,
+		}
+		connectors[connector.ID] = stored
+	}
+	stored.PlugType, stored.Format = connector.PlugType, connector.Format
+	stored.MaxPowerKW, stored.Phases = connector.MaxPowerKW, connector.Phases
+	stored.UpdatedAt = now
+	connector.UpdatedAt = now
+	return nil
+}
+
+// CreateMissingConnectors creates the connectors numbered 1 to count of a charge point that do not exist yet,
+// with status Unknown, and returns the number created
+func (s *MemoryStore) CreateMissingConnectors(ctx context.Context, chargePointID string, count int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	connectors, ok := s.connectors[chargePointID]
+	if !ok {
+		connectors = make(map[int]*models.Connector)
+		s.connectors[chargePointID] = connectors
+	}
+
+	now := time.Now()
+	created := 0
+	for id := 1; id <= count; id++ {
+		if _, ok := connectors[id]; ok {
+			continue
+		}
+		connectors[id] = &models.Connector{
+			ID:            id,
+			ChargePointID: chargePointID,
+			Status:        "Unknown",
+			ErrorCode:     "NoError",
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		created++
+	}
+	return created, nil
+}
+
+// GetConnectors retrieves a page of the connectors of a charge point, ordered by ID, and the total number of its connectors
+func (s *MemoryStore) GetConnectors(ctx context.Context, chargePointID string, page Page) ([]*models.Connector, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.chargePointInScope(ctx, chargePointID) {
+		return nil, 0, nil
+	}
+
+	var connectors []*models.Connector
+	for _, stored := range s.connectors[chargePointID] {
+		c := *stored
+		connectors = append(connectors, &c)
+	}
+	sort.Slice(connectors, func(i, j int) bool { return connectors[i].ID < connectors[j].ID })
+	return pageSlice(connectors, page), len(connectors), nil
+}
+
+// GetFaultedConnectors retrieves the connectors of all charge points that are Faulted or report an error code
+func (s *MemoryStore) GetFaultedConnectors(ctx context.Context) ([]*models.Connector, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var connectors []*models.Connector
+	for _, cpConnectors := range s.connectors {
+		for _, stored := range cpConnectors {
+			if stored.Status == "Faulted" || stored.ErrorCode != "NoError" {
+				c := *stored
+				connectors = append(connectors, &c)
+			}
+		}
+	}
+	sort.Slice(connectors, func(i, j int) bool {
+		if connectors[i].ChargePointID != connectors[j].ChargePointID {
+			return connectors[i].ChargePointID < connectors[j].ChargePointID
+		}
+		return connectors[i].ID < connectors[j].ID
+	})
+	return connectors, nil
+}
+
+// GetConnectorsByStatus retrieves the connectors of all charge points in a status
+func (s *MemoryStore) GetConnectorsByStatus(ctx context.Context, status string) ([]*models.Connector, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var connectors []*models.Connector
+	for _, cpConnectors := range s.connectors {
+		for _, stored := range cpConnectors {
+			if stored.Status == status {
+				c := *stored
+				connectors = append(connectors, &c)
+			}
+		}
+	}
+	sort.Slice(connectors, func(i, j int) bool {
+		if connectors[i].ChargePointID != connectors[j].ChargePointID {
+			return connectors[i].ChargePointID < connectors[j].ChargePointID
+		}
+		return connectors[i].ID < connectors[j].ID
+	})
+	return connectors, nil
+}
+
+// CreateConnectorStatusEvent records a status notification of a connector
+func (s *MemoryStore) CreateConnectorStatusEvent(ctx context.Context, event *models.ConnectorStatusEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event.CreatedAt = time.Now()
+	if event.Timestamp.IsZero() {
+		event.Timestamp = event.CreatedAt
+	}
+	event.ID = s.nextID("connector_status_events")
+
+	stored := *event
+	s.statusEvents = append(s.statusEvents, &stored)
+	return nil
+}
+
+// GetConnectorStatusEvents retrieves the most recent status notifications of a charge point
+func (s *MemoryStore) GetConnectorStatusEvents(ctx context.Context, chargePointID string, connectorID int, errorsOnly bool, limit int) ([]*models.ConnectorStatusEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []*models.ConnectorStatusEvent
+	for _, stored := range s.statusEvents {
+		if stored.ChargePointID != chargePointID ||
+			(connectorID != 0 && stored.ConnectorID != connectorID) ||
+			(errorsOnly && stored.ErrorCode == "NoError") {
+			continue
+		}
+		e := *stored
+		events = append(events, &e)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.After(events[j].Timestamp) })
+	return limitSlice(events, limit), nil
+}
+
+// CreateConnectionEvent records a websocket connection of a charge point and stores its metadata on the charge point
+func (s *MemoryStore) CreateConnectionEvent(ctx context.Context, event *models.ConnectionEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event.ConnectedAt.IsZero() {
+		event.ConnectedAt = time.Now()
+	}
+	s.closeConnectionEvents(event.ChargePointID, event.ConnectedAt)
+	event.ID = s.nextID("charge_point_connections")
+
+	stored := *event
+	s.connectionLog = append(s.connectionLog, &stored)
+
+	if cp, ok := s.chargePoints[event.ChargePointID]; ok {
+		cp.RemoteAddr = event.RemoteAddr
+		cp.Subprotocol = event.Subprotocol
+		cp.ConnectionHeaders = event.Headers
+	}
+	return nil
+}
+
+// CloseConnectionEvent records the end of a charge point's open connection
+func (s *MemoryStore) CloseConnectionEvent(ctx context.Context, chargePointID string, disconnectedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closeConnectionEvents(chargePointID, disconnectedAt)
+	return nil
+}
+
+func (s *MemoryStore) closeConnectionEvents(chargePointID string, disconnectedAt time.Time) {
+	for _, stored := range s.connectionLog {
+		if stored.ChargePointID == chargePointID && stored.DisconnectedAt.IsZero() {
+			stored.DisconnectedAt = disconnectedAt
+		}
+	}
+}
+
+// GetConnectionEvents retrieves the most recent connections of a charge point
+func (s *MemoryStore) GetConnectionEvents(ctx context.Context, chargePointID string, limit int) ([]*models.ConnectionEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []*models.ConnectionEvent
+	for _, stored := range s.connectionLog {
+		if stored.ChargePointID != chargePointID {
+			continue
+		}
+		e := *stored
+		events = append(events, &e)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].ConnectedAt.After(events[j].ConnectedAt) })
+	return limitSlice(events, limit), nil
+}
+
+// StartTransaction starts a new charging transaction owned by the charge point's tenant and sets its ID
+func (s *MemoryStore) StartTransaction(ctx context.Context, tx *models.Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if tx.CreatedAt.IsZero() {
+		tx.CreatedAt = now
+	}
+	tx.UpdatedAt = now
+	tx.ID = 1000 + s.nextID("transactions")
+
+	stored := *tx
+	stored.TenantID = ""
+	if cp, ok := s.chargePoints[tx.ChargePointID]; ok {
+		stored.TenantID = cp.TenantID
+	}
+	s.transactions[tx.ID] = &stored
+	return nil
+}
+
+// StopTransaction updates a transaction when it's stopped, keeping an auto-stop reason recorded by the CPMS
+func (s *MemoryStore) StopTransaction(ctx context.Context, id int, endTime time.Time, meterStop int, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tx, ok := s.transactions[id]; ok {
+		tx.EndTime = endTime
+		tx.MeterStop = meterStop
+		tx.Status = "Completed"
+		if tx.StopReason == "" {
+			tx.StopReason = reason
+		}
+		if tx.EndSoC == 0 {
+			tx.EndSoC = tx.CurrentSoC
+		}
+		tx.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// RecordTransactionSoC records a state of charge reading of a transaction, the first one is its start SoC
+func (s *MemoryStore) RecordTransactionSoC(ctx context.Context, id int, soc float64, end bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tx, ok := s.transactions[id]; ok {
+		if tx.StartSoC == 0 {
+			tx.StartSoC = soc
+		}
+		tx.CurrentSoC = soc
+		if end {
+			tx.EndSoC = soc
+		}
+		tx.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// FlagAdjustedTimestamp marks a transaction as having an implausible timestamp replaced, and flags it for billing review
+func (s *MemoryStore) FlagAdjustedTimestamp(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tx, ok := s.transactions[id]; ok {
+		tx.TimestampAdjusted = true
+		tx.BillingReview = true
+		tx.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// FindStartedTransaction retrieves the transaction started with the given StartTransaction values, to detect retransmissions.
+// Start times replaced by the timestamp policy are matched by the start timestamp the charge point reported.
+func (s *MemoryStore) FindStartedTransaction(ctx context.Context, chargePointID string, connectorID int, idTag string, startTime time.Time, meterStart int) (*models.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found *models.Transaction
+	for _, stored := range s.transactions {
+		reported := stored.StartTime
+		if !stored.ReportedStartTime.IsZero() {
+			reported = stored.ReportedStartTime
+		}
+		if stored.ChargePointID == chargePointID && stored.ConnectorID == connectorID && stored.IdTag == idTag &&
+			reported.Equal(startTime) && stored.MeterStart == meterStart && (found == nil || stored.ID < found.ID) {
+			found = stored
+		}
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	tx := *found
+	return &tx, nil
+}
+
+// GetOrphanedTransactions retrieves the in-progress transactions started before cutoff without a meter value
+// or a heartbeat of their charge point since, oldest first
+func (s *MemoryStore) GetOrphanedTransactions(ctx context.Context, cutoff time.Time) ([]*models.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := make(map[int]bool)
+	for _, mv := range s.meterValues {
+		if !mv.Timestamp.Before(cutoff) {
+			active[mv.TransactionID] = true
+		}
+	}
+
+	var transactions []*models.Transaction
+	for _, stored := range s.transactions {
+		if stored.Status != "InProgress" || !stored.StartTime.Before(cutoff) || active[stored.ID] {
+			continue
+		}
+		if cp, ok := s.chargePoints[stored.ChargePointID]; ok && !cp.LastHeartbeat.Before(cutoff) {
+			continue
+		}
+		tx := *stored
+		transactions = append(transactions, &tx)
+	}
+	sort.Slice(transactions, func(i, j int) bool { return transactions[i].StartTime.Before(transactions[j].StartTime) })
+	return transactions, nil
+}
+
+// CloseOrphanedTransaction closes an in-progress transaction the charge point never stopped with the Orphaned status.
+// It reports false if the transaction is no longer in progress.
+func (s *MemoryStore) CloseOrphanedTransaction(ctx context.Context, id int, endTime time.Time, meterStop int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, ok := s.transactions[id]
+	if !ok || tx.Status != "InProgress" {
+		return false, nil
+	}
+	tx.EndTime = endTime
+	tx.MeterStop = meterStop
+	tx.Status = "Orphaned"
+	tx.UpdatedAt = time.Now()
+	return true, nil
+}
+
+// ReconcileTransaction completes an in-progress transaction the charge point no longer has and flags it for billing review.
+// It reports false if the transaction is no longer in progress.
+func (s *MemoryStore) ReconcileTransaction(ctx context.Context, id int, endTime time.Time, meterStop int, reason string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, ok := s.transactions[id]
+	if !ok || tx.Status != "InProgress" {
+		return false, nil
+	}
+	tx.EndTime = endTime
+	tx.MeterStop = meterStop
+	tx.Status = "Completed"
+	if tx.StopReason == "" {
+		tx.StopReason = reason
+	}
+	tx.BillingReview = true
+	tx.UpdatedAt = time.Now()
+	return true, nil
+}
+
+// GetTransaction retrieves a transaction by ID
+func (s *MemoryStore) GetTransaction(ctx context.Context, id int) (*models.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.transactions[id]
+	if !ok || !inScope(ctx, stored.TenantID) {
+		return nil, ErrNotFound
+	}
+	tx := *stored
+	return &tx, nil
+}
+
+// SetTransactionLimits sets the cost and energy caps of an in-progress transaction, 0 removes a cap
+func (s *MemoryStore) SetTransactionLimits(ctx context.Context, id int, maxCost, maxEnergy float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, ok := s.transactions[id]
+	if !ok || tx.Status != "InProgress" || !inScope(ctx, tx.TenantID) {
+		return ErrNotFound
+	}
+	tx.MaxCost = maxCost
+	tx.MaxEnergy = maxEnergy
+	tx.UpdatedAt = time.Now()
+	return nil
+}
+
+// SetTransactionDeparture sets the energy an in-progress transaction needs by its departure time.
+// A zero target energy removes the departure schedule.
+func (s *MemoryStore) SetTransactionDeparture(ctx context.Context, id int, targetEnergy float64, departure time.Time, priceOptimized bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, ok := s.transactions[id]
+	if !ok || tx.Status != "InProgress" || !inScope(ctx, tx.TenantID) {
+		return ErrNotFound
+	}
+	if targetEnergy == 0 {
+		departure, priceOptimized = time.Time{}, false
+	}
+	tx.TargetEnergy = targetEnergy
+	tx.DepartureTime = departure
+	tx.PriceOptimized = priceOptimized
+	tx.UpdatedAt = time.Now()
+	return nil
+}
+
+// SetTransactionStopReason records why the CPMS stopped a transaction, an empty reason clears it
+func (s *MemoryStore) SetTransactionStopReason(ctx context.Context, id int, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tx, ok := s.transactions[id]; ok {
+		tx.StopReason = reason
+		tx.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// SetTransactionVehicle records the identifiers of the vehicle charged in a transaction.
+// Empty identifiers keep the recorded ones.
+func (s *MemoryStore) SetTransactionVehicle(ctx context.Context, id int, mac, vin string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, ok := s.transactions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if mac != "" {
+		tx.VehicleMAC = mac
+	}
+	if vin != "" {
+		tx.VehicleVIN = vin
+	}
+	tx.UpdatedAt = time.Now()
+	return nil
+}
+
+// GetTransactions retrieves a page of the transactions matching a filter, most recently started first
+// unless sorted otherwise, and the total number of matching transactions
+func (s *MemoryStore) GetTransactions(ctx context.Context, filter TransactionFilter, order Sort, page Page) ([]*models.Transaction, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var transactions []*models.Transaction
+	for _, stored := range s.transactions {
+		if inScope(ctx, stored.TenantID) && matchTransaction(stored, filter) {
+			tx := *stored
+			transactions = append(transactions, &tx)
+		}
+	}
+
+	if order.Field == "" {
+		sort.Slice(transactions, func(i, j int) bool {
+			if !transactions[i].StartTime.Equal(transactions[j].StartTime) {
+				return transactions[i].StartTime.After(transactions[j].StartTime)
+			}
+			return transactions[i].ID > transactions[j].ID
+		})
+	} else if err := sortItems(transactions, order, transactionFields); err != nil {
+		return nil, 0, err
+	}
+	return pageSlice(transactions, page), len(transactions), nil
+}
+
+func matchTransaction(tx *models.Transaction, filter TransactionFilter) bool {
+	return (filter.ChargePointID == "" || tx.ChargePointID == filter.ChargePointID) &&
+		(filter.ConnectorID <= 0 || tx.ConnectorID == filter.ConnectorID) &&
+		(filter.IdTag == "" || tx.IdTag == filter.IdTag) &&
+		(filter.Status == "" || tx.Status == filter.Status) &&
+		(!filter.BillingReview || tx.BillingReview) &&
+		(filter.VehicleVIN == "" || tx.VehicleVIN == filter.VehicleVIN) &&
+		(filter.From.IsZero() || !tx.StartTime.Before(filter.From)) &&
+		(filter.To.IsZero() || tx.StartTime.Before(filter.To))
+}
+
+// transactionFields compares transactions by their sortable fields, like transactionSortColumns
+var transactionFields = map[string]func(a, b *models.Transaction) int{
+	"id":            func(a, b *models.Transaction) int { return compareInts(a.ID, b.ID) },
+	"chargePointId": func(a, b *models.Transaction) int { return strings.Compare(a.ChargePointID, b.ChargePointID) },
+	"connectorId":   func(a, b *models.Transaction) int { return compareInts(a.ConnectorID, b.ConnectorID) },
+	"idTag":         func(a, b *models.Transaction) int { return strings.Compare(a.IdTag, b.IdTag) },
+	"status":        func(a, b *models.Transaction) int { return strings.Compare(a.Status, b.Status) },
+	"startTime":     func(a, b *models.Transaction) int { return compareTimes(a.StartTime, b.StartTime) },
+	"endTime":       func(a, b *models.Transaction) int { return compareTimes(a.EndTime, b.EndTime) },
+	"meterStart":    func(a, b *models.Transaction) int { return compareInts(a.MeterStart, b.MeterStart) },
+	"meterStop":     func(a, b *models.Transaction) int { return compareInts(a.MeterStop, b.MeterStop) },
+}
+
+// StreamTransactions calls fn for every transaction started in [from, to) within the context's tenant scope
+func (s *MemoryStore) StreamTransactions(ctx context.Context, from, to time.Time, fn func(*models.Transaction) error) error {
+	s.mu.Lock()
+	var transactions []*models.Transaction
+	for _, stored := range s.transactions {
+		if inScope(ctx, stored.TenantID) && inRange(stored.StartTime, from, to) {
+			tx := *stored
+			transactions = append(transactions, &tx)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(transactions, func(i, j int) bool {
+		if !transactions[i].StartTime.Equal(transactions[j].StartTime) {
+			return transactions[i].StartTime.Before(transactions[j].StartTime)
+		}
+		return transactions[i].ID < transactions[j].ID
+	})
+
+	for _, tx := range transactions {
+		if err := fn(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenPendingSession records a session waiting for a charge point to start a transaction for an idTag
+func (s *MemoryStore) OpenPendingSession(ctx context.Context, chargePointID, idTag, sessionID string, replace bool) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	key := [2]string{chargePointID, idTag}
+	if pending, ok := s.pendingSessions[key]; ok && !replace && !pending.createdAt.Before(now.Add(-PendingSessionTTL)) {
+		return pending.sessionID, nil
+	}
+
+	s.pendingSessions[key] = &pendingSession{sessionID: sessionID, createdAt: now}
+	return sessionID, nil
+}
+
+// ClaimPendingSession removes and returns the unexpired pending session of an idTag on a charge point
+func (s *MemoryStore) ClaimPendingSession(ctx context.Context, chargePointID, idTag string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := [2]string{chargePointID, idTag}
+	pending, ok := s.pendingSessions[key]
+	if !ok {
+		return "", nil
+	}
+	delete(s.pendingSessions, key)
+
+	if pending.createdAt.Before(time.Now().Add(-PendingSessionTTL)) {
+		return "", nil
+	}
+	return pending.sessionID, nil
+}
+
+// GetTransactionBySession retrieves the transaction of a session within the context's tenant scope
+func (s *MemoryStore) GetTransactionBySession(ctx context.Context, sessionID string) (*models.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.transactions {
+		if stored.SessionID == sessionID && sessionID != "" && inScope(ctx, stored.TenantID) {
+			tx := *stored
+			return &tx, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// SaveMeterValue saves a meter reading
+func (s *MemoryStore) SaveMeterValue(ctx context.Context, mv *models.MeterValue) error {
+	return s.SaveMeterValues(ctx, []*models.MeterValue{mv})
+}
+
+// SaveMeterValues saves the readings of a MeterValues message, tagged with the session of their transaction
+func (s *MemoryStore) SaveMeterValues(ctx context.Context, batch []*models.MeterValue) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, mv := range batch {
+		mv.SessionID = ""
+		if tx, ok := s.transactions[mv.TransactionID]; ok {
+			mv.SessionID = tx.SessionID
+		}
+
+		stored := *mv
+		stored.ID = s.nextID("meter_values")
+		stored.CreatedAt = now
+		s.meterValues = append(s.meterValues, &stored)
+	}
+	return nil
+}
+
+// queryMeterValues returns copies of the meter values matching a filter, ordered by timestamp and ID
+func (s *MemoryStore) queryMeterValues(match func(*models.MeterValue) bool) []*models.MeterValue {
+	var meterValues []*models.MeterValue
+	for _, stored := range s.meterValues {
+		if match(stored) {
+			mv := *stored
+			meterValues = append(meterValues, &mv)
+		}
+	}
+	sort.SliceStable(meterValues, func(i, j int) bool {
+		if !meterValues[i].Timestamp.Equal(meterValues[j].Timestamp) {
+			return meterValues[i].Timestamp.Before(meterValues[j].Timestamp)
+		}
+		return meterValues[i].ID < meterValues[j].ID
+	})
+	return meterValues
+}
+
+// GetTransactionMeterValues retrieves the meter values of a transaction for a measurand, leaving out the
+// per-phase readings
+func (s *MemoryStore) GetTransactionMeterValues(ctx context.Context, transactionID int, measurand string) ([]*models.MeterValue, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.queryMeterValues(func(mv *models.MeterValue) bool {
+		return mv.TransactionID == transactionID && mv.Measurand == measurand && mv.Phase == ""
+	}), nil
+}
+
+// GetLatestMeterValues retrieves the most recent meter value for a measurand of each of the transactions, by transaction ID.
+// An empty measurand selects the most recent meter value of any measurand.
+func (s *MemoryStore) GetLatestMeterValues(ctx context.Context, transactionIDs []int, measurand string) (map[int]*models.MeterValue, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[int]bool, len(transactionIDs))
+	for _, id := range transactionIDs {
+		wanted[id] = true
+	}
+
+	// Meter values are returned in order, so the last one of each transaction wins
+	latest := make(map[int]*models.MeterValue)
+	for _, mv := range s.queryMeterValues(func(mv *models.MeterValue) bool {
+		return wanted[mv.TransactionID] && (measurand == "" || mv.Measurand == measurand)
+	}) {
+		latest[mv.TransactionID] = mv
+	}
+	return latest, nil
+}
+
+// GetTransactionMeterStats derives the highest energy register reading and the peak power of each of the transactions
+// from their meter values, by transaction ID. Transactions without meter values are left out.
+func (s *MemoryStore) GetTransactionMeterStats(ctx context.Context, transactionIDs []int) (map[int]*models.TransactionMeterStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[int]bool, len(transactionIDs))
+	for _, id := range transactionIDs {
+		wanted[id] = true
+	}
+
+	// Power readings are combined per timestamp, the total if reported, otherwise the sum of the phases
+	type powerKey struct {
+		transactionID int
+		at            int64
+	}
+	totals := make(map[powerKey]float64)
+	phases := make(map[powerKey]float64)
+	energyKW := make(map[int]float64)
+	previous := make(map[int]*models.MeterValue)
+
+	stats := make(map[int]*models.TransactionMeterStats)
+	for _, mv := range s.queryMeterValues(func(mv *models.MeterValue) bool {
+		return wanted[mv.TransactionID] && (mv.Measurand == "Power.Active.Import" ||
+			mv.Measurand == "Energy.Active.Import.Register" && mv.Phase == "")
+	}) {
+		st, ok := stats[mv.TransactionID]
+		if !ok {
+			st = &models.TransactionMeterStats{TransactionID: mv.TransactionID}
+			stats[mv.TransactionID] = st
+		}
+
+		if mv.Measurand == "Power.Active.Import" {
+			kw := mv.Value / 1000
+			if mv.Unit == "kW" {
+				kw = mv.Value
+			}
+			key := powerKey{mv.TransactionID, mv.Timestamp.UnixNano()}
+			if mv.Phase != "" {
+				phases[key] += kw
+			} else if total, ok := totals[key]; !ok || kw > total {
+				totals[key] = kw
+			}
+			continue
+		}
+
+		wh := mv.EnergyWh()
+		if wh > st.EnergyRegisterWh {
+			st.EnergyRegisterWh = wh
+		}
+		if prev, ok := previous[mv.TransactionID]; ok {
+			if hours := mv.Timestamp.Sub(prev.Timestamp).Hours(); hours > 0 {
+				kw := (wh - prev.EnergyWh()) / 1000 / hours
+				if current, ok := energyKW[mv.TransactionID]; !ok || kw > current {
+					energyKW[mv.TransactionID] = kw
+				}
+			}
+		}
+		previous[mv.TransactionID] = mv
+	}
+
+	hasPower := make(map[int]bool)
+	for key, kw := range phases {
+		if total, ok := totals[key]; ok {
+			kw = total
+		}
+		if st := stats[key.transactionID]; !hasPower[key.transactionID] || kw > st.PeakPowerKW {
+			st.PeakPowerKW = kw
+		}
+		hasPower[key.transactionID] = true
+	}
+	for key, kw := range totals {
+		if st := stats[key.transactionID]; !hasPower[key.transactionID] || kw > st.PeakPowerKW {
+			st.PeakPowerKW = kw
+		}
+		hasPower[key.transactionID] = true
+	}
+	for id, st := range stats {
+		if !hasPower[id] {
+			st.PeakPowerKW = energyKW[id]
+		}
+	}
+	return stats, nil
+}
+
+// GetChargePointTotals aggregates the transactions and faults of a charge point in [from, to)
+func (s *MemoryStore) GetChargePointTotals(ctx context.Context, chargePointID string, from, to time.Time) (*models.ChargePointTotals, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	totals := &models.ChargePointTotals{From: from, To: to}
+	for _, tx := range s.transactions {
+		end := tx.EndTime
+		if end.IsZero() {
+			end = now
+		}
+		if tx.ChargePointID != chargePointID || !tx.StartTime.Before(to) || !end.After(from) {
+			continue
+		}
+
+		if !tx.StartTime.Before(from) {
+			totals.Sessions++
+			if !tx.EndTime.IsZero() && tx.MeterStop > tx.MeterStart {
+				totals.EnergyKWh += float64(tx.MeterStop-tx.MeterStart) / 1000
+			}
+		}
+
+		start := tx.StartTime
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		totals.ChargingSeconds += int64(end.Sub(start).Seconds())
+	}
+
+	for _, event := range s.statusEvents {
+		if event.ChargePointID == chargePointID && event.ErrorCode != "" && event.ErrorCode != "NoError" &&
+			!event.Timestamp.Before(from) && event.Timestamp.Before(to) {
+			totals.Faults++
+		}
+	}
+	return totals, nil
+}
+
+// GetSessionMeterValues retrieves the meter values of a session
+func (s *MemoryStore) GetSessionMeterValues(ctx context.Context, sessionID string) ([]*models.MeterValue, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.queryMeterValues(func(mv *models.MeterValue) bool {
+		return mv.SessionID == sessionID && sessionID != ""
+	}), nil
+}
+
+// StreamMeterValues calls fn for every meter value of a charge point sampled in [from, to)
+func (s *MemoryStore) StreamMeterValues(ctx context.Context, chargePointID string, from, to time.Time, fn func(*models.MeterValue) error) error {
+	s.mu.Lock()
+	var meterValues []*models.MeterValue
+	if s.chargePointInScope(ctx, chargePointID) {
+		meterValues = s.queryMeterValues(func(mv *models.MeterValue) bool {
+			return mv.ChargePointID == chargePointID && inRange(mv.Timestamp, from, to)
+		})
+	}
+	s.mu.Unlock()
+
+	for _, mv := range meterValues {
+		if err := fn(mv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetHourlyEnergy returns the energy delivered per connector and hour of a charge point in [from, to),
+// measured from the previous hour's highest register reading like PostgresStore
+func (s *MemoryStore) GetHourlyEnergy(ctx context.Context, chargePointID string, from, to time.Time) ([]*models.HourlyEnergy, error) {
+	s.mu.Lock()
+	var meterValues []*models.MeterValue
+	if s.chargePointInScope(ctx, chargePointID) {
+		meterValues = s.queryMeterValues(func(mv *models.MeterValue) bool {
+			return mv.ChargePointID == chargePointID && mv.Measurand == "Energy.Active.Import.Register" &&
+				inRange(mv.Timestamp, from.Add(-hourlyEnergyLookback), to)
+		})
+	}
+	s.mu.Unlock()
+
+	type bucket struct {
+		connectorID    int
+		hour           time.Time
+		minKWh, maxKWh float64
+	}
+	buckets := make(map[[2]int64]*bucket)
+	for _, mv := range meterValues {
+		kwh := mv.Value
+		if mv.Unit != "kWh" {
+			kwh /= 1000
+		}
+
+		hour := mv.Timestamp.Truncate(time.Hour)
+		key := [2]int64{int64(mv.ConnectorID), hour.Unix()}
+		b, ok := buckets[key]
+		if !ok {
+			buckets[key] = &bucket{connectorID: mv.ConnectorID, hour: hour, minKWh: kwh, maxKWh: kwh}
+			continue
+		}
+		if kwh < b.minKWh {
+			b.minKWh = kwh
+		}
+		if kwh > b.maxKWh {
+			b.maxKWh = kwh
+		}
+	}
+
+	sorted := make([]*bucket, 0, len(buckets))
+	for _, b := range buckets {
+		sorted = append(sorted, b)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].connectorID != sorted[j].connectorID {
+			return sorted[i].connectorID < sorted[j].connectorID
+		}
+		return sorted[i].hour.Before(sorted[j].hour)
+	})
+
+	var energy []*models.HourlyEnergy
+	for i, b := range sorted {
+		previous := b.minKWh
+		if i > 0 && sorted[i-1].connectorID == b.connectorID {
+			previous = sorted[i-1].maxKWh
+		}
+		if b.hour.Before(from) {
+			continue
+		}
+
+		kwh := b.maxKWh - previous
+		if kwh < 0 {
+			kwh = 0
+		}
+		energy = append(energy, &models.HourlyEnergy{ConnectorID: b.connectorID, Hour: b.hour, EnergyKWh: kwh})
+	}
+
+	sort.SliceStable(energy, func(i, j int) bool { return energy[i].Hour.Before(energy[j].Hour) })
+	return energy, nil
+}
+
+// EnsureMeterValuePartition does nothing, meter values are not partitioned in memory
+func (s *MemoryStore) EnsureMeterValuePartition(ctx context.Context, t time.Time) error {
+	return nil
+}
+
+// PruneMeterValues deletes raw meter values sampled before the cutoff. Downsampled buckets are not kept in memory.
+func (s *MemoryStore) PruneMeterValues(ctx context.Context, cutoff time.Time, bucketMinutes int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.meterValues[:0]
+	for _, mv := range s.meterValues {
+		if !mv.Timestamp.Before(cutoff) {
+			kept = append(kept, mv)
+		}
+	}
+	s.meterValues = kept
+	return nil, nil
+}
+
+// LogOCPPMessage logs an OCPP message, storing the payload as JSON like PostgresStore
+func (s *MemoryStore) LogOCPPMessage(ctx context.Context, msg *models.OCPPMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payload, err := json.Marshal(msg.Payload)
+	if err != nil {
+		payload = []byte("{}")
+	}
+
+	stored := *msg
+	stored.ID = s.nextID("ocpp_messages")
+	stored.Payload = string(payload)
+	s.ocppMessages = append(s.ocppMessages, &stored)
+	return nil
+}
+
+// GetOCPPMessages retrieves a page of the OCPP messages logged for a charge point, newest first,
+// and the total number of its logged messages
+func (s *MemoryStore) GetOCPPMessages(ctx context.Context, chargePointID string, page Page) ([]*models.OCPPMessage, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.chargePointInScope(ctx, chargePointID) {
+		return nil, 0, nil
+	}
+
+	var messages []*models.OCPPMessage
+	for i := len(s.ocppMessages) - 1; i >= 0; i-- {
+		if stored := s.ocppMessages[i]; stored.ChargePointID == chargePointID {
+			msg := *stored
+			messages = append(messages, &msg)
+		}
+	}
+	return pageSlice(messages, page), len(messages), nil
+}
+
+// OldestOCPPMessageTime returns the timestamp of the oldest logged OCPP message, false if there are none
+func (s *MemoryStore) OldestOCPPMessageTime(ctx context.Context) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var oldest time.Time
+	for _, msg := range s.ocppMessages {
+		if oldest.IsZero() || msg.Timestamp.Before(oldest) {
+			oldest = msg.Timestamp
+		}
+	}
+	return oldest, !oldest.IsZero(), nil
+}
+
+// StreamOCPPMessages calls fn for every OCPP message logged in [from, to), ordered by ID
+func (s *MemoryStore) StreamOCPPMessages(ctx context.Context, from, to time.Time, fn func(*models.OCPPMessage) error) error {
+	s.mu.Lock()
+	var messages []*models.OCPPMessage
+	for _, stored := range s.ocppMessages {
+		if inRange(stored.Timestamp, from, to) {
+			msg := *stored
+			messages = append(messages, &msg)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, msg := range messages {
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteOCPPMessages deletes the OCPP messages logged in [from, to) with an ID up to maxID
+func (s *MemoryStore) DeleteOCPPMessages(ctx context.Context, from, to time.Time, maxID int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	kept := s.ocppMessages[:0]
+	for _, msg := range s.ocppMessages {
+		if inRange(msg.Timestamp, from, to) && msg.ID <= maxID {
+			deleted++
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	s.ocppMessages = kept
+	return deleted, nil
+}
+
+// QuarantineMessage stores an inbound OCPP frame that failed parsing or validation
+func (s *MemoryStore) QuarantineMessage(ctx context.Context, msg *models.QuarantinedMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg.ID = s.nextID("quarantined_messages")
+	stored := *msg
+	s.quarantine = append(s.quarantine, &stored)
+	return nil
+}
+
+// GetQuarantinedMessages retrieves a page of the quarantined OCPP messages matching a filter, newest first,
+// and the total number of matching messages
+func (s *MemoryStore) GetQuarantinedMessages(ctx context.Context, filter QuarantineFilter, page Page) ([]*models.QuarantinedMessage, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var messages []*models.QuarantinedMessage
+	for i := len(s.quarantine) - 1; i >= 0; i-- {
+		stored := s.quarantine[i]
+		if filter.ChargePointID != "" && stored.ChargePointID != filter.ChargePointID {
+			continue
+		}
+		if filter.Unreviewed && !stored.ReviewedAt.IsZero() {
+			continue
+		}
+		msg := *stored
+		messages = append(messages, &msg)
+	}
+	return pageSlice(messages, page), len(messages), nil
+}
+
+// ReviewQuarantinedMessage marks a quarantined OCPP message as reviewed by an actor
+func (s *MemoryStore) ReviewQuarantinedMessage(ctx context.Context, id int, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, msg := range s.quarantine {
+		if msg.ID == id {
+			msg.ReviewedAt = time.Now()
+			msg.ReviewedBy = actor
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// DeleteQuarantinedMessages deletes the quarantined OCPP messages received before a time
+func (s *MemoryStore) DeleteQuarantinedMessages(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	kept := s.quarantine[:0]
+	for _, msg := range s.quarantine {
+		if msg.ReceivedAt.Before(before) {
+			deleted++
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	s.quarantine = kept
+	return deleted, nil
+}
+
+// RegisterConnection records that an instance holds a charge point's websocket
+func (s *MemoryStore) RegisterConnection(ctx context.Context, chargePointID, instanceID, instanceURL string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connections[chargePointID] = &connectionOwner{instanceID: instanceID, instanceURL: instanceURL}
+	return nil
+}
+
+// UnregisterConnection removes a charge point's registration if it is still held by the instance
+func (s *MemoryStore) UnregisterConnection(ctx context.Context, chargePointID, instanceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if owner, ok := s.connections[chargePointID]; ok && owner.instanceID == instanceID {
+		delete(s.connections, chargePointID)
+	}
+	return nil
+}
+
+// ClearConnections removes all registrations of an instance
+func (s *MemoryStore) ClearConnections(ctx context.Context, instanceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for chargePointID, owner := range s.connections {
+		if owner.instanceID == instanceID {
+			delete(s.connections, chargePointID)
+		}
+	}
+	return nil
+}
+
+// GetConnectionOwner returns the instance holding a charge point's websocket and its internal API URL
+func (s *MemoryStore) GetConnectionOwner(ctx context.Context, chargePointID string) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	owner, ok := s.connections[chargePointID]
+	if !ok {
+		return "", "", ErrNotFound
+	}
+	return owner.instanceID, owner.instanceURL, nil
+}
+
+// inRange reports whether t lies in [from, to)
+func inRange(t, from, to time.Time) bool {
+	return !t.Before(from) && t.Before(to)
+}
+
+// limitSlice returns at most the first limit elements of a slice
+func limitSlice[T any](items []T, limit int) []T {
+	if limit >= 0 && len(items) > limit {
+		return items[:limit]
+	}
+	return items
+}
+
+// pageSlice returns the elements of a slice selected by a page
+func pageSlice[T any](items []T, page Page) []T {
+	if page.Offset >= len(items) {
+		return nil
+	}
+	items = items[page.Offset:]
+	if page.Limit > 0 {
+		return limitSlice(items, page.Limit)
+	}
+	return items
+}
+
+// sortItems orders items by a sortable field, breaking ties by ID like orderClause.
+// Unset values are ordered as zero values, where Postgres orders NULLs last.
+func sortItems[T any](items []T, order Sort, fields map[string]func(a, b T) int) error {
+	compare, ok := fields[order.Field]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrInvalidSort, order.Field)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		c := compare(items[i], items[j])
+		if order.Desc {
+			c = -c
+		}
+		if c == 0 {
+			return fields["id"](items[i], items[j]) < 0
+		}
+		return c < 0
+	})
+	return nil
+}
+
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareBools(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case b:
+		return -1
+	}
+	return 1
+}
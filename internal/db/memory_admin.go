@@ -0,0 +1,1653 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// CreateCommand records a command before it is sent to the charge point
+func (s *MemoryStore) CreateCommand(ctx context.Context, cmd *models.Command) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cmd.CreatedAt = time.Now()
+	cmd.ID = s.nextID("commands")
+
+	stored := *cmd
+	s.commands[cmd.ID] = &stored
+	return nil
+}
+
+// CompleteCommand records the outcome of a command
+func (s *MemoryStore) CompleteCommand(ctx context.Context, cmd *models.Command) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cmd.CompletedAt = time.Now()
+	if stored, ok := s.commands[cmd.ID]; ok {
+		stored.Status = cmd.Status
+		stored.Response = cmd.Response
+		stored.Error = cmd.Error
+		stored.Attempts = cmd.Attempts
+		stored.CompletedAt = cmd.CompletedAt
+	}
+	return nil
+}
+
+// GetCommand retrieves a command by its ID
+func (s *MemoryStore) GetCommand(ctx context.Context, id int) (*models.Command, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.commands[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cmd := *stored
+	return &cmd, nil
+}
+
+// queryCommands returns copies of the commands matching a filter, ordered by less
+func (s *MemoryStore) queryCommands(match func(*models.Command) bool, less func(a, b *models.Command) bool) []*models.Command {
+	var commands []*models.Command
+	for _, stored := range s.commands {
+		if match(stored) {
+			cmd := *stored
+			commands = append(commands, &cmd)
+		}
+	}
+	sort.Slice(commands, func(i, j int) bool { return less(commands[i], commands[j]) })
+	return commands
+}
+
+// GetCommands retrieves the most recent commands sent to a charge point
+func (s *MemoryStore) GetCommands(ctx context.Context, chargePointID string, limit int) ([]*models.Command, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	commands := s.queryCommands(
+		func(cmd *models.Command) bool { return cmd.ChargePointID == chargePointID },
+		func(a, b *models.Command) bool { return a.ID > b.ID },
+	)
+	return limitSlice(commands, limit), nil
+}
+
+// GetLatestCommand retrieves the most recent command of an action the charge point answered
+func (s *MemoryStore) GetLatestCommand(ctx context.Context, chargePointID, action string) (*models.Command, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	commands := s.queryCommands(
+		func(cmd *models.Command) bool {
+			return cmd.ChargePointID == chargePointID && cmd.Action == action && len(cmd.Response) > 0
+		},
+		func(a, b *models.Command) bool { return a.ID > b.ID },
+	)
+	if len(commands) == 0 {
+		return nil, ErrNotFound
+	}
+	return commands[0], nil
+}
+
+// GetMacroRunCommands retrieves the commands sent by a macro run
+func (s *MemoryStore) GetMacroRunCommands(ctx context.Context, runID int) ([]*models.Command, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.queryCommands(
+		func(cmd *models.Command) bool { return cmd.MacroRunID == runID },
+		func(a, b *models.Command) bool {
+			if a.ChargePointID != b.ChargePointID {
+				return a.ChargePointID < b.ChargePointID
+			}
+			if a.Step != b.Step {
+				return a.Step < b.Step
+			}
+			return a.ID < b.ID
+		},
+	), nil
+}
+
+// GetSessionCommands retrieves the commands sent for a session
+func (s *MemoryStore) GetSessionCommands(ctx context.Context, sessionID string) ([]*models.Command, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.queryCommands(
+		func(cmd *models.Command) bool { return cmd.SessionID == sessionID && sessionID != "" },
+		func(a, b *models.Command) bool { return a.ID < b.ID },
+	), nil
+}
+
+// SaveMacro creates or updates a command macro
+func (s *MemoryStore) SaveMacro(ctx context.Context, macro *models.Macro) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if macro.CreatedAt.IsZero() {
+		macro.CreatedAt = now
+	}
+	macro.UpdatedAt = now
+
+	stored := *macro
+	stored.Steps = append([]models.MacroStep(nil), macro.Steps...)
+	if existing, ok := s.macros[macro.ID]; ok {
+		stored.CreatedAt = existing.CreatedAt
+	}
+	s.macros[macro.ID] = &stored
+	return nil
+}
+
+// GetMacro retrieves a command macro by its ID
+func (s *MemoryStore) GetMacro(ctx context.Context, id string) (*models.Macro, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.macros[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	macro := *stored
+	macro.Steps = append([]models.MacroStep(nil), stored.Steps...)
+	return &macro, nil
+}
+
+// GetMacros retrieves all command macros
+func (s *MemoryStore) GetMacros(ctx context.Context) ([]*models.Macro, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var macros []*models.Macro
+	for _, stored := range s.macros {
+		macro := *stored
+		macro.Steps = append([]models.MacroStep(nil), stored.Steps...)
+		macros = append(macros, &macro)
+	}
+	sort.Slice(macros, func(i, j int) bool { return macros[i].Name < macros[j].Name })
+	return macros, nil
+}
+
+// DeleteMacro removes a command macro and its run history
+func (s *MemoryStore) DeleteMacro(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.macros[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.macros, id)
+	for runID, run := range s.macroRuns {
+		if run.MacroID == id {
+			delete(s.macroRuns, runID)
+		}
+	}
+	return nil
+}
+
+// CreateMacroRun records the start of a macro run
+func (s *MemoryStore) CreateMacroRun(ctx context.Context, run *models.MacroRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run.CreatedAt = time.Now()
+	run.ID = s.nextID("macro_runs")
+
+	stored := *run
+	stored.ChargePointIDs = append([]string(nil), run.ChargePointIDs...)
+	stored.Commands = nil
+	s.macroRuns[run.ID] = &stored
+	return nil
+}
+
+// CompleteMacroRun records the final status of a macro run
+func (s *MemoryStore) CompleteMacroRun(ctx context.Context, id int, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if run, ok := s.macroRuns[id]; ok {
+		run.Status = status
+		run.CompletedAt = time.Now()
+	}
+	return nil
+}
+
+// GetMacroRun retrieves a macro run by its ID
+func (s *MemoryStore) GetMacroRun(ctx context.Context, id int) (*models.MacroRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.macroRuns[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	run := *stored
+	run.ChargePointIDs = append([]string(nil), stored.ChargePointIDs...)
+	return &run, nil
+}
+
+// CreateFirmwareUpdate stores a new firmware update request
+func (s *MemoryStore) CreateFirmwareUpdate(ctx context.Context, fu *models.FirmwareUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	fu.CreatedAt = now
+	fu.UpdatedAt = now
+	fu.ID = s.nextID("firmware_updates")
+
+	stored := *fu
+	stored.Locations = append([]string(nil), fu.Locations...)
+	s.firmwareUpdates[fu.ID] = &stored
+	return nil
+}
+
+// UpdateFirmwareUpdate persists the status and retry state of a firmware update
+func (s *MemoryStore) UpdateFirmwareUpdate(ctx context.Context, fu *models.FirmwareUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fu.UpdatedAt = time.Now()
+	if stored, ok := s.firmwareUpdates[fu.ID]; ok {
+		stored.Status = fu.Status
+		stored.Attempts = fu.Attempts
+		stored.NextRetryAt = fu.NextRetryAt
+		stored.LastError = fu.LastError
+		stored.UpdatedAt = fu.UpdatedAt
+	}
+	return nil
+}
+
+// queryFirmwareUpdates returns copies of the firmware updates matching a filter, ordered by less
+func (s *MemoryStore) queryFirmwareUpdates(match func(*models.FirmwareUpdate) bool, less func(a, b *models.FirmwareUpdate) bool) []*models.FirmwareUpdate {
+	var updates []*models.FirmwareUpdate
+	for _, stored := range s.firmwareUpdates {
+		if match(stored) {
+			fu := *stored
+			fu.Locations = append([]string(nil), stored.Locations...)
+			updates = append(updates, &fu)
+		}
+	}
+	sort.Slice(updates, func(i, j int) bool { return less(updates[i], updates[j]) })
+	return updates
+}
+
+// GetActiveFirmwareUpdate retrieves the most recent unfinished firmware update for a charge point
+func (s *MemoryStore) GetActiveFirmwareUpdate(ctx context.Context, chargePointID string) (*models.FirmwareUpdate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updates := s.queryFirmwareUpdates(
+		func(fu *models.FirmwareUpdate) bool {
+			return fu.ChargePointID == chargePointID && fu.Status != "Installed" && fu.Status != "Failed"
+		},
+		func(a, b *models.FirmwareUpdate) bool { return a.ID > b.ID },
+	)
+	if len(updates) == 0 {
+		return nil, ErrNotFound
+	}
+	return updates[0], nil
+}
+
+// GetFirmwareUpdates retrieves all firmware updates for a charge point
+func (s *MemoryStore) GetFirmwareUpdates(ctx context.Context, chargePointID string) ([]*models.FirmwareUpdate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.queryFirmwareUpdates(
+		func(fu *models.FirmwareUpdate) bool { return fu.ChargePointID == chargePointID },
+		func(a, b *models.FirmwareUpdate) bool { return a.ID > b.ID },
+	), nil
+}
+
+// GetFirmwareUpdatesDueForRetry retrieves firmware updates whose retry time has passed
+func (s *MemoryStore) GetFirmwareUpdatesDueForRetry(ctx context.Context, now time.Time) ([]*models.FirmwareUpdate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.queryFirmwareUpdates(
+		func(fu *models.FirmwareUpdate) bool {
+			return fu.Status == "RetryScheduled" && !fu.NextRetryAt.IsZero() && !fu.NextRetryAt.After(now)
+		},
+		func(a, b *models.FirmwareUpdate) bool { return a.NextRetryAt.Before(b.NextRetryAt) },
+	), nil
+}
+
+// spotPriceKey identifies the spot price of a price area and hour
+func spotPriceKey(priceArea string, hourStart time.Time) string {
+	return priceArea + "/" + hourStart.UTC().Format(time.RFC3339)
+}
+
+// SaveSpotPrices creates or updates a set of hourly spot prices
+func (s *MemoryStore) SaveSpotPrices(ctx context.Context, prices []*models.SpotPrice) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, p := range prices {
+		if p.CreatedAt.IsZero() {
+			p.CreatedAt = now
+		}
+
+		key := spotPriceKey(p.PriceArea, p.HourStart)
+		if existing, ok := s.spotPrices[key]; ok {
+			existing.PricePerMWh = p.PricePerMWh
+			existing.Currency = p.Currency
+			continue
+		}
+		stored := *p
+		s.spotPrices[key] = &stored
+	}
+	return nil
+}
+
+// GetSpotPrices retrieves the spot prices of a price area within a time range
+func (s *MemoryStore) GetSpotPrices(ctx context.Context, priceArea string, from, to time.Time) ([]*models.SpotPrice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var prices []*models.SpotPrice
+	for _, stored := range s.spotPrices {
+		if stored.PriceArea == priceArea && inRange(stored.HourStart, from, to) {
+			p := *stored
+			prices = append(prices, &p)
+		}
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].HourStart.Before(prices[j].HourStart) })
+	return prices, nil
+}
+
+// SaveCarbonIntensities creates or updates a set of hourly carbon intensities
+func (s *MemoryStore) SaveCarbonIntensities(ctx context.Context, intensities []*models.CarbonIntensity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, c := range intensities {
+		if c.CreatedAt.IsZero() {
+			c.CreatedAt = now
+		}
+
+		key := spotPriceKey(c.PriceArea, c.HourStart)
+		if existing, ok := s.carbon[key]; ok {
+			existing.CO2PerKWh = c.CO2PerKWh
+			existing.RenewableShare = c.RenewableShare
+			continue
+		}
+		stored := *c
+		s.carbon[key] = &stored
+	}
+	return nil
+}
+
+// GetCarbonIntensities retrieves the carbon intensities of a price area within a time range
+func (s *MemoryStore) GetCarbonIntensities(ctx context.Context, priceArea string, from, to time.Time) ([]*models.CarbonIntensity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var intensities []*models.CarbonIntensity
+	for _, stored := range s.carbon {
+		if stored.PriceArea == priceArea && inRange(stored.HourStart, from, to) {
+			c := *stored
+			intensities = append(intensities, &c)
+		}
+	}
+	sort.Slice(intensities, func(i, j int) bool { return intensities[i].HourStart.Before(intensities[j].HourStart) })
+	return intensities, nil
+}
+
+// SetChargePointSpotOptOut excludes the transactions of a charge point from spot price optimized charging,
+// or includes them again
+func (s *MemoryStore) SetChargePointSpotOptOut(ctx context.Context, chargePointID string, optOut bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp, ok := s.chargePoints[chargePointID]
+	if !ok {
+		return ErrNotFound
+	}
+	cp.SpotOptOut = optOut
+	cp.UpdatedAt = time.Now()
+	return nil
+}
+
+// SetTransactionSpotOptOut excludes an in-progress transaction from spot price optimized charging,
+// or includes it again
+func (s *MemoryStore) SetTransactionSpotOptOut(ctx context.Context, id int, optOut bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, ok := s.transactions[id]
+	if !ok || tx.Status != "InProgress" || !inScope(ctx, tx.TenantID) {
+		return ErrNotFound
+	}
+	tx.SpotOptOut = optOut
+	tx.UpdatedAt = time.Now()
+	return nil
+}
+
+// SaveSite creates or updates a site
+func (s *MemoryStore) SaveSite(ctx context.Context, site *models.Site) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if site.CreatedAt.IsZero() {
+		site.CreatedAt = now
+	}
+	site.UpdatedAt = now
+
+	stored := *site
+	if existing, ok := s.sites[site.ID]; ok {
+		stored.CreatedAt = existing.CreatedAt
+	}
+	s.sites[site.ID] = &stored
+	return nil
+}
+
+// GetSite retrieves a site by its ID
+func (s *MemoryStore) GetSite(ctx context.Context, id string) (*models.Site, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.sites[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	site := *stored
+	return &site, nil
+}
+
+// GetSites retrieves all sites
+func (s *MemoryStore) GetSites(ctx context.Context) ([]*models.Site, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sites []*models.Site
+	for _, stored := range s.sites {
+		site := *stored
+		sites = append(sites, &site)
+	}
+	sort.Slice(sites, func(i, j int) bool { return sites[i].Name < sites[j].Name })
+	return sites, nil
+}
+
+// SetChargePointSite assigns a charge point to a site, an empty site ID removes the assignment
+func (s *MemoryStore) SetChargePointSite(ctx context.Context, chargePointID, siteID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cp, ok := s.chargePoints[chargePointID]; ok {
+		cp.SiteID = siteID
+		cp.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// SetChargePointFreeVend enables or disables free vend mode on a charge point
+func (s *MemoryStore) SetChargePointFreeVend(ctx context.Context, chargePointID string, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp, ok := s.chargePoints[chargePointID]
+	if !ok {
+		return ErrNotFound
+	}
+	cp.FreeVend = enabled
+	cp.UpdatedAt = time.Now()
+	return nil
+}
+
+// IsFreeVend reports whether a charge point or its site is in free vend mode
+func (s *MemoryStore) IsFreeVend(ctx context.Context, chargePointID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp, ok := s.chargePoints[chargePointID]
+	if !ok {
+		return false, nil
+	}
+	if cp.FreeVend {
+		return true, nil
+	}
+	site, ok := s.sites[cp.SiteID]
+	return ok && site.FreeVend, nil
+}
+
+// GetActiveTransactionsForSite retrieves the in-progress transactions of all charge points at a site
+func (s *MemoryStore) GetActiveTransactionsForSite(ctx context.Context, siteID string) ([]*models.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var transactions []*models.Transaction
+	for _, stored := range s.transactions {
+		cp, ok := s.chargePoints[stored.ChargePointID]
+		if ok && cp.SiteID == siteID && siteID != "" && stored.Status == "InProgress" {
+			tx := *stored
+			transactions = append(transactions, &tx)
+		}
+	}
+	sort.Slice(transactions, func(i, j int) bool { return transactions[i].StartTime.Before(transactions[j].StartTime) })
+	return transactions, nil
+}
+
+// GetChargePointIDsForSite retrieves the IDs of all charge points assigned to a site
+func (s *MemoryStore) GetChargePointIDsForSite(ctx context.Context, siteID string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	for id, cp := range s.chargePoints {
+		if cp.SiteID == siteID && siteID != "" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// GetParkingSessions retrieves the plugged-in connectors at sites with a max-stay rule,
+// optionally restricted to a single site
+func (s *MemoryStore) GetParkingSessions(ctx context.Context, siteID string) ([]*models.ParkingSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sessions []*models.ParkingSession
+	for chargePointID, connectors := range s.connectors {
+		cp, ok := s.chargePoints[chargePointID]
+		if !ok {
+			continue
+		}
+		site, ok := s.sites[cp.SiteID]
+		if !ok || site.MaxStayMinutes <= 0 || (siteID != "" && site.ID != siteID) {
+			continue
+		}
+
+		for _, c := range connectors {
+			if c.OccupiedSince.IsZero() {
+				continue
+			}
+
+			p := &models.ParkingSession{
+				SiteID:                 site.ID,
+				ChargePointID:          chargePointID,
+				ConnectorID:            c.ID,
+				OccupiedSince:          c.OccupiedSince,
+				MaxStayMinutes:         site.MaxStayMinutes,
+				OverstayWarningMinutes: site.OverstayWarningMinutes,
+			}
+			for _, tx := range s.transactions {
+				if tx.ChargePointID == chargePointID && tx.ConnectorID == c.ID && tx.Status == "InProgress" {
+					p.IdTag = tx.IdTag
+					p.TransactionID = tx.ID
+					p.SessionID = tx.SessionID
+					break
+				}
+			}
+			sessions = append(sessions, p)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].OccupiedSince.Before(sessions[j].OccupiedSince) })
+	return sessions, nil
+}
+
+// SaveAlertRule creates or updates an alert rule
+func (s *MemoryStore) SaveAlertRule(ctx context.Context, rule *models.AlertRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if rule.CreatedAt.IsZero() {
+		rule.CreatedAt = now
+	}
+	rule.UpdatedAt = now
+
+	stored := *rule
+	if existing, ok := s.alertRules[rule.ID]; ok {
+		stored.CreatedAt = existing.CreatedAt
+	}
+	s.alertRules[rule.ID] = &stored
+	return nil
+}
+
+// GetAlertRule retrieves an alert rule by its ID
+func (s *MemoryStore) GetAlertRule(ctx context.Context, id string) (*models.AlertRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.alertRules[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	rule := *stored
+	return &rule, nil
+}
+
+// GetAlertRules retrieves all alert rules
+func (s *MemoryStore) GetAlertRules(ctx context.Context) ([]*models.AlertRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rules []*models.AlertRule
+	for _, stored := range s.alertRules {
+		rule := *stored
+		rules = append(rules, &rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules, nil
+}
+
+// DeleteAlertRule removes an alert rule. The alerts it raised are kept.
+func (s *MemoryStore) DeleteAlertRule(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.alertRules[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.alertRules, id)
+	return nil
+}
+
+// CreateAlert records a firing alert
+func (s *MemoryStore) CreateAlert(ctx context.Context, alert *models.Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if alert.FiredAt.IsZero() {
+		alert.FiredAt = time.Now()
+	}
+	alert.ID = s.nextID("alerts")
+
+	stored := *alert
+	s.alerts = append(s.alerts, &stored)
+	return nil
+}
+
+// ResolveAlert marks a firing alert as resolved
+func (s *MemoryStore) ResolveAlert(ctx context.Context, id int, resolvedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, alert := range s.alerts {
+		if alert.ID == id && alert.State == "firing" {
+			alert.State = "resolved"
+			alert.ResolvedAt = resolvedAt
+		}
+	}
+	return nil
+}
+
+// SetAlertDiagnostics attaches the location of a diagnostics file to an alert
+func (s *MemoryStore) SetAlertDiagnostics(ctx context.Context, id int, file string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, alert := range s.alerts {
+		if alert.ID == id {
+			alert.DiagnosticsFile = file
+		}
+	}
+	return nil
+}
+
+// GetAlerts retrieves the most recently fired alerts, optionally only those in a state.
+// A zero limit retrieves all of them.
+func (s *MemoryStore) GetAlerts(ctx context.Context, state string, limit int) ([]*models.Alert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var alerts []*models.Alert
+	for i := len(s.alerts) - 1; i >= 0; i-- {
+		if state != "" && s.alerts[i].State != state {
+			continue
+		}
+		alert := *s.alerts[i]
+		alerts = append(alerts, &alert)
+	}
+	sort.SliceStable(alerts, func(i, j int) bool { return alerts[i].FiredAt.After(alerts[j].FiredAt) })
+	if limit > 0 && len(alerts) > limit {
+		alerts = alerts[:limit]
+	}
+	return alerts, nil
+}
+
+// SaveGridEvent creates or updates a grid event, ignoring updates of an already finished event
+func (s *MemoryStore) SaveGridEvent(ctx context.Context, event *models.GridEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = now
+	}
+	event.UpdatedAt = now
+
+	if existing, ok := s.gridEvents[event.ID]; ok {
+		if existing.Status == "Scheduled" || existing.Status == "Active" {
+			existing.LimitKW = event.LimitKW
+			existing.StartTime = event.StartTime
+			existing.EndTime = event.EndTime
+			existing.UpdatedAt = event.UpdatedAt
+		}
+		return nil
+	}
+
+	stored := *event
+	s.gridEvents[event.ID] = &stored
+	return nil
+}
+
+// UpdateGridEventStatus updates the status of a grid event
+func (s *MemoryStore) UpdateGridEventStatus(ctx context.Context, id, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event, ok := s.gridEvents[id]; ok {
+		event.Status = status
+		event.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// GetGridEvent retrieves a grid event by its ID
+func (s *MemoryStore) GetGridEvent(ctx context.Context, id string) (*models.GridEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.gridEvents[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	event := *stored
+	return &event, nil
+}
+
+// GetGridEvents retrieves the grid event history, most recent first
+func (s *MemoryStore) GetGridEvents(ctx context.Context) ([]*models.GridEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []*models.GridEvent
+	for _, stored := range s.gridEvents {
+		event := *stored
+		events = append(events, &event)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].StartTime.After(events[j].StartTime) })
+	return events, nil
+}
+
+// GetPendingGridEvents retrieves grid events that are scheduled or active
+func (s *MemoryStore) GetPendingGridEvents(ctx context.Context) ([]*models.GridEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []*models.GridEvent
+	for _, stored := range s.gridEvents {
+		if stored.Status == "Scheduled" || stored.Status == "Active" {
+			event := *stored
+			events = append(events, &event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].StartTime.Before(events[j].StartTime) })
+	return events, nil
+}
+
+// SaveGroup creates or updates a group's name, leaving the freeze state untouched
+func (s *MemoryStore) SaveGroup(ctx context.Context, group *models.Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if group.CreatedAt.IsZero() {
+		group.CreatedAt = now
+	}
+	group.UpdatedAt = now
+
+	if existing, ok := s.groups[group.ID]; ok {
+		existing.Name = group.Name
+		existing.UpdatedAt = group.UpdatedAt
+		return nil
+	}
+
+	s.groups[group.ID] = &models.Group{
+		ID:        group.ID,
+		Name:      group.Name,
+		CreatedAt: group.CreatedAt,
+		UpdatedAt: group.UpdatedAt,
+	}
+	return nil
+}
+
+// GetGroup retrieves a group by its ID
+func (s *MemoryStore) GetGroup(ctx context.Context, id string) (*models.Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.groups[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	group := *stored
+	return &group, nil
+}
+
+// GetGroups retrieves all groups
+func (s *MemoryStore) GetGroups(ctx context.Context) ([]*models.Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var groups []*models.Group
+	for _, stored := range s.groups {
+		group := *stored
+		groups = append(groups, &group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+// GetFrozenGroupsForChargePoint retrieves the frozen groups a charge point belongs to
+func (s *MemoryStore) GetFrozenGroupsForChargePoint(ctx context.Context, chargePointID string) ([]*models.Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var groups []*models.Group
+	for id, stored := range s.groups {
+		if stored.Frozen && s.groupMembers[id][chargePointID] {
+			group := *stored
+			groups = append(groups, &group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups, nil
+}
+
+// SetGroupFrozen freezes or unfreezes a group
+func (s *MemoryStore) SetGroupFrozen(ctx context.Context, id string, frozen bool, reason, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[id]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	group.Frozen = frozen
+	group.FreezeReason, group.FrozenBy, group.FrozenAt = "", "", time.Time{}
+	if frozen {
+		group.FreezeReason, group.FrozenBy, group.FrozenAt = reason, actor, now
+	}
+	group.UpdatedAt = now
+	return nil
+}
+
+// AddGroupMember adds a charge point to a group
+func (s *MemoryStore) AddGroupMember(ctx context.Context, groupID, chargePointID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members, ok := s.groupMembers[groupID]
+	if !ok {
+		members = make(map[string]bool)
+		s.groupMembers[groupID] = members
+	}
+	members[chargePointID] = true
+	return nil
+}
+
+// RemoveGroupMember removes a charge point from a group
+func (s *MemoryStore) RemoveGroupMember(ctx context.Context, groupID, chargePointID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.groupMembers[groupID], chargePointID)
+	return nil
+}
+
+// GetGroupMembers retrieves the IDs of the charge points in a group
+func (s *MemoryStore) GetGroupMembers(ctx context.Context, groupID string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	for id := range s.groupMembers[groupID] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// CreateFreezeOverride stores a new freeze override
+func (s *MemoryStore) CreateFreezeOverride(ctx context.Context, o *models.FreezeOverride) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o.CreatedAt = time.Now()
+	o.ID = s.nextID("freeze_overrides")
+
+	stored := *o
+	s.freezeOverrides = append(s.freezeOverrides, &stored)
+	return nil
+}
+
+// GetActiveFreezeOverride retrieves a valid override for an action on a charge point in a group
+func (s *MemoryStore) GetActiveFreezeOverride(ctx context.Context, groupID, chargePointID, action string) (*models.FreezeOverride, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var active *models.FreezeOverride
+	for _, o := range s.freezeOverrides {
+		if o.GroupID != groupID || o.Action != action || !o.ValidUntil.After(now) ||
+			(o.ChargePointID != "" && o.ChargePointID != chargePointID) {
+			continue
+		}
+		if active == nil || o.ValidUntil.After(active.ValidUntil) {
+			active = o
+		}
+	}
+	if active == nil {
+		return nil, ErrNotFound
+	}
+	o := *active
+	return &o, nil
+}
+
+// SaveTenant creates or updates a tenant
+func (s *MemoryStore) SaveTenant(ctx context.Context, tenant *models.Tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if tenant.CreatedAt.IsZero() {
+		tenant.CreatedAt = now
+	}
+	tenant.UpdatedAt = now
+
+	stored := *tenant
+	if existing, ok := s.tenants[tenant.ID]; ok {
+		stored.CreatedAt = existing.CreatedAt
+	}
+	s.tenants[tenant.ID] = &stored
+	return nil
+}
+
+// GetTenant retrieves a tenant by its ID
+func (s *MemoryStore) GetTenant(ctx context.Context, id string) (*models.Tenant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.tenants[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	t := *stored
+	return &t, nil
+}
+
+// GetTenants retrieves all tenants
+func (s *MemoryStore) GetTenants(ctx context.Context) ([]*models.Tenant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tenants []*models.Tenant
+	for _, stored := range s.tenants {
+		t := *stored
+		tenants = append(tenants, &t)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Name < tenants[j].Name })
+	return tenants, nil
+}
+
+// SetChargePointTenant assigns a charge point to a tenant, an empty tenant ID unassigns it
+func (s *MemoryStore) SetChargePointTenant(ctx context.Context, chargePointID, tenantID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp, ok := s.chargePoints[chargePointID]
+	if !ok {
+		return ErrNotFound
+	}
+	cp.TenantID = tenantID
+	cp.UpdatedAt = time.Now()
+	return nil
+}
+
+// SaveAddressRule creates or updates a connection address rule
+func (s *MemoryStore) SaveAddressRule(ctx context.Context, rule *models.AddressRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := s.addressRules[rule.ID]; ok {
+		rule.CreatedAt = existing.CreatedAt
+	} else if rule.CreatedAt.IsZero() {
+		rule.CreatedAt = now
+	}
+	rule.UpdatedAt = now
+
+	stored := *rule
+	s.addressRules[rule.ID] = &stored
+	return nil
+}
+
+// GetAddressRules retrieves all connection address rules
+func (s *MemoryStore) GetAddressRules(ctx context.Context) ([]*models.AddressRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rules []*models.AddressRule
+	for _, stored := range s.addressRules {
+		rule := *stored
+		rules = append(rules, &rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].TenantID != rules[j].TenantID {
+			return rules[i].TenantID < rules[j].TenantID
+		}
+		return rules[i].ID < rules[j].ID
+	})
+	return rules, nil
+}
+
+// DeleteAddressRule removes a connection address rule
+func (s *MemoryStore) DeleteAddressRule(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.addressRules[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.addressRules, id)
+	return nil
+}
+
+// SaveUpstreamGateway creates or updates the upstream gateway of a charge point
+func (s *MemoryStore) SaveUpstreamGateway(ctx context.Context, gateway *models.UpstreamGateway) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := s.upstreams[gateway.ChargePointID]; ok {
+		gateway.CreatedAt = existing.CreatedAt
+	} else if gateway.CreatedAt.IsZero() {
+		gateway.CreatedAt = now
+	}
+	gateway.UpdatedAt = now
+
+	stored := *gateway
+	stored.Actions = append([]string{}, gateway.Actions...)
+	s.upstreams[gateway.ChargePointID] = &stored
+	return nil
+}
+
+// GetUpstreamGateway retrieves the upstream gateway of a charge point
+func (s *MemoryStore) GetUpstreamGateway(ctx context.Context, chargePointID string) (*models.UpstreamGateway, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.upstreams[chargePointID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	gateway := *stored
+	return &gateway, nil
+}
+
+// GetUpstreamGateways retrieves the upstream gateways of all charge points
+func (s *MemoryStore) GetUpstreamGateways(ctx context.Context) ([]*models.UpstreamGateway, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var gateways []*models.UpstreamGateway
+	for _, stored := range s.upstreams {
+		gateway := *stored
+		gateways = append(gateways, &gateway)
+	}
+	sort.Slice(gateways, func(i, j int) bool { return gateways[i].ChargePointID < gateways[j].ChargePointID })
+	return gateways, nil
+}
+
+// DeleteUpstreamGateway removes the upstream gateway of a charge point
+func (s *MemoryStore) DeleteUpstreamGateway(ctx context.Context, chargePointID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.upstreams[chargePointID]; !ok {
+		return ErrNotFound
+	}
+	delete(s.upstreams, chargePointID)
+	return nil
+}
+
+// SetUpstreamTransactionID records the ID the upstream central system of a gateway charge point assigned to a transaction
+func (s *MemoryStore) SetUpstreamTransactionID(ctx context.Context, id, upstreamID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, ok := s.transactions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	s.upstreamTxIDs[id] = upstreamID
+	tx.UpdatedAt = time.Now()
+	return nil
+}
+
+// GetTransactionIDByUpstreamID retrieves the ID of the latest transaction of a charge point the upstream central
+// system assigned an ID to
+func (s *MemoryStore) GetTransactionIDByUpstreamID(ctx context.Context, chargePointID string, upstreamID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var latest *models.Transaction
+	for id, assigned := range s.upstreamTxIDs {
+		tx := s.transactions[id]
+		if assigned != upstreamID || tx == nil || tx.ChargePointID != chargePointID {
+			continue
+		}
+		if latest == nil || tx.StartTime.After(latest.StartTime) {
+			latest = tx
+		}
+	}
+	if latest == nil {
+		return 0, ErrNotFound
+	}
+	return latest.ID, nil
+}
+
+// GetUpstreamTransactionID retrieves the ID the upstream central system assigned to a transaction
+func (s *MemoryStore) GetUpstreamTransactionID(ctx context.Context, id int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upstreamID, ok := s.upstreamTxIDs[id]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return upstreamID, nil
+}
+
+// GetChargePointPasswordHash retrieves the hash of a charge point's basic auth password, empty if it has none
+func (s *MemoryStore) GetChargePointPasswordHash(ctx context.Context, chargePointID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.chargePoints[chargePointID]; !ok {
+		return "", ErrNotFound
+	}
+	return s.passwordHashes[chargePointID], nil
+}
+
+// CreateCredentialRotation stores a new credential rotation, superseding the open rotations of the charge point
+func (s *MemoryStore) CreateCredentialRotation(ctx context.Context, rotation *models.CredentialRotation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, stored := range s.rotations {
+		if stored.ChargePointID == rotation.ChargePointID && openRotation(stored) {
+			stored.Status = "Superseded"
+			stored.UpdatedAt = now
+		}
+	}
+
+	rotation.CreatedAt = now
+	rotation.UpdatedAt = now
+	rotation.ID = s.nextID("credential_rotations")
+
+	stored := *rotation
+	s.rotations = append(s.rotations, &stored)
+	return nil
+}
+
+// UpdateCredentialRotation persists the status, command and error of an open credential rotation
+func (s *MemoryStore) UpdateCredentialRotation(ctx context.Context, rotation *models.CredentialRotation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rotation.UpdatedAt = time.Now()
+	for _, stored := range s.rotations {
+		if stored.ID == rotation.ID && openRotation(stored) {
+			stored.Status = rotation.Status
+			stored.CommandID = rotation.CommandID
+			stored.Error = rotation.Error
+			stored.UpdatedAt = rotation.UpdatedAt
+		}
+	}
+	return nil
+}
+
+// GetOpenCredentialRotation retrieves the rotation of a charge point waiting for the charge point to use its password
+func (s *MemoryStore) GetOpenCredentialRotation(ctx context.Context, chargePointID string) (*models.CredentialRotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.rotations) - 1; i >= 0; i-- {
+		if stored := s.rotations[i]; stored.ChargePointID == chargePointID && openRotation(stored) {
+			rotation := *stored
+			return &rotation, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// CompleteCredentialRotation makes the password of an open rotation the charge point's password,
+// invalidating the previous one. It reports false if the rotation is no longer open.
+func (s *MemoryStore) CompleteCredentialRotation(ctx context.Context, id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.rotations {
+		if stored.ID != id || !openRotation(stored) {
+			continue
+		}
+		now := time.Now()
+		stored.Status = "Completed"
+		stored.Error = ""
+		stored.UpdatedAt = now
+		stored.CompletedAt = now
+		s.passwordHashes[stored.ChargePointID] = stored.PasswordHash
+		return true, nil
+	}
+	return false, nil
+}
+
+// GetCredentialRotations retrieves the most recent credential rotations of a charge point
+func (s *MemoryStore) GetCredentialRotations(ctx context.Context, chargePointID string, limit int) ([]*models.CredentialRotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rotations []*models.CredentialRotation
+	for i := len(s.rotations) - 1; i >= 0; i-- {
+		if stored := s.rotations[i]; stored.ChargePointID == chargePointID {
+			rotation := *stored
+			rotations = append(rotations, &rotation)
+		}
+	}
+	return limitSlice(rotations, limit), nil
+}
+
+func openRotation(rotation *models.CredentialRotation) bool {
+	return rotation.Status == "Pending" || rotation.Status == "AwaitingReconnect"
+}
+
+// CreateAPIKey stores the hash of a new API key
+func (s *MemoryStore) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key.CreatedAt = time.Now()
+	key.ID = s.nextID("api_keys")
+
+	stored := &hashedAPIKey{APIKey: *key, hash: HashAPIKey(key.Key)}
+	stored.Key = ""
+	s.apiKeys = append(s.apiKeys, stored)
+	return nil
+}
+
+// GetAPIKeyByKey retrieves the unrevoked API key matching a presented key
+func (s *MemoryStore) GetAPIKeyByKey(ctx context.Context, key string) (*models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := HashAPIKey(key)
+	for _, stored := range s.apiKeys {
+		if stored.hash == hash && stored.RevokedAt.IsZero() {
+			k := stored.APIKey
+			return &k, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetAPIKeys retrieves the API keys of a tenant
+func (s *MemoryStore) GetAPIKeys(ctx context.Context, tenantID string) ([]*models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []*models.APIKey
+	for _, stored := range s.apiKeys {
+		if stored.TenantID == tenantID {
+			k := stored.APIKey
+			keys = append(keys, &k)
+		}
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an API key of a tenant
+func (s *MemoryStore) RevokeAPIKey(ctx context.Context, tenantID string, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.apiKeys {
+		if stored.ID == id && stored.TenantID == tenantID && stored.RevokedAt.IsZero() {
+			stored.RevokedAt = time.Now()
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// SaveIdTag creates or updates an idTag of a tenant
+func (s *MemoryStore) SaveIdTag(ctx context.Context, tag *models.IdTag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if tag.CreatedAt.IsZero() {
+		tag.CreatedAt = now
+	}
+	tag.UpdatedAt = now
+
+	key := [2]string{tag.TenantID, tag.IdTag}
+	stored := *tag
+	if existing, ok := s.idTags[key]; ok {
+		stored.CreatedAt = existing.CreatedAt
+	}
+	s.idTags[key] = &stored
+	return nil
+}
+
+// GetIdTags retrieves the idTags visible in the context's tenant scope
+func (s *MemoryStore) GetIdTags(ctx context.Context) ([]*models.IdTag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tags []*models.IdTag
+	for _, stored := range s.idTags {
+		if inScope(ctx, stored.TenantID) {
+			t := *stored
+			tags = append(tags, &t)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].TenantID != tags[j].TenantID {
+			return tags[i].TenantID < tags[j].TenantID
+		}
+		return tags[i].IdTag < tags[j].IdTag
+	})
+	return tags, nil
+}
+
+// DeleteIdTag removes an idTag of a tenant
+func (s *MemoryStore) DeleteIdTag(ctx context.Context, tenantID, idTag string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := [2]string{tenantID, idTag}
+	if _, ok := s.idTags[key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.idTags, key)
+	return nil
+}
+
+// GetIdTagForChargePoint looks up an idTag in the tenant owning a charge point
+func (s *MemoryStore) GetIdTagForChargePoint(ctx context.Context, chargePointID, idTag string) (string, *models.IdTag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp, ok := s.chargePoints[chargePointID]
+	if !ok || cp.TenantID == "" {
+		return "", nil, nil
+	}
+
+	stored, ok := s.idTags[[2]string{cp.TenantID, idTag}]
+	if !ok {
+		return cp.TenantID, nil, nil
+	}
+	t := *stored
+	return cp.TenantID, &t, nil
+}
+
+// CreateImpersonationSession stores a new impersonation session with the hash of its token
+func (s *MemoryStore) CreateImpersonationSession(ctx context.Context, session *models.ImpersonationSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session.CreatedAt = time.Now()
+	session.ID = s.nextID("impersonation_sessions")
+
+	stored := &hashedImpersonationSession{ImpersonationSession: *session, hash: HashAPIKey(session.Token)}
+	stored.Token = ""
+	s.impersonations = append(s.impersonations, stored)
+	return nil
+}
+
+// GetActiveImpersonationSession retrieves the unexpired, unended session matching a token
+func (s *MemoryStore) GetActiveImpersonationSession(ctx context.Context, token string) (*models.ImpersonationSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := HashAPIKey(token)
+	now := time.Now()
+	for _, stored := range s.impersonations {
+		if stored.hash == hash && stored.Active(now) {
+			session := stored.ImpersonationSession
+			return &session, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetImpersonationSessions retrieves the most recent impersonation sessions
+func (s *MemoryStore) GetImpersonationSessions(ctx context.Context, limit int) ([]*models.ImpersonationSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sessions []*models.ImpersonationSession
+	for i := len(s.impersonations) - 1; i >= 0; i-- {
+		session := s.impersonations[i].ImpersonationSession
+		sessions = append(sessions, &session)
+	}
+	return limitSlice(sessions, limit), nil
+}
+
+// EndImpersonationSession ends an active impersonation session
+func (s *MemoryStore) EndImpersonationSession(ctx context.Context, id int) (*models.ImpersonationSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.impersonations {
+		if stored.ID == id && stored.EndedAt.IsZero() {
+			stored.EndedAt = time.Now()
+			session := stored.ImpersonationSession
+			return &session, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// CreateAuditEntry records an operator or policy action
+func (s *MemoryStore) CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.CreatedAt = time.Now()
+	entry.ID = s.nextID("audit_log")
+
+	stored := *entry
+	s.auditLog = append(s.auditLog, &stored)
+	return nil
+}
+
+// GetAuditLog retrieves the most recent audit entries, optionally filtered by target
+func (s *MemoryStore) GetAuditLog(ctx context.Context, targetType, targetID string, limit int) ([]*models.AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []*models.AuditEntry
+	for i := len(s.auditLog) - 1; i >= 0; i-- {
+		stored := s.auditLog[i]
+		if (targetType != "" && stored.TargetType != targetType) || (targetID != "" && stored.TargetID != targetID) {
+			continue
+		}
+		entry := *stored
+		entries = append(entries, &entry)
+	}
+	return limitSlice(entries, limit), nil
+}
+
+// GetIdTagOCPPMessages retrieves the logged OCPP messages carrying an idTag, oldest first
+func (s *MemoryStore) GetIdTagOCPPMessages(ctx context.Context, idTag string) ([]*models.OCPPMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var messages []*models.OCPPMessage
+	for _, stored := range s.ocppMessages {
+		if payloadMentionsIdTag(stored.Payload, idTag) {
+			msg := *stored
+			messages = append(messages, &msg)
+		}
+	}
+	return messages, nil
+}
+
+// GetIdTagQuarantinedMessages retrieves the quarantined OCPP messages carrying an idTag, oldest first
+func (s *MemoryStore) GetIdTagQuarantinedMessages(ctx context.Context, idTag string) ([]*models.QuarantinedMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var messages []*models.QuarantinedMessage
+	for _, stored := range s.quarantine {
+		if quarantineMentionsIdTag(stored.Payload, idTag) {
+			msg := *stored
+			messages = append(messages, &msg)
+		}
+	}
+	return messages, nil
+}
+
+// ErasePersonalData anonymizes the transactions and commands of an idTag within the erasure's tenant with the
+// erasure's pseudonym, deletes its registration, pending sessions and logged and quarantined OCPP messages of the
+// tenant's charge points, and records the erasure with the number of affected rows
+func (s *MemoryStore) ErasePersonalData(ctx context.Context, idTag string, erasure *models.Erasure) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if erasure.ErasedAt.IsZero() {
+		erasure.ErasedAt = time.Now()
+	}
+
+	inTenant := func(chargePointID string) bool {
+		cp, ok := s.chargePoints[chargePointID]
+		return ok && cp.TenantID == erasure.TenantID
+	}
+
+	for _, tx := range s.transactions {
+		if tx.IdTag == idTag && tx.TenantID == erasure.TenantID {
+			tx.IdTag = erasure.Pseudonym
+			tx.VehicleMAC = ""
+			tx.VehicleVIN = ""
+			tx.UpdatedAt = erasure.ErasedAt
+			erasure.TransactionsAnonymized++
+		}
+	}
+
+	for _, cmd := range s.commands {
+		if !inTenant(cmd.ChargePointID) {
+			continue
+		}
+		var payload map[string]interface{}
+		if err := json.Unmarshal(cmd.Payload, &payload); err != nil || payload["idTag"] != idTag {
+			continue
+		}
+		payload["idTag"] = erasure.Pseudonym
+		if data, err := json.Marshal(payload); err == nil {
+			cmd.Payload = data
+			erasure.CommandsAnonymized++
+		}
+	}
+
+	for key, tag := range s.idTags {
+		if tag.TenantID != erasure.TenantID {
+			continue
+		}
+		if tag.IdTag == idTag {
+			delete(s.idTags, key)
+			erasure.IdTagsDeleted++
+		} else if tag.ParentIdTag == idTag {
+			// idTags grouped under the erased one stay grouped under its pseudonym
+			tag.ParentIdTag = erasure.Pseudonym
+		}
+	}
+
+	for key := range s.pendingSessions {
+		if key[1] == idTag && inTenant(key[0]) {
+			delete(s.pendingSessions, key)
+		}
+	}
+
+	kept := s.ocppMessages[:0]
+	for _, msg := range s.ocppMessages {
+		if payloadMentionsIdTag(msg.Payload, idTag) && inTenant(msg.ChargePointID) {
+			erasure.MessagesDeleted++
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	s.ocppMessages = kept
+
+	quarantined := s.quarantine[:0]
+	for _, msg := range s.quarantine {
+		if quarantineMentionsIdTag(msg.Payload, idTag) && inTenant(msg.ChargePointID) {
+			erasure.MessagesDeleted++
+			continue
+		}
+		quarantined = append(quarantined, msg)
+	}
+	s.quarantine = quarantined
+
+	erasure.ID = s.nextID("erasures")
+	stored := *erasure
+	s.erasures = append(s.erasures, &stored)
+	return nil
+}
+
+// GetErasures retrieves the most recent erasures
+func (s *MemoryStore) GetErasures(ctx context.Context, limit int) ([]*models.Erasure, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var erasures []*models.Erasure
+	for i := len(s.erasures) - 1; i >= 0; i-- {
+		e := *s.erasures[i]
+		erasures = append(erasures, &e)
+	}
+	return limitSlice(erasures, limit), nil
+}
+
+// quarantineMentionsIdTag reports whether a quarantined OCPP message payload carries an idTag as a JSON string
+// anywhere in it. The payload isn't necessarily valid JSON.
+func quarantineMentionsIdTag(payload, idTag string) bool {
+	quoted, _ := json.Marshal(idTag)
+	return strings.Contains(payload, string(quoted))
+}
+
+// payloadMentionsIdTag reports whether a logged OCPP message payload carries an idTag, as the idTag
+// of a request or the parent idTag of a confirmation. Payloads are stored as JSON strings.
+func payloadMentionsIdTag(payload, idTag string) bool {
+	var raw string
+	if err := json.Unmarshal([]byte(payload), &raw); err != nil {
+		raw = payload
+	}
+
+	var msg struct {
+		IdTag     string `json:"idTag"`
+		IdTagInfo struct {
+			ParentIdTag string `json:"parentIdTag"`
+		} `json:"idTagInfo"`
+	}
+	if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+		return false
+	}
+	return msg.IdTag == idTag || msg.IdTagInfo.ParentIdTag == idTag
+}
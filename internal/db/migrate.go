@@ -0,0 +1,23 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/balu-dk/go-cpms/migrations"
+)
+
+// Migrate applies the schema to the database, followed by the TimescaleDB schema if timescale is set
+func (s *PostgresStore) Migrate(ctx context.Context, timescale bool) error {
+	if _, err := s.pool.Exec(ctx, migrations.Schema); err != nil {
+		return fmt.Errorf("failed to apply schema: %w", err)
+	}
+
+	if timescale {
+		if _, err := s.pool.Exec(ctx, migrations.Timescale); err != nil {
+			return fmt.Errorf("failed to apply TimescaleDB schema: %w", err)
+		}
+	}
+
+	return nil
+}
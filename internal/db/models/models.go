@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -15,56 +16,685 @@ type ChargePoint struct {
 	RegistrationStatus string    `json:"registrationStatus"`
 	ConnectedSince     time.Time `json:"connectedSince"`
 	IsConnected        bool      `json:"isConnected"`
+	SiteID             string    `json:"siteId,omitempty"`
+	TenantID           string    `json:"tenantId,omitempty"`
+	FreeVend           bool      `json:"freeVend"`   // Accept every idTag and charge nothing, as do all charge points of a free vend site
+	SpotOptOut         bool      `json:"spotOptOut"` // Never defer its transactions to the cheapest spot price hours
 	CreatedAt          time.Time `json:"createdAt"`
 	UpdatedAt          time.Time `json:"updatedAt"`
+
+	// Metadata of the latest connection, for verifying which SIM or network the charge point uses
+	RemoteAddr        string            `json:"remoteAddr,omitempty"`
+	Subprotocol       string            `json:"subprotocol,omitempty"`
+	ConnectionHeaders map[string]string `json:"connectionHeaders,omitempty"`
+
+	// Deviation of the charger clock from server time, measured from the timestamps of its messages
+	ClockDriftMs      int64     `json:"clockDriftMs"` // Positive if the charger clock is ahead
+	ClockDriftAt      time.Time `json:"clockDriftAt,omitempty"`
+	ClockDriftFlagged bool      `json:"clockDriftFlagged"` // The drift exceeds CLOCK_DRIFT_THRESHOLD
+
+	// Start of the reboot loop the charge point is in, zero unless it sent BOOT_LOOP_THRESHOLD BootNotifications within BOOT_LOOP_WINDOW
+	RebootLoopSince time.Time `json:"rebootLoopSince,omitempty"`
 }
 
-// Connector represents a connector/plug on a charge point
-type Connector struct {
-	ID            int       `json:"id"`
+// ConnectionEvent is a websocket connection of a charge point
+type ConnectionEvent struct {
+	ID             int               `json:"id"`
+	ChargePointID  string            `json:"chargePointId"`
+	RemoteAddr     string            `json:"remoteAddr"`
+	Subprotocol    string            `json:"subprotocol"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	ConnectedAt    time.Time         `json:"connectedAt"`
+	DisconnectedAt time.Time         `json:"disconnectedAt,omitempty"` // Zero while connected
+}
+
+// UpstreamGateway forwards the OCPP traffic of a charge point to an upstream central system, which answers the
+// forwarded requests in place of the CPMS, while the CPMS keeps handling them to mirror the charge point's state
+type UpstreamGateway struct {
 	ChargePointID string    `json:"chargePointId"`
-	Status        string    `json:"status"`
-	ErrorCode     string    `json:"errorCode"`
+	URL           string    `json:"url"`               // Websocket endpoint of the upstream, the charge point ID is appended; credentials go in the userinfo
+	Actions       []string  `json:"actions,omitempty"` // Requests of the charge point to forward, empty forwards all
 	CreatedAt     time.Time `json:"createdAt"`
 	UpdatedAt     time.Time `json:"updatedAt"`
 }
 
+// AddressRule allows or denies charge point connections from a network. Deny rules take precedence; once any allow
+// rule applies to a charge point, it may only connect from the networks of its allow rules.
+type AddressRule struct {
+	ID          string    `json:"id"`
+	TenantID    string    `json:"tenantId,omitempty"` // Empty applies the rule to all charge points
+	CIDR        string    `json:"cidr"`               // e.g. 10.64.0.0/10 for a carrier APN, a single address is a /32 or /128
+	Action      string    `json:"action"`             // allow or deny
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// Connector represents a connector/plug on a charge point
+type Connector struct {
+	ID              int       `json:"id"`
+	ChargePointID   string    `json:"chargePointId"`
+	Status          string    `json:"status"`
+	ErrorCode       string    `json:"errorCode"`
+	Info            string    `json:"info,omitempty"`            // Free-form error details reported by the charger
+	VendorID        string    `json:"vendorId,omitempty"`        // Vendor the vendor error code belongs to
+	VendorErrorCode string    `json:"vendorErrorCode,omitempty"` // Vendor-specific error code
+	OccupiedSince   time.Time `json:"occupiedSince,omitempty"`   // When a vehicle was plugged in
+	StatusSince     time.Time `json:"statusSince,omitempty"`     // When the connector entered its current status
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+
+	// Attributes maintained by the operator
+	PlugType   string  `json:"plugType,omitempty"`   // OCPI connector standard, e.g. IEC_62196_T2 or IEC_62196_T2_COMBO
+	Format     string  `json:"format,omitempty"`     // SOCKET or CABLE
+	MaxPowerKW float64 `json:"maxPowerKw,omitempty"` // Maximum charging power in kW
+	Phases     int     `json:"phases,omitempty"`     // 1 or 3 for AC connectors, 0 for DC connectors
+}
+
+// ConnectorStatusEvent is a status notification reported for a connector
+type ConnectorStatusEvent struct {
+	ID                int       `json:"id"`
+	ChargePointID     string    `json:"chargePointId"`
+	ConnectorID       int       `json:"connectorId"`
+	Status            string    `json:"status"`
+	ErrorCode         string    `json:"errorCode"`
+	Info              string    `json:"info,omitempty"`
+	VendorID          string    `json:"vendorId,omitempty"`
+	VendorErrorCode   string    `json:"vendorErrorCode,omitempty"`
+	Timestamp         time.Time `json:"timestamp"`                   // When the charger reported the status, or when it was received
+	TimestampAdjusted bool      `json:"timestampAdjusted,omitempty"` // The reported timestamp was implausible and replaced by the receive time
+	CreatedAt         time.Time `json:"createdAt"`
+}
+
+// HourlyEnergy is the energy a connector delivered in one hour
+type HourlyEnergy struct {
+	ConnectorID int       `json:"connectorId"`
+	Hour        time.Time `json:"hour"`
+	EnergyKWh   float64   `json:"energyKWh"`
+}
+
 // Transaction represents a charging transaction
 type Transaction struct {
-	ID            int       `json:"id"`
-	ChargePointID string    `json:"chargePointId"`
-	ConnectorID   int       `json:"connectorId"`
-	IdTag         string    `json:"idTag"`
-	StartTime     time.Time `json:"startTime"`
-	EndTime       time.Time `json:"endTime,omitempty"`
-	MeterStart    int       `json:"meterStart"`
-	MeterStop     int       `json:"meterStop,omitempty"`
-	Status        string    `json:"status"` // InProgress, Completed, Stopped
-	CreatedAt     time.Time `json:"createdAt"`
-	UpdatedAt     time.Time `json:"updatedAt"`
+	ID                int       `json:"id"`
+	ChargePointID     string    `json:"chargePointId"`
+	ConnectorID       int       `json:"connectorId"`
+	IdTag             string    `json:"idTag"`
+	StartTime         time.Time `json:"startTime"`
+	EndTime           time.Time `json:"endTime,omitempty"`
+	MeterStart        int       `json:"meterStart"`
+	MeterStop         int       `json:"meterStop,omitempty"`
+	Status            string    `json:"status"`               // InProgress, Completed, Stopped, Orphaned
+	MaxCost           float64   `json:"maxCost,omitempty"`    // Session cost cap, 0 means no cap
+	MaxEnergy         float64   `json:"maxEnergy,omitempty"`  // Session energy cap in kWh, 0 means no cap
+	StopReason        string    `json:"stopReason,omitempty"` // Reason reported by the charge point or the CPMS auto-stop reason
+	TenantID          string    `json:"tenantId,omitempty"`
+	SessionID         string    `json:"sessionId,omitempty"`         // End-to-end session identifier
+	OfflineAuthorized bool      `json:"offlineAuthorized,omitempty"` // Started while the charge point was offline, which authorized the idTag itself
+	BillingReview     bool      `json:"billingReview,omitempty"`     // Energy and cost need checking, e.g. closed by the CPMS after the charge point lost it
+	FreeVend          bool      `json:"freeVend,omitempty"`          // Started in free vend mode, it costs nothing
+	VehicleMAC        string    `json:"vehicleMac,omitempty"`        // MAC address of the vehicle's charging controller, if the charge point reported it
+	VehicleVIN        string    `json:"vehicleVin,omitempty"`        // Vehicle identification number, if the charge point reported it
+	TargetEnergy      float64   `json:"targetEnergy,omitempty"`      // kWh the vehicle needs by the departure time, 0 means no departure schedule
+	DepartureTime     time.Time `json:"departureTime,omitempty"`
+	PriceOptimized    bool      `json:"priceOptimized,omitempty"`    // Charge in the cheapest spot price hours before the departure time
+	SpotOptOut        bool      `json:"spotOptOut,omitempty"`        // Never deferred to the cheapest spot price hours
+	TimestampAdjusted bool      `json:"timestampAdjusted,omitempty"` // An implausible start or stop timestamp was replaced by the receive time
+	ReportedStartTime time.Time `json:"reportedStartTime,omitempty"` // Start timestamp reported by the charge point, if it was replaced
+	StartSoC          float64   `json:"startSoc,omitempty"`          // Vehicle state of charge in % at the first SoC reading of the transaction
+	CurrentSoC        float64   `json:"currentSoc,omitempty"`        // Latest state of charge reading in %
+	EndSoC            float64   `json:"endSoc,omitempty"`            // State of charge in % when the transaction ended
+	CreatedAt         time.Time `json:"createdAt"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+}
+
+// ActiveTransaction is an in-progress transaction with its energy and duration so far
+type ActiveTransaction struct {
+	Transaction
+	EnergyKWh        float64   `json:"energyKWh"`                  // Latest energy register reading minus meterStart
+	DurationSeconds  int       `json:"durationSeconds"`            // Since the start of the transaction
+	LastMeterValueAt time.Time `json:"lastMeterValueAt,omitempty"` // Zero before the first energy reading
+}
+
+// ChargePointTotals are the totals of a charge point over a period
+type ChargePointTotals struct {
+	From               time.Time `json:"from"`
+	To                 time.Time `json:"to"`
+	Sessions           int       `json:"sessions"`  // Transactions started in the period
+	EnergyKWh          float64   `json:"energyKWh"` // Energy of the completed transactions started in the period
+	Revenue            float64   `json:"revenue"`
+	Currency           string    `json:"currency,omitempty"`
+	ChargingSeconds    int64     `json:"chargingSeconds"`    // Time the connectors spent in transactions within the period
+	UtilizationPercent float64   `json:"utilizationPercent"` // Charging time over the time all connectors were available
+	Faults             int       `json:"faults"`             // Status notifications reporting an error
+}
+
+// ChargePointStats are the lifetime and period totals of a charge point
+type ChargePointStats struct {
+	ChargePointID string             `json:"chargePointId"`
+	Lifetime      *ChargePointTotals `json:"lifetime"` // Since the charge point was registered
+	Period        *ChargePointTotals `json:"period"`
+	ComputedAt    time.Time          `json:"computedAt"` // Statistics are cached, they may be this old
+}
+
+// SessionSummary is a transaction with the energy, duration and power derived from its meter values
+type SessionSummary struct {
+	Transaction
+	EnergyDeliveredKWh float64 `json:"energyDeliveredKWh"`
+	DurationSeconds    int     `json:"durationSeconds"` // Until the end of the transaction, or so far while in progress
+	AveragePowerKW     float64 `json:"averagePowerKW"`  // Energy delivered over the duration
+	PeakPowerKW        float64 `json:"peakPowerKW"`
+
+	Emissions *SessionEmissions `json:"emissions,omitempty"` // With the carbon intensity feed enabled and data for the session
+}
+
+// TransactionMeterStats are figures derived from the meter values of a transaction
+type TransactionMeterStats struct {
+	TransactionID    int     `json:"transactionId"`
+	EnergyRegisterWh float64 `json:"energyRegisterWh"` // Highest energy register reading, 0 without readings
+	PeakPowerKW      float64 `json:"peakPowerKW"`      // Highest active import power, or power between energy register readings without power readings
+}
+
+// LiveConnector is the most recent power, current and energy readings of a connector,
+// one per measurand, phase and location
+type LiveConnector struct {
+	ConnectorID   int           `json:"connectorId"`
+	TransactionID int           `json:"transactionId,omitempty"` // Transaction in progress the readings belong to
+	UpdatedAt     time.Time     `json:"updatedAt"`               // Timestamp of the latest reading
+	Readings      []*MeterValue `json:"readings"`
 }
 
 // OCPPMessage represents a logged OCPP message
 type OCPPMessage struct {
 	ID            int       `json:"id"`
 	ChargePointID string    `json:"chargePointId"`
-	MessageType   string    `json:"messageType"` // Request or Response
+	MessageType   string    `json:"messageType"` // Request, Response or Error
 	Action        string    `json:"action"`      // OCPP action like BootNotification, StatusNotification, etc.
 	RequestID     string    `json:"requestId"`
-	Payload       string    `json:"payload"`   // JSON string of the message
-	Direction     string    `json:"direction"` // Inbound or Outbound
+	APIRequestID  string    `json:"apiRequestId,omitempty"` // ID of the API request that sent the command, for outbound commands and their confirmations
+	Payload       string    `json:"payload"`                // JSON string of the message
+	Direction     string    `json:"direction"`              // Inbound or Outbound
 	Timestamp     time.Time `json:"timestamp"`
 }
 
+// QuarantinedMessage is an inbound OCPP frame that failed parsing or validation, kept with the error for review
+type QuarantinedMessage struct {
+	ID            int       `json:"id"`
+	ChargePointID string    `json:"chargePointId"`
+	Action        string    `json:"action,omitempty"` // OCPP action of the frame, empty if it couldn't be parsed
+	Payload       string    `json:"payload"`          // Raw frame as received, with personal data redacted
+	Error         string    `json:"error"`
+	ReceivedAt    time.Time `json:"receivedAt"`
+	ReviewedAt    time.Time `json:"reviewedAt,omitempty"` // Zero until reviewed
+	ReviewedBy    string    `json:"reviewedBy,omitempty"`
+}
+
 // MeterValue represents meter readings from a charge point
 type MeterValue struct {
+	ID                int       `json:"id"`
+	TransactionID     int       `json:"transactionId"`
+	ChargePointID     string    `json:"chargePointId"`
+	ConnectorID       int       `json:"connectorId"`
+	Timestamp         time.Time `json:"timestamp"`
+	Value             float64   `json:"value"`
+	Unit              string    `json:"unit"`
+	Measurand         string    `json:"measurand"`
+	Context           string    `json:"context,omitempty"`  // Reading context, e.g. Sample.Periodic or Transaction.Begin
+	Format            string    `json:"format,omitempty"`   // Raw or SignedData
+	Phase             string    `json:"phase,omitempty"`    // Phase the value was measured on, empty for all phases
+	Location          string    `json:"location,omitempty"` // Where the value was measured, e.g. Outlet or EV
+	SessionID         string    `json:"sessionId,omitempty"`
+	TimestampAdjusted bool      `json:"timestampAdjusted,omitempty"` // The reported timestamp was implausible and replaced by the receive time
+	CreatedAt         time.Time `json:"createdAt"`
+}
+
+// EnergyWh returns the value of an energy register reading in Wh
+func (mv *MeterValue) EnergyWh() float64 {
+	if mv.Unit == "kWh" {
+		return mv.Value * 1000
+	}
+	return mv.Value
+}
+
+// CredentialRotation tracks the rotation of a charge point's basic auth password: the new password is pushed to the
+// charge point as its AuthorizationKey and replaces the current one once the charge point reconnects with it
+type CredentialRotation struct {
+	ID            int       `json:"id"`
+	ChargePointID string    `json:"chargePointId"`
+	Status        string    `json:"status"`              // Pending, AwaitingReconnect, Completed, Failed or Superseded
+	CommandID     int       `json:"commandId,omitempty"` // ChangeConfiguration command pushing the new password
+	Error         string    `json:"error,omitempty"`
+	Actor         string    `json:"actor,omitempty"`
+	PasswordHash  string    `json:"-"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+	CompletedAt   time.Time `json:"completedAt,omitempty"`
+}
+
+// FirmwareUpdate represents an UpdateFirmware request and its retry state
+type FirmwareUpdate struct {
 	ID            int       `json:"id"`
-	TransactionID int       `json:"transactionId"`
+	ChargePointID string    `json:"chargePointId"`
+	Locations     []string  `json:"locations"` // Primary location followed by mirror locations
+	RetrieveDate  time.Time `json:"retrieveDate"`
+	Status        string    `json:"status"` // Pending, Downloading, Downloaded, Installing, Installed, RetryScheduled, Failed
+	Attempts      int       `json:"attempts"`
+	MaxAttempts   int       `json:"maxAttempts"`
+	NextRetryAt   time.Time `json:"nextRetryAt,omitempty"`
+	LastError     string    `json:"lastError,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// CurrentLocation returns the location to use for the current attempt,
+// rotating through the mirror locations on every retry
+func (f *FirmwareUpdate) CurrentLocation() string {
+	if len(f.Locations) == 0 {
+		return ""
+	}
+	if f.Attempts == 0 {
+		return f.Locations[0]
+	}
+	return f.Locations[(f.Attempts-1)%len(f.Locations)]
+}
+
+// firmwareErrorLength is the number of characters of a firmware update's last error that are stored
+const firmwareErrorLength = 255
+
+// ScheduleRetry records a failed attempt and schedules the next one with exponential backoff.
+// It returns false when no attempts are left and the update has been marked as Failed.
+// Reasons longer than the stored last error are truncated.
+func (f *FirmwareUpdate) ScheduleRetry(reason string, backoff time.Duration) bool {
+	if runes := []rune(reason); len(runes) > firmwareErrorLength {
+		reason = string(runes[:firmwareErrorLength])
+	}
+	f.LastError = reason
+	if f.Attempts >= f.MaxAttempts {
+		f.Status = "Failed"
+		f.NextRetryAt = time.Time{}
+		return false
+	}
+
+	f.Status = "RetryScheduled"
+	f.NextRetryAt = time.Now().Add(backoff << uint(f.Attempts-1))
+	return true
+}
+
+// SpotPrice represents a day-ahead electricity spot price for one hour in a price area
+type SpotPrice struct {
+	PriceArea   string    `json:"priceArea"`
+	HourStart   time.Time `json:"hourStart"`
+	PricePerMWh float64   `json:"pricePerMWh"`
+	Currency    string    `json:"currency"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// CarbonIntensity represents the CO2 emission per kWh consumed from the grid and its renewable share for one hour in a price area
+type CarbonIntensity struct {
+	PriceArea      string    `json:"priceArea"`
+	HourStart      time.Time `json:"hourStart"`
+	CO2PerKWh      float64   `json:"co2PerKWh"`      // Grams
+	RenewableShare float64   `json:"renewableShare"` // Wind and solar share of the production, 0-1
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// SessionEmissions are the CO2 emissions and renewable share of the energy of a transaction, from the carbon intensity
+// of the hours it was delivered in. Energy delivered in hours without carbon intensity data is left out.
+type SessionEmissions struct {
+	TransactionID  int     `json:"transactionId"`
+	EnergyKWh      float64 `json:"energyKWh"` // Energy delivered in hours with carbon intensity data
+	CO2Grams       float64 `json:"co2Grams"`
+	CO2PerKWh      float64 `json:"co2PerKWh"`      // Average grams per kWh
+	RenewableShare float64 `json:"renewableShare"` // Energy weighted, 0-1
+}
+
+// SessionCost represents the calculated cost of a charging session
+type SessionCost struct {
+	TransactionID int     `json:"transactionId"`
+	EnergyKWh     float64 `json:"energyKWh"`
+	Cost          float64 `json:"cost"`
+	Currency      string  `json:"currency"`
+	TariffMode    string  `json:"tariffMode"`
+
+	Emissions *SessionEmissions `json:"emissions,omitempty"` // Without carbon intensity data for the session
+}
+
+// Site represents a location grouping one or more charge points
+type Site struct {
+	ID                     string    `json:"id"`
+	Name                   string    `json:"name"`
+	SolarEnabled           bool      `json:"solarEnabled"`
+	SolarMeterURL          string    `json:"solarMeterUrl,omitempty"` // Polled for the current PV export power in W
+	MinCurrent             float64   `json:"minCurrent"`              // Minimum charging current per session in A
+	MaxCurrent             float64   `json:"maxCurrent"`              // Maximum charging current per session in A
+	Phases                 int       `json:"phases"`
+	Voltage                float64   `json:"voltage"`
+	MaxStayMinutes         int       `json:"maxStayMinutes"`         // Maximum plug-in duration in minutes, 0 means no limit
+	OverstayWarningMinutes int       `json:"overstayWarningMinutes"` // Minutes before the limit to warn the driver
+	FreeVend               bool      `json:"freeVend"`               // Charge points at the site accept every idTag and charge nothing
+	CreatedAt              time.Time `json:"createdAt"`
+	UpdatedAt              time.Time `json:"updatedAt"`
+}
+
+// GridEvent represents a demand-response event capping the power of a site
+type GridEvent struct {
+	ID        string    `json:"id"`
+	SiteID    string    `json:"siteId"`
+	LimitKW   float64   `json:"limitKW"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Status    string    `json:"status"` // Scheduled, Active, Completed, Cancelled
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// DemandReport is the power demand of a site over a period, measured as the average power per hour. The coincidence
+// factor is the site's peak demand over the sum of the peak demands of its connectors: 1 when all connectors peak
+// at the same time, lower the more load diversity the site has.
+type DemandReport struct {
+	SiteID            string             `json:"siteId"`
+	From              time.Time          `json:"from"`
+	To                time.Time          `json:"to"`
+	PeakPowerKW       float64            `json:"peakPowerKW"`
+	PeakHour          time.Time          `json:"peakHour,omitempty"`
+	ConnectorPeaksKW  float64            `json:"connectorPeaksKW"` // Sum of the peak demands of the connectors
+	CoincidenceFactor float64            `json:"coincidenceFactor"`
+	Connectors        []*ConnectorDemand `json:"connectors"`
+	Days              []*DailyDemand     `json:"days"`
+	Hours             []*HourlyDemand    `json:"hours"`
+}
+
+// ConnectorDemand is the peak demand of a connector in a demand report
+type ConnectorDemand struct {
 	ChargePointID string    `json:"chargePointId"`
 	ConnectorID   int       `json:"connectorId"`
-	Timestamp     time.Time `json:"timestamp"`
-	Value         float64   `json:"value"`
-	Unit          string    `json:"unit"`
-	Measurand     string    `json:"measurand"`
+	PeakPowerKW   float64   `json:"peakPowerKW"`
+	PeakHour      time.Time `json:"peakHour"`
+}
+
+// DailyDemand is the peak demand and coincidence factor of a site on one day (UTC)
+type DailyDemand struct {
+	Day               time.Time `json:"day"`
+	PeakPowerKW       float64   `json:"peakPowerKW"`
+	PeakHour          time.Time `json:"peakHour"`
+	ConnectorPeaksKW  float64   `json:"connectorPeaksKW"`
+	CoincidenceFactor float64   `json:"coincidenceFactor"`
+}
+
+// HourlyDemand is the average power of a site in one hour
+type HourlyDemand struct {
+	Hour             time.Time `json:"hour"`
+	PowerKW          float64   `json:"powerKW"`
+	ActiveConnectors int       `json:"activeConnectors"` // Connectors that delivered energy in the hour
+}
+
+// ParkingSession represents a vehicle plugged in at a site with a max-stay rule
+type ParkingSession struct {
+	SiteID                 string    `json:"siteId"`
+	ChargePointID          string    `json:"chargePointId"`
+	ConnectorID            int       `json:"connectorId"`
+	IdTag                  string    `json:"idTag,omitempty"`
+	TransactionID          int       `json:"transactionId,omitempty"`
+	SessionID              string    `json:"sessionId,omitempty"`
+	OccupiedSince          time.Time `json:"occupiedSince"`
+	MaxStayMinutes         int       `json:"maxStayMinutes"`
+	OverstayWarningMinutes int       `json:"overstayWarningMinutes"`
+}
+
+// Deadline returns when the session exceeds the site's max-stay rule
+func (p *ParkingSession) Deadline() time.Time {
+	return p.OccupiedSince.Add(time.Duration(p.MaxStayMinutes) * time.Minute)
+}
+
+// Group represents a named group of charge points
+type Group struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Frozen       bool      `json:"frozen"` // Blocks firmware updates and configuration changes
+	FreezeReason string    `json:"freezeReason,omitempty"`
+	FrozenBy     string    `json:"frozenBy,omitempty"`
+	FrozenAt     time.Time `json:"frozenAt,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// FreezeOverride is a time-limited exception to a group freeze
+type FreezeOverride struct {
+	ID            int       `json:"id"`
+	GroupID       string    `json:"groupId"`
+	ChargePointID string    `json:"chargePointId,omitempty"` // Empty applies to all members
+	Action        string    `json:"action"`                  // firmware or configuration
+	Reason        string    `json:"reason"`
+	ApprovedBy    string    `json:"approvedBy"`
+	ValidUntil    time.Time `json:"validUntil"`
 	CreatedAt     time.Time `json:"createdAt"`
 }
+
+// AuditEntry represents a recorded operator or policy action
+type AuditEntry struct {
+	ID         int                    `json:"id"`
+	Actor      string                 `json:"actor"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"targetType"`
+	TargetID   string                 `json:"targetId"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	ClientAddr string                 `json:"clientAddr,omitempty"` // Address of the API client, empty for actions without one
+	CreatedAt  time.Time              `json:"createdAt"`
+}
+
+// AlertRule is an operator-defined condition that raises alerts for the charge points or connectors meeting it
+type AlertRule struct {
+	ID                 string    `json:"id"`
+	Name               string    `json:"name"`
+	Condition          string    `json:"condition"`                    // connector_faulted, chargepoint_offline, firmware_failed, error_code, no_telemetry or reboot_loop
+	ChargePointID      string    `json:"chargePointId,omitempty"`      // Empty applies the rule to all charge points
+	DurationMinutes    int       `json:"durationMinutes,omitempty"`    // How long connector_faulted, chargepoint_offline and no_telemetry must hold before firing
+	ErrorCode          string    `json:"errorCode,omitempty"`          // error_code: regular expression matched against the OCPP and vendor error codes
+	TriggerMeterValues bool      `json:"triggerMeterValues,omitempty"` // no_telemetry: request MeterValues with TriggerMessage when firing
+	Enabled            bool      `json:"enabled"`
+	CreatedAt          time.Time `json:"createdAt"`
+	UpdatedAt          time.Time `json:"updatedAt"`
+}
+
+// Alert is an occurrence of an alert rule for a charge point or one of its connectors
+type Alert struct {
+	ID              int       `json:"id"`
+	RuleID          string    `json:"ruleId"`
+	RuleName        string    `json:"ruleName"`
+	Condition       string    `json:"condition"`
+	ChargePointID   string    `json:"chargePointId"`
+	ConnectorID     int       `json:"connectorId,omitempty"` // 0 for alerts about the charge point as a whole
+	State           string    `json:"state"`                 // firing or resolved
+	Message         string    `json:"message"`
+	DiagnosticsFile string    `json:"diagnosticsFile,omitempty"` // Location of the diagnostics collected when the fault occurred
+	FiredAt         time.Time `json:"firedAt"`
+	ResolvedAt      time.Time `json:"resolvedAt,omitempty"`
+}
+
+// Tenant represents a CPO customer served by the CPMS
+type Tenant struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// APIKey represents an API key resolving to a tenant
+type APIKey struct {
+	ID        int       `json:"id"`
+	TenantID  string    `json:"tenantId"`
+	Name      string    `json:"name"`
+	Key       string    `json:"key,omitempty"` // Only set when the key is created
+	CreatedAt time.Time `json:"createdAt"`
+	RevokedAt time.Time `json:"revokedAt,omitempty"`
+}
+
+// IdTag represents an authorization token owned by a tenant
+type IdTag struct {
+	TenantID    string    `json:"tenantId"`
+	IdTag       string    `json:"idTag"`
+	ParentIdTag string    `json:"parentIdTag,omitempty"` // Group the idTag belongs to
+	Status      string    `json:"status"`                // Accepted, Blocked
+	ExpiryDate  time.Time `json:"expiryDate,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// AuthorizationStatus returns the OCPP authorization status of the idTag at a time: Blocked if it is blocked,
+// Expired once its expiry date has passed, and Accepted otherwise
+func (t *IdTag) AuthorizationStatus(now time.Time) string {
+	if t.Status == "Blocked" {
+		return "Blocked"
+	}
+	if !t.ExpiryDate.IsZero() && !t.ExpiryDate.After(now) {
+		return "Expired"
+	}
+	return "Accepted"
+}
+
+// Group returns the group of the idTag, its parent idTag or the idTag itself if it has none
+func (t *IdTag) Group() string {
+	if t.ParentIdTag != "" {
+		return t.ParentIdTag
+	}
+	return t.IdTag
+}
+
+// PersonalData is everything stored about an idTag, exported on request of the person it identifies
+type PersonalData struct {
+	IdTag        string                `json:"idTag"`
+	IdTags       []*IdTag              `json:"idTags"`       // Registrations of the idTag in any tenant
+	Transactions []*Transaction        `json:"transactions"` // Transactions the idTag started
+	Messages     []*OCPPMessage        `json:"messages"`     // Logged OCPP messages carrying the idTag
+	Quarantined  []*QuarantinedMessage `json:"quarantined"`  // Quarantined OCPP messages carrying the idTag
+	ExportedAt   time.Time             `json:"exportedAt"`
+}
+
+// Erasure records the erasure of the personal data of an idTag. The idTag itself is not kept.
+type Erasure struct {
+	ID                     int       `json:"id"`
+	TenantID               string    `json:"tenantId,omitempty"`
+	IdTagHash              string    `json:"idTagHash"` // Hex SHA-256 of the idTag, to prove it was erased
+	Pseudonym              string    `json:"pseudonym"` // Replaces the idTag in anonymized transactions and commands
+	Actor                  string    `json:"actor"`
+	Reason                 string    `json:"reason,omitempty"`
+	TransactionsAnonymized int       `json:"transactionsAnonymized"`
+	CommandsAnonymized     int       `json:"commandsAnonymized"`
+	IdTagsDeleted          int       `json:"idTagsDeleted"`
+	MessagesDeleted        int       `json:"messagesDeleted"`
+	ErasedAt               time.Time `json:"erasedAt"`
+}
+
+// ImpersonationSession lets an admin act within a tenant's scope for a limited time
+type ImpersonationSession struct {
+	ID        int       `json:"id"`
+	TenantID  string    `json:"tenantId"`
+	Actor     string    `json:"actor"` // Admin operator who started the session
+	Reason    string    `json:"reason"`
+	Token     string    `json:"token,omitempty"` // Only set when the session is started
+	ExpiresAt time.Time `json:"expiresAt"`
+	EndedAt   time.Time `json:"endedAt,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Active reports whether the session can still be used
+func (s *ImpersonationSession) Active(now time.Time) bool {
+	return s.EndedAt.IsZero() && now.Before(s.ExpiresAt)
+}
+
+// Command represents a command sent to a charge point, tracked until it is confirmed
+type Command struct {
+	ID            int             `json:"id"`
+	ChargePointID string          `json:"chargePointId"`
+	Action        string          `json:"action"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"` // Pending, Failed or the status confirmed by the charge point
+	Response      json.RawMessage `json:"response,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	Actor         string          `json:"actor"`
+	MacroRunID    int             `json:"macroRunId,omitempty"`
+	Step          int             `json:"step,omitempty"` // Step index within the macro, starting at 1
+	SessionID     string          `json:"sessionId,omitempty"`
+	RequestID     string          `json:"requestId,omitempty"` // ID of the API request that sent the command
+	Attempts      int             `json:"attempts"`            // Times the command was sent, retries included
+	CreatedAt     time.Time       `json:"createdAt"`
+	CompletedAt   time.Time       `json:"completedAt,omitempty"`
+}
+
+// Macro is a named sequence of commands
+type Macro struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	Steps     []MacroStep `json:"steps"`
+	CreatedAt time.Time   `json:"createdAt"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+}
+
+// MacroStep is a single command of a macro
+type MacroStep struct {
+	Action          string            `json:"action"`                  // ClearCache, ChangeConfiguration, SendLocalList, Reset, ChangeAvailability, UnlockConnector, TriggerMessage
+	Configuration   map[string]string `json:"configuration,omitempty"` // ChangeConfiguration: keys and values to set
+	Type            string            `json:"type,omitempty"`          // Reset: Hard or Soft, ChangeAvailability: Operative or Inoperative
+	ConnectorID     int               `json:"connectorId,omitempty"`
+	Message         string            `json:"message,omitempty"` // TriggerMessage: requested message
+	ContinueOnError bool              `json:"continueOnError,omitempty"`
+}
+
+// ConfigurationKey is an OCPP 1.6 configuration key as reported in a GetConfiguration confirmation
+type ConfigurationKey struct {
+	Key      string `json:"key"`
+	Value    string `json:"value,omitempty"`
+	Readonly bool   `json:"readonly,omitempty"`
+}
+
+// ComponentVariable is an OCPP 2.0.1 variable of a component, as reported in a GetVariables or NotifyReport message
+type ComponentVariable struct {
+	Component string `json:"component"`
+	Instance  string `json:"instance,omitempty"` // Component instance, e.g. TransactionEvent of OCPPCommCtrlr
+	Variable  string `json:"variable"`
+	Value     string `json:"value,omitempty"`
+	Readonly  bool   `json:"readonly,omitempty"`
+}
+
+// ConfigurationPlan translates the configuration of a charge point to the other OCPP version. The settings
+// to apply are ready to send: SetVariables data for OCPP 2.0.1, or ChangeConfiguration keys and values for
+// OCPP 1.6, which can be run as a macro step.
+type ConfigurationPlan struct {
+	ChargePointID       string              `json:"chargePointId,omitempty"`
+	From                string              `json:"from"` // ocpp1.6 or ocpp2.0.1
+	To                  string              `json:"to"`
+	SnapshotAt          time.Time           `json:"snapshotAt,omitempty"` // When the translated configuration was reported
+	SetVariables        []ComponentVariable `json:"setVariables,omitempty"`
+	ChangeConfiguration map[string]string   `json:"changeConfiguration,omitempty"`
+	Steps               []ConfigurationStep `json:"steps"`
+}
+
+// ConfigurationStep is the translation of one setting of a configuration plan
+type ConfigurationStep struct {
+	Source      string `json:"source"` // OCPP 1.6 key, or OCPP 2.0.1 component, instance and variable joined by dots
+	Value       string `json:"value,omitempty"`
+	Target      string `json:"target,omitempty"`
+	TargetValue string `json:"targetValue,omitempty"`
+	Action      string `json:"action"` // Apply, Verify for read-only targets, Manual or Unmapped
+	Note        string `json:"note,omitempty"`
+}
+
+// MacroRun represents the execution of a macro against a set of charge points
+type MacroRun struct {
+	ID             int        `json:"id"`
+	MacroID        string     `json:"macroId"`
+	ChargePointIDs []string   `json:"chargePointIds"`
+	Status         string     `json:"status"` // Running, Completed, Failed
+	Actor          string     `json:"actor"`
+	Commands       []*Command `json:"commands,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	CompletedAt    time.Time  `json:"completedAt,omitempty"`
+}
+
+// Session ties together everything belonging to one charging session by its session ID
+type Session struct {
+	ID          string        `json:"id"`
+	Transaction *Transaction  `json:"transaction,omitempty"`
+	Commands    []*Command    `json:"commands"`
+	MeterValues []*MeterValue `json:"meterValues"`
+}
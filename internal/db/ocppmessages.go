@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetOCPPMessages retrieves a page of the OCPP messages logged for a charge point, newest first,
+// and the total number of its logged messages
+func (s *PostgresStore) GetOCPPMessages(ctx context.Context, chargePointID string, page Page) ([]*models.OCPPMessage, int, error) {
+	scope := `charge_point_id = $1 AND charge_point_id IN (
+			SELECT id FROM charge_points WHERE ` + tenantScope("tenant_id", 2) + `
+		)`
+
+	var total int
+	if err := s.pool.QueryRow(ctx, `SELECT COUNT(*) FROM ocpp_messages WHERE `+scope, chargePointID, TenantFromContext(ctx)).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT id, charge_point_id, message_type, action, request_id, COALESCE(api_request_id, ''), payload, direction, timestamp
+		FROM ocpp_messages
+		WHERE ` + scope + `
+		ORDER BY id DESC
+		` + pageClause(3) + `
+	`
+
+	rows, err := s.pool.Query(ctx, query, chargePointID, TenantFromContext(ctx), page.Limit, page.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var messages []*models.OCPPMessage
+	for rows.Next() {
+		msg := &models.OCPPMessage{}
+		var payload []byte
+		if err := rows.Scan(&msg.ID, &msg.ChargePointID, &msg.MessageType, &msg.Action,
+			&msg.RequestID, &msg.APIRequestID, &payload, &msg.Direction, &msg.Timestamp); err != nil {
+			return nil, 0, err
+		}
+		msg.Payload = string(payload)
+		messages = append(messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return messages, total, nil
+}
+
+// OldestOCPPMessageTime returns the timestamp of the oldest logged OCPP message, false if there are none
+func (s *PostgresStore) OldestOCPPMessageTime(ctx context.Context) (time.Time, bool, error) {
+	var oldest sql.NullTime
+	if err := s.pool.QueryRow(ctx, `SELECT MIN(timestamp) FROM ocpp_messages`).Scan(&oldest); err != nil {
+		return time.Time{}, false, err
+	}
+	return oldest.Time, oldest.Valid, nil
+}
+
+// StreamOCPPMessages calls fn for every OCPP message logged in [from, to), ordered by ID.
+// The payload is passed on as the raw JSON stored in the database.
+func (s *PostgresStore) StreamOCPPMessages(ctx context.Context, from, to time.Time, fn func(*models.OCPPMessage) error) error {
+	query := `SELECT id, charge_point_id, message_type, action, request_id, COALESCE(api_request_id, ''), payload, direction, timestamp
+		FROM ocpp_messages
+		WHERE timestamp >= $1 AND timestamp < $2
+		ORDER BY id
+	`
+
+	return s.streamCursor(ctx, query, []interface{}{from, to}, func(rows pgx.Rows) error {
+		var msg models.OCPPMessage
+		var payload []byte
+		if err := rows.Scan(&msg.ID, &msg.ChargePointID, &msg.MessageType, &msg.Action,
+			&msg.RequestID, &msg.APIRequestID, &payload, &msg.Direction, &msg.Timestamp); err != nil {
+			return err
+		}
+		msg.Payload = string(payload)
+		return fn(&msg)
+	})
+}
+
+// DeleteOCPPMessages deletes the OCPP messages logged in [from, to) with an ID up to maxID,
+// so messages that arrived after they were archived are kept
+func (s *PostgresStore) DeleteOCPPMessages(ctx context.Context, from, to time.Time, maxID int) (int64, error) {
+	result, err := s.pool.Exec(ctx, `
+		DELETE FROM ocpp_messages
+		WHERE timestamp >= $1 AND timestamp < $2 AND id <= $3
+	`, from, to, maxID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// QuarantineMessage stores an inbound OCPP frame that failed parsing or validation
+func (s *PostgresStore) QuarantineMessage(ctx context.Context, msg *models.QuarantinedMessage) error {
+	query := `
+		INSERT INTO quarantined_messages (charge_point_id, action, payload, error, received_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+		RETURNING id
+	`
+
+	return s.pool.QueryRow(ctx, query, msg.ChargePointID, msg.Action, msg.Payload, msg.Error, msg.ReceivedAt).Scan(&msg.ID)
+}
+
+// GetQuarantinedMessages retrieves a page of the quarantined OCPP messages matching a filter, newest first,
+// and the total number of matching messages
+func (s *PostgresStore) GetQuarantinedMessages(ctx context.Context, filter QuarantineFilter, page Page) ([]*models.QuarantinedMessage, int, error) {
+	c := quarantineConditions(filter)
+
+	var total int
+	if err := s.pool.QueryRow(ctx, `SELECT COUNT(*) FROM quarantined_messages WHERE `+c.String(), c.args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT id, charge_point_id, COALESCE(action, ''), payload, error, received_at, reviewed_at, COALESCE(reviewed_by, '')
+		FROM quarantined_messages
+		WHERE ` + c.String() + `
+		ORDER BY id DESC
+		` + pageClause(len(c.args)+1) + `
+	`
+
+	rows, err := s.pool.Query(ctx, query, append(c.args, page.Limit, page.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var messages []*models.QuarantinedMessage
+	for rows.Next() {
+		msg := &models.QuarantinedMessage{}
+		var reviewedAt sql.NullTime
+		if err := rows.Scan(&msg.ID, &msg.ChargePointID, &msg.Action, &msg.Payload, &msg.Error,
+			&msg.ReceivedAt, &reviewedAt, &msg.ReviewedBy); err != nil {
+			return nil, 0, err
+		}
+		msg.ReviewedAt = reviewedAt.Time
+		messages = append(messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return messages, total, nil
+}
+
+// ReviewQuarantinedMessage marks a quarantined OCPP message as reviewed by an actor
+func (s *PostgresStore) ReviewQuarantinedMessage(ctx context.Context, id int, actor string) error {
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE quarantined_messages
+		SET reviewed_at = $1, reviewed_by = $2
+		WHERE id = $3
+	`, time.Now(), actor, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteQuarantinedMessages deletes the quarantined OCPP messages received before a time
+func (s *PostgresStore) DeleteQuarantinedMessages(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.pool.Exec(ctx, `DELETE FROM quarantined_messages WHERE received_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,14 @@
+package db
+
+import "fmt"
+
+// Page selects a window of a list in the list's order. A zero Limit selects all rows from Offset on.
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+// pageClause returns the LIMIT and OFFSET clause of a page whose limit is parameter n and offset parameter n+1
+func pageClause(n int) string {
+	return fmt.Sprintf("LIMIT NULLIF($%d::int, 0) OFFSET $%d", n, n+1)
+}
@@ -0,0 +1,246 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// meterValuePartition returns the name of the monthly meter_values partition starting at month
+func meterValuePartition(month time.Time) string {
+	return "meter_values_" + month.Format("2006_01")
+}
+
+// monthStart returns the first instant of the month of t in UTC
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// EnsureMeterValuePartition creates the meter_values partition of the month containing t if it doesn't exist.
+// Samples already stored in the default partition for that month are moved into it.
+// TimescaleDB creates hypertable chunks on insert, so nothing is done in Timescale mode.
+func (s *PostgresStore) EnsureMeterValuePartition(ctx context.Context, t time.Time) error {
+	if s.timescale {
+		return nil
+	}
+
+	from := monthStart(t)
+	to := from.AddDate(0, 1, 0)
+	name := meterValuePartition(from)
+
+	var exists bool
+	if err := s.pool.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	table := pgx.Identifier{name}.Sanitize()
+	if _, err := tx.Exec(ctx, `CREATE TABLE `+table+` (LIKE meter_values INCLUDING DEFAULTS INCLUDING CONSTRAINTS)`); err != nil {
+		return err
+	}
+
+	moveQuery := `
+		WITH moved AS (
+			DELETE FROM meter_values_default WHERE timestamp >= $1 AND timestamp < $2 RETURNING *
+		)
+		INSERT INTO ` + table + ` SELECT * FROM moved
+	`
+	if _, err := tx.Exec(ctx, moveQuery, from, to); err != nil {
+		return err
+	}
+
+	attachQuery := fmt.Sprintf(`ALTER TABLE meter_values ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')`,
+		table, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	if _, err := tx.Exec(ctx, attachQuery); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// PruneMeterValues removes raw meter values sampled before the cutoff.
+// Whole monthly partitions ending before the cutoff are dropped; older samples in the default partition are deleted.
+// If bucketMinutes is positive the samples are first downsampled into meter_value_aggregates.
+// It returns the names of the dropped partitions, or hypertable chunks in Timescale mode.
+func (s *PostgresStore) PruneMeterValues(ctx context.Context, cutoff time.Time, bucketMinutes int) ([]string, error) {
+	if s.timescale {
+		return s.pruneMeterValueChunks(ctx, cutoff, bucketMinutes)
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'meter_values'::regclass AND c.relname ~ '^meter_values_[0-9]{4}_[0-9]{2}$'
+		ORDER BY c.relname
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		month, err := time.Parse("meter_values_2006_01", name)
+		if err != nil {
+			continue
+		}
+		if !month.AddDate(0, 1, 0).After(cutoff) {
+			expired = append(expired, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var dropped []string
+	for _, name := range expired {
+		if err := s.pruneMeterValueTable(ctx, name, time.Time{}, bucketMinutes, true); err != nil {
+			return dropped, err
+		}
+		dropped = append(dropped, name)
+	}
+
+	if err := s.pruneMeterValueTable(ctx, "meter_values_default", cutoff, bucketMinutes, false); err != nil {
+		return dropped, err
+	}
+
+	return dropped, nil
+}
+
+// pruneMeterValueTable downsamples and then drops a partition, or deletes its samples before the cutoff
+func (s *PostgresStore) pruneMeterValueTable(ctx context.Context, name string, cutoff time.Time, bucketMinutes int, drop bool) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	table := pgx.Identifier{name}.Sanitize()
+	condition := `TRUE`
+	args := []interface{}{}
+	if !drop {
+		condition = `timestamp < $1`
+		args = append(args, cutoff)
+	}
+
+	if err := downsampleMeterValues(ctx, tx, table, condition, args, bucketMinutes); err != nil {
+		return err
+	}
+
+	if drop {
+		if _, err := tx.Exec(ctx, `DROP TABLE `+table); err != nil {
+			return err
+		}
+	} else {
+		if _, err := tx.Exec(ctx, `DELETE FROM `+table+` WHERE `+condition, args...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// pruneMeterValueChunks downsamples and then drops the meter_values hypertable chunks ending before the cutoff
+func (s *PostgresStore) pruneMeterValueChunks(ctx context.Context, cutoff time.Time, bucketMinutes int) ([]string, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT chunk_schema, chunk_name, range_end
+		FROM timescaledb_information.chunks
+		WHERE hypertable_name = 'meter_values' AND range_end <= $1
+		ORDER BY range_end
+	`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	type chunk struct {
+		schema, name string
+		end          time.Time
+	}
+	var expired []chunk
+	for rows.Next() {
+		var c chunk
+		if err := rows.Scan(&c.schema, &c.name, &c.end); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		expired = append(expired, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var dropped []string
+	for _, c := range expired {
+		if err := s.dropMeterValueChunk(ctx, c.schema, c.name, c.end, bucketMinutes); err != nil {
+			return dropped, err
+		}
+		dropped = append(dropped, c.name)
+	}
+
+	return dropped, nil
+}
+
+// dropMeterValueChunk downsamples and then drops a hypertable chunk ending at end.
+// Chunks are dropped oldest first, so drop_chunks only removes this one.
+func (s *PostgresStore) dropMeterValueChunk(ctx context.Context, schema, name string, end time.Time, bucketMinutes int) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	table := pgx.Identifier{schema, name}.Sanitize()
+	if err := downsampleMeterValues(ctx, tx, table, `TRUE`, nil, bucketMinutes); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `SELECT drop_chunks('meter_values', older_than => $1::timestamptz)`, end); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// downsampleMeterValues aggregates the samples of a table matching condition into meter_value_aggregates
+// buckets of bucketMinutes. Nothing is kept if bucketMinutes is 0.
+func downsampleMeterValues(ctx context.Context, tx pgx.Tx, table, condition string, args []interface{}, bucketMinutes int) error {
+	if bucketMinutes <= 0 {
+		return nil
+	}
+
+	bucket := bucketMinutes * 60
+	query := fmt.Sprintf(`
+		INSERT INTO meter_value_aggregates (
+			charge_point_id, connector_id, transaction_id, session_id, measurand, unit,
+			bucket_start, bucket_minutes, avg_value, min_value, max_value, samples
+		)
+		SELECT
+			charge_point_id, connector_id, transaction_id, session_id, measurand, unit,
+			to_timestamp(floor(extract(epoch FROM timestamp) / %[1]d) * %[1]d), %[2]d,
+			avg(value), min(value), max(value), count(*)
+		FROM %[3]s
+		WHERE %[4]s
+		GROUP BY 1, 2, 3, 4, 5, 6, 7
+	`, bucket, bucketMinutes, table, condition)
+	_, err := tx.Exec(ctx, query, args...)
+	return err
+}
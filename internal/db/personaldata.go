@@ -0,0 +1,209 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// ocppPayload is the JSON object of a logged OCPP message, whose payload is stored as a JSON string
+const ocppPayload = `(CASE WHEN jsonb_typeof(payload) = 'string' THEN (payload #>> '{}')::jsonb ELSE payload END)`
+
+// mentionsIdTag matches the logged OCPP messages carrying the idTag in $1, as the idTag of a request
+// or the parent idTag of a confirmation
+const mentionsIdTag = `(` + ocppPayload + ` ->> 'idTag' = $1 OR ` + ocppPayload + ` #>> '{idTagInfo,parentIdTag}' = $1)`
+
+// tenantChargePoints matches the rows of the charge points owned by the tenant in $2, or of the charge points
+// not assigned to a tenant if $2 is empty
+const tenantChargePoints = `charge_point_id IN (SELECT id FROM charge_points WHERE tenant_id IS NOT DISTINCT FROM NULLIF($2, ''))`
+
+// quarantinedMentionsIdTag matches the quarantined OCPP messages carrying the idTag in $1 as a JSON string
+// anywhere in their payload, which isn't necessarily valid JSON
+const quarantinedMentionsIdTag = `position(to_json($1::text)::text in payload) > 0`
+
+// GetIdTagOCPPMessages retrieves the logged OCPP messages carrying an idTag, oldest first
+func (s *PostgresStore) GetIdTagOCPPMessages(ctx context.Context, idTag string) ([]*models.OCPPMessage, error) {
+	query := `SELECT id, charge_point_id, message_type, action, request_id, COALESCE(api_request_id, ''), payload, direction, timestamp
+		FROM ocpp_messages
+		WHERE ` + mentionsIdTag + `
+		ORDER BY id
+	`
+
+	rows, err := s.pool.Query(ctx, query, idTag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*models.OCPPMessage
+	for rows.Next() {
+		msg := &models.OCPPMessage{}
+		var payload []byte
+		if err := rows.Scan(&msg.ID, &msg.ChargePointID, &msg.MessageType, &msg.Action,
+			&msg.RequestID, &msg.APIRequestID, &payload, &msg.Direction, &msg.Timestamp); err != nil {
+			return nil, err
+		}
+		msg.Payload = string(payload)
+		messages = append(messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// GetIdTagQuarantinedMessages retrieves the quarantined OCPP messages carrying an idTag, oldest first
+func (s *PostgresStore) GetIdTagQuarantinedMessages(ctx context.Context, idTag string) ([]*models.QuarantinedMessage, error) {
+	query := `SELECT id, charge_point_id, COALESCE(action, ''), payload, error, received_at, reviewed_at, COALESCE(reviewed_by, '')
+		FROM quarantined_messages
+		WHERE ` + quarantinedMentionsIdTag + `
+		ORDER BY id
+	`
+
+	rows, err := s.pool.Query(ctx, query, idTag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*models.QuarantinedMessage
+	for rows.Next() {
+		msg := &models.QuarantinedMessage{}
+		var reviewedAt sql.NullTime
+		if err := rows.Scan(&msg.ID, &msg.ChargePointID, &msg.Action, &msg.Payload, &msg.Error,
+			&msg.ReceivedAt, &reviewedAt, &msg.ReviewedBy); err != nil {
+			return nil, err
+		}
+		msg.ReviewedAt = reviewedAt.Time
+		messages = append(messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// ErasePersonalData erases an idTag within the erasure's tenant in one transaction: its transactions and the commands
+// sent to the tenant's charge points are anonymized with the erasure's pseudonym, its registration, pending sessions
+// and logged and quarantined OCPP messages of the tenant's charge points are deleted, and the erasure is recorded
+// with the number of affected rows. An empty tenant erases the idTag on the charge points not assigned to a tenant.
+// The same idTag in other tenants is left alone.
+func (s *PostgresStore) ErasePersonalData(ctx context.Context, idTag string, erasure *models.Erasure) error {
+	if erasure.ErasedAt.IsZero() {
+		erasure.ErasedAt = time.Now()
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE transactions
+		SET id_tag = $3, vehicle_mac = NULL, vehicle_vin = NULL, updated_at = $4
+		WHERE id_tag = $1 AND tenant_id IS NOT DISTINCT FROM NULLIF($2, '')
+	`, idTag, erasure.TenantID, erasure.Pseudonym, erasure.ErasedAt)
+	if err != nil {
+		return err
+	}
+	erasure.TransactionsAnonymized = int(tag.RowsAffected())
+
+	tag, err = tx.Exec(ctx, `
+		UPDATE commands
+		SET payload = jsonb_set(payload, '{idTag}', to_jsonb($3::text))
+		WHERE payload ->> 'idTag' = $1 AND `+tenantChargePoints+`
+	`, idTag, erasure.TenantID, erasure.Pseudonym)
+	if err != nil {
+		return err
+	}
+	erasure.CommandsAnonymized = int(tag.RowsAffected())
+
+	tag, err = tx.Exec(ctx, `DELETE FROM id_tags WHERE id_tag = $1 AND tenant_id = $2`, idTag, erasure.TenantID)
+	if err != nil {
+		return err
+	}
+	erasure.IdTagsDeleted = int(tag.RowsAffected())
+
+	// idTags grouped under the erased one stay grouped under its pseudonym
+	if _, err := tx.Exec(ctx, `UPDATE id_tags SET parent_id_tag = $3 WHERE parent_id_tag = $1 AND tenant_id = $2`,
+		idTag, erasure.TenantID, erasure.Pseudonym); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM pending_sessions WHERE id_tag = $1 AND `+tenantChargePoints, idTag, erasure.TenantID); err != nil {
+		return err
+	}
+
+	tag, err = tx.Exec(ctx, `DELETE FROM ocpp_messages WHERE `+mentionsIdTag+` AND `+tenantChargePoints, idTag, erasure.TenantID)
+	if err != nil {
+		return err
+	}
+	erasure.MessagesDeleted = int(tag.RowsAffected())
+
+	tag, err = tx.Exec(ctx, `DELETE FROM quarantined_messages WHERE `+quarantinedMentionsIdTag+` AND `+tenantChargePoints,
+		idTag, erasure.TenantID)
+	if err != nil {
+		return err
+	}
+	erasure.MessagesDeleted += int(tag.RowsAffected())
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO erasures (
+			tenant_id, id_tag_hash, pseudonym, actor, reason, transactions_anonymized, commands_anonymized,
+			id_tags_deleted, messages_deleted, erased_at
+		) VALUES (NULLIF($1, ''), $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10)
+		RETURNING id
+	`,
+		erasure.TenantID, erasure.IdTagHash, erasure.Pseudonym, erasure.Actor, erasure.Reason, erasure.TransactionsAnonymized,
+		erasure.CommandsAnonymized, erasure.IdTagsDeleted, erasure.MessagesDeleted, erasure.ErasedAt,
+	).Scan(&erasure.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetErasures retrieves the most recent erasures
+func (s *PostgresStore) GetErasures(ctx context.Context, limit int) ([]*models.Erasure, error) {
+	query := `
+		SELECT id, COALESCE(tenant_id, ''), id_tag_hash, pseudonym, actor, reason, transactions_anonymized,
+			commands_anonymized, id_tags_deleted, messages_deleted, erased_at
+		FROM erasures
+		ORDER BY erased_at DESC, id DESC
+		LIMIT $1
+	`
+
+	rows, err := s.pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var erasures []*models.Erasure
+	for rows.Next() {
+		e := &models.Erasure{}
+		var reason sql.NullString
+		if err := rows.Scan(
+			&e.ID, &e.TenantID, &e.IdTagHash, &e.Pseudonym, &e.Actor, &reason, &e.TransactionsAnonymized,
+			&e.CommandsAnonymized, &e.IdTagsDeleted, &e.MessagesDeleted, &e.ErasedAt,
+		); err != nil {
+			return nil, err
+		}
+		e.Reason = reason.String
+		erasures = append(erasures, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return erasures, nil
+}
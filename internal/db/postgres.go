@@ -9,33 +9,73 @@ import (
 
 	"github.com/balu-dk/go-cpms/config"
 	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/sirupsen/logrus"
 )
 
 // PostgresStore handles database operations
 type PostgresStore struct {
-	pool *pgxpool.Pool
+	pool      *pgxpool.Pool
+	stop      chan struct{}
+	timescale bool // Telemetry tables are TimescaleDB hypertables
 }
 
-// NewPostgresStore initializes a new PostgreSQL connection pool
+// NewPostgresStore initializes a new PostgreSQL connection pool.
+// The database is retried with exponential backoff so the server can start before Postgres is up.
 func NewPostgresStore(cfg *config.Config) (*PostgresStore, error) {
 	ctx := context.Background()
-	pool, err := pgxpool.New(ctx, cfg.GetDSN())
+
+	poolConfig, err := pgxpool.ParseConfig(cfg.GetDSN())
+	if err != nil {
+		return nil, fmt.Errorf("invalid database configuration: %v", err)
+	}
+	healthCheckInterval := time.Duration(cfg.DBHealthCheckInterval) * time.Second
+	if healthCheckInterval > 0 {
+		poolConfig.HealthCheckPeriod = healthCheckInterval
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %v", err)
 	}
 
 	// Test the connection
-	if err := pool.Ping(ctx); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %v", err)
+	backoff := time.Duration(cfg.DBConnectBackoff) * time.Second
+	for attempt := 1; ; attempt++ {
+		err = pool.Ping(ctx)
+		if err == nil {
+			break
+		}
+		if attempt > cfg.DBConnectRetries {
+			pool.Close()
+			return nil, fmt.Errorf("failed to ping database: %v", err)
+		}
+
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"attempt": attempt,
+			"retryIn": backoff,
+		}).Warn("Database not available, retrying")
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
 	}
 
-	return &PostgresStore{pool: pool}, nil
+	s := &PostgresStore{pool: pool, stop: make(chan struct{}), timescale: cfg.TimescaleEnabled}
+	go s.monitorHealth(healthCheckInterval)
+
+	return s, nil
 }
 
 // Close closes the database connection pool
 func (s *PostgresStore) Close() {
+	if s.stop != nil {
+		close(s.stop)
+	}
 	if s.pool != nil {
 		s.pool.Close()
 	}
@@ -75,76 +115,127 @@ func (s *PostgresStore) SaveChargePoint(ctx context.Context, cp *models.ChargePo
 	return err
 }
 
-// GetChargePoint retrieves a charge point by its ID
-func (s *PostgresStore) GetChargePoint(ctx context.Context, id string) (*models.ChargePoint, error) {
-	query := `
-		SELECT 
-			id, vendor, model, serial_number, firmware_version,
-			last_heartbeat, registration_status, connected_since, is_connected,
-			created_at, updated_at
-		FROM charge_points
-		WHERE id = $1
-	`
+const chargePointColumns = `
+	id, vendor, model, serial_number, firmware_version,
+	last_heartbeat, registration_status, connected_since, is_connected,
+	site_id, tenant_id, free_vend, spot_opt_out, created_at, updated_at,
+	remote_addr, subprotocol, connection_headers, clock_drift_ms, clock_drift_at, clock_drift_flagged,
+	reboot_loop_since
+`
 
+func scanChargePoint(row rowScanner) (*models.ChargePoint, error) {
 	cp := &models.ChargePoint{}
-	err := s.pool.QueryRow(ctx, query, id).Scan(
+	var siteID, tenantID, remoteAddr, subprotocol sql.NullString
+	var headers []byte
+	var clockDriftAt, rebootLoopSince sql.NullTime
+	err := row.Scan(
 		&cp.ID, &cp.Vendor, &cp.Model, &cp.SerialNumber, &cp.FirmwareVersion,
 		&cp.LastHeartbeat, &cp.RegistrationStatus, &cp.ConnectedSince, &cp.IsConnected,
-		&cp.CreatedAt, &cp.UpdatedAt,
+		&siteID, &tenantID, &cp.FreeVend, &cp.SpotOptOut, &cp.CreatedAt, &cp.UpdatedAt,
+		&remoteAddr, &subprotocol, &headers, &cp.ClockDriftMs, &clockDriftAt, &cp.ClockDriftFlagged,
+		&rebootLoopSince,
 	)
 	if err != nil {
 		return nil, err
 	}
+	cp.SiteID = siteID.String
+	cp.TenantID = tenantID.String
+	cp.RemoteAddr = remoteAddr.String
+	cp.Subprotocol = subprotocol.String
+	cp.ClockDriftAt = clockDriftAt.Time
+	cp.RebootLoopSince = rebootLoopSince.Time
+	if headers != nil {
+		if err := json.Unmarshal(headers, &cp.ConnectionHeaders); err != nil {
+			return nil, err
+		}
+	}
 	return cp, nil
 }
 
-// GetAllChargePoints retrieves all charge points
-func (s *PostgresStore) GetAllChargePoints(ctx context.Context) ([]*models.ChargePoint, error) {
-	query := `
-		SELECT 
-			id, vendor, model, serial_number, firmware_version,
-			last_heartbeat, registration_status, connected_since, is_connected,
-			created_at, updated_at
+// GetChargePoint retrieves a charge point by its ID
+func (s *PostgresStore) GetChargePoint(ctx context.Context, id string) (*models.ChargePoint, error) {
+	query := `SELECT ` + chargePointColumns + `
 		FROM charge_points
-		ORDER BY created_at DESC
+		WHERE id = $1 AND ` + tenantScope("tenant_id", 2) + `
 	`
 
-	rows, err := s.pool.Query(ctx, query)
+	return notFound(scanChargePoint(s.pool.QueryRow(ctx, query, id, TenantFromContext(ctx))))
+}
+
+// GetChargePoints retrieves a page of the charge points matching a filter, newest first unless sorted otherwise,
+// and the total number of matching charge points
+func (s *PostgresStore) GetChargePoints(ctx context.Context, filter ChargePointFilter, sort Sort, page Page) ([]*models.ChargePoint, int, error) {
+	order, err := orderClause(sort, chargePointSortColumns, "created_at DESC, id")
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	c := chargePointConditions(filter, TenantFromContext(ctx))
+
+	var total int
+	if err := s.pool.QueryRow(ctx, `SELECT COUNT(*) FROM charge_points WHERE `+c.String(), c.args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT ` + chargePointColumns + `
+		FROM charge_points
+		WHERE ` + c.String() + `
+		` + order + `
+		` + pageClause(len(c.args)+1) + `
+	`
+
+	rows, err := s.pool.Query(ctx, query, append(c.args, page.Limit, page.Offset)...)
+	if err != nil {
+		return nil, 0, err
 	}
 	defer rows.Close()
 
 	var chargePoints []*models.ChargePoint
 	for rows.Next() {
-		cp := &models.ChargePoint{}
-		if err := rows.Scan(
-			&cp.ID, &cp.Vendor, &cp.Model, &cp.SerialNumber, &cp.FirmwareVersion,
-			&cp.LastHeartbeat, &cp.RegistrationStatus, &cp.ConnectedSince, &cp.IsConnected,
-			&cp.CreatedAt, &cp.UpdatedAt,
-		); err != nil {
-			return nil, err
+		cp, err := scanChargePoint(rows)
+		if err != nil {
+			return nil, 0, err
 		}
 		chargePoints = append(chargePoints, cp)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return chargePoints, nil
+	return chargePoints, total, nil
 }
 
-// SaveConnector creates or updates a connector
+// occupiedStatuses are the connector statuses in which a vehicle is plugged in
+const occupiedStatuses = `('Preparing', 'Charging', 'SuspendedEV', 'SuspendedEVSE', 'Finishing')`
+
+// SaveConnector creates or updates a connector.
+// The plug-in time is tracked from the first occupied status until the connector is released,
+// the status time from the first notification of a status until the status changes.
 func (s *PostgresStore) SaveConnector(ctx context.Context, connector *models.Connector) error {
 	query := `
 		INSERT INTO connectors (
-			id, charge_point_id, status, error_code, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6)
+			id, charge_point_id, status, error_code, info, vendor_id, vendor_error_code,
+			occupied_since, status_since, created_at, updated_at
+		) VALUES (
+			$1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''),
+			CASE WHEN $3 IN ` + occupiedStatuses + ` THEN $9::timestamptz END, $9, $8, $9
+		)
 		ON CONFLICT (charge_point_id, id) DO UPDATE SET
 			status = $3,
 			error_code = $4,
-			updated_at = $6
+			info = NULLIF($5, ''),
+			vendor_id = NULLIF($6, ''),
+			vendor_error_code = NULLIF($7, ''),
+			occupied_since = CASE
+				WHEN $3 NOT IN ` + occupiedStatuses + ` THEN NULL
+				ELSE COALESCE(connectors.occupied_since, $9::timestamptz)
+			END,
+			status_since = CASE
+				WHEN connectors.status = $3 THEN COALESCE(connectors.status_since, $9::timestamptz)
+				ELSE $9::timestamptz
+			END,
+			updated_at = $9
 	`
 
 	now := time.Now()
@@ -155,22 +246,135 @@ func (s *PostgresStore) SaveConnector(ctx context.Context, connector *models.Con
 
 	_, err := s.pool.Exec(ctx, query,
 		connector.ID, connector.ChargePointID, connector.Status, connector.ErrorCode,
+		connector.Info, connector.VendorID, connector.VendorErrorCode,
 		connector.CreatedAt, connector.UpdatedAt,
 	)
 	return err
 }
 
-// GetConnectors retrieves all connectors for a charge point
-func (s *PostgresStore) GetConnectors(ctx context.Context, chargePointID string) ([]*models.Connector, error) {
+// TouchConnector records that a connector confirmed its stored status, without changing it
+func (s *PostgresStore) TouchConnector(ctx context.Context, chargePointID string, connectorID int) error {
+	query := `
+		UPDATE connectors
+		SET updated_at = $1
+		WHERE charge_point_id = $2 AND id = $3
+	`
+
+	_, err := s.pool.Exec(ctx, query, time.Now(), chargePointID, connectorID)
+	return err
+}
+
+// SaveConnectorAttributes updates the operator-maintained attributes of a connector. Connectors that have not
+// reported a status yet are created with status Unknown.
+func (s *PostgresStore) SaveConnectorAttributes(ctx context.Context, connector *models.Connector) error {
+	query := `
+		INSERT INTO connectors (
+			id, charge_point_id, status, error_code, plug_type, format, max_power_kw, phases, created_at, updated_at
+		)
+		SELECT $1, id, 'Unknown', 'NoError', NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7, $7
+		FROM charge_points
+		WHERE id = $2
+		ON CONFLICT (charge_point_id, id) DO UPDATE SET
+			plug_type = NULLIF($3, ''),
+			format = NULLIF($4, ''),
+			max_power_kw = $5,
+			phases = $6,
+			updated_at = $7
+	`
+
+	connector.UpdatedAt = time.Now()
+
+	tag, err := s.pool.Exec(ctx, query,
+		connector.ID, connector.ChargePointID, connector.PlugType, connector.Format,
+		connector.MaxPowerKW, connector.Phases, connector.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CreateMissingConnectors creates the connectors numbered 1 to count of a charge point that do not exist yet,
+// with status Unknown, and returns the number created
+func (s *PostgresStore) CreateMissingConnectors(ctx context.Context, chargePointID string, count int) (int, error) {
+	query := `
+		INSERT INTO connectors (id, charge_point_id, status, error_code, created_at, updated_at)
+		SELECT n, $1, 'Unknown', 'NoError', $3, $3
+		FROM generate_series(1, $2::int) AS n
+		ON CONFLICT (charge_point_id, id) DO NOTHING
+	`
+
+	tag, err := s.pool.Exec(ctx, query, chargePointID, count, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// GetConnectors retrieves a page of the connectors of a charge point, ordered by ID, and the total number of its connectors
+func (s *PostgresStore) GetConnectors(ctx context.Context, chargePointID string, page Page) ([]*models.Connector, int, error) {
+	scope := `charge_point_id = $1 AND charge_point_id IN (
+			SELECT id FROM charge_points WHERE ` + tenantScope("tenant_id", 2) + `
+		)`
+
+	var total int
+	if err := s.pool.QueryRow(ctx, `SELECT COUNT(*) FROM connectors WHERE `+scope, chargePointID, TenantFromContext(ctx)).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
 	query := `
 		SELECT 
-			id, charge_point_id, status, error_code, created_at, updated_at
+			id, charge_point_id, status, error_code, info, vendor_id, vendor_error_code,
+			occupied_since, status_since, created_at, updated_at,
+			COALESCE(plug_type, ''), COALESCE(format, ''), max_power_kw, phases
 		FROM connectors
-		WHERE charge_point_id = $1
+		WHERE ` + scope + `
 		ORDER BY id
+		` + pageClause(3) + `
+	`
+
+	connectors, err := s.queryConnectors(ctx, query, chargePointID, TenantFromContext(ctx), page.Limit, page.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return connectors, total, nil
+}
+
+// GetFaultedConnectors retrieves the connectors of all charge points that are Faulted or report an error code
+func (s *PostgresStore) GetFaultedConnectors(ctx context.Context) ([]*models.Connector, error) {
+	query := `
+		SELECT 
+			id, charge_point_id, status, error_code, info, vendor_id, vendor_error_code,
+			occupied_since, status_since, created_at, updated_at,
+			COALESCE(plug_type, ''), COALESCE(format, ''), max_power_kw, phases
+		FROM connectors
+		WHERE status = 'Faulted' OR error_code <> 'NoError'
+		ORDER BY charge_point_id, id
+	`
+
+	return s.queryConnectors(ctx, query)
+}
+
+// GetConnectorsByStatus retrieves the connectors of all charge points in a status
+func (s *PostgresStore) GetConnectorsByStatus(ctx context.Context, status string) ([]*models.Connector, error) {
+	query := `
+		SELECT 
+			id, charge_point_id, status, error_code, info, vendor_id, vendor_error_code,
+			occupied_since, status_since, created_at, updated_at,
+			COALESCE(plug_type, ''), COALESCE(format, ''), max_power_kw, phases
+		FROM connectors
+		WHERE status = $1
+		ORDER BY charge_point_id, id
 	`
 
-	rows, err := s.pool.Query(ctx, query, chargePointID)
+	return s.queryConnectors(ctx, query, status)
+}
+
+func (s *PostgresStore) queryConnectors(ctx context.Context, query string, args ...interface{}) ([]*models.Connector, error) {
+	rows, err := s.pool.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -179,12 +383,24 @@ func (s *PostgresStore) GetConnectors(ctx context.Context, chargePointID string)
 	var connectors []*models.Connector
 	for rows.Next() {
 		c := &models.Connector{}
+		var info, vendorID, vendorErrorCode sql.NullString
+		var occupiedSince, statusSince sql.NullTime
 		if err := rows.Scan(
-			&c.ID, &c.ChargePointID, &c.Status, &c.ErrorCode,
-			&c.CreatedAt, &c.UpdatedAt,
+			&c.ID, &c.ChargePointID, &c.Status, &c.ErrorCode, &info, &vendorID, &vendorErrorCode,
+			&occupiedSince, &statusSince, &c.CreatedAt, &c.UpdatedAt,
+			&c.PlugType, &c.Format, &c.MaxPowerKW, &c.Phases,
 		); err != nil {
 			return nil, err
 		}
+		c.Info = info.String
+		c.VendorID = vendorID.String
+		c.VendorErrorCode = vendorErrorCode.String
+		if occupiedSince.Valid {
+			c.OccupiedSince = occupiedSince.Time
+		}
+		if statusSince.Valid {
+			c.StatusSince = statusSince.Time
+		}
 		connectors = append(connectors, c)
 	}
 
@@ -195,13 +411,19 @@ func (s *PostgresStore) GetConnectors(ctx context.Context, chargePointID string)
 	return connectors, nil
 }
 
-// StartTransaction starts a new charging transaction
+// StartTransaction starts a new charging transaction and sets its ID, taken from the transaction ID sequence.
+// The transaction belongs to the tenant owning the charge point.
 func (s *PostgresStore) StartTransaction(ctx context.Context, tx *models.Transaction) error {
 	query := `
 		INSERT INTO transactions (
 			id, charge_point_id, connector_id, id_tag, 
-			start_time, meter_start, status, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			start_time, meter_start, status, created_at, updated_at, tenant_id, session_id,
+			offline_authorized, billing_review, free_vend, timestamp_adjusted, reported_start_time
+		) VALUES (
+			nextval('transactions_id_seq'), $1, $2, $3, $4, $5, $6, $7, $8,
+			(SELECT tenant_id FROM charge_points WHERE id = $1), NULLIF($9, '')::uuid, $10, $11, $12, $13, $14
+		)
+		RETURNING id
 	`
 
 	now := time.Now()
@@ -210,43 +432,190 @@ func (s *PostgresStore) StartTransaction(ctx context.Context, tx *models.Transac
 	}
 	tx.UpdatedAt = now
 
-	_, err := s.pool.Exec(ctx, query,
-		tx.ID, tx.ChargePointID, tx.ConnectorID, tx.IdTag,
-		tx.StartTime, tx.MeterStart, tx.Status, tx.CreatedAt, tx.UpdatedAt,
-	)
+	var reportedStartTime sql.NullTime
+	if !tx.ReportedStartTime.IsZero() {
+		reportedStartTime = sql.NullTime{Time: tx.ReportedStartTime, Valid: true}
+	}
+
+	return s.pool.QueryRow(ctx, query,
+		tx.ChargePointID, tx.ConnectorID, tx.IdTag,
+		tx.StartTime, tx.MeterStart, tx.Status, tx.CreatedAt, tx.UpdatedAt, tx.SessionID,
+		tx.OfflineAuthorized, tx.BillingReview, tx.FreeVend, tx.TimestampAdjusted, reportedStartTime,
+	).Scan(&tx.ID)
+}
+
+// StopTransaction updates a transaction when it's stopped.
+// An auto-stop reason recorded by the CPMS takes precedence over the reason reported by the charge point.
+// The end state of charge is the latest SoC reading until the charge point reports one for the end of the transaction.
+func (s *PostgresStore) StopTransaction(ctx context.Context, id int, endTime time.Time, meterStop int, reason string) error {
+	query := `
+		UPDATE transactions
+		SET end_time = $1, meter_stop = $2, status = 'Completed', stop_reason = COALESCE(stop_reason, NULLIF($3, '')),
+			end_soc = COALESCE(end_soc, current_soc), updated_at = $4
+		WHERE id = $5
+	`
+
+	_, err := s.pool.Exec(ctx, query, endTime, meterStop, reason, time.Now(), id)
 	return err
 }
 
-// StopTransaction updates a transaction when it's stopped
-func (s *PostgresStore) StopTransaction(ctx context.Context, id int, endTime time.Time, meterStop int) error {
+// RecordTransactionSoC records a state of charge reading of a transaction. The first reading is its start SoC,
+// and a reading for the end of the transaction its end SoC.
+func (s *PostgresStore) RecordTransactionSoC(ctx context.Context, id int, soc float64, end bool) error {
 	query := `
 		UPDATE transactions
-		SET end_time = $1, meter_stop = $2, status = 'Completed', updated_at = $3
+		SET start_soc = COALESCE(start_soc, $1), current_soc = $1, end_soc = CASE WHEN $2 THEN $1 ELSE end_soc END, updated_at = $3
 		WHERE id = $4
 	`
 
-	_, err := s.pool.Exec(ctx, query, endTime, meterStop, time.Now(), id)
+	_, err := s.pool.Exec(ctx, query, soc, end, time.Now(), id)
+	return err
+}
+
+// FlagAdjustedTimestamp marks a transaction as having an implausible timestamp replaced by the receive time,
+// and flags it for billing review
+func (s *PostgresStore) FlagAdjustedTimestamp(ctx context.Context, id int) error {
+	query := `
+		UPDATE transactions
+		SET timestamp_adjusted = TRUE, billing_review = TRUE, updated_at = $1
+		WHERE id = $2
+	`
+
+	_, err := s.pool.Exec(ctx, query, time.Now(), id)
 	return err
 }
 
+// GetOrphanedTransactions retrieves the in-progress transactions started before cutoff without a meter value
+// or a heartbeat of their charge point since, oldest first
+func (s *PostgresStore) GetOrphanedTransactions(ctx context.Context, cutoff time.Time) ([]*models.Transaction, error) {
+	query := `SELECT ` + transactionColumns + `
+		FROM transactions t
+		WHERE status = 'InProgress' AND start_time < $1
+			AND NOT EXISTS (SELECT 1 FROM meter_values mv WHERE mv.transaction_id = t.id AND mv.timestamp >= $1)
+			AND NOT EXISTS (SELECT 1 FROM charge_points cp WHERE cp.id = t.charge_point_id AND cp.last_heartbeat >= $1)
+		ORDER BY start_time
+	`
+
+	rows, err := s.pool.Query(ctx, query, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []*models.Transaction
+	for rows.Next() {
+		tx, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, tx)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+// CloseOrphanedTransaction closes an in-progress transaction the charge point never stopped with the Orphaned status.
+// It reports false if the transaction is no longer in progress.
+func (s *PostgresStore) CloseOrphanedTransaction(ctx context.Context, id int, endTime time.Time, meterStop int) (bool, error) {
+	query := `
+		UPDATE transactions
+		SET end_time = $1, meter_stop = $2, status = 'Orphaned', updated_at = $3
+		WHERE id = $4 AND status = 'InProgress'
+	`
+
+	tag, err := s.pool.Exec(ctx, query, endTime, meterStop, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ReconcileTransaction completes an in-progress transaction the charge point no longer has and flags it for billing review.
+// It reports false if the transaction is no longer in progress.
+func (s *PostgresStore) ReconcileTransaction(ctx context.Context, id int, endTime time.Time, meterStop int, reason string) (bool, error) {
+	query := `
+		UPDATE transactions
+		SET end_time = $1, meter_stop = $2, status = 'Completed', stop_reason = COALESCE(stop_reason, NULLIF($3, '')),
+			billing_review = TRUE, updated_at = $4
+		WHERE id = $5 AND status = 'InProgress'
+	`
+
+	tag, err := s.pool.Exec(ctx, query, endTime, meterStop, reason, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+const transactionColumns = `
+	id, charge_point_id, connector_id, id_tag,
+	start_time, end_time, meter_start, meter_stop, status,
+	max_cost, max_energy, stop_reason, tenant_id, COALESCE(session_id::text, ''), offline_authorized, billing_review,
+	free_vend, COALESCE(vehicle_mac, ''), COALESCE(vehicle_vin, ''), target_energy, departure_time, price_optimized,
+	spot_opt_out, timestamp_adjusted, reported_start_time, start_soc, current_soc, end_soc, created_at, updated_at
+`
+
+const meterValueColumns = `
+	id, COALESCE(transaction_id, 0), charge_point_id, connector_id, timestamp,
+	value, unit, measurand, COALESCE(context, ''), COALESCE(format, ''), COALESCE(phase, ''), COALESCE(location, ''),
+	COALESCE(session_id::text, ''), timestamp_adjusted, created_at
+`
+
+func scanMeterValue(row rowScanner) (*models.MeterValue, error) {
+	mv := &models.MeterValue{}
+	err := row.Scan(
+		&mv.ID, &mv.TransactionID, &mv.ChargePointID, &mv.ConnectorID, &mv.Timestamp,
+		&mv.Value, &mv.Unit, &mv.Measurand, &mv.Context, &mv.Format, &mv.Phase, &mv.Location,
+		&mv.SessionID, &mv.TimestampAdjusted, &mv.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return mv, nil
+}
+
 // GetTransaction retrieves a transaction by ID
 func (s *PostgresStore) GetTransaction(ctx context.Context, id int) (*models.Transaction, error) {
-	query := `
-		SELECT 
-			id, charge_point_id, connector_id, id_tag, 
-			start_time, end_time, meter_start, meter_stop, status, 
-			created_at, updated_at
+	query := `SELECT ` + transactionColumns + `
+		FROM transactions
+		WHERE id = $1 AND ` + tenantScope("tenant_id", 2) + `
+	`
+
+	return notFound(scanTransaction(s.pool.QueryRow(ctx, query, id, TenantFromContext(ctx))))
+}
+
+// FindStartedTransaction retrieves the transaction started with the given StartTransaction values, to detect retransmissions.
+// Start times replaced by the timestamp policy are matched by the start timestamp the charge point reported.
+func (s *PostgresStore) FindStartedTransaction(ctx context.Context, chargePointID string, connectorID int, idTag string, startTime time.Time, meterStart int) (*models.Transaction, error) {
+	query := `SELECT ` + transactionColumns + `
 		FROM transactions
-		WHERE id = $1
+		WHERE charge_point_id = $1 AND connector_id = $2 AND id_tag = $3 AND COALESCE(reported_start_time, start_time) = $4
+			AND meter_start = $5
+		ORDER BY id
+		LIMIT 1
 	`
 
+	return notFound(scanTransaction(s.pool.QueryRow(ctx, query, chargePointID, connectorID, idTag, startTime, meterStart)))
+}
+
+func scanTransaction(row rowScanner) (*models.Transaction, error) {
 	tx := &models.Transaction{}
 	var endTime sql.NullTime
 	var meterStop sql.NullInt32
-	err := s.pool.QueryRow(ctx, query, id).Scan(
+	var maxCost, maxEnergy sql.NullFloat64
+	var stopReason, tenantID sql.NullString
+	var targetEnergy, startSoC, currentSoC, endSoC sql.NullFloat64
+	var departureTime, reportedStartTime sql.NullTime
+	err := row.Scan(
 		&tx.ID, &tx.ChargePointID, &tx.ConnectorID, &tx.IdTag,
 		&tx.StartTime, &endTime, &tx.MeterStart, &meterStop, &tx.Status,
-		&tx.CreatedAt, &tx.UpdatedAt,
+		&maxCost, &maxEnergy, &stopReason, &tenantID, &tx.SessionID, &tx.OfflineAuthorized, &tx.BillingReview,
+		&tx.FreeVend, &tx.VehicleMAC, &tx.VehicleVIN, &targetEnergy, &departureTime, &tx.PriceOptimized,
+		&tx.SpotOptOut, &tx.TimestampAdjusted, &reportedStartTime, &startSoC, &currentSoC, &endSoC, &tx.CreatedAt, &tx.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -258,16 +627,143 @@ func (s *PostgresStore) GetTransaction(ctx context.Context, id int) (*models.Tra
 	if meterStop.Valid {
 		tx.MeterStop = int(meterStop.Int32)
 	}
+	tx.MaxCost = maxCost.Float64
+	tx.MaxEnergy = maxEnergy.Float64
+	tx.StopReason = stopReason.String
+	tx.TenantID = tenantID.String
+	tx.TargetEnergy = targetEnergy.Float64
+	tx.StartSoC = startSoC.Float64
+	tx.CurrentSoC = currentSoC.Float64
+	tx.EndSoC = endSoC.Float64
+	if departureTime.Valid {
+		tx.DepartureTime = departureTime.Time
+	}
+	if reportedStartTime.Valid {
+		tx.ReportedStartTime = reportedStartTime.Time
+	}
 
 	return tx, nil
 }
 
+// GetTransactions retrieves a page of the transactions matching a filter, most recently started first
+// unless sorted otherwise, and the total number of matching transactions
+func (s *PostgresStore) GetTransactions(ctx context.Context, filter TransactionFilter, sort Sort, page Page) ([]*models.Transaction, int, error) {
+	order, err := orderClause(sort, transactionSortColumns, "start_time DESC, id DESC")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	c := transactionConditions(filter, TenantFromContext(ctx))
+
+	var total int
+	if err := s.pool.QueryRow(ctx, `SELECT COUNT(*) FROM transactions WHERE `+c.String(), c.args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT ` + transactionColumns + `
+		FROM transactions
+		WHERE ` + c.String() + `
+		` + order + `
+		` + pageClause(len(c.args)+1) + `
+	`
+
+	rows, err := s.pool.Query(ctx, query, append(c.args, page.Limit, page.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var transactions []*models.Transaction
+	for rows.Next() {
+		tx, err := scanTransaction(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		transactions = append(transactions, tx)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return transactions, total, nil
+}
+
+// SetTransactionLimits sets the cost and energy caps of an in-progress transaction, 0 removes a cap
+func (s *PostgresStore) SetTransactionLimits(ctx context.Context, id int, maxCost, maxEnergy float64) error {
+	query := `
+		UPDATE transactions
+		SET max_cost = NULLIF($1, 0), max_energy = NULLIF($2, 0), updated_at = $3
+		WHERE id = $4 AND status = 'InProgress' AND ` + tenantScope("tenant_id", 5) + `
+	`
+
+	tag, err := s.pool.Exec(ctx, query, maxCost, maxEnergy, time.Now(), id, TenantFromContext(ctx))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetTransactionDeparture sets the energy an in-progress transaction needs by its departure time.
+// A zero target energy removes the departure schedule.
+func (s *PostgresStore) SetTransactionDeparture(ctx context.Context, id int, targetEnergy float64, departure time.Time, priceOptimized bool) error {
+	query := `
+		UPDATE transactions
+		SET target_energy = NULLIF($1, 0), departure_time = CASE WHEN $1 = 0 THEN NULL ELSE $2 END,
+			price_optimized = $3 AND $1 <> 0, updated_at = $4
+		WHERE id = $5 AND status = 'InProgress' AND ` + tenantScope("tenant_id", 6) + `
+	`
+
+	tag, err := s.pool.Exec(ctx, query, targetEnergy, departure, priceOptimized, time.Now(), id, TenantFromContext(ctx))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetTransactionStopReason records why the CPMS stopped a transaction, an empty reason clears it
+func (s *PostgresStore) SetTransactionStopReason(ctx context.Context, id int, reason string) error {
+	query := `
+		UPDATE transactions
+		SET stop_reason = NULLIF($1, ''), updated_at = $2
+		WHERE id = $3
+	`
+
+	_, err := s.pool.Exec(ctx, query, reason, time.Now(), id)
+	return err
+}
+
+// SetTransactionVehicle records the identifiers of the vehicle charged in a transaction.
+// Empty identifiers keep the recorded ones.
+func (s *PostgresStore) SetTransactionVehicle(ctx context.Context, id int, mac, vin string) error {
+	query := `
+		UPDATE transactions
+		SET vehicle_mac = COALESCE(NULLIF($1, ''), vehicle_mac), vehicle_vin = COALESCE(NULLIF($2, ''), vehicle_vin), updated_at = $3
+		WHERE id = $4
+	`
+
+	tag, err := s.pool.Exec(ctx, query, mac, vin, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 // LogOCPPMessage logs an OCPP message to the database
 func (s *PostgresStore) LogOCPPMessage(ctx context.Context, msg *models.OCPPMessage) error {
 	query := `
 		INSERT INTO ocpp_messages (
-			charge_point_id, message_type, action, request_id, payload, direction, timestamp
-		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+			charge_point_id, message_type, action, request_id, api_request_id, payload, direction, timestamp
+		) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8)
 	`
 
 	payload, err := json.Marshal(msg.Payload)
@@ -277,7 +773,7 @@ func (s *PostgresStore) LogOCPPMessage(ctx context.Context, msg *models.OCPPMess
 	}
 
 	_, err = s.pool.Exec(ctx, query,
-		msg.ChargePointID, msg.MessageType, msg.Action, msg.RequestID, payload, msg.Direction, msg.Timestamp,
+		msg.ChargePointID, msg.MessageType, msg.Action, msg.RequestID, msg.APIRequestID, payload, msg.Direction, msg.Timestamp,
 	)
 	return err
 }
@@ -286,13 +782,90 @@ func (s *PostgresStore) LogOCPPMessage(ctx context.Context, msg *models.OCPPMess
 func (s *PostgresStore) SaveMeterValue(ctx context.Context, mv *models.MeterValue) error {
 	query := `
 		INSERT INTO meter_values (
-			transaction_id, charge_point_id, connector_id, timestamp, value, unit, measurand, created_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			transaction_id, charge_point_id, connector_id, timestamp, value, unit, measurand, created_at, session_id,
+			timestamp_adjusted, context, format, phase, location
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, (SELECT session_id FROM transactions WHERE id = $1),
+			$9, NULLIF($10, ''), NULLIF($11, ''), NULLIF($12, ''), NULLIF($13, '')
+		)
 	`
 
 	_, err := s.pool.Exec(ctx, query,
 		mv.TransactionID, mv.ChargePointID, mv.ConnectorID, mv.Timestamp,
-		mv.Value, mv.Unit, mv.Measurand, time.Now(),
+		mv.Value, mv.Unit, mv.Measurand, time.Now(), mv.TimestampAdjusted,
+		mv.Context, mv.Format, mv.Phase, mv.Location,
+	)
+	return err
+}
+
+// SaveMeterValues saves the readings of a MeterValues message in a single COPY round trip.
+// The session of each reading is resolved from its transaction beforehand.
+func (s *PostgresStore) SaveMeterValues(ctx context.Context, batch []*models.MeterValue) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	sessions := make(map[int]string)
+	for _, mv := range batch {
+		if mv.TransactionID != 0 {
+			sessions[mv.TransactionID] = ""
+		}
+	}
+
+	if len(sessions) > 0 {
+		ids := make([]int, 0, len(sessions))
+		for id := range sessions {
+			ids = append(ids, id)
+		}
+
+		rows, err := s.pool.Query(ctx, `SELECT id, COALESCE(session_id::text, '') FROM transactions WHERE id = ANY($1)`, ids)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id int
+			var sessionID string
+			if err := rows.Scan(&id, &sessionID); err != nil {
+				rows.Close()
+				return err
+			}
+			sessions[id] = sessionID
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	_, err := s.pool.CopyFrom(ctx,
+		pgx.Identifier{"meter_values"},
+		[]string{
+			"transaction_id", "charge_point_id", "connector_id", "timestamp", "value", "unit", "measurand", "created_at", "session_id",
+			"timestamp_adjusted", "context", "format", "phase", "location",
+		},
+		pgx.CopyFromSlice(len(batch), func(i int) ([]interface{}, error) {
+			mv := batch[i]
+			mv.SessionID = sessions[mv.TransactionID]
+
+			var transactionID sql.NullInt32
+			if mv.TransactionID != 0 {
+				transactionID = sql.NullInt32{Int32: int32(mv.TransactionID), Valid: true}
+			}
+			var sessionID pgtype.UUID
+			if mv.SessionID != "" {
+				if err := sessionID.Scan(mv.SessionID); err != nil {
+					return nil, err
+				}
+			}
+
+			return []interface{}{
+				transactionID, mv.ChargePointID, mv.ConnectorID, mv.Timestamp,
+				mv.Value, mv.Unit, mv.Measurand, now, sessionID, mv.TimestampAdjusted,
+				sql.NullString{String: mv.Context, Valid: mv.Context != ""}, sql.NullString{String: mv.Format, Valid: mv.Format != ""},
+				sql.NullString{String: mv.Phase, Valid: mv.Phase != ""}, sql.NullString{String: mv.Location, Valid: mv.Location != ""},
+			}, nil
+		}),
 	)
 	return err
 }
@@ -323,6 +896,32 @@ func (s *PostgresStore) UpdateChargePointConnection(ctx context.Context, id stri
 	return err
 }
 
+// UpdateClockDrift records the measured clock drift of a charge point and whether it exceeds the threshold
+func (s *PostgresStore) UpdateClockDrift(ctx context.Context, id string, drift time.Duration, flagged bool) error {
+	query := `
+		UPDATE charge_points
+		SET clock_drift_ms = $1, clock_drift_at = $2, clock_drift_flagged = $3
+		WHERE id = $4
+	`
+	_, err := s.pool.Exec(ctx, query, drift.Milliseconds(), time.Now(), flagged, id)
+	return err
+}
+
+// UpdateRebootLoop records the start of a charge point's reboot loop, a zero time records that it ended
+func (s *PostgresStore) UpdateRebootLoop(ctx context.Context, id string, since time.Time) error {
+	query := `
+		UPDATE charge_points
+		SET reboot_loop_since = $1
+		WHERE id = $2
+	`
+	var loopSince sql.NullTime
+	if !since.IsZero() {
+		loopSince = sql.NullTime{Time: since, Valid: true}
+	}
+	_, err := s.pool.Exec(ctx, query, loopSince, id)
+	return err
+}
+
 // UpdateHeartbeat updates the last heartbeat time of a charge point
 func (s *PostgresStore) UpdateHeartbeat(ctx context.Context, id string) error {
 	query := `
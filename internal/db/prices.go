@@ -0,0 +1,220 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// SaveSpotPrices creates or updates a set of hourly spot prices
+func (s *PostgresStore) SaveSpotPrices(ctx context.Context, prices []*models.SpotPrice) error {
+	query := `
+		INSERT INTO spot_prices (
+			price_area, hour_start, price_per_mwh, currency, created_at
+		) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (price_area, hour_start) DO UPDATE SET
+			price_per_mwh = $3,
+			currency = $4
+	`
+
+	now := time.Now()
+	for _, p := range prices {
+		if p.CreatedAt.IsZero() {
+			p.CreatedAt = now
+		}
+		if _, err := s.pool.Exec(ctx, query,
+			p.PriceArea, p.HourStart, p.PricePerMWh, p.Currency, p.CreatedAt,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetSpotPrices retrieves the spot prices of a price area within a time range
+func (s *PostgresStore) GetSpotPrices(ctx context.Context, priceArea string, from, to time.Time) ([]*models.SpotPrice, error) {
+	query := `
+		SELECT price_area, hour_start, price_per_mwh, currency, created_at
+		FROM spot_prices
+		WHERE price_area = $1 AND hour_start >= $2 AND hour_start < $3
+		ORDER BY hour_start
+	`
+
+	rows, err := s.pool.Query(ctx, query, priceArea, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prices []*models.SpotPrice
+	for rows.Next() {
+		p := &models.SpotPrice{}
+		if err := rows.Scan(&p.PriceArea, &p.HourStart, &p.PricePerMWh, &p.Currency, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		prices = append(prices, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return prices, nil
+}
+
+// SaveCarbonIntensities creates or updates a set of hourly carbon intensities
+func (s *PostgresStore) SaveCarbonIntensities(ctx context.Context, intensities []*models.CarbonIntensity) error {
+	query := `
+		INSERT INTO carbon_intensities (
+			price_area, hour_start, co2_per_kwh, renewable_share, created_at
+		) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (price_area, hour_start) DO UPDATE SET
+			co2_per_kwh = $3,
+			renewable_share = $4
+	`
+
+	now := time.Now()
+	for _, c := range intensities {
+		if c.CreatedAt.IsZero() {
+			c.CreatedAt = now
+		}
+		if _, err := s.pool.Exec(ctx, query,
+			c.PriceArea, c.HourStart, c.CO2PerKWh, c.RenewableShare, c.CreatedAt,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCarbonIntensities retrieves the carbon intensities of a price area within a time range
+func (s *PostgresStore) GetCarbonIntensities(ctx context.Context, priceArea string, from, to time.Time) ([]*models.CarbonIntensity, error) {
+	query := `
+		SELECT price_area, hour_start, co2_per_kwh, renewable_share, created_at
+		FROM carbon_intensities
+		WHERE price_area = $1 AND hour_start >= $2 AND hour_start < $3
+		ORDER BY hour_start
+	`
+
+	rows, err := s.pool.Query(ctx, query, priceArea, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var intensities []*models.CarbonIntensity
+	for rows.Next() {
+		c := &models.CarbonIntensity{}
+		if err := rows.Scan(&c.PriceArea, &c.HourStart, &c.CO2PerKWh, &c.RenewableShare, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		intensities = append(intensities, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return intensities, nil
+}
+
+// GetTransactionMeterValues retrieves the meter values of a transaction for a measurand, leaving out the
+// per-phase readings so only the totals are returned
+func (s *PostgresStore) GetTransactionMeterValues(ctx context.Context, transactionID int, measurand string) ([]*models.MeterValue, error) {
+	query := `SELECT ` + meterValueColumns + `
+		FROM meter_values
+		WHERE transaction_id = $1 AND measurand = $2 AND phase IS NULL
+		ORDER BY timestamp
+	`
+
+	rows, err := s.pool.Query(ctx, query, transactionID, measurand)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var meterValues []*models.MeterValue
+	for rows.Next() {
+		mv, err := scanMeterValue(rows)
+		if err != nil {
+			return nil, err
+		}
+		meterValues = append(meterValues, mv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return meterValues, nil
+}
+
+// GetLatestMeterValues retrieves the most recent meter value for a measurand of each of the transactions, by transaction ID.
+// An empty measurand selects the most recent meter value of any measurand. Transactions without such meter values are left out.
+func (s *PostgresStore) GetLatestMeterValues(ctx context.Context, transactionIDs []int, measurand string) (map[int]*models.MeterValue, error) {
+	query := `SELECT DISTINCT ON (transaction_id) ` + meterValueColumns + `
+		FROM meter_values
+		WHERE transaction_id = ANY($1) AND ($2 = '' OR measurand = $2)
+		ORDER BY transaction_id, timestamp DESC, id DESC
+	`
+
+	rows, err := s.pool.Query(ctx, query, transactionIDs, measurand)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	latest := make(map[int]*models.MeterValue)
+	for rows.Next() {
+		mv, err := scanMeterValue(rows)
+		if err != nil {
+			return nil, err
+		}
+		latest[mv.TransactionID] = mv
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return latest, nil
+}
+
+// SetChargePointSpotOptOut excludes the transactions of a charge point from spot price optimized charging,
+// or includes them again
+func (s *PostgresStore) SetChargePointSpotOptOut(ctx context.Context, chargePointID string, optOut bool) error {
+	query := `
+		UPDATE charge_points
+		SET spot_opt_out = $1, updated_at = $2
+		WHERE id = $3
+	`
+
+	tag, err := s.pool.Exec(ctx, query, optOut, time.Now(), chargePointID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetTransactionSpotOptOut excludes an in-progress transaction from spot price optimized charging,
+// or includes it again
+func (s *PostgresStore) SetTransactionSpotOptOut(ctx context.Context, id int, optOut bool) error {
+	query := `
+		UPDATE transactions
+		SET spot_opt_out = $1, updated_at = $2
+		WHERE id = $3 AND status = 'InProgress' AND ` + tenantScope("tenant_id", 4) + `
+	`
+
+	tag, err := s.pool.Exec(ctx, query, optOut, time.Now(), id, TenantFromContext(ctx))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RegisterConnection records that an instance holds a charge point's websocket
+func (s *PostgresStore) RegisterConnection(ctx context.Context, chargePointID, instanceID, instanceURL string) error {
+	query := `
+		INSERT INTO charge_point_connections (charge_point_id, instance_id, instance_url, connected_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (charge_point_id) DO UPDATE SET
+			instance_id = $2,
+			instance_url = $3,
+			connected_at = $4
+	`
+
+	_, err := s.pool.Exec(ctx, query, chargePointID, instanceID, instanceURL, time.Now())
+	return err
+}
+
+// UnregisterConnection removes a charge point's registration if it is still held by the instance,
+// so a charge point that already reconnected to another instance stays reachable
+func (s *PostgresStore) UnregisterConnection(ctx context.Context, chargePointID, instanceID string) error {
+	query := `DELETE FROM charge_point_connections WHERE charge_point_id = $1 AND instance_id = $2`
+
+	_, err := s.pool.Exec(ctx, query, chargePointID, instanceID)
+	return err
+}
+
+// ClearConnections removes all registrations of an instance, e.g. left behind by a crash
+func (s *PostgresStore) ClearConnections(ctx context.Context, instanceID string) error {
+	query := `DELETE FROM charge_point_connections WHERE instance_id = $1`
+
+	_, err := s.pool.Exec(ctx, query, instanceID)
+	return err
+}
+
+// GetConnectionOwner returns the instance holding a charge point's websocket and its internal API URL.
+// It returns ErrNotFound if the charge point is not connected to any instance.
+func (s *PostgresStore) GetConnectionOwner(ctx context.Context, chargePointID string) (string, string, error) {
+	query := `SELECT instance_id, instance_url FROM charge_point_connections WHERE charge_point_id = $1`
+
+	var instanceID, instanceURL string
+	err := s.pool.QueryRow(ctx, query, chargePointID).Scan(&instanceID, &instanceURL)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", "", ErrNotFound
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return instanceID, instanceURL, nil
+}
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// PendingSessionTTL is how long a session opened at authorization or remote start
+// waits for the charge point to start its transaction
+const PendingSessionTTL = 15 * time.Minute
+
+// NewSessionID generates a random (version 4) UUID session identifier
+func NewSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// OpenPendingSession records a session waiting for a charge point to start a transaction for an idTag.
+// A remote start replaces any pending session; an authorization only replaces an expired one,
+// so it joins the session of a preceding remote start. It returns the pending session's ID.
+func (s *PostgresStore) OpenPendingSession(ctx context.Context, chargePointID, idTag, sessionID string, replace bool) (string, error) {
+	query := `
+		INSERT INTO pending_sessions (charge_point_id, id_tag, session_id, created_at)
+		VALUES ($1, $2, $3::uuid, $4)
+		ON CONFLICT (charge_point_id, id_tag) DO UPDATE SET
+			session_id = CASE WHEN $5 OR pending_sessions.created_at < $6 THEN $3::uuid ELSE pending_sessions.session_id END,
+			created_at = CASE WHEN $5 OR pending_sessions.created_at < $6 THEN $4 ELSE pending_sessions.created_at END
+		RETURNING session_id::text
+	`
+
+	now := time.Now()
+	var id string
+	err := s.pool.QueryRow(ctx, query, chargePointID, idTag, sessionID, now, replace, now.Add(-PendingSessionTTL)).Scan(&id)
+	return id, err
+}
+
+// ClaimPendingSession removes and returns the unexpired pending session of an idTag on a charge point.
+// It returns an empty session ID if there is none.
+func (s *PostgresStore) ClaimPendingSession(ctx context.Context, chargePointID, idTag string) (string, error) {
+	query := `
+		DELETE FROM pending_sessions
+		WHERE charge_point_id = $1 AND id_tag = $2
+		RETURNING session_id::text, created_at
+	`
+
+	var sessionID string
+	var createdAt time.Time
+	err := s.pool.QueryRow(ctx, query, chargePointID, idTag).Scan(&sessionID, &createdAt)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if createdAt.Before(time.Now().Add(-PendingSessionTTL)) {
+		return "", nil
+	}
+	return sessionID, nil
+}
+
+// GetTransactionBySession retrieves the transaction of a session within the context's tenant scope
+func (s *PostgresStore) GetTransactionBySession(ctx context.Context, sessionID string) (*models.Transaction, error) {
+	query := `SELECT ` + transactionColumns + `
+		FROM transactions
+		WHERE session_id = $1::uuid AND ` + tenantScope("tenant_id", 2) + `
+	`
+
+	return notFound(scanTransaction(s.pool.QueryRow(ctx, query, sessionID, TenantFromContext(ctx))))
+}
+
+// GetSessionMeterValues retrieves the meter values of a session
+func (s *PostgresStore) GetSessionMeterValues(ctx context.Context, sessionID string) ([]*models.MeterValue, error) {
+	query := `SELECT ` + meterValueColumns + `
+		FROM meter_values
+		WHERE session_id = $1::uuid
+		ORDER BY timestamp, id
+	`
+
+	rows, err := s.pool.Query(ctx, query, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var meterValues []*models.MeterValue
+	for rows.Next() {
+		mv, err := scanMeterValue(rows)
+		if err != nil {
+			return nil, err
+		}
+		meterValues = append(meterValues, mv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return meterValues, nil
+}
+
+// GetTransactionMeterStats derives the highest energy register reading and the peak power of each of the transactions
+// from their meter values, by transaction ID. The peak power is the highest active import power reading, summing the
+// phases of chargers reporting them separately, or the power between energy register readings without power readings.
+// Transactions without meter values are left out.
+func (s *PostgresStore) GetTransactionMeterStats(ctx context.Context, transactionIDs []int) (map[int]*models.TransactionMeterStats, error) {
+	query := `
+		WITH power AS (
+			SELECT transaction_id, timestamp, COALESCE(max(kw) FILTER (WHERE phase = ''), sum(kw)) AS kw
+			FROM (
+				SELECT transaction_id, timestamp, COALESCE(phase, '') AS phase,
+					CASE WHEN unit = 'kW' THEN value ELSE value / 1000 END AS kw
+				FROM meter_values
+				WHERE transaction_id = ANY($1) AND measurand = 'Power.Active.Import'
+			) p
+			GROUP BY transaction_id, timestamp
+		),
+		energy AS (
+			SELECT transaction_id, wh,
+				(wh - lag(wh) OVER w) / 1000 / NULLIF(EXTRACT(EPOCH FROM timestamp - lag(timestamp) OVER w) / 3600, 0) AS kw
+			FROM (
+				SELECT transaction_id, timestamp, CASE WHEN unit = 'kWh' THEN value * 1000 ELSE value END AS wh
+				FROM meter_values
+				WHERE transaction_id = ANY($1) AND measurand = 'Energy.Active.Import.Register' AND phase IS NULL
+			) e
+			WINDOW w AS (PARTITION BY transaction_id ORDER BY timestamp)
+		),
+		stats AS (
+			SELECT transaction_id, max(wh) AS wh, NULL::double precision AS power_kw, max(kw) AS energy_kw
+			FROM energy
+			GROUP BY transaction_id
+			UNION ALL
+			SELECT transaction_id, NULL, max(kw), NULL
+			FROM power
+			GROUP BY transaction_id
+		)
+		SELECT transaction_id, COALESCE(max(wh), 0), COALESCE(max(power_kw), max(energy_kw), 0)
+		FROM stats
+		GROUP BY transaction_id
+	`
+
+	rows, err := s.pool.Query(ctx, query, transactionIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make(map[int]*models.TransactionMeterStats)
+	for rows.Next() {
+		st := &models.TransactionMeterStats{}
+		if err := rows.Scan(&st.TransactionID, &st.EnergyRegisterWh, &st.PeakPowerKW); err != nil {
+			return nil, err
+		}
+		stats[st.TransactionID] = st
+	}
+
+	return stats, rows.Err()
+}
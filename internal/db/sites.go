@@ -0,0 +1,244 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const siteColumns = `
+	id, name, solar_enabled, solar_meter_url, min_current, max_current, phases, voltage,
+	max_stay_minutes, overstay_warning_minutes, free_vend, created_at, updated_at
+`
+
+// SaveSite creates or updates a site
+func (s *PostgresStore) SaveSite(ctx context.Context, site *models.Site) error {
+	query := `
+		INSERT INTO sites (
+			id, name, solar_enabled, solar_meter_url, min_current, max_current, phases, voltage,
+			max_stay_minutes, overstay_warning_minutes, free_vend, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (id) DO UPDATE SET
+			name = $2,
+			solar_enabled = $3,
+			solar_meter_url = $4,
+			min_current = $5,
+			max_current = $6,
+			phases = $7,
+			voltage = $8,
+			max_stay_minutes = $9,
+			overstay_warning_minutes = $10,
+			free_vend = $11,
+			updated_at = $13
+	`
+
+	now := time.Now()
+	if site.CreatedAt.IsZero() {
+		site.CreatedAt = now
+	}
+	site.UpdatedAt = now
+
+	_, err := s.pool.Exec(ctx, query,
+		site.ID, site.Name, site.SolarEnabled, sql.NullString{String: site.SolarMeterURL, Valid: site.SolarMeterURL != ""},
+		site.MinCurrent, site.MaxCurrent, site.Phases, site.Voltage,
+		site.MaxStayMinutes, site.OverstayWarningMinutes, site.FreeVend, site.CreatedAt, site.UpdatedAt,
+	)
+	return err
+}
+
+// GetSite retrieves a site by its ID
+func (s *PostgresStore) GetSite(ctx context.Context, id string) (*models.Site, error) {
+	query := `SELECT ` + siteColumns + ` FROM sites WHERE id = $1`
+	return notFound(scanSite(s.pool.QueryRow(ctx, query, id)))
+}
+
+// GetSites retrieves all sites
+func (s *PostgresStore) GetSites(ctx context.Context) ([]*models.Site, error) {
+	query := `SELECT ` + siteColumns + ` FROM sites ORDER BY name`
+
+	rows, err := s.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sites []*models.Site
+	for rows.Next() {
+		site, err := scanSite(rows)
+		if err != nil {
+			return nil, err
+		}
+		sites = append(sites, site)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sites, nil
+}
+
+// SetChargePointSite assigns a charge point to a site, an empty site ID removes the assignment
+func (s *PostgresStore) SetChargePointSite(ctx context.Context, chargePointID, siteID string) error {
+	query := `
+		UPDATE charge_points
+		SET site_id = NULLIF($1, ''), updated_at = $2
+		WHERE id = $3
+	`
+
+	_, err := s.pool.Exec(ctx, query, siteID, time.Now(), chargePointID)
+	return err
+}
+
+// SetChargePointFreeVend enables or disables free vend mode on a charge point
+func (s *PostgresStore) SetChargePointFreeVend(ctx context.Context, chargePointID string, enabled bool) error {
+	query := `
+		UPDATE charge_points
+		SET free_vend = $1, updated_at = $2
+		WHERE id = $3
+	`
+
+	tag, err := s.pool.Exec(ctx, query, enabled, time.Now(), chargePointID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// IsFreeVend reports whether a charge point or its site is in free vend mode
+func (s *PostgresStore) IsFreeVend(ctx context.Context, chargePointID string) (bool, error) {
+	query := `
+		SELECT cp.free_vend OR COALESCE(s.free_vend, FALSE)
+		FROM charge_points cp
+		LEFT JOIN sites s ON s.id = cp.site_id
+		WHERE cp.id = $1
+	`
+
+	var freeVend bool
+	err := s.pool.QueryRow(ctx, query, chargePointID).Scan(&freeVend)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	return freeVend, err
+}
+
+// GetActiveTransactionsForSite retrieves the in-progress transactions of all charge points at a site
+func (s *PostgresStore) GetActiveTransactionsForSite(ctx context.Context, siteID string) ([]*models.Transaction, error) {
+	query := `
+		SELECT t.id, t.charge_point_id, t.connector_id, t.id_tag, t.start_time, t.meter_start, t.status
+		FROM transactions t
+		JOIN charge_points cp ON cp.id = t.charge_point_id
+		WHERE cp.site_id = $1 AND t.status = 'InProgress'
+		ORDER BY t.start_time
+	`
+
+	rows, err := s.pool.Query(ctx, query, siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []*models.Transaction
+	for rows.Next() {
+		tx := &models.Transaction{}
+		if err := rows.Scan(
+			&tx.ID, &tx.ChargePointID, &tx.ConnectorID, &tx.IdTag, &tx.StartTime, &tx.MeterStart, &tx.Status,
+		); err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, tx)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+func scanSite(row rowScanner) (*models.Site, error) {
+	site := &models.Site{}
+	var solarMeterURL sql.NullString
+	err := row.Scan(
+		&site.ID, &site.Name, &site.SolarEnabled, &solarMeterURL, &site.MinCurrent, &site.MaxCurrent,
+		&site.Phases, &site.Voltage, &site.MaxStayMinutes, &site.OverstayWarningMinutes, &site.FreeVend,
+		&site.CreatedAt, &site.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	site.SolarMeterURL = solarMeterURL.String
+	return site, nil
+}
+
+// GetChargePointIDsForSite retrieves the IDs of all charge points assigned to a site
+func (s *PostgresStore) GetChargePointIDsForSite(ctx context.Context, siteID string) ([]string, error) {
+	rows, err := s.pool.Query(ctx, `SELECT id FROM charge_points WHERE site_id = $1 ORDER BY id`, siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// GetParkingSessions retrieves the plugged-in connectors at sites with a max-stay rule,
+// optionally restricted to a single site
+func (s *PostgresStore) GetParkingSessions(ctx context.Context, siteID string) ([]*models.ParkingSession, error) {
+	query := `
+		SELECT
+			st.id, c.charge_point_id, c.id, COALESCE(t.id_tag, ''), COALESCE(t.id, 0),
+			COALESCE(t.session_id::text, ''), c.occupied_since, st.max_stay_minutes, st.overstay_warning_minutes
+		FROM connectors c
+		JOIN charge_points cp ON cp.id = c.charge_point_id
+		JOIN sites st ON st.id = cp.site_id
+		LEFT JOIN transactions t ON t.charge_point_id = c.charge_point_id
+			AND t.connector_id = c.id AND t.status = 'InProgress'
+		WHERE c.occupied_since IS NOT NULL AND st.max_stay_minutes > 0
+			AND ($1 = '' OR st.id = $1)
+		ORDER BY c.occupied_since
+	`
+
+	rows, err := s.pool.Query(ctx, query, siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*models.ParkingSession
+	for rows.Next() {
+		p := &models.ParkingSession{}
+		if err := rows.Scan(
+			&p.SiteID, &p.ChargePointID, &p.ConnectorID, &p.IdTag, &p.TransactionID,
+			&p.SessionID, &p.OccupiedSince, &p.MaxStayMinutes, &p.OverstayWarningMinutes,
+		); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
@@ -0,0 +1,33 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// GetChargePointTotals aggregates the transactions and faults of a charge point in [from, to): the transactions
+// started and the energy of those completed, the time spent in transactions overlapping the period, and the
+// status notifications reporting an error. Revenue and utilization are left to the caller.
+func (s *PostgresStore) GetChargePointTotals(ctx context.Context, chargePointID string, from, to time.Time) (*models.ChargePointTotals, error) {
+	query := `
+		SELECT
+			count(*) FILTER (WHERE start_time >= $2),
+			COALESCE(sum(GREATEST(meter_stop - meter_start, 0)) FILTER (WHERE start_time >= $2 AND meter_stop IS NOT NULL), 0) / 1000.0,
+			COALESCE(sum(EXTRACT(EPOCH FROM LEAST(COALESCE(end_time, now()), $3) - GREATEST(start_time, $2))), 0)::bigint,
+			(SELECT count(*) FROM connector_status_events
+				WHERE charge_point_id = $1 AND error_code <> 'NoError' AND timestamp >= $2 AND timestamp < $3)
+		FROM transactions
+		WHERE charge_point_id = $1 AND start_time < $3 AND (end_time IS NULL OR end_time > $2)
+	`
+
+	totals := &models.ChargePointTotals{From: from, To: to}
+	err := s.pool.QueryRow(ctx, query, chargePointID, from, to).Scan(
+		&totals.Sessions, &totals.EnergyKWh, &totals.ChargingSeconds, &totals.Faults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// CreateConnectorStatusEvent records a status notification of a connector
+func (s *PostgresStore) CreateConnectorStatusEvent(ctx context.Context, event *models.ConnectorStatusEvent) error {
+	query := `
+		INSERT INTO connector_status_events (
+			charge_point_id, connector_id, status, error_code, info, vendor_id, vendor_error_code,
+			timestamp, timestamp_adjusted, created_at
+		) VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8, $9, $10)
+		RETURNING id
+	`
+
+	event.CreatedAt = time.Now()
+	if event.Timestamp.IsZero() {
+		event.Timestamp = event.CreatedAt
+	}
+
+	return s.pool.QueryRow(ctx, query,
+		event.ChargePointID, event.ConnectorID, event.Status, event.ErrorCode,
+		event.Info, event.VendorID, event.VendorErrorCode, event.Timestamp, event.TimestampAdjusted, event.CreatedAt,
+	).Scan(&event.ID)
+}
+
+// GetConnectorStatusEvents retrieves the most recent status notifications of a charge point,
+// optionally limited to one connector and to events reporting an error
+func (s *PostgresStore) GetConnectorStatusEvents(ctx context.Context, chargePointID string, connectorID int, errorsOnly bool, limit int) ([]*models.ConnectorStatusEvent, error) {
+	query := `
+		SELECT
+			id, charge_point_id, connector_id, status, error_code, info, vendor_id, vendor_error_code,
+			timestamp, timestamp_adjusted, created_at
+		FROM connector_status_events
+		WHERE charge_point_id = $1
+			AND ($2 = 0 OR connector_id = $2)
+			AND (NOT $3 OR error_code <> 'NoError')
+		ORDER BY timestamp DESC
+		LIMIT $4
+	`
+
+	rows, err := s.pool.Query(ctx, query, chargePointID, connectorID, errorsOnly, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.ConnectorStatusEvent
+	for rows.Next() {
+		e := &models.ConnectorStatusEvent{}
+		var info, vendorID, vendorErrorCode sql.NullString
+		if err := rows.Scan(
+			&e.ID, &e.ChargePointID, &e.ConnectorID, &e.Status, &e.ErrorCode, &info, &vendorID, &vendorErrorCode,
+			&e.Timestamp, &e.TimestampAdjusted, &e.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		e.Info = info.String
+		e.VendorID = vendorID.String
+		e.VendorErrorCode = vendorErrorCode.String
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
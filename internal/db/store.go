@@ -0,0 +1,219 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/balu-dk/go-cpms/config"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/sirupsen/logrus"
+)
+
+// Store is the persistence layer of the CPMS.
+// PostgresStore is the production implementation, MemoryStore keeps everything in process for development and demos.
+type Store interface {
+	Close()
+
+	// Charge points and connectors
+	SaveChargePoint(ctx context.Context, cp *models.ChargePoint) error
+	GetChargePoint(ctx context.Context, id string) (*models.ChargePoint, error)
+	GetChargePoints(ctx context.Context, filter ChargePointFilter, sort Sort, page Page) ([]*models.ChargePoint, int, error)
+	UpdateChargePointConnection(ctx context.Context, id string, connected bool) error
+	UpdateHeartbeat(ctx context.Context, id string) error
+	UpdateClockDrift(ctx context.Context, id string, drift time.Duration, flagged bool) error
+	UpdateRebootLoop(ctx context.Context, id string, since time.Time) error
+	SaveConnector(ctx context.Context, connector *models.Connector) error
+	TouchConnector(ctx context.Context, chargePointID string, connectorID int) error
+	GetConnectors(ctx context.Context, chargePointID string, page Page) ([]*models.Connector, int, error)
+	SaveConnectorAttributes(ctx context.Context, connector *models.Connector) error
+	CreateMissingConnectors(ctx context.Context, chargePointID string, count int) (int, error)
+	CreateConnectorStatusEvent(ctx context.Context, event *models.ConnectorStatusEvent) error
+	GetConnectorStatusEvents(ctx context.Context, chargePointID string, connectorID int, errorsOnly bool, limit int) ([]*models.ConnectorStatusEvent, error)
+	CreateConnectionEvent(ctx context.Context, event *models.ConnectionEvent) error
+	CloseConnectionEvent(ctx context.Context, chargePointID string, disconnectedAt time.Time) error
+	GetConnectionEvents(ctx context.Context, chargePointID string, limit int) ([]*models.ConnectionEvent, error)
+	GetFaultedConnectors(ctx context.Context) ([]*models.Connector, error)
+	GetConnectorsByStatus(ctx context.Context, status string) ([]*models.Connector, error)
+
+	// Transactions and sessions
+	StartTransaction(ctx context.Context, tx *models.Transaction) error
+	StopTransaction(ctx context.Context, id int, endTime time.Time, meterStop int, reason string) error
+	FlagAdjustedTimestamp(ctx context.Context, id int) error
+	RecordTransactionSoC(ctx context.Context, id int, soc float64, end bool) error
+	GetOrphanedTransactions(ctx context.Context, cutoff time.Time) ([]*models.Transaction, error)
+	CloseOrphanedTransaction(ctx context.Context, id int, endTime time.Time, meterStop int) (bool, error)
+	ReconcileTransaction(ctx context.Context, id int, endTime time.Time, meterStop int, reason string) (bool, error)
+	GetTransaction(ctx context.Context, id int) (*models.Transaction, error)
+	FindStartedTransaction(ctx context.Context, chargePointID string, connectorID int, idTag string, startTime time.Time, meterStart int) (*models.Transaction, error)
+	GetTransactions(ctx context.Context, filter TransactionFilter, sort Sort, page Page) ([]*models.Transaction, int, error)
+	SetTransactionLimits(ctx context.Context, id int, maxCost, maxEnergy float64) error
+	SetTransactionDeparture(ctx context.Context, id int, targetEnergy float64, departure time.Time, priceOptimized bool) error
+	SetTransactionStopReason(ctx context.Context, id int, reason string) error
+	SetTransactionVehicle(ctx context.Context, id int, mac, vin string) error
+	StreamTransactions(ctx context.Context, from, to time.Time, fn func(*models.Transaction) error) error
+	OpenPendingSession(ctx context.Context, chargePointID, idTag, sessionID string, replace bool) (string, error)
+	ClaimPendingSession(ctx context.Context, chargePointID, idTag string) (string, error)
+	GetTransactionBySession(ctx context.Context, sessionID string) (*models.Transaction, error)
+
+	// Meter values
+	SaveMeterValue(ctx context.Context, mv *models.MeterValue) error
+	SaveMeterValues(ctx context.Context, batch []*models.MeterValue) error
+	GetTransactionMeterValues(ctx context.Context, transactionID int, measurand string) ([]*models.MeterValue, error)
+	GetLatestMeterValues(ctx context.Context, transactionIDs []int, measurand string) (map[int]*models.MeterValue, error)
+	GetSessionMeterValues(ctx context.Context, sessionID string) ([]*models.MeterValue, error)
+	GetTransactionMeterStats(ctx context.Context, transactionIDs []int) (map[int]*models.TransactionMeterStats, error)
+	GetChargePointTotals(ctx context.Context, chargePointID string, from, to time.Time) (*models.ChargePointTotals, error)
+	StreamMeterValues(ctx context.Context, chargePointID string, from, to time.Time, fn func(*models.MeterValue) error) error
+	GetHourlyEnergy(ctx context.Context, chargePointID string, from, to time.Time) ([]*models.HourlyEnergy, error)
+	EnsureMeterValuePartition(ctx context.Context, t time.Time) error
+	PruneMeterValues(ctx context.Context, cutoff time.Time, bucketMinutes int) ([]string, error)
+
+	// OCPP message log
+	LogOCPPMessage(ctx context.Context, msg *models.OCPPMessage) error
+	GetOCPPMessages(ctx context.Context, chargePointID string, page Page) ([]*models.OCPPMessage, int, error)
+	OldestOCPPMessageTime(ctx context.Context) (time.Time, bool, error)
+	StreamOCPPMessages(ctx context.Context, from, to time.Time, fn func(*models.OCPPMessage) error) error
+	DeleteOCPPMessages(ctx context.Context, from, to time.Time, maxID int) (int64, error)
+	QuarantineMessage(ctx context.Context, msg *models.QuarantinedMessage) error
+	GetQuarantinedMessages(ctx context.Context, filter QuarantineFilter, page Page) ([]*models.QuarantinedMessage, int, error)
+	ReviewQuarantinedMessage(ctx context.Context, id int, actor string) error
+	DeleteQuarantinedMessages(ctx context.Context, before time.Time) (int64, error)
+
+	// Commands and macros
+	CreateCommand(ctx context.Context, cmd *models.Command) error
+	CompleteCommand(ctx context.Context, cmd *models.Command) error
+	GetCommand(ctx context.Context, id int) (*models.Command, error)
+	GetCommands(ctx context.Context, chargePointID string, limit int) ([]*models.Command, error)
+	GetLatestCommand(ctx context.Context, chargePointID, action string) (*models.Command, error)
+	GetMacroRunCommands(ctx context.Context, runID int) ([]*models.Command, error)
+	GetSessionCommands(ctx context.Context, sessionID string) ([]*models.Command, error)
+	SaveMacro(ctx context.Context, macro *models.Macro) error
+	GetMacro(ctx context.Context, id string) (*models.Macro, error)
+	GetMacros(ctx context.Context) ([]*models.Macro, error)
+	DeleteMacro(ctx context.Context, id string) error
+	CreateMacroRun(ctx context.Context, run *models.MacroRun) error
+	CompleteMacroRun(ctx context.Context, id int, status string) error
+	GetMacroRun(ctx context.Context, id int) (*models.MacroRun, error)
+
+	// Firmware updates
+	CreateFirmwareUpdate(ctx context.Context, fu *models.FirmwareUpdate) error
+	UpdateFirmwareUpdate(ctx context.Context, fu *models.FirmwareUpdate) error
+	GetActiveFirmwareUpdate(ctx context.Context, chargePointID string) (*models.FirmwareUpdate, error)
+	GetFirmwareUpdates(ctx context.Context, chargePointID string) ([]*models.FirmwareUpdate, error)
+	GetFirmwareUpdatesDueForRetry(ctx context.Context, now time.Time) ([]*models.FirmwareUpdate, error)
+
+	// Spot prices
+	SaveSpotPrices(ctx context.Context, prices []*models.SpotPrice) error
+	GetSpotPrices(ctx context.Context, priceArea string, from, to time.Time) ([]*models.SpotPrice, error)
+	SaveCarbonIntensities(ctx context.Context, intensities []*models.CarbonIntensity) error
+	GetCarbonIntensities(ctx context.Context, priceArea string, from, to time.Time) ([]*models.CarbonIntensity, error)
+	SetChargePointSpotOptOut(ctx context.Context, chargePointID string, optOut bool) error
+	SetTransactionSpotOptOut(ctx context.Context, id int, optOut bool) error
+
+	// Alerting
+	SaveAlertRule(ctx context.Context, rule *models.AlertRule) error
+	GetAlertRule(ctx context.Context, id string) (*models.AlertRule, error)
+	GetAlertRules(ctx context.Context) ([]*models.AlertRule, error)
+	DeleteAlertRule(ctx context.Context, id string) error
+	CreateAlert(ctx context.Context, alert *models.Alert) error
+	ResolveAlert(ctx context.Context, id int, resolvedAt time.Time) error
+	SetAlertDiagnostics(ctx context.Context, id int, file string) error
+	GetAlerts(ctx context.Context, state string, limit int) ([]*models.Alert, error)
+
+	// Sites and grid events
+	SaveSite(ctx context.Context, site *models.Site) error
+	GetSite(ctx context.Context, id string) (*models.Site, error)
+	GetSites(ctx context.Context) ([]*models.Site, error)
+	SetChargePointSite(ctx context.Context, chargePointID, siteID string) error
+	SetChargePointFreeVend(ctx context.Context, chargePointID string, enabled bool) error
+	IsFreeVend(ctx context.Context, chargePointID string) (bool, error)
+	GetActiveTransactionsForSite(ctx context.Context, siteID string) ([]*models.Transaction, error)
+	GetChargePointIDsForSite(ctx context.Context, siteID string) ([]string, error)
+	GetParkingSessions(ctx context.Context, siteID string) ([]*models.ParkingSession, error)
+	SaveGridEvent(ctx context.Context, event *models.GridEvent) error
+	UpdateGridEventStatus(ctx context.Context, id, status string) error
+	GetGridEvent(ctx context.Context, id string) (*models.GridEvent, error)
+	GetGridEvents(ctx context.Context) ([]*models.GridEvent, error)
+	GetPendingGridEvents(ctx context.Context) ([]*models.GridEvent, error)
+
+	// Groups and freezes
+	SaveGroup(ctx context.Context, group *models.Group) error
+	GetGroup(ctx context.Context, id string) (*models.Group, error)
+	GetGroups(ctx context.Context) ([]*models.Group, error)
+	GetFrozenGroupsForChargePoint(ctx context.Context, chargePointID string) ([]*models.Group, error)
+	SetGroupFrozen(ctx context.Context, id string, frozen bool, reason, actor string) error
+	AddGroupMember(ctx context.Context, groupID, chargePointID string) error
+	RemoveGroupMember(ctx context.Context, groupID, chargePointID string) error
+	GetGroupMembers(ctx context.Context, groupID string) ([]string, error)
+	CreateFreezeOverride(ctx context.Context, o *models.FreezeOverride) error
+	GetActiveFreezeOverride(ctx context.Context, groupID, chargePointID, action string) (*models.FreezeOverride, error)
+
+	// Tenants, API keys and idTags
+	SaveTenant(ctx context.Context, tenant *models.Tenant) error
+	GetTenant(ctx context.Context, id string) (*models.Tenant, error)
+	GetTenants(ctx context.Context) ([]*models.Tenant, error)
+	SetChargePointTenant(ctx context.Context, chargePointID, tenantID string) error
+	SaveAddressRule(ctx context.Context, rule *models.AddressRule) error
+	GetAddressRules(ctx context.Context) ([]*models.AddressRule, error)
+	DeleteAddressRule(ctx context.Context, id string) error
+	SaveUpstreamGateway(ctx context.Context, gateway *models.UpstreamGateway) error
+	GetUpstreamGateway(ctx context.Context, chargePointID string) (*models.UpstreamGateway, error)
+	GetUpstreamGateways(ctx context.Context) ([]*models.UpstreamGateway, error)
+	DeleteUpstreamGateway(ctx context.Context, chargePointID string) error
+	SetUpstreamTransactionID(ctx context.Context, id, upstreamID int) error
+	GetTransactionIDByUpstreamID(ctx context.Context, chargePointID string, upstreamID int) (int, error)
+	GetUpstreamTransactionID(ctx context.Context, id int) (int, error)
+	GetChargePointPasswordHash(ctx context.Context, chargePointID string) (string, error)
+	CreateCredentialRotation(ctx context.Context, rotation *models.CredentialRotation) error
+	UpdateCredentialRotation(ctx context.Context, rotation *models.CredentialRotation) error
+	GetOpenCredentialRotation(ctx context.Context, chargePointID string) (*models.CredentialRotation, error)
+	CompleteCredentialRotation(ctx context.Context, id int) (bool, error)
+	GetCredentialRotations(ctx context.Context, chargePointID string, limit int) ([]*models.CredentialRotation, error)
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	GetAPIKeyByKey(ctx context.Context, key string) (*models.APIKey, error)
+	GetAPIKeys(ctx context.Context, tenantID string) ([]*models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, tenantID string, id int) error
+	SaveIdTag(ctx context.Context, tag *models.IdTag) error
+	GetIdTags(ctx context.Context) ([]*models.IdTag, error)
+	DeleteIdTag(ctx context.Context, tenantID, idTag string) error
+	GetIdTagForChargePoint(ctx context.Context, chargePointID, idTag string) (string, *models.IdTag, error)
+
+	// Impersonation and audit log
+	CreateImpersonationSession(ctx context.Context, session *models.ImpersonationSession) error
+	GetActiveImpersonationSession(ctx context.Context, token string) (*models.ImpersonationSession, error)
+	GetImpersonationSessions(ctx context.Context, limit int) ([]*models.ImpersonationSession, error)
+	EndImpersonationSession(ctx context.Context, id int) (*models.ImpersonationSession, error)
+	CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error
+	GetAuditLog(ctx context.Context, targetType, targetID string, limit int) ([]*models.AuditEntry, error)
+
+	// Personal data
+	GetIdTagOCPPMessages(ctx context.Context, idTag string) ([]*models.OCPPMessage, error)
+	GetIdTagQuarantinedMessages(ctx context.Context, idTag string) ([]*models.QuarantinedMessage, error)
+	ErasePersonalData(ctx context.Context, idTag string, erasure *models.Erasure) error
+	GetErasures(ctx context.Context, limit int) ([]*models.Erasure, error)
+
+	// Connection registry shared between instances
+	RegisterConnection(ctx context.Context, chargePointID, instanceID, instanceURL string) error
+	UnregisterConnection(ctx context.Context, chargePointID, instanceID string) error
+	ClearConnections(ctx context.Context, instanceID string) error
+	GetConnectionOwner(ctx context.Context, chargePointID string) (string, string, error)
+}
+
+var (
+	_ Store = (*PostgresStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
+
+// NewStore creates the store selected by the DB_DRIVER configuration
+func NewStore(cfg *config.Config) (Store, error) {
+	switch cfg.DBDriver {
+	case "postgres":
+		return NewPostgresStore(cfg)
+	case "memory":
+		logrus.Warn("Using the in-memory store, all data is lost when the server stops")
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.DBDriver)
+	}
+}
@@ -0,0 +1,329 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type contextKey string
+
+const tenantContextKey contextKey = "tenant"
+
+// WithTenant returns a context whose queries are scoped to a tenant
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantContextKey, tenantID)
+}
+
+// TenantFromContext returns the tenant queries are scoped to, empty means unscoped
+func TenantFromContext(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantContextKey).(string)
+	return tenantID
+}
+
+// tenantScope returns a condition matching rows of the tenant in parameter n, or all rows if it is empty
+func tenantScope(column string, n int) string {
+	return fmt.Sprintf("($%d::text = '' OR %s = $%d)", n, column, n)
+}
+
+// HashAPIKey returns the stored representation of an API key
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// SameIdTagGroup reports whether two idTags may act on each other's transactions at a charge point:
+// they are equal, share a group in the tenant owning the charge point, or the charge point is not
+// assigned to a tenant and accepts every idTag
+func SameIdTagGroup(ctx context.Context, store Store, chargePointID, idTag, other string) (bool, error) {
+	if idTag == other {
+		return true, nil
+	}
+
+	tenantID, tag, err := store.GetIdTagForChargePoint(ctx, chargePointID, idTag)
+	if err != nil {
+		return false, err
+	}
+	if tenantID == "" {
+		return true, nil
+	}
+	if tag == nil {
+		return false, nil
+	}
+
+	_, otherTag, err := store.GetIdTagForChargePoint(ctx, chargePointID, other)
+	if err != nil || otherTag == nil {
+		return false, err
+	}
+	return tag.Group() == otherTag.Group(), nil
+}
+
+// SaveTenant creates or updates a tenant
+func (s *PostgresStore) SaveTenant(ctx context.Context, tenant *models.Tenant) error {
+	query := `
+		INSERT INTO tenants (id, name, created_at, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET
+			name = $2,
+			updated_at = $4
+	`
+
+	now := time.Now()
+	if tenant.CreatedAt.IsZero() {
+		tenant.CreatedAt = now
+	}
+	tenant.UpdatedAt = now
+
+	_, err := s.pool.Exec(ctx, query, tenant.ID, tenant.Name, tenant.CreatedAt, tenant.UpdatedAt)
+	return err
+}
+
+// GetTenants retrieves all tenants
+func (s *PostgresStore) GetTenants(ctx context.Context) ([]*models.Tenant, error) {
+	query := `SELECT id, name, created_at, updated_at FROM tenants ORDER BY name`
+
+	rows, err := s.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []*models.Tenant
+	for rows.Next() {
+		t := &models.Tenant{}
+		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tenants, nil
+}
+
+// SetChargePointTenant assigns a charge point to a tenant, an empty tenant ID unassigns it
+func (s *PostgresStore) SetChargePointTenant(ctx context.Context, chargePointID, tenantID string) error {
+	query := `
+		UPDATE charge_points
+		SET tenant_id = NULLIF($1, ''), updated_at = $2
+		WHERE id = $3
+	`
+
+	tag, err := s.pool.Exec(ctx, query, tenantID, time.Now(), chargePointID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CreateAPIKey stores the hash of a new API key
+func (s *PostgresStore) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	query := `
+		INSERT INTO api_keys (tenant_id, name, key_hash, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+
+	key.CreatedAt = time.Now()
+	return s.pool.QueryRow(ctx, query, key.TenantID, key.Name, HashAPIKey(key.Key), key.CreatedAt).Scan(&key.ID)
+}
+
+// GetAPIKeyByKey retrieves the unrevoked API key matching a presented key
+func (s *PostgresStore) GetAPIKeyByKey(ctx context.Context, key string) (*models.APIKey, error) {
+	query := `
+		SELECT id, tenant_id, name, created_at
+		FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL
+	`
+
+	k := &models.APIKey{}
+	err := s.pool.QueryRow(ctx, query, HashAPIKey(key)).Scan(&k.ID, &k.TenantID, &k.Name, &k.CreatedAt)
+	if err != nil {
+		return notFound[*models.APIKey](nil, err)
+	}
+	return k, nil
+}
+
+// GetAPIKeys retrieves the API keys of a tenant
+func (s *PostgresStore) GetAPIKeys(ctx context.Context, tenantID string) ([]*models.APIKey, error) {
+	query := `
+		SELECT id, tenant_id, name, created_at, revoked_at
+		FROM api_keys
+		WHERE tenant_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := s.pool.Query(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*models.APIKey
+	for rows.Next() {
+		k := &models.APIKey{}
+		var revokedAt sql.NullTime
+		if err := rows.Scan(&k.ID, &k.TenantID, &k.Name, &k.CreatedAt, &revokedAt); err != nil {
+			return nil, err
+		}
+		if revokedAt.Valid {
+			k.RevokedAt = revokedAt.Time
+		}
+		keys = append(keys, k)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an API key of a tenant
+func (s *PostgresStore) RevokeAPIKey(ctx context.Context, tenantID string, id int) error {
+	query := `
+		UPDATE api_keys
+		SET revoked_at = $1
+		WHERE id = $2 AND tenant_id = $3 AND revoked_at IS NULL
+	`
+
+	tag, err := s.pool.Exec(ctx, query, time.Now(), id, tenantID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SaveIdTag creates or updates an idTag of a tenant
+func (s *PostgresStore) SaveIdTag(ctx context.Context, tag *models.IdTag) error {
+	query := `
+		INSERT INTO id_tags (tenant_id, id_tag, parent_id_tag, status, expiry_date, created_at, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7)
+		ON CONFLICT (tenant_id, id_tag) DO UPDATE SET
+			parent_id_tag = NULLIF($3, ''),
+			status = $4,
+			expiry_date = $5,
+			updated_at = $7
+	`
+
+	now := time.Now()
+	if tag.CreatedAt.IsZero() {
+		tag.CreatedAt = now
+	}
+	tag.UpdatedAt = now
+
+	var expiryDate sql.NullTime
+	if !tag.ExpiryDate.IsZero() {
+		expiryDate = sql.NullTime{Time: tag.ExpiryDate, Valid: true}
+	}
+
+	_, err := s.pool.Exec(ctx, query, tag.TenantID, tag.IdTag, tag.ParentIdTag, tag.Status, expiryDate, tag.CreatedAt, tag.UpdatedAt)
+	return err
+}
+
+// GetIdTags retrieves the idTags visible in the context's tenant scope
+func (s *PostgresStore) GetIdTags(ctx context.Context) ([]*models.IdTag, error) {
+	query := `
+		SELECT tenant_id, id_tag, COALESCE(parent_id_tag, ''), status, expiry_date, created_at, updated_at
+		FROM id_tags
+		WHERE ` + tenantScope("tenant_id", 1) + `
+		ORDER BY tenant_id, id_tag
+	`
+
+	rows, err := s.pool.Query(ctx, query, TenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []*models.IdTag
+	for rows.Next() {
+		t := &models.IdTag{}
+		var expiryDate sql.NullTime
+		if err := rows.Scan(&t.TenantID, &t.IdTag, &t.ParentIdTag, &t.Status, &expiryDate, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if expiryDate.Valid {
+			t.ExpiryDate = expiryDate.Time
+		}
+		tags = append(tags, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// DeleteIdTag removes an idTag of a tenant
+func (s *PostgresStore) DeleteIdTag(ctx context.Context, tenantID, idTag string) error {
+	query := `DELETE FROM id_tags WHERE tenant_id = $1 AND id_tag = $2`
+
+	tag, err := s.pool.Exec(ctx, query, tenantID, idTag)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetIdTagForChargePoint looks up an idTag in the tenant owning a charge point.
+// The returned tenant ID is empty if the charge point is not assigned to a tenant,
+// and the idTag is nil if the tenant does not know it.
+func (s *PostgresStore) GetIdTagForChargePoint(ctx context.Context, chargePointID, idTag string) (string, *models.IdTag, error) {
+	query := `
+		SELECT cp.tenant_id, t.parent_id_tag, t.status, t.expiry_date
+		FROM charge_points cp
+		LEFT JOIN id_tags t ON t.tenant_id = cp.tenant_id AND t.id_tag = $2
+		WHERE cp.id = $1
+	`
+
+	var tenantID, parentIdTag, status sql.NullString
+	var expiryDate sql.NullTime
+	err := s.pool.QueryRow(ctx, query, chargePointID, idTag).Scan(&tenantID, &parentIdTag, &status, &expiryDate)
+	if err == pgx.ErrNoRows {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !status.Valid {
+		return tenantID.String, nil, nil
+	}
+
+	t := &models.IdTag{TenantID: tenantID.String, IdTag: idTag, ParentIdTag: parentIdTag.String, Status: status.String}
+	if expiryDate.Valid {
+		t.ExpiryDate = expiryDate.Time
+	}
+	return tenantID.String, t, nil
+}
+
+// GetTenant retrieves a tenant by its ID
+func (s *PostgresStore) GetTenant(ctx context.Context, id string) (*models.Tenant, error) {
+	query := `SELECT id, name, created_at, updated_at FROM tenants WHERE id = $1`
+
+	t := &models.Tenant{}
+	if err := s.pool.QueryRow(ctx, query, id).Scan(&t.ID, &t.Name, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return notFound[*models.Tenant](nil, err)
+	}
+	return t, nil
+}
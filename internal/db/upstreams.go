@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+const upstreamGatewayColumns = `charge_point_id, url, actions, created_at, updated_at`
+
+func scanUpstreamGateway(row rowScanner) (*models.UpstreamGateway, error) {
+	gateway := &models.UpstreamGateway{}
+	if err := row.Scan(
+		&gateway.ChargePointID, &gateway.URL, &gateway.Actions, &gateway.CreatedAt, &gateway.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return gateway, nil
+}
+
+// SaveUpstreamGateway creates or updates the upstream gateway of a charge point
+func (s *PostgresStore) SaveUpstreamGateway(ctx context.Context, gateway *models.UpstreamGateway) error {
+	query := `
+		INSERT INTO upstream_gateways (charge_point_id, url, actions, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (charge_point_id) DO UPDATE SET
+			url = $2,
+			actions = $3,
+			updated_at = $5
+		RETURNING created_at
+	`
+
+	now := time.Now()
+	if gateway.CreatedAt.IsZero() {
+		gateway.CreatedAt = now
+	}
+	gateway.UpdatedAt = now
+
+	actions := gateway.Actions
+	if actions == nil {
+		actions = []string{}
+	}
+
+	return s.pool.QueryRow(ctx, query,
+		gateway.ChargePointID, gateway.URL, actions, gateway.CreatedAt, gateway.UpdatedAt,
+	).Scan(&gateway.CreatedAt)
+}
+
+// GetUpstreamGateway retrieves the upstream gateway of a charge point
+func (s *PostgresStore) GetUpstreamGateway(ctx context.Context, chargePointID string) (*models.UpstreamGateway, error) {
+	query := `SELECT ` + upstreamGatewayColumns + ` FROM upstream_gateways WHERE charge_point_id = $1`
+	return notFound(scanUpstreamGateway(s.pool.QueryRow(ctx, query, chargePointID)))
+}
+
+// GetUpstreamGateways retrieves the upstream gateways of all charge points
+func (s *PostgresStore) GetUpstreamGateways(ctx context.Context) ([]*models.UpstreamGateway, error) {
+	query := `SELECT ` + upstreamGatewayColumns + ` FROM upstream_gateways ORDER BY charge_point_id`
+
+	rows, err := s.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var gateways []*models.UpstreamGateway
+	for rows.Next() {
+		gateway, err := scanUpstreamGateway(rows)
+		if err != nil {
+			return nil, err
+		}
+		gateways = append(gateways, gateway)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return gateways, nil
+}
+
+// DeleteUpstreamGateway removes the upstream gateway of a charge point
+func (s *PostgresStore) DeleteUpstreamGateway(ctx context.Context, chargePointID string) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM upstream_gateways WHERE charge_point_id = $1`, chargePointID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetUpstreamTransactionID records the ID the upstream central system of a gateway charge point assigned to a transaction
+func (s *PostgresStore) SetUpstreamTransactionID(ctx context.Context, id, upstreamID int) error {
+	tag, err := s.pool.Exec(ctx, `UPDATE transactions SET upstream_transaction_id = $1, updated_at = $2 WHERE id = $3`,
+		upstreamID, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetTransactionIDByUpstreamID retrieves the ID of the latest transaction of a charge point the upstream central
+// system assigned an ID to
+func (s *PostgresStore) GetTransactionIDByUpstreamID(ctx context.Context, chargePointID string, upstreamID int) (int, error) {
+	query := `
+		SELECT id FROM transactions
+		WHERE charge_point_id = $1 AND upstream_transaction_id = $2
+		ORDER BY start_time DESC
+		LIMIT 1
+	`
+
+	var id int
+	err := s.pool.QueryRow(ctx, query, chargePointID, upstreamID).Scan(&id)
+	return notFound(id, err)
+}
+
+// GetUpstreamTransactionID retrieves the ID the upstream central system assigned to a transaction
+func (s *PostgresStore) GetUpstreamTransactionID(ctx context.Context, id int) (int, error) {
+	query := `SELECT upstream_transaction_id FROM transactions WHERE id = $1 AND upstream_transaction_id IS NOT NULL`
+
+	var upstreamID int
+	err := s.pool.QueryRow(ctx, query, id).Scan(&upstreamID)
+	return notFound(upstreamID, err)
+}
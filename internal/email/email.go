@@ -0,0 +1,192 @@
+package email
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/sirupsen/logrus"
+)
+
+// queueSize is the number of events buffered for sending
+const queueSize = 100
+
+// defaultEvents are emailed when no event types are configured
+var defaultEvents = []string{events.AlertFiring, events.AlertResolved}
+
+// defaultTemplates render the subject and body of an email. Templates named after an event type,
+// like "alert.firing.subject", take precedence over the generic "subject" and "body".
+const defaultTemplates = `
+{{define "subject"}}[CPMS] {{.Type}}{{if .ChargePointID}} on {{.ChargePointID}}{{end}}{{end}}
+
+{{define "body"}}Event:        {{.Type}}
+Time:         {{.Timestamp.Format "2006-01-02 15:04:05 MST"}}
+{{- if .ChargePointID}}
+Charge point: {{.ChargePointID}}{{end}}
+{{- if .SessionID}}
+Session:      {{.SessionID}}{{end}}
+{{if .Data}}
+{{json .Data}}
+{{end}}{{end}}
+
+{{define "alert.firing.subject"}}[CPMS] FIRING: {{.Data.RuleName}} on {{.ChargePointID}}{{end}}
+
+{{define "alert.firing.body"}}{{.Data.Message}}
+
+Rule:         {{.Data.RuleName}} ({{.Data.Condition}})
+Charge point: {{.ChargePointID}}
+{{- if .Data.ConnectorID}}
+Connector:    {{.Data.ConnectorID}}{{end}}
+Fired at:     {{.Data.FiredAt.Format "2006-01-02 15:04:05 MST"}}
+{{- if .Data.DiagnosticsFile}}
+Diagnostics:  {{.Data.DiagnosticsFile}}{{end}}
+{{end}}
+
+{{define "alert.resolved.subject"}}[CPMS] RESOLVED: {{.Data.RuleName}} on {{.ChargePointID}}{{end}}
+
+{{define "alert.resolved.body"}}Resolved: {{.Data.Message}}
+
+Rule:         {{.Data.RuleName}} ({{.Data.Condition}})
+Charge point: {{.ChargePointID}}
+{{- if .Data.ConnectorID}}
+Connector:    {{.Data.ConnectorID}}{{end}}
+Fired at:     {{.Data.FiredAt.Format "2006-01-02 15:04:05 MST"}}
+Resolved at:  {{.Data.ResolvedAt.Format "2006-01-02 15:04:05 MST"}}
+{{end}}
+`
+
+// Notifier emails selected events to the configured recipients through an SMTP server
+type Notifier struct {
+	addr       string
+	auth       smtp.Auth
+	from       string
+	recipients []string
+	eventTypes map[string]bool
+	templates  *template.Template
+	queue      chan events.Event
+}
+
+// NewNotifier creates a notifier sending through the SMTP server at host:port, authenticating with
+// username and password if a username is given. Empty eventTypes emails alert firing and resolution.
+func NewNotifier(host string, port int, username, password, from string, recipients, eventTypes []string) *Notifier {
+	if len(eventTypes) == 0 {
+		eventTypes = defaultEvents
+	}
+	types := make(map[string]bool)
+	for _, t := range eventTypes {
+		types[t] = true
+	}
+
+	n := &Notifier{
+		from:       from,
+		recipients: recipients,
+		eventTypes: types,
+		templates:  template.Must(newTemplate().Parse(defaultTemplates)),
+		queue:      make(chan events.Event, queueSize),
+	}
+	if host != "" {
+		n.addr = net.JoinHostPort(host, strconv.Itoa(port))
+		if username != "" {
+			n.auth = smtp.PlainAuth("", username, password, host)
+		}
+	}
+	return n
+}
+
+func newTemplate() *template.Template {
+	return template.New("email").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.MarshalIndent(v, "", "  ")
+			return string(b), err
+		},
+	})
+}
+
+// LoadTemplates reads templates from a file, overriding the default templates of the same name
+func (n *Notifier) LoadTemplates(path string) error {
+	templates, err := template.Must(newTemplate().Parse(defaultTemplates)).ParseFiles(path)
+	if err != nil {
+		return fmt.Errorf("failed to parse email templates: %w", err)
+	}
+	n.templates = templates
+	return nil
+}
+
+// Enabled reports whether an SMTP server and recipients are configured
+func (n *Notifier) Enabled() bool {
+	return n.addr != "" && len(n.recipients) > 0
+}
+
+// Handle queues an event for sending if its type is selected. It is meant to be subscribed to an events.Bus.
+func (n *Notifier) Handle(event events.Event) {
+	if !n.Enabled() || !n.eventTypes[event.Type] {
+		return
+	}
+
+	select {
+	case n.queue <- event:
+	default:
+		logrus.WithFields(logrus.Fields{
+			"eventID":   event.ID,
+			"eventType": event.Type,
+		}).Warn("Email queue full, dropping event")
+	}
+}
+
+// Run sends queued events until the queue is closed
+func (n *Notifier) Run() {
+	for event := range n.queue {
+		if err := n.send(event); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"eventID":   event.ID,
+				"eventType": event.Type,
+			}).Error("Failed to send email notification")
+		}
+	}
+}
+
+// send renders and sends the email of an event
+func (n *Notifier) send(event events.Event) error {
+	subject, err := n.render(event, "subject")
+	if err != nil {
+		return err
+	}
+	body, err := n.render(event, "body")
+	if err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.recipients, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", strings.TrimSpace(strings.ReplaceAll(subject, "\n", " ")))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@cpms>\r\n", event.ID)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return smtp.SendMail(n.addr, n.auth, n.from, n.recipients, msg.Bytes())
+}
+
+// render executes the event type's template of a part, or the generic one if the event type has none
+func (n *Notifier) render(event events.Event, part string) (string, error) {
+	name := event.Type + "." + part
+	if n.templates.Lookup(name) == nil {
+		name = part
+	}
+
+	var b strings.Builder
+	if err := n.templates.ExecuteTemplate(&b, name, event); err != nil {
+		return "", fmt.Errorf("failed to render email %s: %w", part, err)
+	}
+	return b.String(), nil
+}
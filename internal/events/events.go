@@ -0,0 +1,126 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	ParkingOverstayWarning  = "parking.overstay_warning"
+	ParkingOverstay         = "parking.overstay"
+	ConnectorFault          = "connector.fault"
+	ConnectorStatusChanged  = "connector.status_changed"
+	ChargePointConnected    = "chargepoint.connected"
+	ChargePointDisconnected = "chargepoint.disconnected"
+	ChargePointFlooding     = "chargepoint.flooding"
+	ChargePointClockDrift   = "chargepoint.clock_drift"
+	ChargePointRebootLoop   = "chargepoint.reboot_loop"
+	TransactionStarted      = "transaction.started"
+	TransactionUpdated      = "transaction.updated"
+	TransactionStopped      = "transaction.stopped"
+	TransactionOrphaned     = "transaction.orphaned"
+	TransactionReconciled   = "transaction.reconciled"
+	FirmwareUpdateFailed    = "firmware.failed"
+	AlertFiring             = "alert.firing"
+	AlertResolved           = "alert.resolved"
+)
+
+// Event represents something that happened in the CPMS which external systems may react to
+type Event struct {
+	ID            string      `json:"id"`
+	Type          string      `json:"type"`
+	Timestamp     time.Time   `json:"timestamp"`
+	ChargePointID string      `json:"chargePointId,omitempty"`
+	SessionID     string      `json:"sessionId,omitempty"`
+	Data          interface{} `json:"data,omitempty"`
+}
+
+// Handler is called for every published event
+type Handler func(event Event)
+
+// watchBuffer is the number of events buffered per watcher. Events are dropped for watchers that fall
+// further behind, so a slow watcher never holds up the publisher.
+const watchBuffer = 256
+
+// Bus distributes events to all subscribed handlers
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+	watchers map[chan Event]struct{}
+}
+
+// NewBus creates a new event bus
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers a handler for all events.
+// Handlers are called synchronously and must not block.
+func (b *Bus) Subscribe(handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish creates an event and delivers it to all subscribed handlers
+func (b *Bus) Publish(eventType, chargePointID string, data interface{}) {
+	b.PublishSession(eventType, chargePointID, "", data)
+}
+
+// PublishSession creates an event belonging to a charging session and delivers it to all subscribed handlers
+func (b *Bus) PublishSession(eventType, chargePointID, sessionID string, data interface{}) {
+	event := Event{
+		ID:            newEventID(),
+		Type:          eventType,
+		Timestamp:     time.Now(),
+		ChargePointID: chargePointID,
+		SessionID:     sessionID,
+		Data:          data,
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, handler := range b.handlers {
+		handler(event)
+	}
+	for watcher := range b.watchers {
+		select {
+		case watcher <- event:
+		default:
+		}
+	}
+}
+
+// Watch streams all published events until stop is called. Unlike handlers, watchers come and go,
+// like the clients of a live event view.
+func (b *Bus) Watch() (<-chan Event, func()) {
+	events := make(chan Event, watchBuffer)
+
+	b.mu.Lock()
+	if b.watchers == nil {
+		b.watchers = make(map[chan Event]struct{})
+	}
+	b.watchers[events] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.watchers, events)
+			close(events)
+		})
+	}
+	return events, stop
+}
+
+// newEventID generates a random event identifier
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,297 @@
+package incident
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/sirupsen/logrus"
+)
+
+// Supported incident management providers
+const (
+	PagerDuty = "pagerduty"
+	Opsgenie  = "opsgenie"
+)
+
+// Default API endpoints of the providers
+const (
+	PagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+	OpsgenieURL  = "https://api.opsgenie.com/v2/alerts"
+)
+
+const (
+	// queueSize is the number of alert events buffered for delivery
+	queueSize = 1000
+	// maxAttempts is the number of delivery attempts per alert event
+	maxAttempts = 3
+	// retryBackoff is the delay before the first redelivery, doubled for every attempt
+	retryBackoff = 2 * time.Second
+)
+
+// opsgeniePriorities maps severities to Opsgenie alert priorities
+var opsgeniePriorities = map[string]string{
+	"critical": "P1",
+	"error":    "P2",
+	"warning":  "P3",
+	"info":     "P4",
+}
+
+// Notifier opens an incident when an alert fires and resolves it when the alert is resolved.
+// Incidents are deduplicated per alert rule and charge point, so the alerts of a rule for several
+// connectors of a charge point share one incident, which is resolved with the last of them.
+type Notifier struct {
+	provider   string
+	url        string
+	apiKey     string // PagerDuty integration routing key or Opsgenie API key
+	severity   string
+	httpClient *http.Client
+	queue      chan events.Event
+
+	mu   sync.Mutex
+	open map[string]map[int]bool // Dedup key -> IDs of its firing alerts
+}
+
+// NewNotifier creates an incident notifier for a provider, posting to its default endpoint if endpoint is empty
+func NewNotifier(provider, endpoint, apiKey, severity string) *Notifier {
+	if endpoint == "" {
+		switch provider {
+		case PagerDuty:
+			endpoint = PagerDutyURL
+		case Opsgenie:
+			endpoint = OpsgenieURL
+		}
+	}
+
+	return &Notifier{
+		provider:   provider,
+		url:        endpoint,
+		apiKey:     apiKey,
+		severity:   severity,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		queue:      make(chan events.Event, queueSize),
+		open:       make(map[string]map[int]bool),
+	}
+}
+
+// Enabled reports whether a provider is configured
+func (n *Notifier) Enabled() bool {
+	return n.provider != ""
+}
+
+// DedupKey returns the key deduplicating the incidents of an alert rule for a charge point
+func DedupKey(alert *models.Alert) string {
+	return fmt.Sprintf("cpms-%s-%s", alert.RuleID, alert.ChargePointID)
+}
+
+// Handle queues alert firing and resolution events for delivery. It is meant to be subscribed to an events.Bus.
+func (n *Notifier) Handle(event events.Event) {
+	if !n.Enabled() || (event.Type != events.AlertFiring && event.Type != events.AlertResolved) {
+		return
+	}
+
+	select {
+	case n.queue <- event:
+	default:
+		logrus.WithFields(logrus.Fields{
+			"eventID":   event.ID,
+			"eventType": event.Type,
+		}).Warn("Incident queue full, dropping event")
+	}
+}
+
+// Run delivers queued alert events until the queue is closed
+func (n *Notifier) Run() {
+	for event := range n.queue {
+		alert, ok := event.Data.(*models.Alert)
+		if !ok {
+			continue
+		}
+
+		key := DedupKey(alert)
+		var err error
+		if event.Type == events.AlertFiring {
+			if n.track(key, alert.ID) {
+				err = n.deliver(func() error { return n.trigger(key, alert) })
+			}
+		} else if n.untrack(key, alert.ID) {
+			err = n.deliver(func() error { return n.resolve(key, alert) })
+		}
+
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"provider": n.provider,
+				"alertID":  alert.ID,
+				"dedupKey": key,
+			}).Error("Failed to update incident")
+		}
+	}
+}
+
+// track records a firing alert of a dedup key and reports whether it is the first, which opens the incident
+func (n *Notifier) track(key string, alertID int) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	alerts, ok := n.open[key]
+	if !ok {
+		alerts = make(map[int]bool)
+		n.open[key] = alerts
+	}
+	alerts[alertID] = true
+	return len(alerts) == 1
+}
+
+// untrack forgets a resolved alert of a dedup key and reports whether it was the last, which resolves the incident.
+// Alerts fired before a restart are not tracked and resolve their incident.
+func (n *Notifier) untrack(key string, alertID int) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	alerts := n.open[key]
+	delete(alerts, alertID)
+	if len(alerts) > 0 {
+		return false
+	}
+	delete(n.open, key)
+	return true
+}
+
+// deliver calls the provider, retrying with backoff on failure
+func (n *Notifier) deliver(call func() error) error {
+	backoff := retryBackoff
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err = call(); err == nil {
+			return nil
+		}
+		if attempt < maxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return err
+}
+
+// trigger opens the incident of a dedup key
+func (n *Notifier) trigger(key string, alert *models.Alert) error {
+	details := map[string]interface{}{
+		"alertId":       alert.ID,
+		"ruleId":        alert.RuleID,
+		"ruleName":      alert.RuleName,
+		"condition":     alert.Condition,
+		"chargePointId": alert.ChargePointID,
+		"firedAt":       alert.FiredAt,
+	}
+	if alert.ConnectorID > 0 {
+		details["connectorId"] = alert.ConnectorID
+	}
+	if alert.DiagnosticsFile != "" {
+		details["diagnosticsFile"] = alert.DiagnosticsFile
+	}
+
+	switch n.provider {
+	case PagerDuty:
+		return n.post(n.url, map[string]interface{}{
+			"routing_key":  n.apiKey,
+			"event_action": "trigger",
+			"dedup_key":    key,
+			"payload": map[string]interface{}{
+				"summary":        alert.Message,
+				"source":         alert.ChargePointID,
+				"severity":       n.severity,
+				"component":      "charge point",
+				"class":          alert.Condition,
+				"timestamp":      alert.FiredAt.Format(time.RFC3339),
+				"custom_details": details,
+			},
+		})
+	case Opsgenie:
+		return n.post(n.url, map[string]interface{}{
+			"message":     truncate(alert.Message, 130),
+			"alias":       key,
+			"description": alert.Message,
+			"source":      "cpms",
+			"entity":      alert.ChargePointID,
+			"tags":        []string{alert.Condition},
+			"priority":    opsgeniePriorities[n.severity],
+			"details":     stringDetails(details),
+		})
+	default:
+		return fmt.Errorf("unsupported incident provider %q", n.provider)
+	}
+}
+
+// resolve resolves the incident of a dedup key
+func (n *Notifier) resolve(key string, alert *models.Alert) error {
+	switch n.provider {
+	case PagerDuty:
+		return n.post(n.url, map[string]interface{}{
+			"routing_key":  n.apiKey,
+			"event_action": "resolve",
+			"dedup_key":    key,
+		})
+	case Opsgenie:
+		return n.post(n.url+"/"+url.PathEscape(key)+"/close?identifierType=alias", map[string]interface{}{
+			"source": "cpms",
+			"note":   "Resolved: " + alert.Message,
+		})
+	default:
+		return fmt.Errorf("unsupported incident provider %q", n.provider)
+	}
+}
+
+func (n *Notifier) post(endpoint string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.provider == Opsgenie {
+		req.Header.Set("Authorization", "GenieKey "+n.apiKey)
+	}
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// stringDetails converts details to the string values Opsgenie accepts
+func stringDetails(details map[string]interface{}) map[string]string {
+	converted := make(map[string]string, len(details))
+	for k, v := range details {
+		if t, ok := v.(time.Time); ok {
+			converted[k] = t.Format(time.RFC3339)
+			continue
+		}
+		converted[k] = fmt.Sprint(v)
+	}
+	return converted
+}
+
+// truncate shortens a string to at most max runes
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
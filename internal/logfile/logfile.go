@@ -0,0 +1,152 @@
+// Package logfile implements a log file rotated by size and age
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the timestamp suffix of rotated log files
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// Writer writes to a log file, moving it aside to a timestamped backup when it grows beyond
+// a maximum size or gets older than the rotation interval. Only the newest backups are kept.
+type Writer struct {
+	path       string
+	maxSize    int64         // Bytes, 0 disables rotation by size
+	interval   time.Duration // 0 disables rotation by age
+	maxBackups int           // 0 keeps all backups
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	created time.Time
+}
+
+// New opens the log file at path for appending, creating it and its directory if needed
+func New(path string, maxSizeMB int, interval time.Duration, maxBackups int) (*Writer, error) {
+	w := &Writer{
+		path:       path,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		interval:   interval,
+		maxBackups: maxBackups,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write appends to the log file, rotating it first if the write would exceed the maximum size
+// or the rotation interval has passed
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.dueForRotation(int64(len(p))) {
+		if err := w.rotate(); err != nil {
+			// Keep logging to the current file rather than losing log lines
+			fmt.Fprintf(os.Stderr, "failed to rotate log file %s: %v\n", w.path, err)
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close closes the log file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
+
+// dueForRotation reports whether the log file must be rotated before writing n bytes.
+// A file is never rotated while empty.
+func (w *Writer) dueForRotation(n int64) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.maxSize > 0 && w.size+n > w.maxSize {
+		return true
+	}
+	return w.interval > 0 && time.Since(w.created) >= w.interval
+}
+
+// open opens the log file, continuing an existing one
+func (w *Writer) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	w.file = file
+	w.size = info.Size()
+	w.created = time.Now()
+	return nil
+}
+
+// rotate moves the log file to a backup, starts a new one and removes the oldest backups
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	backup := w.path + "." + time.Now().UTC().Format(backupTimeFormat)
+	if err := os.Rename(w.path, backup); err != nil {
+		// Reopen the current file so logging continues
+		if openErr := w.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	return w.removeOldBackups()
+}
+
+// removeOldBackups removes all but the newest maxBackups backups
+func (w *Writer) removeOldBackups() error {
+	if w.maxBackups <= 0 {
+		return nil
+	}
+
+	backups, err := filepath.Glob(w.path + ".*")
+	if err != nil {
+		return err
+	}
+
+	// The timestamp suffix sorts chronologically
+	var matching []string
+	for _, backup := range backups {
+		if _, err := time.Parse(backupTimeFormat, strings.TrimPrefix(backup, w.path+".")); err == nil {
+			matching = append(matching, backup)
+		}
+	}
+	sort.Strings(matching)
+
+	for len(matching) > w.maxBackups {
+		if err := os.Remove(matching[0]); err != nil {
+			return err
+		}
+		matching = matching[1:]
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package ocpp
+
+import (
+	"context"
+	"net"
+
+	"github.com/balu-dk/go-cpms/internal/clientip"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/siem"
+	"github.com/sirupsen/logrus"
+)
+
+// Actions of connection address rules
+const (
+	AddressRuleAllow = "allow"
+	AddressRuleDeny  = "deny"
+)
+
+// addressAllowed reports whether a charge point may connect from its client address under the global address rules
+// and those of its tenant. The tenant is the one of the OCPP endpoint, or else the one the charge point is assigned to.
+func (cs *CentralSystem) addressAllowed(ctx context.Context, chargePointID, tenantID, remoteAddr string) bool {
+	fields := logrus.Fields{
+		"chargePointID": chargePointID,
+		"remoteAddr":    remoteAddr,
+	}
+
+	rules, err := cs.db.GetAddressRules(ctx)
+	if err != nil {
+		logrus.WithError(err).WithFields(fields).Error("Rejected charge point connection, failed to get the address rules")
+		return false
+	}
+	if len(rules) == 0 {
+		return true
+	}
+
+	if tenantID == "" {
+		for _, rule := range rules {
+			if rule.TenantID == "" {
+				continue
+			}
+			if chargePoint, err := cs.db.GetChargePoint(ctx, chargePointID); err == nil {
+				tenantID = chargePoint.TenantID
+			}
+			break
+		}
+	}
+
+	ip := net.ParseIP(remoteAddr)
+	allowRules := 0
+	allowed := false
+	for _, rule := range rules {
+		if rule.TenantID != "" && rule.TenantID != tenantID {
+			continue
+		}
+		matches := ip != nil && addressRuleMatches(rule, ip)
+
+		switch rule.Action {
+		case AddressRuleDeny:
+			if matches {
+				cs.rejectAddress(chargePointID, remoteAddr, rule, fields)
+				return false
+			}
+		case AddressRuleAllow:
+			allowRules++
+			allowed = allowed || matches
+		}
+	}
+
+	if allowRules > 0 && !allowed {
+		cs.rejectAddress(chargePointID, remoteAddr, nil, fields)
+		return false
+	}
+	return true
+}
+
+// rejectAddress reports a connection rejected by a deny rule, or by missing every allow rule if rule is nil
+func (cs *CentralSystem) rejectAddress(chargePointID, remoteAddr string, rule *models.AddressRule, fields logrus.Fields) {
+	if rule == nil {
+		logrus.WithFields(fields).Warn("Rejected charge point connecting from outside the allowed networks")
+		cs.siem.Security("connection.rejected", siem.SeverityHigh, chargePointID, "Client address is not in an allowed network", map[string]string{
+			"remoteAddr": remoteAddr,
+		})
+		return
+	}
+
+	logrus.WithFields(fields).WithField("ruleId", rule.ID).Warn("Rejected charge point connecting from a denied network")
+	cs.siem.Security("connection.rejected", siem.SeverityHigh, chargePointID, "Client address is in a denied network", map[string]string{
+		"remoteAddr": remoteAddr,
+		"ruleId":     rule.ID,
+	})
+}
+
+// addressRuleMatches reports whether an address is in the network of a rule
+func addressRuleMatches(rule *models.AddressRule, ip net.IP) bool {
+	networks, err := clientip.ParseNetworks([]string{rule.CIDR})
+	if err != nil {
+		logrus.WithError(err).WithField("ruleId", rule.ID).Warn("Skipping address rule with an invalid network")
+		return false
+	}
+	return networks[0].Contains(ip)
+}
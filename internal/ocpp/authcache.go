@@ -0,0 +1,131 @@
+package ocpp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+)
+
+// authCachePruneEvery is the number of results cached between removals of the expired ones
+const authCachePruneEvery = 1000
+
+// authCache keeps the authorization results of idTags per charge point for a time depending on their status,
+// so Authorize and StartTransaction requests are answered without asking the database or the external
+// authorization endpoint every time. Results of statuses without a TTL are not cached.
+type authCache struct {
+	ttls map[string]time.Duration // Authorization status -> time its results are kept
+
+	mu      sync.Mutex
+	entries map[string]map[string]authCacheEntry // IdTag -> charge point ID -> result
+	puts    int
+}
+
+// authCacheEntry is a cached authorization result
+type authCacheEntry struct {
+	idTagInfo *types.IdTagInfo
+	expires   time.Time
+}
+
+// newAuthCache creates a cache keeping results for the TTL in seconds of their status
+func newAuthCache(ttls map[string]int) *authCache {
+	c := &authCache{
+		ttls:    make(map[string]time.Duration),
+		entries: make(map[string]map[string]authCacheEntry),
+	}
+	for status, seconds := range ttls {
+		c.ttls[status] = time.Duration(seconds) * time.Second
+	}
+	return c
+}
+
+// get returns the cached result of an idTag at a charge point
+func (c *authCache) get(chargePointID, idTag string) (*types.IdTagInfo, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[idTag][chargePointID]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(entry.expires) {
+		delete(c.entries[idTag], chargePointID)
+		return nil, false
+	}
+	return entry.idTagInfo, true
+}
+
+// put caches the result of an idTag at a charge point, no longer than until the expiry date of the idTag
+func (c *authCache) put(chargePointID, idTag string, idTagInfo *types.IdTagInfo) {
+	if c == nil {
+		return
+	}
+
+	ttl := c.ttls[string(idTagInfo.Status)]
+	if ttl <= 0 {
+		return
+	}
+	expires := time.Now().Add(ttl)
+	if idTagInfo.ExpiryDate != nil && idTagInfo.ExpiryDate.Before(expires) {
+		expires = idTagInfo.ExpiryDate.Time
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries[idTag] == nil {
+		c.entries[idTag] = make(map[string]authCacheEntry)
+	}
+	c.entries[idTag][chargePointID] = authCacheEntry{idTagInfo: idTagInfo, expires: expires}
+
+	c.puts++
+	if c.puts%authCachePruneEvery == 0 {
+		c.prune()
+	}
+}
+
+// prune removes the expired results, the caller holds the lock
+func (c *authCache) prune() {
+	now := time.Now()
+	for idTag, results := range c.entries {
+		for chargePointID, entry := range results {
+			if !now.Before(entry.expires) {
+				delete(results, chargePointID)
+			}
+		}
+		if len(results) == 0 {
+			delete(c.entries, idTag)
+		}
+	}
+}
+
+// invalidateIdTag removes the results of an idTag at all charge points
+func (c *authCache) invalidateIdTag(idTag string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, idTag)
+}
+
+// invalidateChargePoint removes the results of all idTags at a charge point
+func (c *authCache) invalidateChargePoint(chargePointID string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for idTag, results := range c.entries {
+		delete(results, chargePointID)
+		if len(results) == 0 {
+			delete(c.entries, idTag)
+		}
+	}
+}
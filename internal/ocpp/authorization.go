@@ -0,0 +1,173 @@
+package ocpp
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/authcallout"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/siem"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/sirupsen/logrus"
+)
+
+// authorizeIdTag checks an idTag against the tenant owning the charge point and
+// reports rejected idTags to the SIEM
+func (cs *CentralSystem) authorizeIdTag(ctx context.Context, chargePointID, idTag string) *types.IdTagInfo {
+	idTagInfo, _ := cs.lookupIdTag(ctx, chargePointID, idTag)
+	cs.reportRejectedIdTag(chargePointID, idTag, idTagInfo)
+	return idTagInfo
+}
+
+// authorizeRequest checks the idTag of an Authorize or StartTransaction request with the external authorization
+// endpoint if one is configured, and against the tenant owning the charge point otherwise. Charge points in free
+// vend mode accept every idTag. Results are served from the authorization cache while they are fresh.
+// Rejected idTags are reported to the SIEM.
+func (cs *CentralSystem) authorizeRequest(ctx context.Context, action, chargePointID string, connectorID int, idTag string) *types.IdTagInfo {
+	idTagInfo, cached := cs.authCache.get(chargePointID, idTag)
+	if !cached {
+		var decided bool
+		if cs.freeVend(ctx, chargePointID) {
+			idTagInfo, decided = types.NewIdTagInfo(types.AuthorizationStatusAccepted), true
+		} else if cs.callout == nil {
+			idTagInfo, decided = cs.lookupIdTag(ctx, chargePointID, idTag)
+		} else {
+			idTagInfo, decided = cs.calloutIdTag(ctx, authcallout.Request{
+				Action:        action,
+				ChargePointID: chargePointID,
+				ConnectorID:   connectorID,
+				IdTag:         idTag,
+			})
+		}
+		// Results of failed lookups and fallbacks are not kept, the next request tries again
+		if decided {
+			cs.authCache.put(chargePointID, idTag, idTagInfo)
+		}
+	}
+
+	cs.reportRejectedIdTag(chargePointID, idTag, idTagInfo)
+	return idTagInfo
+}
+
+// InvalidateIdTagAuthorization removes the cached authorization results of an idTag, after it was changed
+func (cs *CentralSystem) InvalidateIdTagAuthorization(idTag string) {
+	cs.authCache.invalidateIdTag(idTag)
+}
+
+// InvalidateChargePointAuthorization removes the cached authorization results at a charge point,
+// after it was assigned to another tenant
+func (cs *CentralSystem) InvalidateChargePointAuthorization(chargePointID string) {
+	cs.authCache.invalidateChargePoint(chargePointID)
+}
+
+// freeVend reports whether a charge point or its site is in free vend mode
+func (cs *CentralSystem) freeVend(ctx context.Context, chargePointID string) bool {
+	freeVend, err := cs.db.IsFreeVend(ctx, chargePointID)
+	if err != nil {
+		logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to check free vend mode")
+	}
+	return freeVend
+}
+
+// calloutIdTag asks the external authorization endpoint whether to accept an idTag, applying the fallback policy
+// when the endpoint fails or times out. It reports whether the endpoint decided.
+func (cs *CentralSystem) calloutIdTag(ctx context.Context, request authcallout.Request) (*types.IdTagInfo, bool) {
+	result, err := cs.callout.Authorize(ctx, request)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"chargePointID": request.ChargePointID,
+			"idTag":         request.IdTag,
+			"fallback":      cs.config.AuthCalloutFallback,
+		}).Warn("External authorization failed, applying fallback policy")
+
+		switch cs.config.AuthCalloutFallback {
+		case "accept":
+			return types.NewIdTagInfo(types.AuthorizationStatusAccepted), false
+		case "reject":
+			return types.NewIdTagInfo(types.AuthorizationStatusInvalid), false
+		default:
+			idTagInfo, _ := cs.lookupIdTag(ctx, request.ChargePointID, request.IdTag)
+			return idTagInfo, false
+		}
+	}
+
+	idTagInfo := types.NewIdTagInfo(types.AuthorizationStatus(result.Status))
+	if result.ParentIdTag != "" {
+		idTagInfo.ParentIdTag = result.ParentIdTag
+	}
+	if !result.ExpiryDate.IsZero() {
+		idTagInfo.ExpiryDate = types.NewDateTime(result.ExpiryDate)
+	}
+	return idTagInfo, true
+}
+
+// reportRejectedIdTag reports an idTag to the SIEM unless it was accepted
+func (cs *CentralSystem) reportRejectedIdTag(chargePointID, idTag string, idTagInfo *types.IdTagInfo) {
+	if idTagInfo.Status != types.AuthorizationStatusAccepted {
+		cs.siem.Security("authorization.rejected", siem.SeverityMedium, chargePointID, "IdTag rejected", map[string]string{
+			"idTag":  idTag,
+			"status": string(idTagInfo.Status),
+		})
+	}
+}
+
+// authorizeStop checks the idTag a transaction is stopped with against the tenant owning the charge point.
+// An idTag other than the one that started the transaction is only accepted if both are in the same group.
+func (cs *CentralSystem) authorizeStop(ctx context.Context, chargePointID, idTag string, tx *models.Transaction) *types.IdTagInfo {
+	idTagInfo := cs.authorizeIdTag(ctx, chargePointID, idTag)
+	if idTagInfo.Status != types.AuthorizationStatusAccepted {
+		return idTagInfo
+	}
+
+	same, err := db.SameIdTagGroup(ctx, cs.db, chargePointID, idTag, tx.IdTag)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"idTag":         idTag,
+		}).Error("Failed to look up idTag group")
+		return types.NewIdTagInfo(types.AuthorizationStatusInvalid)
+	}
+	if !same {
+		cs.siem.Security("authorization.stop_rejected", siem.SeverityMedium, chargePointID, "Transaction stopped by an idTag outside its group", map[string]string{
+			"idTag":         idTag,
+			"transactionId": strconv.Itoa(tx.ID),
+			"startIdTag":    tx.IdTag,
+		})
+		return types.NewIdTagInfo(types.AuthorizationStatusInvalid)
+	}
+	return idTagInfo
+}
+
+// lookupIdTag returns the authorization status of an idTag in the tenant owning the charge point.
+// Charge points not assigned to a tenant accept every idTag. It reports whether the lookup succeeded,
+// the idTag is Invalid if it failed.
+func (cs *CentralSystem) lookupIdTag(ctx context.Context, chargePointID, idTag string) (*types.IdTagInfo, bool) {
+	tenantID, tag, err := cs.db.GetIdTagForChargePoint(ctx, chargePointID, idTag)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"idTag":         idTag,
+		}).Error("Failed to look up idTag")
+		return types.NewIdTagInfo(types.AuthorizationStatusInvalid), false
+	}
+
+	if tenantID == "" {
+		return types.NewIdTagInfo(types.AuthorizationStatusAccepted), true
+	}
+
+	if tag == nil {
+		return types.NewIdTagInfo(types.AuthorizationStatusInvalid), true
+	}
+
+	// Known idTags carry their expiry date and group whatever their status, so charge points cache them correctly
+	idTagInfo := types.NewIdTagInfo(types.AuthorizationStatus(tag.AuthorizationStatus(time.Now())))
+	if tag.ParentIdTag != "" {
+		idTagInfo.ParentIdTag = tag.ParentIdTag
+	}
+	if !tag.ExpiryDate.IsZero() {
+		idTagInfo.ExpiryDate = types.NewDateTime(tag.ExpiryDate)
+	}
+	return idTagInfo, true
+}
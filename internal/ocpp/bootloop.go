@@ -0,0 +1,141 @@
+package ocpp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/sirupsen/logrus"
+)
+
+// bootHistory holds the recent BootNotifications of a charge point
+type bootHistory struct {
+	mu      sync.Mutex
+	boots   []time.Time                   // Times of the boots within the window, oldest first
+	last    *core.BootNotificationRequest // Latest boot
+	looping bool
+}
+
+// bootCheck is the outcome of tracking a BootNotification
+type bootCheck struct {
+	boots     int  // Boots within the window, this one included
+	looping   bool // The charge point is in a reboot loop
+	duplicate bool // The boot reports the same vendor, model, serial number and firmware as the previous one
+}
+
+// rebootLoopEvent is the data of a chargepoint.reboot_loop event
+type rebootLoopEvent struct {
+	Boots         int `json:"boots"`
+	WindowSeconds int `json:"windowSeconds"`
+	Interval      int `json:"interval"` // Seconds returned in the BootNotification response
+}
+
+// sameBoot reports whether two BootNotifications describe the same charge point and firmware
+func sameBoot(a, b *core.BootNotificationRequest) bool {
+	return a.ChargePointVendor == b.ChargePointVendor &&
+		a.ChargePointModel == b.ChargePointModel &&
+		a.ChargePointSerialNumber == b.ChargePointSerialNumber &&
+		a.FirmwareVersion == b.FirmwareVersion
+}
+
+// trackBoot records a BootNotification of a charge point. A charge point sending the configured number of them
+// within the window is in a reboot loop, which is recorded on the charge point and published when it starts.
+// The first boot seen by this instance clears a loop another instance may have recorded.
+func (cs *CentralSystem) trackBoot(ctx context.Context, chargePointID string, request *core.BootNotificationRequest, now time.Time) bootCheck {
+	if cs.replaying || cs.config.BootLoopThreshold <= 0 {
+		return bootCheck{}
+	}
+
+	value, loaded := cs.bootHistories.LoadOrStore(chargePointID, &bootHistory{})
+	history := value.(*bootHistory)
+	window := time.Duration(cs.config.BootLoopWindow) * time.Second
+
+	history.mu.Lock()
+	recent := history.boots[:0]
+	for _, boot := range history.boots {
+		if now.Sub(boot) < window {
+			recent = append(recent, boot)
+		}
+	}
+	history.boots = append(recent, now)
+	check := bootCheck{
+		boots:     len(history.boots),
+		looping:   len(history.boots) >= cs.config.BootLoopThreshold,
+		duplicate: history.last != nil && sameBoot(history.last, request),
+	}
+	started := check.looping && !history.looping
+	ended := !check.looping && (history.looping || !loaded)
+	history.looping = check.looping
+	history.last = request
+	history.mu.Unlock()
+
+	switch {
+	case started:
+		interval := cs.bootInterval(check)
+		logrus.WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"boots":         check.boots,
+			"window":        window,
+			"interval":      interval,
+		}).Warn("Charge point is in a reboot loop")
+
+		cs.updateRebootLoop(ctx, chargePointID, now)
+		cs.events.Publish(events.ChargePointRebootLoop, chargePointID, rebootLoopEvent{
+			Boots:         check.boots,
+			WindowSeconds: cs.config.BootLoopWindow,
+			Interval:      interval,
+		})
+	case ended:
+		cs.updateRebootLoop(ctx, chargePointID, time.Time{})
+	}
+	return check
+}
+
+// endBootLoop ends the reboot loop of a charge point that stayed up for the window since its last boot
+func (cs *CentralSystem) endBootLoop(ctx context.Context, chargePointID string, now time.Time) {
+	value, ok := cs.bootHistories.Load(chargePointID)
+	if !ok {
+		return
+	}
+	history := value.(*bootHistory)
+	window := time.Duration(cs.config.BootLoopWindow) * time.Second
+
+	history.mu.Lock()
+	ended := history.looping && now.Sub(history.boots[len(history.boots)-1]) >= window
+	if ended {
+		history.looping = false
+	}
+	history.mu.Unlock()
+
+	if ended {
+		logrus.WithField("chargePointID", chargePointID).Info("Charge point left its reboot loop")
+		cs.updateRebootLoop(ctx, chargePointID, time.Time{})
+	}
+}
+
+// updateRebootLoop records the start of a charge point's reboot loop, or a zero time when it ended
+func (cs *CentralSystem) updateRebootLoop(ctx context.Context, chargePointID string, since time.Time) {
+	if err := cs.db.UpdateRebootLoop(ctx, chargePointID, since); err != nil {
+		logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to record charge point reboot loop")
+	}
+}
+
+// bootInterval returns the interval of a BootNotification response: the heartbeat interval, doubled for every
+// boot of a reboot loop up to the configured maximum, which slows down the charge point's messages
+func (cs *CentralSystem) bootInterval(check bootCheck) int {
+	heartbeatInterval := cs.HeartbeatInterval()
+	if !check.looping || heartbeatInterval >= cs.config.BootLoopMaxInterval {
+		return heartbeatInterval
+	}
+
+	interval := heartbeatInterval
+	for boot := cs.config.BootLoopThreshold; boot <= check.boots && interval < cs.config.BootLoopMaxInterval; boot++ {
+		interval *= 2
+	}
+	if interval > cs.config.BootLoopMaxInterval {
+		interval = cs.config.BootLoopMaxInterval
+	}
+	return interval
+}
@@ -2,34 +2,106 @@ package ocpp
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/balu-dk/go-cpms/config"
+	"github.com/balu-dk/go-cpms/internal/authcallout"
 	"github.com/balu-dk/go-cpms/internal/db"
 	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/balu-dk/go-cpms/internal/pnc"
+	"github.com/balu-dk/go-cpms/internal/ratelimit"
+	"github.com/balu-dk/go-cpms/internal/siem"
+	"github.com/balu-dk/go-cpms/internal/tariff"
 	ocpp16 "github.com/lorenzodonini/ocpp-go/ocpp1.6"
 	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
 	"github.com/lorenzodonini/ocpp-go/ocpp1.6/firmware"
 	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	ocpp201 "github.com/lorenzodonini/ocpp-go/ocpp2.0.1"
+	types201 "github.com/lorenzodonini/ocpp-go/ocpp2.0.1/types"
+	"github.com/lorenzodonini/ocpp-go/ws"
 	"github.com/sirupsen/logrus"
 )
 
 // CentralSystem manages the OCPP central system
 type CentralSystem struct {
-	OcppServer ocpp16.CentralSystem
-	db         *db.PostgresStore
-	logger     *OCPPLogger
-	config     *config.Config
+	OcppServer     ocpp16.CentralSystem
+	csms           ocpp201.CSMS // Endpoint of the charging stations connecting with the ocpp2.0.1 subprotocol
+	frames         *tapServer   // Routes the connections to the endpoint of their subprotocol
+	wsServer       *ws.Server
+	db             db.Store
+	logger         *OCPPLogger
+	config         *config.Config
+	tariff         *tariff.Engine
+	events         *events.Bus
+	siem           *siem.Forwarder
+	pendingTenants sync.Map           // Charge point ID -> tenant ID resolved during the websocket handshake
+	pendingConns   sync.Map           // Charge point ID -> connection metadata taken from the websocket handshake
+	pendingLinks   sync.Map           // Charge point ID -> *upstreamLink opened during the websocket handshake
+	connections    sync.Map           // IDs of the charge points connected to this instance
+	messageLimiter *ratelimit.Limiter // Inbound message rate limit per charge point
+	connectLimiter *ratelimit.Limiter // Connection attempt rate limit per client address
+	maxConnections atomic.Int64       // Concurrent connections accepted by this instance, 0 is unlimited
+	throttled      sync.Map           // IDs of the charge points over their message rate limit
+	clockDrifts    sync.Map           // Charge point ID -> *clockDrift
+	bootHistories  sync.Map           // Charge point ID -> *bootHistory
+	statusChanges  sync.Map           // connectorKey -> *pendingStatus held back by the status debounce
+	liveReadings   sync.Map           // Charge point ID -> *liveReadings
+	txUpdates      sync.Map           // Transaction ID -> time of its last transaction.updated event
+	limitChecks    sync.Map           // Transaction ID -> time of its last cost and energy cap check
+	taps           *taps              // Subscribers to the raw frames of charge points
+	replaying      bool               // Set on the central system handling replayed messages, which sends no commands
+
+	heartbeatInterval atomic.Int64 // Seconds, sent to charge points in boot notification responses
+
+	callout   *authcallout.Client // External authorization endpoint, nil authorizes against the local idTags
+	authCache *authCache          // Recent authorization results, nil caches none
+
+	pncVerifier *pnc.Verifier // Verifies contract certificates, nil leaves verifying them to the charge points
+	pncClient   *pnc.Client   // Certificate provider for the contract certificates of vehicles, nil rejects their requests
 }
 
 // NewCentralSystem creates a new OCPP central system
-func NewCentralSystem(cfg *config.Config, store *db.PostgresStore) *CentralSystem {
+func NewCentralSystem(cfg *config.Config, store db.Store, tariffEngine *tariff.Engine, bus *events.Bus, forwarder *siem.Forwarder) *CentralSystem {
+	wsServer := ws.NewServer()
+	wsServer.SetTimeoutConfig(webSocketTimeouts(cfg))
+	frameTaps := &taps{subs: make(map[string]map[chan Frame]struct{})}
+	frameServer := newTapServer(wsServer, frameTaps, cfg.OCPPWSMaxMessageSize)
 	cs := &CentralSystem{
-		OcppServer: ocpp16.NewCentralSystem(nil, nil),
+		OcppServer: ocpp16.NewCentralSystem(nil, frameServer.forSubprotocol(types.V16Subprotocol)),
+		csms:       ocpp201.NewCSMS(nil, frameServer.forSubprotocol(types201.V201Subprotocol)),
+		frames:     frameServer,
+		wsServer:   wsServer,
 		db:         store,
-		logger:     NewOCPPLogger(store),
+		logger:     NewOCPPLogger(store, forwarder, cfg.OCPPLogRedactFields, cfg.OCPPLogFullChargePoints),
 		config:     cfg,
+		tariff:     tariffEngine,
+		events:     bus,
+		siem:       forwarder,
+
+		messageLimiter: ratelimit.New(cfg.OCPPMessageRateLimit, cfg.OCPPMessageRateBurst),
+		connectLimiter: ratelimit.New(cfg.OCPPConnectRateLimit, cfg.OCPPConnectRateBurst),
+		taps:           frameTaps,
+	}
+	frameServer.quarantine = cs.quarantineFrame
+	frameServer.negotiated = cs.pendingSubprotocol
+	frameServer.pendingUpstream = cs.takePendingUpstream
+	for _, subprotocol := range cs.subprotocols() {
+		wsServer.AddSupportedSubprotocol(subprotocol)
+	}
+	cs.heartbeatInterval.Store(int64(cfg.HeartbeatInterval))
+	cs.maxConnections.Store(int64(cfg.OCPPMaxConnections))
+	if cfg.AuthCalloutURL != "" {
+		cs.callout = authcallout.NewClient(cfg.AuthCalloutURL, cfg.AuthCalloutHeader, time.Duration(cfg.AuthCalloutTimeout)*time.Millisecond)
+	}
+	if len(cfg.AuthCacheTTLs) > 0 {
+		cs.authCache = newAuthCache(cfg.AuthCacheTTLs)
+	}
+	if cfg.PnCCertificateURL != "" {
+		cs.pncClient = pnc.NewClient(cfg.PnCCertificateURL, cfg.PnCCertificateHeader, time.Duration(cfg.PnCCertificateTimeout)*time.Millisecond)
 	}
 
 	// Set up OCPP handlers
@@ -39,9 +111,22 @@ func NewCentralSystem(cfg *config.Config, store *db.PostgresStore) *CentralSyste
 	cs.OcppServer.SetCoreHandler(centralSystemHandler)
 	cs.OcppServer.SetFirmwareManagementHandler(centralSystemHandler)
 
+	csmsHandler := &CSMSHandler{
+		cs: cs,
+	}
+	cs.csms.SetProvisioningHandler(csmsHandler)
+	cs.csms.SetAvailabilityHandler(csmsHandler)
+
 	// Set up connection handlers
+	wsServer.SetCheckOriginHandler(cs.acceptConnection)
 	cs.OcppServer.SetNewChargePointHandler(cs.handleNewChargePoint)
 	cs.OcppServer.SetChargePointDisconnectedHandler(cs.handleChargePointDisconnected)
+	cs.csms.SetNewChargingStationHandler(func(station ocpp201.ChargingStationConnection) {
+		cs.handleNewChargePoint(station)
+	})
+	cs.csms.SetChargingStationDisconnectedHandler(func(station ocpp201.ChargingStationConnection) {
+		cs.handleChargePointDisconnected(station)
+	})
 
 	return cs
 }
@@ -49,18 +134,95 @@ func NewCentralSystem(cfg *config.Config, store *db.PostgresStore) *CentralSyste
 // Start starts the OCPP central system
 func (cs *CentralSystem) Start() error {
 	logrus.Infof("Starting OCPP central system on port %d with path %s", cs.config.ServerPort, cs.config.OCPPPath)
+	cs.clearConnections()
+
+	if cs.config.PnCRootCerts != "" {
+		verifier, err := pnc.LoadVerifier(cs.config.PnCRootCerts)
+		if err != nil {
+			return err
+		}
+		cs.pncVerifier = verifier
+	}
+
+	// The OCPP 1.6 and 2.0.1 endpoints start their dispatchers and return, they share the websocket server,
+	// which negotiates the subprotocol of each connection. Start blocks until the websocket server is stopped.
 	cs.OcppServer.Start(cs.config.ServerPort, cs.config.OCPPPath)
+	cs.csms.Start(cs.config.ServerPort, cs.config.OCPPPath)
+	go cs.wsServer.Start(cs.config.ServerPort, cs.config.OCPPPath)
 	return nil
 }
 
+// Stop stops accepting charge point connections and closes the open websockets.
+// It waits for the charge points to disconnect until the context expires,
+// then marks the ones still connected to this instance as disconnected.
+func (cs *CentralSystem) Stop(ctx context.Context) {
+	logrus.Info("Stopping OCPP central system")
+
+	// Shutting down the websocket server closes all open connections with a normal closure
+	cs.wsServer.Stop()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+wait:
+	for cs.connectionCount() > 0 {
+		select {
+		case <-ctx.Done():
+			break wait
+		case <-ticker.C:
+		}
+	}
+
+	// The shutdown deadline may have passed, the remaining cleanup gets its own
+	dbCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cs.connections.Range(func(key, _ interface{}) bool {
+		chargePointID := key.(string)
+		logrus.WithField("chargePointID", chargePointID).Warn("Charge point did not disconnect before shutdown")
+
+		if err := cs.db.UpdateChargePointConnection(dbCtx, chargePointID, false); err != nil {
+			logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to update charge point connection status")
+		}
+		cs.recordDisconnection(dbCtx, chargePointID)
+		cs.unregisterConnection(dbCtx, chargePointID)
+		return true
+	})
+}
+
+// HeartbeatInterval returns the heartbeat interval in seconds sent to booting charge points
+func (cs *CentralSystem) HeartbeatInterval() int {
+	return int(cs.heartbeatInterval.Load())
+}
+
+// SetHeartbeatInterval changes the heartbeat interval sent to charge points from their next boot notification
+func (cs *CentralSystem) SetHeartbeatInterval(seconds int) {
+	cs.heartbeatInterval.Store(int64(seconds))
+}
+
+// SetMessageRateLimit changes the inbound message rate limit per charge point, 0 disables the limit
+func (cs *CentralSystem) SetMessageRateLimit(rate float64, burst int) {
+	cs.messageLimiter.SetLimit(rate, burst)
+}
+
 // handleNewChargePoint handles a new charge point connection
 func (cs *CentralSystem) handleNewChargePoint(cp ocpp16.ChargePointConnection) {
-	logrus.WithField("chargePointID", cp.ID()).Info("New charge point connected")
+	metadata := &models.ConnectionEvent{ChargePointID: cp.ID()}
+	if pending, ok := cs.pendingConns.LoadAndDelete(cp.ID()); ok {
+		metadata = pending.(*models.ConnectionEvent)
+	}
+	logrus.WithFields(logrus.Fields{
+		"chargePointID": cp.ID(),
+		"remoteAddr":    metadata.RemoteAddr,
+		"subprotocol":   metadata.Subprotocol,
+	}).Info("New charge point connected")
 
 	// Create a new charge point record or update the existing one
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	cs.registerConnection(ctx, cp.ID())
+
 	// Get existing charge point or create a minimal record
 	// Full details will be updated when BootNotification is received
 	chargePoint, err := cs.db.GetChargePoint(ctx, cp.ID())
@@ -82,7 +244,11 @@ func (cs *CentralSystem) handleNewChargePoint(cp ocpp16.ChargePointConnection) {
 
 	if err := cs.db.SaveChargePoint(ctx, chargePoint); err != nil {
 		logrus.WithError(err).WithField("chargePointID", cp.ID()).Error("Failed to save charge point")
+		return
 	}
+
+	cs.recordConnection(ctx, metadata)
+	cs.assignPendingTenant(ctx, chargePoint)
 }
 
 // handleChargePointDisconnected handles a charge point disconnection
@@ -92,9 +258,13 @@ func (cs *CentralSystem) handleChargePointDisconnected(cp ocpp16.ChargePointConn
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	cs.unregisterConnection(ctx, cp.ID())
+
 	if err := cs.db.UpdateChargePointConnection(ctx, cp.ID(), false); err != nil {
 		logrus.WithError(err).WithField("chargePointID", cp.ID()).Error("Failed to update charge point connection status")
 	}
+	cs.recordDisconnection(ctx, cp.ID())
+	cs.liveReadings.Delete(cp.ID())
 }
 
 // CentralSystemHandler implements the OCPP handlers
@@ -117,26 +287,45 @@ func (h *CentralSystemHandler) OnBootNotification(chargePointID string, request
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	chargePoint := &models.ChargePoint{
-		ID:                 chargePointID,
-		Vendor:             request.ChargePointVendor,
-		Model:              request.ChargePointModel,
-		SerialNumber:       request.ChargePointSerialNumber,
-		FirmwareVersion:    request.FirmwareVersion,
-		LastHeartbeat:      time.Now(),
-		RegistrationStatus: string(core.RegistrationStatusAccepted),
-		IsConnected:        true,
-		ConnectedSince:     time.Now(),
-	}
+	// The repeated boots of a reboot-looping charge point change nothing, so they are not persisted again
+	boot := h.cs.trackBoot(ctx, chargePointID, request, time.Now())
+	if boot.looping && boot.duplicate {
+		logrus.WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"boots":         boot.boots,
+		}).Debug("Skipping the repeated boot of a reboot-looping charge point")
+	} else {
+		chargePoint := &models.ChargePoint{
+			ID:                 chargePointID,
+			Vendor:             request.ChargePointVendor,
+			Model:              request.ChargePointModel,
+			SerialNumber:       request.ChargePointSerialNumber,
+			FirmwareVersion:    request.FirmwareVersion,
+			LastHeartbeat:      time.Now(),
+			RegistrationStatus: string(core.RegistrationStatusAccepted),
+			IsConnected:        true,
+			ConnectedSince:     time.Now(),
+		}
+
+		if err := h.cs.db.SaveChargePoint(ctx, chargePoint); err != nil {
+			logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to save charge point")
+		}
 
-	if err := h.cs.db.SaveChargePoint(ctx, chargePoint); err != nil {
-		logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to save charge point")
+		// Transactions open before the boot may have been lost by the charge point,
+		// and connectors may not report a status until they are used
+		if !h.cs.replaying {
+			go h.cs.reconcileTransactions(chargePointID, time.Now())
+			go h.cs.discoverConnectors(chargePointID)
+			if h.cs.config.OCPPWSPingInterval > 0 {
+				go h.cs.configurePingInterval(chargePointID)
+			}
+		}
 	}
 
 	// Create response
 	conf := core.NewBootNotificationConfirmation(
 		types.NewDateTime(time.Now()),
-		h.cs.config.HeartbeatInterval,
+		h.cs.bootInterval(boot),
 		core.RegistrationStatusAccepted,
 	)
 
@@ -148,6 +337,10 @@ func (h *CentralSystemHandler) OnBootNotification(chargePointID string, request
 
 // OnHeartbeat handles Heartbeat requests
 func (h *CentralSystemHandler) OnHeartbeat(chargePointID string, request *core.HeartbeatRequest) (confirmation *core.HeartbeatConfirmation, err error) {
+	if !h.cs.allowMessage(chargePointID, "Heartbeat") {
+		return core.NewHeartbeatConfirmation(types.NewDateTime(time.Now())), nil
+	}
+
 	logrus.WithField("chargePointID", chargePointID).Debug("Heartbeat received")
 
 	// Log the request
@@ -160,6 +353,7 @@ func (h *CentralSystemHandler) OnHeartbeat(chargePointID string, request *core.H
 	if err := h.cs.db.UpdateHeartbeat(ctx, chargePointID); err != nil {
 		logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to update heartbeat")
 	}
+	h.cs.endBootLoop(ctx, chargePointID, time.Now())
 
 	// Create response
 	conf := core.NewHeartbeatConfirmation(types.NewDateTime(time.Now()))
@@ -172,11 +366,16 @@ func (h *CentralSystemHandler) OnHeartbeat(chargePointID string, request *core.H
 
 // OnStatusNotification handles StatusNotification requests
 func (h *CentralSystemHandler) OnStatusNotification(chargePointID string, request *core.StatusNotificationRequest) (confirmation *core.StatusNotificationConfirmation, err error) {
+	if !h.cs.allowMessage(chargePointID, "StatusNotification") {
+		return core.NewStatusNotificationConfirmation(), nil
+	}
+
 	logrus.WithFields(logrus.Fields{
-		"chargePointID": chargePointID,
-		"connectorId":   request.ConnectorId,
-		"status":        request.Status,
-		"errorCode":     request.ErrorCode,
+		"chargePointID":   chargePointID,
+		"connectorId":     request.ConnectorId,
+		"status":          request.Status,
+		"errorCode":       request.ErrorCode,
+		"vendorErrorCode": request.VendorErrorCode,
 	}).Info("Status notification received")
 
 	// Log the request
@@ -186,18 +385,9 @@ func (h *CentralSystemHandler) OnStatusNotification(chargePointID string, reques
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	connector := &models.Connector{
-		ID:            request.ConnectorId,
-		ChargePointID: chargePointID,
-		Status:        string(request.Status),
-		ErrorCode:     string(request.ErrorCode),
-	}
-
-	if err := h.cs.db.SaveConnector(ctx, connector); err != nil {
-		logrus.WithError(err).WithFields(logrus.Fields{
-			"chargePointID": chargePointID,
-			"connectorId":   request.ConnectorId,
-		}).Error("Failed to save connector status")
+	h.cs.handleStatus(ctx, chargePointID, request)
+	if request.Timestamp != nil {
+		h.cs.measureClockDrift(ctx, chargePointID, request.Timestamp.Time)
 	}
 
 	// Create response
@@ -211,6 +401,10 @@ func (h *CentralSystemHandler) OnStatusNotification(chargePointID string, reques
 
 // OnMeterValues handles MeterValues requests
 func (h *CentralSystemHandler) OnMeterValues(chargePointID string, request *core.MeterValuesRequest) (confirmation *core.MeterValuesConfirmation, err error) {
+	if !h.cs.allowMessage(chargePointID, "MeterValues") {
+		return core.NewMeterValuesConfirmation(), nil
+	}
+
 	logrus.WithFields(logrus.Fields{
 		"chargePointID": chargePointID,
 		"connectorId":   request.ConnectorId,
@@ -223,46 +417,72 @@ func (h *CentralSystemHandler) OnMeterValues(chargePointID string, request *core
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	var batch []*models.MeterValue
+	var latest time.Time
+	var adjusted bool
+	receivedAt := time.Now()
 	for _, meterValue := range request.MeterValue {
+		if meterValue.Timestamp != nil && meterValue.Timestamp.After(latest) {
+			latest = meterValue.Timestamp.Time
+		}
+		timestamp, timestampAdjusted := h.cs.normalizeTimestamp(chargePointID, "MeterValues", meterValue.Timestamp.Time, receivedAt)
+		adjusted = adjusted || timestampAdjusted
 		for _, sampledValue := range meterValue.SampledValue {
-			// Handle only power consumption values by default
-			measurand := "Energy.Active.Import.Register"
-			if sampledValue.Measurand != "" {
-				measurand = string(sampledValue.Measurand)
-			}
-
-			unit := "Wh"
-			if sampledValue.Unit != "" {
-				unit = string(sampledValue.Unit)
-			}
-
-			value := 0.0
-			if v, err := parseFloat64(sampledValue.Value); err == nil {
-				value = v
+			// Vehicle identifiers are recorded on the transaction instead
+			if vehicle, ok := vehicleFromSampledValue(sampledValue); ok {
+				vehicle.ConnectorID = request.ConnectorId
+				if request.TransactionId != nil {
+					vehicle.TransactionID = *request.TransactionId
+				}
+				h.cs.recordVehicle(ctx, chargePointID, vehicle)
+				continue
 			}
 
-			mv := &models.MeterValue{
-				ChargePointID: chargePointID,
-				ConnectorID:   request.ConnectorId,
-				Timestamp:     meterValue.Timestamp.Time,
-				Value:         value,
-				Unit:          unit,
-				Measurand:     measurand,
+			mv, err := meterValueFromSampledValue(sampledValue)
+			if err != nil {
+				h.cs.quarantineSampledValue(chargePointID, "MeterValues", request, sampledValue, err)
+				continue
 			}
+			mv.ChargePointID = chargePointID
+			mv.ConnectorID = request.ConnectorId
+			mv.Timestamp = timestamp
+			mv.TimestampAdjusted = timestampAdjusted
 
 			if request.TransactionId != nil {
 				mv.TransactionID = *request.TransactionId
 			}
 
-			if err := h.cs.db.SaveMeterValue(ctx, mv); err != nil {
-				logrus.WithError(err).WithFields(logrus.Fields{
-					"chargePointID": chargePointID,
-					"connectorId":   request.ConnectorId,
-				}).Error("Failed to save meter value")
-			}
+			batch = append(batch, mv)
+		}
+	}
+
+	if err := h.cs.db.SaveMeterValues(ctx, batch); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"connectorId":   request.ConnectorId,
+			"samples":       len(batch),
+		}).Error("Failed to save meter values")
+	}
+	h.cs.measureClockDrift(ctx, chargePointID, latest)
+
+	transactionID := 0
+	if request.TransactionId != nil {
+		transactionID = *request.TransactionId
+	}
+	h.cs.updateLiveReadings(chargePointID, request.ConnectorId, transactionID, batch)
+	if request.TransactionId != nil {
+		h.cs.recordSoC(ctx, chargePointID, *request.TransactionId, batch)
+		if adjusted {
+			h.cs.flagAdjustedTimestamp(ctx, chargePointID, *request.TransactionId)
 		}
 	}
 
+	// Stop the transaction if it reached its cost or energy cap
+	if request.TransactionId != nil {
+		h.cs.checkSessionLimits(ctx, chargePointID, *request.TransactionId)
+		h.cs.publishTransactionUpdated(ctx, chargePointID, *request.TransactionId)
+	}
+
 	// Create response
 	conf := core.NewMeterValuesConfirmation()
 
@@ -287,14 +507,66 @@ func (h *CentralSystemHandler) OnStartTransaction(chargePointID string, request
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	// Charge points retransmit StartTransaction when the confirmation was lost, answer with the original transaction
+	original, err := h.cs.db.FindStartedTransaction(ctx, chargePointID, request.ConnectorId, request.IdTag, request.Timestamp.Time, request.MeterStart)
+	if err == nil {
+		logrus.WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"transactionId": original.ID,
+		}).Warn("Duplicate start transaction request, returning the original transaction")
+
+		var idTagInfo *types.IdTagInfo
+		if original.FreeVend {
+			idTagInfo = types.NewIdTagInfo(types.AuthorizationStatusAccepted)
+		} else if original.OfflineAuthorized {
+			idTagInfo = h.cs.authorizeOfflineTransaction(ctx, original)
+		} else {
+			idTagInfo = h.cs.authorizeRequest(ctx, core.StartTransactionFeatureName, chargePointID, request.ConnectorId, request.IdTag)
+		}
+		conf := core.NewStartTransactionConfirmation(idTagInfo, original.ID)
+		h.cs.logger.LogResponse(chargePointID, "StartTransaction", "", conf, "Outbound")
+		return conf, nil
+	}
+	if !errors.Is(err, db.ErrNotFound) {
+		logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to check for a duplicate transaction")
+	}
+
+	h.cs.measureClockDrift(ctx, chargePointID, request.Timestamp.Time)
+
+	// Join the session opened by the remote start or authorization of the idTag
+	sessionID, err := h.cs.db.ClaimPendingSession(ctx, chargePointID, request.IdTag)
+	if err != nil {
+		logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to claim pending session")
+	}
+	if sessionID == "" {
+		sessionID = db.NewSessionID()
+	}
+
+	// Transactions with an adjusted start time are priced on the receive time, so they need a billing review
+	startTime, adjusted := h.cs.normalizeTimestamp(chargePointID, "StartTransaction", request.Timestamp.Time, time.Now())
 	transaction := &models.Transaction{
-		ID:            generateTransactionID(),
-		ChargePointID: chargePointID,
-		ConnectorID:   request.ConnectorId,
-		IdTag:         request.IdTag,
-		StartTime:     request.Timestamp.Time,
-		MeterStart:    request.MeterStart,
-		Status:        "InProgress",
+		SessionID:         sessionID,
+		ChargePointID:     chargePointID,
+		ConnectorID:       request.ConnectorId,
+		IdTag:             request.IdTag,
+		StartTime:         startTime,
+		MeterStart:        request.MeterStart,
+		Status:            "InProgress",
+		FreeVend:          h.cs.freeVend(ctx, chargePointID),
+		TimestampAdjusted: adjusted,
+		BillingReview:     adjusted,
+	}
+	if adjusted {
+		transaction.ReportedStartTime = request.Timestamp.Time
+	}
+
+	var idTagInfo *types.IdTagInfo
+	if transaction.FreeVend {
+		idTagInfo = types.NewIdTagInfo(types.AuthorizationStatusAccepted)
+	} else if h.cs.startedOffline(transaction) {
+		idTagInfo = h.cs.authorizeOfflineTransaction(ctx, transaction)
+	} else {
+		idTagInfo = h.cs.authorizeRequest(ctx, core.StartTransactionFeatureName, chargePointID, request.ConnectorId, request.IdTag)
 	}
 
 	if err := h.cs.db.StartTransaction(ctx, transaction); err != nil {
@@ -302,10 +574,11 @@ func (h *CentralSystemHandler) OnStartTransaction(chargePointID string, request
 			"chargePointID": chargePointID,
 			"connectorId":   request.ConnectorId,
 		}).Error("Failed to save transaction")
+	} else {
+		h.cs.publishTransactionStarted(transaction)
 	}
 
 	// Create response
-	idTagInfo := types.NewIdTagInfo(types.AuthorizationStatusAccepted)
 	conf := core.NewStartTransactionConfirmation(idTagInfo, transaction.ID)
 
 	// Log the response
@@ -328,54 +601,63 @@ func (h *CentralSystemHandler) OnStopTransaction(chargePointID string, request *
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := h.cs.db.StopTransaction(ctx, request.TransactionId, request.Timestamp.Time, request.MeterStop); err != nil {
+	receivedAt := time.Now()
+	endTime, adjusted := h.cs.normalizeTimestamp(chargePointID, "StopTransaction", request.Timestamp.Time, receivedAt)
+	if err := h.cs.db.StopTransaction(ctx, request.TransactionId, endTime, request.MeterStop, string(request.Reason)); err != nil {
 		logrus.WithError(err).WithFields(logrus.Fields{
 			"chargePointID": chargePointID,
 			"transactionId": request.TransactionId,
 		}).Error("Failed to update transaction")
 	}
+	h.cs.measureClockDrift(ctx, chargePointID, request.Timestamp.Time)
 
 	// Process any transaction-specific meter values
 	if request.TransactionData != nil {
+		var batch []*models.MeterValue
 		for _, meterValue := range request.TransactionData {
+			timestamp, timestampAdjusted := h.cs.normalizeTimestamp(chargePointID, "StopTransaction", meterValue.Timestamp.Time, receivedAt)
+			adjusted = adjusted || timestampAdjusted
 			for _, sampledValue := range meterValue.SampledValue {
-				measurand := "Energy.Active.Import.Register"
-				if sampledValue.Measurand != "" {
-					measurand = string(sampledValue.Measurand)
-				}
-
-				unit := "Wh"
-				if sampledValue.Unit != "" {
-					unit = string(sampledValue.Unit)
+				mv, err := meterValueFromSampledValue(sampledValue)
+				if err != nil {
+					h.cs.quarantineSampledValue(chargePointID, "StopTransaction", request, sampledValue, err)
+					continue
 				}
+				mv.TransactionID = request.TransactionId
+				mv.ChargePointID = chargePointID
+				mv.ConnectorID = 0 // We don't have connector ID in stop transaction
+				mv.Timestamp = timestamp
+				mv.TimestampAdjusted = timestampAdjusted
 
-				value := 0.0
-				if v, err := parseFloat64(sampledValue.Value); err == nil {
-					value = v
-				}
-
-				mv := &models.MeterValue{
-					TransactionID: request.TransactionId,
-					ChargePointID: chargePointID,
-					ConnectorID:   0, // We don't have connector ID in stop transaction
-					Timestamp:     meterValue.Timestamp.Time,
-					Value:         value,
-					Unit:          unit,
-					Measurand:     measurand,
-				}
-
-				if err := h.cs.db.SaveMeterValue(ctx, mv); err != nil {
-					logrus.WithError(err).WithFields(logrus.Fields{
-						"chargePointID": chargePointID,
-						"transactionId": request.TransactionId,
-					}).Error("Failed to save transaction meter value")
-				}
+				batch = append(batch, mv)
 			}
 		}
+
+		if err := h.cs.db.SaveMeterValues(ctx, batch); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"chargePointID": chargePointID,
+				"transactionId": request.TransactionId,
+				"samples":       len(batch),
+			}).Error("Failed to save transaction meter values")
+		}
+		h.cs.recordSoC(ctx, chargePointID, request.TransactionId, batch)
 	}
+	h.cs.endLiveTransaction(chargePointID, request.TransactionId)
+	h.cs.limitChecks.Delete(request.TransactionId)
+	if adjusted {
+		h.cs.flagAdjustedTimestamp(ctx, chargePointID, request.TransactionId)
+	}
+	h.cs.publishTransactionStopped(ctx, chargePointID, request.TransactionId)
 
-	// Create response
+	// Create response, checking the idTag the transaction was stopped with against the one that started it
 	conf := core.NewStopTransactionConfirmation()
+	if request.IdTag != "" {
+		if tx, err := h.cs.db.GetTransaction(ctx, request.TransactionId); err == nil {
+			conf.IdTagInfo = h.cs.authorizeStop(ctx, chargePointID, request.IdTag, tx)
+		} else {
+			conf.IdTagInfo = h.cs.authorizeIdTag(ctx, chargePointID, request.IdTag)
+		}
+	}
 
 	// Log the response
 	h.cs.logger.LogResponse(chargePointID, "StopTransaction", "", conf, "Outbound")
@@ -393,11 +675,20 @@ func (h *CentralSystemHandler) OnAuthorize(chargePointID string, request *core.A
 	// Log the request
 	h.cs.logger.LogRequest(chargePointID, "Authorize", "", request, "Inbound")
 
-	// In a real system, we would check if the ID tag is authorized
-	// For simplicity, we accept all authorize requests
-	idTagInfo := types.NewIdTagInfo(types.AuthorizationStatusAccepted)
+	// Check the ID tag against the tenant owning the charge point
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	idTagInfo := h.cs.authorizeRequest(ctx, core.AuthorizeFeatureName, chargePointID, 0, request.IdTag)
 	conf := core.NewAuthorizationConfirmation(idTagInfo)
 
+	// Open the session the following StartTransaction joins
+	if idTagInfo.Status == types.AuthorizationStatusAccepted {
+		if _, err := h.cs.db.OpenPendingSession(ctx, chargePointID, request.IdTag, db.NewSessionID(), false); err != nil {
+			logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to open pending session")
+		}
+	}
+
 	// Log the response
 	h.cs.logger.LogResponse(chargePointID, "Authorize", "", conf, "Outbound")
 
@@ -406,6 +697,10 @@ func (h *CentralSystemHandler) OnAuthorize(chargePointID string, request *core.A
 
 // OnDataTransfer handles DataTransfer requests
 func (h *CentralSystemHandler) OnDataTransfer(chargePointID string, request *core.DataTransferRequest) (confirmation *core.DataTransferConfirmation, err error) {
+	if !h.cs.allowMessage(chargePointID, "DataTransfer") {
+		return core.NewDataTransferConfirmation(core.DataTransferStatusAccepted), nil
+	}
+
 	logrus.WithFields(logrus.Fields{
 		"chargePointID": chargePointID,
 		"vendorId":      request.VendorId,
@@ -415,6 +710,18 @@ func (h *CentralSystemHandler) OnDataTransfer(chargePointID string, request *cor
 	// Log the request
 	h.cs.logger.LogRequest(chargePointID, "DataTransfer", "", request, "Inbound")
 
+	if request.VendorId == pncVendorID {
+		conf := h.cs.handlePnCDataTransfer(chargePointID, request)
+		h.cs.logger.LogResponse(chargePointID, "DataTransfer", "", conf, "Outbound")
+		return conf, nil
+	}
+
+	if vehicle, ok := vehicleFromDataTransfer(request); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		h.cs.recordVehicle(ctx, chargePointID, vehicle)
+		cancel()
+	}
+
 	// For simplicity, we accept all data transfer requests
 	conf := core.NewDataTransferConfirmation(core.DataTransferStatusAccepted)
 
@@ -453,6 +760,12 @@ func (h *CentralSystemHandler) OnFirmwareStatusNotification(chargePointID string
 	// Log the request
 	h.cs.logger.LogRequest(chargePointID, "FirmwareStatusNotification", "", request, "Inbound")
 
+	// Track the progress of the active firmware update
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	h.cs.handleFirmwareStatus(ctx, chargePointID, request.Status)
+
 	// Create response
 	conf := firmware.NewFirmwareStatusNotificationConfirmation()
 
@@ -461,19 +774,3 @@ func (h *CentralSystemHandler) OnFirmwareStatusNotification(chargePointID string
 
 	return conf, nil
 }
-
-// Helper function to generate a unique transaction ID
-// In a production system, you would use a more robust method
-var lastTransactionID = 1000
-
-func generateTransactionID() int {
-	lastTransactionID++
-	return lastTransactionID
-}
-
-// Helper function to parse a string to float64
-func parseFloat64(s string) (float64, error) {
-	var f float64
-	_, err := fmt.Sscanf(s, "%f", &f)
-	return f, err
-}
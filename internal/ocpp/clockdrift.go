@@ -0,0 +1,76 @@
+package ocpp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/sirupsen/logrus"
+)
+
+// clockDriftWindow is the period over which clock drift samples are combined into one measurement
+const clockDriftWindow = 10 * time.Minute
+
+// clockDrift is the clock drift measurement of a charge point in the current window
+type clockDrift struct {
+	mu      sync.Mutex
+	start   time.Time     // Start of the window
+	drift   time.Duration // Largest sample of the window
+	flagged bool          // The last measurement exceeded the threshold
+}
+
+// clockDriftEvent is the data of a chargepoint.clock_drift event
+type clockDriftEvent struct {
+	DriftMs     int64 `json:"driftMs"`
+	ThresholdMs int64 `json:"thresholdMs"`
+}
+
+// measureClockDrift takes a sample of a charge point's clock drift from the timestamp of a message it just sent.
+// Heartbeat requests carry no timestamp, so the samples come from transaction, meter value and status messages.
+// Messages queued while offline arrive late and make the charger clock seem behind, so the drift of a window is its
+// largest sample, the one least delayed in transit. Measurements over the threshold flag the charge point.
+func (cs *CentralSystem) measureClockDrift(ctx context.Context, chargePointID string, reported time.Time) {
+	if cs.replaying || cs.config.ClockDriftThreshold <= 0 || reported.IsZero() {
+		return
+	}
+
+	now := time.Now()
+	sample := reported.Sub(now)
+
+	value, _ := cs.clockDrifts.LoadOrStore(chargePointID, &clockDrift{})
+	cd := value.(*clockDrift)
+
+	cd.mu.Lock()
+	if now.Sub(cd.start) > clockDriftWindow {
+		cd.start = now
+		cd.drift = sample
+	} else if sample > cd.drift {
+		cd.drift = sample
+	} else {
+		cd.mu.Unlock()
+		return
+	}
+	drift := cd.drift
+	threshold := time.Duration(cs.config.ClockDriftThreshold) * time.Second
+	flagged := drift > threshold || drift < -threshold
+	newlyFlagged := flagged && !cd.flagged
+	cd.flagged = flagged
+	cd.mu.Unlock()
+
+	if err := cs.db.UpdateClockDrift(ctx, chargePointID, drift, flagged); err != nil {
+		logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to record clock drift")
+	}
+
+	if newlyFlagged {
+		logrus.WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"drift":         drift.Round(time.Second),
+			"threshold":     threshold,
+		}).Warn("Charge point clock drift exceeds the threshold")
+		cs.events.Publish(events.ChargePointClockDrift, chargePointID, clockDriftEvent{
+			DriftMs:     drift.Milliseconds(),
+			ThresholdMs: threshold.Milliseconds(),
+		})
+	}
+}
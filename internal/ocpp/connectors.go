@@ -0,0 +1,65 @@
+package ocpp
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// discoverConnectorsDelay is how long after a boot notification the connectors of a charge point are discovered,
+	// giving it time to process the boot notification response
+	discoverConnectorsDelay = 2 * time.Second
+	// numberOfConnectorsKey is the configuration key reporting the number of connectors of a charge point
+	numberOfConnectorsKey = "NumberOfConnectors"
+)
+
+// discoverConnectors asks a booted charge point for its number of connectors and creates the connectors that
+// have not reported a status yet with status Unknown, so all of them are listed before their first status notification
+func (cs *CentralSystem) discoverConnectors(chargePointID string) {
+	time.Sleep(discoverConnectorsDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	log := logrus.WithField("chargePointID", chargePointID)
+
+	response, err := cs.SendRequest(ctx, chargePointID, core.NewGetConfigurationRequest([]string{numberOfConnectorsKey}))
+	if err != nil {
+		log.WithError(err).Warn("Failed to get the number of connectors")
+		return
+	}
+	conf, ok := response.(*core.GetConfigurationConfirmation)
+	if !ok {
+		return
+	}
+
+	count := 0
+	for _, key := range conf.ConfigurationKey {
+		if key.Key == numberOfConnectorsKey && key.Value != nil {
+			count, err = strconv.Atoi(*key.Value)
+			if err != nil {
+				log.WithField("value", *key.Value).Warn("Invalid number of connectors")
+				return
+			}
+		}
+	}
+	if count <= 0 {
+		return
+	}
+
+	created, err := cs.db.CreateMissingConnectors(ctx, chargePointID, count)
+	if err != nil {
+		log.WithError(err).Error("Failed to create discovered connectors")
+		return
+	}
+	if created > 0 {
+		log.WithFields(logrus.Fields{
+			"connectors": count,
+			"created":    created,
+		}).Info("Created discovered connectors")
+	}
+}
@@ -0,0 +1,49 @@
+package ocpp
+
+import (
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/siem"
+	"github.com/sirupsen/logrus"
+)
+
+// admitConnection reports whether a charge point may connect within the connection limits: the rate of
+// connection attempts from its client address, and the number of charge points connected to this instance.
+// Reconnects of connected charge points don't count against the connection limit.
+func (cs *CentralSystem) admitConnection(chargePointID, remoteAddr string) bool {
+	fields := logrus.Fields{
+		"chargePointID": chargePointID,
+		"remoteAddr":    remoteAddr,
+	}
+
+	if ok, retryAfter := cs.connectLimiter.Allow(remoteAddr); !ok {
+		logrus.WithFields(fields).WithField("retryAfter", retryAfter.Round(time.Millisecond)).Warn("Rejected charge point connection, too many attempts from its address")
+		cs.siem.Security("connection.rejected", siem.SeverityMedium, chargePointID, "Too many connection attempts from the client address", map[string]string{
+			"remoteAddr": remoteAddr,
+		})
+		return false
+	}
+
+	limit := int(cs.maxConnections.Load())
+	if limit <= 0 {
+		return true
+	}
+	if _, connected := cs.connections.Load(chargePointID); connected {
+		return true
+	}
+	if count := cs.connectionCount(); count >= limit {
+		logrus.WithFields(fields).WithField("connections", count).Warn("Rejected charge point connection, connection limit reached")
+		cs.siem.Security("connection.rejected", siem.SeverityMedium, chargePointID, "Connection limit reached", map[string]string{
+			"remoteAddr": remoteAddr,
+		})
+		return false
+	}
+	return true
+}
+
+// SetConnectionLimits changes the limit of concurrent charge point connections and the rate limit
+// of connection attempts per client address, 0 disables either limit
+func (cs *CentralSystem) SetConnectionLimits(maxConnections int, rate float64, burst int) {
+	cs.maxConnections.Store(int64(maxConnections))
+	cs.connectLimiter.SetLimit(rate, burst)
+}
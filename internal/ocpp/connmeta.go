@@ -0,0 +1,108 @@
+package ocpp
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/sirupsen/logrus"
+)
+
+// connectionHeaders are the handshake headers recorded with every connection, besides the configured ones
+var connectionHeaders = []string{"User-Agent", "X-Forwarded-For", "X-Real-IP", "Forwarded", "Via"}
+
+// secretHeaders are never recorded, even when configured
+var secretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+}
+
+// connectionMetadata returns the metadata of a connection from its websocket handshake:
+// the client address, the subprotocol the websocket server negotiates and the recorded headers
+func (cs *CentralSystem) connectionMetadata(r *http.Request, chargePointID, remoteAddr string) *models.ConnectionEvent {
+	event := &models.ConnectionEvent{
+		ChargePointID: chargePointID,
+		RemoteAddr:    remoteAddr,
+		Subprotocol:   cs.negotiateSubprotocol(r),
+		Headers:       make(map[string]string),
+	}
+
+	names := append(append([]string{}, connectionHeaders...), cs.config.OCPPConnectionHeaders...)
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(name)
+		if secretHeaders[name] {
+			continue
+		}
+		if value := r.Header.Get(name); value != "" {
+			event.Headers[name] = value
+		}
+	}
+	return event
+}
+
+// connectivityEvent is the data of the chargepoint.connected and chargepoint.disconnected events
+type connectivityEvent struct {
+	RemoteAddr       string    `json:"remoteAddr,omitempty"`
+	Subprotocol      string    `json:"subprotocol,omitempty"`
+	ConnectedAt      time.Time `json:"connectedAt"`
+	DisconnectedAt   time.Time `json:"disconnectedAt,omitempty"`
+	OfflineSeconds   int64     `json:"offlineSeconds,omitempty"`   // Since the previous disconnection, of connected events
+	ConnectedSeconds int64     `json:"connectedSeconds,omitempty"` // Length of the connection, of disconnected events
+}
+
+// lastConnection returns the latest recorded connection of a charge point, nil if it has none
+func (cs *CentralSystem) lastConnection(ctx context.Context, chargePointID string) *models.ConnectionEvent {
+	connections, err := cs.db.GetConnectionEvents(ctx, chargePointID, 1)
+	if err != nil {
+		logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to get the last charge point connection")
+		return nil
+	}
+	if len(connections) == 0 {
+		return nil
+	}
+	return connections[0]
+}
+
+// recordConnection records a new connection of a charge point with the metadata of its websocket handshake
+// and publishes a chargepoint.connected event with how long the charge point was offline
+func (cs *CentralSystem) recordConnection(ctx context.Context, event *models.ConnectionEvent) {
+	previous := cs.lastConnection(ctx, event.ChargePointID)
+
+	event.ConnectedAt = time.Now()
+	if err := cs.db.CreateConnectionEvent(ctx, event); err != nil {
+		logrus.WithError(err).WithField("chargePointID", event.ChargePointID).Error("Failed to record charge point connection")
+	}
+
+	data := connectivityEvent{
+		RemoteAddr:  event.RemoteAddr,
+		Subprotocol: event.Subprotocol,
+		ConnectedAt: event.ConnectedAt,
+	}
+	if previous != nil && !previous.DisconnectedAt.IsZero() {
+		data.OfflineSeconds = int64(event.ConnectedAt.Sub(previous.DisconnectedAt).Seconds())
+	}
+	cs.events.Publish(events.ChargePointConnected, event.ChargePointID, data)
+}
+
+// recordDisconnection records the end of a charge point's connection
+// and publishes a chargepoint.disconnected event with how long it was connected
+func (cs *CentralSystem) recordDisconnection(ctx context.Context, chargePointID string) {
+	connection := cs.lastConnection(ctx, chargePointID)
+
+	disconnectedAt := time.Now()
+	if err := cs.db.CloseConnectionEvent(ctx, chargePointID, disconnectedAt); err != nil {
+		logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to record charge point disconnection")
+	}
+
+	data := connectivityEvent{DisconnectedAt: disconnectedAt}
+	if connection != nil && connection.DisconnectedAt.IsZero() {
+		data.RemoteAddr = connection.RemoteAddr
+		data.Subprotocol = connection.Subprotocol
+		data.ConnectedAt = connection.ConnectedAt
+		data.ConnectedSeconds = int64(disconnectedAt.Sub(connection.ConnectedAt).Seconds())
+	}
+	cs.events.Publish(events.ChargePointDisconnected, chargePointID, data)
+}
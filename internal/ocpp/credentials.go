@@ -0,0 +1,71 @@
+package ocpp
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/siem"
+	"github.com/sirupsen/logrus"
+)
+
+// AuthorizationKey is the configuration key of the basic auth password of a charge point
+const AuthorizationKey = "AuthorizationKey"
+
+// RedactCredentials masks the credentials in an OCPP payload, such as the value of an AuthorizationKey
+func RedactCredentials(payload []byte) []byte {
+	return redactFrame(payload)
+}
+
+// credentialsValid reports whether a charge point presents its basic auth password. Charge points without a password
+// connect without one. While a rotation is open the current and the new password are both accepted, and the first
+// connection with the new password completes the rotation, which invalidates the old one.
+func (cs *CentralSystem) credentialsValid(ctx context.Context, r *http.Request, chargePointID, remoteAddr string) bool {
+	fields := logrus.Fields{
+		"chargePointID": chargePointID,
+		"remoteAddr":    remoteAddr,
+	}
+
+	current, err := cs.db.GetChargePointPasswordHash(ctx, chargePointID)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		logrus.WithError(err).WithFields(fields).Error("Rejected charge point connection, failed to get its password")
+		return false
+	}
+	rotation, err := cs.db.GetOpenCredentialRotation(ctx, chargePointID)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		logrus.WithError(err).WithFields(fields).Error("Rejected charge point connection, failed to get its credential rotation")
+		return false
+	}
+
+	username, password, presented := r.BasicAuth()
+	presented = presented && username == chargePointID
+	hash := db.HashPassword(password)
+
+	if presented && rotation != nil && hashesEqual(hash, rotation.PasswordHash) {
+		completed, err := cs.db.CompleteCredentialRotation(ctx, rotation.ID)
+		if err != nil {
+			logrus.WithError(err).WithFields(fields).Error("Rejected charge point connection, failed to complete its credential rotation")
+			return false
+		}
+		if completed {
+			logrus.WithFields(fields).WithField("rotationID", rotation.ID).Info("Charge point connected with its new password, credential rotation completed")
+		}
+		return true
+	}
+
+	if current == "" || (presented && hashesEqual(hash, current)) {
+		return true
+	}
+
+	logrus.WithFields(fields).Warn("Rejected charge point connection, invalid credentials")
+	cs.siem.Security("connection.rejected", siem.SeverityHigh, chargePointID, "Invalid charge point credentials", map[string]string{
+		"remoteAddr": remoteAddr,
+	})
+	return false
+}
+
+func hashesEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
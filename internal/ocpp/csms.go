@@ -0,0 +1,164 @@
+package ocpp
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/availability"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/provisioning"
+	types201 "github.com/lorenzodonini/ocpp-go/ocpp2.0.1/types"
+	"github.com/sirupsen/logrus"
+)
+
+// CSMSHandler implements the OCPP 2.0.1 handlers of charging stations connecting with the ocpp2.0.1 subprotocol.
+// It handles registration, heartbeats and connector statuses; other requests, Authorize and TransactionEvent
+// included, are answered with a NotSupported error.
+type CSMSHandler struct {
+	cs *CentralSystem
+}
+
+// OnBootNotification handles OCPP 2.0.1 BootNotification requests
+func (h *CSMSHandler) OnBootNotification(chargingStationID string, request *provisioning.BootNotificationRequest) (response *provisioning.BootNotificationResponse, err error) {
+	logrus.WithFields(logrus.Fields{
+		"chargePointID": chargingStationID,
+		"vendor":        request.ChargingStation.VendorName,
+		"model":         request.ChargingStation.Model,
+		"reason":        request.Reason,
+	}).Info("Boot notification received")
+
+	h.cs.logger.LogRequest(chargingStationID, "BootNotification", "", request, "Inbound")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Boots are tracked like OCPP 1.6 ones, so a reboot-looping station is detected and slowed down as well
+	boot := h.cs.trackBoot(ctx, chargingStationID, &core.BootNotificationRequest{
+		ChargePointVendor:       request.ChargingStation.VendorName,
+		ChargePointModel:        request.ChargingStation.Model,
+		ChargePointSerialNumber: request.ChargingStation.SerialNumber,
+		FirmwareVersion:         request.ChargingStation.FirmwareVersion,
+	}, time.Now())
+	if boot.looping && boot.duplicate {
+		logrus.WithFields(logrus.Fields{
+			"chargePointID": chargingStationID,
+			"boots":         boot.boots,
+		}).Debug("Skipping the repeated boot of a reboot-looping charge point")
+	} else {
+		chargePoint := &models.ChargePoint{
+			ID:                 chargingStationID,
+			Vendor:             request.ChargingStation.VendorName,
+			Model:              request.ChargingStation.Model,
+			SerialNumber:       request.ChargingStation.SerialNumber,
+			FirmwareVersion:    request.ChargingStation.FirmwareVersion,
+			LastHeartbeat:      time.Now(),
+			RegistrationStatus: string(provisioning.RegistrationStatusAccepted),
+			IsConnected:        true,
+			ConnectedSince:     time.Now(),
+		}
+		if err := h.cs.db.SaveChargePoint(ctx, chargePoint); err != nil {
+			logrus.WithError(err).WithField("chargePointID", chargingStationID).Error("Failed to save charge point")
+		}
+	}
+
+	response = provisioning.NewBootNotificationResponse(
+		types201.NewDateTime(time.Now()),
+		h.cs.bootInterval(boot),
+		provisioning.RegistrationStatusAccepted,
+	)
+
+	h.cs.logger.LogResponse(chargingStationID, "BootNotification", "", response, "Outbound")
+
+	return response, nil
+}
+
+// OnNotifyReport acknowledges OCPP 2.0.1 NotifyReport requests, the reported variables are only logged
+func (h *CSMSHandler) OnNotifyReport(chargingStationID string, request *provisioning.NotifyReportRequest) (response *provisioning.NotifyReportResponse, err error) {
+	h.cs.logger.LogRequest(chargingStationID, "NotifyReport", "", request, "Inbound")
+
+	response = provisioning.NewNotifyReportResponse()
+
+	h.cs.logger.LogResponse(chargingStationID, "NotifyReport", "", response, "Outbound")
+
+	return response, nil
+}
+
+// OnHeartbeat handles OCPP 2.0.1 Heartbeat requests
+func (h *CSMSHandler) OnHeartbeat(chargingStationID string, request *availability.HeartbeatRequest) (response *availability.HeartbeatResponse, err error) {
+	if !h.cs.allowMessage(chargingStationID, "Heartbeat") {
+		return availability.NewHeartbeatResponse(*types201.NewDateTime(time.Now())), nil
+	}
+
+	logrus.WithField("chargePointID", chargingStationID).Debug("Heartbeat received")
+
+	h.cs.logger.LogRequest(chargingStationID, "Heartbeat", "", request, "Inbound")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := h.cs.db.UpdateHeartbeat(ctx, chargingStationID); err != nil {
+		logrus.WithError(err).WithField("chargePointID", chargingStationID).Error("Failed to update heartbeat")
+	}
+
+	response = availability.NewHeartbeatResponse(*types201.NewDateTime(time.Now()))
+
+	h.cs.logger.LogResponse(chargingStationID, "Heartbeat", "", response, "Outbound")
+
+	return response, nil
+}
+
+// chargePointStatus maps an OCPP 2.0.1 connector status to the OCPP 1.6 status connectors are recorded with.
+// Without transaction events the CSMS cannot tell whether an occupied connector is charging, so it is recorded as
+// Preparing, which still counts as plugged in.
+func chargePointStatus(status availability.ConnectorStatus) core.ChargePointStatus {
+	switch status {
+	case availability.ConnectorStatusAvailable:
+		return core.ChargePointStatusAvailable
+	case availability.ConnectorStatusOccupied:
+		return core.ChargePointStatusPreparing
+	case availability.ConnectorStatusReserved:
+		return core.ChargePointStatusReserved
+	case availability.ConnectorStatusFaulted:
+		return core.ChargePointStatusFaulted
+	default:
+		return core.ChargePointStatusUnavailable
+	}
+}
+
+// OnStatusNotification handles OCPP 2.0.1 StatusNotification requests. Connectors are recorded per EVSE,
+// as charging stations with one connector per EVSE number them, with the status mapped to OCPP 1.6.
+func (h *CSMSHandler) OnStatusNotification(chargingStationID string, request *availability.StatusNotificationRequest) (response *availability.StatusNotificationResponse, err error) {
+	if !h.cs.allowMessage(chargingStationID, "StatusNotification") {
+		return availability.NewStatusNotificationResponse(), nil
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"chargePointID": chargingStationID,
+		"evseId":        request.EvseID,
+		"connectorId":   request.ConnectorID,
+		"status":        request.ConnectorStatus,
+	}).Info("Status notification received")
+
+	h.cs.logger.LogRequest(chargingStationID, "StatusNotification", "", request, "Inbound")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	status := &core.StatusNotificationRequest{
+		ConnectorId: request.EvseID,
+		ErrorCode:   core.NoError,
+		Status:      chargePointStatus(request.ConnectorStatus),
+	}
+	if request.Timestamp != nil {
+		status.Timestamp = types.NewDateTime(request.Timestamp.Time)
+	}
+	h.cs.handleStatus(ctx, chargingStationID, status)
+
+	response = availability.NewStatusNotificationResponse()
+
+	h.cs.logger.LogResponse(chargingStationID, "StatusNotification", "", response, "Outbound")
+
+	return response, nil
+}
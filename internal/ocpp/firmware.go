@@ -0,0 +1,57 @@
+package ocpp
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/firmware"
+	"github.com/sirupsen/logrus"
+)
+
+// handleFirmwareStatus updates the active firmware update of a charge point
+// and schedules a retry when the download or installation failed
+func (cs *CentralSystem) handleFirmwareStatus(ctx context.Context, chargePointID string, status firmware.FirmwareStatus) {
+	fu, err := cs.db.GetActiveFirmwareUpdate(ctx, chargePointID)
+	if err != nil {
+		// Firmware updates not started through the CPMS are not tracked
+		logrus.WithField("chargePointID", chargePointID).Debug("No active firmware update found")
+		return
+	}
+
+	failed := false
+	switch status {
+	case firmware.FirmwareStatusDownloadFailed, firmware.FirmwareStatusInstallationFailed:
+		backoff := time.Duration(cs.config.FirmwareRetryBackoff) * time.Second
+		if fu.ScheduleRetry(string(status), backoff) {
+			logrus.WithFields(logrus.Fields{
+				"chargePointID":    chargePointID,
+				"firmwareUpdateID": fu.ID,
+				"attempts":         fu.Attempts,
+				"nextRetryAt":      fu.NextRetryAt,
+			}).Warn("Firmware update failed, retry scheduled")
+		} else {
+			logrus.WithFields(logrus.Fields{
+				"chargePointID":    chargePointID,
+				"firmwareUpdateID": fu.ID,
+				"attempts":         fu.Attempts,
+				"lastError":        fu.LastError,
+			}).Error("Firmware update failed after final attempt")
+			failed = true
+		}
+	case firmware.FirmwareStatusIdle:
+		// Idle carries no information about the update progress
+		return
+	default:
+		fu.Status = string(status)
+	}
+
+	if err := cs.db.UpdateFirmwareUpdate(ctx, fu); err != nil {
+		logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to update firmware update status")
+	}
+
+	// Subscribers reading the update back find it Failed
+	if failed {
+		cs.events.Publish(events.FirmwareUpdateFailed, chargePointID, fu)
+	}
+}
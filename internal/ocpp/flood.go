@@ -0,0 +1,60 @@
+package ocpp
+
+import (
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// floodEvent is the data of a charge point flooding event
+type floodEvent struct {
+	Action    string  `json:"action"`
+	RateLimit float64 `json:"rateLimit"`
+	Burst     int     `json:"burst"`
+}
+
+// allowMessage takes an inbound message of a charge point from its message rate limit.
+// Messages over the limit are still confirmed but not persisted. The first message over the limit
+// logs a warning, publishes a flooding event and disconnects the charge point if configured.
+func (cs *CentralSystem) allowMessage(chargePointID, action string) bool {
+	rate, burst := cs.messageLimiter.Limit()
+	if rate <= 0 {
+		return true
+	}
+
+	if ok, _ := cs.messageLimiter.Allow(chargePointID); ok {
+		if _, throttled := cs.throttled.LoadAndDelete(chargePointID); throttled {
+			logrus.WithField("chargePointID", chargePointID).Info("Charge point message rate is back within the limit")
+		}
+		return true
+	}
+
+	if _, throttled := cs.throttled.LoadOrStore(chargePointID, struct{}{}); throttled {
+		return false
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"chargePointID": chargePointID,
+		"action":        action,
+		"rateLimit":     rate,
+		"burst":         burst,
+	}).Warn("Charge point exceeded its message rate limit, messages are not persisted")
+
+	cs.events.Publish(events.ChargePointFlooding, chargePointID, floodEvent{
+		Action:    action,
+		RateLimit: rate,
+		Burst:     burst,
+	})
+
+	if cs.config.OCPPFloodDisconnect {
+		// StopConnection blocks until the connection's write loop picks up the close
+		go func() {
+			closeError := websocket.CloseError{Code: websocket.ClosePolicyViolation, Text: "message rate limit exceeded"}
+			if err := cs.wsServer.StopConnection(chargePointID, closeError); err != nil {
+				logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to disconnect flooding charge point")
+			}
+		}()
+	}
+
+	return false
+}
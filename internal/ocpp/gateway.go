@@ -0,0 +1,623 @@
+package ocpp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/gorilla/websocket"
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+	"github.com/sirupsen/logrus"
+)
+
+// upstreamDialTimeout bounds connecting to an upstream central system, which is done in the charge point's handshake,
+// and writing a frame to it
+const upstreamDialTimeout = 5 * time.Second
+
+// upstreamTimeout is how long the upstream's response to a forwarded request is waited for before the charge point
+// is sent the CPMS's own response instead
+const upstreamTimeout = 10 * time.Second
+
+// frame is the envelope of an OCPP-J message
+type frame struct {
+	messageType ocppj.MessageType
+	messageID   string
+	action      string          // Of calls
+	payload     json.RawMessage // Of calls and call results
+	errorCode   string          // Of call errors
+	errorDesc   string          // Of call errors
+}
+
+// parseFrame parses the envelope of an OCPP-J message, reporting false for malformed frames
+func parseFrame(data []byte) (*frame, bool) {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(data, &elements); err != nil || len(elements) < 3 {
+		return nil, false
+	}
+
+	f := &frame{}
+	if json.Unmarshal(elements[0], &f.messageType) != nil || json.Unmarshal(elements[1], &f.messageID) != nil {
+		return nil, false
+	}
+	switch f.messageType {
+	case ocppj.CALL:
+		if len(elements) < 4 || json.Unmarshal(elements[2], &f.action) != nil {
+			return nil, false
+		}
+		f.payload = elements[3]
+	case ocppj.CALL_RESULT:
+		f.payload = elements[2]
+	case ocppj.CALL_ERROR:
+		_ = json.Unmarshal(elements[2], &f.errorCode)
+		if len(elements) > 3 {
+			_ = json.Unmarshal(elements[3], &f.errorDesc)
+		}
+	default:
+		return nil, false
+	}
+	return f, true
+}
+
+// logPayload is the payload of a frame as logged, the error code and description of call errors
+func (f *frame) logPayload() interface{} {
+	if f.messageType == ocppj.CALL_ERROR {
+		return map[string]string{
+			"errorCode":        f.errorCode,
+			"errorDescription": f.errorDesc,
+		}
+	}
+	return f.payload
+}
+
+// logType is the message type of a frame as logged
+func (f *frame) logType() string {
+	switch f.messageType {
+	case ocppj.CALL:
+		return "Request"
+	case ocppj.CALL_ERROR:
+		return "Error"
+	default:
+		return "Response"
+	}
+}
+
+// callError builds an OCPP-J call error answering a request
+func callError(messageID string, code ocpp.ErrorCode, description string) []byte {
+	data, _ := json.Marshal([]interface{}{ocppj.CALL_ERROR, messageID, code, description, struct{}{}})
+	return data
+}
+
+// transactionIDs maps the transaction IDs an upstream central system assigned to a gateway charge point's transactions
+// to the IDs the CPMS mirrors them under. The mapping is stored with the transactions, as they outlive connections and
+// may continue on another instance.
+type transactionIDs struct {
+	chargePointID string
+	db            db.Store
+}
+
+// record stores the transaction ID in the upstream's StartTransaction response with the transaction the CPMS started.
+// Passing the CPMS's response as both records a transaction the charge point knows by the CPMS's ID.
+func (t *transactionIDs) record(upstream, local *frame) {
+	if upstream.messageType != ocppj.CALL_RESULT || local.messageType != ocppj.CALL_RESULT {
+		return
+	}
+	var upstreamConf, localConf struct {
+		TransactionID int `json:"transactionId"`
+	}
+	if json.Unmarshal(upstream.payload, &upstreamConf) != nil || json.Unmarshal(local.payload, &localConf) != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := t.db.SetUpstreamTransactionID(ctx, localConf.TransactionID, upstreamConf.TransactionID); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"chargePointID":         t.chargePointID,
+			"transactionID":         localConf.TransactionID,
+			"upstreamTransactionID": upstreamConf.TransactionID,
+		}).Error("Failed to record upstream transaction ID")
+	}
+}
+
+// toLocal rewrites the upstream transaction ID of a charge point's request, such as StopTransaction or MeterValues,
+// to the CPMS's ID. It reports false for a transaction ID the mapping doesn't know, which the CPMS must not handle
+// as one of its own IDs.
+func (t *transactionIDs) toLocal(f *frame, data []byte) ([]byte, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return rewriteTransactionID(f, data, func(upstreamID int) (int, bool) {
+		id, err := t.db.GetTransactionIDByUpstreamID(ctx, t.chargePointID, upstreamID)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			logrus.WithError(err).WithField("chargePointID", t.chargePointID).Error("Failed to get transaction by upstream ID")
+		}
+		return id, err == nil
+	})
+}
+
+// toUpstream rewrites the CPMS transaction ID of a request sent to the charge point, such as RemoteStopTransaction,
+// to the upstream's ID the charge point knows the transaction by
+func (t *transactionIDs) toUpstream(f *frame, data []byte) []byte {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rewritten, _ := rewriteTransactionID(f, data, func(id int) (int, bool) {
+		upstreamID, err := t.db.GetUpstreamTransactionID(ctx, id)
+		return upstreamID, err == nil
+	})
+	return rewritten
+}
+
+// rewriteTransactionID replaces the transactionId of an OCPP 1.6 call with the ID lookup maps it to. Frames without
+// an integer transactionId are returned unchanged; those with one lookup doesn't map are returned unchanged with false.
+func rewriteTransactionID(f *frame, data []byte, lookup func(int) (int, bool)) ([]byte, bool) {
+	var payload map[string]json.RawMessage
+	if json.Unmarshal(f.payload, &payload) != nil {
+		return data, true
+	}
+	var id int
+	if raw, ok := payload["transactionId"]; !ok || json.Unmarshal(raw, &id) != nil {
+		return data, true
+	}
+	mapped, ok := lookup(id)
+	if !ok {
+		return data, false
+	}
+	if mapped == id {
+		return data, true
+	}
+
+	payload["transactionId"], _ = json.Marshal(mapped)
+	rewritten, err := json.Marshal([]interface{}{f.messageType, f.messageID, f.action, payload})
+	if err != nil {
+		return data, true
+	}
+	return rewritten, true
+}
+
+// forwardedCall is a request of the charge point forwarded to the upstream central system. The charge point is sent
+// the upstream's response; the CPMS's own response is held back and only sent if the upstream doesn't answer in time.
+type forwardedCall struct {
+	action      string
+	timer       *time.Timer
+	local       *frame // The CPMS's response, nil until the CPMS answered
+	localRaw    []byte
+	upstream    *frame // The upstream's response, nil until the upstream answered
+	upstreamRaw []byte
+	noLocal     bool // The CPMS doesn't handle the request, as its transaction ID is unknown
+	timedOut    bool // The upstream didn't answer in time
+	sent        bool // The charge point was sent a response
+}
+
+// upstreamLink is the connection of a charge point's upstream gateway to the upstream central system. Requests of
+// the charge point are handled by the CPMS as well as forwarded, so the CPMS mirrors the charge point's state, and
+// requests of the upstream are passed on to the charge point with their responses routed back to the upstream.
+type upstreamLink struct {
+	chargePointID string
+	url           string          // Redacted
+	actions       map[string]bool // Requests of the charge point to forward, nil forwards all
+	conn          *websocket.Conn
+	frames        *tapServer
+	logger        *OCPPLogger
+	transactions  *transactionIDs
+
+	writeMu sync.Mutex // Serializes writes to the upstream connection
+
+	mu            sync.Mutex
+	closed        bool
+	forwarded     map[string]*forwardedCall // Message ID -> request forwarded upstream
+	upstreamCalls map[string]string         // Message ID -> action of the upstream's requests awaiting the charge point's response
+}
+
+// acceptConnection checks the websocket handshake of a charge point and, if the charge point has an upstream
+// gateway, connects it to the upstream central system before accepting the connection, so no frame misses it
+func (cs *CentralSystem) acceptConnection(r *http.Request) bool {
+	if !cs.checkConnection(r) {
+		return false
+	}
+	cs.openUpstream(path.Base(r.URL.Path))
+	return true
+}
+
+// openUpstream connects a charge point's upstream gateway for its new connection. The charge point is handled by
+// the CPMS alone if the upstream central system can't be reached.
+func (cs *CentralSystem) openUpstream(chargePointID string) {
+	if _, connected := cs.frames.upstreams.Load(chargePointID); connected {
+		// The websocket server rejects a second connection of a charge point
+		return
+	}
+	subprotocol := cs.pendingSubprotocol(chargePointID)
+	if subprotocol == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), upstreamDialTimeout)
+	defer cancel()
+
+	gateway, err := cs.db.GetUpstreamGateway(ctx, chargePointID)
+	if errors.Is(err, db.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to get upstream gateway")
+		return
+	}
+
+	link, err := cs.dialUpstream(ctx, gateway, subprotocol)
+	if err != nil {
+		logrus.WithError(err).WithField("chargePointID", chargePointID).Warn("Failed to connect to the upstream central system, handling the charge point locally")
+		return
+	}
+	if previous, loaded := cs.pendingLinks.Swap(chargePointID, link); loaded {
+		previous.(*upstreamLink).close()
+	}
+}
+
+// takePendingUpstream returns the upstream link opened in the handshake of a charge point's new connection, nil if none was
+func (cs *CentralSystem) takePendingUpstream(chargePointID string) *upstreamLink {
+	if pending, ok := cs.pendingLinks.LoadAndDelete(chargePointID); ok {
+		return pending.(*upstreamLink)
+	}
+	return nil
+}
+
+// dialUpstream connects to the upstream central system of a gateway with the subprotocol the charge point negotiated
+func (cs *CentralSystem) dialUpstream(ctx context.Context, gateway *models.UpstreamGateway, subprotocol string) (*upstreamLink, error) {
+	u, err := url.Parse(gateway.URL)
+	if err != nil {
+		return nil, err
+	}
+	u = u.JoinPath(gateway.ChargePointID)
+
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: upstreamDialTimeout,
+		Subprotocols:     []string{subprotocol},
+	}
+	conn, _, err := dialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", u.Redacted(), err)
+	}
+	if conn.Subprotocol() != subprotocol {
+		conn.Close()
+		return nil, fmt.Errorf("%s does not accept the %s subprotocol", u.Redacted(), subprotocol)
+	}
+
+	link := &upstreamLink{
+		chargePointID: gateway.ChargePointID,
+		url:           u.Redacted(),
+		conn:          conn,
+		frames:        cs.frames,
+		logger:        cs.logger,
+		transactions:  &transactionIDs{chargePointID: gateway.ChargePointID, db: cs.db},
+		forwarded:     make(map[string]*forwardedCall),
+		upstreamCalls: make(map[string]string),
+	}
+	if len(gateway.Actions) > 0 {
+		link.actions = make(map[string]bool, len(gateway.Actions))
+		for _, action := range gateway.Actions {
+			link.actions[action] = true
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"chargePointID": gateway.ChargePointID,
+		"upstream":      link.url,
+	}).Info("Connected charge point to its upstream central system")
+
+	go link.run()
+	return link, nil
+}
+
+// upstream returns the upstream link of a charge point's connection, nil if it has none. A frame may be read before
+// the new connection is handled, so the link opened in the handshake is taken by whichever comes first.
+func (s *tapServer) upstream(chargePointID string) *upstreamLink {
+	if link, ok := s.upstreams.Load(chargePointID); ok {
+		return link.(*upstreamLink)
+	}
+
+	s.upstreamMu.Lock()
+	defer s.upstreamMu.Unlock()
+
+	if link, ok := s.upstreams.Load(chargePointID); ok {
+		return link.(*upstreamLink)
+	}
+	var link *upstreamLink
+	if s.pendingUpstream != nil {
+		link = s.pendingUpstream(chargePointID)
+	}
+	s.upstreams.Store(chargePointID, link)
+	return link
+}
+
+// connectedUpstream returns the upstream link of a charge point's current connection, nil if it has none
+func (s *tapServer) connectedUpstream(chargePointID string) *upstreamLink {
+	if link, ok := s.upstreams.Load(chargePointID); ok {
+		return link.(*upstreamLink)
+	}
+	return nil
+}
+
+// closeUpstream closes the upstream link of a charge point's closed connection
+func (s *tapServer) closeUpstream(chargePointID string) {
+	if link, ok := s.upstreams.LoadAndDelete(chargePointID); ok && link.(*upstreamLink) != nil {
+		link.(*upstreamLink).close()
+	}
+}
+
+// isClosed reports whether the upstream connection is closed
+func (l *upstreamLink) isClosed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closed
+}
+
+// close closes the upstream connection. Requests still awaiting the upstream's response are answered by the CPMS
+// once they time out.
+func (l *upstreamLink) close() {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	l.closed = true
+	l.upstreamCalls = make(map[string]string)
+	l.mu.Unlock()
+
+	l.conn.Close()
+}
+
+// write sends a frame to the upstream central system, reporting false if the connection is closed or fails
+func (l *upstreamLink) write(data []byte) bool {
+	if l.isClosed() {
+		return false
+	}
+
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+
+	_ = l.conn.SetWriteDeadline(time.Now().Add(upstreamDialTimeout))
+	if err := l.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"chargePointID": l.chargePointID,
+			"upstream":      l.url,
+		}).Warn("Failed to write to the upstream central system, handling the charge point locally")
+		go l.close()
+		return false
+	}
+	return true
+}
+
+// inbound forwards a frame of the charge point to the upstream central system if it is a forwarded request or the
+// response to an upstream's request. It returns the frame for the CPMS to handle, with the upstream's transaction ID
+// mapped to the CPMS's, and false for frames the CPMS must not handle: responses to the upstream, which the CPMS has
+// no request for, and requests with a transaction ID the mapping doesn't know, which are quarantined.
+func (l *upstreamLink) inbound(data []byte) ([]byte, bool) {
+	f, ok := parseFrame(data)
+	if !ok {
+		// Malformed frames are left to the endpoint, which quarantines them
+		return data, true
+	}
+
+	switch f.messageType {
+	case ocppj.CALL:
+		forward := !l.isClosed() && (l.actions == nil || l.actions[f.action])
+		local, known := l.transactions.toLocal(f, data)
+		if !known {
+			if l.frames.quarantine != nil {
+				l.frames.quarantine(l.chargePointID, data, errors.New("transaction ID unknown to the upstream gateway"))
+			}
+			if !forward || !l.forward(f, data, true) {
+				l.sendToChargePoint(callError(f.messageID, ocppj.PropertyConstraintViolation, "Unknown transaction ID"))
+			}
+			return nil, false
+		}
+		if forward {
+			l.forward(f, data, false)
+		}
+		return local, true
+	default:
+		l.mu.Lock()
+		action, ok := l.upstreamCalls[f.messageID]
+		delete(l.upstreamCalls, f.messageID)
+		l.mu.Unlock()
+		if !ok {
+			return data, true
+		}
+
+		l.logger.logMessage(l.chargePointID, f.logType(), action, f.messageID, "", f.logPayload(), "Inbound")
+		l.write(data)
+		return nil, false
+	}
+}
+
+// forward forwards a request of the charge point to the upstream central system, reporting false if it couldn't be
+// written. noLocal marks a request the CPMS doesn't handle, which is answered with an error if the upstream doesn't.
+func (l *upstreamLink) forward(f *frame, data []byte, noLocal bool) bool {
+	l.mu.Lock()
+	call := &forwardedCall{action: f.action, noLocal: noLocal}
+	l.forwarded[f.messageID] = call
+	// The timer is set before the upstream can answer, under the lock the answer is handled with
+	call.timer = time.AfterFunc(upstreamTimeout, func() { l.expire(f.messageID) })
+	l.mu.Unlock()
+
+	if l.write(data) {
+		return true
+	}
+
+	l.mu.Lock()
+	call.timer.Stop()
+	delete(l.forwarded, f.messageID)
+	l.mu.Unlock()
+	return false
+}
+
+// outbound returns a frame the CPMS sends to the charge point, with the CPMS's transaction ID mapped to the
+// upstream's, and false for the CPMS's responses to forwarded requests, which are held back for the upstream's
+func (l *upstreamLink) outbound(data []byte) ([]byte, bool) {
+	f, ok := parseFrame(data)
+	if !ok {
+		return data, true
+	}
+	if f.messageType == ocppj.CALL {
+		return l.transactions.toUpstream(f, data), true
+	}
+
+	l.mu.Lock()
+	call, ok := l.forwarded[f.messageID]
+	if !ok {
+		l.mu.Unlock()
+		return data, true
+	}
+	call.local = f
+	call.localRaw = data
+	response, mapIDs := l.settle(f.messageID, call)
+	l.mu.Unlock()
+
+	if mapIDs != nil {
+		mapIDs()
+	}
+	return response, response != nil
+}
+
+// settle decides on the response to a forwarded request once the CPMS or the upstream answered it, or it timed out.
+// It returns the response to send the charge point, nil if there is none to send yet, and for StartTransaction
+// requests the mapping of the transaction IDs to store before the response is sent, so the charge point's next
+// messages find it. The upstream's response to StartTransaction waits for the CPMS's until the request times out.
+// The request is forgotten once its response was sent and the CPMS answered too, or the request timed out, as the
+// CPMS's response is not waited for any longer. Called with l.mu held.
+func (l *upstreamLink) settle(messageID string, call *forwardedCall) (response []byte, mapIDs func()) {
+	start := call.action == "StartTransaction"
+	if !call.sent {
+		switch {
+		case call.upstream != nil && (call.local != nil || call.noLocal || call.timedOut || !start):
+			response, call.sent = call.upstreamRaw, true
+		case call.timedOut && call.local != nil:
+			response, call.sent = call.localRaw, true
+		case call.timedOut && call.noLocal:
+			response, call.sent = callError(messageID, ocppj.PropertyConstraintViolation, "Unknown transaction ID"), true
+		}
+	}
+
+	if call.sent && (call.local != nil || call.noLocal || call.timedOut) {
+		call.timer.Stop()
+		delete(l.forwarded, messageID)
+		if start && call.local != nil {
+			upstream, local := call.upstream, call.local
+			if upstream == nil {
+				// The charge point got the CPMS's response and uses its transaction ID
+				upstream = local
+			}
+			mapIDs = func() { l.transactions.record(upstream, local) }
+		}
+	}
+	return response, mapIDs
+}
+
+// sendToChargePoint sends a frame of the gateway to the charge point
+func (l *upstreamLink) sendToChargePoint(data []byte) {
+	if err := l.frames.send(l.chargePointID, data); err != nil {
+		logrus.WithError(err).WithField("chargePointID", l.chargePointID).Warn("Failed to send an upstream gateway frame to the charge point")
+	}
+}
+
+// run reads the frames of the upstream central system until its connection closes
+func (l *upstreamLink) run() {
+	defer l.close()
+
+	for {
+		_, data, err := l.conn.ReadMessage()
+		if err != nil {
+			if !l.isClosed() {
+				logrus.WithError(err).WithFields(logrus.Fields{
+					"chargePointID": l.chargePointID,
+					"upstream":      l.url,
+				}).Warn("Upstream central system closed the connection, handling the charge point locally")
+			}
+			return
+		}
+		l.handleUpstream(data)
+	}
+}
+
+// handleUpstream passes a request of the upstream central system on to the charge point, or settles the response to
+// a forwarded request with the upstream's
+func (l *upstreamLink) handleUpstream(data []byte) {
+	f, ok := parseFrame(data)
+	if !ok {
+		logrus.WithField("chargePointID", l.chargePointID).Warn("Dropped a malformed frame of the upstream central system")
+		return
+	}
+
+	if f.messageType == ocppj.CALL {
+		l.mu.Lock()
+		l.upstreamCalls[f.messageID] = f.action
+		l.mu.Unlock()
+
+		l.logger.logMessage(l.chargePointID, "Request", f.action, f.messageID, "", f.payload, "Outbound")
+		l.sendToChargePoint(data)
+		return
+	}
+
+	l.mu.Lock()
+	call, ok := l.forwarded[f.messageID]
+	if !ok || call.upstream != nil {
+		l.mu.Unlock()
+		logrus.WithFields(logrus.Fields{
+			"chargePointID": l.chargePointID,
+			"messageID":     f.messageID,
+		}).Debug("Dropped a late response of the upstream central system")
+		return
+	}
+	call.upstream = f
+	call.upstreamRaw = data
+	response, mapIDs := l.settle(f.messageID, call)
+	l.mu.Unlock()
+
+	l.logger.logMessage(l.chargePointID, f.logType(), call.action, f.messageID, "", f.logPayload(), "Outbound")
+	if mapIDs != nil {
+		mapIDs()
+	}
+	if response != nil {
+		l.sendToChargePoint(response)
+	}
+}
+
+// expire settles a forwarded request the upstream central system didn't answer in time: the charge point is sent
+// the CPMS's response instead
+func (l *upstreamLink) expire(messageID string) {
+	l.mu.Lock()
+	call, ok := l.forwarded[messageID]
+	if !ok {
+		l.mu.Unlock()
+		return
+	}
+	call.timedOut = true
+	answered := call.upstream != nil
+	response, mapIDs := l.settle(messageID, call)
+	l.mu.Unlock()
+
+	if !answered {
+		logrus.WithFields(logrus.Fields{
+			"chargePointID": l.chargePointID,
+			"action":        call.action,
+			"upstream":      l.url,
+		}).Warn("Upstream central system did not answer in time, answering the charge point locally")
+	}
+	if mapIDs != nil {
+		mapIDs()
+	}
+	if response != nil {
+		l.sendToChargePoint(response)
+	}
+}
@@ -0,0 +1,470 @@
+package ocpp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/gorilla/websocket"
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+	"github.com/lorenzodonini/ocpp-go/ws"
+)
+
+func TestParseFrame(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		wantOK bool
+		want   frame
+	}{
+		{
+			name:   "call",
+			data:   `[2,"19223201","BootNotification",{"chargePointVendor":"VendorX","chargePointModel":"SingleSocket"}]`,
+			wantOK: true,
+			want: frame{
+				messageType: ocppj.CALL, messageID: "19223201", action: "BootNotification",
+				payload: []byte(`{"chargePointVendor":"VendorX","chargePointModel":"SingleSocket"}`),
+			},
+		},
+		{
+			name:   "call result",
+			data:   `[3,"19223201",{"status":"Accepted","interval":300}]`,
+			wantOK: true,
+			want:   frame{messageType: ocppj.CALL_RESULT, messageID: "19223201", payload: []byte(`{"status":"Accepted","interval":300}`)},
+		},
+		{
+			name:   "call error",
+			data:   `[4,"19223201","NotImplemented","Unknown action",{}]`,
+			wantOK: true,
+			want:   frame{messageType: ocppj.CALL_ERROR, messageID: "19223201", errorCode: "NotImplemented", errorDesc: "Unknown action"},
+		},
+		{
+			name:   "call error without description",
+			data:   `[4,"19223201","GenericError"]`,
+			wantOK: true,
+			want:   frame{messageType: ocppj.CALL_ERROR, messageID: "19223201", errorCode: "GenericError"},
+		},
+		{name: "call without payload", data: `[2,"19223201","Heartbeat"]`},
+		{name: "call with a numeric action", data: `[2,"19223201",5,{}]`},
+		{name: "numeric message ID", data: `[2,19223201,"Heartbeat",{}]`},
+		{name: "unknown message type", data: `[5,"19223201",{}]`},
+		{name: "too few elements", data: `[3,"19223201"]`},
+		{name: "object", data: `{"messageType":2}`},
+		{name: "invalid JSON", data: `[2,"19223201","Heartbeat",{}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, ok := parseFrame([]byte(tt.data))
+			if ok != tt.wantOK {
+				t.Fatalf("parseFrame() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+
+			if f.messageType != tt.want.messageType || f.messageID != tt.want.messageID || f.action != tt.want.action ||
+				string(f.payload) != string(tt.want.payload) || f.errorCode != tt.want.errorCode || f.errorDesc != tt.want.errorDesc {
+				t.Errorf("parseFrame() = %+v, want %+v", *f, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteTransactionID(t *testing.T) {
+	// Upstream transaction 7 is mirrored as 1042; 8 was started while the upstream was unreachable and kept its ID
+	mapping := map[int]int{7: 1042, 8: 8}
+	lookup := func(id int) (int, bool) {
+		mapped, ok := mapping[id]
+		return mapped, ok
+	}
+
+	tests := []struct {
+		name   string
+		data   string
+		want   string
+		wantOK bool
+	}{
+		{
+			name:   "mapped",
+			data:   `[2,"m1","StopTransaction",{"meterStop":1200,"timestamp":"2026-03-02T11:45:00Z","transactionId":7}]`,
+			want:   `[2,"m1","StopTransaction",{"meterStop":1200,"timestamp":"2026-03-02T11:45:00Z","transactionId":1042}]`,
+			wantOK: true,
+		},
+		{
+			name:   "nested payload kept",
+			data:   `[2,"m2","MeterValues",{"connectorId":1,"meterValue":[{"sampledValue":[{"value":"5000"}],"timestamp":"2026-03-02T11:15:00Z"}],"transactionId":7}]`,
+			want:   `[2,"m2","MeterValues",{"connectorId":1,"meterValue":[{"sampledValue":[{"value":"5000"}],"timestamp":"2026-03-02T11:15:00Z"}],"transactionId":1042}]`,
+			wantOK: true,
+		},
+		{
+			name:   "identity mapping unchanged",
+			data:   `[2,"m3","StopTransaction", {"meterStop":1200, "transactionId":8}]`,
+			want:   `[2,"m3","StopTransaction", {"meterStop":1200, "transactionId":8}]`,
+			wantOK: true,
+		},
+		{
+			name:   "unknown transaction",
+			data:   `[2,"m4","StopTransaction",{"meterStop":1200,"transactionId":9}]`,
+			want:   `[2,"m4","StopTransaction",{"meterStop":1200,"transactionId":9}]`,
+			wantOK: false,
+		},
+		{
+			name:   "no transaction ID",
+			data:   `[2,"m5","MeterValues",{"connectorId":1,"meterValue":[]}]`,
+			want:   `[2,"m5","MeterValues",{"connectorId":1,"meterValue":[]}]`,
+			wantOK: true,
+		},
+		{
+			name:   "non-integer transaction ID",
+			data:   `[2,"m6","DataTransfer",{"vendorId":"X","transactionId":"7"}]`,
+			want:   `[2,"m6","DataTransfer",{"vendorId":"X","transactionId":"7"}]`,
+			wantOK: true,
+		},
+		{
+			name:   "payload not an object",
+			data:   `[2,"m7","DataTransfer",[7]]`,
+			want:   `[2,"m7","DataTransfer",[7]]`,
+			wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, ok := parseFrame([]byte(tt.data))
+			if !ok {
+				t.Fatalf("parseFrame(%s) failed", tt.data)
+			}
+
+			got, ok := rewriteTransactionID(f, []byte(tt.data), lookup)
+			if ok != tt.wantOK {
+				t.Errorf("rewriteTransactionID() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if string(got) != tt.want {
+				t.Errorf("rewriteTransactionID() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCallError(t *testing.T) {
+	data := callError("m1", ocppj.PropertyConstraintViolation, "Unknown transaction")
+
+	want := `[4,"m1","PropertyConstraintViolation","Unknown transaction",{}]`
+	if string(data) != want {
+		t.Fatalf("callError() = %s, want %s", data, want)
+	}
+
+	f, ok := parseFrame(data)
+	if !ok || f.messageType != ocppj.CALL_ERROR || f.messageID != "m1" || f.errorCode != "PropertyConstraintViolation" {
+		t.Errorf("parseFrame(callError()) = %+v, %v", f, ok)
+	}
+}
+
+// gatewayChargePoint is the charge point the upstream link tests connect
+const gatewayChargePoint = "CP001"
+
+// fakeWsServer records the frames sent to charge points
+type fakeWsServer struct {
+	ws.WsServer
+	mu   sync.Mutex
+	sent []string
+}
+
+func (s *fakeWsServer) Write(chargePointID string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, string(data))
+	return nil
+}
+
+func (s *fakeWsServer) frames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.sent...)
+}
+
+// newTestLink returns an upstream link of gatewayChargePoint connected to a test upstream central system, which
+// passes on the frames it reads
+func newTestLink(t *testing.T, store db.Store) (*upstreamLink, *fakeWsServer, <-chan string) {
+	t.Helper()
+
+	received := make(chan string, 16)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(data)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wsServer := &fakeWsServer{}
+	link := &upstreamLink{
+		chargePointID: gatewayChargePoint,
+		conn:          conn,
+		frames:        &tapServer{WsServer: wsServer, taps: &taps{}},
+		transactions:  &transactionIDs{chargePointID: gatewayChargePoint, db: store},
+		forwarded:     make(map[string]*forwardedCall),
+		upstreamCalls: make(map[string]string),
+	}
+	t.Cleanup(func() {
+		link.mu.Lock()
+		for _, call := range link.forwarded {
+			call.timer.Stop()
+		}
+		link.mu.Unlock()
+		conn.Close()
+	})
+	return link, wsServer, received
+}
+
+// upstreamFrames returns the frames written to the test upstream central system, which has read them all once it
+// reads the end marker written last
+func upstreamFrames(t *testing.T, link *upstreamLink, received <-chan string) []string {
+	t.Helper()
+
+	const end = `"end"`
+	if !link.write([]byte(end)) {
+		return nil
+	}
+	var frames []string
+	for {
+		select {
+		case data := <-received:
+			if data == end {
+				return frames
+			}
+			frames = append(frames, data)
+		case <-time.After(5 * time.Second):
+			t.Fatal("upstream central system read no end marker")
+		}
+	}
+}
+
+func TestInbound(t *testing.T) {
+	const (
+		heartbeat     = `[2,"m1","Heartbeat",{}]`
+		stopUpstream  = `[2,"m2","StopTransaction",{"meterStop":1200,"transactionId":7}]`
+		stopLocal     = `[2,"m2","StopTransaction",{"meterStop":1200,"transactionId":1001}]`
+		stopUnknown   = `[2,"m3","StopTransaction",{"meterStop":1200,"transactionId":9}]`
+		startResponse = `[3,"u1",{"status":"Accepted"}]`
+	)
+
+	tests := []struct {
+		name            string
+		closed          bool
+		actions         []string // Forwarded requests, nil forwards all
+		data            string
+		want            string   // Frame the CPMS handles, empty if it must not handle the frame
+		wantUpstream    []string // Frames written to the upstream
+		wantSent        []string // Frames sent to the charge point
+		wantForwarded   bool     // The request awaits the upstream's response
+		wantQuarantined bool
+	}{
+		{name: "forwarded request", data: heartbeat, want: heartbeat, wantUpstream: []string{heartbeat}, wantForwarded: true},
+		{name: "request not forwarded", actions: []string{"StopTransaction"}, data: heartbeat, want: heartbeat},
+		{name: "closed upstream", closed: true, data: heartbeat, want: heartbeat},
+		{name: "transaction ID mapped", data: stopUpstream, want: stopLocal, wantUpstream: []string{stopUpstream}, wantForwarded: true},
+		{name: "unknown transaction forwarded", data: stopUnknown, wantUpstream: []string{stopUnknown}, wantForwarded: true, wantQuarantined: true},
+		{
+			name:            "unknown transaction not forwarded",
+			actions:         []string{"Heartbeat"},
+			data:            stopUnknown,
+			wantSent:        []string{`[4,"m3","PropertyConstraintViolation","Unknown transaction ID",{}]`},
+			wantQuarantined: true,
+		},
+		{name: "response to the upstream", data: startResponse, wantUpstream: []string{startResponse}},
+		{name: "response to the CPMS", data: `[3,"c1",{"status":"Accepted"}]`, want: `[3,"c1",{"status":"Accepted"}]`},
+		{name: "malformed frame", data: `[2,"m1"`, want: `[2,"m1"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := db.NewMemoryStore()
+			tx := &models.Transaction{ChargePointID: gatewayChargePoint, ConnectorID: 1, IdTag: "TAG1", StartTime: time.Now()}
+			if err := store.StartTransaction(ctx, tx); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.SetUpstreamTransactionID(ctx, tx.ID, 7); err != nil {
+				t.Fatal(err)
+			}
+
+			link, wsServer, received := newTestLink(t, store)
+			if tt.actions != nil {
+				link.actions = make(map[string]bool)
+				for _, action := range tt.actions {
+					link.actions[action] = true
+				}
+			}
+			if tt.closed {
+				link.close()
+			}
+			link.upstreamCalls["u1"] = "RemoteStartTransaction"
+			var quarantined bool
+			link.frames.quarantine = func(string, []byte, error) { quarantined = true }
+
+			got, ok := link.inbound([]byte(tt.data))
+			if ok != (tt.want != "") || string(got) != tt.want {
+				t.Errorf("inbound() = %s, %v, want %s", got, ok, tt.want)
+			}
+			if upstream := upstreamFrames(t, link, received); !reflect.DeepEqual(upstream, tt.wantUpstream) {
+				t.Errorf("upstream frames = %v, want %v", upstream, tt.wantUpstream)
+			}
+			if sent := wsServer.frames(); !reflect.DeepEqual(sent, tt.wantSent) {
+				t.Errorf("charge point frames = %v, want %v", sent, tt.wantSent)
+			}
+			if quarantined != tt.wantQuarantined {
+				t.Errorf("quarantined = %v, want %v", quarantined, tt.wantQuarantined)
+			}
+
+			link.mu.Lock()
+			defer link.mu.Unlock()
+			if forwarded := len(link.forwarded) > 0; forwarded != tt.wantForwarded {
+				t.Errorf("forwarded = %v, want %v", forwarded, tt.wantForwarded)
+			}
+			if _, pending := link.upstreamCalls["u1"]; pending == (tt.data == startResponse) {
+				t.Errorf("upstream request pending = %v", pending)
+			}
+		})
+	}
+}
+
+func TestSettle(t *testing.T) {
+	const (
+		upstream = `[3,"m1",{"transactionId":7,"idTagInfo":{"status":"Accepted"}}]`
+		local    = `[3,"m1",{"transactionId":1001,"idTagInfo":{"status":"Accepted"}}]`
+		unknown  = `[4,"m1","PropertyConstraintViolation","Unknown transaction ID",{}]`
+	)
+
+	tests := []struct {
+		name          string
+		action        string
+		upstream      bool // The upstream answered
+		local         bool // The CPMS answered
+		noLocal       bool
+		timedOut      bool
+		sent          bool
+		want          string // Response to send the charge point
+		wantForwarded bool   // The request is still awaited
+		wantMapIDs    bool
+	}{
+		{name: "upstream first", action: "Heartbeat", upstream: true, want: upstream, wantForwarded: true},
+		{name: "upstream after the CPMS", action: "Heartbeat", upstream: true, local: true, want: upstream},
+		{name: "CPMS first", action: "Heartbeat", local: true, wantForwarded: true},
+		{name: "CPMS after the upstream", action: "Heartbeat", upstream: true, local: true, sent: true},
+		{name: "start waits for the CPMS", action: "StartTransaction", upstream: true, wantForwarded: true},
+		{name: "start answered by both", action: "StartTransaction", upstream: true, local: true, want: upstream, wantMapIDs: true},
+		{name: "start answered by the CPMS on timeout", action: "StartTransaction", local: true, timedOut: true, want: local, wantMapIDs: true},
+		{name: "start answered by the upstream on timeout", action: "StartTransaction", upstream: true, timedOut: true, want: upstream},
+		{name: "CPMS answer on timeout", action: "Heartbeat", local: true, timedOut: true, want: local},
+		{name: "unknown transaction answered by the upstream", action: "StopTransaction", upstream: true, noLocal: true, want: upstream},
+		{name: "unknown transaction on timeout", action: "StopTransaction", noLocal: true, timedOut: true, want: unknown},
+		{name: "no answer on timeout", action: "Heartbeat", timedOut: true, wantForwarded: true},
+		{name: "CPMS never answered", action: "Heartbeat", upstream: true, timedOut: true, sent: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			call := &forwardedCall{action: tt.action, noLocal: tt.noLocal, timedOut: tt.timedOut, sent: tt.sent}
+			call.timer = time.AfterFunc(time.Hour, func() {})
+			defer call.timer.Stop()
+			if tt.upstream {
+				call.upstreamRaw = []byte(upstream)
+				call.upstream, _ = parseFrame(call.upstreamRaw)
+			}
+			if tt.local {
+				call.localRaw = []byte(local)
+				call.local, _ = parseFrame(call.localRaw)
+			}
+			link := &upstreamLink{forwarded: map[string]*forwardedCall{"m1": call}}
+
+			response, mapIDs := link.settle("m1", call)
+			if string(response) != tt.want {
+				t.Errorf("settle() response = %s, want %s", response, tt.want)
+			}
+			if (mapIDs != nil) != tt.wantMapIDs {
+				t.Errorf("settle() maps transaction IDs = %v, want %v", mapIDs != nil, tt.wantMapIDs)
+			}
+			if _, forwarded := link.forwarded["m1"]; forwarded != tt.wantForwarded {
+				t.Errorf("forwarded = %v, want %v", forwarded, tt.wantForwarded)
+			}
+		})
+	}
+}
+
+func TestExpire(t *testing.T) {
+	const (
+		upstream = `[3,"m1",{"currentTime":"2026-03-02T11:00:00Z"}]`
+		local    = `[3,"m1",{"currentTime":"2026-03-02T11:00:01Z"}]`
+	)
+
+	tests := []struct {
+		name          string
+		upstream      bool // The upstream answered and its response was sent
+		local         bool // The CPMS answered
+		noLocal       bool
+		want          []string // Frames sent to the charge point
+		wantForwarded bool     // The request is still awaited
+	}{
+		{name: "CPMS answer sent", local: true, want: []string{local}},
+		{name: "unknown transaction", noLocal: true, want: []string{`[4,"m1","PropertyConstraintViolation","Unknown transaction ID",{}]`}},
+		{name: "CPMS answer no longer awaited", upstream: true},
+		{name: "no answer yet", wantForwarded: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			call := &forwardedCall{action: "Heartbeat", noLocal: tt.noLocal, sent: tt.upstream}
+			call.timer = time.AfterFunc(time.Hour, func() {})
+			defer call.timer.Stop()
+			if tt.upstream {
+				call.upstreamRaw = []byte(upstream)
+				call.upstream, _ = parseFrame(call.upstreamRaw)
+			}
+			if tt.local {
+				call.localRaw = []byte(local)
+				call.local, _ = parseFrame(call.localRaw)
+			}
+			wsServer := &fakeWsServer{}
+			link := &upstreamLink{
+				chargePointID: gatewayChargePoint,
+				frames:        &tapServer{WsServer: wsServer, taps: &taps{}},
+				forwarded:     map[string]*forwardedCall{"m1": call},
+			}
+
+			link.expire("m1")
+			link.expire("m2") // Unknown requests are ignored
+			if sent := wsServer.frames(); !reflect.DeepEqual(sent, tt.want) {
+				t.Errorf("charge point frames = %v, want %v", sent, tt.want)
+			}
+			if !call.timedOut {
+				t.Error("request not marked timed out")
+			}
+			if _, forwarded := link.forwarded["m1"]; forwarded != tt.wantForwarded {
+				t.Errorf("forwarded = %v, want %v", forwarded, tt.wantForwarded)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package ocpp
+
+import (
+	"context"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Auto-stop reasons recorded on transactions stopped by the CPMS
+const (
+	StopReasonCostCap   = "CostCapReached"
+	StopReasonEnergyCap = "EnergyCapReached"
+)
+
+// limitCheckInterval is the least time between two cap checks of a transaction. Pricing a session reads all of its
+// energy readings, so the caps are checked at most this often rather than on every MeterValues request.
+const limitCheckInterval = 30 * time.Second
+
+// checkSessionLimits sends a RemoteStopTransaction when a transaction reached its cost or energy cap
+func (cs *CentralSystem) checkSessionLimits(ctx context.Context, chargePointID string, transactionID int) {
+	if cs.replaying {
+		return
+	}
+
+	now := time.Now()
+	if last, ok := cs.limitChecks.Load(transactionID); ok && now.Sub(last.(time.Time)) < limitCheckInterval {
+		return
+	}
+	cs.limitChecks.Store(transactionID, now)
+
+	tx, err := cs.db.GetTransaction(ctx, transactionID)
+	if err != nil {
+		logrus.WithError(err).WithField("transactionId", transactionID).Debug("Failed to get transaction for limit check")
+		return
+	}
+
+	// Skip uncapped transactions and transactions that are already being stopped
+	if (tx.MaxCost <= 0 && tx.MaxEnergy <= 0) || tx.StopReason != "" || tx.Status != "InProgress" {
+		return
+	}
+
+	cost, err := cs.tariff.SessionCost(ctx, tx)
+	if err != nil {
+		logrus.WithError(err).WithField("transactionId", transactionID).Error("Failed to calculate session cost")
+		return
+	}
+
+	reason := ""
+	switch {
+	case tx.MaxEnergy > 0 && cost.EnergyKWh >= tx.MaxEnergy:
+		reason = StopReasonEnergyCap
+	case tx.MaxCost > 0 && cost.Cost >= tx.MaxCost:
+		reason = StopReasonCostCap
+	default:
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"chargePointID": chargePointID,
+		"transactionId": transactionID,
+		"energyKWh":     cost.EnergyKWh,
+		"cost":          cost.Cost,
+		"reason":        reason,
+	}).Info("Session cap reached, stopping transaction")
+
+	// The reason is recorded before the request is sent, so later checks skip the transaction while it is being stopped.
+	// It is cleared again unless the charge point accepts the request, so the next check retries the stop.
+	if err := cs.db.SetTransactionStopReason(ctx, transactionID, reason); err != nil {
+		logrus.WithError(err).WithField("transactionId", transactionID).Error("Failed to record stop reason")
+		return
+	}
+
+	callback := func(response ocpp.Response, err error) {
+		if err != nil {
+			logrus.WithError(err).WithField("transactionId", transactionID).Error("Auto-stop request failed")
+			cs.clearStopReason(transactionID)
+			return
+		}
+
+		confirmation, ok := response.(*core.RemoteStopTransactionConfirmation)
+		if !ok || confirmation.Status != types.RemoteStartStopStatusAccepted {
+			logrus.WithField("transactionId", transactionID).Warn("Auto-stop request rejected")
+			cs.clearStopReason(transactionID)
+			return
+		}
+		logrus.WithField("transactionId", transactionID).Info("Auto-stop request accepted")
+	}
+
+	request := core.NewRemoteStopTransactionRequest(transactionID)
+	if err := cs.SendCommandAsync(chargePointID, "", request, callback); err != nil {
+		logrus.WithError(err).WithField("transactionId", transactionID).Error("Failed to send auto-stop request")
+		cs.clearStopReason(transactionID)
+	}
+}
+
+// clearStopReason removes the auto-stop reason of a transaction the charge point did not stop
+func (cs *CentralSystem) clearStopReason(transactionID int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := cs.db.SetTransactionStopReason(ctx, transactionID, ""); err != nil {
+		logrus.WithError(err).WithField("transactionId", transactionID).Error("Failed to clear stop reason")
+	}
+}
+
+// ForgetTransaction drops the state kept in memory for a transaction the CPMS closed itself. Orphaned and reconciled
+// transactions never get a StopTransaction, which drops it otherwise.
+func (cs *CentralSystem) ForgetTransaction(chargePointID string, transactionID int) {
+	cs.endLiveTransaction(chargePointID, transactionID)
+	cs.limitChecks.Delete(transactionID)
+	cs.txUpdates.Delete(transactionID)
+}
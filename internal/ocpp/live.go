@@ -0,0 +1,137 @@
+package ocpp
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// liveMeasurandPrefixes are the families of measurands kept in the live readings of a charge point
+var liveMeasurandPrefixes = []string{"Power.", "Current.", "Energy."}
+
+// liveReadings holds the most recent power, current and energy readings of the connectors of a charge point
+type liveReadings struct {
+	mu         sync.Mutex
+	connectors map[int]*models.LiveConnector
+	readings   map[int]map[string]*models.MeterValue // Connector ID -> measurand, phase and location -> reading
+}
+
+// isLiveMeasurand reports whether a measurand is kept in the live readings
+func isLiveMeasurand(measurand string) bool {
+	for _, prefix := range liveMeasurandPrefixes {
+		if strings.HasPrefix(measurand, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// updateLiveReadings keeps the readings of a MeterValues request as the live readings of its connector,
+// unless a later reading of the same measurand, phase and location was received already
+func (cs *CentralSystem) updateLiveReadings(chargePointID string, connectorID, transactionID int, batch []*models.MeterValue) {
+	if cs.replaying {
+		return
+	}
+
+	value, _ := cs.liveReadings.LoadOrStore(chargePointID, &liveReadings{
+		connectors: make(map[int]*models.LiveConnector),
+		readings:   make(map[int]map[string]*models.MeterValue),
+	})
+	live := value.(*liveReadings)
+
+	live.mu.Lock()
+	defer live.mu.Unlock()
+
+	connector, ok := live.connectors[connectorID]
+	if !ok {
+		connector = &models.LiveConnector{ConnectorID: connectorID}
+		live.connectors[connectorID] = connector
+		live.readings[connectorID] = make(map[string]*models.MeterValue)
+	}
+	if transactionID != 0 {
+		connector.TransactionID = transactionID
+	}
+
+	readings := live.readings[connectorID]
+	for _, mv := range batch {
+		if !isLiveMeasurand(mv.Measurand) {
+			continue
+		}
+		key := mv.Measurand + "|" + mv.Phase + "|" + mv.Location
+		if latest, ok := readings[key]; ok && mv.Timestamp.Before(latest.Timestamp) {
+			continue
+		}
+		reading := *mv
+		readings[key] = &reading
+		if mv.Timestamp.After(connector.UpdatedAt) {
+			connector.UpdatedAt = mv.Timestamp
+		}
+	}
+}
+
+// endLiveTransaction drops the power and current readings of the connector a transaction ran on once it stopped,
+// the energy register readings remain
+func (cs *CentralSystem) endLiveTransaction(chargePointID string, transactionID int) {
+	value, ok := cs.liveReadings.Load(chargePointID)
+	if !ok {
+		return
+	}
+	live := value.(*liveReadings)
+
+	live.mu.Lock()
+	defer live.mu.Unlock()
+
+	for connectorID, connector := range live.connectors {
+		if connector.TransactionID != transactionID {
+			continue
+		}
+		connector.TransactionID = 0
+		for key, reading := range live.readings[connectorID] {
+			if !strings.HasPrefix(reading.Measurand, "Energy.") {
+				delete(live.readings[connectorID], key)
+			}
+		}
+	}
+}
+
+// LiveReadings returns the most recent power, current and energy readings per connector of a charge point
+// connected to this instance, ordered by connector ID. They are kept in memory from the MeterValues requests
+// received since the charge point connected.
+func (cs *CentralSystem) LiveReadings(chargePointID string) []*models.LiveConnector {
+	connectors := []*models.LiveConnector{}
+
+	value, ok := cs.liveReadings.Load(chargePointID)
+	if !ok {
+		return connectors
+	}
+	live := value.(*liveReadings)
+
+	live.mu.Lock()
+	defer live.mu.Unlock()
+
+	for connectorID, connector := range live.connectors {
+		c := *connector
+		c.Readings = make([]*models.MeterValue, 0, len(live.readings[connectorID]))
+		for _, reading := range live.readings[connectorID] {
+			mv := *reading
+			c.Readings = append(c.Readings, &mv)
+		}
+		sort.Slice(c.Readings, func(i, j int) bool {
+			a, b := c.Readings[i], c.Readings[j]
+			if a.Measurand != b.Measurand {
+				return a.Measurand < b.Measurand
+			}
+			if a.Phase != b.Phase {
+				return a.Phase < b.Phase
+			}
+			return a.Location < b.Location
+		})
+		connectors = append(connectors, &c)
+	}
+	sort.Slice(connectors, func(i, j int) bool {
+		return connectors[i].ConnectorID < connectors[j].ConnectorID
+	})
+	return connectors
+}
@@ -3,54 +3,118 @@ package ocpp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/balu-dk/go-cpms/internal/db"
 	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/siem"
+	"github.com/lorenzodonini/ocpp-go/ocpp"
 	"github.com/sirupsen/logrus"
 )
 
-// OCPPLogger logs OCPP messages to the database
+// OCPPLogger logs OCPP messages to the database and forwards them to the SIEM, with personal data redacted
 type OCPPLogger struct {
-	db *db.PostgresStore
+	db       db.Store
+	siem     *siem.Forwarder
+	redactor *payloadRedactor
 }
 
-// NewOCPPLogger creates a new OCPP logger
-func NewOCPPLogger(db *db.PostgresStore) *OCPPLogger {
+// NewOCPPLogger creates a new OCPP logger masking idTags and the redactFields in payloads,
+// except for the fullLogChargePoints whose messages are logged in full
+func NewOCPPLogger(db db.Store, forwarder *siem.Forwarder, redactFields, fullLogChargePoints []string) *OCPPLogger {
 	return &OCPPLogger{
-		db: db,
+		db:       db,
+		siem:     forwarder,
+		redactor: newPayloadRedactor(redactFields, fullLogChargePoints),
 	}
 }
 
 // LogRequest logs an OCPP request
 func (l *OCPPLogger) LogRequest(chargePointID, action, requestID string, payload interface{}, direction string) {
-	l.logMessage(chargePointID, "Request", action, requestID, payload, direction)
+	l.logMessage(chargePointID, "Request", action, requestID, "", payload, direction)
 }
 
 // LogResponse logs an OCPP response
 func (l *OCPPLogger) LogResponse(chargePointID, action, requestID string, payload interface{}, direction string) {
-	l.logMessage(chargePointID, "Response", action, requestID, payload, direction)
+	l.logMessage(chargePointID, "Response", action, requestID, "", payload, direction)
 }
 
-// logMessage logs an OCPP message to the database
-func (l *OCPPLogger) logMessage(chargePointID, messageType, action, requestID string, payload interface{}, direction string) {
+// LogCommand logs an outbound command (messageType Request) or its confirmation (messageType Response)
+// with the ID of the API request that sent it
+func (l *OCPPLogger) LogCommand(chargePointID, messageType, action, apiRequestID string, payload interface{}) {
+	direction := "Outbound"
+	if messageType == "Response" {
+		direction = "Inbound"
+	}
+	l.logMessage(chargePointID, messageType, action, "", apiRequestID, payload, direction)
+}
+
+// LogConfirmation logs the confirmation of an outbound command, or the error the charge point answered it with
+func (l *OCPPLogger) LogConfirmation(chargePointID, action, apiRequestID string, confirmation ocpp.Response, err error) {
+	var ocppErr *ocpp.Error
+	switch {
+	case err == nil && confirmation != nil:
+		l.LogCommand(chargePointID, "Response", action, apiRequestID, confirmation)
+	case errors.As(err, &ocppErr):
+		l.logMessage(chargePointID, "Error", action, "", apiRequestID, map[string]string{
+			"errorCode":        string(ocppErr.Code),
+			"errorDescription": ocppErr.Description,
+		}, "Inbound")
+	}
+}
+
+// redactRaw masks the personal data and credentials of a raw inbound frame or payload, as logged messages are.
+// Payloads that aren't valid JSON are kept as text with the personal data fields masked.
+func (l *OCPPLogger) redactRaw(chargePointID string, data []byte) []byte {
+	var redactor *payloadRedactor
+	if l != nil {
+		redactor = l.redactor
+	}
+	if !json.Valid(data) {
+		return redactor.redactText(chargePointID, data)
+	}
+	return redactFrame(redactor.redact(chargePointID, data))
+}
+
+// logMessage logs an OCPP message to the database. A nil logger discards messages, as for replays.
+func (l *OCPPLogger) logMessage(chargePointID, messageType, action, requestID, apiRequestID string, payload interface{}, direction string) {
+	if l == nil {
+		return
+	}
+
 	// Konverter payload til en JSON-string
 	payloadJSON, err := json.Marshal(payload)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to marshal OCPP message payload")
 		payloadJSON = []byte("{}")
 	}
+	payloadJSON = l.redactor.redact(chargePointID, payloadJSON)
+	// Credentials are never logged, not even for the charge points logged in full
+	payloadJSON = redactFrame(payloadJSON)
 
 	msg := &models.OCPPMessage{
 		ChargePointID: chargePointID,
 		MessageType:   messageType,
 		Action:        action,
 		RequestID:     requestID,
+		APIRequestID:  apiRequestID,
 		Payload:       string(payloadJSON), // Konverteret til string
 		Direction:     direction,
 		Timestamp:     time.Now(),
 	}
 
+	l.siem.Forward(siem.Record{
+		Timestamp:     msg.Timestamp,
+		Kind:          siem.KindOCPP,
+		Name:          action,
+		Severity:      siem.SeverityInfo,
+		ChargePointID: chargePointID,
+		MessageType:   messageType,
+		Direction:     direction,
+		Data:          json.RawMessage(payloadJSON),
+	})
+
 	// Use a background context with a timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -60,6 +124,7 @@ func (l *OCPPLogger) logMessage(chargePointID, messageType, action, requestID st
 			"chargePointID": chargePointID,
 			"action":        action,
 			"requestID":     requestID,
+			"apiRequestID":  apiRequestID,
 			"error":         err,
 		}).Error("Failed to log OCPP message")
 	}
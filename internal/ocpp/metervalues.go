@@ -0,0 +1,73 @@
+package ocpp
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/sirupsen/logrus"
+)
+
+// meterValueFromSampledValue converts a sampled value of a MeterValues or StopTransaction request to a meter value,
+// keeping all of its attributes. Omitted attributes get their OCPP default. The caller sets the charge point,
+// connector, transaction and timestamp. It fails if the value isn't a number, like signed meter data.
+func meterValueFromSampledValue(sampledValue types.SampledValue) (*models.MeterValue, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(sampledValue.Value), 64)
+	if err != nil {
+		return nil, err
+	}
+
+	mv := &models.MeterValue{
+		Value:     value,
+		Measurand: string(types.MeasurandEnergyActiveImportRegister),
+		Unit:      string(types.UnitOfMeasureWh),
+		Context:   string(types.ReadingContextSamplePeriodic),
+		Format:    string(types.ValueFormatRaw),
+		Location:  string(types.LocationOutlet),
+		Phase:     string(sampledValue.Phase),
+	}
+	if sampledValue.Measurand != "" {
+		mv.Measurand = string(sampledValue.Measurand)
+	}
+	if sampledValue.Unit != "" {
+		mv.Unit = string(sampledValue.Unit)
+	}
+	if sampledValue.Context != "" {
+		mv.Context = string(sampledValue.Context)
+	}
+	if sampledValue.Format != "" {
+		mv.Format = string(sampledValue.Format)
+	}
+	if sampledValue.Location != "" {
+		mv.Location = string(sampledValue.Location)
+	}
+	return mv, nil
+}
+
+// recordSoC records the latest state of charge reading of a batch of meter values on their transaction.
+// A reading in the Transaction.End context is the end SoC of the transaction.
+func (cs *CentralSystem) recordSoC(ctx context.Context, chargePointID string, transactionID int, batch []*models.MeterValue) {
+	if transactionID == 0 {
+		return
+	}
+
+	var latest *models.MeterValue
+	for _, mv := range batch {
+		if mv.Measurand == string(types.MeasueandSoC) && (latest == nil || !mv.Timestamp.Before(latest.Timestamp)) {
+			latest = mv
+		}
+	}
+	if latest == nil {
+		return
+	}
+
+	end := latest.Context == string(types.ReadingContextTransactionEnd)
+	if err := cs.db.RecordTransactionSoC(ctx, transactionID, latest.Value, end); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"transactionId": transactionID,
+		}).Error("Failed to record the state of charge")
+	}
+}
@@ -0,0 +1,377 @@
+// Package ocpptest provides an in-memory OCPP server for testing the service layer without charge points.
+package ocpptest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	cpmsocpp "github.com/balu-dk/go-cpms/internal/ocpp"
+	"github.com/balu-dk/go-cpms/internal/service"
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+)
+
+var _ service.OCPPServer = (*Server)(nil)
+
+// Request is a request sent to a charge point through the server
+type Request struct {
+	ChargePointID string
+	Request       ocpp.Request
+}
+
+// Handler answers the requests sent to charge points
+type Handler func(chargePointID string, request ocpp.Request) (ocpp.Response, error)
+
+// Server is an in-memory OCPP server implementing service.OCPPServer. Charge points are connected
+// with Connect, and the requests sent to them are recorded and answered by the handler.
+type Server struct {
+	mu                sync.Mutex
+	handler           Handler
+	connected         map[string]bool
+	requests          []Request
+	commands          []*models.OCPPMessage
+	replayed          []*models.OCPPMessage
+	taps              map[string][]chan cpmsocpp.Frame
+	live              map[string][]*models.LiveConnector
+	heartbeatInterval int
+	messageRate       float64
+	messageBurst      int
+	maxConnections    int
+	connectRate       float64
+	connectBurst      int
+	invalidated       []string
+	forgotten         []int
+}
+
+// NewServer creates a server whose requests are answered by handler, nil to fail every request
+func NewServer(handler Handler) *Server {
+	return &Server{
+		handler:   handler,
+		connected: make(map[string]bool),
+		taps:      make(map[string][]chan cpmsocpp.Frame),
+		live:      make(map[string][]*models.LiveConnector),
+	}
+}
+
+// Start does nothing, the server accepts no connections
+func (s *Server) Start() error {
+	return nil
+}
+
+// Stop disconnects all charge points and stops all taps
+func (s *Server) Stop(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connected = make(map[string]bool)
+	for chargePointID, subs := range s.taps {
+		for _, frames := range subs {
+			close(frames)
+		}
+		delete(s.taps, chargePointID)
+	}
+}
+
+// SetHandler replaces the handler answering requests
+func (s *Server) SetHandler(handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handler = handler
+}
+
+// Connect marks charge points as connected to this instance
+func (s *Server) Connect(chargePointIDs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range chargePointIDs {
+		s.connected[id] = true
+	}
+}
+
+// Disconnect marks charge points as disconnected
+func (s *Server) Disconnect(chargePointIDs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range chargePointIDs {
+		delete(s.connected, id)
+	}
+}
+
+// IsLocal reports whether a charge point is connected
+func (s *Server) IsLocal(chargePointID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connected[chargePointID]
+}
+
+// LocalChargePoints returns the IDs of the connected charge points, sorted
+func (s *Server) LocalChargePoints() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	for id := range s.connected {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// SendRequestAsync records a request to a connected charge point and passes the answer of the handler
+// to the callback in a new goroutine, like a confirmation arriving from the charge point
+func (s *Server) SendRequestAsync(chargePointID string, request ocpp.Request, callback func(ocpp.Response, error)) error {
+	return s.SendCommandAsync(chargePointID, "", request, callback)
+}
+
+// SendRequest records a request to a connected charge point and returns the answer of the handler
+func (s *Server) SendRequest(ctx context.Context, chargePointID string, request ocpp.Request) (ocpp.Response, error) {
+	return s.SendCommand(ctx, chargePointID, "", request)
+}
+
+// SendCommandAsync sends a request like SendRequestAsync and logs it with its confirmation
+func (s *Server) SendCommandAsync(chargePointID, apiRequestID string, request ocpp.Request, callback func(ocpp.Response, error)) error {
+	handler, err := s.send(chargePointID, request)
+	if err != nil {
+		return err
+	}
+	s.logCommand(chargePointID, "Request", request.GetFeatureName(), apiRequestID, request)
+
+	go func() {
+		confirmation, err := answer(handler, chargePointID, request)
+		if err == nil {
+			s.logCommand(chargePointID, "Response", request.GetFeatureName(), apiRequestID, confirmation)
+		}
+		callback(confirmation, err)
+	}()
+	return nil
+}
+
+// SendCommand sends a request like SendRequest and logs it with its confirmation
+func (s *Server) SendCommand(ctx context.Context, chargePointID, apiRequestID string, request ocpp.Request) (ocpp.Response, error) {
+	handler, err := s.send(chargePointID, request)
+	if err != nil {
+		return nil, err
+	}
+	s.logCommand(chargePointID, "Request", request.GetFeatureName(), apiRequestID, request)
+
+	confirmation, err := answer(handler, chargePointID, request)
+	if err == nil {
+		s.logCommand(chargePointID, "Response", request.GetFeatureName(), apiRequestID, confirmation)
+	}
+	return confirmation, err
+}
+
+// send records a request if the charge point is connected and returns the handler to answer it with
+func (s *Server) send(chargePointID string, request ocpp.Request) (Handler, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.connected[chargePointID] {
+		return nil, fmt.Errorf("charge point %s is not connected", chargePointID)
+	}
+	s.requests = append(s.requests, Request{ChargePointID: chargePointID, Request: request})
+	return s.handler, nil
+}
+
+// answer answers a request with a handler
+func answer(handler Handler, chargePointID string, request ocpp.Request) (ocpp.Response, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("no handler for %s", request.GetFeatureName())
+	}
+	return handler(chargePointID, request)
+}
+
+// Requests returns the requests sent to charge points, in order
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// logCommand records a logged command or confirmation
+func (s *Server) logCommand(chargePointID, messageType, action, apiRequestID string, payload interface{}) {
+	data, _ := json.Marshal(payload)
+	direction := "Outbound"
+	if messageType == "Response" {
+		direction = "Inbound"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.commands = append(s.commands, &models.OCPPMessage{
+		ChargePointID: chargePointID,
+		MessageType:   messageType,
+		Action:        action,
+		APIRequestID:  apiRequestID,
+		Payload:       string(data),
+		Direction:     direction,
+		Timestamp:     time.Now(),
+	})
+}
+
+// Commands returns the logged commands and confirmations, in order
+func (s *Server) Commands() []*models.OCPPMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*models.OCPPMessage(nil), s.commands...)
+}
+
+// HeartbeatInterval returns the heartbeat interval in seconds
+func (s *Server) HeartbeatInterval() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.heartbeatInterval
+}
+
+// SetHeartbeatInterval changes the heartbeat interval
+func (s *Server) SetHeartbeatInterval(seconds int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.heartbeatInterval = seconds
+}
+
+// SetMessageRateLimit records the inbound message rate limit
+func (s *Server) SetMessageRateLimit(rate float64, burst int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messageRate, s.messageBurst = rate, burst
+}
+
+// MessageRateLimit returns the inbound message rate limit
+func (s *Server) MessageRateLimit() (float64, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.messageRate, s.messageBurst
+}
+
+// SetConnectionLimits records the connection limits
+func (s *Server) SetConnectionLimits(maxConnections int, rate float64, burst int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxConnections, s.connectRate, s.connectBurst = maxConnections, rate, burst
+}
+
+// ConnectionLimits returns the connection limits
+func (s *Server) ConnectionLimits() (int, float64, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxConnections, s.connectRate, s.connectBurst
+}
+
+// Replay records the replayed messages and reports each as replayed without a confirmation
+func (s *Server) Replay(messages []*models.OCPPMessage, dryRun bool) []cpmsocpp.ReplayResult {
+	s.mu.Lock()
+	s.replayed = append(s.replayed, messages...)
+	s.mu.Unlock()
+
+	results := make([]cpmsocpp.ReplayResult, 0, len(messages))
+	for _, msg := range messages {
+		results = append(results, cpmsocpp.ReplayResult{
+			MessageID:     msg.ID,
+			ChargePointID: msg.ChargePointID,
+			Action:        msg.Action,
+			Timestamp:     msg.Timestamp,
+		})
+	}
+	return results
+}
+
+// Replayed returns the replayed messages, in order
+func (s *Server) Replayed() []*models.OCPPMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*models.OCPPMessage(nil), s.replayed...)
+}
+
+// Tap streams the frames published for a charge point until stop is called
+func (s *Server) Tap(chargePointID string) (<-chan cpmsocpp.Frame, func()) {
+	frames := make(chan cpmsocpp.Frame, 16)
+
+	s.mu.Lock()
+	s.taps[chargePointID] = append(s.taps[chargePointID], frames)
+	s.mu.Unlock()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			subs := s.taps[chargePointID]
+			for i, sub := range subs {
+				if sub == frames {
+					s.taps[chargePointID] = append(subs[:i], subs[i+1:]...)
+					close(frames)
+					break
+				}
+			}
+		})
+	}
+	return frames, stop
+}
+
+// Publish sends a frame to the taps of its charge point. Taps that are full miss the frame.
+func (s *Server) Publish(frame cpmsocpp.Frame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, frames := range s.taps[frame.ChargePointID] {
+		select {
+		case frames <- frame:
+		default:
+		}
+	}
+}
+
+// LiveReadings returns the live readings set for a charge point
+func (s *Server) LiveReadings(chargePointID string) []*models.LiveConnector {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*models.LiveConnector{}, s.live[chargePointID]...)
+}
+
+// SetLiveReadings sets the live readings of a charge point
+func (s *Server) SetLiveReadings(chargePointID string, connectors []*models.LiveConnector) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.live[chargePointID] = connectors
+}
+
+// InvalidateIdTagAuthorization records the invalidated idTag
+func (s *Server) InvalidateIdTagAuthorization(idTag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.invalidated = append(s.invalidated, "idTag:"+idTag)
+}
+
+// InvalidateChargePointAuthorization records the invalidated charge point
+func (s *Server) InvalidateChargePointAuthorization(chargePointID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.invalidated = append(s.invalidated, "chargePoint:"+chargePointID)
+}
+
+// ForgetTransaction records the forgotten transaction
+func (s *Server) ForgetTransaction(chargePointID string, transactionID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forgotten = append(s.forgotten, transactionID)
+}
+
+// Forgotten returns the IDs of the forgotten transactions, in order
+func (s *Server) Forgotten() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.forgotten...)
+}
+
+// Invalidated returns the invalidated authorization results, in order, as "idTag:<idTag>" or "chargePoint:<id>"
+func (s *Server) Invalidated() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.invalidated...)
+}
@@ -0,0 +1,46 @@
+package ocpp
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/sirupsen/logrus"
+)
+
+// startedOffline reports whether a transaction was started while the charge point was offline,
+// judged by how far its start lies in the past when the CPMS receives it
+func (cs *CentralSystem) startedOffline(tx *models.Transaction) bool {
+	return !cs.replaying && time.Since(tx.StartTime) > time.Duration(cs.config.OfflineTransactionThreshold)*time.Second
+}
+
+// authorizeOfflineTransaction marks a transaction started while the charge point was offline as offline-authorized
+// and returns the authorization of its idTag. The vehicle has been charging already, so unknown idTags are handled
+// by the unknown idTag policy: accepted, accepted with the transaction flagged for billing review, or rejected.
+func (cs *CentralSystem) authorizeOfflineTransaction(ctx context.Context, tx *models.Transaction) *types.IdTagInfo {
+	tx.OfflineAuthorized = true
+
+	idTagInfo := cs.authorizeRequest(ctx, core.StartTransactionFeatureName, tx.ChargePointID, tx.ConnectorID, tx.IdTag)
+	if idTagInfo.Status != types.AuthorizationStatusInvalid {
+		return idTagInfo
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"chargePointID": tx.ChargePointID,
+		"idTag":         tx.IdTag,
+		"startTime":     tx.StartTime,
+		"policy":        cs.config.OfflineUnknownIdTagPolicy,
+	}).Warn("Transaction started offline with an unknown idTag")
+
+	switch cs.config.OfflineUnknownIdTagPolicy {
+	case "accept":
+		return types.NewIdTagInfo(types.AuthorizationStatusAccepted)
+	case "review":
+		tx.BillingReview = true
+		return types.NewIdTagInfo(types.AuthorizationStatusAccepted)
+	default:
+		return idTagInfo
+	}
+}
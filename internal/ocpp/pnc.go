@@ -0,0 +1,168 @@
+package ocpp
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/pnc"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/sirupsen/logrus"
+)
+
+// pncVendorID is the vendorId of the DataTransfer requests carrying the ISO 15118 Plug & Charge messages of
+// OCPP 2.0.1 over OCPP 1.6, as described by the Open Charge Alliance
+const pncVendorID = "org.openchargealliance.iso15118pnc"
+
+// pncAuthorizeRequest is the Authorize request of a vehicle with a contract certificate.
+// Charge points that verified the certificate themselves send its hash data instead of the certificate.
+type pncAuthorizeRequest struct {
+	IdToken struct {
+		IdToken string `json:"idToken"`
+		Type    string `json:"type"`
+	} `json:"idToken"`
+	Certificate                 string            `json:"certificate,omitempty"`
+	ISO15118CertificateHashData []json.RawMessage `json:"iso15118CertificateHashData,omitempty"`
+}
+
+// pncIdTokenInfo is the authorization status of an eMAID
+type pncIdTokenInfo struct {
+	Status              string          `json:"status"`
+	CacheExpiryDateTime *types.DateTime `json:"cacheExpiryDateTime,omitempty"`
+}
+
+// pncAuthorizeResponse answers an Authorize request of a vehicle
+type pncAuthorizeResponse struct {
+	IdTokenInfo       pncIdTokenInfo `json:"idTokenInfo"`
+	CertificateStatus string         `json:"certificateStatus,omitempty"`
+}
+
+// pncGetEVCertificateRequest asks for the installation or update of the contract certificate of a vehicle
+type pncGetEVCertificateRequest struct {
+	ISO15118SchemaVersion string `json:"iso15118SchemaVersion"`
+	Action                string `json:"action"`
+	EXIRequest            string `json:"exiRequest"`
+}
+
+// pncGetEVCertificateResponse answers a Get15118EVCertificate request
+type pncGetEVCertificateResponse struct {
+	Status      string `json:"status"`
+	EXIResponse string `json:"exiResponse"`
+}
+
+// handlePnCDataTransfer answers the Plug & Charge messages of a charge point
+func (cs *CentralSystem) handlePnCDataTransfer(chargePointID string, request *core.DataTransferRequest) *core.DataTransferConfirmation {
+	var response interface{}
+	var err error
+	switch request.MessageId {
+	case "Authorize":
+		var req pncAuthorizeRequest
+		if err = unmarshalDataTransfer(request.Data, &req); err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			response = cs.authorizeContract(ctx, chargePointID, req)
+			cancel()
+		}
+	case "Get15118EVCertificate":
+		var req pncGetEVCertificateRequest
+		if err = unmarshalDataTransfer(request.Data, &req); err == nil {
+			response = cs.getEVCertificate(chargePointID, req)
+		}
+	default:
+		return core.NewDataTransferConfirmation(core.DataTransferStatusUnknownMessageId)
+	}
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"messageId":     request.MessageId,
+		}).Warn("Invalid Plug & Charge request")
+		return core.NewDataTransferConfirmation(core.DataTransferStatusRejected)
+	}
+
+	// The data of the response is a JSON string, like the data of the request
+	data, err := json.Marshal(response)
+	if err != nil {
+		return core.NewDataTransferConfirmation(core.DataTransferStatusRejected)
+	}
+	conf := core.NewDataTransferConfirmation(core.DataTransferStatusAccepted)
+	conf.Data = string(data)
+	return conf
+}
+
+// authorizeContract authorizes the eMAID of a vehicle's contract like an idTag, after verifying the contract
+// certificate if roots are configured. Accepted eMAIDs open a pending session, as idTags accepted by Authorize do.
+func (cs *CentralSystem) authorizeContract(ctx context.Context, chargePointID string, request pncAuthorizeRequest) pncAuthorizeResponse {
+	emaid := request.IdToken.IdToken
+	log := logrus.WithFields(logrus.Fields{
+		"chargePointID": chargePointID,
+		"emaid":         emaid,
+	})
+
+	var response pncAuthorizeResponse
+	if request.Certificate != "" && cs.pncVerifier != nil {
+		response.CertificateStatus = cs.pncVerifier.VerifyContract(request.Certificate, emaid, time.Now())
+		if response.CertificateStatus != pnc.CertificateAccepted {
+			log.WithField("certificateStatus", response.CertificateStatus).Warn("Contract certificate rejected")
+			response.IdTokenInfo.Status = string(types.AuthorizationStatusInvalid)
+			cs.reportRejectedIdTag(chargePointID, emaid, types.NewIdTagInfo(types.AuthorizationStatusInvalid))
+			return response
+		}
+	}
+
+	// eMAIDs start transactions as idTags, which are at most 20 characters long
+	if emaid == "" || len(emaid) > 20 {
+		response.IdTokenInfo.Status = string(types.AuthorizationStatusInvalid)
+		return response
+	}
+
+	idTagInfo := cs.authorizeRequest(ctx, core.AuthorizeFeatureName, chargePointID, 0, emaid)
+	response.IdTokenInfo = pncIdTokenInfo{
+		Status:              string(idTagInfo.Status),
+		CacheExpiryDateTime: idTagInfo.ExpiryDate,
+	}
+
+	if idTagInfo.Status == types.AuthorizationStatusAccepted {
+		if _, err := cs.db.OpenPendingSession(ctx, chargePointID, emaid, db.NewSessionID(), false); err != nil {
+			log.WithError(err).Error("Failed to open pending session")
+		}
+	}
+
+	log.WithField("status", idTagInfo.Status).Info("Contract authorized")
+	return response
+}
+
+// getEVCertificate forwards a vehicle's request for a contract certificate to the certificate provider,
+// waiting for it up to the certificate provider timeout
+func (cs *CentralSystem) getEVCertificate(chargePointID string, request pncGetEVCertificateRequest) pncGetEVCertificateResponse {
+	failed := pncGetEVCertificateResponse{Status: "Failed"}
+	if cs.pncClient == nil {
+		return failed
+	}
+
+	result, err := cs.pncClient.GetEVCertificate(context.Background(), pnc.CertificateRequest{
+		ChargePointID:         chargePointID,
+		ISO15118SchemaVersion: request.ISO15118SchemaVersion,
+		Action:                request.Action,
+		EXIRequest:            request.EXIRequest,
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to get contract certificate")
+		return failed
+	}
+
+	return pncGetEVCertificateResponse{Status: result.Status, EXIResponse: result.EXIResponse}
+}
+
+// unmarshalDataTransfer decodes the data of a DataTransfer request, a JSON object or a string holding one
+func unmarshalDataTransfer(data interface{}, v interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		raw = []byte(text)
+	}
+	return json.Unmarshal(raw, v)
+}
@@ -0,0 +1,74 @@
+package ocpp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/sirupsen/logrus"
+)
+
+// quarantineFrame stores an inbound frame the OCPP-J layer failed to parse or validate. The layer has answered
+// it with a CallError already when its message ID could be read, as OCPP-J requires.
+func (cs *CentralSystem) quarantineFrame(chargePointID string, data []byte, err error) {
+	action := ""
+	var frame []json.RawMessage
+	if json.Unmarshal(data, &frame) == nil && len(frame) > 2 {
+		// Only calls, [2, messageId, action, payload], carry their action
+		var messageType int
+		if json.Unmarshal(frame[0], &messageType) == nil && messageType == 2 {
+			_ = json.Unmarshal(frame[2], &action)
+		}
+	}
+
+	cs.quarantine(chargePointID, action, string(data), err)
+}
+
+// quarantineSampledValue stores a request carrying a sampled value that isn't a number though its format is Raw.
+// The value is left out of the meter values, rather than recorded as 0, and the rest of the request is handled.
+// Signed meter data isn't a number and is skipped without quarantining the request.
+func (cs *CentralSystem) quarantineSampledValue(chargePointID, action string, request interface{}, sampledValue types.SampledValue, err error) {
+	fields := logrus.Fields{
+		"chargePointID": chargePointID,
+		"measurand":     sampledValue.Measurand,
+		"format":        sampledValue.Format,
+	}
+	if sampledValue.Format == types.ValueFormatSignedData {
+		logrus.WithError(err).WithFields(fields).Debug("Skipping a sampled value with signed meter data")
+		return
+	}
+	if cs.replaying {
+		return
+	}
+
+	payload, marshalErr := json.Marshal(request)
+	if marshalErr != nil {
+		payload = []byte("{}")
+	}
+	cs.quarantine(chargePointID, action, string(payload), fmt.Errorf("sampled value %q of %s is not a number: %w", sampledValue.Value, sampledValue.Measurand, err))
+}
+
+// quarantine stores a message that failed parsing or validation for review, with its personal data redacted
+func (cs *CentralSystem) quarantine(chargePointID, action, payload string, err error) {
+	logrus.WithError(err).WithFields(logrus.Fields{
+		"chargePointID": chargePointID,
+		"action":        action,
+	}).Warn("Quarantined a malformed OCPP message")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msg := &models.QuarantinedMessage{
+		ChargePointID: chargePointID,
+		Action:        action,
+		Payload:       string(cs.logger.redactRaw(chargePointID, []byte(payload))),
+		Error:         err.Error(),
+		ReceivedAt:    time.Now(),
+	}
+	if err := cs.db.QuarantineMessage(ctx, msg); err != nil {
+		logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to quarantine a malformed OCPP message")
+	}
+}
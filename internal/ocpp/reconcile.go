@@ -0,0 +1,126 @@
+package ocpp
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/remotetrigger"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// reconcileDelay is how long after a boot notification the open transactions of a charge point are reconciled,
+	// giving it time to send the StopTransaction requests it queued while rebooting
+	reconcileDelay = 30 * time.Second
+	// reconcileStatusWait is how long the connector statuses triggered for reconciliation are waited for
+	reconcileStatusWait = 10 * time.Second
+	// StopReasonReconciled is the stop reason of transactions closed because the charge point lost them while rebooting
+	StopReasonReconciled = "Reboot"
+)
+
+// idleStatuses are the connector statuses in which a connector has no transaction
+var idleStatuses = map[string]bool{
+	string(core.ChargePointStatusAvailable):   true,
+	string(core.ChargePointStatusPreparing):   true,
+	string(core.ChargePointStatusFinishing):   true,
+	string(core.ChargePointStatusUnavailable): true,
+}
+
+// reconcileTransactions closes the transactions a charge point still had in progress when it booted but no longer has.
+// It asks the charge point for the status of their connectors, and completes the transactions of connectors reporting
+// an idle status at their latest energy reading, flagged for billing review. Transactions of connectors whose status
+// is unknown or still in a session are left open.
+func (cs *CentralSystem) reconcileTransactions(chargePointID string, bootTime time.Time) {
+	time.Sleep(reconcileDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	log := logrus.WithField("chargePointID", chargePointID)
+
+	open, _, err := cs.db.GetTransactions(ctx, db.TransactionFilter{ChargePointID: chargePointID, Status: "InProgress"}, db.Sort{}, db.Page{})
+	if err != nil {
+		log.WithError(err).Error("Failed to get open transactions for reconciliation")
+		return
+	}
+
+	// Transactions started after the boot are known to the charge point
+	var stale []int
+	connectors := make(map[int]bool)
+	for _, tx := range open {
+		if tx.StartTime.Before(bootTime) {
+			stale = append(stale, tx.ID)
+			connectors[tx.ConnectorID] = true
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+
+	log.WithField("transactions", stale).Info("Reconciling transactions open before boot")
+
+	for connectorID := range connectors {
+		request := remotetrigger.NewTriggerMessageRequest(core.StatusNotificationFeatureName)
+		request.ConnectorId = &connectorID
+		if _, err := cs.SendRequest(ctx, chargePointID, request); err != nil {
+			log.WithError(err).WithField("connectorId", connectorID).Warn("Failed to trigger status notification for reconciliation")
+		}
+	}
+	time.Sleep(reconcileStatusWait)
+
+	statuses, _, err := cs.db.GetConnectors(ctx, chargePointID, db.Page{})
+	if err != nil {
+		log.WithError(err).Error("Failed to get connector statuses for reconciliation")
+		return
+	}
+	idle := make(map[int]bool)
+	for _, c := range statuses {
+		idle[c.ID] = c.UpdatedAt.After(bootTime) && idleStatuses[c.Status]
+	}
+
+	latest, err := cs.db.GetLatestMeterValues(ctx, stale, "Energy.Active.Import.Register")
+	if err != nil {
+		log.WithError(err).Error("Failed to get meter values for reconciliation")
+		return
+	}
+
+	for _, tx := range open {
+		if !tx.StartTime.Before(bootTime) || !idle[tx.ConnectorID] {
+			continue
+		}
+
+		endTime, meterStop := tx.StartTime, tx.MeterStart
+		if mv, ok := latest[tx.ID]; ok {
+			endTime, meterStop = mv.Timestamp, int(mv.EnergyWh())
+		}
+
+		closed, err := cs.db.ReconcileTransaction(ctx, tx.ID, endTime, meterStop, StopReasonReconciled)
+		if err != nil {
+			log.WithError(err).WithField("transactionId", tx.ID).Error("Failed to reconcile transaction")
+			continue
+		}
+		if !closed {
+			continue
+		}
+		cs.ForgetTransaction(chargePointID, tx.ID)
+
+		log.WithFields(logrus.Fields{
+			"transactionId": tx.ID,
+			"connectorId":   tx.ConnectorID,
+		}).Warn("Closed transaction lost by the charge point, flagged for billing review")
+
+		cs.events.PublishSession(events.TransactionReconciled, chargePointID, tx.SessionID, map[string]interface{}{
+			"transactionId": tx.ID,
+			"connectorId":   tx.ConnectorID,
+			"idTag":         tx.IdTag,
+			"startTime":     tx.StartTime,
+			"endTime":       endTime,
+			"meterStart":    tx.MeterStart,
+			"meterStop":     meterStop,
+			"bootTime":      bootTime,
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package ocpp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// personalDataFields are masked in every logged payload, they identify drivers
+var personalDataFields = []string{"idTag", "parentIdTag"}
+
+// payloadRedactor masks personal data in the OCPP payloads the logger stores and forwards
+type payloadRedactor struct {
+	fields      map[string]bool // Lowercase JSON field names whose values are masked
+	fullLogging map[string]bool // Charge points whose payloads are logged unredacted
+	fullLogAll  bool
+	textFields  *regexp.Regexp // Matches "field": "value" pairs of the fields in payloads that aren't valid JSON
+}
+
+// newPayloadRedactor creates a redactor masking the idTags and the extra fields of every payload, except those of
+// the charge points logged in full. A "*" charge point logs every payload in full, for debugging.
+func newPayloadRedactor(extraFields, fullLogChargePoints []string) *payloadRedactor {
+	r := &payloadRedactor{
+		fields:      make(map[string]bool),
+		fullLogging: make(map[string]bool),
+	}
+	var names []string
+	for _, field := range append(append([]string{}, personalDataFields...), extraFields...) {
+		r.fields[strings.ToLower(field)] = true
+		names = append(names, regexp.QuoteMeta(field))
+	}
+	r.textFields = regexp.MustCompile(`(?i)("(?:` + strings.Join(names, "|") + `)"\s*:\s*)"((?:[^"\\]|\\.)*)"`)
+	for _, id := range fullLogChargePoints {
+		if id == "*" {
+			r.fullLogAll = true
+		}
+		r.fullLogging[id] = true
+	}
+	return r
+}
+
+// redact returns the payload of a charge point's message with the configured fields masked
+func (r *payloadRedactor) redact(chargePointID string, payload []byte) []byte {
+	if r == nil || r.fullLogAll || r.fullLogging[chargePointID] {
+		return payload
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil || !r.redactValue(v) {
+		return payload
+	}
+
+	redactedPayload, err := json.Marshal(v)
+	if err != nil {
+		return []byte("{}")
+	}
+	return redactedPayload
+}
+
+// redactText masks the configured fields of a payload that isn't valid JSON, such as a malformed frame,
+// wherever they appear as "field": "value" pairs
+func (r *payloadRedactor) redactText(chargePointID string, payload []byte) []byte {
+	if r == nil || r.fullLogAll || r.fullLogging[chargePointID] {
+		return payload
+	}
+
+	return r.textFields.ReplaceAllFunc(payload, func(match []byte) []byte {
+		pair := r.textFields.FindSubmatch(match)
+		value, err := strconv.Unquote(`"` + string(pair[2]) + `"`)
+		if err != nil {
+			value = string(pair[2])
+		}
+		return append(append([]byte{}, pair[1]...), strconv.Quote(maskValue(value))...)
+	})
+}
+
+// redactValue masks the configured fields within a decoded JSON value and reports whether it changed it
+func (r *payloadRedactor) redactValue(v interface{}) bool {
+	changed := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for name, item := range v {
+			if r.fields[strings.ToLower(name)] && item != nil {
+				v[name] = maskValue(item)
+				changed = true
+				continue
+			}
+			if r.redactValue(item) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if r.redactValue(item) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// maskValue replaces a value with a short hash of it, so messages about the same idTag can still be correlated
+// without storing the idTag
+func maskValue(v interface{}) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return "redacted:" + hex.EncodeToString(sum[:4])
+}
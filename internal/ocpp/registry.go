@@ -0,0 +1,157 @@
+package ocpp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/firmware"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/localauth"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/remotetrigger"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/reservation"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/smartcharging"
+	types201 "github.com/lorenzodonini/ocpp-go/ocpp2.0.1/types"
+	"github.com/sirupsen/logrus"
+)
+
+// profiles are the OCPP 1.6 profiles forwarded requests are parsed with
+var profiles = []*ocpp.Profile{
+	core.Profile,
+	firmware.Profile,
+	localauth.Profile,
+	remotetrigger.Profile,
+	reservation.Profile,
+	smartcharging.Profile,
+}
+
+// IsLocal reports whether a charge point's websocket is held by this instance
+func (cs *CentralSystem) IsLocal(chargePointID string) bool {
+	_, ok := cs.connections.Load(chargePointID)
+	return ok
+}
+
+// LocalChargePoints returns the IDs of the charge points connected to this instance
+func (cs *CentralSystem) LocalChargePoints() []string {
+	var ids []string
+	cs.connections.Range(func(key, _ interface{}) bool {
+		ids = append(ids, key.(string))
+		return true
+	})
+	return ids
+}
+
+// connectionCount returns the number of charge points connected to this instance
+func (cs *CentralSystem) connectionCount() int {
+	count := 0
+	cs.connections.Range(func(_, _ interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// registerConnection records in the shared registry that this instance holds a charge point's websocket
+func (cs *CentralSystem) registerConnection(ctx context.Context, chargePointID string) {
+	cs.connections.Store(chargePointID, struct{}{})
+
+	if err := cs.db.RegisterConnection(ctx, chargePointID, cs.config.InstanceID, cs.config.InstanceURL); err != nil {
+		logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to register charge point connection")
+	}
+}
+
+// unregisterConnection removes this instance's registration of a charge point's websocket
+func (cs *CentralSystem) unregisterConnection(ctx context.Context, chargePointID string) {
+	cs.connections.Delete(chargePointID)
+
+	if err := cs.db.UnregisterConnection(ctx, chargePointID, cs.config.InstanceID); err != nil {
+		logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to unregister charge point connection")
+	}
+}
+
+// clearConnections removes registrations left behind by a previous run of this instance
+func (cs *CentralSystem) clearConnections() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := cs.db.ClearConnections(ctx, cs.config.InstanceID); err != nil {
+		logrus.WithError(err).WithField("instanceID", cs.config.InstanceID).Error("Failed to clear stale charge point connections")
+	}
+}
+
+// ParseRequest decodes the JSON payload of an OCPP 1.6 request
+func ParseRequest(action string, payload json.RawMessage) (ocpp.Request, error) {
+	for _, profile := range profiles {
+		feature := profile.GetFeature(action)
+		if feature == nil {
+			continue
+		}
+
+		request, ok := reflect.New(feature.GetRequestType()).Interface().(ocpp.Request)
+		if !ok {
+			return nil, fmt.Errorf("unsupported action: %s", action)
+		}
+		if err := json.Unmarshal(payload, request); err != nil {
+			return nil, fmt.Errorf("invalid %s payload: %w", action, err)
+		}
+		return request, nil
+	}
+
+	return nil, fmt.Errorf("unsupported action: %s", action)
+}
+
+// SendRequestAsync sends a request to a charge point connected to this instance.
+// The callback receives the confirmation or the error of the request.
+func (cs *CentralSystem) SendRequestAsync(chargePointID string, request ocpp.Request, callback func(ocpp.Response, error)) error {
+	return cs.SendCommandAsync(chargePointID, "", request, callback)
+}
+
+// SendCommandAsync sends a request to a charge point connected to this instance on behalf of an API request.
+// The request and its confirmation or error are logged with the ID of the API request, if any.
+// Commands are OCPP 1.6 requests, charging stations connected with OCPP 2.0.1 cannot be sent any.
+func (cs *CentralSystem) SendCommandAsync(chargePointID, apiRequestID string, request ocpp.Request, callback func(ocpp.Response, error)) error {
+	action := request.GetFeatureName()
+	if subprotocol := cs.frames.connectedSubprotocol(chargePointID); subprotocol == types201.V201Subprotocol {
+		return fmt.Errorf("%s is not supported for charge points connected with %s", action, subprotocol)
+	}
+	err := cs.OcppServer.SendRequestAsync(chargePointID, request, func(confirmation ocpp.Response, err error) {
+		cs.logger.LogConfirmation(chargePointID, action, apiRequestID, confirmation, err)
+		callback(confirmation, err)
+	})
+	if err != nil {
+		return err
+	}
+	cs.logger.LogCommand(chargePointID, "Request", action, apiRequestID, request)
+	return nil
+}
+
+// SendRequest sends a request to a charge point connected to this instance and waits for its confirmation
+func (cs *CentralSystem) SendRequest(ctx context.Context, chargePointID string, request ocpp.Request) (ocpp.Response, error) {
+	return cs.SendCommand(ctx, chargePointID, "", request)
+}
+
+// SendCommand sends a request like SendCommandAsync and waits for its confirmation
+func (cs *CentralSystem) SendCommand(ctx context.Context, chargePointID, apiRequestID string, request ocpp.Request) (ocpp.Response, error) {
+	type result struct {
+		confirmation ocpp.Response
+		err          error
+	}
+	done := make(chan result, 1)
+
+	err := cs.SendCommandAsync(chargePointID, apiRequestID, request, func(confirmation ocpp.Response, err error) {
+		done <- result{confirmation, err}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case res := <-done:
+		return res.confirmation, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,204 @@
+package ocpp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/balu-dk/go-cpms/internal/ratelimit"
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/firmware"
+)
+
+// ReplayResult is the outcome of passing a logged message through the handlers again
+type ReplayResult struct {
+	MessageID     int             `json:"messageId"`
+	ChargePointID string          `json:"chargePointId"`
+	Action        string          `json:"action"`
+	Timestamp     time.Time       `json:"timestamp"` // When the message was originally received
+	Confirmation  json.RawMessage `json:"confirmation,omitempty"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// Replay passes logged inbound requests through the OCPP handlers again, in order, to reproduce bugs
+// or backfill data after handler fixes. In dry-run mode the handlers read from the store but their
+// writes are discarded. Replays are not logged as OCPP messages, publish no events, are not rate limited
+// and never send commands to charge points, so session caps are not enforced.
+// The handlers stamp records with the time of the replay, and replayed StartTransaction requests
+// start new transactions.
+func (cs *CentralSystem) Replay(messages []*models.OCPPMessage, dryRun bool) []ReplayResult {
+	store := cs.db
+	if dryRun {
+		store = readOnlyStore{cs.db}
+	}
+
+	replayer := &CentralSystem{
+		db:             store,
+		config:         cs.config,
+		tariff:         cs.tariff,
+		events:         events.NewBus(),
+		messageLimiter: ratelimit.New(0, 0),
+		replaying:      true,
+	}
+	replayer.heartbeatInterval.Store(int64(cs.HeartbeatInterval()))
+	handler := &CentralSystemHandler{cs: replayer}
+
+	results := make([]ReplayResult, 0, len(messages))
+	for _, msg := range messages {
+		result := ReplayResult{
+			MessageID:     msg.ID,
+			ChargePointID: msg.ChargePointID,
+			Action:        msg.Action,
+			Timestamp:     msg.Timestamp,
+		}
+
+		confirmation, err := handler.replay(msg)
+		if err == nil {
+			result.Confirmation, err = json.Marshal(confirmation)
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// replay passes a logged inbound request to its handler
+func (h *CentralSystemHandler) replay(msg *models.OCPPMessage) (ocpp.Response, error) {
+	if msg.MessageType != "Request" || msg.Direction != "Inbound" {
+		return nil, fmt.Errorf("only inbound requests can be replayed")
+	}
+
+	// The message log stores payloads as JSON strings holding the JSON of the message
+	payload := json.RawMessage(msg.Payload)
+	var encoded string
+	if err := json.Unmarshal(payload, &encoded); err == nil {
+		payload = json.RawMessage(encoded)
+	}
+
+	request, err := ParseRequest(msg.Action, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	switch request := request.(type) {
+	case *core.BootNotificationRequest:
+		return h.OnBootNotification(msg.ChargePointID, request)
+	case *core.HeartbeatRequest:
+		return h.OnHeartbeat(msg.ChargePointID, request)
+	case *core.StatusNotificationRequest:
+		return h.OnStatusNotification(msg.ChargePointID, request)
+	case *core.MeterValuesRequest:
+		return h.OnMeterValues(msg.ChargePointID, request)
+	case *core.StartTransactionRequest:
+		return h.OnStartTransaction(msg.ChargePointID, request)
+	case *core.StopTransactionRequest:
+		return h.OnStopTransaction(msg.ChargePointID, request)
+	case *core.AuthorizeRequest:
+		return h.OnAuthorize(msg.ChargePointID, request)
+	case *core.DataTransferRequest:
+		return h.OnDataTransfer(msg.ChargePointID, request)
+	case *firmware.DiagnosticsStatusNotificationRequest:
+		return h.OnDiagnosticsStatusNotification(msg.ChargePointID, request)
+	case *firmware.FirmwareStatusNotificationRequest:
+		return h.OnFirmwareStatusNotification(msg.ChargePointID, request)
+	default:
+		return nil, fmt.Errorf("%s is not handled by the central system", msg.Action)
+	}
+}
+
+// readOnlyStore discards the writes of the OCPP handlers for dry-run replays
+type readOnlyStore struct {
+	db.Store
+}
+
+func (readOnlyStore) SaveChargePoint(ctx context.Context, cp *models.ChargePoint) error {
+	return nil
+}
+
+func (readOnlyStore) UpdateChargePointConnection(ctx context.Context, id string, connected bool) error {
+	return nil
+}
+
+func (readOnlyStore) UpdateHeartbeat(ctx context.Context, id string) error {
+	return nil
+}
+
+func (readOnlyStore) SaveConnector(ctx context.Context, connector *models.Connector) error {
+	return nil
+}
+
+func (readOnlyStore) CreateConnectorStatusEvent(ctx context.Context, event *models.ConnectorStatusEvent) error {
+	return nil
+}
+
+func (readOnlyStore) CreateConnectionEvent(ctx context.Context, event *models.ConnectionEvent) error {
+	return nil
+}
+
+func (readOnlyStore) CloseConnectionEvent(ctx context.Context, chargePointID string, disconnectedAt time.Time) error {
+	return nil
+}
+
+func (readOnlyStore) StartTransaction(ctx context.Context, tx *models.Transaction) error {
+	return nil
+}
+
+func (readOnlyStore) StopTransaction(ctx context.Context, id int, endTime time.Time, meterStop int, reason string) error {
+	return nil
+}
+
+func (readOnlyStore) FlagAdjustedTimestamp(ctx context.Context, id int) error {
+	return nil
+}
+
+func (readOnlyStore) RecordTransactionSoC(ctx context.Context, id int, soc float64, end bool) error {
+	return nil
+}
+
+func (readOnlyStore) SetTransactionStopReason(ctx context.Context, id int, reason string) error {
+	return nil
+}
+
+func (readOnlyStore) OpenPendingSession(ctx context.Context, chargePointID, idTag, sessionID string, replace bool) (string, error) {
+	return sessionID, nil
+}
+
+// ClaimPendingSession leaves the pending session open, so the transaction gets a new session as if none was pending
+func (readOnlyStore) ClaimPendingSession(ctx context.Context, chargePointID, idTag string) (string, error) {
+	return "", nil
+}
+
+func (readOnlyStore) SaveMeterValue(ctx context.Context, mv *models.MeterValue) error {
+	return nil
+}
+
+func (readOnlyStore) SaveMeterValues(ctx context.Context, batch []*models.MeterValue) error {
+	return nil
+}
+
+func (readOnlyStore) LogOCPPMessage(ctx context.Context, msg *models.OCPPMessage) error {
+	return nil
+}
+
+func (readOnlyStore) UpdateFirmwareUpdate(ctx context.Context, fu *models.FirmwareUpdate) error {
+	return nil
+}
+
+func (readOnlyStore) SetChargePointTenant(ctx context.Context, chargePointID, tenantID string) error {
+	return nil
+}
+
+func (readOnlyStore) RegisterConnection(ctx context.Context, chargePointID, instanceID, instanceURL string) error {
+	return nil
+}
+
+func (readOnlyStore) UnregisterConnection(ctx context.Context, chargePointID, instanceID string) error {
+	return nil
+}
@@ -0,0 +1,103 @@
+package ocpp
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/sirupsen/logrus"
+)
+
+// connectorStatusChangedEvent is the data of a connector.status_changed event
+type connectorStatusChangedEvent struct {
+	ConnectorID     int       `json:"connectorId"`
+	PreviousStatus  string    `json:"previousStatus,omitempty"` // Empty for a connector reporting its status for the first time
+	Status          string    `json:"status"`
+	ErrorCode       string    `json:"errorCode"`
+	Info            string    `json:"info,omitempty"`
+	VendorID        string    `json:"vendorId,omitempty"`
+	VendorErrorCode string    `json:"vendorErrorCode,omitempty"`
+	Timestamp       time.Time `json:"timestamp,omitempty"` // Time of the status change reported by the charge point
+}
+
+// storedConnector returns the stored state of a connector, nil if it has none yet
+func (cs *CentralSystem) storedConnector(ctx context.Context, chargePointID string, connectorID int) *models.Connector {
+	connectors, _, err := cs.db.GetConnectors(ctx, chargePointID, db.Page{})
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"connectorId":   connectorID,
+		}).Error("Failed to get connector status")
+		return nil
+	}
+	for _, c := range connectors {
+		if c.ID == connectorID {
+			return c
+		}
+	}
+	return nil
+}
+
+// publishStatusChange publishes a connector.status_changed event when a status notification
+// reports another status than the connector had, like for parking systems and signage
+func (cs *CentralSystem) publishStatusChange(chargePointID, previousStatus string, request *core.StatusNotificationRequest) {
+	if string(request.Status) == previousStatus {
+		return
+	}
+
+	event := connectorStatusChangedEvent{
+		ConnectorID:     request.ConnectorId,
+		PreviousStatus:  previousStatus,
+		Status:          string(request.Status),
+		ErrorCode:       string(request.ErrorCode),
+		Info:            request.Info,
+		VendorID:        request.VendorId,
+		VendorErrorCode: request.VendorErrorCode,
+	}
+	if request.Timestamp != nil {
+		event.Timestamp = request.Timestamp.Time
+	}
+	cs.events.Publish(events.ConnectorStatusChanged, chargePointID, event)
+}
+
+// recordStatusEvent stores a status notification in the connector's history and raises
+// an alert with the charger-reported error details when it reports an error
+func (cs *CentralSystem) recordStatusEvent(ctx context.Context, chargePointID string, request *core.StatusNotificationRequest) {
+	event := &models.ConnectorStatusEvent{
+		ChargePointID:   chargePointID,
+		ConnectorID:     request.ConnectorId,
+		Status:          string(request.Status),
+		ErrorCode:       string(request.ErrorCode),
+		Info:            request.Info,
+		VendorID:        request.VendorId,
+		VendorErrorCode: request.VendorErrorCode,
+	}
+	if request.Timestamp != nil {
+		event.Timestamp, event.TimestampAdjusted = cs.normalizeTimestamp(chargePointID, "StatusNotification", request.Timestamp.Time, time.Now())
+	}
+
+	if err := cs.db.CreateConnectorStatusEvent(ctx, event); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"connectorId":   request.ConnectorId,
+		}).Error("Failed to record connector status event")
+	}
+
+	if request.ErrorCode == core.NoError {
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"chargePointID":   chargePointID,
+		"connectorId":     request.ConnectorId,
+		"errorCode":       request.ErrorCode,
+		"info":            request.Info,
+		"vendorId":        request.VendorId,
+		"vendorErrorCode": request.VendorErrorCode,
+	}).Warn("Connector reported an error")
+
+	cs.events.Publish(events.ConnectorFault, chargePointID, event)
+}
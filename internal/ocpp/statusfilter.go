@@ -0,0 +1,125 @@
+package ocpp
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/sirupsen/logrus"
+)
+
+// connectorKey identifies a connector of a charge point
+type connectorKey struct {
+	chargePointID string
+	connectorID   int
+}
+
+// pendingStatus is a status notification held back until the connector stops flapping
+type pendingStatus struct {
+	timer   *time.Timer
+	request *core.StatusNotificationRequest
+}
+
+// sameStatus reports whether a status notification repeats the stored status of its connector
+func sameStatus(stored *models.Connector, request *core.StatusNotificationRequest) bool {
+	return stored.Status == string(request.Status) &&
+		stored.ErrorCode == string(request.ErrorCode) &&
+		stored.Info == request.Info &&
+		stored.VendorID == request.VendorId &&
+		stored.VendorErrorCode == request.VendorErrorCode
+}
+
+// isFlap reports whether a status change is one between Available and Preparing, which chargers
+// may report back and forth while a driver fumbles with the cable
+func isFlap(from, to string) bool {
+	available, preparing := string(core.ChargePointStatusAvailable), string(core.ChargePointStatusPreparing)
+	return (from == available && to == preparing) || (from == preparing && to == available)
+}
+
+// handleStatus persists and publishes a status notification. A notification repeating the stored status is skipped
+// if deduplication is enabled, only refreshing when the connector was last heard from, and a change between
+// Available and Preparing is held back for the debounce period, in which a later notification for the connector
+// supersedes it.
+func (cs *CentralSystem) handleStatus(ctx context.Context, chargePointID string, request *core.StatusNotificationRequest) {
+	key := connectorKey{chargePointID: chargePointID, connectorID: request.ConnectorId}
+	if value, ok := cs.statusChanges.LoadAndDelete(key); ok {
+		value.(*pendingStatus).timer.Stop()
+	}
+
+	stored := cs.storedConnector(ctx, chargePointID, request.ConnectorId)
+	if cs.config.StatusDedup && stored != nil && sameStatus(stored, request) {
+		logrus.WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"connectorId":   request.ConnectorId,
+			"status":        request.Status,
+		}).Debug("Skipping a repeated status notification")
+		cs.touchConnector(ctx, chargePointID, request.ConnectorId)
+		return
+	}
+
+	if cs.config.StatusDebounce > 0 && !cs.replaying && stored != nil && isFlap(stored.Status, string(request.Status)) {
+		pending := &pendingStatus{request: request}
+		pending.timer = time.AfterFunc(time.Duration(cs.config.StatusDebounce)*time.Second, func() {
+			cs.applyPendingStatus(key, pending)
+		})
+		cs.statusChanges.Store(key, pending)
+		return
+	}
+
+	cs.applyStatus(ctx, chargePointID, stored, request)
+}
+
+// applyPendingStatus persists a status notification that held for the debounce period
+func (cs *CentralSystem) applyPendingStatus(key connectorKey, pending *pendingStatus) {
+	if !cs.statusChanges.CompareAndDelete(key, pending) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stored := cs.storedConnector(ctx, key.chargePointID, key.connectorID)
+	if cs.config.StatusDedup && stored != nil && sameStatus(stored, pending.request) {
+		cs.touchConnector(ctx, key.chargePointID, key.connectorID)
+		return
+	}
+	cs.applyStatus(ctx, key.chargePointID, stored, pending.request)
+}
+
+// touchConnector refreshes the update time of a connector whose repeated status was skipped, so a status confirmed
+// after a reboot still counts as reported since the boot
+func (cs *CentralSystem) touchConnector(ctx context.Context, chargePointID string, connectorID int) {
+	if err := cs.db.TouchConnector(ctx, chargePointID, connectorID); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"connectorId":   connectorID,
+		}).Error("Failed to refresh connector status")
+	}
+}
+
+// applyStatus stores the status of a connector and its history, and publishes the status change
+func (cs *CentralSystem) applyStatus(ctx context.Context, chargePointID string, stored *models.Connector, request *core.StatusNotificationRequest) {
+	connector := &models.Connector{
+		ID:              request.ConnectorId,
+		ChargePointID:   chargePointID,
+		Status:          string(request.Status),
+		ErrorCode:       string(request.ErrorCode),
+		Info:            request.Info,
+		VendorID:        request.VendorId,
+		VendorErrorCode: request.VendorErrorCode,
+	}
+	if err := cs.db.SaveConnector(ctx, connector); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"connectorId":   request.ConnectorId,
+		}).Error("Failed to save connector status")
+	}
+
+	previousStatus := ""
+	if stored != nil {
+		previousStatus = stored.Status
+	}
+	cs.recordStatusEvent(ctx, chargePointID, request)
+	cs.publishStatusChange(chargePointID, previousStatus, request)
+}
@@ -0,0 +1,134 @@
+package ocpp
+
+import (
+	"net/http"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/gorilla/websocket"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/lorenzodonini/ocpp-go/ws"
+)
+
+// endpointHandlers are the handlers an OCPP-J endpoint registers on the websocket server
+type endpointHandlers struct {
+	message      func(ws.Channel, []byte) error
+	newClient    func(ws.Channel)
+	disconnected func(ws.Channel)
+}
+
+// protocolServer is the websocket server as seen by the OCPP-J endpoint of one subprotocol. The endpoints
+// share the central system's websocket server, which is started and stopped by the central system itself.
+type protocolServer struct {
+	*tapServer
+	subprotocol string
+}
+
+// forSubprotocol returns the websocket server for the OCPP-J endpoint of a subprotocol
+func (s *tapServer) forSubprotocol(subprotocol string) ws.WsServer {
+	s.endpoints[subprotocol] = &endpointHandlers{}
+	return &protocolServer{tapServer: s, subprotocol: subprotocol}
+}
+
+// SetMessageHandler sets the handler of the inbound frames of the subprotocol's connections
+func (s *protocolServer) SetMessageHandler(handler func(ws.Channel, []byte) error) {
+	s.endpoints[s.subprotocol].message = handler
+}
+
+// SetNewClientHandler sets the handler of the subprotocol's new connections
+func (s *protocolServer) SetNewClientHandler(handler func(ws.Channel)) {
+	s.endpoints[s.subprotocol].newClient = handler
+}
+
+// SetDisconnectedClientHandler sets the handler of the subprotocol's closed connections
+func (s *protocolServer) SetDisconnectedClientHandler(handler func(ws.Channel)) {
+	s.endpoints[s.subprotocol].disconnected = handler
+}
+
+// AddSupportedSubprotocol does nothing, the central system configures the subprotocols it accepts
+func (s *protocolServer) AddSupportedSubprotocol(subprotocol string) {}
+
+// Start returns right away, so the endpoint starts its dispatcher without starting the shared websocket server
+func (s *protocolServer) Start(port int, listenPath string) {}
+
+// Stop does nothing, the shared websocket server is stopped by the central system
+func (s *protocolServer) Stop() {}
+
+// endpoint returns the handlers of the endpoint a charge point's connection belongs to. A frame may be read
+// before the new connection is handled, so the subprotocol is resolved by whichever comes first.
+func (s *tapServer) endpoint(chargePointID string) *endpointHandlers {
+	subprotocol, ok := s.subprotocols.Load(chargePointID)
+	if !ok {
+		subprotocol, _ = s.subprotocols.LoadOrStore(chargePointID, s.negotiatedSubprotocol(chargePointID))
+	}
+	return s.endpoints[subprotocol.(string)]
+}
+
+// negotiatedSubprotocol returns the subprotocol negotiated for a new connection, OCPP 1.6 if it is unknown
+func (s *tapServer) negotiatedSubprotocol(chargePointID string) string {
+	if s.negotiated != nil {
+		if subprotocol := s.negotiated(chargePointID); s.endpoints[subprotocol] != nil {
+			return subprotocol
+		}
+	}
+	return types.V16Subprotocol
+}
+
+// handleNewClient hands a new connection to the endpoint of its subprotocol
+func (s *tapServer) handleNewClient(channel ws.Channel) {
+	s.subprotocols.Store(channel.ID(), s.negotiatedSubprotocol(channel.ID()))
+	s.upstream(channel.ID())
+	if endpoint := s.endpoint(channel.ID()); endpoint.newClient != nil {
+		endpoint.newClient(channel)
+	}
+}
+
+// handleDisconnectedClient hands a closed connection to the endpoint of its subprotocol
+func (s *tapServer) handleDisconnectedClient(channel ws.Channel) {
+	endpoint := s.endpoint(channel.ID())
+	s.subprotocols.Delete(channel.ID())
+	s.closeUpstream(channel.ID())
+	if endpoint.disconnected != nil {
+		endpoint.disconnected(channel)
+	}
+}
+
+// connectedSubprotocol returns the subprotocol of a charge point's connection to this instance, empty if it isn't connected
+func (s *tapServer) connectedSubprotocol(chargePointID string) string {
+	subprotocol, ok := s.subprotocols.Load(chargePointID)
+	if !ok {
+		return ""
+	}
+	return subprotocol.(string)
+}
+
+// subprotocols returns the configured subprotocols the websocket server accepts, OCPP 1.6 unless configured.
+// The OCPP 2.0.1 endpoint handles no transactions yet, so ocpp2.0.1 has to be configured explicitly.
+func (cs *CentralSystem) subprotocols() []string {
+	if len(cs.config.OCPPSubprotocols) == 0 {
+		return []string{types.V16Subprotocol}
+	}
+	return cs.config.OCPPSubprotocols
+}
+
+// negotiateSubprotocol returns the subprotocol the websocket server negotiates for a handshake: the first
+// one offered by the charge point that is accepted, empty if there is none
+func (cs *CentralSystem) negotiateSubprotocol(r *http.Request) string {
+	for _, offered := range websocket.Subprotocols(r) {
+		for _, accepted := range cs.subprotocols() {
+			if offered == accepted {
+				return offered
+			}
+		}
+	}
+	return ""
+}
+
+// pendingSubprotocol returns the subprotocol negotiated in the handshake of a charge point's new connection
+func (cs *CentralSystem) pendingSubprotocol(chargePointID string) string {
+	if pending, ok := cs.pendingConns.Load(chargePointID); ok {
+		if metadata, ok := pending.(*models.ConnectionEvent); ok {
+			return metadata.Subprotocol
+		}
+	}
+	return ""
+}
@@ -0,0 +1,251 @@
+package ocpp
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ws"
+)
+
+// tapBuffer is the number of frames buffered per tap. Frames are dropped for taps that fall further behind,
+// so a slow subscriber never holds up the charge point's connection.
+const tapBuffer = 256
+
+// redacted replaces credentials in tapped frames
+const redacted = "***"
+
+// Frame is a raw OCPP-J message exchanged with a charge point, with credentials redacted
+type Frame struct {
+	Timestamp     time.Time       `json:"timestamp"`
+	ChargePointID string          `json:"chargePointId"`
+	Direction     string          `json:"direction"` // Inbound or Outbound
+	Data          json.RawMessage `json:"data"`
+}
+
+// taps holds the subscribers to the frames of each charge point
+type taps struct {
+	mu   sync.RWMutex
+	subs map[string]map[chan Frame]struct{} // Charge point ID -> subscribers
+}
+
+// publish copies a frame to the taps of a charge point
+func (t *taps) publish(chargePointID, direction string, data []byte) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	subs := t.subs[chargePointID]
+	if len(subs) == 0 {
+		return
+	}
+
+	frame := Frame{
+		Timestamp:     time.Now(),
+		ChargePointID: chargePointID,
+		Direction:     direction,
+		Data:          redactFrame(data),
+	}
+	for sub := range subs {
+		select {
+		case sub <- frame:
+		default:
+		}
+	}
+}
+
+// tapServer is the websocket server of the central system, copying the frames it reads and writes to the taps.
+// Each connection is handed to the OCPP-J endpoint of the subprotocol negotiated in its handshake.
+type tapServer struct {
+	ws.WsServer
+	taps           *taps
+	maxMessageSize int // Bytes, charge points sending larger frames are disconnected once the frame is read, 0 disables the limit
+
+	endpoints    map[string]*endpointHandlers      // Subprotocol -> handlers of its OCPP-J endpoint
+	subprotocols sync.Map                          // Charge point ID -> subprotocol of its connection
+	negotiated   func(chargePointID string) string // Subprotocol negotiated in the handshake of a new connection
+
+	quarantine func(chargePointID string, data []byte, err error) // Stores frames that failed parsing or validation
+
+	upstreamMu      sync.Mutex                               // Serializes taking the upstream links opened in handshakes
+	upstreams       sync.Map                                 // Charge point ID -> *upstreamLink of its connection, nil without an upstream gateway
+	pendingUpstream func(chargePointID string) *upstreamLink // Upstream link opened in the handshake of a new connection
+}
+
+// newTapServer wraps a websocket server, taking over its connection and message handlers
+func newTapServer(server ws.WsServer, frameTaps *taps, maxMessageSize int) *tapServer {
+	s := &tapServer{
+		WsServer:       server,
+		taps:           frameTaps,
+		maxMessageSize: maxMessageSize,
+		endpoints:      make(map[string]*endpointHandlers),
+	}
+	server.SetNewClientHandler(s.handleNewClient)
+	server.SetDisconnectedClientHandler(s.handleDisconnectedClient)
+	server.SetMessageHandler(s.handleMessage)
+	return s
+}
+
+// handleMessage copies an inbound frame to the taps and passes it to the endpoint of its connection, and to the
+// upstream central system of a charge point with an upstream gateway. Frames the endpoint fails to parse or
+// validate are quarantined.
+func (s *tapServer) handleMessage(channel ws.Channel, data []byte) error {
+	s.taps.publish(channel.ID(), "Inbound", data)
+	if !s.checkMessageSize(channel.ID(), data) {
+		return nil
+	}
+	if link := s.upstream(channel.ID()); link != nil {
+		var handle bool
+		if data, handle = link.inbound(data); !handle {
+			return nil
+		}
+	}
+
+	endpoint := s.endpoint(channel.ID())
+	if endpoint.message == nil {
+		return nil
+	}
+	err := endpoint.message(channel, data)
+	if err != nil && s.quarantine != nil {
+		s.quarantine(channel.ID(), data, err)
+	}
+	return err
+}
+
+// Write sends a frame of the endpoint to a charge point. Responses to requests forwarded to an upstream central
+// system are held back, the charge point is sent the upstream's response.
+func (s *tapServer) Write(chargePointID string, data []byte) error {
+	if link := s.connectedUpstream(chargePointID); link != nil {
+		var send bool
+		if data, send = link.outbound(data); !send {
+			return nil
+		}
+	}
+	return s.send(chargePointID, data)
+}
+
+// send sends a frame to a charge point and copies it to the taps once sent
+func (s *tapServer) send(chargePointID string, data []byte) error {
+	if err := s.WsServer.Write(chargePointID, data); err != nil {
+		return err
+	}
+	s.taps.publish(chargePointID, "Outbound", data)
+	return nil
+}
+
+// Tap streams the frames exchanged with a charge point connected to this instance, including frames
+// of connections made after tapping, until stop is called. Credentials are redacted.
+func (cs *CentralSystem) Tap(chargePointID string) (<-chan Frame, func()) {
+	frames := make(chan Frame, tapBuffer)
+
+	cs.taps.mu.Lock()
+	if cs.taps.subs[chargePointID] == nil {
+		cs.taps.subs[chargePointID] = make(map[chan Frame]struct{})
+	}
+	cs.taps.subs[chargePointID][frames] = struct{}{}
+	cs.taps.mu.Unlock()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			cs.taps.mu.Lock()
+			defer cs.taps.mu.Unlock()
+
+			delete(cs.taps.subs[chargePointID], frames)
+			if len(cs.taps.subs[chargePointID]) == 0 {
+				delete(cs.taps.subs, chargePointID)
+			}
+			close(frames)
+		})
+	}
+	return frames, stop
+}
+
+// redactFrame masks the credentials in an OCPP-J frame: the values of configuration keys holding
+// passwords or keys, such as AuthorizationKey, and the passwords of URLs, such as firmware and
+// diagnostics locations. Frames without credentials are passed on unchanged.
+func redactFrame(data []byte) json.RawMessage {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var frame interface{}
+	if err := decoder.Decode(&frame); err != nil {
+		// Pass malformed frames on as a string, they are part of what engineers watch for
+		raw, _ := json.Marshal(string(data))
+		return raw
+	}
+	if !redactValue(frame) {
+		return json.RawMessage(data)
+	}
+
+	raw, err := json.Marshal(frame)
+	if err != nil {
+		raw, _ = json.Marshal(redacted)
+	}
+	return raw
+}
+
+// redactValue masks the credentials within a decoded JSON value and reports whether it changed it
+func redactValue(v interface{}) bool {
+	changed := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		// Configuration keys are {"key": ..., "value": ...} objects in ChangeConfiguration requests
+		// and GetConfiguration confirmations
+		if key, ok := v["key"].(string); ok && isSecretKey(key) {
+			if _, ok := v["value"]; ok {
+				v["value"] = redacted
+				changed = true
+			}
+		}
+		for name, item := range v {
+			if s, ok := item.(string); ok {
+				if masked, ok := redactURL(s); ok {
+					v[name] = masked
+					changed = true
+				}
+				continue
+			}
+			if redactValue(item) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if s, ok := item.(string); ok {
+				if masked, ok := redactURL(s); ok {
+					v[i] = masked
+					changed = true
+				}
+				continue
+			}
+			if redactValue(item) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// isSecretKey reports whether a configuration key holds a credential
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	return key == "authorizationkey" || strings.Contains(key, "password") || strings.Contains(key, "secret")
+}
+
+// redactURL masks the password of a URL, reporting false for other strings
+func redactURL(s string) (string, bool) {
+	if !strings.Contains(s, "://") || !strings.Contains(s, "@") {
+		return "", false
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return "", false
+	}
+	if _, hasPassword := u.User.Password(); !hasPassword {
+		return "", false
+	}
+	return u.Redacted(), true
+}
@@ -0,0 +1,142 @@
+package ocpp
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/clientip"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/siem"
+	"github.com/sirupsen/logrus"
+)
+
+// checkConnection validates a websocket handshake before it is upgraded.
+// Besides the default same-origin check, the connection limits, the address rules and the charge point's password,
+// it resolves the tenant of the charge point from the OCPP path or its ID prefix and rejects charge points connecting
+// on another tenant's endpoint.
+func (cs *CentralSystem) checkConnection(r *http.Request) bool {
+	if !sameOrigin(r) {
+		return false
+	}
+
+	chargePointID := path.Base(r.URL.Path)
+	remoteAddr := clientip.FromRequest(r, cs.config.TrustedProxies)
+
+	if !cs.admitConnection(chargePointID, remoteAddr) {
+		return false
+	}
+	metadata := cs.connectionMetadata(r, chargePointID, remoteAddr)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tenantID := cs.tenantForConnection(r.URL.Path, chargePointID)
+	if !cs.addressAllowed(ctx, chargePointID, tenantID, remoteAddr) {
+		return false
+	}
+	if !cs.credentialsValid(ctx, r, chargePointID, remoteAddr) {
+		return false
+	}
+	if tenantID == "" {
+		cs.pendingConns.Store(chargePointID, metadata)
+		return true
+	}
+
+	// A charge point already assigned to a tenant must keep using that tenant's endpoint
+	chargePoint, err := cs.db.GetChargePoint(ctx, chargePointID)
+	if err == nil && chargePoint.TenantID != "" {
+		if chargePoint.TenantID != tenantID {
+			logrus.WithFields(logrus.Fields{
+				"chargePointID": chargePointID,
+				"tenantID":      tenantID,
+				"ownerTenantID": chargePoint.TenantID,
+			}).Warn("Rejected charge point connecting on another tenant's endpoint")
+			cs.siem.Security("connection.rejected", siem.SeverityHigh, chargePointID, "Charge point connected on another tenant's endpoint", map[string]string{
+				"tenantId":      tenantID,
+				"ownerTenantId": chargePoint.TenantID,
+				"remoteAddr":    remoteAddr,
+			})
+			return false
+		}
+		cs.pendingConns.Store(chargePointID, metadata)
+		return true
+	}
+
+	tenant, err := cs.db.GetTenant(ctx, tenantID)
+	if err != nil || tenant == nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"tenantID":      tenantID,
+		}).Warn("Rejected charge point connecting for unknown tenant")
+		cs.siem.Security("connection.rejected", siem.SeverityHigh, chargePointID, "Charge point connected for an unknown tenant", map[string]string{
+			"tenantId":   tenantID,
+			"remoteAddr": remoteAddr,
+		})
+		return false
+	}
+
+	cs.pendingTenants.Store(chargePointID, tenantID)
+	cs.pendingConns.Store(chargePointID, metadata)
+	return true
+}
+
+// tenantForConnection returns the tenant named in the OCPP path or mapped from the charge point ID prefix
+func (cs *CentralSystem) tenantForConnection(urlPath, chargePointID string) string {
+	if cs.config.OCPPTenantFromPath {
+		if tenantID := path.Base(path.Dir(urlPath)); tenantID != "." && tenantID != "/" {
+			return tenantID
+		}
+	}
+
+	// The longest matching prefix wins
+	match := ""
+	for prefix := range cs.config.OCPPTenantPrefixes {
+		if strings.HasPrefix(chargePointID, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+
+	return cs.config.OCPPTenantPrefixes[match]
+}
+
+// assignPendingTenant assigns a newly connected charge point to the tenant resolved during its handshake
+func (cs *CentralSystem) assignPendingTenant(ctx context.Context, chargePoint *models.ChargePoint) {
+	value, ok := cs.pendingTenants.LoadAndDelete(chargePoint.ID)
+	if !ok || chargePoint.TenantID != "" {
+		return
+	}
+
+	tenantID := value.(string)
+	if err := cs.db.SetChargePointTenant(ctx, chargePoint.ID, tenantID); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"chargePointID": chargePoint.ID,
+			"tenantID":      tenantID,
+		}).Error("Failed to assign charge point to tenant")
+		return
+	}
+
+	chargePoint.TenantID = tenantID
+	cs.authCache.invalidateChargePoint(chargePoint.ID)
+	logrus.WithFields(logrus.Fields{
+		"chargePointID": chargePoint.ID,
+		"tenantID":      tenantID,
+	}).Info("Charge point assigned to tenant")
+}
+
+// sameOrigin mirrors the websocket upgrader's default origin check
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
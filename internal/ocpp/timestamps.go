@@ -0,0 +1,48 @@
+package ocpp
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// normalizeTimestamp applies the timestamp policy to a timestamp reported by a charge point in a message received
+// at receivedAt. Timestamps further before or after the receive time than the configured bounds are implausible,
+// typically from a charger whose clock was reset. Under the normalize policy they are replaced by the receive time,
+// and the second result reports that the record must be annotated as adjusted.
+func (cs *CentralSystem) normalizeTimestamp(chargePointID, action string, reported, receivedAt time.Time) (time.Time, bool) {
+	if cs.replaying || reported.IsZero() {
+		return reported, false
+	}
+
+	maxPast := time.Duration(cs.config.TimestampMaxPast) * time.Second
+	maxFuture := time.Duration(cs.config.TimestampMaxFuture) * time.Second
+	if !reported.Before(receivedAt.Add(-maxPast)) && !reported.After(receivedAt.Add(maxFuture)) {
+		return reported, false
+	}
+
+	log := logrus.WithFields(logrus.Fields{
+		"chargePointID": chargePointID,
+		"action":        action,
+		"timestamp":     reported,
+		"policy":        cs.config.TimestampPolicy,
+	})
+	if cs.config.TimestampPolicy != "normalize" {
+		log.Warn("Charge point reported an implausible timestamp")
+		return reported, false
+	}
+
+	log.Warn("Charge point reported an implausible timestamp, replacing it by the receive time")
+	return receivedAt, true
+}
+
+// flagAdjustedTimestamp marks a transaction whose stop or meter value timestamps were adjusted, which flags it for billing review
+func (cs *CentralSystem) flagAdjustedTimestamp(ctx context.Context, chargePointID string, transactionID int) {
+	if err := cs.db.FlagAdjustedTimestamp(ctx, transactionID); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"transactionId": transactionID,
+		}).Error("Failed to flag the adjusted timestamp of a transaction")
+	}
+}
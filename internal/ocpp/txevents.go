@@ -0,0 +1,102 @@
+package ocpp
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/sirupsen/logrus"
+)
+
+// transactionEvent is the data of the transaction.started, transaction.updated and transaction.stopped events.
+// Energy and cost are those of the transaction so far, priced with the configured tariff.
+type transactionEvent struct {
+	TransactionID int       `json:"transactionId"`
+	ConnectorID   int       `json:"connectorId"`
+	IdTag         string    `json:"idTag"`
+	StartTime     time.Time `json:"startTime"`
+	MeterStart    int       `json:"meterStart"`
+	EndTime       time.Time `json:"endTime,omitempty"`
+	MeterStop     int       `json:"meterStop,omitempty"`
+	StopReason    string    `json:"stopReason,omitempty"`
+	EnergyKWh     float64   `json:"energyKWh"`
+	Cost          float64   `json:"cost,omitempty"`
+	Currency      string    `json:"currency,omitempty"`
+}
+
+// newTransactionEvent returns the event data of a transaction without its energy and cost
+func newTransactionEvent(tx *models.Transaction) transactionEvent {
+	return transactionEvent{
+		TransactionID: tx.ID,
+		ConnectorID:   tx.ConnectorID,
+		IdTag:         tx.IdTag,
+		StartTime:     tx.StartTime,
+		MeterStart:    tx.MeterStart,
+		EndTime:       tx.EndTime,
+		MeterStop:     tx.MeterStop,
+		StopReason:    tx.StopReason,
+	}
+}
+
+// publishTransactionStarted publishes a transaction.started event for a transaction just started
+func (cs *CentralSystem) publishTransactionStarted(tx *models.Transaction) {
+	if cs.replaying {
+		return
+	}
+	cs.events.PublishSession(events.TransactionStarted, tx.ChargePointID, tx.SessionID, newTransactionEvent(tx))
+}
+
+// publishTransactionUpdated publishes a transaction.updated event with the energy and cost of a transaction
+// so far, at most once per configured update interval of the transaction
+func (cs *CentralSystem) publishTransactionUpdated(ctx context.Context, chargePointID string, transactionID int) {
+	if cs.replaying {
+		return
+	}
+
+	now := time.Now()
+	interval := time.Duration(cs.config.TransactionUpdateInterval) * time.Second
+	if last, ok := cs.txUpdates.Load(transactionID); ok && now.Sub(last.(time.Time)) < interval {
+		return
+	}
+	cs.txUpdates.Store(transactionID, now)
+
+	cs.publishTransaction(ctx, events.TransactionUpdated, chargePointID, transactionID)
+}
+
+// publishTransactionStopped publishes a transaction.stopped event with the final energy and cost of a transaction
+func (cs *CentralSystem) publishTransactionStopped(ctx context.Context, chargePointID string, transactionID int) {
+	if cs.replaying {
+		return
+	}
+	cs.txUpdates.Delete(transactionID)
+
+	cs.publishTransaction(ctx, events.TransactionStopped, chargePointID, transactionID)
+}
+
+// publishTransaction publishes a transaction event with the energy and cost of the transaction
+func (cs *CentralSystem) publishTransaction(ctx context.Context, eventType, chargePointID string, transactionID int) {
+	fields := logrus.Fields{
+		"chargePointID": chargePointID,
+		"transactionId": transactionID,
+		"eventType":     eventType,
+	}
+
+	tx, err := cs.db.GetTransaction(ctx, transactionID)
+	if err != nil {
+		logrus.WithError(err).WithFields(fields).Error("Failed to get transaction for event")
+		return
+	}
+	event := newTransactionEvent(tx)
+
+	cost, err := cs.tariff.SessionCost(ctx, tx)
+	if err != nil {
+		logrus.WithError(err).WithFields(fields).Error("Failed to calculate session cost for event")
+	} else {
+		event.EnergyKWh = cost.EnergyKWh
+		event.Cost = cost.Cost
+		event.Currency = cost.Currency
+	}
+
+	cs.events.PublishSession(eventType, chargePointID, tx.SessionID, event)
+}
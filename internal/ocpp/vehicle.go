@@ -0,0 +1,193 @@
+package ocpp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/sirupsen/logrus"
+)
+
+// vehicleIdentificationMessageID is the messageId of the DataTransfer requests the built-in parser reads
+const vehicleIdentificationMessageID = "VehicleIdentification"
+
+// vinPattern matches a vehicle identification number, which never contains I, O or Q
+var vinPattern = regexp.MustCompile(`^[A-HJ-NPR-Z0-9]{17}$`)
+
+// VehicleID identifies the vehicle charging at a connector, as reported by a charge point.
+// A zero TransactionID means the transaction in progress at the connector.
+type VehicleID struct {
+	ConnectorID   int
+	TransactionID int
+	MAC           string // MAC address of the vehicle's charging controller, e.g. the EVCCID of ISO 15118
+	VIN           string
+}
+
+// DataTransferVehicleParser reads a vehicle identifier from a vendor's DataTransfer request.
+// It reports false if the request does not identify a vehicle.
+type DataTransferVehicleParser func(request *core.DataTransferRequest) (VehicleID, bool)
+
+// SampledValueVehicleParser reads a vehicle identifier from a sampled value of a MeterValues request.
+// It reports false if the value does not identify a vehicle, which is then stored as a meter value.
+type SampledValueVehicleParser func(value types.SampledValue) (VehicleID, bool)
+
+var (
+	vehicleParsersMu          sync.RWMutex
+	dataTransferVehicleParser = map[string]DataTransferVehicleParser{}
+	sampledValueVehicleParser = []SampledValueVehicleParser{parseVehicleSampledValue}
+)
+
+// RegisterDataTransferVehicleParser reads the vehicle identifiers of the DataTransfer requests of a vendor with
+// parser instead of the built-in parser, which reads requests with messageId VehicleIdentification and a JSON
+// object with connectorId, transactionId, mac and vin as data
+func RegisterDataTransferVehicleParser(vendorID string, parser DataTransferVehicleParser) {
+	vehicleParsersMu.Lock()
+	defer vehicleParsersMu.Unlock()
+	dataTransferVehicleParser[vendorID] = parser
+}
+
+// RegisterSampledValueVehicleParser reads vehicle identifiers from sampled values with parser, before the built-in
+// parser claiming the non-numeric values that are a MAC address or a VIN
+func RegisterSampledValueVehicleParser(parser SampledValueVehicleParser) {
+	vehicleParsersMu.Lock()
+	defer vehicleParsersMu.Unlock()
+	sampledValueVehicleParser = append([]SampledValueVehicleParser{parser}, sampledValueVehicleParser...)
+}
+
+// vehicleFromDataTransfer reads the vehicle identifier of a DataTransfer request with the parser of its vendor
+func vehicleFromDataTransfer(request *core.DataTransferRequest) (VehicleID, bool) {
+	vehicleParsersMu.RLock()
+	parser, ok := dataTransferVehicleParser[request.VendorId]
+	vehicleParsersMu.RUnlock()
+	if !ok {
+		parser = parseVehicleDataTransfer
+	}
+	return parser(request)
+}
+
+// vehicleFromSampledValue reads the vehicle identifier of a sampled value with the first parser claiming it
+func vehicleFromSampledValue(value types.SampledValue) (VehicleID, bool) {
+	vehicleParsersMu.RLock()
+	parsers := sampledValueVehicleParser
+	vehicleParsersMu.RUnlock()
+
+	for _, parser := range parsers {
+		if vehicle, ok := parser(value); ok {
+			return vehicle, true
+		}
+	}
+	return VehicleID{}, false
+}
+
+// parseVehicleDataTransfer is the built-in DataTransfer parser
+func parseVehicleDataTransfer(request *core.DataTransferRequest) (VehicleID, bool) {
+	if request.MessageId != vehicleIdentificationMessageID || request.Data == nil {
+		return VehicleID{}, false
+	}
+
+	var payload struct {
+		ConnectorID   int    `json:"connectorId"`
+		TransactionID int    `json:"transactionId"`
+		MAC           string `json:"mac"`
+		VIN           string `json:"vin"`
+	}
+	if err := unmarshalDataTransfer(request.Data, &payload); err != nil {
+		return VehicleID{}, false
+	}
+
+	vehicle := VehicleID{
+		ConnectorID:   payload.ConnectorID,
+		TransactionID: payload.TransactionID,
+		MAC:           normalizeMAC(payload.MAC),
+		VIN:           normalizeVIN(payload.VIN),
+	}
+	return vehicle, vehicle.MAC != "" || vehicle.VIN != ""
+}
+
+// parseVehicleSampledValue is the built-in sampled value parser
+func parseVehicleSampledValue(value types.SampledValue) (VehicleID, bool) {
+	if _, err := strconv.ParseFloat(value.Value, 64); err == nil {
+		return VehicleID{}, false
+	}
+	if mac := normalizeMAC(value.Value); mac != "" {
+		return VehicleID{MAC: mac}, true
+	}
+	if vin := normalizeVIN(value.Value); vin != "" {
+		return VehicleID{VIN: vin}, true
+	}
+	return VehicleID{}, false
+}
+
+// normalizeMAC returns a MAC address in upper case with colons, or an empty string if s is not a MAC address
+func normalizeMAC(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) == 12 {
+		// Without separators, as reported by some vendors
+		s = s[0:2] + ":" + s[2:4] + ":" + s[4:6] + ":" + s[6:8] + ":" + s[8:10] + ":" + s[10:12]
+	}
+	hw, err := net.ParseMAC(s)
+	if err != nil {
+		return ""
+	}
+	return strings.ToUpper(hw.String())
+}
+
+// normalizeVIN returns a VIN in upper case, or an empty string if s is not a VIN
+func normalizeVIN(s string) string {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if !vinPattern.MatchString(s) {
+		return ""
+	}
+	return s
+}
+
+// recordVehicle records a vehicle identifier reported by a charge point on its transaction
+func (cs *CentralSystem) recordVehicle(ctx context.Context, chargePointID string, vehicle VehicleID) {
+	log := logrus.WithFields(logrus.Fields{
+		"chargePointID": chargePointID,
+		"connectorId":   vehicle.ConnectorID,
+	})
+
+	if vehicle.TransactionID == 0 {
+		if vehicle.ConnectorID <= 0 {
+			log.Warn("Vehicle identifier without connector or transaction")
+			return
+		}
+		open, _, err := cs.db.GetTransactions(ctx, db.TransactionFilter{
+			ChargePointID: chargePointID,
+			ConnectorID:   vehicle.ConnectorID,
+			Status:        "InProgress",
+		}, db.Sort{}, db.Page{Limit: 1})
+		if err != nil {
+			log.WithError(err).Error("Failed to get the transaction of a vehicle")
+			return
+		}
+		if len(open) == 0 {
+			log.Debug("Vehicle identifier without transaction in progress")
+			return
+		}
+		vehicle.TransactionID = open[0].ID
+	}
+
+	if err := cs.db.SetTransactionVehicle(ctx, vehicle.TransactionID, vehicle.MAC, vehicle.VIN); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			log.WithField("transactionId", vehicle.TransactionID).Warn("Vehicle identifier for an unknown transaction")
+			return
+		}
+		log.WithError(err).WithField("transactionId", vehicle.TransactionID).Error("Failed to record vehicle identifier")
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"transactionId": vehicle.TransactionID,
+		"mac":           vehicle.MAC,
+		"vin":           vehicle.VIN,
+	}).Info("Vehicle identified")
+}
@@ -0,0 +1,84 @@
+package ocpp
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/balu-dk/go-cpms/config"
+	"github.com/gorilla/websocket"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ws"
+	"github.com/sirupsen/logrus"
+)
+
+// webSocketPingIntervalKey is the configuration key of the interval of the websocket pings sent by a charge point
+const webSocketPingIntervalKey = "WebSocketPingInterval"
+
+// webSocketTimeouts returns the timeouts of the charge point connections
+func webSocketTimeouts(cfg *config.Config) ws.ServerTimeoutConfig {
+	timeouts := ws.NewServerTimeoutConfig()
+	timeouts.PingWait = time.Duration(cfg.OCPPWSPingWait) * time.Second
+	timeouts.WriteWait = time.Duration(cfg.OCPPWSWriteWait) * time.Second
+	return timeouts
+}
+
+// checkMessageSize reports whether an inbound frame is within the message size limit, and disconnects
+// the charge point if it isn't. The check runs once the frame has been read in full: ocpp-go keeps the
+// connections to itself and sets no read limit on them, so the limit keeps oversized frames away from the
+// handlers and the database but doesn't bound the memory a single frame takes. Bound the frame size at a
+// reverse proxy in front of the CPMS for that.
+func (s *tapServer) checkMessageSize(chargePointID string, data []byte) bool {
+	if s.maxMessageSize <= 0 || len(data) <= s.maxMessageSize {
+		return true
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"chargePointID": chargePointID,
+		"size":          len(data),
+		"limit":         s.maxMessageSize,
+	}).Warn("Charge point sent a message over the size limit, disconnecting")
+
+	// StopConnection blocks until the connection's write loop picks up the close
+	go func() {
+		closeError := websocket.CloseError{Code: websocket.CloseMessageTooBig, Text: "message too big"}
+		if err := s.WsServer.StopConnection(chargePointID, closeError); err != nil {
+			logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Failed to disconnect charge point")
+		}
+	}()
+	return false
+}
+
+// configurePingInterval sets the websocket ping interval of a booted charge point, so it keeps its connection
+// busy enough for load balancers with short idle timeouts
+func (cs *CentralSystem) configurePingInterval(chargePointID string) {
+	time.Sleep(discoverConnectorsDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	log := logrus.WithFields(logrus.Fields{
+		"chargePointID": chargePointID,
+		"pingInterval":  cs.config.OCPPWSPingInterval,
+	})
+
+	request := core.NewChangeConfigurationRequest(webSocketPingIntervalKey, strconv.Itoa(cs.config.OCPPWSPingInterval))
+	response, err := cs.SendRequest(ctx, chargePointID, request)
+	if err != nil {
+		log.WithError(err).Warn("Failed to configure the websocket ping interval")
+		return
+	}
+	conf, ok := response.(*core.ChangeConfigurationConfirmation)
+	if !ok {
+		return
+	}
+
+	switch conf.Status {
+	case core.ConfigurationStatusAccepted:
+		log.Debug("Websocket ping interval configured")
+	case core.ConfigurationStatusRebootRequired:
+		log.Info("Websocket ping interval configured, it applies after the next reboot")
+	default:
+		log.WithField("status", conf.Status).Warn("Charge point did not accept the websocket ping interval")
+	}
+}
@@ -0,0 +1,170 @@
+// Package pnc implements the backend side of ISO 15118 Plug & Charge: verifying the contract certificates of
+// vehicles and fetching contract certificates for them from a certificate provider, like a V2G root operator.
+package pnc
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Certificate statuses of Authorize requests with a contract certificate, as in OCPP 2.0.1
+const (
+	CertificateAccepted       = "Accepted"
+	CertificateSignatureError = "SignatureError"
+	CertificateExpired        = "CertificateExpired"
+	CertificateChainError     = "CertChainError"
+)
+
+// Verifier verifies contract certificates against trusted root certificates
+type Verifier struct {
+	roots *x509.CertPool
+}
+
+// LoadVerifier creates a verifier trusting the PEM encoded root certificates in a file,
+// e.g. the V2G and mobility operator roots
+func LoadVerifier(path string) (*Verifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Plug & Charge root certificates: %w", err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return &Verifier{roots: roots}, nil
+}
+
+// VerifyContract verifies a PEM encoded contract certificate, followed by its sub-CA certificates, for the eMAID
+// it was presented with and returns its certificate status. Revocation is not checked.
+func (v *Verifier) VerifyContract(chain, emaid string, now time.Time) string {
+	var certs []*x509.Certificate
+	rest := []byte(chain)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return CertificateChainError
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return CertificateChainError
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	var invalid x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		return CertificateExpired
+	case errors.Is(err, x509.ErrUnsupportedAlgorithm), errors.As(err, new(x509.InsecureAlgorithmError)):
+		return CertificateSignatureError
+	case err != nil:
+		return CertificateChainError
+	}
+
+	// The common name of a contract certificate is the eMAID of the contract
+	if NormalizeEMAID(certs[0].Subject.CommonName) != NormalizeEMAID(emaid) {
+		return CertificateChainError
+	}
+	return CertificateAccepted
+}
+
+// NormalizeEMAID returns an eMAID in upper case without separators, so "DE-8AA-CA2B3C4D5-L" and
+// "de8aaca2b3c4d5l" compare equal
+func NormalizeEMAID(emaid string) string {
+	return strings.ToUpper(strings.ReplaceAll(emaid, "-", ""))
+}
+
+// CertificateRequest is the body posted to the certificate provider, with the EXI encoded
+// CertificateInstallationReq or CertificateUpdateReq of the vehicle
+type CertificateRequest struct {
+	ChargePointID         string `json:"chargePointId"`
+	ISO15118SchemaVersion string `json:"iso15118SchemaVersion"`
+	Action                string `json:"action"` // Install or Update
+	EXIRequest            string `json:"exiRequest"`
+}
+
+// CertificateResponse is the answer of the certificate provider, with the EXI encoded
+// CertificateInstallationRes or CertificateUpdateRes for the vehicle
+type CertificateResponse struct {
+	Status      string `json:"status"` // Accepted or Failed
+	EXIResponse string `json:"exiResponse"`
+}
+
+// Client posts certificate requests of vehicles to the certificate provider
+type Client struct {
+	url        string
+	authHeader string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the certificate provider at url, sending authHeader as the Authorization header
+// if it is set
+func NewClient(url, authHeader string, timeout time.Duration) *Client {
+	return &Client{
+		url:        url,
+		authHeader: authHeader,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// GetEVCertificate asks the certificate provider to install or update the contract certificate of a vehicle
+func (c *Client) GetEVCertificate(ctx context.Context, request CertificateRequest) (*CertificateResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.authHeader != "" {
+		req.Header.Set("Authorization", c.authHeader)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call certificate provider: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to call certificate provider: unexpected status %s", resp.Status)
+	}
+
+	var response CertificateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode certificate response: %v", err)
+	}
+	if response.Status != "Accepted" && response.Status != "Failed" {
+		return nil, fmt.Errorf("invalid certificate response status %q", response.Status)
+	}
+
+	return &response, nil
+}
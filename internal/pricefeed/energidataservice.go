@@ -0,0 +1,94 @@
+package pricefeed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// Client fetches day-ahead spot prices from Energi Data Service (energidataservice.dk)
+type Client struct {
+	baseURL    string
+	currency   string
+	httpClient *http.Client
+}
+
+// NewClient creates a new spot price client
+func NewClient(baseURL, currency string) *Client {
+	return &Client{
+		baseURL:    baseURL,
+		currency:   currency,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// elspotRecord is a single record of the Elspotprices dataset
+type elspotRecord struct {
+	HourUTC      string   `json:"HourUTC"`
+	PriceArea    string   `json:"PriceArea"`
+	SpotPriceDKK *float64 `json:"SpotPriceDKK"`
+	SpotPriceEUR *float64 `json:"SpotPriceEUR"`
+}
+
+// FetchPrices retrieves the hourly spot prices of a price area within a time range
+func (c *Client) FetchPrices(ctx context.Context, priceArea string, from, to time.Time) ([]*models.SpotPrice, error) {
+	params := url.Values{}
+	params.Set("start", from.UTC().Format("2006-01-02T15:04"))
+	params.Set("end", to.UTC().Format("2006-01-02T15:04"))
+	params.Set("filter", fmt.Sprintf(`{"PriceArea":["%s"]}`, priceArea))
+	params.Set("timezone", "UTC")
+	params.Set("sort", "HourUTC")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch spot prices: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch spot prices: unexpected status %s", resp.Status)
+	}
+
+	var body struct {
+		Records []elspotRecord `json:"records"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode spot prices: %v", err)
+	}
+
+	var prices []*models.SpotPrice
+	for _, record := range body.Records {
+		hourStart, err := time.Parse("2006-01-02T15:04:05", record.HourUTC)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HourUTC %q: %v", record.HourUTC, err)
+		}
+
+		price := record.SpotPriceDKK
+		if c.currency == "EUR" {
+			price = record.SpotPriceEUR
+		}
+		if price == nil {
+			// Prices are occasionally published in one currency only
+			continue
+		}
+
+		prices = append(prices, &models.SpotPrice{
+			PriceArea:   record.PriceArea,
+			HourStart:   hourStart.UTC(),
+			PricePerMWh: *price,
+			Currency:    c.currency,
+		})
+	}
+
+	return prices, nil
+}
@@ -0,0 +1,118 @@
+// Package ratelimit implements token bucket rate limiting per key
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often buckets that have refilled completely are dropped
+const pruneInterval = time.Minute
+
+// Limiter keeps a token bucket per key. Buckets refill at a fixed rate up to the burst size,
+// and every allowed event takes one token. A rate of 0 disables the limit.
+type Limiter struct {
+	mu        sync.Mutex
+	rate      float64 // Tokens added per second
+	burst     float64
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New creates a limiter allowing rate events per second per key with bursts of up to burst events.
+// A burst below one allows a single event at a time.
+func New(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastPrune: time.Now(),
+	}
+}
+
+// Allow takes a token from the key's bucket. If the bucket is empty it returns false
+// and the time until the next token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	l.prune(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// SetLimit changes the rate and burst size of the limiter. Buckets keep their tokens up to the new burst size.
+func (l *Limiter) SetLimit(rate float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = rate
+	l.burst = float64(burst)
+	if rate <= 0 {
+		l.buckets = make(map[string]*bucket)
+	}
+	for _, b := range l.buckets {
+		if b.tokens > l.burst {
+			b.tokens = l.burst
+		}
+	}
+}
+
+// Limit returns the rate and burst size of the limiter
+func (l *Limiter) Limit() (float64, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate, int(l.burst)
+}
+
+// refill returns the tokens of a bucket at a point in time
+func (l *Limiter) refill(b *bucket, now time.Time) float64 {
+	tokens := b.tokens + now.Sub(b.last).Seconds()*l.rate
+	if tokens > l.burst {
+		return l.burst
+	}
+	return tokens
+}
+
+// prune drops the buckets that have refilled completely, which behave like new buckets
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < pruneInterval {
+		return
+	}
+	l.lastPrune = now
+
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/balu-dk/go-cpms/internal/clientip"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/ocpp"
+)
+
+// ValidateAddressRule checks the action and network of a connection address rule and normalizes the network
+func ValidateAddressRule(rule *models.AddressRule) error {
+	if rule.Action != ocpp.AddressRuleAllow && rule.Action != ocpp.AddressRuleDeny {
+		return fmt.Errorf("action must be '%s' or '%s'", ocpp.AddressRuleAllow, ocpp.AddressRuleDeny)
+	}
+	if rule.CIDR == "" {
+		return errors.New("cidr is required")
+	}
+
+	networks, err := clientip.ParseNetworks([]string{rule.CIDR})
+	if err != nil {
+		return fmt.Errorf("invalid cidr: %v", err)
+	}
+	rule.CIDR = networks[0].String()
+	return nil
+}
+
+// GetAddressRules returns all connection address rules
+func (s *CPMS) GetAddressRules(ctx context.Context) ([]*models.AddressRule, error) {
+	return s.db.GetAddressRules(ctx)
+}
+
+// SaveAddressRule creates or updates a connection address rule. It applies from the next connection attempt,
+// connected charge points are not disconnected.
+// Returns db.ErrNotFound if the rule names an unknown tenant.
+func (s *CPMS) SaveAddressRule(ctx context.Context, rule *models.AddressRule) error {
+	if err := ValidateAddressRule(rule); err != nil {
+		return err
+	}
+	if rule.TenantID != "" {
+		if _, err := s.db.GetTenant(ctx, rule.TenantID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.db.SaveAddressRule(ctx, rule); err != nil {
+		return err
+	}
+
+	s.audit(ctx, "addressrule.save", "addressrule", rule.ID, map[string]interface{}{
+		"tenantId": rule.TenantID,
+		"cidr":     rule.CIDR,
+		"action":   rule.Action,
+	})
+	return nil
+}
+
+// DeleteAddressRule removes a connection address rule
+func (s *CPMS) DeleteAddressRule(ctx context.Context, id string) error {
+	if err := s.db.DeleteAddressRule(ctx, id); err != nil {
+		return err
+	}
+
+	s.audit(ctx, "addressrule.delete", "addressrule", id, nil)
+	return nil
+}
@@ -0,0 +1,535 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/sirupsen/logrus"
+)
+
+// Alert rule conditions
+const (
+	AlertConnectorFaulted   = "connector_faulted"   // A connector is Faulted for the rule's duration
+	AlertChargePointOffline = "chargepoint_offline" // A charge point is disconnected for the rule's duration
+	AlertFirmwareFailed     = "firmware_failed"     // A firmware update failed after its final attempt
+	AlertErrorCode          = "error_code"          // A connector reports an error code matching the rule's pattern
+	AlertNoTelemetry        = "no_telemetry"        // A transaction of a connected charge point sends no meter values for the rule's duration
+	AlertRebootLoop         = "reboot_loop"         // A charge point is in a reboot loop, sending BootNotification over and over
+)
+
+// Alert states
+const (
+	AlertStateFiring   = "firing"
+	AlertStateResolved = "resolved"
+)
+
+// alertKey identifies what an alert rule fires for: a charge point, or one of its connectors
+type alertKey struct {
+	ruleID        string
+	chargePointID string
+	connectorID   int
+}
+
+// alertMatch is a rule whose condition holds for an alert key
+type alertMatch struct {
+	rule    *models.AlertRule
+	message string
+	since   time.Time // When a connector condition started, for attaching the diagnostics collected since
+}
+
+// alertEngine serializes the evaluations of the alert rules, so a rule fires only once for the same key
+type alertEngine struct {
+	mu sync.Mutex
+}
+
+// ValidateAlertRule checks that an alert rule can be evaluated
+func ValidateAlertRule(rule *models.AlertRule) error {
+	switch rule.Condition {
+	case AlertConnectorFaulted, AlertChargePointOffline:
+		if rule.DurationMinutes < 0 {
+			return errors.New("durationMinutes must not be negative")
+		}
+	case AlertNoTelemetry:
+		if rule.DurationMinutes <= 0 {
+			return fmt.Errorf("%s rules require a positive durationMinutes", rule.Condition)
+		}
+	case AlertFirmwareFailed, AlertRebootLoop:
+	case AlertErrorCode:
+		if rule.ErrorCode == "" {
+			return fmt.Errorf("%s rules require an errorCode", rule.Condition)
+		}
+		if _, err := regexp.Compile(rule.ErrorCode); err != nil {
+			return fmt.Errorf("invalid errorCode pattern: %v", err)
+		}
+	default:
+		return fmt.Errorf("unsupported alert condition: %s", rule.Condition)
+	}
+	return nil
+}
+
+// GetAlertRules returns all alert rules
+func (s *CPMS) GetAlertRules(ctx context.Context) ([]*models.AlertRule, error) {
+	return s.db.GetAlertRules(ctx)
+}
+
+// GetAlertRule returns a specific alert rule
+func (s *CPMS) GetAlertRule(ctx context.Context, id string) (*models.AlertRule, error) {
+	return s.db.GetAlertRule(ctx, id)
+}
+
+// SaveAlertRule creates or updates an alert rule. Changes apply from the next evaluation.
+func (s *CPMS) SaveAlertRule(ctx context.Context, rule *models.AlertRule) error {
+	if err := ValidateAlertRule(rule); err != nil {
+		return err
+	}
+
+	if err := s.db.SaveAlertRule(ctx, rule); err != nil {
+		return err
+	}
+
+	s.audit(ctx, "alertrule.save", "alertrule", rule.ID, map[string]interface{}{
+		"condition": rule.Condition,
+		"enabled":   rule.Enabled,
+	})
+	return nil
+}
+
+// DeleteAlertRule removes an alert rule. Its firing alerts are resolved by the next evaluation.
+func (s *CPMS) DeleteAlertRule(ctx context.Context, id string) error {
+	if err := s.db.DeleteAlertRule(ctx, id); err != nil {
+		return err
+	}
+
+	s.audit(ctx, "alertrule.delete", "alertrule", id, nil)
+	return nil
+}
+
+// GetAlerts returns the most recently fired alerts, optionally only those in a state
+func (s *CPMS) GetAlerts(ctx context.Context, state string, limit int) ([]*models.Alert, error) {
+	return s.db.GetAlerts(ctx, state, limit)
+}
+
+// handleAlertEvent evaluates the alert rules reacting to an event without waiting for the next evaluation.
+// It is subscribed to the event bus, whose handlers must not block.
+func (s *CPMS) handleAlertEvent(event events.Event) {
+	if event.Type != events.ConnectorFault && event.Type != events.FirmwareUpdateFailed {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := s.evaluateAlertEvent(ctx, event); err != nil {
+			logrus.WithError(err).WithField("eventID", event.ID).Error("Failed to evaluate alert rules for event")
+		}
+	}()
+}
+
+// evaluateAlertEvent fires the error code and firmware rules matching a connector fault or firmware failure event
+func (s *CPMS) evaluateAlertEvent(ctx context.Context, event events.Event) error {
+	rules, err := s.db.GetAlertRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	matches := make(map[alertKey]alertMatch)
+	for _, rule := range rules {
+		if !rule.Enabled || !alertRuleApplies(rule, event.ChargePointID) {
+			continue
+		}
+
+		switch data := event.Data.(type) {
+		case *models.ConnectorStatusEvent:
+			if rule.Condition != AlertErrorCode {
+				continue
+			}
+			pattern, err := regexp.Compile(rule.ErrorCode)
+			if err != nil {
+				continue
+			}
+			if matchesErrorCode(pattern, data.ErrorCode, data.VendorErrorCode) {
+				key := alertKey{ruleID: rule.ID, chargePointID: data.ChargePointID, connectorID: data.ConnectorID}
+				matches[key] = alertMatch{rule: rule, message: errorCodeMessage(data.ChargePointID, data.ConnectorID, data.ErrorCode, data.VendorErrorCode, data.Info), since: event.Timestamp}
+			}
+		case *models.FirmwareUpdate:
+			if rule.Condition != AlertFirmwareFailed {
+				continue
+			}
+			key := alertKey{ruleID: rule.ID, chargePointID: data.ChargePointID}
+			matches[key] = alertMatch{rule: rule, message: firmwareFailedMessage(data)}
+		}
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	s.alerts.mu.Lock()
+	defer s.alerts.mu.Unlock()
+
+	firing, err := s.firingAlerts(ctx)
+	if err != nil {
+		return err
+	}
+	for key, match := range matches {
+		if _, ok := firing[key]; !ok {
+			s.fireAlert(ctx, key, match)
+		}
+	}
+	return nil
+}
+
+// evaluateAlerts fires the alerts of the rules whose conditions hold and resolves the firing alerts
+// whose conditions no longer hold, or whose rules were disabled or deleted
+func (s *CPMS) evaluateAlerts(ctx context.Context) error {
+	rules, err := s.db.GetAlertRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.alerts.mu.Lock()
+	defer s.alerts.mu.Unlock()
+
+	firing, err := s.firingAlerts(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	matches := make(map[alertKey]alertMatch)
+	unknown := make(map[string]bool) // Rules that could not be evaluated keep their alerts firing
+
+	var offline, looping []*models.ChargePoint
+	var faulted []*models.Connector
+	var silent []*silentTransaction
+	var offlineErr, loopingErr, faultedErr, silentErr error
+	offlineLoaded, loopingLoaded, faultedLoaded, silentLoaded := false, false, false, false
+
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		duration := time.Duration(rule.DurationMinutes) * time.Minute
+
+		switch rule.Condition {
+		case AlertChargePointOffline:
+			if !offlineLoaded {
+				disconnected := false
+				offline, _, offlineErr = s.db.GetChargePoints(ctx, db.ChargePointFilter{IsConnected: &disconnected}, db.Sort{}, db.Page{})
+				offlineLoaded = true
+			}
+			if offlineErr != nil {
+				unknown[rule.ID] = true
+				continue
+			}
+			for _, cp := range offline {
+				// Disconnecting is the last update of a charge point until it reconnects
+				if alertRuleApplies(rule, cp.ID) && now.Sub(cp.UpdatedAt) >= duration {
+					key := alertKey{ruleID: rule.ID, chargePointID: cp.ID}
+					matches[key] = alertMatch{rule: rule, message: fmt.Sprintf("Charge point %s has been offline since %s", cp.ID, cp.UpdatedAt.Format(time.RFC3339))}
+				}
+			}
+
+		case AlertRebootLoop:
+			if !loopingLoaded {
+				looping, _, loopingErr = s.db.GetChargePoints(ctx, db.ChargePointFilter{RebootLooping: true}, db.Sort{}, db.Page{})
+				loopingLoaded = true
+			}
+			if loopingErr != nil {
+				unknown[rule.ID] = true
+				continue
+			}
+			for _, cp := range looping {
+				if alertRuleApplies(rule, cp.ID) {
+					key := alertKey{ruleID: rule.ID, chargePointID: cp.ID}
+					matches[key] = alertMatch{rule: rule, message: fmt.Sprintf("Charge point %s has been in a reboot loop since %s", cp.ID, cp.RebootLoopSince.Format(time.RFC3339))}
+				}
+			}
+
+		case AlertConnectorFaulted, AlertErrorCode:
+			if !faultedLoaded {
+				faulted, faultedErr = s.db.GetFaultedConnectors(ctx)
+				faultedLoaded = true
+			}
+			if faultedErr != nil {
+				unknown[rule.ID] = true
+				continue
+			}
+
+			var pattern *regexp.Regexp
+			if rule.Condition == AlertErrorCode {
+				if pattern, err = regexp.Compile(rule.ErrorCode); err != nil {
+					logrus.WithError(err).WithField("alertRuleID", rule.ID).Error("Invalid alert rule error code pattern")
+					unknown[rule.ID] = true
+					continue
+				}
+			}
+
+			for _, c := range faulted {
+				if !alertRuleApplies(rule, c.ChargePointID) {
+					continue
+				}
+				key := alertKey{ruleID: rule.ID, chargePointID: c.ChargePointID, connectorID: c.ID}
+
+				since := c.StatusSince
+				if since.IsZero() {
+					since = c.UpdatedAt
+				}
+
+				if pattern != nil {
+					if matchesErrorCode(pattern, c.ErrorCode, c.VendorErrorCode) {
+						matches[key] = alertMatch{rule: rule, message: errorCodeMessage(c.ChargePointID, c.ID, c.ErrorCode, c.VendorErrorCode, c.Info), since: since}
+					}
+					continue
+				}
+
+				if c.Status == "Faulted" && now.Sub(since) >= duration {
+					matches[key] = alertMatch{rule: rule, message: fmt.Sprintf("Connector %d of charge point %s has been Faulted since %s (%s)", c.ID, c.ChargePointID, since.Format(time.RFC3339), c.ErrorCode), since: since}
+				}
+			}
+
+		case AlertNoTelemetry:
+			if !silentLoaded {
+				silent, silentErr = s.silentTransactions(ctx)
+				silentLoaded = true
+			}
+			if silentErr != nil {
+				unknown[rule.ID] = true
+				continue
+			}
+			for _, st := range silent {
+				if alertRuleApplies(rule, st.tx.ChargePointID) && now.Sub(st.since) >= duration {
+					key := alertKey{ruleID: rule.ID, chargePointID: st.tx.ChargePointID, connectorID: st.tx.ConnectorID}
+					matches[key] = alertMatch{rule: rule, message: fmt.Sprintf("Transaction %d on connector %d of charge point %s has sent no meter values since %s", st.tx.ID, st.tx.ConnectorID, st.tx.ChargePointID, st.since.Format(time.RFC3339)), since: st.since}
+				}
+			}
+
+		case AlertFirmwareFailed:
+			// Firmware rules fire on failure events and hold until a later update of the charge point replaces the failed one
+			for key, alert := range firing {
+				if key.ruleID != rule.ID {
+					continue
+				}
+				updates, err := s.db.GetFirmwareUpdates(ctx, key.chargePointID)
+				if err != nil {
+					unknown[rule.ID] = true
+					break
+				}
+				if len(updates) > 0 && updates[0].Status == "Failed" {
+					matches[key] = alertMatch{rule: rule, message: alert.Message}
+				}
+			}
+		}
+	}
+
+	if offlineErr != nil {
+		logrus.WithError(offlineErr).Error("Failed to get offline charge points for alerting")
+	}
+	if loopingErr != nil {
+		logrus.WithError(loopingErr).Error("Failed to get reboot-looping charge points for alerting")
+	}
+	if faultedErr != nil {
+		logrus.WithError(faultedErr).Error("Failed to get faulted connectors for alerting")
+	}
+	if silentErr != nil {
+		logrus.WithError(silentErr).Error("Failed to get the meter values of active transactions for alerting")
+	}
+
+	for key, match := range matches {
+		if _, ok := firing[key]; !ok {
+			s.fireAlert(ctx, key, match)
+			if match.rule.Condition == AlertNoTelemetry && match.rule.TriggerMeterValues {
+				go s.triggerMeterValues(key.chargePointID, key.connectorID)
+			}
+		}
+	}
+	for key, alert := range firing {
+		if _, ok := matches[key]; !ok && !unknown[key.ruleID] {
+			s.resolveAlert(ctx, alert, now)
+		}
+	}
+
+	return nil
+}
+
+// silentTransaction is an active transaction with the time of its latest meter value, or its start without meter values
+type silentTransaction struct {
+	tx    *models.Transaction
+	since time.Time
+}
+
+// silentTransactions returns the active transactions of connected charge points with the time they last sent meter values.
+// Transactions of disconnected charge points can't send meter values, the chargepoint_offline condition covers them.
+func (s *CPMS) silentTransactions(ctx context.Context) ([]*silentTransaction, error) {
+	transactions, _, err := s.db.GetTransactions(ctx, db.TransactionFilter{Status: "InProgress"}, db.Sort{}, db.Page{})
+	if err != nil {
+		return nil, err
+	}
+	if len(transactions) == 0 {
+		return nil, nil
+	}
+
+	connected := true
+	chargePoints, _, err := s.db.GetChargePoints(ctx, db.ChargePointFilter{IsConnected: &connected}, db.Sort{}, db.Page{})
+	if err != nil {
+		return nil, err
+	}
+	isConnected := make(map[string]bool, len(chargePoints))
+	for _, cp := range chargePoints {
+		isConnected[cp.ID] = true
+	}
+
+	ids := make([]int, 0, len(transactions))
+	for _, tx := range transactions {
+		if isConnected[tx.ChargePointID] {
+			ids = append(ids, tx.ID)
+		}
+	}
+	latest, err := s.db.GetLatestMeterValues(ctx, ids, "")
+	if err != nil {
+		return nil, err
+	}
+
+	silent := make([]*silentTransaction, 0, len(ids))
+	for _, tx := range transactions {
+		if !isConnected[tx.ChargePointID] {
+			continue
+		}
+		st := &silentTransaction{tx: tx, since: tx.StartTime}
+		if mv, ok := latest[tx.ID]; ok && mv.Timestamp.After(st.since) {
+			st.since = mv.Timestamp
+		}
+		silent = append(silent, st)
+	}
+	return silent, nil
+}
+
+// triggerMeterValues asks a connector without telemetry to send its meter values
+func (s *CPMS) triggerMeterValues(chargePointID string, connectorID int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := s.TriggerMessage(ctx, chargePointID, core.MeterValuesFeatureName, connectorID); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"connectorID":   connectorID,
+		}).Error("Failed to trigger meter values of a connector without telemetry")
+	}
+}
+
+// firingAlerts returns the firing alerts by their keys
+func (s *CPMS) firingAlerts(ctx context.Context) (map[alertKey]*models.Alert, error) {
+	alerts, err := s.db.GetAlerts(ctx, AlertStateFiring, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	firing := make(map[alertKey]*models.Alert, len(alerts))
+	for _, alert := range alerts {
+		firing[alertKey{ruleID: alert.RuleID, chargePointID: alert.ChargePointID, connectorID: alert.ConnectorID}] = alert
+	}
+	return firing, nil
+}
+
+// fireAlert records a firing alert and publishes it
+func (s *CPMS) fireAlert(ctx context.Context, key alertKey, match alertMatch) {
+	alert := &models.Alert{
+		RuleID:        match.rule.ID,
+		RuleName:      match.rule.Name,
+		Condition:     match.rule.Condition,
+		ChargePointID: key.chargePointID,
+		ConnectorID:   key.connectorID,
+		State:         AlertStateFiring,
+		Message:       match.message,
+	}
+	if key.connectorID > 0 {
+		alert.DiagnosticsFile = s.diagnostics.file(diagnosticsKey{chargePointID: key.chargePointID, connectorID: key.connectorID}, match.since)
+	}
+
+	if err := s.db.CreateAlert(ctx, alert); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"alertRuleID":   key.ruleID,
+			"chargePointID": key.chargePointID,
+		}).Error("Failed to record alert")
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"alertID":       alert.ID,
+		"alertRuleID":   alert.RuleID,
+		"chargePointID": alert.ChargePointID,
+		"connectorID":   alert.ConnectorID,
+	}).Warn(alert.Message)
+
+	s.events.Publish(events.AlertFiring, alert.ChargePointID, alert)
+}
+
+// resolveAlert marks a firing alert as resolved and publishes it
+func (s *CPMS) resolveAlert(ctx context.Context, alert *models.Alert, now time.Time) {
+	if err := s.db.ResolveAlert(ctx, alert.ID, now); err != nil {
+		logrus.WithError(err).WithField("alertID", alert.ID).Error("Failed to resolve alert")
+		return
+	}
+	alert.State = AlertStateResolved
+	alert.ResolvedAt = now
+
+	logrus.WithFields(logrus.Fields{
+		"alertID":       alert.ID,
+		"alertRuleID":   alert.RuleID,
+		"chargePointID": alert.ChargePointID,
+		"connectorID":   alert.ConnectorID,
+	}).Info("Alert resolved")
+
+	s.events.Publish(events.AlertResolved, alert.ChargePointID, alert)
+}
+
+// alertRuleApplies reports whether a rule covers a charge point
+func alertRuleApplies(rule *models.AlertRule, chargePointID string) bool {
+	return rule.ChargePointID == "" || rule.ChargePointID == chargePointID
+}
+
+// matchesErrorCode reports whether the OCPP or vendor error code of a connector matches a pattern.
+// NoError never matches.
+func matchesErrorCode(pattern *regexp.Regexp, errorCode, vendorErrorCode string) bool {
+	if errorCode != "" && errorCode != "NoError" && pattern.MatchString(errorCode) {
+		return true
+	}
+	return vendorErrorCode != "" && pattern.MatchString(vendorErrorCode)
+}
+
+func errorCodeMessage(chargePointID string, connectorID int, errorCode, vendorErrorCode, info string) string {
+	message := fmt.Sprintf("Connector %d of charge point %s reported error %s", connectorID, chargePointID, errorCode)
+	if vendorErrorCode != "" {
+		message += fmt.Sprintf(" (vendor error %s)", vendorErrorCode)
+	}
+	if info != "" {
+		message += ": " + info
+	}
+	return message
+}
+
+func firmwareFailedMessage(fu *models.FirmwareUpdate) string {
+	return fmt.Sprintf("Firmware update %d of charge point %s failed after %d attempts: %s", fu.ID, fu.ChargePointID, fu.Attempts, fu.LastError)
+}
+
+// runAlerting periodically evaluates the alert rules
+func (s *CPMS) runAlerting() {
+	ticker := time.NewTicker(time.Duration(s.config.AlertEvaluationInterval) * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := s.evaluateAlerts(ctx); err != nil {
+			logrus.WithError(err).Error("Failed to evaluate alert rules")
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/archive"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/sirupsen/logrus"
+)
+
+// archiveOCPPMessages archives the OCPP messages of every whole day past the retention period and deletes them.
+// Each day is written as a gzip compressed file with one JSON message per line.
+func (s *CPMS) archiveOCPPMessages(ctx context.Context, store archive.Store) error {
+	cutoff := time.Now().UTC().AddDate(0, 0, -s.config.OCPPMessageRetentionDays).Truncate(24 * time.Hour)
+
+	for {
+		oldest, ok, err := s.db.OldestOCPPMessageTime(ctx)
+		if err != nil {
+			return err
+		}
+		if !ok || !oldest.Before(cutoff) {
+			return nil
+		}
+
+		day := oldest.UTC().Truncate(24 * time.Hour)
+		if err := s.archiveOCPPMessageDay(ctx, store, day); err != nil {
+			return fmt.Errorf("archive %s: %w", day.Format("2006-01-02"), err)
+		}
+	}
+}
+
+// archiveOCPPMessageDay archives and deletes the OCPP messages logged on a single day
+func (s *CPMS) archiveOCPPMessageDay(ctx context.Context, store archive.Store, day time.Time) error {
+	from, to := day, day.AddDate(0, 0, 1)
+
+	file, err := os.CreateTemp("", "ocpp-messages-*.ndjson.gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	enc := json.NewEncoder(gz)
+	count, maxID := 0, 0
+	err = s.db.StreamOCPPMessages(ctx, from, to, func(msg *models.OCPPMessage) error {
+		count++
+		if msg.ID > maxID {
+			maxID = msg.ID
+		}
+		return enc.Encode(msg)
+	})
+	if err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// The highest ID is part of the key, so a later run for the same day never overwrites an earlier archive
+	key := fmt.Sprintf("ocpp_messages/%s/%s-%d.ndjson.gz", day.Format("2006/01"), day.Format("2006-01-02"), maxID)
+	if err := store.Put(ctx, key, file, size); err != nil {
+		return err
+	}
+
+	deleted, err := s.db.DeleteOCPPMessages(ctx, from, to, maxID)
+	if err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"day":      day.Format("2006-01-02"),
+		"key":      key,
+		"archived": count,
+		"deleted":  deleted,
+	}).Info("Archived OCPP messages")
+	return nil
+}
+
+// pruneQuarantinedMessages deletes the quarantined OCPP messages past the retention period. They are not
+// archived, a malformed message is only kept for as long as it can be reviewed.
+func (s *CPMS) pruneQuarantinedMessages(ctx context.Context) error {
+	cutoff := time.Now().UTC().AddDate(0, 0, -s.config.OCPPMessageRetentionDays)
+	deleted, err := s.db.DeleteQuarantinedMessages(ctx, cutoff)
+	if deleted > 0 {
+		logrus.WithFields(logrus.Fields{
+			"cutoff":  cutoff,
+			"deleted": deleted,
+		}).Info("Pruned quarantined OCPP messages")
+	}
+	return err
+}
+
+// runOCPPMessageRetention archives and prunes old OCPP messages and prunes old quarantined messages at startup
+// and then daily
+func (s *CPMS) runOCPPMessageRetention() {
+	store, err := archive.New(s.config.OCPPArchiveDestination, archive.S3Config{
+		Region:          s.config.S3Region,
+		Endpoint:        s.config.S3Endpoint,
+		AccessKeyID:     s.config.S3AccessKeyID,
+		SecretAccessKey: s.config.S3SecretAccessKey,
+	})
+	if err != nil {
+		logrus.WithError(err).Error("Invalid OCPP archive destination, OCPP message retention disabled")
+		return
+	}
+
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+		if err := s.archiveOCPPMessages(ctx, store); err != nil {
+			logrus.WithError(err).Error("Failed to archive OCPP messages")
+		}
+		if err := s.pruneQuarantinedMessages(ctx); err != nil {
+			logrus.WithError(err).Error("Failed to prune quarantined OCPP messages")
+		}
+		cancel()
+
+		<-ticker.C
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/balu-dk/go-cpms/internal/clientip"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/siem"
+	"github.com/sirupsen/logrus"
+)
+
+type contextKey string
+
+const (
+	actorContextKey      contextKey = "actor"
+	clientAddrContextKey contextKey = "clientAddr"
+)
+
+// defaultActor is recorded when no operator is associated with the context
+const defaultActor = "system"
+
+// WithActor returns a context recording the operator performing an action
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey, actor)
+}
+
+// ActorFromContext returns the operator performing an action
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorContextKey).(string); ok && actor != "" {
+		return actor
+	}
+	return defaultActor
+}
+
+// WithClientAddr returns a context recording the address of the API client performing an action
+func WithClientAddr(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, clientAddrContextKey, addr)
+}
+
+// ClientAddrFromContext returns the address of the API client performing an action, empty if there is none
+func ClientAddrFromContext(ctx context.Context) string {
+	addr, _ := ctx.Value(clientAddrContextKey).(string)
+	return addr
+}
+
+// ClientAddr returns the address of the client of an API request, taken from the
+// forwarding headers of requests received through a trusted proxy
+func (s *CPMS) ClientAddr(r *http.Request) string {
+	return clientip.FromRequest(r, s.config.TrustedProxies)
+}
+
+// audit records an action in the audit log. Failures are logged but never block the action itself.
+func (s *CPMS) audit(ctx context.Context, action, targetType, targetID string, details map[string]interface{}) {
+	entry := &models.AuditEntry{
+		Actor:      ActorFromContext(ctx),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    details,
+		ClientAddr: ClientAddrFromContext(ctx),
+	}
+
+	if err := s.db.CreateAuditEntry(ctx, entry); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"action":     action,
+			"targetType": targetType,
+			"targetID":   targetID,
+		}).Error("Failed to record audit entry")
+	}
+
+	chargePointID := ""
+	if targetType == "chargepoint" {
+		chargePointID = targetID
+	}
+	s.siem.Security(action, siem.SeverityLow, chargePointID, entry.Actor+" "+action+" "+targetType+" "+targetID, details)
+}
+
+// GetAuditLog returns the most recent audit entries, optionally filtered by target
+func (s *CPMS) GetAuditLog(ctx context.Context, targetType, targetID string, limit int) ([]*models.AuditEntry, error) {
+	return s.db.GetAuditLog(ctx, targetType, targetID, limit)
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/sirupsen/logrus"
+)
+
+// carbonFeedInterval is how often the carbon intensity is refreshed. The feed publishes 5 minute values,
+// so the intensity of the current hour is refined on every refresh until the hour is complete.
+const carbonFeedInterval = 15 * time.Minute
+
+// GetCarbonIntensities returns the stored carbon intensities of the configured price area within a time range
+func (s *CPMS) GetCarbonIntensities(ctx context.Context, from, to time.Time) ([]*models.CarbonIntensity, error) {
+	return s.db.GetCarbonIntensities(ctx, s.config.PriceArea, from, to)
+}
+
+// RefreshCarbonIntensities fetches the carbon intensity of the last day from the carbon intensity feed and stores it
+func (s *CPMS) RefreshCarbonIntensities(ctx context.Context) error {
+	to := time.Now().UTC().Truncate(time.Hour).Add(time.Hour)
+	from := to.Add(-25 * time.Hour)
+
+	intensities, err := s.carbonFeed.FetchIntensities(ctx, s.config.PriceArea, from, to)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.SaveCarbonIntensities(ctx, intensities); err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"priceArea":   s.config.PriceArea,
+		"intensities": len(intensities),
+	}).Info("Carbon intensities refreshed")
+
+	return nil
+}
+
+// runCarbonFeed periodically refreshes the carbon intensity from the carbon intensity feed
+func (s *CPMS) runCarbonFeed() {
+	ticker := time.NewTicker(carbonFeedInterval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if err := s.RefreshCarbonIntensities(ctx); err != nil {
+			logrus.WithError(err).Error("Failed to refresh carbon intensities")
+		}
+		cancel()
+
+		<-ticker.C
+	}
+}
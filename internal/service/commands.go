@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	cpmsocpp "github.com/balu-dk/go-cpms/internal/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/sirupsen/logrus"
+)
+
+// Command statuses recorded by the CPMS. Any other status is the one confirmed by the charge point.
+const (
+	CommandStatusPending = "Pending"
+	CommandStatusFailed  = "Failed"
+)
+
+// ErrChargePointOffline is returned when a command targets a charge point not connected to any instance
+var ErrChargePointOffline = errors.New("charge point is offline")
+
+// commandTracker lets callers wait for the confirmation of commands sent by this instance
+type commandTracker struct {
+	mu      sync.Mutex
+	waiters map[int]chan struct{}
+}
+
+func newCommandTracker() *commandTracker {
+	return &commandTracker{waiters: make(map[int]chan struct{})}
+}
+
+func (t *commandTracker) register(id int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.waiters[id] = make(chan struct{})
+}
+
+func (t *commandTracker) done(id int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ch, ok := t.waiters[id]; ok {
+		close(ch)
+		delete(t.waiters, id)
+	}
+}
+
+// wait returns a channel closed once the command completes, or nil if it already has
+func (t *commandTracker) wait(id int) <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.waiters[id]
+}
+
+// commandOption sets optional fields of a tracked command
+type commandOption func(*models.Command)
+
+// withMacroStep links a command to a step of a macro run
+func withMacroStep(runID, step int) commandOption {
+	return func(cmd *models.Command) {
+		cmd.MacroRunID = runID
+		cmd.Step = step
+	}
+}
+
+// withSession links a command to a charging session
+func withSession(sessionID string) commandOption {
+	return func(cmd *models.Command) {
+		cmd.SessionID = sessionID
+	}
+}
+
+// sendCommand sends a request to a charge point and records it in the command tracker, with its credentials masked.
+// The command is completed with the status confirmed by the charge point once the response arrives,
+// or retried according to the retry policy of its action if it fails with a transient error.
+func (s *CPMS) sendCommand(ctx context.Context, chargePointID string, request ocpp.Request, opts ...commandOption) (*models.Command, error) {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := &models.Command{
+		ChargePointID: chargePointID,
+		Action:        request.GetFeatureName(),
+		Payload:       cpmsocpp.RedactCredentials(payload),
+		Status:        CommandStatusPending,
+		Actor:         ActorFromContext(ctx),
+		RequestID:     RequestIDFromContext(ctx),
+		Attempts:      1,
+	}
+	for _, opt := range opts {
+		opt(cmd)
+	}
+
+	if err := s.db.CreateCommand(ctx, cmd); err != nil {
+		return nil, err
+	}
+	s.commands.register(cmd.ID)
+
+	if err := s.dispatchCommand(ctx, &dispatchedCommand{cmd: cmd, request: request, payload: payload, attempts: 1}); err != nil {
+		return s.completeCommand(cmd, nil, err), err
+	}
+	return cmd, nil
+}
+
+// completeCommand records the outcome of a command and releases anyone waiting for it.
+// The pending command may still be read by the sender, so the result is recorded on a copy.
+func (s *CPMS) completeCommand(pending *models.Command, confirmation ocpp.Response, err error) *models.Command {
+	defer s.commands.done(pending.ID)
+
+	cmd := *pending
+
+	fields := logrus.Fields{
+		"chargePointID": cmd.ChargePointID,
+		"action":        cmd.Action,
+		"commandID":     cmd.ID,
+		"requestID":     cmd.RequestID,
+	}
+
+	if err != nil {
+		cmd.Status = CommandStatusFailed
+		cmd.Error = err.Error()
+		logrus.WithError(err).WithFields(fields).Error("Command failed")
+	} else {
+		cmd.Status = confirmationStatus(confirmation)
+		cmd.Response, _ = json.Marshal(confirmation)
+		fields["status"] = cmd.Status
+		logrus.WithFields(fields).Info("Command processed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.db.CompleteCommand(ctx, &cmd); err != nil {
+		logrus.WithError(err).WithFields(fields).Error("Failed to record command result")
+	}
+
+	return &cmd
+}
+
+// confirmationStatus returns the status field of a confirmation, or Accepted for confirmations without one
+func confirmationStatus(confirmation ocpp.Response) string {
+	data, err := json.Marshal(confirmation)
+	if err != nil {
+		return "Accepted"
+	}
+
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil || body.Status == "" {
+		return "Accepted"
+	}
+	return body.Status
+}
+
+// waitForCommand blocks until a command completes or the timeout expires and returns its latest state
+func (s *CPMS) waitForCommand(ctx context.Context, cmd *models.Command, timeout time.Duration) (*models.Command, error) {
+	if ch := s.commands.wait(cmd.ID); ch != nil {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-ch:
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return s.db.GetCommand(ctx, cmd.ID)
+}
+
+// WaitForCommand blocks until a command sent by this instance is confirmed by the charge point, fails or the
+// timeout expires, and returns its latest state. A command still Pending after the timeout wasn't confirmed in time.
+func (s *CPMS) WaitForCommand(ctx context.Context, cmd *models.Command, timeout time.Duration) (*models.Command, error) {
+	return s.waitForCommand(ctx, cmd, timeout)
+}
+
+// GetCommands returns the most recent commands sent to a charge point
+func (s *CPMS) GetCommands(ctx context.Context, chargePointID string, limit int) ([]*models.Command, error) {
+	return s.db.GetCommands(ctx, chargePointID, limit)
+}
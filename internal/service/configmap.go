@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/balu-dk/go-cpms/internal/configmap"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+)
+
+// ErrInvalidConfigurationSource is returned when a configuration to translate names an unknown OCPP version
+var ErrInvalidConfigurationSource = errors.New("configuration source must be ocpp1.6 or ocpp2.0.1")
+
+// PlanConfigurationMigration translates the latest configuration a charge point reported to GetConfiguration into
+// the OCPP 2.0.1 variables to set after migrating it. db.ErrNotFound is returned if it never reported one.
+func (s *CPMS) PlanConfigurationMigration(ctx context.Context, chargePointID string) (*models.ConfigurationPlan, error) {
+	cmd, err := s.db.GetLatestCommand(ctx, chargePointID, core.GetConfigurationFeatureName)
+	if err != nil {
+		return nil, err
+	}
+
+	var conf core.GetConfigurationConfirmation
+	if err := json.Unmarshal(cmd.Response, &conf); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration snapshot: %w", err)
+	}
+
+	keys := make([]models.ConfigurationKey, 0, len(conf.ConfigurationKey))
+	for _, k := range conf.ConfigurationKey {
+		key := models.ConfigurationKey{Key: k.Key, Readonly: k.Readonly}
+		if k.Value != nil {
+			key.Value = *k.Value
+		}
+		keys = append(keys, key)
+	}
+
+	plan := configmap.ToV201(keys)
+	plan.ChargePointID = chargePointID
+	plan.SnapshotAt = cmd.CompletedAt
+	return plan, nil
+}
+
+// TranslateConfiguration translates OCPP 1.6 configuration keys to OCPP 2.0.1 variables, or OCPP 2.0.1
+// variables to OCPP 1.6 configuration keys, depending on the version the configuration is from
+func (s *CPMS) TranslateConfiguration(from string, keys []models.ConfigurationKey, variables []models.ComponentVariable) (*models.ConfigurationPlan, error) {
+	switch from {
+	case configmap.V16:
+		return configmap.ToV201(keys), nil
+	case configmap.V201:
+		return configmap.ToV16(variables), nil
+	default:
+		return nil, ErrInvalidConfigurationSource
+	}
+}
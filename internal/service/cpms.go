@@ -2,45 +2,163 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/balu-dk/go-cpms/config"
+	"github.com/balu-dk/go-cpms/internal/carbonfeed"
 	"github.com/balu-dk/go-cpms/internal/db"
 	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/email"
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/balu-dk/go-cpms/internal/incident"
 	"github.com/balu-dk/go-cpms/internal/ocpp"
+	"github.com/balu-dk/go-cpms/internal/pricefeed"
+	"github.com/balu-dk/go-cpms/internal/ratelimit"
+	"github.com/balu-dk/go-cpms/internal/siem"
+	"github.com/balu-dk/go-cpms/internal/tariff"
+	"github.com/balu-dk/go-cpms/internal/webhook"
 	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
 	"github.com/lorenzodonini/ocpp-go/ocpp1.6/firmware"
 	"github.com/lorenzodonini/ocpp-go/ocpp1.6/remotetrigger"
 	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
-	"github.com/sirupsen/logrus"
 )
 
 // CPMS represents the Charging Point Management System service
 type CPMS struct {
 	config        *config.Config
-	db            *db.PostgresStore
-	centralSystem *ocpp.CentralSystem
+	db            db.Store
+	centralSystem OCPPServer
+	tariff        *tariff.Engine
+	priceFeed     *pricefeed.Client
+	carbonFeed    *carbonfeed.Client
+	solar         *solarController
+	parking       *parkingMonitor
+	events        *events.Bus
+	webhooks      *webhook.Dispatcher
+	email         *email.Notifier
+	incidents     *incident.Notifier
+	commands      *commandTracker
+	commandQueue  *commandQueue
+	alerts        *alertEngine
+	diagnostics   *diagnosticsCollector
+	recovery      *recoveryTracker
+	siem          *siem.Forwarder
+	stats         *statsCache
+
+	apiLimiter     *ratelimit.Limiter
+	commandLimiter *ratelimit.Limiter
 }
 
 // NewCPMS creates a new CPMS service
-func NewCPMS(cfg *config.Config, store *db.PostgresStore) *CPMS {
-	return &CPMS{
-		config: cfg,
-		db:     store,
+func NewCPMS(cfg *config.Config, store db.Store, opts ...Option) *CPMS {
+	s := &CPMS{
+		config:       cfg,
+		db:           store,
+		tariff:       tariff.NewEngine(cfg, store),
+		priceFeed:    pricefeed.NewClient(cfg.PriceFeedURL, cfg.PriceCurrency),
+		carbonFeed:   carbonfeed.NewClient(cfg.CarbonFeedURL),
+		solar:        newSolarController(),
+		parking:      newParkingMonitor(),
+		events:       events.NewBus(),
+		webhooks:     webhook.NewDispatcher(cfg.WebhookURLs, cfg.WebhookSecret, cfg.WebhookEvents),
+		email:        email.NewNotifier(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.EmailFrom, cfg.EmailRecipients, cfg.EmailEvents),
+		incidents:    incident.NewNotifier(cfg.IncidentProvider, cfg.IncidentURL, cfg.IncidentAPIKey, cfg.IncidentSeverity),
+		commands:     newCommandTracker(),
+		commandQueue: newCommandQueue(),
+		alerts:       &alertEngine{},
+		diagnostics:  newDiagnosticsCollector(),
+		recovery:     newRecoveryTracker(),
+		siem:         siem.NewForwarder(cfg.SIEMURL, cfg.SIEMActions, cfg.SIEMChargePoints, cfg.SIEMMinSeverity),
+		stats:        newStatsCache(),
+
+		apiLimiter:     ratelimit.New(cfg.APIRateLimit, cfg.APIRateBurst),
+		commandLimiter: ratelimit.New(cfg.APICommandRateLimit, cfg.APICommandRateBurst),
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.centralSystem == nil {
+		s.centralSystem = ocpp.NewCentralSystem(s.config, s.db, s.tariff, s.events, s.siem)
+	}
+
+	// Webhook endpoints can be configured on reload, so the dispatcher always receives events
+	s.events.Subscribe(s.webhooks.Handle)
+	s.events.Subscribe(s.handleAlertEvent)
+	s.events.Subscribe(s.handleDiagnosticsEvent)
+	s.events.Subscribe(s.handleRecoveryEvent)
+	s.events.Subscribe(s.email.Handle)
+	s.events.Subscribe(s.incidents.Handle)
+
+	return s
 }
 
 // Start starts the CPMS service
 func (s *CPMS) Start() error {
+	if s.config.EmailTemplateFile != "" {
+		if err := s.email.LoadTemplates(s.config.EmailTemplateFile); err != nil {
+			return err
+		}
+	}
+
 	// Start the central system
-	s.centralSystem = ocpp.NewCentralSystem(s.config, s.db)
-	return s.centralSystem.Start()
+	if err := s.centralSystem.Start(); err != nil {
+		return err
+	}
+
+	// Start background jobs
+	go s.runFirmwareRetries()
+	go s.runCommandQueue()
+	if s.config.PriceFeedEnabled {
+		go s.runSpotPriceFeed()
+	}
+	if s.config.CarbonFeedEnabled {
+		go s.runCarbonFeed()
+	}
+	go s.runSolarControl()
+	go s.runDepartureScheduling()
+	go s.runGridEvents()
+	go s.runParkingMonitor()
+	go s.runAlerting()
+	if s.config.RecoveryEnabled {
+		go s.runRecovery()
+	}
+	go s.runMeterValueRetention()
+	if s.config.OrphanedTransactionTimeout > 0 {
+		go s.runOrphanedTransactionCleanup()
+	}
+	if s.config.OCPPMessageRetentionDays > 0 {
+		go s.runOCPPMessageRetention()
+	}
+	go s.webhooks.Run()
+	if s.email.Enabled() {
+		go s.email.Run()
+	}
+	if s.incidents.Enabled() {
+		go s.incidents.Run()
+	}
+	if s.siem.Enabled() {
+		go s.siem.Run()
+	}
+
+	return nil
+}
+
+// Stop shuts down the OCPP central system, closing charge point connections within the context's deadline
+func (s *CPMS) Stop(ctx context.Context) {
+	s.centralSystem.Stop(ctx)
 }
 
-// GetChargePoints returns all charge points
-func (s *CPMS) GetChargePoints(ctx context.Context) ([]*models.ChargePoint, error) {
-	return s.db.GetAllChargePoints(ctx)
+// AdminUIEnabled reports whether the API server serves the embedded admin web UI
+func (s *CPMS) AdminUIEnabled() bool {
+	return s.config.AdminUIEnabled
+}
+
+// GetChargePoints returns a page of the charge points matching a filter and the total number of matching charge points
+func (s *CPMS) GetChargePoints(ctx context.Context, filter db.ChargePointFilter, sort db.Sort, page db.Page) ([]*models.ChargePoint, int, error) {
+	return s.db.GetChargePoints(ctx, filter, sort, page)
 }
 
 // GetChargePoint returns a specific charge point
@@ -48,9 +166,45 @@ func (s *CPMS) GetChargePoint(ctx context.Context, id string) (*models.ChargePoi
 	return s.db.GetChargePoint(ctx, id)
 }
 
-// GetConnectors returns all connectors for a charge point
-func (s *CPMS) GetConnectors(ctx context.Context, chargePointID string) ([]*models.Connector, error) {
-	return s.db.GetConnectors(ctx, chargePointID)
+// GetConnectors returns a page of the connectors of a charge point and the total number of its connectors
+func (s *CPMS) GetConnectors(ctx context.Context, chargePointID string, page db.Page) ([]*models.Connector, int, error) {
+	return s.db.GetConnectors(ctx, chargePointID, page)
+}
+
+// SaveConnectorAttributes updates the operator-maintained attributes of a connector
+func (s *CPMS) SaveConnectorAttributes(ctx context.Context, connector *models.Connector) error {
+	if err := s.db.SaveConnectorAttributes(ctx, connector); err != nil {
+		return err
+	}
+
+	s.audit(ctx, "connector.attributes", "chargepoint", connector.ChargePointID, map[string]interface{}{
+		"connectorId": connector.ID,
+		"plugType":    connector.PlugType,
+		"format":      connector.Format,
+		"maxPowerKw":  connector.MaxPowerKW,
+		"phases":      connector.Phases,
+	})
+	return nil
+}
+
+// GetConnectorStatusEvents returns the most recent status notifications of a charge point's connectors
+func (s *CPMS) GetConnectorStatusEvents(ctx context.Context, chargePointID string, connectorID int, errorsOnly bool, limit int) ([]*models.ConnectorStatusEvent, error) {
+	return s.db.GetConnectorStatusEvents(ctx, chargePointID, connectorID, errorsOnly, limit)
+}
+
+// GetConnectionEvents returns the most recent websocket connections of a charge point with their metadata
+func (s *CPMS) GetConnectionEvents(ctx context.Context, chargePointID string, limit int) ([]*models.ConnectionEvent, error) {
+	return s.db.GetConnectionEvents(ctx, chargePointID, limit)
+}
+
+// GetOCPPMessages returns a page of the OCPP messages logged for a charge point and the total number of its messages
+func (s *CPMS) GetOCPPMessages(ctx context.Context, chargePointID string, page db.Page) ([]*models.OCPPMessage, int, error) {
+	return s.db.GetOCPPMessages(ctx, chargePointID, page)
+}
+
+// GetHourlyEnergy returns the energy delivered per connector and hour of a charge point in [from, to)
+func (s *CPMS) GetHourlyEnergy(ctx context.Context, chargePointID string, from, to time.Time) ([]*models.HourlyEnergy, error) {
+	return s.db.GetHourlyEnergy(ctx, chargePointID, from, to)
 }
 
 // GetTransaction returns a specific transaction
@@ -58,8 +212,13 @@ func (s *CPMS) GetTransaction(ctx context.Context, id int) (*models.Transaction,
 	return s.db.GetTransaction(ctx, id)
 }
 
+// GetTransactions returns a page of the transactions matching a filter and the total number of matching transactions
+func (s *CPMS) GetTransactions(ctx context.Context, filter db.TransactionFilter, sort db.Sort, page db.Page) ([]*models.Transaction, int, error) {
+	return s.db.GetTransactions(ctx, filter, sort, page)
+}
+
 // ResetChargePoint sends a reset request to a charge point
-func (s *CPMS) ResetChargePoint(ctx context.Context, chargePointID string, resetType string) error {
+func (s *CPMS) ResetChargePoint(ctx context.Context, chargePointID string, resetType string) (*models.Command, error) {
 	var ocppResetType core.ResetType
 	switch resetType {
 	case "Hard":
@@ -67,26 +226,14 @@ func (s *CPMS) ResetChargePoint(ctx context.Context, chargePointID string, reset
 	case "Soft":
 		ocppResetType = core.ResetTypeSoft
 	default:
-		return fmt.Errorf("invalid reset type: %s", resetType)
+		return nil, fmt.Errorf("invalid reset type: %s", resetType)
 	}
 
-	callback := func(confirmation *core.ResetConfirmation, err error) {
-		if err != nil {
-			logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Reset request failed")
-			return
-		}
-
-		logrus.WithFields(logrus.Fields{
-			"chargePointID": chargePointID,
-			"status":        confirmation.Status,
-		}).Info("Reset request processed")
-	}
-
-	return s.centralSystem.OcppServer.Reset(chargePointID, callback, ocppResetType)
+	return s.sendCommand(ctx, chargePointID, core.NewResetRequest(ocppResetType))
 }
 
 // ChangeAvailability changes the availability of a connector
-func (s *CPMS) ChangeAvailability(ctx context.Context, chargePointID string, connectorID int, availabilityType string) error {
+func (s *CPMS) ChangeAvailability(ctx context.Context, chargePointID string, connectorID int, availabilityType string) (*models.Command, error) {
 	var ocppAvailabilityType core.AvailabilityType
 	switch availabilityType {
 	case "Operative":
@@ -94,233 +241,142 @@ func (s *CPMS) ChangeAvailability(ctx context.Context, chargePointID string, con
 	case "Inoperative":
 		ocppAvailabilityType = core.AvailabilityTypeInoperative
 	default:
-		return fmt.Errorf("invalid availability type: %s", availabilityType)
+		return nil, fmt.Errorf("invalid availability type: %s", availabilityType)
 	}
 
-	callback := func(confirmation *core.ChangeAvailabilityConfirmation, err error) {
-		if err != nil {
-			logrus.WithError(err).WithFields(logrus.Fields{
-				"chargePointID": chargePointID,
-				"connectorID":   connectorID,
-			}).Error("Change availability request failed")
-			return
-		}
-
-		logrus.WithFields(logrus.Fields{
-			"chargePointID": chargePointID,
-			"connectorID":   connectorID,
-			"status":        confirmation.Status,
-		}).Info("Change availability request processed")
-	}
-
-	return s.centralSystem.OcppServer.ChangeAvailability(chargePointID, callback, connectorID, ocppAvailabilityType)
+	return s.sendCommand(ctx, chargePointID, core.NewChangeAvailabilityRequest(connectorID, ocppAvailabilityType))
 }
 
 // UnlockConnector sends an unlock connector request
-func (s *CPMS) UnlockConnector(ctx context.Context, chargePointID string, connectorID int) error {
-	callback := func(confirmation *core.UnlockConnectorConfirmation, err error) {
-		if err != nil {
-			logrus.WithError(err).WithFields(logrus.Fields{
-				"chargePointID": chargePointID,
-				"connectorID":   connectorID,
-			}).Error("Unlock connector request failed")
-			return
-		}
-
-		logrus.WithFields(logrus.Fields{
-			"chargePointID": chargePointID,
-			"connectorID":   connectorID,
-			"status":        confirmation.Status,
-		}).Info("Unlock connector request processed")
-	}
-
-	return s.centralSystem.OcppServer.UnlockConnector(chargePointID, callback, connectorID)
+func (s *CPMS) UnlockConnector(ctx context.Context, chargePointID string, connectorID int) (*models.Command, error) {
+	return s.sendCommand(ctx, chargePointID, core.NewUnlockConnectorRequest(connectorID))
 }
 
-// RemoteStartTransaction sends a remote start transaction request
-func (s *CPMS) RemoteStartTransaction(ctx context.Context, chargePointID string, connectorID int, idTag string) error {
-	callback := func(confirmation *core.RemoteStartTransactionConfirmation, err error) {
-		if err != nil {
-			logrus.WithError(err).WithFields(logrus.Fields{
-				"chargePointID": chargePointID,
-				"connectorID":   connectorID,
-				"idTag":         idTag,
-			}).Error("Remote start transaction request failed")
-			return
-		}
-
-		logrus.WithFields(logrus.Fields{
-			"chargePointID": chargePointID,
-			"connectorID":   connectorID,
-			"idTag":         idTag,
-			"status":        confirmation.Status,
-		}).Info("Remote start transaction request processed")
-	}
-
+// RemoteStartTransaction sends a remote start transaction request. If schedule is set, the request carries
+// a TxProfile limiting the transaction with it from its start.
+// It opens the session the resulting transaction joins when the charge point starts it.
+func (s *CPMS) RemoteStartTransaction(ctx context.Context, chargePointID string, connectorID int, idTag string, schedule *types.ChargingSchedule) (*models.Command, error) {
 	req := core.NewRemoteStartTransactionRequest(idTag)
 	if connectorID > 0 {
 		req.ConnectorId = &connectorID
 	}
+	if schedule != nil {
+		req.ChargingProfile = newRemoteStartProfile(schedule)
+	}
 
-	return s.centralSystem.OcppServer.RemoteStartTransaction(chargePointID, callback, idTag, func(request *core.RemoteStartTransactionRequest) {
-		request.ConnectorId = &connectorID
-	})
+	sessionID, err := s.db.OpenPendingSession(ctx, chargePointID, idTag, db.NewSessionID(), true)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.sendCommand(ctx, chargePointID, req, withSession(sessionID))
 }
 
-// RemoteStopTransaction sends a remote stop transaction request
-func (s *CPMS) RemoteStopTransaction(ctx context.Context, chargePointID string, transactionID int) error {
-	callback := func(confirmation *core.RemoteStopTransactionConfirmation, err error) {
+// ErrIdTagNotInGroup is returned when a transaction is stopped on behalf of an idTag outside the group of the idTag that started it
+var ErrIdTagNotInGroup = errors.New("idTag is not in the group of the transaction's idTag")
+
+// RemoteStopTransaction sends a remote stop transaction request. If idTag is set, the stop is made on behalf
+// of that idTag, which must be the idTag that started the transaction or one in its group.
+func (s *CPMS) RemoteStopTransaction(ctx context.Context, chargePointID string, transactionID int, idTag string) (*models.Command, error) {
+	var opts []commandOption
+	tx, err := s.db.GetTransaction(ctx, transactionID)
+	if err == nil && tx.SessionID != "" {
+		opts = append(opts, withSession(tx.SessionID))
+	}
+
+	if idTag != "" {
 		if err != nil {
-			logrus.WithError(err).WithFields(logrus.Fields{
-				"chargePointID": chargePointID,
-				"transactionID": transactionID,
-			}).Error("Remote stop transaction request failed")
-			return
+			return nil, err
+		}
+		same, err := db.SameIdTagGroup(ctx, s.db, chargePointID, idTag, tx.IdTag)
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			return nil, ErrIdTagNotInGroup
 		}
-
-		logrus.WithFields(logrus.Fields{
-			"chargePointID": chargePointID,
-			"transactionID": transactionID,
-			"status":        confirmation.Status,
-		}).Info("Remote stop transaction request processed")
 	}
 
-	return s.centralSystem.OcppServer.RemoteStopTransaction(chargePointID, callback, transactionID)
+	return s.sendCommand(ctx, chargePointID, core.NewRemoteStopTransactionRequest(transactionID), opts...)
 }
 
 // TriggerHeartbeat sends a trigger message to request a heartbeat
-func (s *CPMS) TriggerHeartbeat(ctx context.Context, chargePointID string) error {
-	callback := func(confirmation *remotetrigger.TriggerMessageConfirmation, err error) {
-		if err != nil {
-			logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Trigger heartbeat request failed")
-			return
-		}
+func (s *CPMS) TriggerHeartbeat(ctx context.Context, chargePointID string) (*models.Command, error) {
+	return s.sendCommand(ctx, chargePointID, remotetrigger.NewTriggerMessageRequest(core.HeartbeatFeatureName))
+}
 
-		logrus.WithFields(logrus.Fields{
-			"chargePointID": chargePointID,
-			"status":        confirmation.Status,
-		}).Info("Trigger heartbeat request processed")
+// TriggerStatusNotification sends a trigger message to request a status notification
+func (s *CPMS) TriggerStatusNotification(ctx context.Context, chargePointID string, connectorID int) (*models.Command, error) {
+	req := remotetrigger.NewTriggerMessageRequest(core.StatusNotificationFeatureName)
+	if connectorID > 0 {
+		req.ConnectorId = &connectorID
 	}
 
-	return s.centralSystem.OcppServer.TriggerMessage(chargePointID, callback, core.HeartbeatFeatureName)
+	return s.sendCommand(ctx, chargePointID, req)
 }
 
-// TriggerStatusNotification sends a trigger message to request a status notification
-func (s *CPMS) TriggerStatusNotification(ctx context.Context, chargePointID string, connectorID int) error {
-	callback := func(confirmation *remotetrigger.TriggerMessageConfirmation, err error) {
-		if err != nil {
-			logrus.WithError(err).WithFields(logrus.Fields{
-				"chargePointID": chargePointID,
-				"connectorID":   connectorID,
-			}).Error("Trigger status notification request failed")
-			return
-		}
-
-		logrus.WithFields(logrus.Fields{
-			"chargePointID": chargePointID,
-			"connectorID":   connectorID,
-			"status":        confirmation.Status,
-		}).Info("Trigger status notification request processed")
-	}
+// TriggerMessages are the messages a charge point can be asked to send with TriggerMessage
+var TriggerMessages = []string{
+	core.BootNotificationFeatureName,
+	firmware.DiagnosticsStatusNotificationFeatureName,
+	firmware.FirmwareStatusNotificationFeatureName,
+	core.HeartbeatFeatureName,
+	core.MeterValuesFeatureName,
+	core.StatusNotificationFeatureName,
+}
 
-	return s.centralSystem.OcppServer.TriggerMessage(chargePointID, callback, core.StatusNotificationFeatureName, func(request *remotetrigger.TriggerMessageRequest) {
-		if connectorID > 0 {
-			request.ConnectorId = &connectorID
+// IsTriggerMessage reports whether a message is one of the TriggerMessages
+func IsTriggerMessage(message string) bool {
+	for _, m := range TriggerMessages {
+		if m == message {
+			return true
 		}
-	})
+	}
+	return false
 }
 
-// GetDiagnostics requests the charge point to upload diagnostics to a remote location
-func (s *CPMS) GetDiagnostics(ctx context.Context, chargePointID string, location string, startTime, stopTime time.Time) error {
-	callback := func(confirmation *firmware.GetDiagnosticsConfirmation, err error) {
-		if err != nil {
-			logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Get diagnostics request failed")
-			return
-		}
+// TriggerMessage asks a charge point to send one of the TriggerMessages, for a single connector if connectorID is positive
+func (s *CPMS) TriggerMessage(ctx context.Context, chargePointID, requestedMessage string, connectorID int) (*models.Command, error) {
+	if !IsTriggerMessage(requestedMessage) {
+		return nil, fmt.Errorf("invalid trigger message: %s", requestedMessage)
+	}
 
-		logrus.WithFields(logrus.Fields{
-			"chargePointID": chargePointID,
-			"fileName":      confirmation.FileName,
-		}).Info("Get diagnostics request processed")
+	req := remotetrigger.NewTriggerMessageRequest(remotetrigger.MessageTrigger(requestedMessage))
+	if connectorID > 0 {
+		req.ConnectorId = &connectorID
 	}
 
-	return s.centralSystem.OcppServer.GetDiagnostics(chargePointID, callback, location, func(request *firmware.GetDiagnosticsRequest) {
-		if !startTime.IsZero() {
-			request.StartTime = types.NewDateTime(startTime)
-		}
-		if !stopTime.IsZero() {
-			request.EndTime = types.NewDateTime(stopTime)
-		}
-	})
+	return s.sendCommand(ctx, chargePointID, req)
 }
 
-// UpdateFirmware requests the charge point to download and install new firmware
-func (s *CPMS) UpdateFirmware(ctx context.Context, chargePointID string, location string, retrieveDate time.Time) error {
-	callback := func(confirmation *firmware.UpdateFirmwareConfirmation, err error) {
-		if err != nil {
-			logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Update firmware request failed")
-			return
-		}
-
-		logrus.WithField("chargePointID", chargePointID).Info("Update firmware request processed")
+// GetDiagnostics requests the charge point to upload diagnostics to a remote location
+func (s *CPMS) GetDiagnostics(ctx context.Context, chargePointID string, location string, startTime, stopTime time.Time) (*models.Command, error) {
+	req := firmware.NewGetDiagnosticsRequest(location)
+	if !startTime.IsZero() {
+		req.StartTime = types.NewDateTime(startTime)
+	}
+	if !stopTime.IsZero() {
+		req.EndTime = types.NewDateTime(stopTime)
 	}
 
-	dt := types.NewDateTime(retrieveDate)
-	return s.centralSystem.OcppServer.UpdateFirmware(chargePointID, callback, location, dt)
+	return s.sendCommand(ctx, chargePointID, req)
 }
 
 // ClearCache requests the charge point to clear its authorization cache
-func (s *CPMS) ClearCache(ctx context.Context, chargePointID string) error {
-	callback := func(confirmation *core.ClearCacheConfirmation, err error) {
-		if err != nil {
-			logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Clear cache request failed")
-			return
-		}
-
-		logrus.WithFields(logrus.Fields{
-			"chargePointID": chargePointID,
-			"status":        confirmation.Status,
-		}).Info("Clear cache request processed")
-	}
-
-	return s.centralSystem.OcppServer.ClearCache(chargePointID, callback)
+func (s *CPMS) ClearCache(ctx context.Context, chargePointID string) (*models.Command, error) {
+	return s.sendCommand(ctx, chargePointID, core.NewClearCacheRequest())
 }
 
 // GetConfiguration retrieves the charge point's configuration
-func (s *CPMS) GetConfiguration(ctx context.Context, chargePointID string, keys []string) error {
-	callback := func(confirmation *core.GetConfigurationConfirmation, err error) {
-		if err != nil {
-			logrus.WithError(err).WithField("chargePointID", chargePointID).Error("Get configuration request failed")
-			return
-		}
-
-		logrus.WithFields(logrus.Fields{
-			"chargePointID":     chargePointID,
-			"configurationKeys": len(confirmation.ConfigurationKey),
-			"unknownKeys":       len(confirmation.UnknownKey),
-		}).Info("Get configuration request processed")
-	}
-
-	return s.centralSystem.OcppServer.GetConfiguration(chargePointID, callback, keys)
+func (s *CPMS) GetConfiguration(ctx context.Context, chargePointID string, keys []string) (*models.Command, error) {
+	return s.sendCommand(ctx, chargePointID, core.NewGetConfigurationRequest(keys))
 }
 
 // ChangeConfiguration changes a configuration key on the charge point
-func (s *CPMS) ChangeConfiguration(ctx context.Context, chargePointID string, key string, value string) error {
-	callback := func(confirmation *core.ChangeConfigurationConfirmation, err error) {
-		if err != nil {
-			logrus.WithError(err).WithFields(logrus.Fields{
-				"chargePointID": chargePointID,
-				"key":           key,
-			}).Error("Change configuration request failed")
-			return
-		}
-
-		logrus.WithFields(logrus.Fields{
-			"chargePointID": chargePointID,
-			"key":           key,
-			"status":        confirmation.Status,
-		}).Info("Change configuration request processed")
+func (s *CPMS) ChangeConfiguration(ctx context.Context, chargePointID string, key string, value string) (*models.Command, error) {
+	if err := s.checkFreeze(ctx, chargePointID, FreezeActionConfiguration); err != nil {
+		return nil, err
 	}
 
-	return s.centralSystem.OcppServer.ChangeConfiguration(chargePointID, callback, key, value)
+	return s.sendCommand(ctx, chargePointID, core.NewChangeConfigurationRequest(key, value))
 }
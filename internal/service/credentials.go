@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/sirupsen/logrus"
+)
+
+// Statuses of credential rotations set by the CPMS. Rotations become Completed once the charge point
+// reconnects with its new password, and Superseded when another rotation is started.
+const (
+	CredentialRotationPending           = "Pending"
+	CredentialRotationAwaitingReconnect = "AwaitingReconnect"
+	CredentialRotationFailed            = "Failed"
+)
+
+// credentialCommandTimeout is how long a rotation waits for the charge point to confirm its new AuthorizationKey
+const credentialCommandTimeout = time.Minute
+
+// RotateCredentials starts the rotation of a charge point's basic auth password. A new random password is pushed
+// to the charge point as its AuthorizationKey; the current password stays valid until the charge point reconnects
+// with the new one, which completes the rotation. Charge points without a password get their first one this way.
+func (s *CPMS) RotateCredentials(ctx context.Context, chargePointID string) (*models.CredentialRotation, error) {
+	if err := s.checkFreeze(ctx, chargePointID, FreezeActionConfiguration); err != nil {
+		return nil, err
+	}
+	if _, err := s.db.GetChargePoint(ctx, chargePointID); err != nil {
+		return nil, err
+	}
+
+	// 20 random bytes as 40 hex digits, the longest AuthorizationKey of the OCPP 1.6 security profiles
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate password: %v", err)
+	}
+	password := hex.EncodeToString(buf)
+
+	rotation := &models.CredentialRotation{
+		ChargePointID: chargePointID,
+		Status:        CredentialRotationPending,
+		Actor:         ActorFromContext(ctx),
+		PasswordHash:  db.HashPassword(password),
+	}
+	if err := s.db.CreateCredentialRotation(ctx, rotation); err != nil {
+		return nil, fmt.Errorf("failed to create credential rotation: %v", err)
+	}
+
+	s.audit(ctx, "chargepoint.credentials.rotate", "chargepoint", chargePointID, map[string]interface{}{
+		"rotationId": rotation.ID,
+	})
+
+	cmd, err := s.sendCommand(ctx, chargePointID, core.NewChangeConfigurationRequest(ocpp.AuthorizationKey, password))
+	if cmd != nil {
+		rotation.CommandID = cmd.ID
+	}
+	if err != nil {
+		// The password never reached the charge point
+		rotation.Status = CredentialRotationFailed
+		rotation.Error = err.Error()
+		s.updateCredentialRotation(rotation)
+		return nil, err
+	}
+
+	s.updateCredentialRotation(rotation)
+	awaiting := *rotation
+	go s.awaitCredentialCommand(&awaiting, cmd)
+
+	return rotation, nil
+}
+
+// GetCredentialRotations returns the most recent credential rotations of a charge point
+func (s *CPMS) GetCredentialRotations(ctx context.Context, chargePointID string, limit int) ([]*models.CredentialRotation, error) {
+	return s.db.GetCredentialRotations(ctx, chargePointID, limit)
+}
+
+// awaitCredentialCommand records the charge point's confirmation of its new AuthorizationKey. Only an explicit
+// refusal fails the rotation: without a confirmation the charge point may still have applied the password,
+// so the rotation stays open and the new password valid.
+func (s *CPMS) awaitCredentialCommand(rotation *models.CredentialRotation, cmd *models.Command) {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialCommandTimeout+5*time.Second)
+	defer cancel()
+
+	result, err := s.waitForCommand(ctx, cmd, credentialCommandTimeout)
+	if err != nil {
+		logrus.WithError(err).WithField("rotationID", rotation.ID).Error("Failed to get the AuthorizationKey command")
+		return
+	}
+
+	switch result.Status {
+	case string(core.ConfigurationStatusAccepted), string(core.ConfigurationStatusRebootRequired):
+		rotation.Status = CredentialRotationAwaitingReconnect
+	case string(core.ConfigurationStatusRejected), string(core.ConfigurationStatusNotSupported):
+		rotation.Status = CredentialRotationFailed
+		rotation.Error = "Charge point responded " + result.Status + " to the new AuthorizationKey"
+	case CommandStatusFailed:
+		rotation.Error = "No confirmation of the new AuthorizationKey: " + result.Error
+	default:
+		rotation.Error = "No confirmation of the new AuthorizationKey"
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"chargePointID": rotation.ChargePointID,
+		"rotationID":    rotation.ID,
+		"status":        rotation.Status,
+		"error":         rotation.Error,
+	}).Info("Credential rotation updated")
+
+	s.updateCredentialRotation(rotation)
+}
+
+func (s *CPMS) updateCredentialRotation(rotation *models.CredentialRotation) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.db.UpdateCredentialRotation(ctx, rotation); err != nil {
+		logrus.WithError(err).WithField("rotationID", rotation.ID).Error("Failed to update credential rotation")
+	}
+}
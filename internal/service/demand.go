@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// GetSiteDemand returns the demand report of a site in [from, to) for sizing its grid connection. The demand of
+// an hour is the energy its connectors delivered in that hour, which equals their average power in kW.
+func (s *CPMS) GetSiteDemand(ctx context.Context, siteID string, from, to time.Time) (*models.DemandReport, error) {
+	if _, err := s.db.GetSite(ctx, siteID); err != nil {
+		return nil, err
+	}
+
+	chargePointIDs, err := s.db.GetChargePointIDsForSite(ctx, siteID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.DemandReport{
+		SiteID:     siteID,
+		From:       from,
+		To:         to,
+		Connectors: []*models.ConnectorDemand{},
+		Days:       []*models.DailyDemand{},
+		Hours:      []*models.HourlyDemand{},
+	}
+
+	type connectorKey struct {
+		chargePointID string
+		connectorID   int
+		day           time.Time
+	}
+	hours := make(map[time.Time]*models.HourlyDemand)
+	dailyPeaks := make(map[connectorKey]float64)
+	connectors := make(map[connectorKey]*models.ConnectorDemand)
+	for _, chargePointID := range chargePointIDs {
+		energy, err := s.db.GetHourlyEnergy(ctx, chargePointID, from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range energy {
+			if e.EnergyKWh <= 0 {
+				continue
+			}
+
+			hour, ok := hours[e.Hour]
+			if !ok {
+				hour = &models.HourlyDemand{Hour: e.Hour}
+				hours[e.Hour] = hour
+			}
+			hour.PowerKW += e.EnergyKWh
+			hour.ActiveConnectors++
+
+			key := connectorKey{chargePointID: chargePointID, connectorID: e.ConnectorID}
+			connector, ok := connectors[key]
+			if !ok {
+				connector = &models.ConnectorDemand{ChargePointID: chargePointID, ConnectorID: e.ConnectorID}
+				connectors[key] = connector
+				report.Connectors = append(report.Connectors, connector)
+			}
+			if e.EnergyKWh > connector.PeakPowerKW {
+				connector.PeakPowerKW = e.EnergyKWh
+				connector.PeakHour = e.Hour
+			}
+
+			key.day = e.Hour.UTC().Truncate(24 * time.Hour)
+			if e.EnergyKWh > dailyPeaks[key] {
+				dailyPeaks[key] = e.EnergyKWh
+			}
+		}
+	}
+
+	for _, hour := range hours {
+		report.Hours = append(report.Hours, hour)
+	}
+	sort.Slice(report.Hours, func(i, j int) bool {
+		return report.Hours[i].Hour.Before(report.Hours[j].Hour)
+	})
+
+	days := make(map[time.Time]*models.DailyDemand)
+	for _, hour := range report.Hours {
+		if hour.PowerKW > report.PeakPowerKW {
+			report.PeakPowerKW = hour.PowerKW
+			report.PeakHour = hour.Hour
+		}
+
+		day := hour.Hour.UTC().Truncate(24 * time.Hour)
+		daily, ok := days[day]
+		if !ok {
+			daily = &models.DailyDemand{Day: day}
+			days[day] = daily
+			report.Days = append(report.Days, daily)
+		}
+		if hour.PowerKW > daily.PeakPowerKW {
+			daily.PeakPowerKW = hour.PowerKW
+			daily.PeakHour = hour.Hour
+		}
+	}
+	for key, peak := range dailyPeaks {
+		days[key.day].ConnectorPeaksKW += peak
+	}
+	for _, daily := range report.Days {
+		daily.CoincidenceFactor = coincidenceFactor(daily.PeakPowerKW, daily.ConnectorPeaksKW)
+	}
+
+	sort.Slice(report.Connectors, func(i, j int) bool {
+		a, b := report.Connectors[i], report.Connectors[j]
+		if a.ChargePointID != b.ChargePointID {
+			return a.ChargePointID < b.ChargePointID
+		}
+		return a.ConnectorID < b.ConnectorID
+	})
+	for _, connector := range report.Connectors {
+		report.ConnectorPeaksKW += connector.PeakPowerKW
+	}
+	report.CoincidenceFactor = coincidenceFactor(report.PeakPowerKW, report.ConnectorPeaksKW)
+
+	return report, nil
+}
+
+// coincidenceFactor returns the ratio of a site's peak demand to the sum of its connectors' peak demands, 0 without demand
+func coincidenceFactor(peakKW, connectorPeaksKW float64) float64 {
+	if connectorPeaksKW <= 0 {
+		return 0
+	}
+	return peakKW / connectorPeaksKW
+}
@@ -0,0 +1,298 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/sirupsen/logrus"
+)
+
+// departureSlot is a part of the time before a departure with a single spot price
+type departureSlot struct {
+	start    time.Time
+	end      time.Time
+	price    float64
+	hasPrice bool
+	power    float64 // kW scheduled in the slot
+}
+
+// chargingPlan is the energy a transaction is scheduled to be charged with by a deadline
+type chargingPlan struct {
+	energy         float64 // kWh
+	deadline       time.Time
+	priceOptimized bool
+}
+
+// SetTransactionDeparture sets the energy in kWh an in-progress transaction needs by its departure time and
+// sends it a charging schedule delivering it, in the cheapest spot price hours if priceOptimized is set.
+// The schedule is updated with the energy delivered until the departure time. A zero target energy removes it.
+func (s *CPMS) SetTransactionDeparture(ctx context.Context, id int, targetEnergy float64, departure time.Time, priceOptimized bool) error {
+	if err := s.db.SetTransactionDeparture(ctx, id, targetEnergy, departure, priceOptimized); err != nil {
+		return err
+	}
+	s.audit(ctx, "transaction.departure", "transaction", strconv.Itoa(id), map[string]interface{}{
+		"targetEnergy":   targetEnergy,
+		"departureTime":  departure,
+		"priceOptimized": priceOptimized,
+	})
+	return s.rescheduleTransaction(ctx, id)
+}
+
+// SetTransactionSpotOptOut excludes an in-progress transaction from spot price optimized charging, or includes it again
+func (s *CPMS) SetTransactionSpotOptOut(ctx context.Context, id int, optOut bool) error {
+	if err := s.db.SetTransactionSpotOptOut(ctx, id, optOut); err != nil {
+		return err
+	}
+	s.audit(ctx, "transaction.spotoptout", "transaction", strconv.Itoa(id), map[string]interface{}{"optOut": optOut})
+
+	// Opt-outs only change the schedules of spot price optimized charging
+	if !s.config.SpotChargingEnabled {
+		return nil
+	}
+	if err := s.rescheduleTransaction(ctx, id); err != nil {
+		logrus.WithError(err).WithField("transactionId", id).Warn("Failed to update charging schedule")
+	}
+	return nil
+}
+
+// SetChargePointSpotOptOut excludes the transactions of a charge point from spot price optimized charging,
+// or includes them again
+func (s *CPMS) SetChargePointSpotOptOut(ctx context.Context, chargePointID string, optOut bool) error {
+	if err := s.db.SetChargePointSpotOptOut(ctx, chargePointID, optOut); err != nil {
+		return err
+	}
+	s.audit(ctx, "chargepoint.spotoptout", "chargepoint", chargePointID, map[string]interface{}{"optOut": optOut})
+
+	if !s.config.SpotChargingEnabled {
+		return nil
+	}
+	transactions, _, err := s.db.GetTransactions(ctx, db.TransactionFilter{ChargePointID: chargePointID, Status: "InProgress"}, db.Sort{}, db.Page{})
+	if err != nil {
+		return err
+	}
+	for _, tx := range transactions {
+		if err := s.rescheduleTransaction(ctx, tx.ID); err != nil {
+			logrus.WithError(err).WithField("transactionId", tx.ID).Warn("Failed to update charging schedule")
+		}
+	}
+	return nil
+}
+
+// rescheduleTransaction sends a transaction the charging schedule of its plan,
+// or removes its schedule if its charging is no longer scheduled
+func (s *CPMS) rescheduleTransaction(ctx context.Context, id int) error {
+	tx, err := s.db.GetTransaction(ctx, id)
+	if err != nil {
+		return err
+	}
+	cp, err := s.db.GetChargePoint(ctx, tx.ChargePointID)
+	if err != nil {
+		return err
+	}
+
+	plan, ok := s.chargingPlanOf(tx, cp.SpotOptOut, time.Now())
+	if !ok {
+		return s.ClearChargingProfile(ctx, tx.ChargePointID, departureProfileID)
+	}
+	return s.scheduleCharging(ctx, tx, plan)
+}
+
+// chargingPlanOf returns the charging plan of a transaction. Transactions with a departure time are charged
+// with their target energy by then. With spot price optimized charging enabled, the other transactions are
+// charged with the default energy by the default deadline, and all transactions are deferred to the cheapest
+// hours unless they or their charge point opt out. It reports false if the charging of a transaction is not
+// scheduled, or no longer is after its deadline.
+func (s *CPMS) chargingPlanOf(tx *models.Transaction, chargePointOptOut bool, now time.Time) (chargingPlan, bool) {
+	spot := s.config.SpotChargingEnabled && !tx.SpotOptOut && !chargePointOptOut
+
+	var plan chargingPlan
+	switch {
+	case tx.TargetEnergy > 0:
+		plan = chargingPlan{energy: tx.TargetEnergy, deadline: tx.DepartureTime, priceOptimized: tx.PriceOptimized || spot}
+	case spot:
+		deadline := tx.StartTime.Add(time.Duration(s.config.SpotChargingDeadline) * time.Hour)
+		plan = chargingPlan{energy: s.config.SpotChargingEnergy, deadline: deadline, priceOptimized: true}
+	default:
+		return chargingPlan{}, false
+	}
+	return plan, plan.deadline.After(now)
+}
+
+// scheduleCharging sends a transaction the charging schedule delivering the remaining energy of its plan by the deadline
+func (s *CPMS) scheduleCharging(ctx context.Context, tx *models.Transaction, plan chargingPlan) error {
+	latest, err := s.db.GetLatestMeterValues(ctx, []int{tx.ID}, energyMeasurand)
+	if err != nil {
+		return err
+	}
+	remaining := plan.energy
+	if mv, ok := latest[tx.ID]; ok {
+		remaining -= (mv.EnergyWh() - float64(tx.MeterStart)) / 1000
+	}
+
+	maxPower, err := s.connectorMaxPower(ctx, tx.ChargePointID, tx.ConnectorID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Truncate(time.Second)
+	slots := departureSlots(now, plan.deadline)
+	if plan.priceOptimized && len(slots) > 0 {
+		prices, err := s.db.GetSpotPrices(ctx, s.config.PriceArea, now.Truncate(time.Hour), plan.deadline)
+		if err != nil {
+			return err
+		}
+		pricedSlots(slots, prices)
+	}
+	planDeparture(slots, remaining, maxPower, plan.priceOptimized)
+
+	// Past the deadline the transaction charges at full power
+	schedule := types.NewChargingSchedule(types.ChargingRateUnitWatts, types.NewChargingSchedulePeriod(0, math.Round(maxPower*1000)))
+	if len(slots) > 0 {
+		schedule.ChargingSchedulePeriod = nil
+		for _, slot := range slots {
+			limit := math.Round(slot.power * 1000)
+			periods := schedule.ChargingSchedulePeriod
+			if len(periods) > 0 && periods[len(periods)-1].Limit == limit {
+				continue
+			}
+			schedule.ChargingSchedulePeriod = append(periods, types.NewChargingSchedulePeriod(int(slot.start.Sub(now).Seconds()), limit))
+		}
+		duration := int(plan.deadline.Sub(now).Seconds())
+		schedule.Duration = &duration
+	}
+	schedule.StartSchedule = types.NewDateTime(now)
+
+	profile := types.NewChargingProfile(departureProfileID, departureStackLevel, types.ChargingProfilePurposeTxProfile, types.ChargingProfileKindAbsolute, schedule)
+	profile.TransactionId = tx.ID
+
+	logrus.WithFields(logrus.Fields{
+		"transactionId":   tx.ID,
+		"remainingEnergy": remaining,
+		"deadline":        plan.deadline,
+		"priceOptimized":  plan.priceOptimized,
+		"periods":         len(schedule.ChargingSchedulePeriod),
+	}).Debug("Charging schedule computed")
+
+	return s.SetChargingProfile(ctx, tx.ChargePointID, tx.ConnectorID, profile)
+}
+
+// connectorMaxPower returns the maximum power in kW maintained for a connector, or the configured default
+func (s *CPMS) connectorMaxPower(ctx context.Context, chargePointID string, connectorID int) (float64, error) {
+	connectors, _, err := s.db.GetConnectors(ctx, chargePointID, db.Page{})
+	if err != nil {
+		return 0, err
+	}
+	for _, connector := range connectors {
+		if connector.ID == connectorID && connector.MaxPowerKW > 0 {
+			return connector.MaxPowerKW, nil
+		}
+	}
+	return s.config.DepartureDefaultMaxPower, nil
+}
+
+// departureSlots splits the time from now until the departure at the hours spot prices change
+func departureSlots(now, departure time.Time) []*departureSlot {
+	var slots []*departureSlot
+	for start := now; start.Before(departure); {
+		end := start.Truncate(time.Hour).Add(time.Hour)
+		if end.After(departure) {
+			end = departure
+		}
+		slots = append(slots, &departureSlot{start: start, end: end})
+		start = end
+	}
+	return slots
+}
+
+// pricedSlots sets the spot prices of the slots
+func pricedSlots(slots []*departureSlot, prices []*models.SpotPrice) {
+	byHour := make(map[int64]float64, len(prices))
+	for _, price := range prices {
+		byHour[price.HourStart.Unix()] = price.PricePerMWh
+	}
+	for _, slot := range slots {
+		slot.price, slot.hasPrice = byHour[slot.start.Truncate(time.Hour).Unix()]
+	}
+}
+
+// planDeparture spreads the remaining energy in kWh over the slots, evenly or filling the cheapest slots first.
+// Slots without a spot price are filled last. Power is capped at maxPower in kW.
+func planDeparture(slots []*departureSlot, remaining, maxPower float64, priceOptimized bool) {
+	if remaining <= 0 || len(slots) == 0 {
+		return
+	}
+
+	if !priceOptimized {
+		hours := slots[len(slots)-1].end.Sub(slots[0].start).Hours()
+		power := math.Min(remaining/hours, maxPower)
+		for _, slot := range slots {
+			slot.power = power
+		}
+		return
+	}
+
+	order := make([]*departureSlot, len(slots))
+	copy(order, slots)
+	sort.SliceStable(order, func(i, j int) bool {
+		if order[i].hasPrice != order[j].hasPrice {
+			return order[i].hasPrice
+		}
+		return order[i].price < order[j].price
+	})
+	for _, slot := range order {
+		if remaining <= 0 {
+			break
+		}
+		hours := slot.end.Sub(slot.start).Hours()
+		energy := math.Min(remaining, maxPower*hours)
+		slot.power = energy / hours
+		remaining -= energy
+	}
+}
+
+// runDepartureScheduling periodically updates the charging schedules of the transactions with a departure time,
+// and of all transactions not opted out of spot price optimized charging if it is enabled
+func (s *CPMS) runDepartureScheduling() {
+	ticker := time.NewTicker(time.Duration(s.config.DepartureScheduleInterval) * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		transactions, _, err := s.db.GetTransactions(ctx, db.TransactionFilter{Status: "InProgress"}, db.Sort{}, db.Page{})
+		if err != nil {
+			logrus.WithError(err).Error("Failed to get transactions for departure scheduling")
+			cancel()
+			continue
+		}
+
+		optOuts := make(map[string]bool) // Charge point ID -> opted out of spot price optimized charging
+		for _, tx := range transactions {
+			optOut, ok := optOuts[tx.ChargePointID]
+			if !ok {
+				cp, err := s.db.GetChargePoint(ctx, tx.ChargePointID)
+				if err != nil {
+					logrus.WithError(err).WithField("chargePointID", tx.ChargePointID).Warn("Failed to get charge point for charging scheduling")
+					continue
+				}
+				optOut = cp.SpotOptOut
+				optOuts[tx.ChargePointID] = optOut
+			}
+
+			// Past the deadline the schedule has expired and the transaction charges at full power
+			plan, ok := s.chargingPlanOf(tx, optOut, time.Now())
+			if !ok {
+				continue
+			}
+			if err := s.scheduleCharging(ctx, tx, plan); err != nil {
+				logrus.WithError(err).WithField("transactionId", tx.ID).Warn("Failed to update charging schedule")
+			}
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/sirupsen/logrus"
+)
+
+// diagnosticsTimeout is how long a fault-driven GetDiagnostics waits for the charge point's confirmation
+const diagnosticsTimeout = 30 * time.Second
+
+// diagnosticsKey identifies a connector of a charge point
+type diagnosticsKey struct {
+	chargePointID string
+	connectorID   int
+}
+
+// diagnosticsFile is a diagnostics file collected for a connector fault
+type diagnosticsFile struct {
+	location    string
+	collectedAt time.Time
+}
+
+// diagnosticsCollector rate limits fault-driven diagnostics collection per charge point
+// and remembers the latest file collected for each connector
+type diagnosticsCollector struct {
+	mu        sync.Mutex
+	requested map[string]time.Time // Charge point -> last collection
+	files     map[diagnosticsKey]diagnosticsFile
+}
+
+func newDiagnosticsCollector() *diagnosticsCollector {
+	return &diagnosticsCollector{
+		requested: make(map[string]time.Time),
+		files:     make(map[diagnosticsKey]diagnosticsFile),
+	}
+}
+
+// allow reports whether diagnostics may be collected from a charge point, and if so records the collection
+func (c *diagnosticsCollector) allow(chargePointID string, interval time.Duration, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if last, ok := c.requested[chargePointID]; ok && now.Sub(last) < interval {
+		return false
+	}
+	c.requested[chargePointID] = now
+	return true
+}
+
+func (c *diagnosticsCollector) store(key diagnosticsKey, file diagnosticsFile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files[key] = file
+}
+
+// file returns the location of the latest diagnostics of a connector collected since a time, empty if there is none
+func (c *diagnosticsCollector) file(key diagnosticsKey, since time.Time) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	file, ok := c.files[key]
+	if !ok || file.collectedAt.Before(since) {
+		return ""
+	}
+	return file.location
+}
+
+// collectsDiagnostics reports whether a connector status triggers diagnostics collection
+func (s *CPMS) collectsDiagnostics(status, errorCode string) bool {
+	if s.config.DiagnosticsLocation == "" || status != "Faulted" {
+		return false
+	}
+	if len(s.config.DiagnosticsErrorCodes) == 0 {
+		return errorCode != "NoError"
+	}
+	for _, code := range s.config.DiagnosticsErrorCodes {
+		if code == errorCode {
+			return true
+		}
+	}
+	return false
+}
+
+// handleDiagnosticsEvent collects diagnostics from a charge point when one of its connectors faults.
+// It is subscribed to the event bus, whose handlers must not block.
+func (s *CPMS) handleDiagnosticsEvent(event events.Event) {
+	if event.Type != events.ConnectorFault {
+		return
+	}
+	data, ok := event.Data.(*models.ConnectorStatusEvent)
+	if !ok || !s.collectsDiagnostics(data.Status, data.ErrorCode) {
+		return
+	}
+
+	now := time.Now()
+	interval := time.Duration(s.config.DiagnosticsInterval) * time.Minute
+	if !s.diagnostics.allow(data.ChargePointID, interval, now) {
+		logrus.WithFields(logrus.Fields{
+			"chargePointID": data.ChargePointID,
+			"connectorId":   data.ConnectorID,
+		}).Debug("Skipping diagnostics collection, collected recently")
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout+5*time.Second)
+		defer cancel()
+
+		s.collectDiagnostics(ctx, data, now)
+	}()
+}
+
+// collectDiagnostics requests the diagnostics of the time leading up to a connector fault and attaches
+// the file the charge point uploads to the connector's firing alerts
+func (s *CPMS) collectDiagnostics(ctx context.Context, fault *models.ConnectorStatusEvent, now time.Time) {
+	fields := logrus.Fields{
+		"chargePointID": fault.ChargePointID,
+		"connectorId":   fault.ConnectorID,
+		"errorCode":     fault.ErrorCode,
+	}
+
+	startTime := now.Add(-time.Duration(s.config.DiagnosticsLookback) * time.Minute)
+	cmd, err := s.GetDiagnostics(ctx, fault.ChargePointID, s.config.DiagnosticsLocation, startTime, time.Time{})
+	if err != nil {
+		logrus.WithError(err).WithFields(fields).Error("Failed to request diagnostics for connector fault")
+		return
+	}
+
+	cmd, err = s.waitForCommand(ctx, cmd, diagnosticsTimeout)
+	if err != nil {
+		logrus.WithError(err).WithFields(fields).Error("Failed to get diagnostics result")
+		return
+	}
+
+	var conf struct {
+		FileName string `json:"fileName"`
+	}
+	if len(cmd.Response) > 0 {
+		_ = json.Unmarshal(cmd.Response, &conf)
+	}
+	if conf.FileName == "" {
+		fields["status"] = cmd.Status
+		logrus.WithFields(fields).Warn("Charge point returned no diagnostics file for connector fault")
+		return
+	}
+
+	key := diagnosticsKey{chargePointID: fault.ChargePointID, connectorID: fault.ConnectorID}
+	location := strings.TrimSuffix(s.config.DiagnosticsLocation, "/") + "/" + conf.FileName
+	s.diagnostics.store(key, diagnosticsFile{location: location, collectedAt: now})
+
+	fields["diagnosticsFile"] = location
+	logrus.WithFields(fields).Info("Diagnostics collected for connector fault")
+
+	// Alerts fired from now on pick up the stored file, those already firing get it attached
+	s.alerts.mu.Lock()
+	defer s.alerts.mu.Unlock()
+
+	firing, err := s.firingAlerts(ctx)
+	if err != nil {
+		logrus.WithError(err).WithFields(fields).Error("Failed to get firing alerts for diagnostics")
+		return
+	}
+	for alertKey, alert := range firing {
+		if alertKey.chargePointID != key.chargePointID || alertKey.connectorID != key.connectorID || alert.DiagnosticsFile != "" {
+			continue
+		}
+		if err := s.db.SetAlertDiagnostics(ctx, alert.ID, location); err != nil {
+			logrus.WithError(err).WithField("alertID", alert.ID).Error("Failed to attach diagnostics to alert")
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/balu-dk/go-cpms/config"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+	"github.com/sirupsen/logrus"
+)
+
+// commandQueueInterval is how often the charge points with queued commands are checked for a reconnect
+const commandQueueInterval = 5 * time.Second
+
+// dispatchedCommand is a command on its way to a charge point, possibly through retries and the queue
+type dispatchedCommand struct {
+	cmd      *models.Command
+	request  ocpp.Request
+	payload  json.RawMessage // Unmasked payload for forwarding to another instance
+	attempts int
+	queuedAt time.Time
+}
+
+// commandQueue holds the commands waiting for their offline charge points to reconnect, in send order
+type commandQueue struct {
+	mu       sync.Mutex
+	commands map[string][]*dispatchedCommand // Charge point ID -> queued commands
+}
+
+func newCommandQueue() *commandQueue {
+	return &commandQueue{commands: make(map[string][]*dispatchedCommand)}
+}
+
+func (q *commandQueue) push(dc *dispatchedCommand) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.commands[dc.cmd.ChargePointID] = append(q.commands[dc.cmd.ChargePointID], dc)
+}
+
+// chargePoints returns the IDs of the charge points with queued commands
+func (q *commandQueue) chargePoints() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ids := make([]string, 0, len(q.commands))
+	for id := range q.commands {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// take removes and returns the queued commands of a charge point
+func (q *commandQueue) take(chargePointID string) []*dispatchedCommand {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	commands := q.commands[chargePointID]
+	delete(q.commands, chargePointID)
+	return commands
+}
+
+// commandRetryPolicy returns the retry policy of an action, a single attempt without a configured policy
+func (s *CPMS) commandRetryPolicy(action string) config.CommandRetryPolicy {
+	if policy, ok := s.config.CommandRetryPolicies[action]; ok {
+		return policy
+	}
+	if policy, ok := s.config.CommandRetryPolicies["*"]; ok {
+		return policy
+	}
+	return config.CommandRetryPolicy{MaxAttempts: 1}
+}
+
+// isTransientCommandError reports whether a command failed because the charge point was offline, disconnected
+// while the command was pending or didn't respond in time, rather than because the charge point rejected it
+func isTransientCommandError(err error) bool {
+	if errors.Is(err, ErrChargePointOffline) {
+		return true
+	}
+
+	var ocppErr *ocpp.Error
+	if !errors.As(err, &ocppErr) || ocppErr.Code != ocppj.GenericError {
+		return false
+	}
+	// Raised by the websocket layer rather than sent by the charge point
+	return ocppErr.Description == "Request timed out" || ocppErr.Description == "client disconnected, no response received from client"
+}
+
+// dispatchCommand sends a command to the charge point, through the instance holding its websocket if that is another one.
+// Transient failures are retried or queued according to the retry policy, the callback completes the command otherwise.
+// It returns the error of a command failing finally before it was sent, which the caller completes the command with.
+func (s *CPMS) dispatchCommand(ctx context.Context, dc *dispatchedCommand) error {
+	cmd := dc.cmd
+
+	// The charge point may be connected to another instance of the cluster, which doesn't retry forwarded commands
+	if instanceURL, ok := s.remoteInstanceURL(ctx, cmd.ChargePointID); ok {
+		go s.forwardCommand(cmd, dc.payload, instanceURL)
+		return nil
+	}
+
+	err := ErrChargePointOffline
+	if s.centralSystem.IsLocal(cmd.ChargePointID) {
+		callback := func(confirmation ocpp.Response, err error) {
+			if err != nil && s.retryCommand(dc, err) {
+				return
+			}
+			s.completeDispatched(dc, confirmation, err)
+		}
+
+		if err = s.centralSystem.SendCommandAsync(cmd.ChargePointID, cmd.RequestID, dc.request, callback); err == nil {
+			return nil
+		}
+	}
+
+	if s.retryCommand(dc, err) {
+		return nil
+	}
+	return err
+}
+
+// retryCommand schedules the next attempt of a command that failed with a transient error, or queues it
+// until its charge point reconnects, as the retry policy of its action allows. It reports whether the
+// command remains pending.
+func (s *CPMS) retryCommand(dc *dispatchedCommand, err error) bool {
+	if !isTransientCommandError(err) {
+		return false
+	}
+
+	cmd := dc.cmd
+	policy := s.commandRetryPolicy(cmd.Action)
+	fields := logrus.Fields{
+		"chargePointID": cmd.ChargePointID,
+		"action":        cmd.Action,
+		"commandID":     cmd.ID,
+		"attempt":       dc.attempts,
+	}
+
+	// Queued commands keep their attempts, they are sent once the charge point reconnects
+	if policy.QueueOnDisconnect && !s.centralSystem.IsLocal(cmd.ChargePointID) {
+		if dc.queuedAt.IsZero() {
+			dc.queuedAt = time.Now()
+		}
+		s.commandQueue.push(dc)
+		logrus.WithError(err).WithFields(fields).Warn("Command queued until the charge point reconnects")
+		return true
+	}
+
+	if dc.attempts >= policy.MaxAttempts {
+		return false
+	}
+
+	backoff := time.Duration(policy.Backoff) * time.Second << (dc.attempts - 1)
+	dc.attempts++
+	logrus.WithError(err).WithFields(fields).WithField("backoff", backoff).Warn("Command failed, retrying")
+
+	time.AfterFunc(backoff, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := s.dispatchCommand(ctx, dc); err != nil {
+			s.completeDispatched(dc, nil, err)
+		}
+	})
+	return true
+}
+
+// completeDispatched records the outcome of a dispatched command with its attempts. The command itself
+// may still be read by the sender, so the attempts are recorded on a copy.
+func (s *CPMS) completeDispatched(dc *dispatchedCommand, confirmation ocpp.Response, err error) {
+	cmd := *dc.cmd
+	cmd.Attempts = dc.attempts
+	_ = s.completeCommand(&cmd, confirmation, err)
+}
+
+// flushCommandQueue sends the queued commands of the charge points that reconnected,
+// and fails those whose charge point stayed offline beyond the queue timeout
+func (s *CPMS) flushCommandQueue(ctx context.Context) {
+	timeout := time.Duration(s.config.CommandQueueTimeout) * time.Second
+	now := time.Now()
+
+	for _, chargePointID := range s.commandQueue.chargePoints() {
+		_, remote := s.remoteInstanceURL(ctx, chargePointID)
+		connected := remote || s.centralSystem.IsLocal(chargePointID)
+
+		for _, dc := range s.commandQueue.take(chargePointID) {
+			switch {
+			case connected:
+				logrus.WithFields(logrus.Fields{
+					"chargePointID": chargePointID,
+					"action":        dc.cmd.Action,
+					"commandID":     dc.cmd.ID,
+				}).Info("Sending queued command to the reconnected charge point")
+				if err := s.dispatchCommand(ctx, dc); err != nil {
+					s.completeDispatched(dc, nil, err)
+				}
+			case now.Sub(dc.queuedAt) >= timeout:
+				s.completeDispatched(dc, nil, ErrChargePointOffline)
+			default:
+				s.commandQueue.push(dc)
+			}
+		}
+	}
+}
+
+// runCommandQueue periodically sends the commands queued for charge points that reconnected
+func (s *CPMS) runCommandQueue() {
+	ticker := time.NewTicker(commandQueueInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		s.flushCommandQueue(ctx)
+		cancel()
+	}
+}
@@ -0,0 +1,18 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// ExportTransactions streams every transaction started in [from, to) to fn
+func (s *CPMS) ExportTransactions(ctx context.Context, from, to time.Time, fn func(*models.Transaction) error) error {
+	return s.db.StreamTransactions(ctx, from, to, fn)
+}
+
+// ExportMeterValues streams every meter value of a charge point sampled in [from, to) to fn
+func (s *CPMS) ExportMeterValues(ctx context.Context, chargePointID string, from, to time.Time, fn func(*models.MeterValue) error) error {
+	return s.db.StreamMeterValues(ctx, chargePointID, from, to, fn)
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/firmware"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/sirupsen/logrus"
+)
+
+// firmwareRetryInterval is how often scheduled firmware retries are checked
+const firmwareRetryInterval = 30 * time.Second
+
+// ErrFirmwareUpdateNotDelivered is returned when an UpdateFirmware request could not be sent to the charge point.
+// The firmware update is recorded all the same, with a retry scheduled unless it has no attempts left.
+var ErrFirmwareUpdateNotDelivered = errors.New("update firmware request not delivered")
+
+// UpdateFirmware requests the charge point to download and install new firmware.
+// Failed downloads or installations are retried with backoff, rotating through the mirror locations.
+// If the request could not be delivered, the recorded update is returned with ErrFirmwareUpdateNotDelivered.
+func (s *CPMS) UpdateFirmware(ctx context.Context, chargePointID string, location string, mirrors []string, retrieveDate time.Time) (*models.FirmwareUpdate, error) {
+	if err := s.checkFreeze(ctx, chargePointID, FreezeActionFirmware); err != nil {
+		return nil, err
+	}
+
+	fu := &models.FirmwareUpdate{
+		ChargePointID: chargePointID,
+		Locations:     append([]string{location}, mirrors...),
+		RetrieveDate:  retrieveDate,
+		Status:        "Pending",
+		MaxAttempts:   s.config.FirmwareMaxAttempts,
+	}
+
+	if err := s.db.CreateFirmwareUpdate(ctx, fu); err != nil {
+		return nil, fmt.Errorf("failed to create firmware update: %v", err)
+	}
+
+	if err := s.sendFirmwareUpdate(ctx, fu); err != nil {
+		if errors.Is(err, ErrFirmwareUpdateNotDelivered) {
+			return fu, err
+		}
+		return nil, err
+	}
+
+	return fu, nil
+}
+
+// GetFirmwareUpdates returns the firmware update history of a charge point
+func (s *CPMS) GetFirmwareUpdates(ctx context.Context, chargePointID string) ([]*models.FirmwareUpdate, error) {
+	return s.db.GetFirmwareUpdates(ctx, chargePointID)
+}
+
+// sendFirmwareUpdate sends the next attempt of a firmware update to the charge point
+func (s *CPMS) sendFirmwareUpdate(ctx context.Context, fu *models.FirmwareUpdate) error {
+	fu.Attempts++
+	fu.Status = "Pending"
+	fu.NextRetryAt = time.Time{}
+	location := fu.CurrentLocation()
+
+	if err := s.db.UpdateFirmwareUpdate(ctx, fu); err != nil {
+		return fmt.Errorf("failed to update firmware update: %v", err)
+	}
+
+	chargePointID := fu.ChargePointID
+	callback := func(_ ocpp.Response, err error) {
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"chargePointID":    chargePointID,
+				"firmwareUpdateID": fu.ID,
+			}).Error("Update firmware request failed")
+			s.scheduleFirmwareRetry(fu, err.Error())
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"chargePointID":    chargePointID,
+			"firmwareUpdateID": fu.ID,
+			"location":         location,
+			"attempt":          fu.Attempts,
+		}).Info("Update firmware request processed")
+	}
+
+	request := firmware.NewUpdateFirmwareRequest(location, types.NewDateTime(fu.RetrieveDate))
+	if err := s.centralSystem.SendRequestAsync(chargePointID, request, callback); err != nil {
+		s.scheduleFirmwareRetry(fu, err.Error())
+		return fmt.Errorf("%w: %v", ErrFirmwareUpdateNotDelivered, err)
+	}
+
+	return nil
+}
+
+// scheduleFirmwareRetry schedules another attempt for a firmware update whose request could not be delivered.
+// An update without attempts left is marked as Failed, which fires the firmware_failed alert rules.
+func (s *CPMS) scheduleFirmwareRetry(fu *models.FirmwareUpdate, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	backoff := time.Duration(s.config.FirmwareRetryBackoff) * time.Second
+	retrying := fu.ScheduleRetry(reason, backoff)
+	if !retrying {
+		logrus.WithFields(logrus.Fields{
+			"chargePointID":    fu.ChargePointID,
+			"firmwareUpdateID": fu.ID,
+			"attempts":         fu.Attempts,
+			"lastError":        fu.LastError,
+		}).Error("Firmware update failed after final attempt")
+	}
+
+	if err := s.db.UpdateFirmwareUpdate(ctx, fu); err != nil {
+		logrus.WithError(err).WithField("firmwareUpdateID", fu.ID).Error("Failed to update firmware update")
+	}
+
+	if !retrying {
+		s.events.Publish(events.FirmwareUpdateFailed, fu.ChargePointID, fu)
+	}
+}
+
+// runFirmwareRetries periodically resends firmware updates whose retry time has passed
+func (s *CPMS) runFirmwareRetries() {
+	ticker := time.NewTicker(firmwareRetryInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		updates, err := s.db.GetFirmwareUpdatesDueForRetry(ctx, time.Now())
+		if err != nil {
+			logrus.WithError(err).Error("Failed to get firmware updates due for retry")
+			cancel()
+			continue
+		}
+
+		for _, fu := range updates {
+			logrus.WithFields(logrus.Fields{
+				"chargePointID":    fu.ChargePointID,
+				"firmwareUpdateID": fu.ID,
+				"attempt":          fu.Attempts + 1,
+			}).Info("Retrying firmware update")
+
+			if err := s.sendFirmwareUpdate(ctx, fu); err != nil {
+				logrus.WithError(err).WithField("firmwareUpdateID", fu.ID).Error("Failed to retry firmware update")
+			}
+		}
+		cancel()
+	}
+}
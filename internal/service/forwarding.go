@@ -0,0 +1,160 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/ocpp"
+	"github.com/sirupsen/logrus"
+)
+
+// forwardTimeout is how long an instance waits for the confirmation of a command forwarded to another instance
+const forwardTimeout = 60 * time.Second
+
+// ErrNotConnectedHere is returned when a forwarded command targets a charge point not connected to this instance
+var ErrNotConnectedHere = errors.New("charge point is not connected to this instance")
+
+// ForwardedCommand is a command handed to the instance holding the charge point's websocket
+type ForwardedCommand struct {
+	ChargePointID string          `json:"chargePointId"`
+	Action        string          `json:"action"`
+	Payload       json.RawMessage `json:"payload"`
+	RequestID     string          `json:"requestId,omitempty"` // ID of the API request that sent the command
+}
+
+// ForwardedResult is the outcome of a forwarded command
+type ForwardedResult struct {
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// forwardedResponse is a confirmation received from another instance in its JSON form
+type forwardedResponse struct {
+	action string
+	raw    json.RawMessage
+}
+
+func (r forwardedResponse) GetFeatureName() string {
+	return r.action
+}
+
+func (r forwardedResponse) MarshalJSON() ([]byte, error) {
+	return r.raw, nil
+}
+
+var forwardClient = &http.Client{Timeout: forwardTimeout + 5*time.Second}
+
+// remoteInstanceURL returns the internal API URL of the instance holding a charge point's websocket
+// if it is another instance. Charge points not found in the registry are sent to locally.
+func (s *CPMS) remoteInstanceURL(ctx context.Context, chargePointID string) (string, bool) {
+	if s.centralSystem.IsLocal(chargePointID) {
+		return "", false
+	}
+
+	instanceID, instanceURL, err := s.db.GetConnectionOwner(ctx, chargePointID)
+	if err != nil || instanceID == s.config.InstanceID || instanceURL == "" {
+		return "", false
+	}
+	return instanceURL, true
+}
+
+// forwardCommand hands a command to the instance holding the charge point's websocket and completes it with the result.
+// The payload is passed separately, as the recorded one has its credentials masked.
+func (s *CPMS) forwardCommand(cmd *models.Command, payload json.RawMessage, instanceURL string) {
+	body, err := json.Marshal(ForwardedCommand{
+		ChargePointID: cmd.ChargePointID,
+		Action:        cmd.Action,
+		Payload:       payload,
+		RequestID:     cmd.RequestID,
+	})
+	if err != nil {
+		s.completeCommand(cmd, nil, err)
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, instanceURL+"/internal/v1/commands", bytes.NewReader(body))
+	if err != nil {
+		s.completeCommand(cmd, nil, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Internal-Secret", s.config.InternalAPISecret)
+	if cmd.RequestID != "" {
+		req.Header.Set("X-Request-ID", cmd.RequestID)
+	}
+
+	resp, err := forwardClient.Do(req)
+	if err != nil {
+		s.completeCommand(cmd, nil, fmt.Errorf("forwarding to %s: %w", instanceURL, err))
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		s.completeCommand(cmd, nil, fmt.Errorf("forwarding to %s: status %d", instanceURL, resp.StatusCode))
+		return
+	}
+
+	var envelope struct {
+		Data ForwardedResult `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		s.completeCommand(cmd, nil, fmt.Errorf("forwarding to %s: %w", instanceURL, err))
+		return
+	}
+	result := envelope.Data
+
+	if result.Error != "" {
+		s.completeCommand(cmd, nil, errors.New(result.Error))
+		return
+	}
+
+	s.completeCommand(cmd, forwardedResponse{action: cmd.Action, raw: result.Response}, nil)
+}
+
+// InternalAuthenticate checks the shared secret of a request from another instance
+func (s *CPMS) InternalAuthenticate(secret string) bool {
+	if s.config.InternalAPISecret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(s.config.InternalAPISecret)) == 1
+}
+
+// ExecuteForwardedCommand sends a command forwarded by another instance to a charge point connected here
+func (s *CPMS) ExecuteForwardedCommand(ctx context.Context, fc ForwardedCommand) (*ForwardedResult, error) {
+	if !s.centralSystem.IsLocal(fc.ChargePointID) {
+		return nil, ErrNotConnectedHere
+	}
+
+	request, err := ocpp.ParseRequest(fc.Action, fc.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, forwardTimeout)
+	defer cancel()
+
+	logrus.WithFields(logrus.Fields{
+		"chargePointID": fc.ChargePointID,
+		"action":        fc.Action,
+		"requestID":     fc.RequestID,
+	}).Debug("Executing forwarded command")
+
+	confirmation, err := s.centralSystem.SendCommand(ctx, fc.ChargePointID, fc.RequestID, request)
+	if err != nil {
+		return &ForwardedResult{Error: err.Error()}, nil
+	}
+
+	response, err := json.Marshal(confirmation)
+	if err != nil {
+		return nil, err
+	}
+	return &ForwardedResult{Response: response}, nil
+}
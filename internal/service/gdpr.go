@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// ErrIdTagCharging is returned when erasing an idTag with a transaction in progress
+var ErrIdTagCharging = errors.New("idTag has a transaction in progress")
+
+// ExportPersonalData returns everything stored about an idTag across all tenants
+func (s *CPMS) ExportPersonalData(ctx context.Context, idTag string) (*models.PersonalData, error) {
+	data := &models.PersonalData{
+		IdTag:        idTag,
+		IdTags:       []*models.IdTag{},
+		Transactions: []*models.Transaction{},
+		Messages:     []*models.OCPPMessage{},
+		Quarantined:  []*models.QuarantinedMessage{},
+		ExportedAt:   time.Now(),
+	}
+
+	tags, err := s.db.GetIdTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		if tag.IdTag == idTag {
+			data.IdTags = append(data.IdTags, tag)
+		}
+	}
+
+	transactions, _, err := s.db.GetTransactions(ctx, db.TransactionFilter{IdTag: idTag}, db.Sort{}, db.Page{})
+	if err != nil {
+		return nil, err
+	}
+	if transactions != nil {
+		data.Transactions = transactions
+	}
+
+	messages, err := s.db.GetIdTagOCPPMessages(ctx, idTag)
+	if err != nil {
+		return nil, err
+	}
+	if messages != nil {
+		data.Messages = messages
+	}
+
+	quarantined, err := s.db.GetIdTagQuarantinedMessages(ctx, idTag)
+	if err != nil {
+		return nil, err
+	}
+	if quarantined != nil {
+		data.Quarantined = quarantined
+	}
+
+	// The audit log must not keep the idTag either
+	s.audit(ctx, "personaldata.export", "idtag", hashIdTag(idTag), map[string]interface{}{
+		"transactions": len(data.Transactions),
+		"messages":     len(data.Messages),
+		"quarantined":  len(data.Quarantined),
+	})
+	return data, nil
+}
+
+// ErasePersonalData erases the personal data of an idTag within a tenant: its transactions are kept for accounting but anonymized
+// under a random pseudonym, and its registration and logged and quarantined OCPP messages are deleted. The erasure is recorded
+// in the erasure log with a hash of the idTag, so it can be proven without keeping the idTag. idTags are only unique within
+// a tenant, so the same idTag of other tenants is kept; an empty tenant erases the idTag on charge points without a tenant.
+// Tenant-scoped callers can only erase their own idTags.
+func (s *CPMS) ErasePersonalData(ctx context.Context, tenantID, idTag, reason string) (*models.Erasure, error) {
+	if scoped := db.TenantFromContext(ctx); scoped != "" {
+		tenantID = scoped
+	}
+
+	active, _, err := s.db.GetTransactions(ctx, db.TransactionFilter{IdTag: idTag, Status: "InProgress"}, db.Sort{}, db.Page{})
+	if err != nil {
+		return nil, err
+	}
+	for _, tx := range active {
+		if tx.TenantID == tenantID {
+			return nil, ErrIdTagCharging
+		}
+	}
+
+	pseudonym, err := newPseudonym()
+	if err != nil {
+		return nil, err
+	}
+
+	erasure := &models.Erasure{
+		TenantID:  tenantID,
+		IdTagHash: hashIdTag(idTag),
+		Pseudonym: pseudonym,
+		Actor:     ActorFromContext(ctx),
+		Reason:    reason,
+	}
+	if err := s.db.ErasePersonalData(ctx, idTag, erasure); err != nil {
+		return nil, err
+	}
+	// Charge points must not be authorized from a cached result of the erased idTag
+	s.centralSystem.InvalidateIdTagAuthorization(idTag)
+
+	s.audit(ctx, "personaldata.erase", "idtag", erasure.IdTagHash, map[string]interface{}{
+		"erasureId":              erasure.ID,
+		"tenantId":               erasure.TenantID,
+		"pseudonym":              erasure.Pseudonym,
+		"transactionsAnonymized": erasure.TransactionsAnonymized,
+		"messagesDeleted":        erasure.MessagesDeleted,
+	})
+	return erasure, nil
+}
+
+// GetErasures returns the most recent entries of the erasure log
+func (s *CPMS) GetErasures(ctx context.Context, limit int) ([]*models.Erasure, error) {
+	return s.db.GetErasures(ctx, limit)
+}
+
+// hashIdTag returns the hex SHA-256 of an idTag recorded in place of the idTag itself
+func hashIdTag(idTag string) string {
+	sum := sha256.Sum256([]byte(idTag))
+	return hex.EncodeToString(sum[:])
+}
+
+// newPseudonym generates the random idTag replacing an erased one, short enough for an OCPP 1.6 idTag
+func newPseudonym() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "erased-" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/webhook"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/sirupsen/logrus"
+)
+
+// gridEventInterval is how often grid events are checked for activation and expiry
+const gridEventInterval = 30 * time.Second
+
+// ReceiveGridEvent stores a demand-response event and applies it if it has already started. An update of an active
+// event whose limit or window changed is applied again.
+func (s *CPMS) ReceiveGridEvent(ctx context.Context, event *models.GridEvent) error {
+	if _, err := s.db.GetSite(ctx, event.SiteID); err != nil {
+		return fmt.Errorf("unknown site %s: %v", event.SiteID, err)
+	}
+
+	previous, err := s.db.GetGridEvent(ctx, event.ID)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return err
+	}
+
+	event.Status = "Scheduled"
+	if err := s.db.SaveGridEvent(ctx, event); err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"gridEventID": event.ID,
+		"siteID":      event.SiteID,
+		"limitKW":     event.LimitKW,
+		"startTime":   event.StartTime,
+		"endTime":     event.EndTime,
+	}).Info("Grid event received")
+
+	stored, err := s.db.GetGridEvent(ctx, event.ID)
+	if err != nil {
+		return err
+	}
+	if previous != nil && previous.Status == "Active" && stored.Status == "Active" && gridEventChanged(previous, stored) {
+		s.updateActiveGridEvent(ctx, stored)
+	}
+	s.processGridEvent(ctx, stored)
+
+	return nil
+}
+
+// gridEventChanged reports whether an update changed the limit or window of a grid event
+func gridEventChanged(previous, updated *models.GridEvent) bool {
+	return previous.LimitKW != updated.LimitKW ||
+		!previous.StartTime.Equal(updated.StartTime) ||
+		!previous.EndTime.Equal(updated.EndTime)
+}
+
+// updateActiveGridEvent sends the curtailment profile of an active grid event again after its limit or window
+// changed, replacing the one the charge points have. An event moved to start later is lifted until its new start,
+// and one that ended by now is left to processGridEvent to complete.
+func (s *CPMS) updateActiveGridEvent(ctx context.Context, event *models.GridEvent) {
+	now := time.Now()
+
+	switch {
+	case !now.Before(event.EndTime):
+		return
+	case now.Before(event.StartTime):
+		s.restoreGridEvent(ctx, event)
+		if err := s.db.UpdateGridEventStatus(ctx, event.ID, "Scheduled"); err != nil {
+			logrus.WithError(err).WithField("gridEventID", event.ID).Error("Failed to reschedule grid event")
+			return
+		}
+		event.Status = "Scheduled"
+	default:
+		if err := s.applyGridEvent(ctx, event); err != nil {
+			logrus.WithError(err).WithField("gridEventID", event.ID).Error("Failed to apply updated grid event")
+		}
+	}
+}
+
+// CancelGridEvent cancels a grid event and restores the site's power if it was active
+func (s *CPMS) CancelGridEvent(ctx context.Context, id string) error {
+	event, err := s.db.GetGridEvent(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if event.Status == "Active" {
+		s.restoreGridEvent(ctx, event)
+	}
+
+	return s.db.UpdateGridEventStatus(ctx, id, "Cancelled")
+}
+
+// GetGridEvents returns the grid event history
+func (s *CPMS) GetGridEvents(ctx context.Context) ([]*models.GridEvent, error) {
+	return s.db.GetGridEvents(ctx)
+}
+
+// processGridEvent activates or ends a grid event depending on the current time
+func (s *CPMS) processGridEvent(ctx context.Context, event *models.GridEvent) {
+	now := time.Now()
+
+	switch {
+	case !now.Before(event.EndTime):
+		if event.Status == "Active" {
+			s.restoreGridEvent(ctx, event)
+		}
+		if err := s.db.UpdateGridEventStatus(ctx, event.ID, "Completed"); err != nil {
+			logrus.WithError(err).WithField("gridEventID", event.ID).Error("Failed to complete grid event")
+		}
+	case event.Status == "Scheduled" && !now.Before(event.StartTime):
+		if err := s.applyGridEvent(ctx, event); err != nil {
+			logrus.WithError(err).WithField("gridEventID", event.ID).Error("Failed to apply grid event")
+			return
+		}
+		if err := s.db.UpdateGridEventStatus(ctx, event.ID, "Active"); err != nil {
+			logrus.WithError(err).WithField("gridEventID", event.ID).Error("Failed to activate grid event")
+		}
+	}
+}
+
+// applyGridEvent caps the power of all charge points at the event's site by splitting the site limit evenly
+func (s *CPMS) applyGridEvent(ctx context.Context, event *models.GridEvent) error {
+	chargePointIDs, err := s.db.GetChargePointIDsForSite(ctx, event.SiteID)
+	if err != nil {
+		return err
+	}
+	if len(chargePointIDs) == 0 {
+		return nil
+	}
+
+	limit := event.LimitKW * 1000 / float64(len(chargePointIDs))
+	duration := int(event.EndTime.Sub(event.StartTime).Seconds())
+
+	// The profile expires on its own at the end of the event, even if the restore is never delivered
+	schedule := types.NewChargingSchedule(types.ChargingRateUnitWatts, types.NewChargingSchedulePeriod(0, limit))
+	schedule.StartSchedule = types.NewDateTime(event.StartTime)
+	schedule.Duration = &duration
+	profile := types.NewChargingProfile(curtailmentProfileID, 1, types.ChargingProfilePurposeChargePointMaxProfile, types.ChargingProfileKindAbsolute, schedule)
+	profile.ValidTo = types.NewDateTime(event.EndTime)
+
+	for _, chargePointID := range chargePointIDs {
+		if err := s.SetChargingProfile(ctx, chargePointID, 0, profile); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"gridEventID":   event.ID,
+				"chargePointID": chargePointID,
+			}).Error("Failed to send curtailment profile")
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"gridEventID":  event.ID,
+		"siteID":       event.SiteID,
+		"chargePoints": len(chargePointIDs),
+		"limitW":       limit,
+	}).Info("Grid event applied")
+
+	return nil
+}
+
+// restoreGridEvent removes the curtailment profile from all charge points at the event's site
+func (s *CPMS) restoreGridEvent(ctx context.Context, event *models.GridEvent) {
+	chargePointIDs, err := s.db.GetChargePointIDsForSite(ctx, event.SiteID)
+	if err != nil {
+		logrus.WithError(err).WithField("gridEventID", event.ID).Error("Failed to get charge points for grid event restore")
+		return
+	}
+
+	for _, chargePointID := range chargePointIDs {
+		if err := s.ClearChargingProfile(ctx, chargePointID, curtailmentProfileID); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"gridEventID":   event.ID,
+				"chargePointID": chargePointID,
+			}).Error("Failed to clear curtailment profile")
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"gridEventID": event.ID,
+		"siteID":      event.SiteID,
+	}).Info("Grid event restored")
+}
+
+// runGridEvents periodically activates and ends grid events
+func (s *CPMS) runGridEvents() {
+	ticker := time.NewTicker(gridEventInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		events, err := s.db.GetPendingGridEvents(ctx)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to get pending grid events")
+			cancel()
+			continue
+		}
+
+		for _, event := range events {
+			s.processGridEvent(ctx, event)
+		}
+		cancel()
+	}
+}
+
+// VerifyGridSignal checks the HMAC-SHA256 signature of a demand-response webhook body.
+// Signals are rejected when no secret is configured.
+func (s *CPMS) VerifyGridSignal(body []byte, signature string) bool {
+	if s.config.GridSignalSecret == "" {
+		return false
+	}
+
+	expected := webhook.Sign(s.config.GridSignalSecret, body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/balu-dk/go-cpms/config"
+)
+
+func TestVerifyGridSignal(t *testing.T) {
+	const (
+		body      = `{"eventId":"dr-1","maxPower":11000}`
+		signature = "ab514cd0db4e03523cb51a3512333f5f8e1452f4040e5ba7a60cdc61f2f6a324" // HMAC-SHA256 of body with grid-secret
+	)
+
+	tests := []struct {
+		name      string
+		secret    string
+		body      string
+		signature string
+		want      bool
+	}{
+		{name: "valid signature", secret: "grid-secret", body: body, signature: signature, want: true},
+		{name: "uppercase signature", secret: "grid-secret", body: body, signature: strings.ToUpper(signature), want: false},
+		{name: "tampered body", secret: "grid-secret", body: `{"eventId":"dr-1","maxPower":0}`, signature: signature, want: false},
+		{name: "wrong secret", secret: "other-secret", body: body, signature: signature, want: false},
+		{name: "truncated signature", secret: "grid-secret", body: body, signature: signature[:32], want: false},
+		{name: "missing signature", secret: "grid-secret", body: body, signature: "", want: false},
+		{name: "no secret configured", secret: "", body: body, signature: signature, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &CPMS{config: &config.Config{GridSignalSecret: tt.secret}}
+			if got := s.VerifyGridSignal([]byte(tt.body), tt.signature); got != tt.want {
+				t.Errorf("VerifyGridSignal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// Actions that can be blocked by a group freeze
+const (
+	FreezeActionFirmware      = "firmware"
+	FreezeActionConfiguration = "configuration"
+)
+
+// ErrChargePointFrozen is returned when an action is blocked by a group freeze
+var ErrChargePointFrozen = errors.New("charge point is frozen")
+
+// GetGroups returns all groups
+func (s *CPMS) GetGroups(ctx context.Context) ([]*models.Group, error) {
+	return s.db.GetGroups(ctx)
+}
+
+// GetGroup returns a specific group
+func (s *CPMS) GetGroup(ctx context.Context, id string) (*models.Group, error) {
+	return s.db.GetGroup(ctx, id)
+}
+
+// SaveGroup creates or updates a group
+func (s *CPMS) SaveGroup(ctx context.Context, group *models.Group) error {
+	return s.db.SaveGroup(ctx, group)
+}
+
+// GetGroupMembers returns the charge points in a group
+func (s *CPMS) GetGroupMembers(ctx context.Context, groupID string) ([]string, error) {
+	return s.db.GetGroupMembers(ctx, groupID)
+}
+
+// AddGroupMember adds a charge point to a group
+func (s *CPMS) AddGroupMember(ctx context.Context, groupID, chargePointID string) error {
+	if err := s.db.AddGroupMember(ctx, groupID, chargePointID); err != nil {
+		return err
+	}
+
+	s.audit(ctx, "group.member_added", "group", groupID, map[string]interface{}{
+		"chargePointId": chargePointID,
+	})
+	return nil
+}
+
+// RemoveGroupMember removes a charge point from a group
+func (s *CPMS) RemoveGroupMember(ctx context.Context, groupID, chargePointID string) error {
+	if err := s.db.RemoveGroupMember(ctx, groupID, chargePointID); err != nil {
+		return err
+	}
+
+	s.audit(ctx, "group.member_removed", "group", groupID, map[string]interface{}{
+		"chargePointId": chargePointID,
+	})
+	return nil
+}
+
+// FreezeGroup blocks firmware updates and configuration changes for all charge points in a group
+func (s *CPMS) FreezeGroup(ctx context.Context, groupID, reason string) error {
+	if err := s.db.SetGroupFrozen(ctx, groupID, true, reason, ActorFromContext(ctx)); err != nil {
+		return err
+	}
+
+	s.audit(ctx, "group.frozen", "group", groupID, map[string]interface{}{
+		"reason": reason,
+	})
+	return nil
+}
+
+// UnfreezeGroup lifts the freeze of a group
+func (s *CPMS) UnfreezeGroup(ctx context.Context, groupID string) error {
+	if err := s.db.SetGroupFrozen(ctx, groupID, false, "", ""); err != nil {
+		return err
+	}
+
+	s.audit(ctx, "group.unfrozen", "group", groupID, nil)
+	return nil
+}
+
+// CreateFreezeOverride allows an action on a frozen group for a limited time
+func (s *CPMS) CreateFreezeOverride(ctx context.Context, override *models.FreezeOverride, validFor time.Duration) error {
+	if override.Action != FreezeActionFirmware && override.Action != FreezeActionConfiguration {
+		return fmt.Errorf("invalid freeze action: %s", override.Action)
+	}
+
+	override.ApprovedBy = ActorFromContext(ctx)
+	override.ValidUntil = time.Now().Add(validFor)
+	if err := s.db.CreateFreezeOverride(ctx, override); err != nil {
+		return err
+	}
+
+	s.audit(ctx, "group.override_created", "group", override.GroupID, map[string]interface{}{
+		"overrideId":    override.ID,
+		"chargePointId": override.ChargePointID,
+		"action":        override.Action,
+		"reason":        override.Reason,
+		"validUntil":    override.ValidUntil,
+	})
+	return nil
+}
+
+// checkFreeze returns ErrChargePointFrozen when an action on a charge point is blocked
+// by a frozen group without a valid override. Blocked and overridden attempts are audited.
+func (s *CPMS) checkFreeze(ctx context.Context, chargePointID, action string) error {
+	groups, err := s.db.GetFrozenGroupsForChargePoint(ctx, chargePointID)
+	if err != nil {
+		return fmt.Errorf("failed to check freeze policy: %v", err)
+	}
+
+	for _, group := range groups {
+		override, err := s.db.GetActiveFreezeOverride(ctx, group.ID, chargePointID, action)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			return fmt.Errorf("failed to check freeze override: %v", err)
+		}
+
+		if override == nil {
+			s.audit(ctx, "freeze.blocked", "chargepoint", chargePointID, map[string]interface{}{
+				"groupId": group.ID,
+				"action":  action,
+			})
+			return fmt.Errorf("%w by group %s: %s", ErrChargePointFrozen, group.ID, group.FreezeReason)
+		}
+
+		s.audit(ctx, "freeze.overridden", "chargepoint", chargePointID, map[string]interface{}{
+			"groupId":    group.ID,
+			"action":     action,
+			"overrideId": override.ID,
+		})
+	}
+
+	return nil
+}
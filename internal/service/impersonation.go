@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// MaxImpersonationDuration bounds how long an impersonation session can be used
+const MaxImpersonationDuration = 4 * time.Hour
+
+// ErrImpersonationNotAllowed is returned when a tenant-scoped caller tries to impersonate
+var ErrImpersonationNotAllowed = errors.New("impersonation requires the admin API key")
+
+// ErrActorRequired is returned when an impersonation is started without a named operator
+var ErrActorRequired = errors.New("impersonation requires a named operator")
+
+const impersonationContextKey contextKey = "impersonation"
+
+// ImpersonationFromContext returns the impersonation session a request runs under, if any
+func ImpersonationFromContext(ctx context.Context) *models.ImpersonationSession {
+	session, _ := ctx.Value(impersonationContextKey).(*models.ImpersonationSession)
+	return session
+}
+
+// StartImpersonation opens a time-limited session letting the calling admin act within a tenant's scope.
+// The session token is only returned here, the CPMS stores its hash.
+func (s *CPMS) StartImpersonation(ctx context.Context, tenantID, reason string, validFor time.Duration) (*models.ImpersonationSession, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrImpersonationNotAllowed
+	}
+
+	if ActorFromContext(ctx) == defaultActor {
+		return nil, ErrActorRequired
+	}
+
+	if validFor > MaxImpersonationDuration {
+		validFor = MaxImpersonationDuration
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate impersonation token: %v", err)
+	}
+
+	session := &models.ImpersonationSession{
+		TenantID:  tenantID,
+		Actor:     ActorFromContext(ctx),
+		Reason:    reason,
+		Token:     hex.EncodeToString(buf),
+		ExpiresAt: time.Now().Add(validFor),
+	}
+
+	if err := s.db.CreateImpersonationSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, "impersonation.start", "tenant", tenantID, map[string]interface{}{
+		"sessionId": session.ID,
+		"reason":    reason,
+		"expiresAt": session.ExpiresAt,
+	})
+	return session, nil
+}
+
+// Impersonate resolves an impersonation token and returns a context scoped to the session's tenant.
+// Every action taken with the context is attributed to the admin acting as the tenant.
+func (s *CPMS) Impersonate(ctx context.Context, token string) (context.Context, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrImpersonationNotAllowed
+	}
+
+	session, err := s.db.GetActiveImpersonationSession(ctx, token)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, ErrUnauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = db.WithTenant(ctx, session.TenantID)
+	ctx = WithActor(ctx, fmt.Sprintf("%s (impersonating %s)", session.Actor, session.TenantID))
+	return context.WithValue(ctx, impersonationContextKey, session), nil
+}
+
+// AuditImpersonatedRequest records an API request made under an impersonation session
+func (s *CPMS) AuditImpersonatedRequest(ctx context.Context, method, path string) {
+	session := ImpersonationFromContext(ctx)
+	if session == nil {
+		return
+	}
+
+	s.audit(ctx, "impersonation.request", "tenant", session.TenantID, map[string]interface{}{
+		"sessionId": session.ID,
+		"method":    method,
+		"path":      path,
+	})
+}
+
+// EndImpersonation ends an impersonation session before it expires
+func (s *CPMS) EndImpersonation(ctx context.Context, id int) error {
+	session, err := s.db.EndImpersonationSession(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	s.audit(ctx, "impersonation.end", "tenant", session.TenantID, map[string]interface{}{"sessionId": id})
+	return nil
+}
+
+// GetImpersonationSessions returns the most recent impersonation sessions
+func (s *CPMS) GetImpersonationSessions(ctx context.Context, limit int) ([]*models.ImpersonationSession, error) {
+	return s.db.GetImpersonationSessions(ctx, limit)
+}
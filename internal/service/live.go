@@ -0,0 +1,18 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// GetLiveReadings returns the most recent power, current and energy readings per connector of a charge point.
+// They are kept in memory by the instance the charge point is connected to, so charge points connected to
+// another instance must be read there. Charge points not connected have no live readings.
+func (s *CPMS) GetLiveReadings(ctx context.Context, chargePointID string) ([]*models.LiveConnector, error) {
+	if instanceURL, remote := s.remoteInstanceURL(ctx, chargePointID); remote {
+		return nil, fmt.Errorf("%w, it is connected to %s", ErrNotConnectedHere, instanceURL)
+	}
+	return s.centralSystem.LiveReadings(chargePointID), nil
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/localauth"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+)
+
+// SyncLocalList replaces the charge point's local authorization list with the idTags of its tenant.
+// Charge points not assigned to a tenant receive an empty list.
+func (s *CPMS) SyncLocalList(ctx context.Context, chargePointID string) (*models.Command, error) {
+	return s.syncLocalList(ctx, chargePointID)
+}
+
+func (s *CPMS) syncLocalList(ctx context.Context, chargePointID string, opts ...commandOption) (*models.Command, error) {
+	cp, err := s.db.GetChargePoint(ctx, chargePointID)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []*models.IdTag
+	if cp.TenantID != "" {
+		tags, err = s.db.GetIdTags(db.WithTenant(ctx, cp.TenantID))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The list version only has to increase between updates
+	req := localauth.NewSendLocalListRequest(int(time.Now().Unix()), localauth.UpdateTypeFull)
+	req.LocalAuthorizationList = make([]localauth.AuthorizationData, 0, len(tags))
+	for _, tag := range tags {
+		info := types.NewIdTagInfo(types.AuthorizationStatus(tag.AuthorizationStatus(time.Now())))
+		if !tag.ExpiryDate.IsZero() {
+			info.ExpiryDate = types.NewDateTime(tag.ExpiryDate)
+		}
+
+		req.LocalAuthorizationList = append(req.LocalAuthorizationList, localauth.AuthorizationData{
+			IdTag:     tag.IdTag,
+			IdTagInfo: info,
+		})
+	}
+
+	return s.sendCommand(ctx, chargePointID, req, opts...)
+}
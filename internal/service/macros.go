@@ -0,0 +1,354 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/remotetrigger"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// macroConcurrency is the number of charge points a macro run works on at the same time
+	macroConcurrency = 10
+	// macroStepTimeout is how long a macro step waits for the charge point's confirmation
+	macroStepTimeout = 60 * time.Second
+)
+
+// Macro run statuses
+const (
+	MacroRunStatusRunning   = "Running"
+	MacroRunStatusCompleted = "Completed"
+	MacroRunStatusFailed    = "Failed"
+)
+
+// ErrNoMacroTargets is returned when a macro run's filter matches no charge points
+var ErrNoMacroTargets = errors.New("no charge points match the macro target")
+
+// MacroTarget selects the charge points a macro runs against
+type MacroTarget struct {
+	ChargePointIDs []string `json:"chargePointIds,omitempty"`
+	GroupID        string   `json:"groupId,omitempty"`
+	SiteID         string   `json:"siteId,omitempty"`
+	ConnectedOnly  bool     `json:"connectedOnly,omitempty"`
+}
+
+// successStatuses are the confirmed statuses letting a macro continue with its next step
+var successStatuses = map[string]bool{
+	"Accepted":       true,
+	"RebootRequired": true,
+	"Scheduled":      true,
+	"Unlocked":       true,
+}
+
+// ValidateMacroStep checks that a macro step can be executed
+func ValidateMacroStep(step models.MacroStep) error {
+	switch step.Action {
+	case core.ClearCacheFeatureName, "SendLocalList":
+		return nil
+	case core.ChangeConfigurationFeatureName:
+		if len(step.Configuration) == 0 {
+			return fmt.Errorf("%s requires configuration", step.Action)
+		}
+	case core.ResetFeatureName:
+		if step.Type != "Hard" && step.Type != "Soft" {
+			return fmt.Errorf("%s type must be 'Hard' or 'Soft'", step.Action)
+		}
+	case core.ChangeAvailabilityFeatureName:
+		if step.Type != "Operative" && step.Type != "Inoperative" {
+			return fmt.Errorf("%s type must be 'Operative' or 'Inoperative'", step.Action)
+		}
+	case core.UnlockConnectorFeatureName:
+		if step.ConnectorID <= 0 {
+			return fmt.Errorf("%s requires a connectorId", step.Action)
+		}
+	case remotetrigger.TriggerMessageFeatureName:
+		if step.Message == "" {
+			return fmt.Errorf("%s requires a message", step.Action)
+		}
+	default:
+		return fmt.Errorf("unsupported macro action: %s", step.Action)
+	}
+	return nil
+}
+
+// GetMacros returns all command macros
+func (s *CPMS) GetMacros(ctx context.Context) ([]*models.Macro, error) {
+	return s.db.GetMacros(ctx)
+}
+
+// GetMacro returns a specific command macro
+func (s *CPMS) GetMacro(ctx context.Context, id string) (*models.Macro, error) {
+	return s.db.GetMacro(ctx, id)
+}
+
+// SaveMacro creates or updates a command macro
+func (s *CPMS) SaveMacro(ctx context.Context, macro *models.Macro) error {
+	for i, step := range macro.Steps {
+		if err := ValidateMacroStep(step); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+
+	if err := s.db.SaveMacro(ctx, macro); err != nil {
+		return err
+	}
+
+	s.audit(ctx, "macro.save", "macro", macro.ID, map[string]interface{}{"steps": len(macro.Steps)})
+	return nil
+}
+
+// DeleteMacro removes a command macro
+func (s *CPMS) DeleteMacro(ctx context.Context, id string) error {
+	if err := s.db.DeleteMacro(ctx, id); err != nil {
+		return err
+	}
+
+	s.audit(ctx, "macro.delete", "macro", id, nil)
+	return nil
+}
+
+// GetMacroRun returns a macro run with the commands sent by each step
+func (s *CPMS) GetMacroRun(ctx context.Context, id int) (*models.MacroRun, error) {
+	run, err := s.db.GetMacroRun(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	run.Commands, err = s.db.GetMacroRunCommands(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+// RunMacro starts a macro against the charge points matching the target.
+// Each charge point runs the steps in order and stops at the first failed step unless the step
+// continues on error. The run executes in the background; its progress is in the command tracker.
+func (s *CPMS) RunMacro(ctx context.Context, macroID string, target MacroTarget) (*models.MacroRun, error) {
+	macro, err := s.db.GetMacro(ctx, macroID)
+	if err != nil {
+		return nil, err
+	}
+
+	chargePointIDs, err := s.resolveMacroTarget(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &models.MacroRun{
+		MacroID:        macro.ID,
+		ChargePointIDs: chargePointIDs,
+		Status:         MacroRunStatusRunning,
+		Actor:          ActorFromContext(ctx),
+	}
+
+	if err := s.db.CreateMacroRun(ctx, run); err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, "macro.run", "macro", macro.ID, map[string]interface{}{
+		"runId":          run.ID,
+		"chargePointIds": chargePointIDs,
+	})
+
+	// The run outlives the API request but keeps its actor and tenant scope
+	runCtx := WithActor(db.WithTenant(context.Background(), db.TenantFromContext(ctx)), run.Actor)
+	go s.executeMacroRun(runCtx, macro, run)
+
+	return run, nil
+}
+
+// resolveMacroTarget returns the charge points matching a target that are visible to the caller
+func (s *CPMS) resolveMacroTarget(ctx context.Context, target MacroTarget) ([]string, error) {
+	candidates := append([]string{}, target.ChargePointIDs...)
+
+	if target.GroupID != "" {
+		members, err := s.db.GetGroupMembers(ctx, target.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, members...)
+	}
+
+	if target.SiteID != "" {
+		ids, err := s.db.GetChargePointIDsForSite(ctx, target.SiteID)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, ids...)
+	}
+
+	seen := make(map[string]bool)
+	var chargePointIDs []string
+	for _, id := range candidates {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		// Charge points outside the caller's tenant are not found
+		cp, err := s.db.GetChargePoint(ctx, id)
+		if err != nil {
+			continue
+		}
+		if target.ConnectedOnly && !cp.IsConnected {
+			continue
+		}
+		chargePointIDs = append(chargePointIDs, id)
+	}
+
+	if len(chargePointIDs) == 0 {
+		return nil, ErrNoMacroTargets
+	}
+
+	return chargePointIDs, nil
+}
+
+// executeMacroRun runs a macro on every charge point of the run and records the final status
+func (s *CPMS) executeMacroRun(ctx context.Context, macro *models.Macro, run *models.MacroRun) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+	sem := make(chan struct{}, macroConcurrency)
+
+	for _, chargePointID := range run.ChargePointIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(chargePointID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if !s.executeMacro(ctx, macro, run.ID, chargePointID) {
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+		}(chargePointID)
+	}
+	wg.Wait()
+
+	status := MacroRunStatusCompleted
+	if failed > 0 {
+		status = MacroRunStatusFailed
+	}
+
+	if err := s.db.CompleteMacroRun(ctx, run.ID, status); err != nil {
+		logrus.WithError(err).WithField("macroRunID", run.ID).Error("Failed to record macro run status")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"macroID":      macro.ID,
+		"macroRunID":   run.ID,
+		"chargePoints": len(run.ChargePointIDs),
+		"failed":       failed,
+	}).Info("Macro run finished")
+}
+
+// executeMacro runs the steps of a macro on a charge point and reports whether all steps succeeded
+func (s *CPMS) executeMacro(ctx context.Context, macro *models.Macro, runID int, chargePointID string) bool {
+	ok := true
+	for i, step := range macro.Steps {
+		stepOK := s.executeMacroStep(ctx, chargePointID, step, withMacroStep(runID, i+1))
+		if stepOK {
+			continue
+		}
+
+		ok = false
+		logrus.WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"macroRunID":    runID,
+			"step":          i + 1,
+			"action":        step.Action,
+		}).Warn("Macro step failed")
+
+		if !step.ContinueOnError {
+			break
+		}
+	}
+	return ok
+}
+
+// executeMacroStep sends the command(s) of a step and waits for their confirmation
+func (s *CPMS) executeMacroStep(ctx context.Context, chargePointID string, step models.MacroStep, opt commandOption) bool {
+	var commands []*models.Command
+	var err error
+
+	switch step.Action {
+	case core.ClearCacheFeatureName:
+		commands, err = s.macroCommand(ctx, chargePointID, core.NewClearCacheRequest(), opt)
+	case "SendLocalList":
+		var cmd *models.Command
+		cmd, err = s.syncLocalList(ctx, chargePointID, opt)
+		if cmd != nil {
+			commands = append(commands, cmd)
+		}
+	case core.ChangeConfigurationFeatureName:
+		if err = s.checkFreeze(ctx, chargePointID, FreezeActionConfiguration); err != nil {
+			break
+		}
+
+		keys := make([]string, 0, len(step.Configuration))
+		for key := range step.Configuration {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			var sent []*models.Command
+			sent, err = s.macroCommand(ctx, chargePointID, core.NewChangeConfigurationRequest(key, step.Configuration[key]), opt)
+			commands = append(commands, sent...)
+			if err != nil {
+				break
+			}
+		}
+	case core.ResetFeatureName:
+		commands, err = s.macroCommand(ctx, chargePointID, core.NewResetRequest(core.ResetType(step.Type)), opt)
+	case core.ChangeAvailabilityFeatureName:
+		commands, err = s.macroCommand(ctx, chargePointID, core.NewChangeAvailabilityRequest(step.ConnectorID, core.AvailabilityType(step.Type)), opt)
+	case core.UnlockConnectorFeatureName:
+		commands, err = s.macroCommand(ctx, chargePointID, core.NewUnlockConnectorRequest(step.ConnectorID), opt)
+	case remotetrigger.TriggerMessageFeatureName:
+		req := remotetrigger.NewTriggerMessageRequest(remotetrigger.MessageTrigger(step.Message))
+		if step.ConnectorID > 0 {
+			req.ConnectorId = &step.ConnectorID
+		}
+		commands, err = s.macroCommand(ctx, chargePointID, req, opt)
+	default:
+		err = fmt.Errorf("unsupported macro action: %s", step.Action)
+	}
+
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"action":        step.Action,
+		}).Error("Failed to send macro step")
+		return false
+	}
+
+	for _, cmd := range commands {
+		result, err := s.waitForCommand(ctx, cmd, macroStepTimeout)
+		if err != nil || !successStatuses[result.Status] {
+			return false
+		}
+	}
+	return true
+}
+
+// macroCommand sends a single command of a macro step
+func (s *CPMS) macroCommand(ctx context.Context, chargePointID string, request ocpp.Request, opt commandOption) ([]*models.Command, error) {
+	cmd, err := s.sendCommand(ctx, chargePointID, request, opt)
+	if cmd == nil {
+		return nil, err
+	}
+	return []*models.Command{cmd}, err
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/ocpp"
+	ocppgo "github.com/lorenzodonini/ocpp-go/ocpp"
+)
+
+// OCPPServer is the OCPP central system the CPMS reaches charge points through.
+// ocpp.CentralSystem is the real implementation, ocpptest.Server an in-memory one for tests.
+type OCPPServer interface {
+	Start() error
+	Stop(ctx context.Context)
+
+	// IsLocal reports whether a charge point is connected to this instance
+	IsLocal(chargePointID string) bool
+	// LocalChargePoints returns the IDs of the charge points connected to this instance
+	LocalChargePoints() []string
+
+	// SendRequestAsync sends a request to a charge point, the callback receives its confirmation or error
+	SendRequestAsync(chargePointID string, request ocppgo.Request, callback func(ocppgo.Response, error)) error
+	// SendRequest sends a request to a charge point and waits for its confirmation
+	SendRequest(ctx context.Context, chargePointID string, request ocppgo.Request) (ocppgo.Response, error)
+	// SendCommandAsync sends a request like SendRequestAsync, logging it with the ID of the API request that sent it
+	SendCommandAsync(chargePointID, apiRequestID string, request ocppgo.Request, callback func(ocppgo.Response, error)) error
+	// SendCommand sends a request like SendRequest, logging it with the ID of the API request that sent it
+	SendCommand(ctx context.Context, chargePointID, apiRequestID string, request ocppgo.Request) (ocppgo.Response, error)
+
+	HeartbeatInterval() int
+	SetHeartbeatInterval(seconds int)
+	SetMessageRateLimit(rate float64, burst int)
+	SetConnectionLimits(maxConnections int, rate float64, burst int)
+
+	// Replay passes logged inbound requests through the OCPP handlers again
+	Replay(messages []*models.OCPPMessage, dryRun bool) []ocpp.ReplayResult
+	// Tap streams the frames exchanged with a charge point until stop is called
+	Tap(chargePointID string) (frames <-chan ocpp.Frame, stop func())
+	// LiveReadings returns the most recent power, current and energy readings per connector of a charge point
+	LiveReadings(chargePointID string) []*models.LiveConnector
+
+	// InvalidateIdTagAuthorization drops the cached authorization results of an idTag
+	InvalidateIdTagAuthorization(idTag string)
+	// InvalidateChargePointAuthorization drops the cached authorization results at a charge point
+	InvalidateChargePointAuthorization(chargePointID string)
+
+	// ForgetTransaction drops the state kept for a transaction closed without a StopTransaction
+	ForgetTransaction(chargePointID string, transactionID int)
+}
+
+var _ OCPPServer = (*ocpp.CentralSystem)(nil)
+
+// Option configures a CPMS
+type Option func(*CPMS)
+
+// WithOCPPServer makes the CPMS reach charge points through server instead of its own OCPP central system
+func WithOCPPServer(server OCPPServer) Option {
+	return func(s *CPMS) {
+		s.centralSystem = server
+	}
+}
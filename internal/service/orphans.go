@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/sirupsen/logrus"
+)
+
+// orphanCheckInterval is how often in-progress transactions are checked for orphans
+const orphanCheckInterval = 5 * time.Minute
+
+// closeOrphanedTransactions closes the in-progress transactions that received no meter values and whose
+// charge point sent no heartbeats for the orphaned transaction timeout, as the charge point will likely never
+// stop them. They end at their latest energy reading, or at their start without one.
+func (s *CPMS) closeOrphanedTransactions(ctx context.Context) error {
+	cutoff := time.Now().Add(-time.Duration(s.config.OrphanedTransactionTimeout) * time.Minute)
+	transactions, err := s.db.GetOrphanedTransactions(ctx, cutoff)
+	if err != nil || len(transactions) == 0 {
+		return err
+	}
+
+	ids := make([]int, len(transactions))
+	for i, tx := range transactions {
+		ids[i] = tx.ID
+	}
+	latest, err := s.db.GetLatestMeterValues(ctx, ids, energyMeasurand)
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range transactions {
+		endTime, meterStop := tx.StartTime, tx.MeterStart
+		if mv, ok := latest[tx.ID]; ok {
+			endTime, meterStop = mv.Timestamp, int(mv.EnergyWh())
+		}
+
+		closed, err := s.db.CloseOrphanedTransaction(ctx, tx.ID, endTime, meterStop)
+		if err != nil {
+			return err
+		}
+		if !closed {
+			continue
+		}
+		s.centralSystem.ForgetTransaction(tx.ChargePointID, tx.ID)
+
+		logrus.WithFields(logrus.Fields{
+			"chargePointID": tx.ChargePointID,
+			"transactionId": tx.ID,
+			"lastActivity":  endTime,
+		}).Warn("Closed orphaned transaction")
+
+		s.events.PublishSession(events.TransactionOrphaned, tx.ChargePointID, tx.SessionID, map[string]interface{}{
+			"transactionId": tx.ID,
+			"connectorId":   tx.ConnectorID,
+			"idTag":         tx.IdTag,
+			"startTime":     tx.StartTime,
+			"endTime":       endTime,
+			"meterStart":    tx.MeterStart,
+			"meterStop":     meterStop,
+		})
+	}
+
+	return nil
+}
+
+// runOrphanedTransactionCleanup periodically closes orphaned transactions
+func (s *CPMS) runOrphanedTransactionCleanup() {
+	ticker := time.NewTicker(orphanCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if err := s.closeOrphanedTransactions(ctx); err != nil {
+			logrus.WithError(err).Error("Failed to close orphaned transactions")
+		}
+		cancel()
+	}
+}
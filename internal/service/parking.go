@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/sirupsen/logrus"
+)
+
+// parkingCheckInterval is how often plug-in durations are checked against max-stay rules
+const parkingCheckInterval = time.Minute
+
+// parkingMonitor remembers which notifications were already sent for a plug-in
+type parkingMonitor struct {
+	mu         sync.Mutex
+	warned     map[string]bool
+	overstayed map[string]bool
+}
+
+func newParkingMonitor() *parkingMonitor {
+	return &parkingMonitor{
+		warned:     make(map[string]bool),
+		overstayed: make(map[string]bool),
+	}
+}
+
+// parkingKey identifies a single plug-in of a vehicle on a connector
+func parkingKey(p *models.ParkingSession) string {
+	return fmt.Sprintf("%s/%d/%d", p.ChargePointID, p.ConnectorID, p.OccupiedSince.Unix())
+}
+
+// GetParkingSessions returns the vehicles currently plugged in at sites with a max-stay rule
+func (s *CPMS) GetParkingSessions(ctx context.Context, siteID string) ([]*models.ParkingSession, error) {
+	return s.db.GetParkingSessions(ctx, siteID)
+}
+
+// checkParking emits warning and overstay events for plugged-in vehicles approaching or exceeding the max stay
+func (s *CPMS) checkParking(ctx context.Context) error {
+	sessions, err := s.db.GetParkingSessions(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	active := make(map[string]bool, len(sessions))
+
+	s.parking.mu.Lock()
+	defer s.parking.mu.Unlock()
+
+	for _, p := range sessions {
+		key := parkingKey(p)
+		active[key] = true
+		deadline := p.Deadline()
+
+		data := map[string]interface{}{
+			"siteId":        p.SiteID,
+			"connectorId":   p.ConnectorID,
+			"idTag":         p.IdTag,
+			"transactionId": p.TransactionID,
+			"occupiedSince": p.OccupiedSince,
+			"deadline":      deadline,
+		}
+
+		switch {
+		case !now.Before(deadline) && !s.parking.overstayed[key]:
+			s.parking.overstayed[key] = true
+			data["overstayMinutes"] = int(now.Sub(deadline).Minutes())
+			s.events.PublishSession(events.ParkingOverstay, p.ChargePointID, p.SessionID, data)
+			logrus.WithFields(logrus.Fields{
+				"chargePointID": p.ChargePointID,
+				"connectorID":   p.ConnectorID,
+				"siteID":        p.SiteID,
+			}).Info("Parking overstay detected")
+		case p.OverstayWarningMinutes > 0 && !s.parking.warned[key] &&
+			!now.Before(deadline.Add(-time.Duration(p.OverstayWarningMinutes)*time.Minute)):
+			s.parking.warned[key] = true
+			s.events.PublishSession(events.ParkingOverstayWarning, p.ChargePointID, p.SessionID, data)
+		}
+	}
+
+	// Forget vehicles that have left
+	for key := range s.parking.warned {
+		if !active[key] {
+			delete(s.parking.warned, key)
+		}
+	}
+	for key := range s.parking.overstayed {
+		if !active[key] {
+			delete(s.parking.overstayed, key)
+		}
+	}
+
+	return nil
+}
+
+// runParkingMonitor periodically checks plug-in durations against max-stay rules
+func (s *CPMS) runParkingMonitor() {
+	ticker := time.NewTicker(parkingCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := s.checkParking(ctx); err != nil {
+			logrus.WithError(err).Error("Failed to check parking sessions")
+		}
+		cancel()
+	}
+}
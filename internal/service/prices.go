@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/sirupsen/logrus"
+)
+
+// spotPriceFeedInterval is how often day-ahead spot prices are refreshed.
+// Day-ahead prices are published once a day, so hourly polling picks them up shortly after publication.
+const spotPriceFeedInterval = time.Hour
+
+// GetSpotPrices returns the stored spot prices of the configured price area within a time range
+func (s *CPMS) GetSpotPrices(ctx context.Context, from, to time.Time) ([]*models.SpotPrice, error) {
+	return s.db.GetSpotPrices(ctx, s.config.PriceArea, from, to)
+}
+
+// RefreshSpotPrices fetches today's and tomorrow's spot prices from the price feed and stores them
+func (s *CPMS) RefreshSpotPrices(ctx context.Context) error {
+	from := time.Now().UTC().Truncate(24 * time.Hour)
+	to := from.Add(48 * time.Hour)
+
+	prices, err := s.priceFeed.FetchPrices(ctx, s.config.PriceArea, from, to)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.SaveSpotPrices(ctx, prices); err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"priceArea": s.config.PriceArea,
+		"prices":    len(prices),
+	}).Info("Spot prices refreshed")
+
+	return nil
+}
+
+// runSpotPriceFeed periodically refreshes spot prices from the price feed
+func (s *CPMS) runSpotPriceFeed() {
+	ticker := time.NewTicker(spotPriceFeedInterval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if err := s.RefreshSpotPrices(ctx); err != nil {
+			logrus.WithError(err).Error("Failed to refresh spot prices")
+		}
+		cancel()
+
+		<-ticker.C
+	}
+}
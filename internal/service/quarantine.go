@@ -0,0 +1,25 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// GetQuarantinedMessages returns a page of the inbound OCPP messages quarantined because they failed
+// parsing or validation, newest first, and the total number of matching messages
+func (s *CPMS) GetQuarantinedMessages(ctx context.Context, filter db.QuarantineFilter, page db.Page) ([]*models.QuarantinedMessage, int, error) {
+	return s.db.GetQuarantinedMessages(ctx, filter, page)
+}
+
+// ReviewQuarantinedMessage marks a quarantined OCPP message as reviewed by the acting API client
+func (s *CPMS) ReviewQuarantinedMessage(ctx context.Context, id int) error {
+	if err := s.db.ReviewQuarantinedMessage(ctx, id, ActorFromContext(ctx)); err != nil {
+		return err
+	}
+
+	s.audit(ctx, "ocpp.quarantine_review", "quarantinedmessage", strconv.Itoa(id), nil)
+	return nil
+}
@@ -0,0 +1,20 @@
+package service
+
+import (
+	"time"
+)
+
+// AllowAPIRequest takes a request of an API client from its rate limits. Requests changing state
+// also count against the command limit. It returns false and the time until the client may retry
+// if the client is over a limit.
+func (s *CPMS) AllowAPIRequest(client string, command bool) (bool, time.Duration) {
+	if ok, retryAfter := s.apiLimiter.Allow(client); !ok {
+		return false, retryAfter
+	}
+	if command {
+		if ok, retryAfter := s.commandLimiter.Allow(client); !ok {
+			return false, retryAfter
+		}
+	}
+	return true, 0
+}
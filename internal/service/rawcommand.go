@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/ocpp"
+)
+
+// rawCommandTimeout is how long SendRawCommand waits for the confirmation of the charge point
+const rawCommandTimeout = 30 * time.Second
+
+// ErrInvalidRawCommand is returned when a raw command names an unknown OCPP action or its payload does not parse
+var ErrInvalidRawCommand = errors.New("invalid raw command")
+
+// SendRawCommand sends any OCPP 1.6 request given as its action and JSON payload and waits for the
+// confirmation, for reproducing charge point issues. It bypasses freezes and is audited.
+// The command is returned as Pending if the charge point does not confirm in time.
+func (s *CPMS) SendRawCommand(ctx context.Context, chargePointID, action string, payload json.RawMessage) (*models.Command, error) {
+	request, err := ocpp.ParseRequest(action, payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRawCommand, err)
+	}
+
+	s.audit(ctx, "ocpp.raw_send", "chargepoint", chargePointID, map[string]interface{}{
+		"action":  action,
+		"payload": payload,
+	})
+
+	cmd, err := s.sendCommand(ctx, chargePointID, request)
+	if err != nil {
+		return cmd, err
+	}
+	return s.waitForCommand(ctx, cmd, rawCommandTimeout)
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/sirupsen/logrus"
+)
+
+// recoveryCheckInterval is how often connectors are checked for being stuck in Preparing
+const recoveryCheckInterval = time.Minute
+
+// recoveryState tracks the automatic resets of a charge point until it recovers
+type recoveryState struct {
+	attempts    int
+	lastAttempt time.Time
+	exhausted   bool // The attempt limit was reached and reported
+}
+
+// recoveryTracker limits automatic recovery to one reset per interval and a maximum number of attempts per charge point
+type recoveryTracker struct {
+	mu     sync.Mutex
+	states map[string]*recoveryState
+}
+
+func newRecoveryTracker() *recoveryTracker {
+	return &recoveryTracker{states: make(map[string]*recoveryState)}
+}
+
+// next returns the type and number of the next reset of a charge point, or false if it must not be reset now.
+// exhausted is true the first time a charge point runs out of attempts.
+func (t *recoveryTracker) next(chargePointID string, now time.Time, interval time.Duration, maxAttempts int) (resetType string, attempt int, ok, exhausted bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, found := t.states[chargePointID]
+	if !found {
+		state = &recoveryState{}
+		t.states[chargePointID] = state
+	}
+
+	// Give the previous reset time to take effect
+	if !state.lastAttempt.IsZero() && now.Sub(state.lastAttempt) < interval {
+		return "", 0, false, false
+	}
+	if state.attempts >= maxAttempts {
+		exhausted = !state.exhausted
+		state.exhausted = true
+		return "", state.attempts, false, exhausted
+	}
+
+	state.attempts++
+	state.lastAttempt = now
+	if state.attempts == 1 {
+		return "Soft", state.attempts, true, false
+	}
+	return "Hard", state.attempts, true, false
+}
+
+// recovered forgets the resets of the charge points that are no longer unhealthy once their last reset had time to take effect
+func (t *recoveryTracker) recovered(unhealthy map[string]bool, now time.Time, interval time.Duration) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var recovered []string
+	for chargePointID, state := range t.states {
+		if !unhealthy[chargePointID] && now.Sub(state.lastAttempt) >= interval {
+			delete(t.states, chargePointID)
+			recovered = append(recovered, chargePointID)
+		}
+	}
+	return recovered
+}
+
+// handleRecoveryEvent resets a charge point whose connector reported its configured number of consecutive faults.
+// It is subscribed to the event bus, whose handlers must not block.
+func (s *CPMS) handleRecoveryEvent(event events.Event) {
+	if !s.config.RecoveryEnabled || event.Type != events.ConnectorFault {
+		return
+	}
+	data, ok := event.Data.(*models.ConnectorStatusEvent)
+	if !ok || data.Status != "Faulted" {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		threshold := s.config.RecoveryFaultThreshold
+		history, err := s.db.GetConnectorStatusEvents(ctx, data.ChargePointID, data.ConnectorID, false, threshold)
+		if err != nil {
+			logrus.WithError(err).WithField("chargePointID", data.ChargePointID).Error("Failed to get connector status history for recovery")
+			return
+		}
+		if len(history) < threshold {
+			return
+		}
+		for _, e := range history {
+			if e.Status != "Faulted" {
+				return
+			}
+		}
+
+		s.recoverChargePoint(ctx, data.ChargePointID, fmt.Sprintf("connector %d reported %d consecutive faults (%s)", data.ConnectorID, threshold, data.ErrorCode))
+	}()
+}
+
+// checkStuckConnectors resets the charge points with connectors stuck in Preparing
+// and forgets the resets of the charge points that recovered
+func (s *CPMS) checkStuckConnectors(ctx context.Context) error {
+	now := time.Now()
+	unhealthy := make(map[string]bool)
+
+	if timeout := time.Duration(s.config.RecoveryPreparingTimeout) * time.Minute; timeout > 0 {
+		preparing, err := s.db.GetConnectorsByStatus(ctx, "Preparing")
+		if err != nil {
+			return err
+		}
+		for _, c := range preparing {
+			since := c.StatusSince
+			if since.IsZero() {
+				since = c.UpdatedAt
+			}
+			if now.Sub(since) < timeout {
+				continue
+			}
+			unhealthy[c.ChargePointID] = true
+			s.recoverChargePoint(ctx, c.ChargePointID, fmt.Sprintf("connector %d stuck in Preparing since %s", c.ID, since.Format(time.RFC3339)))
+		}
+	}
+
+	faulted, err := s.db.GetConnectorsByStatus(ctx, "Faulted")
+	if err != nil {
+		return err
+	}
+	for _, c := range faulted {
+		unhealthy[c.ChargePointID] = true
+	}
+
+	interval := time.Duration(s.config.RecoveryInterval) * time.Minute
+	for _, chargePointID := range s.recovery.recovered(unhealthy, now, interval) {
+		logrus.WithField("chargePointID", chargePointID).Info("Charge point recovered after automatic reset")
+	}
+	return nil
+}
+
+// recoverChargePoint resets a charge point connected to this instance, starting with a Soft reset and escalating
+// to Hard resets until the attempt limit is reached. Charge points with transactions in progress are left alone.
+func (s *CPMS) recoverChargePoint(ctx context.Context, chargePointID, reason string) {
+	if !s.centralSystem.IsLocal(chargePointID) {
+		return
+	}
+
+	fields := logrus.Fields{
+		"chargePointID": chargePointID,
+		"reason":        reason,
+	}
+
+	active, _, err := s.db.GetTransactions(ctx, db.TransactionFilter{ChargePointID: chargePointID, Status: "InProgress"}, db.Sort{}, db.Page{Limit: 1})
+	if err != nil {
+		logrus.WithError(err).WithFields(fields).Error("Failed to check transactions before automatic reset")
+		return
+	}
+	if len(active) > 0 {
+		logrus.WithFields(fields).Debug("Skipping automatic reset, transaction in progress")
+		return
+	}
+
+	interval := time.Duration(s.config.RecoveryInterval) * time.Minute
+	resetType, attempt, ok, exhausted := s.recovery.next(chargePointID, time.Now(), interval, s.config.RecoveryMaxAttempts)
+	if exhausted {
+		logrus.WithFields(fields).Warn("Automatic recovery gave up after reaching the attempt limit")
+		s.audit(ctx, "chargepoint.recovery_exhausted", "chargepoint", chargePointID, map[string]interface{}{
+			"attempts": attempt,
+			"reason":   reason,
+		})
+	}
+	if !ok {
+		return
+	}
+
+	details := map[string]interface{}{
+		"resetType": resetType,
+		"attempt":   attempt,
+		"reason":    reason,
+	}
+
+	cmd, err := s.ResetChargePoint(ctx, chargePointID, resetType)
+	if err != nil {
+		details["error"] = err.Error()
+		logrus.WithError(err).WithFields(fields).Error("Automatic reset failed")
+	} else {
+		details["commandId"] = cmd.ID
+		fields["resetType"] = resetType
+		fields["attempt"] = attempt
+		logrus.WithFields(fields).Warn("Automatic reset sent")
+	}
+
+	s.audit(ctx, "chargepoint.recovery", "chargepoint", chargePointID, details)
+}
+
+// runRecovery periodically resets charge points with connectors stuck in Preparing
+func (s *CPMS) runRecovery() {
+	ticker := time.NewTicker(recoveryCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := s.checkStuckConnectors(ctx); err != nil {
+			logrus.WithError(err).Error("Failed to check connectors for automatic recovery")
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/balu-dk/go-cpms/config"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/sirupsen/logrus"
+)
+
+// Reload applies the runtime-tunable settings of a reloaded configuration: the log level,
+// the heartbeat interval, the API and OCPP message rate limits, the OCPP connection limits and the webhook endpoints.
+// Other settings only take effect on restart.
+func (s *CPMS) Reload(cfg *config.Config) {
+	if level, err := logrus.ParseLevel(cfg.LogLevel); err == nil {
+		logrus.SetLevel(level)
+	}
+
+	s.apiLimiter.SetLimit(cfg.APIRateLimit, cfg.APIRateBurst)
+	s.commandLimiter.SetLimit(cfg.APICommandRateLimit, cfg.APICommandRateBurst)
+	s.webhooks.SetEndpoints(cfg.WebhookURLs, cfg.WebhookSecret, cfg.WebhookEvents)
+
+	s.centralSystem.SetMessageRateLimit(cfg.OCPPMessageRateLimit, cfg.OCPPMessageRateBurst)
+	s.centralSystem.SetConnectionLimits(cfg.OCPPMaxConnections, cfg.OCPPConnectRateLimit, cfg.OCPPConnectRateBurst)
+	if s.centralSystem.HeartbeatInterval() != cfg.HeartbeatInterval {
+		s.centralSystem.SetHeartbeatInterval(cfg.HeartbeatInterval)
+		go s.pushHeartbeatInterval(cfg.HeartbeatInterval)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"logLevel":             cfg.LogLevel,
+		"heartbeatInterval":    cfg.HeartbeatInterval,
+		"apiRateLimit":         cfg.APIRateLimit,
+		"apiCommandRateLimit":  cfg.APICommandRateLimit,
+		"ocppMessageRateLimit": cfg.OCPPMessageRateLimit,
+		"ocppMaxConnections":   cfg.OCPPMaxConnections,
+		"webhookURLs":          len(cfg.WebhookURLs),
+	}).Info("Configuration reloaded")
+}
+
+// pushHeartbeatInterval changes the heartbeat interval of the charge points connected to this instance,
+// which otherwise keep the interval of their last boot notification
+func (s *CPMS) pushHeartbeatInterval(seconds int) {
+	ctx := context.Background()
+	value := strconv.Itoa(seconds)
+
+	for _, chargePointID := range s.centralSystem.LocalChargePoints() {
+		if _, err := s.sendCommand(ctx, chargePointID, core.NewChangeConfigurationRequest("HeartbeatInterval", value)); err != nil {
+			logrus.WithError(err).WithField("chargePointID", chargePointID).Warn("Failed to change heartbeat interval of charge point")
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/ocpp"
+)
+
+// replayLimit is the maximum number of messages replayed at once
+const replayLimit = 10000
+
+// ErrReplayTooLarge is returned when more messages match a replay than are replayed at once
+var ErrReplayTooLarge = fmt.Errorf("more than %d messages match the replay, narrow the time range", replayLimit)
+
+// ReplayFilter selects the logged inbound requests to replay
+type ReplayFilter struct {
+	ChargePointID string    // Empty for all charge points
+	From          time.Time // Inclusive
+	To            time.Time // Exclusive
+	Actions       []string  // Empty for all actions
+}
+
+// ReplayOCPPMessages passes the logged inbound requests matching the filter through the OCPP handlers
+// again, in the order they were received. Dry runs discard the handlers' writes, other replays are audited.
+func (s *CPMS) ReplayOCPPMessages(ctx context.Context, filter ReplayFilter, dryRun bool) ([]ocpp.ReplayResult, error) {
+	actions := make(map[string]bool, len(filter.Actions))
+	for _, action := range filter.Actions {
+		actions[action] = true
+	}
+
+	var messages []*models.OCPPMessage
+	err := s.db.StreamOCPPMessages(ctx, filter.From, filter.To, func(msg *models.OCPPMessage) error {
+		if msg.MessageType != "Request" || msg.Direction != "Inbound" {
+			return nil
+		}
+		if filter.ChargePointID != "" && msg.ChargePointID != filter.ChargePointID {
+			return nil
+		}
+		if len(actions) > 0 && !actions[msg.Action] {
+			return nil
+		}
+		if len(messages) == replayLimit {
+			return ErrReplayTooLarge
+		}
+		messages = append(messages, msg)
+		return nil
+	})
+	if errors.Is(err, ErrReplayTooLarge) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OCPP messages: %w", err)
+	}
+
+	if !dryRun {
+		s.audit(ctx, "ocpp.replay", "chargepoint", filter.ChargePointID, map[string]interface{}{
+			"from":     filter.From,
+			"to":       filter.To,
+			"actions":  filter.Actions,
+			"messages": len(messages),
+		})
+	}
+
+	return s.centralSystem.Replay(messages, dryRun), nil
+}
@@ -0,0 +1,16 @@
+package service
+
+import "context"
+
+const requestIDContextKey contextKey = "requestID"
+
+// WithRequestID returns a context carrying the ID of the API request an action is performed for
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, requestID)
+}
+
+// RequestIDFromContext returns the ID of the API request an action is performed for, empty if there is none
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey).(string)
+	return requestID
+}
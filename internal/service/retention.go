@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// retentionInterval is how often meter value partitions are maintained
+	retentionInterval = 24 * time.Hour
+	// partitionMonthsAhead is the number of future monthly partitions kept ready
+	partitionMonthsAhead = 2
+)
+
+// maintainMeterValues creates upcoming meter value partitions and prunes samples past the retention period
+func (s *CPMS) maintainMeterValues(ctx context.Context) error {
+	now := time.Now().UTC()
+	for i := 0; i <= partitionMonthsAhead; i++ {
+		if err := s.db.EnsureMeterValuePartition(ctx, now.AddDate(0, i, 0)); err != nil {
+			return err
+		}
+	}
+
+	if s.config.MeterValueRetentionDays <= 0 {
+		return nil
+	}
+
+	cutoff := now.AddDate(0, 0, -s.config.MeterValueRetentionDays)
+	dropped, err := s.db.PruneMeterValues(ctx, cutoff, s.config.MeterValueDownsampleMinutes)
+	if len(dropped) > 0 {
+		logrus.WithFields(logrus.Fields{
+			"partitions": dropped,
+			"cutoff":     cutoff,
+		}).Info("Pruned meter value partitions")
+	}
+	return err
+}
+
+// runMeterValueRetention maintains meter value partitions at startup and then daily
+func (s *CPMS) runMeterValueRetention() {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		if err := s.maintainMeterValues(ctx); err != nil {
+			logrus.WithError(err).Error("Failed to maintain meter value partitions")
+		}
+		cancel()
+
+		<-ticker.C
+	}
+}
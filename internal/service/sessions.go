@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// GetSession returns the transaction, commands and meter values of a charging session.
+// It returns db.ErrNotFound if the session is unknown or outside the caller's tenant.
+func (s *CPMS) GetSession(ctx context.Context, sessionID string) (*models.Session, error) {
+	session := &models.Session{ID: sessionID}
+
+	tx, err := s.db.GetTransactionBySession(ctx, sessionID)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return nil, err
+	}
+	session.Transaction = tx
+
+	session.Commands, err = s.db.GetSessionCommands(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A session without a transaction yet is visible if its charge point is
+	if session.Transaction == nil {
+		if len(session.Commands) == 0 {
+			return nil, db.ErrNotFound
+		}
+		if _, err := s.db.GetChargePoint(ctx, session.Commands[0].ChargePointID); err != nil {
+			return nil, err
+		}
+		return session, nil
+	}
+
+	session.MeterValues, err = s.db.GetSessionMeterValues(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
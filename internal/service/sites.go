@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// GetSites returns all sites
+func (s *CPMS) GetSites(ctx context.Context) ([]*models.Site, error) {
+	return s.db.GetSites(ctx)
+}
+
+// GetSite returns a specific site
+func (s *CPMS) GetSite(ctx context.Context, id string) (*models.Site, error) {
+	return s.db.GetSite(ctx, id)
+}
+
+// SaveSite creates or updates a site
+func (s *CPMS) SaveSite(ctx context.Context, site *models.Site) error {
+	if err := s.db.SaveSite(ctx, site); err != nil {
+		return err
+	}
+
+	// Free vend mode of the site may have changed, which the cached authorizations of its charge points reflect
+	chargePointIDs, err := s.db.GetChargePointIDsForSite(ctx, site.ID)
+	if err != nil {
+		return err
+	}
+	for _, chargePointID := range chargePointIDs {
+		s.centralSystem.InvalidateChargePointAuthorization(chargePointID)
+	}
+	return nil
+}
+
+// SetChargePointSite assigns a charge point to a site
+func (s *CPMS) SetChargePointSite(ctx context.Context, chargePointID, siteID string) error {
+	if err := s.db.SetChargePointSite(ctx, chargePointID, siteID); err != nil {
+		return err
+	}
+	s.centralSystem.InvalidateChargePointAuthorization(chargePointID)
+	return nil
+}
+
+// SetChargePointFreeVend enables or disables free vend mode on a charge point, in which it accepts every idTag
+// and its transactions cost nothing
+func (s *CPMS) SetChargePointFreeVend(ctx context.Context, chargePointID string, enabled bool) error {
+	if err := s.db.SetChargePointFreeVend(ctx, chargePointID, enabled); err != nil {
+		return err
+	}
+	s.centralSystem.InvalidateChargePointAuthorization(chargePointID)
+
+	s.audit(ctx, "chargepoint.freevend", "chargepoint", chargePointID, map[string]interface{}{"enabled": enabled})
+	return nil
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/smartcharging"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Charging profile IDs reserved for profiles managed by the CPMS.
+// Sending a profile with an existing ID replaces the previous one on the charge point.
+const (
+	solarProfileID       = 1001
+	curtailmentProfileID = 1002
+	remoteStartProfileID = 1003
+	departureProfileID   = 1004
+)
+
+// Stack levels of the TxProfiles managed by the CPMS. A charge point also replaces a profile with the same purpose
+// and stack level as a new one, whatever its ID, so each controller needs its own level. While several profiles
+// are valid the one with the highest level applies: a departure plan overrides solar charging, and both override
+// the schedule sent with a remote start.
+const (
+	remoteStartStackLevel = 1
+	solarStackLevel       = 2
+	departureStackLevel   = 3
+)
+
+// SetChargingProfile sends a charging profile to a connector of a charge point
+func (s *CPMS) SetChargingProfile(ctx context.Context, chargePointID string, connectorID int, profile *types.ChargingProfile) error {
+	callback := func(response ocpp.Response, err error) {
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"chargePointID": chargePointID,
+				"connectorID":   connectorID,
+				"profileID":     profile.ChargingProfileId,
+			}).Error("Set charging profile request failed")
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"connectorID":   connectorID,
+			"profileID":     profile.ChargingProfileId,
+			"status":        response.(*smartcharging.SetChargingProfileConfirmation).Status,
+		}).Debug("Set charging profile request processed")
+	}
+
+	return s.centralSystem.SendRequestAsync(chargePointID, smartcharging.NewSetChargingProfileRequest(connectorID, profile), callback)
+}
+
+// ClearChargingProfile removes a charging profile from a charge point by its ID
+func (s *CPMS) ClearChargingProfile(ctx context.Context, chargePointID string, profileID int) error {
+	callback := func(response ocpp.Response, err error) {
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"chargePointID": chargePointID,
+				"profileID":     profileID,
+			}).Error("Clear charging profile request failed")
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"chargePointID": chargePointID,
+			"profileID":     profileID,
+			"status":        response.(*smartcharging.ClearChargingProfileConfirmation).Status,
+		}).Debug("Clear charging profile request processed")
+	}
+
+	request := smartcharging.NewClearChargingProfileRequest()
+	request.Id = &profileID
+	return s.centralSystem.SendRequestAsync(chargePointID, request, callback)
+}
+
+// newRemoteStartProfile creates the TxProfile sent with a remote start, applying a schedule from the start of the
+// transaction or from its start schedule if it has one
+func newRemoteStartProfile(schedule *types.ChargingSchedule) *types.ChargingProfile {
+	kind := types.ChargingProfileKindRelative
+	if schedule.StartSchedule != nil {
+		kind = types.ChargingProfileKindAbsolute
+	}
+	return types.NewChargingProfile(remoteStartProfileID, remoteStartStackLevel, types.ChargingProfilePurposeTxProfile, kind, schedule)
+}
+
+// newTxCurrentLimitProfile creates a TxProfile limiting a transaction to a constant current
+func newTxCurrentLimitProfile(profileID, stackLevel, transactionID int, limit float64) *types.ChargingProfile {
+	schedule := types.NewChargingSchedule(types.ChargingRateUnitAmperes, types.NewChargingSchedulePeriod(0, limit))
+	profile := types.NewChargingProfile(profileID, stackLevel, types.ChargingProfilePurposeTxProfile, types.ChargingProfileKindRelative, schedule)
+	profile.TransactionId = transactionID
+	return profile
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/sirupsen/logrus"
+)
+
+// solarReadingMaxAge is how long a pushed export meter reading is considered current
+const solarReadingMaxAge = 5 * time.Minute
+
+// solarReading is a measurement of the power a site exports to the grid
+type solarReading struct {
+	exportPower float64 // W, positive when exporting
+	at          time.Time
+}
+
+// solarController adjusts the charging current of active transactions at solar-enabled sites
+// so EVs consume the surplus that would otherwise be exported to the grid
+type solarController struct {
+	mu         sync.Mutex
+	readings   map[string]solarReading // Latest pushed reading per site
+	limits     map[int]float64         // Current limit in A per transaction
+	httpClient *http.Client
+}
+
+func newSolarController() *solarController {
+	return &solarController{
+		readings:   make(map[string]solarReading),
+		limits:     make(map[int]float64),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// ReportSiteExportPower records a pushed export meter reading for a site, in W
+func (s *CPMS) ReportSiteExportPower(siteID string, exportPower float64) {
+	s.solar.mu.Lock()
+	defer s.solar.mu.Unlock()
+	s.solar.readings[siteID] = solarReading{exportPower: exportPower, at: time.Now()}
+}
+
+// siteExportPower returns the current export power of a site, preferring a recent pushed reading
+// and falling back to polling the site's meter URL
+func (s *CPMS) siteExportPower(ctx context.Context, site *models.Site) (float64, error) {
+	s.solar.mu.Lock()
+	reading, ok := s.solar.readings[site.ID]
+	s.solar.mu.Unlock()
+
+	if ok && time.Since(reading.at) < solarReadingMaxAge {
+		return reading.exportPower, nil
+	}
+
+	if site.SolarMeterURL == "" {
+		return 0, fmt.Errorf("no recent export meter reading for site %s", site.ID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, site.SolarMeterURL, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := s.solar.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read export meter: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("failed to read export meter: unexpected status %s", resp.Status)
+	}
+
+	var body struct {
+		ExportPower float64 `json:"exportPower"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("failed to decode export meter reading: %v", err)
+	}
+
+	return body.ExportPower, nil
+}
+
+// adjustSolarSite redistributes the available solar surplus over the active transactions of a site
+func (s *CPMS) adjustSolarSite(ctx context.Context, site *models.Site) error {
+	exportPower, err := s.siteExportPower(ctx, site)
+	if err != nil {
+		return err
+	}
+
+	transactions, err := s.db.GetActiveTransactionsForSite(ctx, site.ID)
+	if err != nil {
+		return err
+	}
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	// The export meter already reflects what the EVs draw, so the surplus
+	// available for charging is the current allocation plus what is still exported
+	s.solar.mu.Lock()
+	allocated := 0.0
+	for _, tx := range transactions {
+		allocated += s.solar.limits[tx.ID]
+	}
+	s.solar.mu.Unlock()
+
+	wattsPerAmp := site.Voltage * float64(site.Phases)
+	available := allocated + exportPower/wattsPerAmp
+	perSession := math.Floor(available / float64(len(transactions)))
+
+	// Below the minimum current EVs cannot charge, so pause instead
+	limit := math.Min(perSession, site.MaxCurrent)
+	if limit < site.MinCurrent {
+		limit = 0
+	}
+
+	for _, tx := range transactions {
+		s.solar.mu.Lock()
+		previous, known := s.solar.limits[tx.ID]
+		s.solar.limits[tx.ID] = limit
+		s.solar.mu.Unlock()
+
+		if known && previous == limit {
+			continue
+		}
+
+		profile := newTxCurrentLimitProfile(solarProfileID, solarStackLevel, tx.ID, limit)
+		if err := s.SetChargingProfile(ctx, tx.ChargePointID, tx.ConnectorID, profile); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"siteID":        site.ID,
+				"transactionId": tx.ID,
+			}).Error("Failed to set solar charging profile")
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"siteID":       site.ID,
+		"exportPower":  exportPower,
+		"transactions": len(transactions),
+		"limit":        limit,
+	}).Debug("Solar surplus charging adjusted")
+
+	return nil
+}
+
+// runSolarControl periodically adjusts charging at all solar-enabled sites
+func (s *CPMS) runSolarControl() {
+	ticker := time.NewTicker(time.Duration(s.config.SolarControlInterval) * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		sites, err := s.db.GetSites(ctx)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to get sites for solar control")
+			cancel()
+			continue
+		}
+
+		for _, site := range sites {
+			if !site.SolarEnabled {
+				continue
+			}
+			if err := s.adjustSolarSite(ctx, site); err != nil {
+				logrus.WithError(err).WithField("siteID", site.ID).Warn("Failed to adjust solar surplus charging")
+			}
+		}
+		s.pruneSolarLimits(ctx)
+		cancel()
+	}
+}
+
+// pruneSolarLimits forgets the allocation of transactions that are no longer in progress
+func (s *CPMS) pruneSolarLimits(ctx context.Context) {
+	s.solar.mu.Lock()
+	ids := make([]int, 0, len(s.solar.limits))
+	for id := range s.solar.limits {
+		ids = append(ids, id)
+	}
+	s.solar.mu.Unlock()
+
+	for _, id := range ids {
+		tx, err := s.db.GetTransaction(ctx, id)
+		if err != nil || tx.Status != "InProgress" {
+			s.solar.mu.Lock()
+			delete(s.solar.limits, id)
+			s.solar.mu.Unlock()
+		}
+	}
+}
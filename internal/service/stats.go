@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// statsCache keeps computed charge point statistics, which price every transaction, for reuse within the cache TTL
+type statsCache struct {
+	mu      sync.Mutex
+	entries map[string]*models.ChargePointStats
+}
+
+func newStatsCache() *statsCache {
+	return &statsCache{entries: make(map[string]*models.ChargePointStats)}
+}
+
+// get returns the statistics cached under key if they are younger than ttl
+func (c *statsCache) get(key string, ttl time.Duration, now time.Time) (*models.ChargePointStats, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats, ok := c.entries[key]
+	if !ok || now.Sub(stats.ComputedAt) >= ttl {
+		return nil, false
+	}
+	return stats, true
+}
+
+// put caches statistics under key, dropping the entries older than ttl
+func (c *statsCache) put(key string, stats *models.ChargePointStats, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, cached := range c.entries {
+		if stats.ComputedAt.Sub(cached.ComputedAt) >= ttl {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = stats
+}
+
+// GetChargePointStats returns the lifetime totals of a charge point and its totals in [from, to): sessions, energy,
+// revenue, utilization and faults. Statistics are reused for the configured cache TTL, so they may lag behind.
+func (s *CPMS) GetChargePointStats(ctx context.Context, chargePointID string, from, to time.Time) (*models.ChargePointStats, error) {
+	cp, err := s.db.GetChargePoint(ctx, chargePointID)
+	if err != nil {
+		return nil, err
+	}
+	if cp == nil {
+		return nil, db.ErrNotFound
+	}
+
+	now := time.Now()
+	ttl := time.Duration(s.config.ChargePointStatsCacheTTL) * time.Second
+	key := chargePointID + "|" + from.UTC().Format(time.RFC3339) + "|" + to.UTC().Format(time.RFC3339)
+	if stats, ok := s.stats.get(key, ttl, now); ok {
+		return stats, nil
+	}
+
+	connectors, _, err := s.db.GetConnectors(ctx, chargePointID, db.Page{})
+	if err != nil {
+		return nil, err
+	}
+	// Connector 0 is the charge point as a whole, a charge point without connectors counts as one
+	connectorCount := 0
+	for _, c := range connectors {
+		if c.ID > 0 {
+			connectorCount++
+		}
+	}
+	if connectorCount == 0 {
+		connectorCount = 1
+	}
+
+	stats := &models.ChargePointStats{ChargePointID: chargePointID, ComputedAt: now}
+	if stats.Lifetime, err = s.chargePointTotals(ctx, chargePointID, cp.CreatedAt, now, connectorCount, now); err != nil {
+		return nil, err
+	}
+	if stats.Period, err = s.chargePointTotals(ctx, chargePointID, from, to, connectorCount, now); err != nil {
+		return nil, err
+	}
+
+	if ttl > 0 {
+		s.stats.put(key, stats, ttl)
+	}
+	return stats, nil
+}
+
+// chargePointTotals returns the totals of a charge point in [from, to) with the revenue of the transactions
+// started in the period, priced with the configured tariff. Utilization is the charging time over the time
+// all connectors were available until now.
+func (s *CPMS) chargePointTotals(ctx context.Context, chargePointID string, from, to time.Time, connectors int, now time.Time) (*models.ChargePointTotals, error) {
+	totals, err := s.db.GetChargePointTotals(ctx, chargePointID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	totals.Currency = s.config.PriceCurrency
+
+	transactions, _, err := s.db.GetTransactions(ctx, db.TransactionFilter{
+		ChargePointID: chargePointID,
+		From:          from,
+		To:            to,
+	}, db.Sort{}, db.Page{})
+	if err != nil {
+		return nil, err
+	}
+	for _, tx := range transactions {
+		cost, err := s.tariff.SessionCost(ctx, tx)
+		if err != nil {
+			return nil, err
+		}
+		totals.Revenue += cost.Cost
+	}
+
+	end := to
+	if end.After(now) {
+		end = now
+	}
+	if available := end.Sub(from).Seconds() * float64(connectors); available > 0 {
+		totals.UtilizationPercent = math.Min(float64(totals.ChargingSeconds)/available*100, 100)
+	}
+	return totals, nil
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/balu-dk/go-cpms/internal/ocpp"
+)
+
+// TapOCPP streams the raw OCPP frames exchanged with a charge point until stop is called, for watching
+// its protocol conversation live. Charge points connected to another instance must be tapped there,
+// charge points not connected yet are streamed once they connect to this instance.
+func (s *CPMS) TapOCPP(ctx context.Context, chargePointID string) (<-chan ocpp.Frame, func(), error) {
+	if instanceURL, remote := s.remoteInstanceURL(ctx, chargePointID); remote {
+		return nil, nil, fmt.Errorf("%w, it is connected to %s", ErrNotConnectedHere, instanceURL)
+	}
+
+	s.audit(ctx, "ocpp.tap", "chargepoint", chargePointID, nil)
+
+	frames, stop := s.centralSystem.Tap(chargePointID)
+	return frames, stop, nil
+}
+
+// WatchEvents streams the events published on this instance until stop is called, for live event views.
+// The events of charge points connected to other instances are published there.
+func (s *CPMS) WatchEvents() (<-chan events.Event, func()) {
+	return s.events.Watch()
+}
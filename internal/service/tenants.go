@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+	"github.com/balu-dk/go-cpms/internal/siem"
+)
+
+// ErrUnauthorized is returned when an API key is missing, unknown or revoked
+var ErrUnauthorized = errors.New("invalid API key")
+
+// AuthEnabled reports whether API requests must present an API key
+func (s *CPMS) AuthEnabled() bool {
+	return s.config.APIAuthEnabled
+}
+
+// Authenticate resolves an API key and returns a context scoped to its tenant.
+// The admin key returns an unscoped context with access to all tenants.
+func (s *CPMS) Authenticate(ctx context.Context, key string) (context.Context, error) {
+	if key == "" {
+		return nil, ErrUnauthorized
+	}
+
+	if s.config.AdminAPIKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(s.config.AdminAPIKey)) == 1 {
+		return ctx, nil
+	}
+
+	apiKey, err := s.db.GetAPIKeyByKey(ctx, key)
+	if errors.Is(err, db.ErrNotFound) {
+		s.siem.Security("api.auth_failed", siem.SeverityMedium, "", "Invalid API key presented", nil)
+		return nil, ErrUnauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = db.WithTenant(ctx, apiKey.TenantID)
+	if ActorFromContext(ctx) == defaultActor {
+		ctx = WithActor(ctx, apiKey.TenantID+"/"+apiKey.Name)
+	}
+	return ctx, nil
+}
+
+// IsAdmin reports whether the context has access to all tenants
+func IsAdmin(ctx context.Context) bool {
+	return db.TenantFromContext(ctx) == ""
+}
+
+// GetTenants returns all tenants
+func (s *CPMS) GetTenants(ctx context.Context) ([]*models.Tenant, error) {
+	return s.db.GetTenants(ctx)
+}
+
+// SaveTenant creates or updates a tenant
+func (s *CPMS) SaveTenant(ctx context.Context, tenant *models.Tenant) error {
+	if err := s.db.SaveTenant(ctx, tenant); err != nil {
+		return err
+	}
+
+	s.audit(ctx, "tenant.save", "tenant", tenant.ID, map[string]interface{}{"name": tenant.Name})
+	return nil
+}
+
+// SetChargePointTenant assigns a charge point to a tenant, an empty tenant ID unassigns it
+func (s *CPMS) SetChargePointTenant(ctx context.Context, chargePointID, tenantID string) error {
+	if err := s.db.SetChargePointTenant(ctx, chargePointID, tenantID); err != nil {
+		return err
+	}
+	s.centralSystem.InvalidateChargePointAuthorization(chargePointID)
+
+	s.audit(ctx, "chargepoint.tenant", "chargepoint", chargePointID, map[string]interface{}{"tenantId": tenantID})
+	return nil
+}
+
+// CreateAPIKey generates a new API key for a tenant.
+// The key is only returned here, the CPMS stores its hash.
+func (s *CPMS) CreateAPIKey(ctx context.Context, tenantID, name string) (*models.APIKey, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %v", err)
+	}
+
+	key := &models.APIKey{
+		TenantID: tenantID,
+		Name:     name,
+		Key:      hex.EncodeToString(buf),
+	}
+
+	if err := s.db.CreateAPIKey(ctx, key); err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, "apikey.create", "tenant", tenantID, map[string]interface{}{"keyId": key.ID, "name": name})
+	return key, nil
+}
+
+// GetAPIKeys returns the API keys of a tenant without the keys themselves
+func (s *CPMS) GetAPIKeys(ctx context.Context, tenantID string) ([]*models.APIKey, error) {
+	return s.db.GetAPIKeys(ctx, tenantID)
+}
+
+// RevokeAPIKey revokes an API key of a tenant
+func (s *CPMS) RevokeAPIKey(ctx context.Context, tenantID string, id int) error {
+	if err := s.db.RevokeAPIKey(ctx, tenantID, id); err != nil {
+		return err
+	}
+
+	s.audit(ctx, "apikey.revoke", "tenant", tenantID, map[string]interface{}{"keyId": id})
+	return nil
+}
+
+// GetIdTags returns the idTags visible to the caller
+func (s *CPMS) GetIdTags(ctx context.Context) ([]*models.IdTag, error) {
+	return s.db.GetIdTags(ctx)
+}
+
+// SaveIdTag creates or updates an idTag. Tenant-scoped callers can only manage their own idTags.
+func (s *CPMS) SaveIdTag(ctx context.Context, tag *models.IdTag) error {
+	if tenantID := db.TenantFromContext(ctx); tenantID != "" {
+		tag.TenantID = tenantID
+	}
+
+	if err := s.db.SaveIdTag(ctx, tag); err != nil {
+		return err
+	}
+	s.centralSystem.InvalidateIdTagAuthorization(tag.IdTag)
+	return nil
+}
+
+// DeleteIdTag removes an idTag. Tenant-scoped callers can only remove their own idTags.
+func (s *CPMS) DeleteIdTag(ctx context.Context, tenantID, idTag string) error {
+	if scoped := db.TenantFromContext(ctx); scoped != "" {
+		tenantID = scoped
+	}
+
+	if err := s.db.DeleteIdTag(ctx, tenantID, idTag); err != nil {
+		return err
+	}
+	s.centralSystem.InvalidateIdTagAuthorization(idTag)
+	return nil
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// energyMeasurand is the measurand of the energy register readings
+const energyMeasurand = "Energy.Active.Import.Register"
+
+// GetTransactionCost calculates the cost of a transaction using the configured tariff
+func (s *CPMS) GetTransactionCost(ctx context.Context, id int) (*models.SessionCost, error) {
+	tx, err := s.db.GetTransaction(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.tariff.SessionCost(ctx, tx)
+}
+
+// SetTransactionLimits sets the cost and energy caps of an in-progress transaction.
+// The transaction is stopped automatically once either cap is reached.
+func (s *CPMS) SetTransactionLimits(ctx context.Context, id int, maxCost, maxEnergy float64) error {
+	return s.db.SetTransactionLimits(ctx, id, maxCost, maxEnergy)
+}
+
+// GetActiveTransactions returns a page of the in-progress transactions matching a filter with the energy
+// delivered according to their latest meter value and their duration, and the total number of matching transactions
+func (s *CPMS) GetActiveTransactions(ctx context.Context, filter db.TransactionFilter, sort db.Sort, page db.Page) ([]*models.ActiveTransaction, int, error) {
+	filter.Status = "InProgress"
+	transactions, total, err := s.db.GetTransactions(ctx, filter, sort, page)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]int, len(transactions))
+	for i, tx := range transactions {
+		ids[i] = tx.ID
+	}
+	latest, err := s.db.GetLatestMeterValues(ctx, ids, energyMeasurand)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	active := make([]*models.ActiveTransaction, 0, len(transactions))
+	for _, tx := range transactions {
+		at := &models.ActiveTransaction{
+			Transaction:     *tx,
+			DurationSeconds: int(now.Sub(tx.StartTime).Seconds()),
+		}
+		if mv, ok := latest[tx.ID]; ok {
+			at.EnergyKWh = (mv.EnergyWh() - float64(tx.MeterStart)) / 1000
+			at.LastMeterValueAt = mv.Timestamp
+		}
+		active = append(active, at)
+	}
+	return active, total, nil
+}
+
+// GetSessionSummaries returns a page of the transactions matching a filter with the energy delivered, duration,
+// and average and peak power derived from their meter values, and the total number of matching transactions
+func (s *CPMS) GetSessionSummaries(ctx context.Context, filter db.TransactionFilter, sort db.Sort, page db.Page) ([]*models.SessionSummary, int, error) {
+	transactions, total, err := s.db.GetTransactions(ctx, filter, sort, page)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	summaries, err := s.summarizeSessions(ctx, transactions)
+	if err != nil {
+		return nil, 0, err
+	}
+	return summaries, total, nil
+}
+
+// GetSessionSummary returns a transaction with the energy delivered, duration, and average and peak power
+// derived from its meter values
+func (s *CPMS) GetSessionSummary(ctx context.Context, id int) (*models.SessionSummary, error) {
+	tx, err := s.db.GetTransaction(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries, err := s.summarizeSessions(ctx, []*models.Transaction{tx})
+	if err != nil {
+		return nil, err
+	}
+	return summaries[0], nil
+}
+
+// summarizeSessions derives the session summaries of transactions. The energy of completed transactions is
+// their meter stop minus meter start, the energy of transactions in progress is measured up to the latest
+// energy register reading. The peak power is at least the average power, which meter values may lack.
+func (s *CPMS) summarizeSessions(ctx context.Context, transactions []*models.Transaction) ([]*models.SessionSummary, error) {
+	ids := make([]int, len(transactions))
+	for i, tx := range transactions {
+		ids[i] = tx.ID
+	}
+	stats, err := s.db.GetTransactionMeterStats(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	summaries := make([]*models.SessionSummary, 0, len(transactions))
+	for _, tx := range transactions {
+		summary := &models.SessionSummary{Transaction: *tx}
+
+		end := tx.EndTime
+		if end.IsZero() {
+			end = now
+		}
+		summary.DurationSeconds = int(end.Sub(tx.StartTime).Seconds())
+
+		st, ok := stats[tx.ID]
+		if !tx.EndTime.IsZero() {
+			summary.EnergyDeliveredKWh = float64(tx.MeterStop-tx.MeterStart) / 1000
+		} else if ok && st.EnergyRegisterWh > 0 {
+			summary.EnergyDeliveredKWh = (st.EnergyRegisterWh - float64(tx.MeterStart)) / 1000
+		}
+		summary.EnergyDeliveredKWh = math.Max(summary.EnergyDeliveredKWh, 0)
+
+		if summary.DurationSeconds > 0 {
+			summary.AveragePowerKW = summary.EnergyDeliveredKWh / (float64(summary.DurationSeconds) / 3600)
+		}
+		if ok {
+			summary.PeakPowerKW = st.PeakPowerKW
+		}
+		summary.PeakPowerKW = math.Max(summary.PeakPowerKW, summary.AveragePowerKW)
+
+		if s.config.CarbonFeedEnabled {
+			if summary.Emissions, err = s.tariff.SessionEmissions(ctx, tx); err != nil {
+				return nil, err
+			}
+		}
+
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
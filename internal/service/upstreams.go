@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// ValidateUpstreamGateway checks the URL and forwarded actions of an upstream gateway
+func ValidateUpstreamGateway(gateway *models.UpstreamGateway) error {
+	u, err := url.Parse(gateway.URL)
+	if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+		return errors.New("url must be a ws:// or wss:// URL")
+	}
+	for _, action := range gateway.Actions {
+		if action == "" {
+			return errors.New("actions must not be empty")
+		}
+	}
+	return nil
+}
+
+// redactUpstreamURL masks the password of an upstream gateway's URL
+func redactUpstreamURL(gateway *models.UpstreamGateway) {
+	if u, err := url.Parse(gateway.URL); err == nil {
+		gateway.URL = u.Redacted()
+	}
+}
+
+// GetUpstreamGateways returns the upstream gateways of all charge points, with the passwords of their URLs masked
+func (s *CPMS) GetUpstreamGateways(ctx context.Context) ([]*models.UpstreamGateway, error) {
+	gateways, err := s.db.GetUpstreamGateways(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, gateway := range gateways {
+		redactUpstreamURL(gateway)
+	}
+	return gateways, nil
+}
+
+// SaveUpstreamGateway forwards the OCPP traffic of a charge point to an upstream central system, from the charge
+// point's next connection; a connected charge point is not disconnected. The password of the saved gateway's URL is masked.
+func (s *CPMS) SaveUpstreamGateway(ctx context.Context, gateway *models.UpstreamGateway) error {
+	if err := ValidateUpstreamGateway(gateway); err != nil {
+		return err
+	}
+
+	if err := s.db.SaveUpstreamGateway(ctx, gateway); err != nil {
+		return err
+	}
+	redactUpstreamURL(gateway)
+
+	s.audit(ctx, "chargepoint.upstream", "chargepoint", gateway.ChargePointID, map[string]interface{}{
+		"url":     gateway.URL,
+		"actions": gateway.Actions,
+	})
+	return nil
+}
+
+// DeleteUpstreamGateway stops forwarding the OCPP traffic of a charge point from its next connection
+func (s *CPMS) DeleteUpstreamGateway(ctx context.Context, chargePointID string) error {
+	if err := s.db.DeleteUpstreamGateway(ctx, chargePointID); err != nil {
+		return err
+	}
+
+	s.audit(ctx, "chargepoint.upstream_removed", "chargepoint", chargePointID, nil)
+	return nil
+}
@@ -0,0 +1,284 @@
+package siem
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// queueSize is the number of records buffered for forwarding
+	queueSize = 5000
+	// dialTimeout bounds connecting and writing to a syslog collector
+	dialTimeout = 5 * time.Second
+)
+
+// Record kinds
+const (
+	KindOCPP     = "ocpp"
+	KindSecurity = "security"
+)
+
+// Severities on the CEF scale of 0-10
+const (
+	SeverityInfo   = 1
+	SeverityLow    = 3
+	SeverityMedium = 5
+	SeverityHigh   = 8
+)
+
+// Record is an OCPP message or security event forwarded to the SIEM
+type Record struct {
+	Timestamp     time.Time   `json:"timestamp"`
+	Kind          string      `json:"kind"`
+	Name          string      `json:"name"` // OCPP action or security event name
+	Severity      int         `json:"severity"`
+	ChargePointID string      `json:"chargePointId,omitempty"`
+	MessageType   string      `json:"messageType,omitempty"` // Request or Response
+	Direction     string      `json:"direction,omitempty"`   // Inbound or Outbound
+	Message       string      `json:"message,omitempty"`
+	Data          interface{} `json:"data,omitempty"`
+}
+
+// Forwarder ships records to a SIEM over syslog with CEF payloads or as JSON over HTTP
+type Forwarder struct {
+	target       *url.URL
+	actions      map[string]bool // Names to forward, empty forwards all
+	chargePoints map[string]bool // Charge points to forward, empty forwards all
+	minSeverity  int
+	hostname     string
+	httpClient   *http.Client
+	conn         net.Conn
+	queue        chan Record
+}
+
+// NewForwarder creates a SIEM forwarder for a udp://, tcp:// (syslog) or http(s):// target.
+// An empty target disables forwarding.
+func NewForwarder(target string, actions, chargePoints []string, minSeverity int) *Forwarder {
+	f := &Forwarder{
+		actions:      toSet(actions),
+		chargePoints: toSet(chargePoints),
+		minSeverity:  minSeverity,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		queue:        make(chan Record, queueSize),
+	}
+	f.hostname, _ = os.Hostname()
+
+	if target != "" {
+		u, err := parseTarget(target)
+		if err != nil {
+			logrus.WithError(err).Error("Invalid SIEM target, forwarding disabled")
+			return f
+		}
+		f.target = u
+	}
+
+	return f
+}
+
+// parseTarget parses and validates a SIEM target URL
+func parseTarget(target string) (*url.URL, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "udp", "tcp", "http", "https":
+		return u, nil
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q, use udp, tcp, http or https", u.Scheme)
+	}
+}
+
+// Enabled reports whether a SIEM target is configured
+func (f *Forwarder) Enabled() bool {
+	return f != nil && f.target != nil
+}
+
+// Forward queues a record if it passes the filters. It never blocks.
+func (f *Forwarder) Forward(record Record) {
+	if !f.Enabled() {
+		return
+	}
+	if record.Severity < f.minSeverity {
+		return
+	}
+	if len(f.actions) > 0 && !f.actions[record.Name] {
+		return
+	}
+	if len(f.chargePoints) > 0 && record.ChargePointID != "" && !f.chargePoints[record.ChargePointID] {
+		return
+	}
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
+
+	select {
+	case f.queue <- record:
+	default:
+		logrus.WithFields(logrus.Fields{
+			"kind": record.Kind,
+			"name": record.Name,
+		}).Warn("SIEM queue full, dropping record")
+	}
+}
+
+// Security forwards a security event
+func (f *Forwarder) Security(name string, severity int, chargePointID, message string, data interface{}) {
+	f.Forward(Record{
+		Kind:          KindSecurity,
+		Name:          name,
+		Severity:      severity,
+		ChargePointID: chargePointID,
+		Message:       message,
+		Data:          data,
+	})
+}
+
+// Run forwards queued records until the queue is closed
+func (f *Forwarder) Run() {
+	for record := range f.queue {
+		var err error
+		if f.target.Scheme == "http" || f.target.Scheme == "https" {
+			err = f.post(record)
+		} else {
+			err = f.writeSyslog(record)
+		}
+
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"kind": record.Kind,
+				"name": record.Name,
+			}).Warn("SIEM forwarding failed")
+		}
+	}
+}
+
+func (f *Forwarder) post(record Record) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	resp, err := f.httpClient.Post(f.target.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// writeSyslog sends a record as an RFC 5424 syslog message with a CEF payload,
+// reconnecting once if the connection was lost
+func (f *Forwarder) writeSyslog(record Record) error {
+	msg := f.syslogMessage(record)
+	if f.target.Scheme == "tcp" {
+		// Octet counting framing, RFC 6587
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if f.conn == nil {
+			f.conn, err = net.DialTimeout(f.target.Scheme, f.target.Host, dialTimeout)
+			if err != nil {
+				return err
+			}
+		}
+
+		_ = f.conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+		if _, err = f.conn.Write([]byte(msg)); err == nil {
+			return nil
+		}
+
+		f.conn.Close()
+		f.conn = nil
+	}
+	return err
+}
+
+func (f *Forwarder) syslogMessage(record Record) string {
+	// Facility 13 (log audit), syslog severity derived from the CEF severity
+	pri := 13*8 + syslogSeverity(record.Severity)
+	return fmt.Sprintf("<%d>1 %s %s go-cpms - - - %s",
+		pri, record.Timestamp.UTC().Format(time.RFC3339Nano), f.hostname, CEF(record))
+}
+
+// CEF formats a record in ArcSight Common Event Format
+func CEF(record Record) string {
+	ext := []string{
+		"rt=" + cefValue(fmt.Sprint(record.Timestamp.UnixMilli())),
+		"cat=" + cefValue(record.Kind),
+	}
+	if record.ChargePointID != "" {
+		ext = append(ext, "dvchost="+cefValue(record.ChargePointID))
+	}
+	if record.MessageType != "" {
+		ext = append(ext, "cs1Label=messageType", "cs1="+cefValue(record.MessageType))
+	}
+	if record.Direction != "" {
+		ext = append(ext, "deviceDirection="+cefDirection(record.Direction))
+	}
+	if record.Message != "" {
+		ext = append(ext, "msg="+cefValue(record.Message))
+	}
+	if record.Data != nil {
+		if data, err := json.Marshal(record.Data); err == nil {
+			ext = append(ext, "cs2Label=data", "cs2="+cefValue(string(data)))
+		}
+	}
+
+	return fmt.Sprintf("CEF:0|balu-dk|go-cpms|1.0|%s|%s|%d|%s",
+		cefHeader(record.Kind+":"+record.Name), cefHeader(record.Name), record.Severity, strings.Join(ext, " "))
+}
+
+func cefHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ").Replace(s)
+}
+
+func cefValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+// cefDirection maps a message direction to CEF's 0 for inbound and 1 for outbound
+func cefDirection(direction string) string {
+	if direction == "Outbound" {
+		return "1"
+	}
+	return "0"
+}
+
+// syslogSeverity maps a CEF severity to a syslog severity
+func syslogSeverity(severity int) int {
+	switch {
+	case severity >= SeverityHigh:
+		return 2 // Critical
+	case severity >= SeverityMedium:
+		return 4 // Warning
+	case severity >= SeverityLow:
+		return 5 // Notice
+	default:
+		return 6 // Informational
+	}
+}
+
+func toSet(items []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, item := range items {
+		set[item] = true
+	}
+	return set
+}
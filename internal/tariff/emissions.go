@@ -0,0 +1,60 @@
+package tariff
+
+import (
+	"context"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// SessionEmissions calculates the CO2 emissions and renewable share of the energy of a transaction.
+// Each interval between two register readings is attributed the carbon intensity of the hour it started in.
+// It returns nil if no carbon intensity data covers the transaction.
+func (e *Engine) SessionEmissions(ctx context.Context, tx *models.Transaction) (*models.SessionEmissions, error) {
+	intervals, err := e.energyIntervals(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	return e.emissions(ctx, tx.ID, intervals)
+}
+
+// emissions attributes the carbon intensity of the hours the energy intervals of a transaction started in
+func (e *Engine) emissions(ctx context.Context, transactionID int, intervals []energyInterval) (*models.SessionEmissions, error) {
+	if len(intervals) == 0 {
+		return nil, nil
+	}
+
+	from := intervals[0].start.UTC().Truncate(time.Hour)
+	to := intervals[len(intervals)-1].start.UTC().Truncate(time.Hour).Add(time.Hour)
+	stored, err := e.db.GetCarbonIntensities(ctx, e.config.PriceArea, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(stored) == 0 {
+		return nil, nil
+	}
+
+	intensities := make(map[time.Time]*models.CarbonIntensity, len(stored))
+	for _, c := range stored {
+		intensities[c.HourStart.UTC()] = c
+	}
+
+	emissions := &models.SessionEmissions{TransactionID: transactionID}
+	var renewableKWh float64
+	for _, interval := range intervals {
+		c, ok := intensities[interval.start.UTC().Truncate(time.Hour)]
+		if !ok {
+			continue
+		}
+		emissions.EnergyKWh += interval.kWh
+		emissions.CO2Grams += interval.kWh * c.CO2PerKWh
+		renewableKWh += interval.kWh * c.RenewableShare
+	}
+	if emissions.EnergyKWh == 0 {
+		return nil, nil
+	}
+
+	emissions.CO2PerKWh = emissions.CO2Grams / emissions.EnergyKWh
+	emissions.RenewableShare = renewableKWh / emissions.EnergyKWh
+	return emissions, nil
+}
@@ -0,0 +1,141 @@
+package tariff
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/balu-dk/go-cpms/config"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+// Tariff modes
+const (
+	ModeFlat = "flat"
+	ModeSpot = "spot"
+	ModeFree = "free" // Transactions started in free vend mode
+)
+
+// energyMeasurand is the measurand used to calculate delivered energy
+const energyMeasurand = "Energy.Active.Import.Register"
+
+// Engine prices charging sessions using either a flat tariff or spot price + markup
+type Engine struct {
+	db     db.Store
+	config *config.Config
+}
+
+// NewEngine creates a new tariff engine
+func NewEngine(cfg *config.Config, store db.Store) *Engine {
+	return &Engine{
+		db:     store,
+		config: cfg,
+	}
+}
+
+// PriceAt returns the price per kWh at a given time
+func (e *Engine) PriceAt(ctx context.Context, t time.Time) (float64, error) {
+	if e.config.TariffMode != ModeSpot {
+		return e.config.TariffFlatPrice, nil
+	}
+
+	hourStart := t.UTC().Truncate(time.Hour)
+	prices, err := e.db.GetSpotPrices(ctx, e.config.PriceArea, hourStart, hourStart.Add(time.Hour))
+	if err != nil {
+		return 0, err
+	}
+	if len(prices) == 0 {
+		return 0, fmt.Errorf("no spot price available for %s at %s", e.config.PriceArea, hourStart.Format(time.RFC3339))
+	}
+
+	// Spot prices are quoted per MWh
+	return prices[0].PricePerMWh/1000 + e.config.TariffSpotMarkup, nil
+}
+
+// energyInterval is the energy delivered between two energy register readings of a transaction
+type energyInterval struct {
+	start time.Time
+	kWh   float64
+}
+
+// energyIntervals returns the intervals between the energy register readings of a transaction in which energy was delivered
+func (e *Engine) energyIntervals(ctx context.Context, tx *models.Transaction) ([]energyInterval, error) {
+	samples, err := e.db.GetTransactionMeterValues(ctx, tx.ID, energyMeasurand)
+	if err != nil {
+		return nil, err
+	}
+
+	type reading struct {
+		at  time.Time
+		kWh float64
+	}
+
+	readings := []reading{{at: tx.StartTime, kWh: float64(tx.MeterStart) / 1000}}
+	for _, mv := range samples {
+		// A reading whose implausible timestamp was replaced can't be placed in time,
+		// its energy is priced with the interval of the next reading instead
+		if mv.TimestampAdjusted {
+			continue
+		}
+		readings = append(readings, reading{at: mv.Timestamp, kWh: toKWh(mv.Value, mv.Unit)})
+	}
+	if !tx.EndTime.IsZero() {
+		readings = append(readings, reading{at: tx.EndTime, kWh: float64(tx.MeterStop) / 1000})
+	}
+
+	var intervals []energyInterval
+	for i := 1; i < len(readings); i++ {
+		if delta := readings[i].kWh - readings[i-1].kWh; delta > 0 {
+			intervals = append(intervals, energyInterval{start: readings[i-1].at, kWh: delta})
+		}
+	}
+	return intervals, nil
+}
+
+// SessionCost calculates the cost of a transaction from its energy meter values.
+// Each interval between two register readings is priced at the rate valid at its start.
+// Transactions started in free vend mode only have their energy counted.
+// The cost includes the emissions of the session if carbon intensity data covers it.
+func (e *Engine) SessionCost(ctx context.Context, tx *models.Transaction) (*models.SessionCost, error) {
+	intervals, err := e.energyIntervals(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	cost := &models.SessionCost{
+		TransactionID: tx.ID,
+		Currency:      e.config.PriceCurrency,
+		TariffMode:    e.config.TariffMode,
+	}
+	if tx.FreeVend {
+		cost.TariffMode = ModeFree
+	}
+
+	for _, interval := range intervals {
+		cost.EnergyKWh += interval.kWh
+		if tx.FreeVend {
+			continue
+		}
+
+		price, err := e.PriceAt(ctx, interval.start)
+		if err != nil {
+			return nil, err
+		}
+		cost.Cost += interval.kWh * price
+	}
+
+	if cost.Emissions, err = e.emissions(ctx, tx.ID, intervals); err != nil {
+		return nil, err
+	}
+
+	return cost, nil
+}
+
+// toKWh converts an energy register value to kWh
+func toKWh(value float64, unit string) float64 {
+	if unit == "kWh" {
+		return value
+	}
+	return value / 1000
+}
@@ -0,0 +1,156 @@
+package tariff
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/balu-dk/go-cpms/config"
+	"github.com/balu-dk/go-cpms/internal/db"
+	"github.com/balu-dk/go-cpms/internal/db/models"
+)
+
+func TestSessionCost(t *testing.T) {
+	hour := func(h, m int) time.Time { return time.Date(2026, 3, 2, h, m, 0, 0, time.UTC) }
+	reading := func(at time.Time, value float64, unit string) *models.MeterValue {
+		return &models.MeterValue{TransactionID: 1, Timestamp: at, Value: value, Unit: unit, Measurand: energyMeasurand}
+	}
+
+	// 1.00 per kWh from 10:00 and 2.00 per kWh from 11:00, before the markup of 0.50
+	spotPrices := []*models.SpotPrice{
+		{PriceArea: "DK1", HourStart: hour(10, 0), PricePerMWh: 1000, Currency: "DKK"},
+		{PriceArea: "DK1", HourStart: hour(11, 0), PricePerMWh: 2000, Currency: "DKK"},
+	}
+
+	tests := []struct {
+		name     string
+		mode     string
+		freeVend bool
+		start    time.Time
+		readings []*models.MeterValue
+		wantKWh  float64
+		wantCost float64
+		wantMode string
+		wantErr  bool
+	}{
+		{
+			name:     "flat tariff",
+			mode:     ModeFlat,
+			start:    hour(10, 30),
+			readings: []*models.MeterValue{reading(hour(11, 15), 5000, "Wh")},
+			wantKWh:  8,
+			wantCost: 24,
+			wantMode: ModeFlat,
+		},
+		{
+			name:     "spot intervals priced at their start",
+			mode:     ModeSpot,
+			start:    hour(10, 30),
+			readings: []*models.MeterValue{reading(hour(11, 15), 5000, "Wh")},
+			wantKWh:  8,
+			wantCost: 5*1.5 + 3*2.5,
+			wantMode: ModeSpot,
+		},
+		{
+			name:     "kWh register readings",
+			mode:     ModeSpot,
+			start:    hour(10, 30),
+			readings: []*models.MeterValue{reading(hour(11, 15), 5, "kWh")},
+			wantKWh:  8,
+			wantCost: 5*1.5 + 3*2.5,
+			wantMode: ModeSpot,
+		},
+		{
+			name:  "per-phase readings ignored",
+			mode:  ModeSpot,
+			start: hour(10, 30),
+			readings: []*models.MeterValue{
+				{TransactionID: 1, Timestamp: hour(11, 0), Value: 1000, Unit: "Wh", Measurand: energyMeasurand, Phase: "L1"},
+				reading(hour(11, 15), 5000, "Wh"),
+			},
+			wantKWh:  8,
+			wantCost: 5*1.5 + 3*2.5,
+			wantMode: ModeSpot,
+		},
+		{
+			name:  "reading with an adjusted timestamp priced with the next interval",
+			mode:  ModeSpot,
+			start: hour(10, 30),
+			readings: []*models.MeterValue{
+				{TransactionID: 1, Timestamp: hour(11, 15), Value: 5000, Unit: "Wh", Measurand: energyMeasurand, TimestampAdjusted: true},
+			},
+			wantKWh:  8,
+			wantCost: 8 * 1.5,
+			wantMode: ModeSpot,
+		},
+		{
+			name:     "free vend counts energy only",
+			mode:     ModeSpot,
+			freeVend: true,
+			start:    hour(10, 30),
+			readings: []*models.MeterValue{reading(hour(11, 15), 5000, "Wh")},
+			wantKWh:  8,
+			wantCost: 0,
+			wantMode: ModeFree,
+		},
+		{
+			name:    "no spot price for an interval",
+			mode:    ModeSpot,
+			start:   hour(9, 30),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := db.NewMemoryStore()
+			if err := store.SaveSpotPrices(ctx, spotPrices); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.SaveMeterValues(ctx, tt.readings); err != nil {
+				t.Fatal(err)
+			}
+
+			engine := NewEngine(&config.Config{
+				PriceArea:        "DK1",
+				PriceCurrency:    "DKK",
+				TariffMode:       tt.mode,
+				TariffFlatPrice:  3,
+				TariffSpotMarkup: 0.5,
+			}, store)
+
+			tx := &models.Transaction{
+				ID:        1,
+				StartTime: tt.start,
+				EndTime:   hour(11, 45),
+				MeterStop: 8000,
+				FreeVend:  tt.freeVend,
+			}
+			cost, err := engine.SessionCost(ctx, tx)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("SessionCost() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SessionCost() error = %v", err)
+			}
+
+			if math.Abs(cost.EnergyKWh-tt.wantKWh) > 1e-9 {
+				t.Errorf("EnergyKWh = %v, want %v", cost.EnergyKWh, tt.wantKWh)
+			}
+			if math.Abs(cost.Cost-tt.wantCost) > 1e-9 {
+				t.Errorf("Cost = %v, want %v", cost.Cost, tt.wantCost)
+			}
+			if cost.TariffMode != tt.wantMode {
+				t.Errorf("TariffMode = %q, want %q", cost.TariffMode, tt.wantMode)
+			}
+			if cost.Currency != "DKK" {
+				t.Errorf("Currency = %q, want DKK", cost.Currency)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/balu-dk/go-cpms/internal/events"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// queueSize is the number of events buffered for delivery
+	queueSize = 1000
+	// maxAttempts is the number of delivery attempts per endpoint
+	maxAttempts = 3
+	// retryBackoff is the delay before the first redelivery, doubled for every attempt
+	retryBackoff = 2 * time.Second
+)
+
+// Dispatcher delivers events to the configured webhook endpoints
+type Dispatcher struct {
+	mu         sync.RWMutex
+	urls       []string
+	secret     string
+	eventTypes map[string]bool // Event types to deliver, empty delivers all
+	httpClient *http.Client
+	queue      chan events.Event
+}
+
+// NewDispatcher creates a new webhook dispatcher
+func NewDispatcher(urls []string, secret string, eventTypes []string) *Dispatcher {
+	d := &Dispatcher{
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		queue:      make(chan events.Event, queueSize),
+	}
+	d.SetEndpoints(urls, secret, eventTypes)
+	return d
+}
+
+// SetEndpoints replaces the endpoints, the signing secret and the event types to deliver.
+// Events already queued are delivered to the new endpoints.
+func (d *Dispatcher) SetEndpoints(urls []string, secret string, eventTypes []string) {
+	types := make(map[string]bool)
+	for _, t := range eventTypes {
+		types[t] = true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.urls = urls
+	d.secret = secret
+	d.eventTypes = types
+}
+
+// Enabled reports whether any webhook endpoints are configured
+func (d *Dispatcher) Enabled() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.urls) > 0
+}
+
+// Handle queues an event for delivery. It is meant to be subscribed to an events.Bus.
+func (d *Dispatcher) Handle(event events.Event) {
+	d.mu.RLock()
+	deliver := len(d.urls) > 0 && (len(d.eventTypes) == 0 || d.eventTypes[event.Type])
+	d.mu.RUnlock()
+	if !deliver {
+		return
+	}
+
+	select {
+	case d.queue <- event:
+	default:
+		logrus.WithFields(logrus.Fields{
+			"eventID":   event.ID,
+			"eventType": event.Type,
+		}).Warn("Webhook queue full, dropping event")
+	}
+}
+
+// Run delivers queued events until the queue is closed
+func (d *Dispatcher) Run() {
+	for event := range d.queue {
+		body, err := json.Marshal(event)
+		if err != nil {
+			logrus.WithError(err).WithField("eventID", event.ID).Error("Failed to marshal webhook event")
+			continue
+		}
+
+		d.mu.RLock()
+		urls, secret := d.urls, d.secret
+		d.mu.RUnlock()
+
+		for _, url := range urls {
+			d.deliver(url, secret, event, body)
+		}
+	}
+}
+
+// deliver posts an event to a single endpoint, retrying with backoff on failure
+func (d *Dispatcher) deliver(url, secret string, event events.Event, body []byte) {
+	backoff := retryBackoff
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err := d.post(url, secret, event, body)
+		if err == nil {
+			return
+		}
+
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"url":       url,
+			"eventID":   event.ID,
+			"eventType": event.Type,
+			"attempt":   attempt,
+		}).Warn("Webhook delivery failed")
+
+		if attempt < maxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+func (d *Dispatcher) post(url, secret string, event events.Event, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Type", event.Type)
+	req.Header.Set("X-Event-ID", event.ID)
+	if secret != "" {
+		req.Header.Set("X-Signature", Sign(secret, body))
+	}
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 signature of a body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,15 @@
+// Package migrations embeds the SQL schema of the CPMS database
+package migrations
+
+import _ "embed"
+
+// Schema creates or updates all tables. It is idempotent and can be applied to an existing database.
+//
+//go:embed schema.sql
+var Schema string
+
+// Timescale converts the time series tables to TimescaleDB hypertables, applied after Schema
+// when TIMESCALE_ENABLED is set
+//
+//go:embed timescale.sql
+var Timescale string
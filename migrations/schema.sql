@@ -39,7 +39,7 @@ CREATE TABLE IF NOT EXISTS transactions (
     end_time TIMESTAMP WITH TIME ZONE,
     meter_start INTEGER NOT NULL,
     meter_stop INTEGER,
-    status VARCHAR(20) NOT NULL, -- InProgress, Completed, Stopped
+    status VARCHAR(20) NOT NULL, -- InProgress, Completed, Stopped, Orphaned
     created_at TIMESTAMP WITH TIME ZONE NOT NULL,
     updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
     CONSTRAINT transaction_connector_fk FOREIGN KEY (charge_point_id, connector_id) REFERENCES connectors(charge_point_id, id)
@@ -49,7 +49,7 @@ CREATE TABLE IF NOT EXISTS transactions (
 CREATE TABLE IF NOT EXISTS ocpp_messages (
     id SERIAL PRIMARY KEY,
     charge_point_id VARCHAR(100) NOT NULL REFERENCES charge_points(id),
-    message_type VARCHAR(20) NOT NULL, -- Request or Response
+    message_type VARCHAR(20) NOT NULL, -- Request, Response or Error
     action VARCHAR(100) NOT NULL,
     request_id VARCHAR(100) NOT NULL,
     payload JSONB NOT NULL,
@@ -77,4 +77,566 @@ CREATE INDEX IF NOT EXISTS meter_values_cp_connector_idx ON meter_values(charge_
 
 -- Create indexes
 CREATE INDEX IF NOT EXISTS charge_points_connected_idx ON charge_points(is_connected);
-CREATE INDEX IF NOT EXISTS transactions_status_idx ON transactions(status);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS transactions_status_idx ON transactions(status);
+-- Firmware updates table for tracking UpdateFirmware requests and their retries
+CREATE TABLE IF NOT EXISTS firmware_updates (
+    id SERIAL PRIMARY KEY,
+    charge_point_id VARCHAR(100) NOT NULL REFERENCES charge_points(id) ON DELETE CASCADE,
+    locations TEXT[] NOT NULL, -- Primary location followed by mirror locations
+    retrieve_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    status VARCHAR(30) NOT NULL, -- Pending, Downloading, Downloaded, Installing, Installed, RetryScheduled, Failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    next_retry_at TIMESTAMP WITH TIME ZONE,
+    last_error VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX IF NOT EXISTS firmware_updates_cp_idx ON firmware_updates(charge_point_id);
+CREATE INDEX IF NOT EXISTS firmware_updates_retry_idx ON firmware_updates(status, next_retry_at);
+
+-- Spot prices table for day-ahead electricity prices
+CREATE TABLE IF NOT EXISTS spot_prices (
+    price_area VARCHAR(10) NOT NULL,
+    hour_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    price_per_mwh DOUBLE PRECISION NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (price_area, hour_start)
+);
+
+-- Session limits and stop reason on transactions
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS max_cost DOUBLE PRECISION;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS max_energy DOUBLE PRECISION; -- kWh
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS stop_reason VARCHAR(50);
+
+-- Sites table grouping charge points at one location
+CREATE TABLE IF NOT EXISTS sites (
+    id VARCHAR(100) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    solar_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    solar_meter_url VARCHAR(255),
+    min_current DOUBLE PRECISION NOT NULL DEFAULT 6,
+    max_current DOUBLE PRECISION NOT NULL DEFAULT 32,
+    phases INTEGER NOT NULL DEFAULT 3,
+    voltage DOUBLE PRECISION NOT NULL DEFAULT 230,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+ALTER TABLE charge_points ADD COLUMN IF NOT EXISTS site_id VARCHAR(100) REFERENCES sites(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS charge_points_site_idx ON charge_points(site_id);
+
+-- Grid events table for demand-response / curtailment signals
+CREATE TABLE IF NOT EXISTS grid_events (
+    id VARCHAR(100) PRIMARY KEY,
+    site_id VARCHAR(100) NOT NULL REFERENCES sites(id) ON DELETE CASCADE,
+    limit_kw DOUBLE PRECISION NOT NULL,
+    start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    status VARCHAR(20) NOT NULL, -- Scheduled, Active, Completed, Cancelled
+    source VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX IF NOT EXISTS grid_events_status_idx ON grid_events(status);
+
+-- Parking enforcement: max-stay rules per site and plug-in tracking per connector
+ALTER TABLE sites ADD COLUMN IF NOT EXISTS max_stay_minutes INTEGER NOT NULL DEFAULT 0; -- 0 means no max-stay rule
+ALTER TABLE sites ADD COLUMN IF NOT EXISTS overstay_warning_minutes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE connectors ADD COLUMN IF NOT EXISTS occupied_since TIMESTAMP WITH TIME ZONE;
+
+-- Charge point groups
+CREATE TABLE IF NOT EXISTS groups (
+    id VARCHAR(100) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    frozen BOOLEAN NOT NULL DEFAULT FALSE, -- Blocks firmware updates and configuration changes
+    freeze_reason VARCHAR(255),
+    frozen_by VARCHAR(100),
+    frozen_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id VARCHAR(100) NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    charge_point_id VARCHAR(100) NOT NULL REFERENCES charge_points(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (group_id, charge_point_id)
+);
+CREATE INDEX IF NOT EXISTS group_members_cp_idx ON group_members(charge_point_id);
+
+-- Time-limited exceptions to a group freeze
+CREATE TABLE IF NOT EXISTS freeze_overrides (
+    id SERIAL PRIMARY KEY,
+    group_id VARCHAR(100) NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    charge_point_id VARCHAR(100), -- NULL applies to all members
+    action VARCHAR(20) NOT NULL, -- firmware or configuration
+    reason VARCHAR(255) NOT NULL,
+    approved_by VARCHAR(100) NOT NULL,
+    valid_until TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX IF NOT EXISTS freeze_overrides_group_idx ON freeze_overrides(group_id, valid_until);
+
+-- Audit log of operator and policy actions
+CREATE TABLE IF NOT EXISTS audit_log (
+    id SERIAL PRIMARY KEY,
+    actor VARCHAR(100) NOT NULL,
+    action VARCHAR(100) NOT NULL,
+    target_type VARCHAR(50) NOT NULL,
+    target_id VARCHAR(100) NOT NULL,
+    details JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_log_target_idx ON audit_log(target_type, target_id);
+CREATE INDEX IF NOT EXISTS audit_log_created_idx ON audit_log(created_at);
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS client_addr VARCHAR(45);
+
+-- Tenants: CPO customers served by this instance
+CREATE TABLE IF NOT EXISTS tenants (
+    id VARCHAR(100) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    tenant_id VARCHAR(100) NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE, -- SHA-256 of the key, the key itself is never stored
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS id_tags (
+    tenant_id VARCHAR(100) NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    id_tag VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (tenant_id, id_tag)
+);
+
+ALTER TABLE charge_points ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(100) REFERENCES tenants(id);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(100) REFERENCES tenants(id);
+CREATE INDEX IF NOT EXISTS charge_points_tenant_idx ON charge_points(tenant_id);
+CREATE INDEX IF NOT EXISTS transactions_tenant_idx ON transactions(tenant_id);
+
+-- Support impersonation sessions letting an admin act within a tenant's scope
+CREATE TABLE IF NOT EXISTS impersonation_sessions (
+    id SERIAL PRIMARY KEY,
+    token_hash VARCHAR(64) NOT NULL UNIQUE, -- SHA-256 of the session token
+    tenant_id VARCHAR(100) NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    actor VARCHAR(100) NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ended_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Command tracker: every command sent to a charge point and its outcome
+CREATE TABLE IF NOT EXISTS commands (
+    id SERIAL PRIMARY KEY,
+    charge_point_id VARCHAR(100) NOT NULL REFERENCES charge_points(id) ON DELETE CASCADE,
+    action VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(30) NOT NULL, -- Pending, Failed or the status confirmed by the charge point
+    response JSONB,
+    error TEXT,
+    actor VARCHAR(100) NOT NULL,
+    macro_run_id INTEGER,
+    step INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS commands_cp_idx ON commands(charge_point_id, created_at);
+CREATE INDEX IF NOT EXISTS commands_macro_run_idx ON commands(macro_run_id);
+
+-- Command macros: named sequences of commands run against a charge point or fleet
+CREATE TABLE IF NOT EXISTS macros (
+    id VARCHAR(100) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    steps JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS macro_runs (
+    id SERIAL PRIMARY KEY,
+    macro_id VARCHAR(100) NOT NULL REFERENCES macros(id) ON DELETE CASCADE,
+    charge_point_ids TEXT[] NOT NULL,
+    status VARCHAR(20) NOT NULL, -- Running, Completed, Failed
+    actor VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Shared registry of the CPMS instance holding each charge point's websocket
+CREATE TABLE IF NOT EXISTS charge_point_connections (
+    charge_point_id VARCHAR(100) PRIMARY KEY,
+    instance_id VARCHAR(100) NOT NULL,
+    instance_url VARCHAR(255) NOT NULL, -- Internal API base URL commands are forwarded to
+    connected_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX IF NOT EXISTS charge_point_connections_instance_idx ON charge_point_connections(instance_id);
+
+-- Transaction IDs are taken from a sequence, so instances sharing the database and restarts never reuse one.
+-- The sequence continues after the IDs the CPMS assigned itself before.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_class WHERE relkind = 'S' AND relname = 'transactions_id_seq') THEN
+        CREATE SEQUENCE transactions_id_seq OWNED BY transactions.id;
+        PERFORM setval('transactions_id_seq', COALESCE((SELECT MAX(id) FROM transactions), 1000));
+        ALTER TABLE transactions ALTER COLUMN id SET DEFAULT nextval('transactions_id_seq');
+    END IF;
+END $$;
+
+-- Charger-reported error details of StatusNotification
+ALTER TABLE connectors ADD COLUMN IF NOT EXISTS info VARCHAR(50);
+ALTER TABLE connectors ADD COLUMN IF NOT EXISTS vendor_id VARCHAR(255);
+ALTER TABLE connectors ADD COLUMN IF NOT EXISTS vendor_error_code VARCHAR(50);
+
+CREATE TABLE IF NOT EXISTS connector_status_events (
+    id SERIAL PRIMARY KEY,
+    charge_point_id VARCHAR(100) NOT NULL REFERENCES charge_points(id) ON DELETE CASCADE,
+    connector_id INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    error_code VARCHAR(50) NOT NULL,
+    info VARCHAR(50),
+    vendor_id VARCHAR(255),
+    vendor_error_code VARCHAR(50),
+    timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX IF NOT EXISTS connector_status_events_cp_idx ON connector_status_events(charge_point_id, timestamp);
+
+-- End-to-end session identifiers tying commands, transactions, meter values and events together
+CREATE TABLE IF NOT EXISTS pending_sessions (
+    charge_point_id VARCHAR(100) NOT NULL,
+    id_tag VARCHAR(20) NOT NULL,
+    session_id UUID NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (charge_point_id, id_tag)
+);
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS session_id UUID;
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS session_id UUID;
+ALTER TABLE meter_values ADD COLUMN IF NOT EXISTS session_id UUID;
+CREATE INDEX IF NOT EXISTS transactions_session_idx ON transactions(session_id);
+CREATE INDEX IF NOT EXISTS commands_session_idx ON commands(session_id);
+CREATE INDEX IF NOT EXISTS meter_values_session_idx ON meter_values(session_id);
+
+-- ID of the API request that caused a command or an OCPP message, for tracing a request end to end
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS request_id VARCHAR(64);
+ALTER TABLE ocpp_messages ADD COLUMN IF NOT EXISTS api_request_id VARCHAR(64);
+CREATE INDEX IF NOT EXISTS commands_request_idx ON commands(request_id);
+CREATE INDEX IF NOT EXISTS ocpp_messages_api_request_idx ON ocpp_messages(api_request_id);
+
+-- Monthly partitioning of meter_values by sample timestamp.
+-- An unpartitioned meter_values table is converted once, with partitions covering its existing rows.
+DO $$
+DECLARE
+    partition_month DATE;
+    last_month DATE;
+    is_hypertable BOOLEAN := FALSE;
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = 'meter_values'::regclass) THEN
+        RETURN;
+    END IF;
+
+    -- Left alone once converted to a hypertable by timescale.sql
+    IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb') THEN
+        EXECUTE 'SELECT EXISTS (SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_name = ''meter_values'')'
+        INTO is_hypertable;
+        IF is_hypertable THEN
+            RETURN;
+        END IF;
+    END IF;
+
+    ALTER TABLE meter_values RENAME TO meter_values_unpartitioned;
+    ALTER INDEX meter_values_pkey RENAME TO meter_values_unpartitioned_pkey;
+    DROP INDEX IF EXISTS meter_values_transaction_idx;
+    DROP INDEX IF EXISTS meter_values_cp_connector_idx;
+    DROP INDEX IF EXISTS meter_values_session_idx;
+
+    CREATE TABLE meter_values (
+        id INTEGER NOT NULL DEFAULT nextval('meter_values_id_seq'),
+        transaction_id INTEGER REFERENCES transactions(id),
+        charge_point_id VARCHAR(100) NOT NULL REFERENCES charge_points(id),
+        connector_id INTEGER NOT NULL,
+        timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+        value DOUBLE PRECISION NOT NULL,
+        unit VARCHAR(10) NOT NULL,
+        measurand VARCHAR(50) NOT NULL,
+        created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+        session_id UUID,
+        PRIMARY KEY (id, timestamp),
+        CONSTRAINT meter_values_connector_fk FOREIGN KEY (charge_point_id, connector_id) REFERENCES connectors(charge_point_id, id)
+    ) PARTITION BY RANGE (timestamp);
+    ALTER SEQUENCE meter_values_id_seq OWNED BY meter_values.id;
+
+    -- Samples with timestamps outside the monthly partitions, e.g. from chargers with a wrong clock
+    CREATE TABLE meter_values_default PARTITION OF meter_values DEFAULT;
+
+    SELECT date_trunc('month', COALESCE(MIN(timestamp), now()))::date,
+           date_trunc('month', GREATEST(COALESCE(MAX(timestamp), now()), now()))::date
+    INTO partition_month, last_month
+    FROM meter_values_unpartitioned;
+
+    WHILE partition_month <= last_month LOOP
+        EXECUTE format(
+            'CREATE TABLE %I PARTITION OF meter_values FOR VALUES FROM (%L) TO (%L)',
+            'meter_values_' || to_char(partition_month, 'YYYY_MM'), partition_month, partition_month + INTERVAL '1 month'
+        );
+        partition_month := partition_month + INTERVAL '1 month';
+    END LOOP;
+
+    INSERT INTO meter_values (
+        id, transaction_id, charge_point_id, connector_id, timestamp, value, unit, measurand, created_at, session_id
+    )
+    SELECT id, transaction_id, charge_point_id, connector_id, timestamp, value, unit, measurand, created_at, session_id
+    FROM meter_values_unpartitioned;
+
+    DROP TABLE meter_values_unpartitioned;
+END $$;
+
+CREATE INDEX IF NOT EXISTS meter_values_transaction_idx ON meter_values(transaction_id);
+CREATE INDEX IF NOT EXISTS meter_values_cp_connector_idx ON meter_values(charge_point_id, connector_id);
+CREATE INDEX IF NOT EXISTS meter_values_session_idx ON meter_values(session_id);
+
+-- ID of the API request that caused a command or an OCPP message, for tracing a request end to end
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS request_id VARCHAR(64);
+ALTER TABLE ocpp_messages ADD COLUMN IF NOT EXISTS api_request_id VARCHAR(64);
+CREATE INDEX IF NOT EXISTS commands_request_idx ON commands(request_id);
+CREATE INDEX IF NOT EXISTS ocpp_messages_api_request_idx ON ocpp_messages(api_request_id);
+CREATE INDEX IF NOT EXISTS meter_values_timestamp_idx ON meter_values(timestamp);
+
+-- Downsampled meter values kept after the raw samples passed the retention period
+CREATE TABLE IF NOT EXISTS meter_value_aggregates (
+    charge_point_id VARCHAR(100) NOT NULL REFERENCES charge_points(id) ON DELETE CASCADE,
+    connector_id INTEGER NOT NULL,
+    transaction_id INTEGER,
+    session_id UUID,
+    measurand VARCHAR(50) NOT NULL,
+    unit VARCHAR(10) NOT NULL,
+    bucket_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    bucket_minutes INTEGER NOT NULL,
+    avg_value DOUBLE PRECISION NOT NULL,
+    min_value DOUBLE PRECISION NOT NULL,
+    max_value DOUBLE PRECISION NOT NULL,
+    samples INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS meter_value_aggregates_cp_idx ON meter_value_aggregates(charge_point_id, bucket_start);
+CREATE INDEX IF NOT EXISTS meter_value_aggregates_transaction_idx ON meter_value_aggregates(transaction_id);
+
+-- Orderings of the paginated list endpoints
+CREATE INDEX IF NOT EXISTS charge_points_created_idx ON charge_points(created_at DESC, id);
+CREATE INDEX IF NOT EXISTS transactions_start_time_idx ON transactions(start_time DESC, id DESC);
+CREATE INDEX IF NOT EXISTS ocpp_messages_cp_id_id_idx ON ocpp_messages(charge_point_id, id DESC);
+
+-- Transactions closed by the CPMS after the charge point lost them, whose energy and cost need checking
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS billing_review BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Transactions the charge point started while offline, authorizing the idTag itself
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS offline_authorized BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Lookup of retransmitted StartTransaction requests
+CREATE INDEX IF NOT EXISTS transactions_cp_connector_start_idx ON transactions(charge_point_id, connector_id, start_time);
+
+-- Group of an idTag, letting the idTags of a group stop each other's transactions
+ALTER TABLE id_tags ADD COLUMN IF NOT EXISTS parent_id_tag VARCHAR(20);
+
+-- Blocking and expiry of idTags
+ALTER TABLE id_tags ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'Accepted'; -- Accepted, Blocked
+ALTER TABLE id_tags ADD COLUMN IF NOT EXISTS expiry_date TIMESTAMP WITH TIME ZONE;
+
+-- Free vend mode, in which charge points accept every idTag and transactions cost nothing
+ALTER TABLE charge_points ADD COLUMN IF NOT EXISTS free_vend BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE sites ADD COLUMN IF NOT EXISTS free_vend BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS free_vend BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Connector attributes maintained by the operator
+ALTER TABLE connectors ADD COLUMN IF NOT EXISTS plug_type VARCHAR(50);
+ALTER TABLE connectors ADD COLUMN IF NOT EXISTS format VARCHAR(10);
+ALTER TABLE connectors ADD COLUMN IF NOT EXISTS max_power_kw DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE connectors ADD COLUMN IF NOT EXISTS phases INTEGER NOT NULL DEFAULT 0;
+
+-- Identifiers of the vehicle charged in a transaction, as reported by the charge point
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS vehicle_mac VARCHAR(50);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS vehicle_vin VARCHAR(50);
+CREATE INDEX IF NOT EXISTS transactions_vehicle_vin_idx ON transactions(vehicle_vin);
+
+-- Departure-time aware smart charging
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS target_energy DOUBLE PRECISION; -- kWh
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS departure_time TIMESTAMP WITH TIME ZONE;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS price_optimized BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Opt-outs of spot price optimized charging
+ALTER TABLE charge_points ADD COLUMN IF NOT EXISTS spot_opt_out BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS spot_opt_out BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Alerting: operator-defined rules and the alerts they raise
+ALTER TABLE connectors ADD COLUMN IF NOT EXISTS status_since TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id VARCHAR(100) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    condition VARCHAR(30) NOT NULL, -- connector_faulted, chargepoint_offline, firmware_failed, error_code
+    charge_point_id VARCHAR(100), -- NULL applies to all charge points
+    duration_minutes INTEGER NOT NULL DEFAULT 0,
+    error_code VARCHAR(255),
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS alerts (
+    id SERIAL PRIMARY KEY,
+    rule_id VARCHAR(100) NOT NULL, -- Kept when the rule is deleted
+    rule_name VARCHAR(255) NOT NULL,
+    condition VARCHAR(30) NOT NULL,
+    charge_point_id VARCHAR(100) NOT NULL,
+    connector_id INTEGER NOT NULL DEFAULT 0,
+    state VARCHAR(20) NOT NULL, -- firing, resolved
+    message TEXT NOT NULL,
+    fired_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    resolved_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS alerts_state_idx ON alerts(state, fired_at DESC);
+
+-- Diagnostics collected on connector faults
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS diagnostics_file TEXT;
+
+-- GDPR erasure log, proving the personal data of an idTag was erased without keeping the idTag
+CREATE TABLE IF NOT EXISTS erasures (
+    id SERIAL PRIMARY KEY,
+    id_tag_hash VARCHAR(64) NOT NULL, -- Hex SHA-256 of the erased idTag
+    pseudonym VARCHAR(20) NOT NULL,
+    actor VARCHAR(100) NOT NULL,
+    reason TEXT,
+    transactions_anonymized INTEGER NOT NULL,
+    commands_anonymized INTEGER NOT NULL,
+    id_tags_deleted INTEGER NOT NULL,
+    messages_deleted INTEGER NOT NULL,
+    erased_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX IF NOT EXISTS erasures_id_tag_hash_idx ON erasures(id_tag_hash);
+
+-- Metadata of charge point connections, for verifying which SIM or network a charger uses
+ALTER TABLE charge_points ADD COLUMN IF NOT EXISTS remote_addr VARCHAR(64);
+ALTER TABLE charge_points ADD COLUMN IF NOT EXISTS subprotocol VARCHAR(20);
+ALTER TABLE charge_points ADD COLUMN IF NOT EXISTS connection_headers JSONB;
+
+CREATE TABLE IF NOT EXISTS charge_point_connections (
+    id SERIAL PRIMARY KEY,
+    charge_point_id VARCHAR(100) NOT NULL REFERENCES charge_points(id) ON DELETE CASCADE,
+    remote_addr VARCHAR(64) NOT NULL,
+    subprotocol VARCHAR(20) NOT NULL,
+    headers JSONB NOT NULL,
+    connected_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    disconnected_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS charge_point_connections_cp_idx ON charge_point_connections(charge_point_id, connected_at);
+
+-- Networks charge points may or may not connect from, checked during the websocket handshake
+CREATE TABLE IF NOT EXISTS address_rules (
+    id VARCHAR(100) PRIMARY KEY,
+    tenant_id VARCHAR(100) REFERENCES tenants(id) ON DELETE CASCADE, -- NULL applies to all charge points
+    cidr VARCHAR(50) NOT NULL,
+    action VARCHAR(10) NOT NULL, -- allow, deny
+    description TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Basic auth passwords of charge points and their rotations
+ALTER TABLE charge_points ADD COLUMN IF NOT EXISTS password_hash VARCHAR(64); -- Hex SHA-256, NULL connects without a password
+
+CREATE TABLE IF NOT EXISTS credential_rotations (
+    id SERIAL PRIMARY KEY,
+    charge_point_id VARCHAR(100) NOT NULL REFERENCES charge_points(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL, -- Pending, AwaitingReconnect, Completed, Failed, Superseded
+    command_id INTEGER,
+    error TEXT,
+    actor VARCHAR(100),
+    password_hash VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS credential_rotations_cp_idx ON credential_rotations(charge_point_id, created_at DESC);
+
+-- Charger clock drift measured from message timestamps
+ALTER TABLE charge_points ADD COLUMN IF NOT EXISTS clock_drift_ms BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE charge_points ADD COLUMN IF NOT EXISTS clock_drift_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE charge_points ADD COLUMN IF NOT EXISTS clock_drift_flagged BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Implausible charger timestamps replaced by the receive time under the normalize timestamp policy
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS timestamp_adjusted BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reported_start_time TIMESTAMP WITH TIME ZONE; -- NULL unless the start time was replaced
+ALTER TABLE meter_values ADD COLUMN IF NOT EXISTS timestamp_adjusted BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE connector_status_events ADD COLUMN IF NOT EXISTS timestamp_adjusted BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- SampledValue attributes of meter values, NULL in values stored before they were recorded
+ALTER TABLE meter_values ADD COLUMN IF NOT EXISTS context VARCHAR(30);
+ALTER TABLE meter_values ADD COLUMN IF NOT EXISTS format VARCHAR(20);
+ALTER TABLE meter_values ADD COLUMN IF NOT EXISTS phase VARCHAR(10);
+ALTER TABLE meter_values ADD COLUMN IF NOT EXISTS location VARCHAR(10);
+
+-- Vehicle state of charge of transactions, from SoC meter values
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS start_soc DOUBLE PRECISION; -- %
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS current_soc DOUBLE PRECISION; -- %
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS end_soc DOUBLE PRECISION; -- %
+
+-- Searching the transactions of an idTag, most recent first
+CREATE INDEX IF NOT EXISTS transactions_id_tag_start_idx ON transactions(id_tag, start_time DESC, id DESC);
+
+-- Hourly grid carbon intensity per price area
+CREATE TABLE IF NOT EXISTS carbon_intensities (
+    price_area VARCHAR(10) NOT NULL,
+    hour_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    co2_per_kwh DOUBLE PRECISION NOT NULL, -- g/kWh
+    renewable_share DOUBLE PRECISION NOT NULL, -- 0-1
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (price_area, hour_start)
+);
+
+-- MeterValues requested by no_telemetry alert rules when they fire
+ALTER TABLE alert_rules ADD COLUMN IF NOT EXISTS trigger_meter_values BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Attempts of retried commands
+ALTER TABLE commands ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 1;
+
+-- Reboot loops of charge points sending repeated BootNotifications
+ALTER TABLE charge_points ADD COLUMN IF NOT EXISTS reboot_loop_since TIMESTAMP WITH TIME ZONE;
+
+-- Inbound OCPP frames that failed parsing or validation, kept for review
+CREATE TABLE IF NOT EXISTS quarantined_messages (
+    id SERIAL PRIMARY KEY,
+    charge_point_id VARCHAR(100) NOT NULL,
+    action VARCHAR(100),
+    payload TEXT NOT NULL,
+    error TEXT NOT NULL,
+    received_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    reviewed_by VARCHAR(100)
+);
+CREATE INDEX IF NOT EXISTS quarantined_messages_cp_id_idx ON quarantined_messages(charge_point_id, id DESC);
+
+-- Upstream central systems the OCPP traffic of charge points is forwarded to
+CREATE TABLE IF NOT EXISTS upstream_gateways (
+    charge_point_id VARCHAR(100) PRIMARY KEY,
+    url TEXT NOT NULL,
+    actions TEXT[] NOT NULL, -- Empty forwards all requests
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Transaction IDs assigned by the upstream central system of a gateway charge point, which the charge point uses
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS upstream_transaction_id INTEGER;
+CREATE INDEX IF NOT EXISTS transactions_upstream_id_idx ON transactions(charge_point_id, upstream_transaction_id)
+    WHERE upstream_transaction_id IS NOT NULL;
+
+-- Erasures are scoped to the tenant of the idTag, as idTags are only unique within a tenant
+ALTER TABLE erasures ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(100);
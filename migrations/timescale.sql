@@ -0,0 +1,94 @@
+-- Optional TimescaleDB mode, applied after schema.sql on servers with the timescaledb extension.
+-- Enable it in the CPMS with TIMESCALE_ENABLED=true.
+
+CREATE EXTENSION IF NOT EXISTS timescaledb;
+
+-- Convert the monthly partitioned meter_values table into a hypertable with monthly chunks
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = 'meter_values'::regclass) THEN
+        RETURN;
+    END IF;
+
+    ALTER TABLE meter_values RENAME TO meter_values_partitioned;
+    ALTER INDEX meter_values_pkey RENAME TO meter_values_partitioned_pkey;
+    ALTER SEQUENCE meter_values_id_seq OWNED BY NONE;
+    DROP INDEX IF EXISTS meter_values_transaction_idx;
+    DROP INDEX IF EXISTS meter_values_cp_connector_idx;
+    DROP INDEX IF EXISTS meter_values_session_idx;
+    DROP INDEX IF EXISTS meter_values_timestamp_idx;
+
+    CREATE TABLE meter_values (
+        id INTEGER NOT NULL DEFAULT nextval('meter_values_id_seq'),
+        transaction_id INTEGER REFERENCES transactions(id),
+        charge_point_id VARCHAR(100) NOT NULL REFERENCES charge_points(id),
+        connector_id INTEGER NOT NULL,
+        timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+        value DOUBLE PRECISION NOT NULL,
+        unit VARCHAR(10) NOT NULL,
+        measurand VARCHAR(50) NOT NULL,
+        created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+        session_id UUID,
+        timestamp_adjusted BOOLEAN NOT NULL DEFAULT FALSE,
+        context VARCHAR(30),
+        format VARCHAR(20),
+        phase VARCHAR(10),
+        location VARCHAR(10),
+        PRIMARY KEY (id, timestamp),
+        CONSTRAINT meter_values_connector_fk FOREIGN KEY (charge_point_id, connector_id) REFERENCES connectors(charge_point_id, id)
+    );
+    ALTER SEQUENCE meter_values_id_seq OWNED BY meter_values.id;
+    PERFORM create_hypertable('meter_values', 'timestamp', chunk_time_interval => INTERVAL '1 month');
+
+    INSERT INTO meter_values (
+        id, transaction_id, charge_point_id, connector_id, timestamp, value, unit, measurand, created_at, session_id,
+        timestamp_adjusted, context, format, phase, location
+    )
+    SELECT id, transaction_id, charge_point_id, connector_id, timestamp, value, unit, measurand, created_at, session_id,
+        timestamp_adjusted, context, format, phase, location
+    FROM meter_values_partitioned;
+
+    DROP TABLE meter_values_partitioned;
+END $$;
+
+CREATE INDEX IF NOT EXISTS meter_values_transaction_idx ON meter_values(transaction_id);
+CREATE INDEX IF NOT EXISTS meter_values_cp_connector_idx ON meter_values(charge_point_id, connector_id);
+CREATE INDEX IF NOT EXISTS meter_values_session_idx ON meter_values(session_id);
+CREATE INDEX IF NOT EXISTS meter_values_timestamp_idx ON meter_values(timestamp);
+
+-- Connector status history as a hypertable with weekly chunks. Unique keys must include the time column.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_name = 'connector_status_events') THEN
+        RETURN;
+    END IF;
+
+    ALTER TABLE connector_status_events DROP CONSTRAINT connector_status_events_pkey;
+    ALTER TABLE connector_status_events ADD PRIMARY KEY (id, timestamp);
+    PERFORM create_hypertable('connector_status_events', 'timestamp',
+        chunk_time_interval => INTERVAL '7 days', migrate_data => TRUE);
+END $$;
+
+-- Hourly energy register readings per connector in kWh. The energy delivered in an hour is the
+-- difference to the previous hour's highest reading, see PostgresStore.GetHourlyEnergy.
+CREATE MATERIALIZED VIEW IF NOT EXISTS meter_values_hourly_energy
+WITH (timescaledb.continuous) AS
+SELECT
+    charge_point_id,
+    connector_id,
+    time_bucket(INTERVAL '1 hour', timestamp) AS bucket,
+    min(CASE WHEN unit = 'kWh' THEN value ELSE value / 1000 END) AS min_kwh,
+    max(CASE WHEN unit = 'kWh' THEN value ELSE value / 1000 END) AS max_kwh
+FROM meter_values
+WHERE measurand = 'Energy.Active.Import.Register'
+GROUP BY charge_point_id, connector_id, bucket
+WITH NO DATA;
+
+-- Refresh recent hours only, so buckets stay available after their raw samples are pruned.
+-- History from before the conversion is materialized once with
+--   CALL refresh_continuous_aggregate('meter_values_hourly_energy', NULL, now() - INTERVAL '3 days');
+SELECT add_continuous_aggregate_policy('meter_values_hourly_energy',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE);